@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gengo/goship/lib/annotation"
+)
+
+// checkAnnotations reports the active critical annotations in "list" to the deployment output,
+// and returns an error if any of them blocks deployments.
+func checkAnnotations(list []annotation.Annotation, report func(line string)) error {
+	var blocking *annotation.Annotation
+	for i, a := range list {
+		if a.Severity != annotation.Critical {
+			continue
+		}
+		line := fmt.Sprintf("annotation: %s (by %s)", a.Message, a.By)
+		if a.Blocking() {
+			line += " blocks deployments"
+			if blocking == nil {
+				blocking = &list[i]
+			}
+		}
+		report(line)
+	}
+	if blocking != nil {
+		return fmt.Errorf("deployments are blocked by the critical annotation of %s: %s", blocking.By, blocking.Message)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/annotation"
+)
+
+func TestCheckAnnotations(t *testing.T) {
+	for _, spec := range []struct {
+		desc    string
+		list    []annotation.Annotation
+		lines   []string
+		blocked bool
+	}{
+		{desc: "no annotations"},
+		{
+			desc: "non-critical annotations",
+			list: []annotation.Annotation{
+				{Message: "flaky metrics", Severity: annotation.Warning, By: "alice"},
+				{Message: "new dashboards", Severity: annotation.Info, By: "bob"},
+			},
+		},
+		{
+			desc: "critical annotation without blocking",
+			list: []annotation.Annotation{
+				{Message: "DB migration", Severity: annotation.Critical, By: "alice"},
+				{Message: "flaky metrics", Severity: annotation.Warning, By: "bob"},
+			},
+			lines: []string{"annotation: DB migration (by alice)"},
+		},
+		{
+			desc: "blocking critical annotation",
+			list: []annotation.Annotation{
+				{Message: "DB migration", Severity: annotation.Critical, By: "alice"},
+				{Message: "failover drill", Severity: annotation.Critical, By: "bob", BlocksDeploys: true},
+			},
+			lines:   []string{"annotation: DB migration (by alice)", "annotation: failover drill (by bob) blocks deployments"},
+			blocked: true,
+		},
+		{
+			desc: "blocking flag of non-critical annotation",
+			list: []annotation.Annotation{
+				{Message: "flaky metrics", Severity: annotation.Warning, By: "alice", BlocksDeploys: true},
+			},
+		},
+	} {
+		var lines []string
+		err := checkAnnotations(spec.list, func(line string) { lines = append(lines, line) })
+		if blocked := err != nil; blocked != spec.blocked {
+			t.Errorf("checkAnnotations(list, report) failed with %v with %s; want blocked = %v", err, spec.desc, spec.blocked)
+		}
+		if !reflect.DeepEqual(lines, spec.lines) {
+			t.Errorf("reported lines = %q with %s; want %q", lines, spec.desc, spec.lines)
+		}
+	}
+}
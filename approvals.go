@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// approvalTimeout is how long deployments wait for approval before their requests expire.
+const approvalTimeout = 4 * time.Hour
+
+var (
+	errApprovalRequested   = errors.New("deployment is waiting for approval")
+	errApprovalUnavailable = errors.New("deployment requires approval, but approvals are not available")
+)
+
+// pendingDeployment is the payload of an approval request, which starts the deployment once approved.
+type pendingDeployment struct {
+	User    string        `json:"user"`
+	Deploy  RevRange      `json:"deploy"`
+	Source  RevRange      `json:"source"`
+	Options deployOptions `json:"options"`
+}
+
+// requestApproval requests approval of the deployment of "ev" by "user", which deploy would start with the rest of the arguments.
+func (h DeployHandler) requestApproval(ctx context.Context, ev notifier.Event, user string, deploy, src RevRange, opts deployOptions, now time.Time) error {
+	if h.approvals == nil {
+		return errApprovalUnavailable
+	}
+	d := pendingDeployment{User: user, Deploy: deploy, Source: src, Options: opts}
+	if err := h.approvals.Request(ev, now.Add(approvalTimeout), d); err != nil {
+		reqlog.Errorf(ctx, "Failed to request approval of %s: %v", ev.ID, err)
+		return err
+	}
+	reqlog.Infof(ctx, "%s requested approval to deploy %s-%s as %s", user, ev.Project, ev.Environment, ev.ID)
+	return errApprovalRequested
+}
+
+// deployApproved starts the deployment of the approved request "a" on behalf of its requester with the latest configuration.
+func (h DeployHandler) deployApproved(ctx context.Context, a notifier.Approval) error {
+	var d pendingDeployment
+	if err := json.Unmarshal(a.Payload, &d); err != nil {
+		return err
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		return err
+	}
+	proj, env, err := config.ResolveTarget(c.Projects, a.Event.Project, a.Event.Environment)
+	if err != nil {
+		return err
+	}
+	d.Options.Approved = true
+	_, err = h.deploy(ctx, c, d.User, *proj, *env, d.Deploy, d.Source, d.Options)
+	return err
+}
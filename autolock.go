@@ -0,0 +1,28 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// lockOnFailure locks "env" with "lock" if the deployment "ev" into it has failed at "now" and the environment is configured to,
+// and notifies the lock through "n". It returns the lock, or nil unless the environment has been locked.
+// Failures to lock are only logged since the deployment has failed anyway.
+func lockOnFailure(ctx context.Context, lock func(proj, env, id string, now time.Time) (config.AutoLock, error), n notifier.Notifier, ev notifier.Event, env config.Environment, success bool, now time.Time) *config.AutoLock {
+	if success || !env.LockOnFailure {
+		return nil
+	}
+	l, err := lock(ev.Project, ev.Environment, ev.ID, now)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to lock %s-%s after the failed deployment %s: %v", ev.Project, ev.Environment, ev.ID, err)
+		return nil
+	}
+	reqlog.Infof(ctx, "Locked %s-%s: %s", ev.Project, ev.Environment, l.Reason)
+	ev.Type, ev.User, ev.Reason = notifier.AutoLocked, l.By, l.Reason
+	n.Notify(ev)
+	return &l
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"golang.org/x/net/context"
+)
+
+func TestLockOnFailure(t *testing.T) {
+	now := time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)
+	ev := notifier.Event{Type: notifier.DeployFailed, ID: "api-production-1", Project: "api", Environment: "production", User: "alice"}
+	for _, spec := range []struct {
+		desc    string
+		env     config.Environment
+		success bool
+		fail    bool
+		locked  bool
+	}{
+		{desc: "failure", env: config.Environment{Name: "production", LockOnFailure: true}, locked: true},
+		{desc: "success", env: config.Environment{Name: "production", LockOnFailure: true}, success: true},
+		{desc: "failure without lock_on_failure", env: config.Environment{Name: "production"}},
+		{desc: "failure to lock", env: config.Environment{Name: "production", LockOnFailure: true}, fail: true},
+	} {
+		var (
+			events []notifier.Event
+			calls  []string
+		)
+		lock := func(proj, env, id string, at time.Time) (config.AutoLock, error) {
+			calls = append(calls, proj+"-"+env+" "+id)
+			if spec.fail {
+				return config.AutoLock{}, errors.New("etcd unavailable")
+			}
+			return config.AutoLock{Reason: "auto-locked: deploy " + id + " failed", By: config.AutoLockOwner, Since: at, DeployID: id}, nil
+		}
+		got := lockOnFailure(context.Background(), lock, recordingNotifier{events: &events}, ev, spec.env, spec.success, now)
+		if !spec.locked {
+			if got != nil || len(events) != 0 {
+				t.Errorf("lockOnFailure(...) = %#v and notified %#v on %s; want nothing", got, events, spec.desc)
+			}
+			if spec.success && len(calls) != 0 {
+				t.Errorf("lockOnFailure(...) locked %q on %s; want no locks", calls, spec.desc)
+			}
+			continue
+		}
+		want := config.AutoLock{Reason: "auto-locked: deploy api-production-1 failed", By: "goship", Since: now, DeployID: "api-production-1"}
+		if got == nil || *got != want {
+			t.Errorf("lockOnFailure(...) = %#v on %s; want %#v", got, spec.desc, want)
+		}
+		if len(calls) != 1 || calls[0] != "api-production api-production-1" {
+			t.Errorf("lockOnFailure(...) locked %q on %s; want api-production for api-production-1", calls, spec.desc)
+		}
+		if len(events) != 1 || events[0].Type != notifier.AutoLocked || events[0].User != "goship" || events[0].Reason != want.Reason || events[0].ID != ev.ID {
+			t.Errorf("lockOnFailure(...) notified %#v on %s; want an %s event by goship", events, spec.desc, notifier.AutoLocked)
+		}
+	}
+}
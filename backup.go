@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/backup"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// runBackup writes an archive of all the state of goship into the file of -out in "args", and reports it to "w".
+// i.e. goship backup -out state.tar.gz
+func runBackup(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "File which the archive is written into")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	m, err := backup.Export(f, etcd.NewClient([]string{*ETCDServer}), *dataPath, time.Now())
+	if err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Backed up %d keys and %d deploy histories into %s\n", m.Keys, m.Files, *out)
+	return nil
+}
+
+// runRestore restores the archive in the file of -in in "args", and reports it to "w".
+// It refuses to overwrite existing state unless -force. Secrets are re-encrypted with the primary key of "keys" if needed.
+// i.e. goship restore -in state.tar.gz
+func runRestore(args []string, keys *config.Keyring, w io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("in", "", "File which the archive is read from")
+	force := fs.Bool("force", false, "Restore even if goship already has state, overwriting the keys and deploy histories in the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	res, err := restoreState(f, etcd.NewClient([]string{*ETCDServer}), keys, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Restored %d keys and %d deploy histories from %s\n", res.Keys, res.Files, *in)
+	if res.Rekeyed > 0 {
+		fmt.Fprintf(w, "Re-encrypted secrets in %d keys\n", res.Rekeyed)
+	}
+	return nil
+}
+
+// restoreResult is the result of restoreState.
+type restoreResult struct {
+	backup.Manifest
+	// Rekeyed is the number of keys whose secrets were re-encrypted.
+	Rekeyed int `json:"rekeyed"`
+}
+
+// restoreState restores the archive in "r" into "s" and the deploy histories.
+// The secrets in the archive must be decryptable with "keys". If they were encrypted with another master key,
+// which "keys" has as the previous one, they are re-encrypted with the primary key afterwards.
+func restoreState(r io.Reader, s backup.Store, keys *config.Keyring, force bool) (restoreResult, error) {
+	var stale bool
+	check := func(key, value string) error {
+		st, err := config.CheckSecrets(key, value)
+		stale = stale || st
+		return err
+	}
+	historyMu.Lock()
+	m, err := backup.Import(r, s, *dataPath, backup.Options{Force: force, Check: check})
+	historyMu.Unlock()
+	if err != nil {
+		return restoreResult{}, err
+	}
+	res := restoreResult{Manifest: m}
+	if stale {
+		if res.Rekeyed, err = config.Rekey(s, keys); err != nil {
+			return res, fmt.Errorf("restored, but failed to re-encrypt secrets: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// backupHandler serves an archive of all the state of goship. Only admins can download it.
+// i.e. curl -o state.tar.gz http://127.0.0.1:8000/admin/backup
+type backupHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+}
+
+func (h backupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	// buffers the archive so that failures are reported instead of a truncated archive.
+	var buf bytes.Buffer
+	now := time.Now()
+	if _, err := backup.Export(&buf, h.ecl, *dataPath, now); err != nil {
+		glog.Errorf("Failed to back up state: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s downloaded a backup", u.Name)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="goship-%s.tar.gz"`, now.UTC().Format("20060102T150405Z")))
+	if _, err := buf.WriteTo(w); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// restoreHandler restores an archive posted by an admin. It refuses to overwrite existing state unless force=true.
+// i.e. curl --data-binary @state.tar.gz 'http://127.0.0.1:8000/admin/restore?force=true'
+type restoreHandler struct {
+	ecl     *etcd.Client
+	keys    *config.Keyring
+	isAdmin func(user string) bool
+	feed    *activity.Feed
+}
+
+func (h restoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	res, err := restoreState(r.Body, h.ecl, h.keys, r.FormValue("force") == "true")
+	switch err.(type) {
+	case nil:
+	case backup.InvalidError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		if err == backup.ErrNotEmpty {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		glog.Errorf("Failed to restore state: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.feed.Record(activity.Entry{Type: activity.ConfigChanged, User: u.Name, Summary: fmt.Sprintf("%s restored %d keys and %d deploy histories from a backup", u.Name, res.Keys, res.Files)})
+	buf, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
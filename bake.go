@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+// bakeWait returns how long "rev" must still bake to have run for "required" since it was successfully deployed
+// in "entries" of an environment, or zero if it has baked long enough. It returns false if "rev" has never been
+// successfully deployed there.
+func bakeWait(entries []DeployLogEntry, rev revision.Revision, required time.Duration, now time.Time) (time.Duration, bool) {
+	var since time.Time
+	found := false
+	for _, e := range entries {
+		if !e.Success || e.Range.To != rev {
+			continue
+		}
+		// the revision runs once the deployment finishes.
+		t := e.Time.Add(e.Duration)
+		if !found || t.Before(since) {
+			since, found = t, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if wait := since.Add(required).Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// checkBake returns an error if "rev" has not baked in the environment which "env" of "proj" requires for long enough
+// at "now", unless "override" is true. Revisions which have never been deployed there are rejected even if "override" is true.
+// Overrides are recorded in the activity feed on behalf of "user".
+func (h DeployHandler) checkBake(ctx context.Context, proj config.Project, env config.Environment, user string, rev revision.Revision, now time.Time, override bool, report func(line string)) error {
+	b := env.RequiresBake
+	if b == nil {
+		return nil
+	}
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj.Name, b.Environment))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read deployments of %s-%s: %v", proj.Name, b.Environment, err)
+	}
+	wait, ok := bakeWait(entries, rev, b.Duration(), now)
+	if !ok {
+		return fmt.Errorf("%s has never been deployed into %s; it must run there for %s before %s", rev.Short(), b.Environment, b.Duration(), env.Name)
+	}
+	if wait == 0 {
+		return nil
+	}
+	report(fmt.Sprintf("bake: %s must run in %s for %s more", rev.Short(), b.Environment, wait))
+	if !override {
+		return fmt.Errorf("%s has not baked in %s for %s yet; wait %s more or deploy with override_bake=true to ship it anyway",
+			rev.Short(), b.Environment, b.Duration(), wait)
+	}
+	reqlog.Warningf(ctx, "%s overrode the bake time to deploy %s into %s-%s %s early", user, rev.Short(), proj.Name, env.Name, wait)
+	if h.feed != nil {
+		h.feed.Record(activity.Entry{
+			Type:        activity.BakeOverridden,
+			Project:     proj.Name,
+			Environment: env.Name,
+			User:        user,
+			Summary:     fmt.Sprintf("%s deployed %s into %s-%s %s before it baked in %s", user, rev.Short(), proj.Name, env.Name, wait, b.Environment),
+		})
+	}
+	return nil
+}
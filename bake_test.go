@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+func TestBakeWait(t *testing.T) {
+	deployed := time.Date(2016, 7, 20, 10, 0, 0, 0, time.UTC)
+	entries := []DeployLogEntry{
+		{Range: RevRange{From: "aaa", To: "bbb"}, Success: true, Time: deployed.Add(-time.Hour)},
+		// finished 5 minutes after it started.
+		{Range: RevRange{From: "bbb", To: "ccc"}, Success: true, Time: deployed.Add(-5 * time.Minute), Duration: 5 * time.Minute},
+		{Range: RevRange{From: "ccc", To: "ddd"}, Success: false, Time: deployed.Add(-3 * time.Hour)},
+		// redeployed after a rollback; the first deployment counts.
+		{Range: RevRange{From: "ddd", To: "bbb"}, Success: true, Time: deployed.Add(time.Hour)},
+	}
+	for _, spec := range []struct {
+		rev     revision.Revision
+		elapsed time.Duration
+		want    time.Duration
+		wantOK  bool
+	}{
+		{rev: "ccc", elapsed: 0, want: 2 * time.Hour, wantOK: true},
+		{rev: "ccc", elapsed: 2*time.Hour - time.Second, want: time.Second, wantOK: true},
+		{rev: "ccc", elapsed: 2 * time.Hour, want: 0, wantOK: true},
+		{rev: "ccc", elapsed: 3 * time.Hour, want: 0, wantOK: true},
+		{rev: "bbb", elapsed: time.Hour, want: 0, wantOK: true},
+		{rev: "bbb", elapsed: 30 * time.Minute, want: 30 * time.Minute, wantOK: true},
+		// failed deployments do not bake.
+		{rev: "ddd", elapsed: 10 * time.Hour},
+		// skipped the environment.
+		{rev: "eee", elapsed: 10 * time.Hour},
+	} {
+		now := deployed.Add(spec.elapsed)
+		got, ok := bakeWait(entries, spec.rev, 2*time.Hour, now)
+		if got != spec.want || ok != spec.wantOK {
+			t.Errorf("bakeWait(entries, %q, 2h, %s) = %s, %t; want %s, %t", spec.rev, now, got, ok, spec.want, spec.wantOK)
+		}
+	}
+}
+
+func TestCheckBake(t *testing.T) {
+	withDataPath(t, func() {
+		deployed := time.Date(2016, 7, 20, 10, 0, 0, 0, time.UTC)
+		if err := appendEntry("api", "staging", DeployLogEntry{Range: RevRange{From: "aaa", To: "bbb"}, Success: true, Time: deployed}); err != nil {
+			t.Fatalf("appendEntry failed with %v", err)
+		}
+		proj := config.Project{Name: "api"}
+		env := config.Environment{Name: "production", RequiresBake: &config.BakeRequirement{Environment: "staging", Minutes: 120}}
+		for _, spec := range []struct {
+			rev      revision.Revision
+			elapsed  time.Duration
+			override bool
+			// msg is a part of the error, or empty if the deployment is allowed.
+			msg string
+		}{
+			{rev: "bbb", elapsed: 2 * time.Hour},
+			{rev: "bbb", elapsed: 90 * time.Minute, msg: "wait 30m0s more"},
+			{rev: "bbb", elapsed: 90 * time.Minute, override: true},
+			{rev: "ccc", elapsed: 10 * time.Hour, msg: "never been deployed into staging"},
+			{rev: "ccc", elapsed: 10 * time.Hour, override: true, msg: "never been deployed into staging"},
+		} {
+			var h DeployHandler
+			now := deployed.Add(spec.elapsed)
+			err := h.checkBake(context.Background(), proj, env, "alice", spec.rev, now, spec.override, func(string) {})
+			if spec.msg == "" {
+				if err != nil {
+					t.Errorf("checkBake(%q) failed with %v after %s with override=%t", spec.rev, err, spec.elapsed, spec.override)
+				}
+				continue
+			}
+			if err == nil || !strings.Contains(err.Error(), spec.msg) {
+				t.Errorf("checkBake(%q) = %v after %s with override=%t; want an error with %q", spec.rev, err, spec.elapsed, spec.override, spec.msg)
+			}
+		}
+
+		// environments without the requirement are not checked.
+		var h DeployHandler
+		if err := h.checkBake(context.Background(), proj, config.Environment{Name: "qa"}, "alice", "ccc", deployed, false, func(string) {}); err != nil {
+			t.Errorf("checkBake(%q) failed with %v; want no requirement", "ccc", err)
+		}
+	})
+}
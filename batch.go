@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+// defaultBatchParallelism is the number of environments deployed at a time in a batch unless specified.
+const defaultBatchParallelism = 2
+
+// batchRequest is a request of a batch deployment into environments of a project.
+type batchRequest struct {
+	Environments []string `json:"environments"`
+	// Revision is deployed into all the environments. Each environment is deployed to its latest deployable revision if empty.
+	Revision revision.Revision `json:"revision"`
+	// Parallelism is the maximum number of environments deployed at a time.
+	Parallelism int `json:"parallelism"`
+	// ContinueOnError makes the batch go on with the rest of environments after a failure.
+	ContinueOnError bool `json:"continue_on_error"`
+	// Note is the reason of the deployments. It is required if any of the environments requires.
+	Note string `json:"note"`
+	// Confirm maps environments to their confirm phrases. It is required for environments with confirm phrases.
+	Confirm map[string]string `json:"confirm"`
+}
+
+// batchResult is the result of a batch deployment.
+type batchResult struct {
+	ID      string      `json:"id"`
+	Success bool        `json:"success"`
+	Steps   []ChainStep `json:"environments"`
+}
+
+// refs validates "req" against "proj" and returns references to the requested environments.
+func (req batchRequest) refs(proj config.Project) ([]config.EnvironmentRef, error) {
+	if len(req.Environments) == 0 {
+		return nil, fmt.Errorf("no environments specified")
+	}
+	if req.Parallelism < 0 {
+		return nil, fmt.Errorf("invalid parallelism %d", req.Parallelism)
+	}
+	known := make(map[string]bool)
+	for _, e := range proj.Environments {
+		known[e.Name] = true
+	}
+	seen := make(map[string]bool)
+	var refs []config.EnvironmentRef
+	for _, name := range req.Environments {
+		if !known[name] {
+			return nil, fmt.Errorf("no such environment %s in %s", name, proj.Name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("environment %s specified twice", name)
+		}
+		seen[name] = true
+		refs = append(refs, config.EnvironmentRef{Project: proj.Name, Environment: name})
+	}
+	return refs, nil
+}
+
+// runBatch runs "step" for each environment in "refs" with at most "parallelism" steps at a time.
+// Steps are started in order. Unless "continueOnError", no more steps are started once a step fails, and they are reported as skipped.
+// Locked environments do not stop the batch but it does not succeed as a whole.
+// "step" returns the status of the step. An error means the step failed.
+func runBatch(ctx context.Context, refs []config.EnvironmentRef, parallelism int, continueOnError bool, step func(ref config.EnvironmentRef) (string, error)) (steps []ChainStep, success bool) {
+	if parallelism <= 0 {
+		parallelism = defaultBatchParallelism
+	}
+	steps = make([]ChainStep, len(refs))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+		sem    = make(chan struct{}, parallelism)
+	)
+	for i, ref := range refs {
+		steps[i] = ChainStep{Project: ref.Project, Environment: ref.Environment, Status: chainSkipped}
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed && !continueOnError
+		mu.Unlock()
+		if stop {
+			<-sem
+			continue
+		}
+		wg.Add(1)
+		go func(i int, ref config.EnvironmentRef) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, err := step(ref)
+			if err != nil {
+				reqlog.Errorf(ctx, "Failed to deploy %s in a batch: %v", ref, err)
+				status = chainFailed
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			steps[i].Status = status
+			if status == chainFailed {
+				failed = true
+			}
+		}(i, ref)
+	}
+	wg.Wait()
+
+	success = true
+	for _, st := range steps {
+		if st.Status != chainSucceeded {
+			success = false
+		}
+	}
+	return steps, success
+}
+
+// batchHandler deploys multiple environments of a project at once.
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/deploy-batch
+// with {"environments": ["us", "eu"], "revision": "abc123", "parallelism": 2, "continue_on_error": false}
+type batchHandler struct {
+	DeployHandler
+}
+
+func (h batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 6 || components[4] == "" || components[5] != "deploy-batch" {
+		http.NotFound(w, r)
+		return
+	}
+	projName := components[4]
+	id := reqlog.FromRequest(r)
+	ctx := reqlog.NewContext(context.Background(), id)
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch current user: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch latest configuration: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, err := acl.FindProject(ac, c.Projects, u, projName)
+	if err != nil {
+		respondTargetError(w, id, err)
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		reqlog.Error(w, id, "permission denied", http.StatusForbidden)
+		return
+	}
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+	refs, err := req.refs(*proj)
+	if err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	for _, ref := range refs {
+		_, e, err := config.ResolveTarget(c.Projects, ref.Project, ref.Environment)
+		if err != nil {
+			reqlog.ErrorWithSuggestions(w, id, err.Error(), http.StatusBadRequest, config.Suggestions(err))
+			return
+		}
+		if err := e.ValidateDeployNote(req.Note); err != nil {
+			reqlog.Error(w, id, err.Error(), statusUnprocessableEntity)
+			return
+		}
+	}
+	if respondUnconfirmed(w, id, checkConfirmation(c, refs, func(ref config.EnvironmentRef) []string { return []string{req.Confirm[ref.Environment]} })) {
+		return
+	}
+
+	res := h.deployBatch(ctx, c, u.Name, *proj, refs, req)
+	buf, err := json.Marshal(res)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to marshal batch status: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		reqlog.Errorf(ctx, "Failed to send response: %v", err)
+	}
+}
+
+// deployBatch deploys the environments in "refs" as requested in "req", and records the batch as a whole
+// into the deploy history of each of the environments.
+func (h batchHandler) deployBatch(ctx context.Context, c config.Config, user string, proj config.Project, refs []config.EnvironmentRef, req batchRequest) batchResult {
+	start := time.Now()
+	opts := deployOptions{ChainID: deployID(proj.Name, "batch", start), Note: req.Note}
+	steps, success := runBatch(ctx, refs, req.Parallelism, req.ContinueOnError, func(ref config.EnvironmentRef) (string, error) {
+		_, e, err := config.ResolveTarget(c.Projects, ref.Project, ref.Environment)
+		if err != nil {
+			return "", err
+		}
+		if e.IsLocked() {
+			return chainLocked, nil
+		}
+		rng, err := h.latestRange(ctx, c, proj, *e)
+		if err != nil {
+			return "", err
+		}
+		if req.Revision != "" {
+			rng.To = req.Revision
+		}
+		ok, err := h.deploy(ctx, c, user, proj, *e, rng, RevRange{}, opts)
+		if err != nil || !ok {
+			return chainFailed, err
+		}
+		return chainSucceeded, nil
+	})
+
+	entry := DeployLogEntry{
+		ID:        opts.ChainID,
+		Range:     RevRange{To: req.Revision},
+		User:      user,
+		Success:   success,
+		Time:      start,
+		Duration:  time.Since(start),
+		ChainID:   opts.ChainID,
+		Chain:     steps,
+		Batch:     true,
+		Note:      req.Note,
+		RequestID: reqlog.FromContext(ctx),
+	}
+	for _, ref := range refs {
+		if err := appendEntry(ref.Project, ref.Environment, entry); err != nil {
+			reqlog.Errorf(ctx, "Failed to insert an entry of batch %s into %s: %v", opts.ChainID, ref, err)
+		}
+	}
+	return batchResult{ID: opts.ChainID, Success: success, Steps: steps}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"golang.org/x/net/context"
+)
+
+func batchRefs(envs ...string) []config.EnvironmentRef {
+	var refs []config.EnvironmentRef
+	for _, e := range envs {
+		refs = append(refs, config.EnvironmentRef{Project: "api", Environment: e})
+	}
+	return refs
+}
+
+func TestRunBatchParallelism(t *testing.T) {
+	refs := batchRefs("us", "eu", "jp", "au", "br")
+	for _, spec := range []struct {
+		parallelism int
+		want        int
+	}{
+		{parallelism: 0, want: defaultBatchParallelism},
+		{parallelism: 1, want: 1},
+		{parallelism: 3, want: 3},
+		{parallelism: 10, want: len(refs)},
+	} {
+		var (
+			mu            sync.Mutex
+			running, peak int
+			called        int
+		)
+		steps, success := runBatch(context.Background(), refs, spec.parallelism, false, func(ref config.EnvironmentRef) (string, error) {
+			mu.Lock()
+			running++
+			called++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return chainSucceeded, nil
+		})
+		if !success || len(steps) != len(refs) || called != len(refs) {
+			t.Errorf("runBatch(ctx, refs, %d, false, step) = %#v, %v with %d calls; want all succeeded", spec.parallelism, steps, success, called)
+		}
+		if peak != spec.want {
+			t.Errorf("runBatch(ctx, refs, %d, false, step) ran %d steps at a time; want %d", spec.parallelism, peak, spec.want)
+		}
+	}
+}
+
+func TestRunBatchFailure(t *testing.T) {
+	refs := batchRefs("us", "eu", "jp", "au")
+	for _, spec := range []struct {
+		continueOnError bool
+		results         map[string]string
+		errs            map[string]error
+		want            []string
+	}{
+		{
+			results: map[string]string{"api/eu": chainFailed},
+			want:    []string{chainSucceeded, chainFailed, chainSkipped, chainSkipped},
+		},
+		{
+			errs: map[string]error{"api/us": errors.New("cannot run")},
+			want: []string{chainFailed, chainSkipped, chainSkipped, chainSkipped},
+		},
+		{
+			continueOnError: true,
+			results:         map[string]string{"api/eu": chainFailed},
+			want:            []string{chainSucceeded, chainFailed, chainSucceeded, chainSucceeded},
+		},
+		{
+			// locked environments are skipped without stopping the batch
+			results: map[string]string{"api/us": chainLocked},
+			want:    []string{chainLocked, chainSucceeded, chainSucceeded, chainSucceeded},
+		},
+	} {
+		var called []string
+		steps, success := runBatch(context.Background(), refs, 1, spec.continueOnError, func(ref config.EnvironmentRef) (string, error) {
+			called = append(called, ref.String())
+			if err := spec.errs[ref.String()]; err != nil {
+				return "", err
+			}
+			if st, ok := spec.results[ref.String()]; ok {
+				return st, nil
+			}
+			return chainSucceeded, nil
+		})
+		var got []string
+		for _, st := range steps {
+			got = append(got, st.Status)
+		}
+		if !reflect.DeepEqual(got, spec.want) || success {
+			t.Errorf("runBatch(ctx, refs, 1, %v, step) = %q, %v; want %q, false", spec.continueOnError, got, success, spec.want)
+		}
+		for i, st := range spec.want {
+			if st == chainSkipped && i < len(called) {
+				t.Errorf("step %s was called after a failure; called=%q", refs[i], called)
+			}
+		}
+	}
+}
+
+func TestBatchRequestRefs(t *testing.T) {
+	proj := config.Project{Name: "api", Environments: []config.Environment{{Name: "us"}, {Name: "eu"}}}
+	req := batchRequest{Environments: []string{"eu", "us"}}
+	got, err := req.refs(proj)
+	if err != nil {
+		t.Fatalf("req.refs(proj) failed with %v", err)
+	}
+	if want := batchRefs("eu", "us"); !reflect.DeepEqual(got, want) {
+		t.Errorf("req.refs(proj) = %#v; want %#v", got, want)
+	}
+
+	for _, req := range []batchRequest{
+		{},
+		{Environments: []string{"us", "jp"}},
+		{Environments: []string{"us", "us"}},
+		{Environments: []string{"us"}, Parallelism: -1},
+	} {
+		if got, err := req.refs(proj); err == nil {
+			t.Errorf("%#v.refs(proj) = %#v; want failure", req, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/blocklist"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// blockedCommits returns the entries in "list" whose commits deploying "rng" of "repo" ships, i.e. rng.To and the commits in it
+// but not in rng.From. Every ancestor of rng.To ships if rng.From is empty, e.g. the first deployment.
+func blockedCommits(gcl githublib.Client, repo config.Repo, list blocklist.List, rng RevRange) (blocklist.List, error) {
+	if len(list) == 0 || rng.To == "" {
+		return nil, nil
+	}
+	if rng.From == "" {
+		var found blocklist.List
+		for _, e := range list {
+			if e.Matches(string(rng.To)) {
+				found = append(found, e)
+				continue
+			}
+			comp, resp, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, e.SHA, string(rng.To))
+			if err != nil {
+				if resp != nil && resp.StatusCode == http.StatusNotFound {
+					// a global entry of another repository
+					continue
+				}
+				return nil, err
+			}
+			// rng.To is ahead of or identical to the blocklisted commit iff it contains the commit.
+			if comp.Status != nil && (*comp.Status == "ahead" || *comp.Status == "identical") {
+				found = append(found, e)
+			}
+		}
+		return found, nil
+	}
+	shas := []string{string(rng.To)}
+	if rng.From != rng.To {
+		comp, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(rng.From), string(rng.To))
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range comp.Commits {
+			if c.SHA != nil {
+				shas = append(shas, *c.SHA)
+			}
+		}
+	}
+	return list.Contained(shas), nil
+}
+
+// checkBlocklist returns an error if deploying "deploy" into "env" of "proj" ships blocklisted commits unless "override" is true.
+// Overrides are recorded in the activity feed on behalf of "user". See refuseBlocklisted.
+func (h DeployHandler) checkBlocklist(ctx context.Context, proj config.Project, env, user string, deploy, src RevRange, override bool, report func(line string)) error {
+	list, err := blocklist.Load(h.ecl)
+	if err != nil {
+		return fmt.Errorf("could not load blocklist: %v", err)
+	}
+	found, err := refuseBlocklisted(h.gcl, proj, list.For(proj.Name), deploy, src, override, report)
+	if err != nil || len(found) == 0 {
+		return err
+	}
+	reqlog.Warningf(ctx, "%s overrode the blocklist to deploy %d blocklisted commits into %s-%s", user, len(found), proj.Name, env)
+	if h.feed != nil {
+		h.feed.Record(activity.Entry{
+			Type:        activity.BlocklistOverridden,
+			Project:     proj.Name,
+			Environment: env,
+			User:        user,
+			Summary:     fmt.Sprintf("%s deployed %d blocklisted commits into %s-%s on purpose", user, len(found), proj.Name, env),
+		})
+	}
+	return nil
+}
+
+// refuseBlocklisted returns an error if deploying "deploy" of "proj" ships commits in "list" unless "override" is true.
+// The source revisions in "src" are checked instead if known. Blocklisted commits are reported to "report",
+// and returned if they are shipped on purpose.
+func refuseBlocklisted(gcl githublib.Client, proj config.Project, list blocklist.List, deploy, src RevRange, override bool, report func(line string)) (blocklist.List, error) {
+	rng := deploy
+	if src.To != "" {
+		rng = src
+	} else if proj.RepoType == config.RepoTypeDocker {
+		// images are not commits.
+		return nil, nil
+	}
+	found, err := blockedCommits(gcl, proj.SourceRepo(), list, rng)
+	if err != nil {
+		if override {
+			report(fmt.Sprintf("blocklist: could not be checked: %v", err))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not check blocklisted commits in %s...%s: %v", rng.From.Short(), rng.To.Short(), err)
+	}
+	for _, e := range found {
+		report(fmt.Sprintf("blocklist: %s was blocklisted by %s: %s", e.SHA, e.By, e.Reason))
+	}
+	if len(found) > 0 && !override {
+		return nil, fmt.Errorf("%s...%s contains blocklisted commit %s: %s; deploy with override_blocklist=true to ship it anyway",
+			rng.From.Short(), rng.To.Short(), found[0].SHA, found[0].Reason)
+	}
+	return found, nil
+}
+
+// blocklistHandler lists, adds or removes blocklisted commits. Only admins can access the blocklist.
+// i.e. GET http://127.0.0.1:8000/admin/blocklist
+// or POST http://127.0.0.1:8000/admin/blocklist with {"sha": "0123abc", "project": "api", "reason": "corrupts sessions"}
+// or DELETE http://127.0.0.1:8000/admin/blocklist?sha=0123abc&project=api
+type blocklistHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	// feed records changes of the blocklist.
+	feed *activity.Feed
+}
+
+func (h blocklistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	var resp interface{}
+	switch r.Method {
+	case "POST":
+		var e blocklist.Entry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, "malformed entry: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := blocklist.Add(h.ecl, e, u.Name, time.Now())
+		if err != nil {
+			glog.Errorf("Failed to blocklist %s: %v", e.SHA, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("%s blocklisted %s of %s: %s", u.Name, added.SHA, scopeName(added.Project), added.Reason)
+		h.feed.Record(activity.Entry{Type: activity.BlocklistChanged, Project: added.Project, User: u.Name, Summary: fmt.Sprintf("%s blocklisted %s: %s", u.Name, added.SHA, added.Reason)})
+		resp = added
+	case "DELETE":
+		sha, project := r.FormValue("sha"), r.FormValue("project")
+		if err := blocklist.Remove(h.ecl, project, sha); err != nil {
+			if err == blocklist.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			glog.Errorf("Failed to remove %s from the blocklist: %v", sha, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("%s removed %s of %s from the blocklist", u.Name, sha, scopeName(project))
+		h.feed.Record(activity.Entry{Type: activity.BlocklistChanged, Project: project, User: u.Name, Summary: fmt.Sprintf("%s removed %s from the blocklist", u.Name, sha)})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		list, err := blocklist.Load(h.ecl)
+		if err != nil {
+			glog.Errorf("Failed to load blocklist: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = list
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// scopeName describes the scope of a blocklist entry of "project".
+func scopeName(project string) string {
+	if project == "" {
+		return "all projects"
+	}
+	return project
+}
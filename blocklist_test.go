@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/blocklist"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// historyClient is a githublib.Client which compares commits of a linear history like the comparison API.
+type historyClient struct {
+	githublib.Client
+	history []string
+	calls   int
+	fail    bool
+}
+
+func (c *historyClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	c.calls++
+	if c.fail {
+		return nil, nil, errors.New("unavailable")
+	}
+	b, h := c.index(base), c.index(head)
+	if b < 0 || h < 0 {
+		resp := &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}
+		return nil, resp, &github.ErrorResponse{Response: resp.Response, Message: "Not Found"}
+	}
+	comp := &github.CommitsComparison{Status: github.String("identical")}
+	switch {
+	case h > b:
+		comp.Status = github.String("ahead")
+		for _, sha := range c.history[b+1 : h+1] {
+			comp.Commits = append(comp.Commits, github.RepositoryCommit{SHA: github.String(sha)})
+		}
+	case h < b:
+		comp.Status = github.String("behind")
+	}
+	return comp, nil, nil
+}
+
+func (c *historyClient) index(sha string) int {
+	for i, s := range c.history {
+		if strings.HasPrefix(s, sha) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestBlockedCommits(t *testing.T) {
+	gcl := &historyClient{history: []string{"c0000000000", "c1111111111", "bad2222222222", "c3333333333", "c4444444444"}}
+	repo := config.Repo{RepoOwner: "gengo", RepoName: "api"}
+	list := blocklist.List{
+		{SHA: "bad2222", Reason: "corrupts sessions"},
+		// a global entry of another repository
+		{SHA: "0ther00", Reason: "breaks another repo"},
+	}
+	for _, spec := range []struct {
+		desc string
+		rng  RevRange
+		want []string
+	}{
+		{desc: "range before the commit", rng: RevRange{From: "c0000000000", To: "c1111111111"}},
+		{desc: "range containing the commit", rng: RevRange{From: "c1111111111", To: "c4444444444"}, want: []string{"corrupts sessions"}},
+		{desc: "range ending at the commit", rng: RevRange{From: "c0000000000", To: "bad2222222222"}, want: []string{"corrupts sessions"}},
+		{desc: "range after the commit", rng: RevRange{From: "c3333333333", To: "c4444444444"}},
+		{desc: "rollback", rng: RevRange{From: "c4444444444", To: "c1111111111"}},
+		{desc: "redeploy", rng: RevRange{From: "c1111111111", To: "c1111111111"}},
+		{desc: "first deploy after the commit", rng: RevRange{To: "c3333333333"}, want: []string{"corrupts sessions"}},
+		{desc: "first deploy before the commit", rng: RevRange{To: "c1111111111"}},
+	} {
+		got, err := blockedCommits(gcl, repo, list, spec.rng)
+		if err != nil {
+			t.Errorf("blockedCommits(gcl, repo, list, %v) failed with %v with %s", spec.rng, err, spec.desc)
+			continue
+		}
+		var reasons []string
+		for _, e := range got {
+			reasons = append(reasons, e.Reason)
+		}
+		if !reflect.DeepEqual(reasons, spec.want) {
+			t.Errorf("blockedCommits(gcl, repo, list, %v) = %q with %s; want %q", spec.rng, reasons, spec.desc, spec.want)
+		}
+	}
+
+	gcl.calls = 0
+	if got, err := blockedCommits(gcl, repo, nil, RevRange{From: "c1111111111", To: "c4444444444"}); err != nil || got != nil || gcl.calls != 0 {
+		t.Errorf("blockedCommits(gcl, repo, nil, rng) = %v, %v with %d calls; want nothing without calls", got, err, gcl.calls)
+	}
+}
+
+func TestRefuseBlocklisted(t *testing.T) {
+	gcl := &historyClient{history: []string{"c0000000000", "bad1111111111", "c2222222222"}}
+	proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, RepoType: config.RepoTypeGithub}
+	list := blocklist.List{{SHA: "bad1111", Reason: "corrupts sessions", By: "alice"}}
+	deploy := RevRange{From: "c0000000000", To: "c2222222222"}
+
+	var lines []string
+	report := func(line string) { lines = append(lines, line) }
+	if _, err := refuseBlocklisted(gcl, proj, list, deploy, RevRange{}, false, report); err == nil || !strings.Contains(err.Error(), "corrupts sessions") {
+		t.Errorf("refuseBlocklisted(..., override=false) failed with %v; want the reason of the blocklisted commit", err)
+	}
+	if want := []string{"blocklist: bad1111 was blocklisted by alice: corrupts sessions"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("reported lines = %q; want %q", lines, want)
+	}
+
+	found, err := refuseBlocklisted(gcl, proj, list, deploy, RevRange{}, true, report)
+	if err != nil || len(found) != 1 {
+		t.Errorf("refuseBlocklisted(..., override=true) = %v, %v; want the blocklisted commit shipped", found, err)
+	}
+
+	// source revisions of images
+	docker := proj
+	docker.RepoType = config.RepoTypeDocker
+	images := RevRange{From: "image-0", To: "image-2"}
+	if found, err := refuseBlocklisted(gcl, docker, list, images, RevRange{}, false, report); err != nil || found != nil {
+		t.Errorf("refuseBlocklisted(images without source) = %v, %v; want no check", found, err)
+	}
+	if _, err := refuseBlocklisted(gcl, docker, list, images, deploy, false, report); err == nil {
+		t.Errorf("refuseBlocklisted(images, source) succeeded; want failure")
+	}
+
+	gcl.fail = true
+	if _, err := refuseBlocklisted(gcl, proj, list, deploy, RevRange{}, false, report); err == nil {
+		t.Errorf("refuseBlocklisted(...) succeeded without GitHub; want failure")
+	}
+	if _, err := refuseBlocklisted(gcl, proj, list, deploy, RevRange{}, true, report); err != nil {
+		t.Errorf("refuseBlocklisted(..., override=true) failed with %v without GitHub; want success", err)
+	}
+}
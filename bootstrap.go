@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/revision"
+	gcrrev "github.com/gengo/goship/lib/revision/gcr"
+	githubrev "github.com/gengo/goship/lib/revision/github"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// bootstrapUser is the user recorded in deploy records imported by bootstrap.
+const bootstrapUser = "goship-bootstrap"
+
+// deployedRevisionFunc returns the revision deployed into "host" of "env".
+type deployedRevisionFunc func(ctx context.Context, host string, proj config.Project, env config.Environment) (revision.Revision, error)
+
+// bootstrapResult is the result of importing the deploy state of an environment.
+type bootstrapResult struct {
+	Project, Environment string
+	// Revision is the revision recorded as deployed.
+	Revision revision.Revision
+	// Skipped is true if the environment already had deploy records.
+	Skipped bool
+	// Hosts maps host names to their deployed revisions. It is set only if the hosts disagree.
+	Hosts map[string]revision.Revision
+	Err   error
+}
+
+// runBootstrap imports the deploy state of all the environments from their hosts and reports the results to "w".
+func runBootstrap(ctx context.Context, w io.Writer) error {
+	ecl := etcd.NewClient([]string{*ETCDServer})
+	gcl, err := newGithubClient(ecl)
+	if err != nil {
+		return err
+	}
+	dcl, err := docker.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+	c, err := config.Load(ecl)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dataPath, 0777); err != nil {
+		return err
+	}
+
+	hostKeys := hostkeys.NewChecker(ecl, hostkeys.ConfiguredTOFU(ecl))
+	deployed := func(ctx context.Context, host string, proj config.Project, env config.Environment) (revision.Revision, error) {
+		ctrl, err := newControl(gcl, dcl, hostKeys, c.DeployUser, proj)
+		if err != nil {
+			return "", err
+		}
+		rev, _, err := ctrl.LatestDeployed(ctx, host, proj, env)
+		return rev, err
+	}
+	var failed bool
+	for _, r := range bootstrap(ctx, c, deployed, time.Now()) {
+		switch {
+		case r.Err != nil:
+			failed = true
+			fmt.Fprintf(w, "%s-%s: failed: %v\n", r.Project, r.Environment, r.Err)
+			continue
+		case r.Skipped:
+			fmt.Fprintf(w, "%s-%s: skipped (already has deploy records)\n", r.Project, r.Environment)
+			continue
+		}
+		fmt.Fprintf(w, "%s-%s: imported %s\n", r.Project, r.Environment, r.Revision)
+		if r.Hosts == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s-%s: hosts disagree:\n", r.Project, r.Environment)
+		hosts := make([]string, 0, len(r.Hosts))
+		for h := range r.Hosts {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		for _, h := range hosts {
+			fmt.Fprintf(w, "\t%s\t%s\n", h, r.Hosts[h])
+		}
+	}
+	if failed {
+		return fmt.Errorf("failed to import some environments")
+	}
+	return nil
+}
+
+// newControl returns a revision.Control for "proj". It verifies keys of hosts with "hostKeys" if not nil.
+func newControl(gcl githublib.Client, dcl *docker.Client, hostKeys ssh.HostKeyChecker, deployUser string, proj config.Project) (revision.Control, error) {
+	s, err := ssh.WithPrivateKeyFile(deployUser, *keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if hostKeys != nil {
+		s = s.WithHostKeys(hostKeys)
+	}
+	s = config.WithSSHAuth(s, proj.Environments...)
+	c := githubrev.New(gcl, s)
+	switch t := proj.RepoType; t {
+	case config.RepoTypeGithub:
+	case config.RepoTypeDocker:
+		c = gcrrev.New(c, dcl, s)
+	default:
+		return nil, fmt.Errorf("unknown repository type %q", t)
+	}
+	return c, nil
+}
+
+// bootstrap polls all hosts and records the most common revision in each environment as a synthetic deploy record.
+// Environments which already have deploy records are skipped, so that re-running it does not duplicate records.
+func bootstrap(ctx context.Context, c config.Config, deployed deployedRevisionFunc, now time.Time) []bootstrapResult {
+	var results []bootstrapResult
+	for _, proj := range c.Projects {
+		for _, env := range proj.Environments {
+			r := bootstrapEnvironment(ctx, proj, env, deployed, now)
+			if r.Err != nil {
+				glog.Errorf("Failed to import deploy state of %s-%s: %v", proj.Name, env.Name, r.Err)
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func bootstrapEnvironment(ctx context.Context, proj config.Project, env config.Environment, deployed deployedRevisionFunc, now time.Time) bootstrapResult {
+	r := bootstrapResult{Project: proj.Name, Environment: env.Name}
+	basename := fmt.Sprintf("%s-%s", proj.Name, env.Name)
+	file := path.Join(*dataPath, basename+".json")
+	if err := prepareDataFiles(file); err != nil {
+		r.Err = err
+		return r
+	}
+	entries, err := readEntries(basename)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if len(entries) > 0 {
+		r.Skipped = true
+		return r
+	}
+
+	hosts := pollHosts(ctx, proj, env, deployed)
+	if len(hosts) == 0 {
+		r.Err = fmt.Errorf("no revision found in hosts %q", config.HostNames(env.Hosts))
+		return r
+	}
+	var agreed bool
+	r.Revision, agreed = mostCommonRevision(hosts)
+	if !agreed {
+		r.Hosts = hosts
+	}
+
+	entries = append(entries, DeployLogEntry{
+		ID:       deployID(proj.Name, env.Name, now),
+		Range:    RevRange{To: r.Revision},
+		User:     bootstrapUser,
+		Success:  true,
+		Time:     now,
+		Imported: true,
+	})
+	r.Err = writeJSON(entries, file)
+	return r
+}
+
+// pollHosts returns a map from hosts in "env" to their deployed revisions.
+// Hosts whose revisions are not available are omitted.
+func pollHosts(ctx context.Context, proj config.Project, env config.Environment, deployed deployedRevisionFunc) map[string]revision.Revision {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		hosts = make(map[string]revision.Revision)
+	)
+	for _, host := range config.HostNames(env.Hosts) {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			rev, err := deployed(ctx, host, proj, env)
+			if err != nil || rev == "" {
+				glog.Errorf("Failed to get deployed revision in %s (%s-%s): %v", host, proj.Name, env.Name, err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			hosts[host] = rev
+		}(host)
+	}
+	wg.Wait()
+	return hosts
+}
+
+// mostCommonRevision returns the revision deployed into the largest number of hosts.
+// Ties are broken by the lexical order of revisions so that the result is stable.
+// "agreed" is true iff all hosts have the same revision.
+func mostCommonRevision(hosts map[string]revision.Revision) (rev revision.Revision, agreed bool) {
+	counts := make(map[revision.Revision]int)
+	for _, r := range hosts {
+		counts[r]++
+	}
+	var best int
+	for r, n := range counts {
+		if n > best || (n == best && r < rev) {
+			rev, best = r, n
+		}
+	}
+	return rev, len(counts) == 1
+}
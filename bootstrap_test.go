@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+func withDataPath(t *testing.T, f func()) {
+	dir, err := ioutil.TempDir("", "goship-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+	orig := *dataPath
+	*dataPath = dir
+	defer func() { *dataPath = orig }()
+	f()
+}
+
+func stubDeployed(revs map[string]revision.Revision) deployedRevisionFunc {
+	return func(ctx context.Context, host string, proj config.Project, env config.Environment) (revision.Revision, error) {
+		rev, ok := revs[host]
+		if !ok {
+			return "", fmt.Errorf("host %s unreachable", host)
+		}
+		return rev, nil
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	c := config.Config{
+		Projects: []config.Project{
+			{
+				Name: "api",
+				Environments: []config.Environment{
+					{Name: "staging", Hosts: []config.Host{{Name: "s1"}, {Name: "s2"}}},
+					{Name: "production", Hosts: []config.Host{{Name: "p1"}, {Name: "p2"}, {Name: "p3"}, {Name: "p4"}}},
+					{Name: "qa", Hosts: []config.Host{{Name: "q1"}}},
+				},
+			},
+		},
+	}
+	deployed := stubDeployed(map[string]revision.Revision{
+		"s1": "aaa", "s2": "aaa",
+		// split-brain
+		"p1": "bbb", "p2": "ccc", "p3": "bbb",
+		// p4 and q1 are unreachable
+	})
+	now := time.Date(2015, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	withDataPath(t, func() {
+		got := bootstrap(context.Background(), c, deployed, now)
+		if len(got) != 3 {
+			t.Fatalf("bootstrap(...) = %#v; want 3 results", got)
+		}
+		if got[0].Err != nil || got[0].Revision != "aaa" || got[0].Hosts != nil {
+			t.Errorf("got[0] = %#v; want aaa without disagreement", got[0])
+		}
+		if got[1].Err != nil || got[1].Revision != "bbb" {
+			t.Errorf("got[1] = %#v; want bbb", got[1])
+		}
+		if want := map[string]revision.Revision{"p1": "bbb", "p2": "ccc", "p3": "bbb"}; !reflect.DeepEqual(got[1].Hosts, want) {
+			t.Errorf("got[1].Hosts = %v; want %v", got[1].Hosts, want)
+		}
+		if got[2].Err == nil {
+			t.Errorf("got[2].Err = nil; want an error for an environment without reachable hosts")
+		}
+
+		entries, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		want := []DeployLogEntry{{
+			ID:       deployID("api", "production", now),
+			Range:    RevRange{To: "bbb"},
+			User:     bootstrapUser,
+			Success:  true,
+			Time:     now,
+			Imported: true,
+		}}
+		if !reflect.DeepEqual(entries, want) {
+			t.Errorf("entries = %#v; want %#v", entries, want)
+		}
+
+		// re-running does not duplicate the imported records
+		got = bootstrap(context.Background(), c, deployed, now.Add(time.Hour))
+		if !got[0].Skipped || !got[1].Skipped {
+			t.Errorf("bootstrap(...) = %#v; want the imported environments skipped", got)
+		}
+		entries, err = readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("entries = %#v; want 1 entry", entries)
+		}
+	})
+}
+
+func TestMostCommonRevision(t *testing.T) {
+	for _, spec := range []struct {
+		hosts  map[string]revision.Revision
+		rev    revision.Revision
+		agreed bool
+	}{
+		{hosts: map[string]revision.Revision{"h1": "aaa"}, rev: "aaa", agreed: true},
+		{hosts: map[string]revision.Revision{"h1": "aaa", "h2": "aaa"}, rev: "aaa", agreed: true},
+		{hosts: map[string]revision.Revision{"h1": "bbb", "h2": "aaa", "h3": "bbb"}, rev: "bbb", agreed: false},
+		{hosts: map[string]revision.Revision{"h1": "bbb", "h2": "aaa"}, rev: "aaa", agreed: false},
+	} {
+		rev, agreed := mostCommonRevision(spec.hosts)
+		if rev != spec.rev || agreed != spec.agreed {
+			t.Errorf("mostCommonRevision(%v) = %q, %v; want %q, %v", spec.hosts, rev, agreed, spec.rev, spec.agreed)
+		}
+	}
+}
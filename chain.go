@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// Statuses of steps in chained deployments
+const (
+	chainSucceeded = "succeeded"
+	chainFailed    = "failed"
+	chainLocked    = "locked"
+	chainSkipped   = "skipped"
+)
+
+// ChainStep is the status of a step in a chained deployment.
+type ChainStep struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	Status      string `json:"status"`
+}
+
+// runChain runs "step" for each environment in "chain" in order, and stops at the first step which does not succeed.
+// The remaining steps are reported as skipped.
+// "step" returns the status of the step. An error means the step failed.
+func runChain(ctx context.Context, chain []config.EnvironmentRef, step func(ref config.EnvironmentRef) (string, error)) (steps []ChainStep, success bool) {
+	success = true
+	for _, ref := range chain {
+		st := ChainStep{Project: ref.Project, Environment: ref.Environment, Status: chainSkipped}
+		if success {
+			status, err := step(ref)
+			if err != nil {
+				reqlog.Errorf(ctx, "Failed to deploy %s in a chain: %v", ref, err)
+				status = chainFailed
+			}
+			st.Status = status
+			success = status == chainSucceeded
+		}
+		steps = append(steps, st)
+	}
+	return steps, success
+}
+
+// deployChain deploys the dependencies of "env" in order before "env" itself, and records the chain as a whole
+// into the deploy history of "env".
+func (h DeployHandler) deployChain(ctx context.Context, w http.ResponseWriter, c config.Config, user string, proj config.Project, env config.Environment, deploy, src RevRange, opts deployOptions) {
+	id := reqlog.FromContext(ctx)
+	chain, err := config.DeployChain(c.Projects, proj.Name, env.Name)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to resolve dependencies of %s-%s: %v", proj.Name, env.Name, err)
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start := time.Now()
+	opts.ChainID = deployID(proj.Name, env.Name, start)
+	target := config.EnvironmentRef{Project: proj.Name, Environment: env.Name}
+	steps, success := runChain(ctx, chain, func(ref config.EnvironmentRef) (string, error) {
+		p, e, err := config.ResolveTarget(c.Projects, ref.Project, ref.Environment)
+		if err != nil {
+			return "", err
+		}
+		if e.IsLocked() {
+			return chainLocked, nil
+		}
+		if err := e.ValidateDeployNote(opts.Note); err != nil {
+			return "", err
+		}
+		rng, srcRng, stepOpts := deploy, src, opts
+		if ref != target {
+			if rng, err = h.latestRange(ctx, c, *p, *e); err != nil {
+				return "", err
+			}
+			// dependencies are deployed from their own branches, and flags are allowed per environment.
+			srcRng, stepOpts.Branch, stepOpts.Flags = RevRange{}, "", nil
+		}
+		ok, err := h.deploy(ctx, c, user, *p, *e, rng, srcRng, stepOpts)
+		if err != nil || !ok {
+			return chainFailed, err
+		}
+		return chainSucceeded, nil
+	})
+
+	err = appendEntry(proj.Name, env.Name, DeployLogEntry{
+		ID:        opts.ChainID,
+		Range:     deploy,
+		User:      user,
+		Success:   success,
+		Time:      start,
+		Duration:  time.Since(start),
+		ChainID:   opts.ChainID,
+		Chain:     steps,
+		Note:      opts.Note,
+		RequestID: id,
+	})
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to insert an entry: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := json.Marshal(steps)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to marshal chain status: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		reqlog.Errorf(ctx, "Failed to send response: %v", err)
+	}
+}
+
+// latestRange returns the range from the revision deployed into the first host of "env" to the latest deployable revision.
+func (h DeployHandler) latestRange(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error) {
+	ctrl, err := newControl(h.gcl, h.dcl, h.hostKeys, c.DeployUser, proj)
+	if err != nil {
+		return RevRange{}, err
+	}
+	var rng RevRange
+	if rng.To, _, err = ctrl.Latest(ctx, proj, env); err != nil {
+		return RevRange{}, err
+	}
+	if len(env.Hosts) == 0 {
+		return rng, nil
+	}
+	if rng.From, _, err = ctrl.LatestDeployed(ctx, env.Hosts[0].Name, proj, env); err != nil {
+		return RevRange{}, fmt.Errorf("failed to get revision deployed into %s: %v", env.Hosts[0].Name, err)
+	}
+	return rng, nil
+}
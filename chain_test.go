@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"golang.org/x/net/context"
+)
+
+func TestRunChain(t *testing.T) {
+	chain := []config.EnvironmentRef{
+		{Project: "db", Environment: "production"},
+		{Project: "api", Environment: "production"},
+		{Project: "worker", Environment: "production"},
+	}
+	for _, spec := range []struct {
+		results map[string]string
+		errs    map[string]error
+		want    []string
+		success bool
+	}{
+		{
+			want:    []string{chainSucceeded, chainSucceeded, chainSucceeded},
+			success: true,
+		},
+		{
+			results: map[string]string{"api/production": chainFailed},
+			want:    []string{chainSucceeded, chainFailed, chainSkipped},
+		},
+		{
+			results: map[string]string{"db/production": chainLocked},
+			want:    []string{chainLocked, chainSkipped, chainSkipped},
+		},
+		{
+			errs: map[string]error{"worker/production": errors.New("cannot run")},
+			want: []string{chainSucceeded, chainSucceeded, chainFailed},
+		},
+	} {
+		var called []string
+		steps, success := runChain(context.Background(), chain, func(ref config.EnvironmentRef) (string, error) {
+			called = append(called, ref.String())
+			if err := spec.errs[ref.String()]; err != nil {
+				return "", err
+			}
+			if st, ok := spec.results[ref.String()]; ok {
+				return st, nil
+			}
+			return chainSucceeded, nil
+		})
+		var got []string
+		for _, st := range steps {
+			got = append(got, st.Status)
+		}
+		if !reflect.DeepEqual(got, spec.want) || success != spec.success {
+			t.Errorf("runChain(ctx, ...) = %q, %v; want %q, %v", got, success, spec.want, spec.success)
+		}
+		for i, st := range spec.want {
+			if st == chainSkipped && i < len(called) {
+				t.Errorf("step %s was called after a failure; called=%q", chain[i], called)
+			}
+		}
+	}
+}
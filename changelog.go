@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// storyNameTTL is how long names of Pivotal stories are cached for changelogs.
+const storyNameTTL = time.Hour
+
+// changelog is the changes between two deployments of an environment grouped by the stories they refer to.
+type changelog struct {
+	Title    string
+	Sections []changelogSection
+}
+
+// changelogSection is the commits which refer to the same story, or to no stories.
+type changelogSection struct {
+	Title   string
+	Commits []string
+}
+
+// Markdown renders "l" in Markdown.
+func (l changelog) Markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n", l.Title)
+	if len(l.Sections) == 0 {
+		buf.WriteString("\nNo changes.\n")
+	}
+	for _, s := range l.Sections {
+		fmt.Fprintf(&buf, "\n## %s\n\n", s.Title)
+		for _, c := range s.Commits {
+			fmt.Fprintf(&buf, "- %s\n", c)
+		}
+	}
+	return buf.String()
+}
+
+var changelogHTML = template.Must(template.New("changelog").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Sections}}<h2>{{.Title}}</h2>
+<ul>
+{{range .Commits}}<li>{{.}}</li>
+{{end}}</ul>
+{{else}}<p>No changes.</p>
+{{end}}</body>
+</html>
+`))
+
+// changelogHandler renders the changes between two deployments of an environment as release notes.
+// Commits are grouped by the Pivotal stories or the JIRA issues they refer to like GitHub releases, and titled with the names of
+// the stories. The deployments are given by their IDs in the deploy log as "from_deploy" and "to_deploy".
+// "to_deploy" defaults to the latest successful deployment, and "from_deploy" to the successful one before it.
+// The changelog is in Markdown, or in HTML with "format=html".
+// i.e. GET http://127.0.0.1:8000/api/v1/projects/my-project/environments/production/changelog?format=html
+type changelogHandler struct {
+	ac   acl.AccessControl
+	load func() (config.Config, error)
+	gcl  githublib.Client
+	// history returns the deploy history of "env" of "proj".
+	history func(proj, env string) ([]DeployLogEntry, error)
+	// namer returns the StoryNamer of Pivotal configured in "c", or nil if Pivotal is not configured.
+	namer func(c config.Config) pivotal.StoryNamer
+	names *pivotal.NameCache
+}
+
+func newChangelogHandler(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client) changelogHandler {
+	return changelogHandler{
+		ac:   ac,
+		load: func() (config.Config, error) { return config.Load(ecl) },
+		gcl:  gcl,
+		history: func(proj, env string) ([]DeployLogEntry, error) {
+			return readEntries(fmt.Sprintf("%s-%s", proj, env))
+		},
+		namer: func(c config.Config) pivotal.StoryNamer {
+			if c.Pivotal == nil || c.Pivotal.Token == "" {
+				return nil
+			}
+			return pivotal.NewStoryNamer(c.Pivotal.Token)
+		},
+		names: pivotal.NewNameCache(storyNameTTL),
+	}
+}
+
+func (h changelogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 8 || components[4] == "" || components[5] != "environments" || components[6] == "" || components[7] != "changelog" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+	id := reqlog.FromRequest(r)
+	ctx := reqlog.NewContext(context.Background(), id)
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch current user: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := h.load()
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch latest configuration: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, env, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		respondTargetError(w, id, err)
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		reqlog.Error(w, id, "permission denied", http.StatusForbidden)
+		return
+	}
+	entries, err := h.history(proj.Name, env.Name)
+	if err != nil && !os.IsNotExist(err) {
+		reqlog.Errorf(ctx, "Failed to read the deploy log of %s-%s: %v", proj.Name, env.Name, err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	from, to, err := changelogRange(entries, r.FormValue("from_deploy"), r.FormValue("to_deploy"))
+	if err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusNotFound)
+		return
+	}
+	l, err := h.changelog(ctx, c, *proj, *env, from, to)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to make the changelog of %s-%s: %v", proj.Name, env.Name, err)
+		reqlog.Error(w, id, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if r.FormValue("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := changelogHTML.Execute(w, l); err != nil {
+			reqlog.Errorf(ctx, "Failed to send response: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	if _, err := w.Write([]byte(l.Markdown())); err != nil {
+		reqlog.Errorf(ctx, "Failed to send response: %v", err)
+	}
+}
+
+// changelogRange returns the deployments in "entries" identified by "fromID" and "toID".
+// "toID" defaults to the latest successful deployment, and "fromID" to the successful deployment before "to".
+func changelogRange(entries []DeployLogEntry, fromID, toID string) (from, to DeployLogEntry, err error) {
+	sorted := make([]DeployLogEntry, 0, len(entries))
+	for _, e := range entries {
+		// whole chains and batches are recorded by their steps too.
+		if e.Range.To != "" && len(e.Chain) == 0 {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.Sort(ByTime(sorted))
+
+	i := -1
+	for j, e := range sorted {
+		if (toID == "" && e.Success) || (toID != "" && e.ID == toID) {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		if toID == "" {
+			return from, to, fmt.Errorf("no successful deployments")
+		}
+		return from, to, fmt.Errorf("deployment %q not found", toID)
+	}
+	to = sorted[i]
+	for _, e := range sorted[i+1:] {
+		if (fromID == "" && e.Success) || (fromID != "" && e.ID == fromID) {
+			return e, to, nil
+		}
+	}
+	if fromID == "" {
+		return from, to, fmt.Errorf("no successful deployments before %s", to.Range.To.Short())
+	}
+	return from, to, fmt.Errorf("deployment %q not found before %s", fromID, to.Range.To.Short())
+}
+
+// changelog returns the changes from the revision deployed by "from" to the one by "to" into "env" of "proj".
+// Pivotal stories are titled with their names if Pivotal is configured in "c". Stories which have been deleted
+// or could not be looked up are titled only with their IDs.
+func (h changelogHandler) changelog(ctx context.Context, c config.Config, proj config.Project, env config.Environment, from, to DeployLogEntry) (changelog, error) {
+	l := changelog{Title: fmt.Sprintf("Changes in %s of %s from %s to %s", env.Name, proj.Name, from.Range.To.Short(), to.Range.To.Short())}
+	if from.Range.To == to.Range.To {
+		return l, nil
+	}
+	repo := proj.SourceRepo()
+	comp, _, err := h.gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(from.Range.To), string(to.Range.To))
+	if err != nil {
+		return l, err
+	}
+	namer := h.namer(c)
+	for _, g := range groupCommits(comp.Commits) {
+		s := changelogSection{Title: g.title, Commits: g.commits}
+		switch {
+		case g.story != 0 && namer != nil:
+			name, err := h.names.StoryName(namer, g.story)
+			switch {
+			case err == pivotal.ErrStoryNotFound:
+				s.Title += " (deleted)"
+			case err != nil:
+				reqlog.Warningf(ctx, "Failed to look up the name of Pivotal story #%d: %v", g.story, err)
+			default:
+				s.Title += ": " + name
+			}
+		case g.story == 0 && g.issue == "":
+			s.Title = "Uncategorized"
+		}
+		l.Sections = append(l.Sections, s)
+	}
+	return l, nil
+}
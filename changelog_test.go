@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// changelogClient is a githublib.Client which compares commits from fixtures keyed by "<base>...<head>".
+type changelogClient struct {
+	githublib.Client
+	comps map[string][]github.RepositoryCommit
+}
+
+func (c changelogClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	commits, ok := c.comps[base+"..."+head]
+	if !ok {
+		return nil, nil, errors.New("not found")
+	}
+	return &github.CommitsComparison{Commits: commits}, nil, nil
+}
+
+// fakeNamer is a pivotal.StoryNamer of the stories in "names". Other stories have been deleted.
+type fakeNamer struct {
+	names map[int]string
+	calls *int
+}
+
+func (n fakeNamer) StoryName(id int) (string, error) {
+	*n.calls++
+	name, ok := n.names[id]
+	if !ok {
+		return "", pivotal.ErrStoryNotFound
+	}
+	return name, nil
+}
+
+func TestChangelogRange(t *testing.T) {
+	t0 := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	entries := []DeployLogEntry{
+		{ID: "d1", Range: RevRange{From: "0000000", To: "1111111"}, Success: true, Time: t0},
+		{ID: "d2", Range: RevRange{From: "1111111", To: "2222222"}, Success: true, Time: t0.Add(time.Hour)},
+		{ID: "d3", Range: RevRange{From: "2222222", To: "3333333"}, Success: false, Time: t0.Add(2 * time.Hour)},
+		{ID: "d4", Range: RevRange{From: "2222222", To: "4444444"}, Success: true, Time: t0.Add(3 * time.Hour)},
+		// whole chain
+		{ID: "c1", Range: RevRange{From: "2222222", To: "4444444"}, Success: true, Time: t0.Add(4 * time.Hour), Chain: []ChainStep{{}}},
+	}
+	for _, spec := range []struct {
+		from, to         string
+		wantFrom, wantTo string
+		// wantErr is true if the deployments are not found.
+		wantErr bool
+	}{
+		{wantFrom: "d2", wantTo: "d4"},
+		{to: "d2", wantFrom: "d1", wantTo: "d2"},
+		{from: "d1", wantFrom: "d1", wantTo: "d4"},
+		{from: "d2", to: "d3", wantFrom: "d2", wantTo: "d3"},
+		{to: "d1", wantErr: true},
+		{from: "d4", to: "d2", wantErr: true},
+		{to: "unknown", wantErr: true},
+		{from: "c1", wantErr: true},
+	} {
+		from, to, err := changelogRange(entries, spec.from, spec.to)
+		if spec.wantErr {
+			if err == nil {
+				t.Errorf("changelogRange(entries, %q, %q) = %q, %q; want failure", spec.from, spec.to, from.ID, to.ID)
+			}
+			continue
+		}
+		if err != nil || from.ID != spec.wantFrom || to.ID != spec.wantTo {
+			t.Errorf("changelogRange(entries, %q, %q) = %q, %q, %v; want %q, %q", spec.from, spec.to, from.ID, to.ID, err, spec.wantFrom, spec.wantTo)
+		}
+	}
+	if _, _, err := changelogRange(nil, "", ""); err == nil {
+		t.Errorf("changelogRange(nil, %q, %q) succeeded; want failure without deployments", "", "")
+	}
+}
+
+func TestChangelog(t *testing.T) {
+	var calls int
+	h := changelogHandler{
+		gcl: changelogClient{comps: map[string][]github.RepositoryCommit{
+			"1111111aaa...2222222bbb": {
+				releaseCommit("a111111", "Add login [#123]"),
+				releaseCommit("b222222", "API-42 Fix timeout\n\nDetails"),
+				releaseCommit("c333333", "Bump version"),
+				releaseCommit("d444444", "Remove the old page [#456]"),
+				releaseCommit("e555555", "Fix login again [finishes #123]"),
+			},
+		}},
+		namer: func(c config.Config) pivotal.StoryNamer {
+			return fakeNamer{names: map[int]string{123: "Sign in with Google"}, calls: &calls}
+		},
+		names: pivotal.NewNameCache(time.Hour),
+	}
+	proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+	env := config.Environment{Name: "production"}
+	from := DeployLogEntry{ID: "d1", Range: RevRange{To: "1111111aaa"}}
+	to := DeployLogEntry{ID: "d2", Range: RevRange{From: "1111111aaa", To: "2222222bbb"}}
+
+	for i := 0; i < 2; i++ {
+		l, err := h.changelog(context.Background(), config.Config{}, proj, env, from, to)
+		if err != nil {
+			t.Fatalf("h.changelog(ctx, c, proj, env, from, to) failed with %v", err)
+		}
+		want := `# Changes in production of api from 1111111 to 2222222
+
+## Pivotal #123: Sign in with Google
+
+- a111111 Add login [#123] (alice)
+- e555555 Fix login again [finishes #123] (alice)
+
+## JIRA API-42
+
+- b222222 API-42 Fix timeout (alice)
+
+## Pivotal #456 (deleted)
+
+- d444444 Remove the old page [#456] (alice)
+
+## Uncategorized
+
+- c333333 Bump version (alice)
+`
+		if got := l.Markdown(); got != want {
+			t.Errorf("l.Markdown() = %q; want %q", got, want)
+		}
+	}
+	// names are cached
+	if calls != 2 {
+		t.Errorf("calls = %d; want 2 lookups of the stories", calls)
+	}
+
+	// without Pivotal
+	h.namer = func(c config.Config) pivotal.StoryNamer { return nil }
+	l, err := h.changelog(context.Background(), config.Config{}, proj, env, from, to)
+	if err != nil {
+		t.Fatalf("h.changelog(ctx, c, proj, env, from, to) failed with %v", err)
+	}
+	if got, want := l.Sections[0].Title, "Pivotal #123"; got != want {
+		t.Errorf("l.Sections[0].Title = %q without Pivotal; want %q", got, want)
+	}
+
+	// redeployment
+	l, err = h.changelog(context.Background(), config.Config{}, proj, env, to, to)
+	if err != nil || l.Markdown() != "# Changes in production of api from 2222222 to 2222222\n\nNo changes.\n" {
+		t.Errorf("h.changelog(ctx, c, proj, env, to, to) = %q, %v; want no changes", l.Markdown(), err)
+	}
+
+	if _, err := h.changelog(context.Background(), config.Config{}, proj, env, DeployLogEntry{Range: RevRange{To: "9999999"}}, to); err == nil {
+		t.Errorf("h.changelog with an unknown comparison succeeded; want failure")
+	}
+}
+
+func TestChangelogHTML(t *testing.T) {
+	l := changelog{Title: "Changes <1>", Sections: []changelogSection{{Title: "Pivotal #1: A & B", Commits: []string{"a111111 Fix <script> (alice)"}}}}
+	var buf bytes.Buffer
+	if err := changelogHTML.Execute(&buf, l); err != nil {
+		t.Fatalf("changelogHTML.Execute(&buf, l) failed with %v", err)
+	}
+	for _, want := range []string{"<h1>Changes &lt;1&gt;</h1>", "<h2>Pivotal #1: A &amp; B</h2>", "<li>a111111 Fix &lt;script&gt; (alice)</li>"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("changelogHTML.Execute(&buf, l) = %s; want %s", buf.String(), want)
+		}
+	}
+}
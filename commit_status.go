@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// States of GitHub commit statuses of deployments.
+const (
+	commitStatusPending = "pending"
+	commitStatusSuccess = "success"
+	commitStatusFailure = "failure"
+)
+
+// commitStatusDescriptions are the descriptions of commit statuses shown next to their contexts, e.g. "goship/production: deployed".
+var commitStatusDescriptions = map[string]string{
+	commitStatusPending: "deploying",
+	commitStatusSuccess: "deployed",
+	commitStatusFailure: "deploy failed",
+}
+
+// commitStatusContext returns the context of commit statuses of deployments into "env".
+// Statuses of the same context replace each other on GitHub, so redeployments of a revision update its status.
+func commitStatusContext(env string) string {
+	return "goship/" + env
+}
+
+// finalCommitStatus returns the state of the commit status of a finished deployment.
+func finalCommitStatus(success bool) string {
+	if success {
+		return commitStatusSuccess
+	}
+	return commitStatusFailure
+}
+
+// deployLogURL returns the absolute URL of the deploy log of "env" in "proj".
+func deployLogURL(proj, env string) string {
+	return externalBaseURL() + fmt.Sprintf("/deployLog/%s-%s", proj, env)
+}
+
+// postCommitStatus posts "state" of a deployment of "sha" into "env" by "user" to the repository of "proj" if enabled by proj.CommitStatuses.
+// Docker projects are skipped since they deploy images but not commits. Failures are only logged since they must not fail deployments.
+func postCommitStatus(ctx context.Context, gcl githublib.Client, proj config.Project, env, sha, user, state string) {
+	if !proj.CommitStatuses || proj.RepoType == config.RepoTypeDocker || sha == "" {
+		return
+	}
+	repo := proj.SourceRepo()
+	status := &github.RepoStatus{
+		State:       github.String(state),
+		TargetURL:   github.String(deployLogURL(proj.Name, env)),
+		Description: github.String(commitStatusDescriptions[state] + " by " + user),
+		Context:     github.String(commitStatusContext(env)),
+	}
+	if _, _, err := gcl.CreateStatus(repo.RepoOwner, repo.RepoName, sha, status); err != nil {
+		reqlog.Errorf(ctx, "Failed to post %s commit status of %s to %s/%s@%s: %v", state, commitStatusContext(env), repo.RepoOwner, repo.RepoName, sha, err)
+	}
+}
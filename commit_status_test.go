@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// statusClient is a githublib.Client which keeps the latest status per context of each ref like the statuses API.
+type statusClient struct {
+	githublib.Client
+	calls    int
+	statuses map[string]map[string]github.RepoStatus
+	fail     bool
+}
+
+func (c *statusClient) CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+	c.calls++
+	if c.fail {
+		return nil, nil, errors.New("unavailable")
+	}
+	key := owner + "/" + repo + "@" + ref
+	if c.statuses[key] == nil {
+		c.statuses[key] = make(map[string]github.RepoStatus)
+	}
+	c.statuses[key][*status.Context] = *status
+	return status, nil, nil
+}
+
+func TestPostCommitStatus(t *testing.T) {
+	orig := *externalURL
+	*externalURL = "https://goship.example.com/"
+	defer func() { *externalURL = orig }()
+
+	proj := config.Project{
+		Name:           "api",
+		Repo:           config.Repo{RepoOwner: "gengo", RepoName: "api"},
+		RepoType:       config.RepoTypeGithub,
+		CommitStatuses: true,
+	}
+	gcl := &statusClient{statuses: make(map[string]map[string]github.RepoStatus)}
+	postCommitStatus(context.Background(), gcl, proj, "production", "abc123", "alice", commitStatusPending)
+	postCommitStatus(context.Background(), gcl, proj, "production", "abc123", "alice", finalCommitStatus(false))
+	// redeployment of the same revision
+	postCommitStatus(context.Background(), gcl, proj, "production", "abc123", "alice", commitStatusPending)
+	postCommitStatus(context.Background(), gcl, proj, "production", "abc123", "alice", finalCommitStatus(true))
+	postCommitStatus(context.Background(), gcl, proj, "staging", "abc123", "alice", finalCommitStatus(false))
+
+	got := gcl.statuses["gengo/api@abc123"]
+	if len(gcl.statuses) != 1 || len(got) != 2 {
+		t.Fatalf("statuses = %#v; want statuses of 2 contexts on gengo/api@abc123", gcl.statuses)
+	}
+	for _, spec := range []struct {
+		context, state, description string
+		target                      string
+	}{
+		{context: "goship/production", state: "success", description: "deployed by alice", target: "https://goship.example.com/deployLog/api-production"},
+		{context: "goship/staging", state: "failure", description: "deploy failed by alice", target: "https://goship.example.com/deployLog/api-staging"},
+	} {
+		s, ok := got[spec.context]
+		if !ok {
+			t.Errorf("no status of %s; want %s", spec.context, spec.state)
+			continue
+		}
+		if *s.State != spec.state || *s.Description != spec.description || *s.TargetURL != spec.target {
+			t.Errorf("status of %s = %s %q %s; want %s %q %s", spec.context, *s.State, *s.Description, *s.TargetURL, spec.state, spec.description, spec.target)
+		}
+	}
+
+	gcl.calls = 0
+	disabled := proj
+	disabled.CommitStatuses = false
+	postCommitStatus(context.Background(), gcl, disabled, "production", "abc123", "alice", commitStatusPending)
+	docker := proj
+	docker.RepoType = config.RepoTypeDocker
+	postCommitStatus(context.Background(), gcl, docker, "production", "v1.2.3", "alice", commitStatusPending)
+	postCommitStatus(context.Background(), gcl, proj, "production", "", "alice", commitStatusPending)
+	if gcl.calls != 0 {
+		t.Errorf("CreateStatus called %d times; want no calls when disabled, for docker or without revisions", gcl.calls)
+	}
+
+	// failures are not fatal.
+	gcl.fail = true
+	postCommitStatus(context.Background(), gcl, proj, "production", "def456", "alice", commitStatusPending)
+	if gcl.calls != 1 {
+		t.Errorf("CreateStatus called %d times; want 1", gcl.calls)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// configDiff is the response of the diff of two versions of the config of a project.
+type configDiff struct {
+	From    int                   `json:"from"`
+	To      int                   `json:"to"`
+	Changes []config.ConfigChange `json:"changes"`
+}
+
+// configHistoryHandler lists the versions of the config of a project, diffs two of them, or rolls the project back to one of them,
+// which records a new version. Users who can read the project can list and diff the versions, and only admins can roll back.
+// Secrets in the versions are references, which never reveal the values.
+// i.e. GET http://127.0.0.1:8000/api/v1/projects/api/config/history
+// i.e. GET http://127.0.0.1:8000/api/v1/projects/api/config/diff?from=2&to=5
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/api/config/rollback?version=2
+type configHistoryHandler struct {
+	ac      acl.AccessControl
+	store   config.RenameStore
+	isAdmin func(user string) bool
+	// feed records rollbacks.
+	feed *activity.Feed
+}
+
+func (h configHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 7 || components[4] == "" || components[5] != "config" {
+		http.NotFound(w, r)
+		return
+	}
+	projName, action := components[4], components[6]
+	method := "GET"
+	if action == "rollback" {
+		method = "POST"
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.store)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, err := acl.FindProject(ac, c.Projects, u, projName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	var resp interface{}
+	switch action {
+	case "history":
+		versions, err := config.ConfigHistory(h.store, proj.Name)
+		if err != nil {
+			glog.Errorf("Failed to read the config history of %s: %v", proj.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = map[string]interface{}{"versions": versions}
+	case "diff":
+		diff, err := h.diff(proj.Name, r.FormValue("from"), r.FormValue("to"))
+		if err != nil {
+			http.Error(w, err.Error(), config.StatusCode(err))
+			return
+		}
+		resp = diff
+	case "rollback":
+		if !h.isAdmin(u.Name) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		version, err := parseVersion(r.FormValue("version"))
+		if err != nil {
+			http.Error(w, err.Error(), config.StatusCode(err))
+			return
+		}
+		v, err := config.RollbackProject(h.store, c, proj.Name, version, u.Name, time.Now())
+		if err != nil {
+			glog.Errorf("Failed to roll %s back to version %d: %v", proj.Name, version, err)
+			http.Error(w, err.Error(), config.StatusCode(err))
+			return
+		}
+		glog.Infof("%s rolled the config of %s back to version %d", u.Name, proj.Name, version)
+		h.feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: proj.Name, User: u.Name, Summary: fmt.Sprintf("%s rolled the config of %s back to version %d", u.Name, proj.Name, version)})
+		resp = v
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// diff returns the changes of the config of "proj" from the version "from" to "to".
+func (h configHistoryHandler) diff(proj, from, to string) (configDiff, error) {
+	a, err := parseVersion(from)
+	if err != nil {
+		return configDiff{}, err
+	}
+	b, err := parseVersion(to)
+	if err != nil {
+		return configDiff{}, err
+	}
+	va, err := config.GetConfigVersion(h.store, proj, a)
+	if err != nil {
+		return configDiff{}, err
+	}
+	vb, err := config.GetConfigVersion(h.store, proj, b)
+	if err != nil {
+		return configDiff{}, err
+	}
+	return configDiff{From: a, To: b, Changes: config.DiffVersions(va, vb)}, nil
+}
+
+// parseVersion parses "s" as a version number of the config history.
+func parseVersion(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, &config.Error{Kind: config.ErrInvalid, Msg: fmt.Sprintf("invalid version %q", s)}
+	}
+	return v, nil
+}
+
+// recordConfigVersion records the current config of the project "proj" in its history as changed by "author".
+// Failures are only logged since the change itself has been made.
+func recordConfigVersion(s config.ETCDInterface, proj, author, summary string) {
+	c, err := config.Load(s)
+	if err == nil {
+		_, err = config.RecordVersion(s, c, proj, author, summary, time.Now())
+	}
+	if err != nil {
+		glog.Errorf("Failed to record the config of %s in its history: %v", proj, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestConfigHistoryHandler(t *testing.T) {
+	s := make(webhookStore)
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, branch := range []string{"master", "release"} {
+		c := config.Config{Projects: []config.Project{{
+			Name:         "api",
+			Repo:         config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			TravisToken:  "travis-secret",
+			Environments: []config.Environment{{Name: "staging", Branch: branch}},
+		}}}
+		if err := config.Store(s, c); err != nil {
+			t.Fatalf("config.Store(s, c) failed with %v", err)
+		}
+		if _, err := config.RecordVersion(s, c, "api", "alice", "", now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("config.RecordVersion(s, c, %q, ...) failed with %v", "api", err)
+		}
+	}
+
+	admin := false
+	h := configHistoryHandler{ac: acl.Null, store: s, isAdmin: func(user string) bool { return admin }}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q, %q, nil) failed with %v", method, path, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("GET", "/api/v1/projects/api/config/history")
+	var history struct {
+		Versions []config.ConfigVersion `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil || w.Code != http.StatusOK || len(history.Versions) != 2 {
+		t.Fatalf("history = %d %s; want 2 versions", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "travis-secret") {
+		t.Errorf("history = %s; want no plaintext secrets", w.Body)
+	}
+
+	w = serve("GET", "/api/v1/projects/api/config/diff?from=1&to=2")
+	var diff configDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &diff); err != nil || len(diff.Changes) != 1 || diff.Changes[0].Path != "envs/staging/branch" {
+		t.Errorf("diff = %d %s; want the branch of staging", w.Code, w.Body)
+	}
+
+	for _, spec := range []struct {
+		method, path string
+		code         int
+	}{
+		{method: "GET", path: "/api/v1/projects/api/config/diff?from=1&to=9", code: http.StatusNotFound},
+		{method: "GET", path: "/api/v1/projects/api/config/diff?from=one&to=2", code: http.StatusBadRequest},
+		{method: "GET", path: "/api/v1/projects/web/config/history", code: http.StatusNotFound},
+		{method: "GET", path: "/api/v1/projects/api/config/rollback?version=1", code: http.StatusMethodNotAllowed},
+		{method: "POST", path: "/api/v1/projects/api/config/rollback?version=1", code: http.StatusForbidden},
+	} {
+		if w := serve(spec.method, spec.path); w.Code != spec.code {
+			t.Errorf("%s %s = %d %s; want %d", spec.method, spec.path, w.Code, w.Body, spec.code)
+		}
+	}
+
+	admin = true
+	w = serve("POST", "/api/v1/projects/api/config/rollback?version=1")
+	var v config.ConfigVersion
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil || w.Code != http.StatusOK || v.Version != 3 {
+		t.Fatalf("rollback = %d %s; want version 3", w.Code, w.Body)
+	}
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if _, env, err := config.EnvironmentFromName(c.Projects, "api", "staging"); err != nil || env.Branch != "master" {
+		t.Errorf("staging = %#v, %v after rollback; want branch master", env, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/golang/glog"
+)
+
+// statusPreconditionRequired is the HTTP status code 428, which net/http does not define yet.
+const statusPreconditionRequired = 428
+
+// confirmationRequired is the body of 428 responses to deployments without the confirm phrases of the environments.
+// It names the challenge but never the phrase.
+type confirmationRequired struct {
+	Error       string `json:"error"`
+	Challenge   string `json:"challenge"`
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	RequestID   string `json:"requestId,omitempty"`
+}
+
+// checkConfirmation returns a config.ConfirmationError unless "phrases" of each environment in "refs" contain its confirm phrase.
+func checkConfirmation(c config.Config, refs []config.EnvironmentRef, phrases func(ref config.EnvironmentRef) []string) error {
+	for _, ref := range refs {
+		_, e, err := config.ResolveTarget(c.Projects, ref.Project, ref.Environment)
+		if err != nil {
+			return err
+		}
+		err = e.ValidateConfirmation(ref.Project, "")
+		for _, p := range phrases(ref) {
+			if err == nil {
+				break
+			}
+			err = e.ValidateConfirmation(ref.Project, p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondUnconfirmed responds to the deployment request "id" which failed checkConfirmation with "err".
+// It returns false if "err" is nil.
+func respondUnconfirmed(w http.ResponseWriter, id string, err error) bool {
+	if err == nil {
+		return false
+	}
+	cerr, ok := err.(config.ConfirmationError)
+	if !ok {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	buf, err := json.Marshal(confirmationRequired{
+		Error:       cerr.Error(),
+		Challenge:   config.ConfirmChallenge,
+		Project:     cerr.Project,
+		Environment: cerr.Environment,
+		RequestID:   id,
+	})
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusPreconditionRequired)
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+var confirmTestConfig = config.Config{
+	Projects: []config.Project{
+		{
+			Name: "api",
+			Environments: []config.Environment{
+				{Name: "staging"},
+				{Name: "production", ConfirmPhrase: "ship api", DependsOn: []string{"db/production"}},
+			},
+		},
+		{
+			Name: "db",
+			Environments: []config.Environment{
+				{Name: "production", ConfirmPhrase: "ship db"},
+			},
+		},
+	},
+}
+
+func TestCheckConfirmation(t *testing.T) {
+	staging := config.EnvironmentRef{Project: "api", Environment: "staging"}
+	production := config.EnvironmentRef{Project: "api", Environment: "production"}
+	db := config.EnvironmentRef{Project: "db", Environment: "production"}
+	chain, err := config.DeployChain(confirmTestConfig.Projects, "api", "production")
+	if err != nil {
+		t.Fatalf("config.DeployChain(projects, %q, %q) failed with %v", "api", "production", err)
+	}
+	phrases := func(ps ...string) func(config.EnvironmentRef) []string {
+		return func(config.EnvironmentRef) []string { return ps }
+	}
+	for _, spec := range []struct {
+		path    string
+		refs    []config.EnvironmentRef
+		phrases func(config.EnvironmentRef) []string
+		// unconfirmed is the environment which lacks confirmation. Zero means success.
+		unconfirmed config.EnvironmentRef
+	}{
+		// single deployments, also with rollback=true
+		{path: "deploy", refs: []config.EnvironmentRef{staging}, phrases: phrases()},
+		{path: "deploy", refs: []config.EnvironmentRef{production}, phrases: phrases(), unconfirmed: production},
+		{path: "deploy", refs: []config.EnvironmentRef{production}, phrases: phrases("ship db"), unconfirmed: production},
+		{path: "deploy", refs: []config.EnvironmentRef{production}, phrases: phrases("ship api")},
+		// with dependencies, which are confirmed with their own phrases
+		{path: "chain", refs: chain, phrases: phrases("ship api"), unconfirmed: db},
+		{path: "chain", refs: chain, phrases: phrases("ship db"), unconfirmed: production},
+		{path: "chain", refs: chain, phrases: phrases("ship api", "ship db")},
+		// batch
+		{
+			path:    "batch",
+			refs:    []config.EnvironmentRef{staging, production},
+			phrases: batchPhrases(map[string]string{"production": "ship api"}),
+		},
+		{
+			path:        "batch",
+			refs:        []config.EnvironmentRef{staging, production},
+			phrases:     batchPhrases(map[string]string{"staging": "ship api"}),
+			unconfirmed: production,
+		},
+	} {
+		err := checkConfirmation(confirmTestConfig, spec.refs, spec.phrases)
+		var zero config.EnvironmentRef
+		if spec.unconfirmed == zero {
+			if err != nil {
+				t.Errorf("checkConfirmation(c, %q, phrase) of %s failed with %v; want success", spec.refs, spec.path, err)
+			}
+			continue
+		}
+		want := config.ConfirmationError{EnvironmentRef: spec.unconfirmed}
+		if err != want {
+			t.Errorf("checkConfirmation(c, %q, phrase) of %s failed with %v; want %v", spec.refs, spec.path, err, want)
+		}
+	}
+}
+
+// batchPhrases returns phrases of environments in a batch like batchRequest.Confirm.
+func batchPhrases(confirm map[string]string) func(config.EnvironmentRef) []string {
+	return func(ref config.EnvironmentRef) []string { return []string{confirm[ref.Environment]} }
+}
+
+func TestRespondUnconfirmed(t *testing.T) {
+	if w := httptest.NewRecorder(); respondUnconfirmed(w, "req-1", nil) {
+		t.Errorf("respondUnconfirmed(w, id, nil) = true; want false")
+	}
+
+	err := checkConfirmation(confirmTestConfig, []config.EnvironmentRef{{Project: "api", Environment: "production"}}, func(config.EnvironmentRef) []string { return nil })
+	w := httptest.NewRecorder()
+	if !respondUnconfirmed(w, "req-1", err) {
+		t.Fatalf("respondUnconfirmed(w, id, %v) = false; want true", err)
+	}
+	if got, want := w.Code, 428; got != want {
+		t.Errorf("w.Code = %d; want %d", got, want)
+	}
+	if got, want := w.HeaderMap.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type = %q; want %q", got, want)
+	}
+	if strings.Contains(w.Body.String(), "ship api") {
+		t.Errorf("body %q reveals the phrase", w.Body.String())
+	}
+	var got confirmationRequired
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q, &got) failed with %v", w.Body.String(), err)
+	}
+	if got.Challenge != config.ConfirmChallenge || got.Project != "api" || got.Environment != "production" || got.Error == "" {
+		t.Errorf("body = %#v; want the %s challenge of api/production", got, config.ConfirmChallenge)
+	}
+	if got.RequestID != "req-1" {
+		t.Errorf("requestId = %q; want %q", got.RequestID, "req-1")
+	}
+
+	w = httptest.NewRecorder()
+	if !respondUnconfirmed(w, "req-2", errors.New("no such environment")) || w.Code != http.StatusBadRequest {
+		t.Errorf("respondUnconfirmed(w, id, err) responded %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(w.Body.String(), `"requestId":"req-2"`) {
+		t.Errorf("body = %q; want the request ID", w.Body.String())
+	}
+}
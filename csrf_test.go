@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/handlers/annotations"
+	"github.com/gengo/goship/handlers/clone"
+	"github.com/gengo/goship/handlers/comment"
+	deploypage "github.com/gengo/goship/handlers/deploy-page"
+	hostsethandler "github.com/gengo/goship/handlers/hostset"
+	"github.com/gengo/goship/handlers/lock"
+	"github.com/gengo/goship/handlers/preferences"
+	"github.com/gengo/goship/handlers/schedules"
+	subscriptionhandlers "github.com/gengo/goship/handlers/subscriptions"
+	tokenhandlers "github.com/gengo/goship/handlers/tokens"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/hostlock"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+)
+
+// TestMutatingHandlersRequireCSRFToken makes sure that every mutating route rejects requests of sessions without
+// their CSRF tokens before the handlers run, so the handlers have no dependencies here.
+func TestMutatingHandlersRequireCSRFToken(t *testing.T) {
+	auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+	isAdmin := func(string) bool { return true }
+	dh := DeployHandler{}
+	for _, spec := range []struct {
+		method, path string
+		h            http.Handler
+	}{
+		{method: "POST", path: "/deploy", h: deploypage.New(helpers.Assets{}, nil)},
+		{method: "POST", path: "/deploy_handler", h: dh},
+		{method: "POST", path: "/lock", h: lock.NewLock(nil, nil, nil)},
+		{method: "POST", path: "/unlock", h: lock.NewUnlock(nil, nil, nil)},
+		{method: "POST", path: "/comment", h: comment.New(nil, nil, nil)},
+		{method: "POST", path: "/pivotal/retry", h: pivotalRetryHandler{}},
+		{method: "POST", path: "/clone_environment", h: clone.New(nil, isAdmin, nil)},
+		{method: "POST", path: "/admin/retention", h: retentionHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/templates/reload", h: templatesReloadHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/projects/rename", h: renameProjectHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/reports/monthly", h: recomputeReportHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/hostkeys", h: hostKeysHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/blocklist", h: blocklistHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/hosts", h: hostEditorHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/notifications/test", h: notificationTestHandler{isAdmin: isAdmin}},
+		{method: "POST", path: "/admin/restore", h: restoreHandler{isAdmin: isAdmin}},
+		{method: "PUT", path: "/api/v1/me/preferences", h: preferences.New(nil)},
+		{method: "POST", path: "/api/v1/me/tokens", h: tokenhandlers.New(nil)},
+		{method: "DELETE", path: "/api/v1/me/tokens", h: tokenhandlers.New(nil)},
+		{method: "DELETE", path: "/api/v1/tokens", h: tokenhandlers.NewAll(nil, isAdmin)},
+		{method: "PUT", path: "/api/v1/me/subscriptions", h: subscriptionhandlers.New(nil)},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/deploy-batch", h: batchHandler{dh}},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/annotations", h: annotations.New(nil, nil)},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/drain", h: hostsethandler.New(nil, nil, drain.Hosts)},
+		{method: "DELETE", path: "/api/v1/projects/api/environments/production/lock", h: hostsethandler.New(nil, nil, hostlock.Hosts)},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/skip", h: schedules.New(nil, nil)},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/external-deploy", h: newExternalDeployHandler(nil, nil, nil)},
+		{method: "POST", path: "/api/v1/projects/api/config/rollback", h: configHistoryHandler{isAdmin: isAdmin}},
+	} {
+		// a session which has seen a page, and thus has a CSRF token.
+		get, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q, %q, nil) failed with %v", "GET", "/", err)
+		}
+		page := httptest.NewRecorder()
+		token, err := auth.CSRFToken(page, get)
+		if err != nil {
+			t.Fatalf("auth.CSRFToken(w, r) failed with %v", err)
+		}
+		cookies := (&http.Response{Header: page.Header()}).Cookies()
+
+		for _, sent := range []string{"", "wrong", token + "x"} {
+			r, err := http.NewRequest(spec.method, spec.path, strings.NewReader(url.Values{"csrf_token": {sent}}.Encode()))
+			if err != nil {
+				t.Fatalf("http.NewRequest(%q, %q, body) failed with %v", spec.method, spec.path, err)
+			}
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for _, c := range cookies {
+				r.AddCookie(c)
+			}
+			w := httptest.NewRecorder()
+			auth.Authenticate(spec.h).ServeHTTP(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s with CSRF token %q responded %d; want %d", spec.method, spec.path, sent, w.Code, http.StatusForbidden)
+				continue
+			}
+			var resp struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != auth.CSRFErrorCode {
+				t.Errorf("code of %s %s with CSRF token %q = %q, %v; want %q", spec.method, spec.path, sent, resp.Code, err, auth.CSRFErrorCode)
+			}
+		}
+	}
+}
@@ -11,38 +11,75 @@ import (
 	"os/exec"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/annotation"
+	"github.com/gengo/goship/lib/artifact"
 	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/hostlock"
 	"github.com/gengo/goship/lib/notification"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/gengo/goship/lib/preflight"
+	"github.com/gengo/goship/lib/reqlog"
 	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/scripts"
+	"github.com/gengo/goship/lib/ssh"
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
 )
 
+// statusUnprocessableEntity is the HTTP status code 422, which net/http does not define yet.
+const statusUnprocessableEntity = 422
+
 type DeployHandler struct {
+	// ac checks if users can deploy projects.
+	ac   acl.AccessControl
 	ecl  *etcd.Client
 	ctrl revision.Control
 	hub  *notification.Hub
+	gcl  githublib.Client
+	dcl  *docker.Client
+	// registry registers deployments in progress.
+	registry *running.Registry
+	// hostKeys verifies keys of hosts if not nil.
+	hostKeys ssh.HostKeyChecker
+	// feed records deployments.
+	feed *activity.Feed
+	// scripts checks out script repos of projects.
+	scripts *scripts.Cache
+	// sshKeyPath is the private key which preflight checks connect to hosts with.
+	sshKeyPath string
+	// approvals keeps approval requests of deployments which require approval.
+	approvals *notifier.Reminders
 }
 
 func (h DeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	id := reqlog.FromRequest(r)
+	ctx := reqlog.NewContext(context.Background(), id)
 
 	c, err := config.Load(h.ecl)
 	if err != nil {
-		glog.Errorf("Failed to fetch latest configuration: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		reqlog.Errorf(ctx, "Failed to fetch latest configuration: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	u, err := auth.CurrentUser(r)
 	if err != nil {
-		glog.Errorf("Failed to fetch current user: %v", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		reqlog.Errorf(ctx, "Failed to fetch current user: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
@@ -50,7 +87,15 @@ func (h DeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		user              = u.Name
 		projName, envName string
 		deploy            RevRange
-		src               = RevRange{
+		opts              = deployOptions{
+			Rollback:          r.FormValue("rollback") == "true",
+			Branch:            r.FormValue("branch"),
+			PersistBranch:     r.FormValue("persist") == "true",
+			OverrideBlocklist: r.FormValue("override_blocklist") == "true",
+			OverrideBake:      r.FormValue("override_bake") == "true",
+			Strict:            r.FormValue("strict") == "true",
+		}
+		src = RevRange{
 			From: revision.Revision(r.FormValue("from_source_revision")),
 			To:   revision.Revision(r.FormValue("to_source_revision")),
 		}
@@ -66,108 +111,449 @@ func (h DeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	} {
 		*spec.value = r.FormValue(spec.name)
 		if *spec.value == "" {
-			glog.Errorf("%s not specified", spec.name)
-			http.Error(w, fmt.Sprintf("%s not specified", spec.name), http.StatusBadRequest)
+			reqlog.Errorf(ctx, "%s not specified", spec.name)
+			reqlog.Error(w, id, fmt.Sprintf("%s not specified", spec.name), http.StatusBadRequest)
 			return
 		}
 	}
-	proj, err := config.ProjectFromName(c.Projects, projName)
+	// "host" can be repeated to redeploy several hosts. r.Form has been parsed by FormValue.
+	opts.Hosts = r.Form["host"]
+	ac := acl.ForUser(h.ac, c, u)
+	proj, env, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
 	if err != nil {
-		http.Error(w, "no such project", http.StatusNotFound)
+		respondTargetError(w, id, err)
 		return
 	}
-	env, err := config.EnvironmentFromName(c.Projects, projName, envName)
-	if err != nil {
-		http.Error(w, "no such project/environment", http.StatusNotFound)
+	repo := proj.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		reqlog.Error(w, id, "permission denied", http.StatusForbidden)
 		return
 	}
 
-	h.deploy(ctx, w, c, user, proj, *env, deploy, src)
-}
+	// placeholder environments are refused before anything is notified or recorded.
+	if err := env.RequireHosts(proj.Name); err != nil {
+		reqlog.Error(w, id, err.Error(), config.StatusCode(err))
+		return
+	}
 
-func (h DeployHandler) deploy(ctx context.Context, w http.ResponseWriter, c config.Config, user string, proj config.Project, env config.Environment, deploy, src RevRange) {
-	if c.Notify != "" {
-		err := startNotify(c.Notify, user, proj.Name, env.Name)
-		if err != nil {
-			glog.Errorf("Failed to notify start-deployment event of %s (%s): %v", proj.Name, env.Name, err)
-		}
+	opts.Note = strings.TrimSpace(r.FormValue("note"))
+	if err := env.ValidateDeployNote(opts.Note); err != nil {
+		reqlog.Error(w, id, err.Error(), statusUnprocessableEntity)
+		return
 	}
 
-	deployTime := time.Now()
-	success := true
-	command := deployCommand(env)
-	cmd := exec.Command(command[0], command[1:]...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		glog.Errorf("Could not get stdout of command: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if opts.Flags, err = config.ParseDeployFlags(r.FormValue("flags")); err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
 		return
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		glog.Errorf("Could not get stderr of command: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := env.ValidateFlags(opts.Flags); err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
 		return
 	}
-	repo := proj.SourceRepo()
-	glog.Infof("Starting deployment of %s-%s (%s/%s) from %s to %s; requested by %s", proj.Name, env.Name, repo.RepoOwner, repo.RepoName, deploy.From, deploy.To, user)
-	if err = cmd.Start(); err != nil {
-		glog.Errorf("Could not run deployment command: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	withDependencies := r.FormValue("with_dependencies") == "true"
+	refs := []config.EnvironmentRef{{Project: proj.Name, Environment: env.Name}}
+	if withDependencies {
+		if refs, err = config.DeployChain(c.Projects, proj.Name, env.Name); err != nil {
+			reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// dependencies can be in projects which the user cannot deploy.
+		for _, ref := range refs {
+			p, err := config.FindProject(c.Projects, ref.Project)
+			if err != nil {
+				respondTargetError(w, id, err)
+				return
+			}
+			repo := p.SourceRepo()
+			if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+				reqlog.Error(w, id, fmt.Sprintf("permission denied to deploy %s", p.Name), http.StatusForbidden)
+				return
+			}
+		}
+	}
+	// "confirm" can be repeated to confirm dependencies with their own phrases.
+	if respondUnconfirmed(w, id, checkConfirmation(c, refs, func(config.EnvironmentRef) []string { return r.Form["confirm"] })) {
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go h.sendOutput(&wg, bufio.NewScanner(stdout), proj.Name, env.Name, deployTime)
-	go h.sendOutput(&wg, bufio.NewScanner(stderr), proj.Name, env.Name, deployTime)
-	wg.Wait()
+	if withDependencies {
+		h.deployChain(ctx, w, c, user, *proj, *env, deploy, src, opts)
+		return
+	}
+	_, err = h.deploy(ctx, c, user, *proj, *env, deploy, src, opts)
+	switch err {
+	case nil:
+	case errApprovalRequested:
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, err)
+	default:
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// deployOptions are optional parameters of a deployment request.
+type deployOptions struct {
+	// Rollback is true if the deployment reverts the environment to an older revision.
+	Rollback bool
+	// ChainID identifies the chained deployment which the deployment is a step of.
+	ChainID string
+	// Branch overrides the branch of the environment only for this deployment.
+	Branch string
+	// PersistBranch stores Branch into the environment once the deployment succeeds.
+	PersistBranch bool
+	// Flags are deploy flags exported to the deployment command as GOSHIP_FLAG_<KEY>.
+	Flags map[string]string
+	// Note is the reason of the deployment given by the user.
+	Note string
+	// OverrideBlocklist ships blocklisted commits on purpose. Overrides are recorded in the activity feed.
+	OverrideBlocklist bool
+	// OverrideBake ships revisions which have not baked long enough on purpose. Overrides are recorded in the activity feed.
+	OverrideBake bool
+	// Hosts redeploys only the hosts of the names, e.g. the ones left behind by a partially failed deployment.
+	// Locked hosts are refused.
+	Hosts []string
+	// Strict aborts the deployment if any of the hosts are locked instead of skipping them.
+	Strict bool
+	// Approved is true if the deployment has been approved. Deployments into environments which require approval
+	// wait for approval otherwise.
+	Approved bool
+	// Revisions are the revisions of all the repositories of a multi-repo project, resolved when the deployment starts.
+	Revisions config.Revisions
+	// Hooks are the results of the hooks of the deployment, filled as they run.
+	Hooks []HookResult
+}
+
+// apply returns a copy of "env" overridden by the options.
+func (o deployOptions) apply(env config.Environment) config.Environment {
+	if o.Branch != "" {
+		env.Branch = o.Branch
+	}
+	return env
+}
 
-	err = cmd.Wait()
+// hostsEnvName is the name of the environment variable which exports the hosts to deploy into to the deployment command.
+const hostsEnvName = "GOSHIP_HOSTS"
+
+// scriptDirEnvName is the name of the environment variable which exports the checkout of the script repo to the deployment command.
+const scriptDirEnvName = "GOSHIP_SCRIPT_DIR"
+
+// triggeredByEnvName is the name of the environment variable which exports the user who requested the deployment to the deployment command.
+const triggeredByEnvName = "GOSHIP_TRIGGERED_BY"
+
+// unknownDeployer is the name of deployers who are not identified.
+const unknownDeployer = "unknown"
+
+// deployerName returns "user", or unknownDeployer if empty, so that deployments are never attributed to nobody.
+func deployerName(user string) string {
+	if strings.TrimSpace(user) == "" {
+		return unknownDeployer
+	}
+	return user
+}
+
+// commandEnv returns the environment variables of the deployment command by "user" into "hosts" with deploy "flags",
+// the known_hosts file "knownHosts", the checkout of the script repo "scriptDir", which is empty if none,
+// and the revisions "revs" of the repositories of a multi-repo project, which are nil otherwise.
+func commandEnv(user string, hosts config.HostList, flags map[string]string, knownHosts, scriptDir string, revs config.Revisions) []string {
+	env := append(os.Environ(), hostsEnvName+"="+hosts.String())
+	env = append(env, config.FlagEnv(flags)...)
+	env = append(env, knownHostsEnvName+"="+knownHosts)
+	if scriptDir != "" {
+		env = append(env, scriptDirEnvName+"="+scriptDir)
+	}
+	if len(revs) > 0 {
+		env = append(env, revisionsEnvName+"="+revs.String())
+	}
+	return append(env, triggeredByEnvName+"="+user)
+}
+
+// deployHosts returns the hosts in "env" of "proj" which are not drained.
+// It returns an error if the environment has no hosts configured or all of them are drained,
+// since deploying into none of them is not what the user wants.
+func deployHosts(proj string, env config.Environment, drains drain.Drains) (config.HostList, error) {
+	if err := env.RequireHosts(proj); err != nil {
+		return nil, err
+	}
+	active := drains.Active(proj, env.Name, env.Hosts)
+	if len(active) == 0 {
+		return nil, fmt.Errorf("all hosts in %s-%s are drained", proj, env.Name)
+	}
+	if skipped := len(env.Hosts) - len(active); skipped > 0 {
+		glog.Infof("Skipping %d drained hosts in %s-%s", skipped, proj, env.Name)
+	}
+	return config.HostList(config.HostNames(active)), nil
+}
+
+// deploy runs the deployment command of "env" requested by "user" and records the result.
+// It returns false if the command failed, or an error if it could not run the command at all.
+func (h DeployHandler) deploy(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, deploy, src RevRange, opts deployOptions) (bool, error) {
+	deployTime := time.Now()
+	user = deployerName(user)
+	n := notifier.ForEnvironment(c, proj.Name, env.Name)
+	ev := notifier.Event{
+		ID:          deployID(proj.Name, env.Name, deployTime),
+		Project:     proj.Name,
+		Environment: env.Name,
+		User:        user,
+		From:        string(deploy.From),
+		To:          string(deploy.To),
+		Flags:       opts.Flags,
+		Note:        opts.Note,
+		RequestID:   reqlog.FromContext(ctx),
+	}
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj.Name, env.Name))
+	if err == nil {
+		ev.ExpectedDuration = expectedDuration(entries)
+	}
+	logURL := path.Join("/output", fmt.Sprintf("%s-%s", proj.Name, env.Name), deployTime.String())
+
+	// every check which refuses the deployment runs before anything announces that it started.
+	env = opts.apply(env)
+	if err := env.AllowsDeploy(opts.Rollback); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	drains, err := drain.Load(h.ecl, deployTime)
 	if err != nil {
-		success = false
-		glog.Errorf("Deployment of %s failed: %v", proj.Name, err)
-	} else {
-		glog.Infof("Successfully deployed %s", proj.Name)
+		reqlog.Errorf(ctx, "Could not load drained hosts: %v", err)
+		return false, err
 	}
-	if c.Notify != "" {
-		err = endNotify(c.Notify, proj.Name, env.Name, success)
-		if err != nil {
-			glog.Errorf("Failed to notify start-deployment event of %s (%s): %v", proj.Name, env.Name, err)
+	hosts, err := deployHosts(proj.Name, env, drains)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	if hosts, err = onlyHosts(proj.Name, env.Name, hosts, opts.Hosts); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	report := func(line string) { appendDeployOutput(fmt.Sprintf("%s-%s", proj.Name, env.Name), line, deployTime) }
+	locks, err := hostlock.Load(h.ecl, deployTime)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not load host locks: %v", err)
+		return false, err
+	}
+	hosts, skipped, err := excludeLockedHosts(ctx, proj.Name, env.Name, hosts, locks, opts.Strict || len(opts.Hosts) > 0, report)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	keys, err := hostkeys.Load(h.ecl)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not load host keys: %v", err)
+		return false, err
+	}
+	if err := refuseBlockedHosts(keys, hosts); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	checkers, err := h.preflightCheckers(c.DeployUser, env)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not prepare preflight checks: %v", err)
+		return false, err
+	}
+	notes, err := annotation.Load(h.ecl, deployTime)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not load annotations: %v", err)
+		return false, err
+	}
+	if err := checkAnnotations(notes.Of(proj.Name, env.Name), report); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	if err := h.checkBlocklist(ctx, proj, env.Name, user, deploy, src, opts.OverrideBlocklist, report); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	if err := h.checkBake(ctx, proj, env, user, deploy.To, deployTime, opts.OverrideBake, report); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	hosts, failed, err := preflightHosts(ctx, proj.Name, env, hosts, checkers, report)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	skipped = append(skipped, failed...)
+	if opts.Revisions, err = deployRevisions(h.gcl, proj, env, deploy.To); err != nil {
+		reqlog.Errorf(ctx, "Could not deploy %s-%s: %v", proj.Name, env.Name, err)
+		return false, err
+	}
+	knownHosts, err := writeKnownHosts(keys)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not write known hosts: %v", err)
+		return false, err
+	}
+	params := config.DeployParams{
+		Revision:    string(deploy.To),
+		Environment: env.Name,
+		Branch:      env.Branch,
+		Hosts:       hosts,
+	}
+	command, err := env.DeployArgv(params)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not build deployment command: %v", err)
+		return false, err
+	}
+	// deployments which require approval wait here until approved.
+	if env.RequireApproval && !opts.Approved {
+		return false, h.requestApproval(ctx, ev, user, deploy, src, opts, deployTime)
+	}
+	scriptDir, cleanup, err := h.checkoutScripts(proj, ev.ID)
+	if err != nil {
+		reqlog.Errorf(ctx, "Could not check out scripts of %s: %v", proj.Name, err)
+		return false, err
+	}
+	defer cleanup()
+
+	ev.Type = notifier.DeployStarted
+	n.Notify(ev)
+	h.feed.Record(activity.Entry{
+		Type:        activity.DeployStarted,
+		Project:     proj.Name,
+		Environment: env.Name,
+		User:        user,
+		Summary:     fmt.Sprintf("%s started deploying %s-%s from %s to %s", user, proj.Name, env.Name, deploy.From.Short(), deploy.To.Short()),
+		URL:         logURL,
+	})
+	success := false
+	h.startRunning(running.Deploy{
+		ID:          ev.ID,
+		Project:     proj.Name,
+		Environment: env.Name,
+		User:        user,
+		From:        ev.From,
+		To:          ev.To,
+		StartedAt:   deployTime,
+		LogURL:      logURL,
+	})
+	defer func() { h.finishRunning(ev.ID, success) }()
+
+	dir := env.CommandDir(scriptDir)
+	cmdEnv := commandEnv(user, hosts, opts.Flags, knownHosts, scriptDir, opts.Revisions)
+	hookOutput := func(line string) {
+		h.broadcastOutput(proj.Name, env.Name, line)
+		report(line)
+	}
+	arts := artifact.NewCollector(c.MaxArtifacts)
+	repo := proj.SourceRepo()
+	// commit statuses are posted only once the deploy command starts, e.g. not if the pre-deploy hook fails.
+	commandStarted := false
+	defer func() {
+		if commandStarted {
+			postCommitStatus(ctx, h.gcl, proj, env.Name, ev.To, user, finalCommitStatus(success))
 		}
+	}()
+	run := func() (error, error) {
+		reqlog.Infof(ctx, "Starting deployment of %s-%s (%s/%s) from %s to %s; requested by %s", proj.Name, env.Name, repo.RepoOwner, repo.RepoName, deploy.From, deploy.To, user)
+		commandStarted = true
+		postCommitStatus(ctx, h.gcl, proj, env.Name, ev.To, user, commitStatusPending)
+		return h.runCommand(proj.Name, env.Name, command, dir, cmdEnv, deployTime, arts)
+	}
+	var failure error
+	if opts.Hooks, failure, err = runWithHooks(env, params, dir, cmdEnv, hookOutput, run); err != nil {
+		reqlog.Errorf(ctx, "Could not run deployment command: %v", err)
+		return false, err
+	}
+	if n := arts.Dropped(); n > 0 {
+		reqlog.Warningf(ctx, "Dropped %d artifacts of %s-%s over the limit", n, proj.Name, env.Name)
+	}
+	duration := time.Since(deployTime)
+	ev.Type, ev.Duration = notifier.DeploySucceeded, duration
+	ev.Artifacts = arts.Artifacts()
+	if failure != nil {
+		ev.Type = notifier.DeployFailed
+		reqlog.Criticalf(ctx, "Deployment of %s failed: %v", proj.Name, failure)
+	} else {
+		success = true
+		reqlog.Infof(ctx, "Successfully deployed %s", proj.Name)
+	}
+	n.Notify(ev)
+	done := activity.Entry{Type: activity.DeploySucceeded, Project: proj.Name, Environment: env.Name, User: user, URL: logURL,
+		Summary: fmt.Sprintf("%s deployed %s into %s-%s in %s", user, deploy.To.Short(), proj.Name, env.Name, duration)}
+	if !success {
+		done.Type, done.Summary = activity.DeployFailed, fmt.Sprintf("%s failed to deploy %s into %s-%s", user, deploy.To.Short(), proj.Name, env.Name)
+	}
+	h.feed.Record(done)
+	autoLock := func(p, e, id string, now time.Time) (config.AutoLock, error) {
+		return config.AutoLockEnvironment(h.ecl, p, e, id, now)
+	}
+	if l := lockOnFailure(ctx, autoLock, n, ev, env, success, time.Now()); l != nil {
+		h.feed.Record(activity.Entry{Type: activity.Locked, Project: proj.Name, Environment: env.Name, User: l.By, URL: logURL,
+			Summary: fmt.Sprintf("%s locked %s-%s: %s", l.By, proj.Name, env.Name, l.Reason)})
 	}
 
-	if (c.Pivotal.Token != "") && success {
-		err := config.PostToPivotal(c.Pivotal, env.Name, repo.RepoOwner, repo.RepoName, string(deploy.From), string(deploy.To))
-		if err != nil {
-			glog.Errorf("Failed to post to pivotal: %v", err)
-		} else {
-			glog.Infof("Pivotal Token: %s", c.Pivotal.Token)
+	others := proj.RepoRanges(previousRevisions(entries), opts.Revisions)
+	piv := postToPivotal(ctx, c, n, ev, proj, env, deploy, others, pivotalEvent(success, opts.Rollback), h.ecl, deployID(proj.Name, env.Name, deployTime))
+	postToGithubIssues(ctx, c, proj, env, deploy, ev, pivotalEvent(success, opts.Rollback))
+	if success && !opts.Rollback {
+		notifySubscribers(ctx, c, h.ecl, h.gcl, proj, env, deploy, ev)
+	}
+	var release string
+	if success {
+		release = releaseDeploy(ctx, h.gcl, proj, env, deploy, deployTime, entries)
+	}
+	err = h.insertEntry(ctx, proj, env, deploy, src, user, success, deployTime, duration, piv, skipped, release, ev.Artifacts, opts)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to insert an entry: %v", err)
+		return success, err
+	}
+	if success && opts.PersistBranch && opts.Branch != "" {
+		if err := config.SetBranch(h.ecl, proj.Name, env.Name, opts.Branch); err != nil {
+			reqlog.Errorf(ctx, "Failed to store branch %s of %s-%s: %v", opts.Branch, proj.Name, env.Name, err)
+			return success, err
 		}
 	}
+	return success, nil
+}
 
-	err = h.insertEntry(ctx, proj, env, deploy, src, user, success, deployTime)
+// checkoutScripts checks out the script repo of "proj" for the deployment "id".
+// It returns the checkout, or "" if the project has no script repo, and a function which removes it.
+func (h DeployHandler) checkoutScripts(proj config.Project, id string) (string, func(), error) {
+	if proj.ScriptRepo == nil {
+		return "", func() {}, nil
+	}
+	if h.scripts == nil {
+		return "", nil, fmt.Errorf("script repo of %s is configured but no script cache is available", proj.Name)
+	}
+	return h.scripts.Checkout(proj.Name, proj.ScriptRepo.URL, proj.ScriptRepo.Ref, id)
+}
+
+// runCommand runs "command" of a deployment of "e" of "p" started at "deployTime" in "dir" with the environment variables "env",
+// and sends its output to web pages and the log. It returns the error which the command exited with as "failure",
+// or an error if it could not run the command at all.
+func (h DeployHandler) runCommand(p, e string, command []string, dir string, env []string, deployTime time.Time, arts *artifact.Collector) (failure, err error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir, cmd.Env = dir, env
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		glog.Errorf("Failed to insert an entry: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("could not get stdout of command: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get stderr of command: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
 	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go h.sendOutput(&wg, bufio.NewScanner(stdout), p, e, deployTime, arts)
+	go h.sendOutput(&wg, bufio.NewScanner(stderr), p, e, deployTime, arts)
+	wg.Wait()
+	return cmd.Wait(), nil
 }
 
-func (h DeployHandler) sendOutput(wg *sync.WaitGroup, scanner *bufio.Scanner, p, e string, deployTime time.Time) {
+// sendOutput pushes lines of output of a deployment to web pages and the log, and records artifacts declared in them to "arts".
+// Declarations of artifacts are output as they are.
+func (h DeployHandler) sendOutput(wg *sync.WaitGroup, scanner *bufio.Scanner, p, e string, deployTime time.Time, arts *artifact.Collector) {
 	defer wg.Done()
 	for scanner.Scan() {
 		t := scanner.Text()
-		msg := struct {
-			Project     string
-			Environment string
-			StdoutLine  string
-		}{p, e, stripANSICodes(strings.TrimSpace(t))}
-		cmdOutput, err := json.Marshal(msg)
-		if err != nil {
-			glog.Errorf("Failed to marshal output into JSON: %v", err)
-		}
-		h.hub.Broadcast(string(cmdOutput))
+		line := stripANSICodes(strings.TrimSpace(t))
+		arts.Scan(line)
+		h.broadcastOutput(p, e, line)
 
 		go appendDeployOutput(fmt.Sprintf("%s-%s", p, e), t, deployTime)
 	}
@@ -177,6 +563,20 @@ func (h DeployHandler) sendOutput(wg *sync.WaitGroup, scanner *bufio.Scanner, p,
 	}
 }
 
+// broadcastOutput pushes a line of output of a deployment of "e" of "p" to web pages.
+func (h DeployHandler) broadcastOutput(p, e, line string) {
+	msg := struct {
+		Project     string
+		Environment string
+		StdoutLine  string
+	}{p, e, line}
+	cmdOutput, err := json.Marshal(msg)
+	if err != nil {
+		glog.Errorf("Failed to marshal output into JSON: %v", err)
+	}
+	h.hub.Broadcast(string(cmdOutput))
+}
+
 func stripANSICodes(t string) string {
 	ansi := regexp.MustCompile(`\x1B\[[0-9;]{1,4}[mK]`)
 	return ansi.ReplaceAllString(t, "")
@@ -205,62 +605,111 @@ func appendDeployOutput(env string, output string, timestamp time.Time) {
 	io.WriteString(out, output+"\n")
 }
 
-func startNotify(n, user, p, env string) error {
-	msg := fmt.Sprintf("%s is deploying %s to *%s*.", user, p, env)
-	err := notify(n, msg)
-	if err != nil {
-		return err
+// pivotalEvent returns the type of the Pivotal event for a finished deployment.
+func pivotalEvent(success, rollback bool) config.PivotalEvent {
+	switch {
+	case !success:
+		return config.PivotalDeployFailed
+	case rollback:
+		return config.PivotalRollback
 	}
-	return nil
+	return config.PivotalDeploySucceeded
 }
 
-func notify(n, msg string) error {
-	cmd := exec.Command(n, msg)
-	err := cmd.Run()
+// postToPivotal comments the deployment "id" of "deploy" into "env" to Pivotal stories as "pev" if configured, and notifies the result
+// through "n" as a PivotalPosted event like "ev". The stories which failed are queued in "outbox" for retries.
+// Stories referred by the commits in "others", the other repositories of a multi-repo project, are commented as well.
+// It returns nil unless the comments are posted.
+func postToPivotal(ctx context.Context, c config.Config, n notifier.Notifier, ev notifier.Event, proj config.Project, env config.Environment, deploy RevRange, others []config.RepoRange, pev config.PivotalEvent, outbox pivotal.OutboxStore, id string) *pivotal.Summary {
+	if c.Pivotal == nil || c.Pivotal.Token == "" || !env.PostsToPivotal(pev) {
+		return nil
+	}
+	sum, rest, err := config.PostToPivotal(c.Pivotal, proj, pev, env.Name, string(deploy.From), string(deploy.To), ev.User, ev.Note, others...)
+	if err == config.ErrFirstDeploy || err == config.ErrBaseMissing {
+		// The deployment itself has succeeded or failed regardless, so it is only noted.
+		reqlog.Infof(ctx, "Skipped posting %s of %s-%s to pivotal: %v", pev, proj.Name, env.Name, err)
+		return &pivotal.Summary{Note: err.Error()}
+	}
 	if err != nil {
-		return err
+		reqlog.Errorf(ctx, "Failed to post to pivotal: %v", err)
+		return nil
 	}
-	return nil
+	reqlog.Infof(ctx, "Posted %s of %s-%s to pivotal: %s", pev, proj.Name, env.Name, sum)
+	sum = enqueuePivotal(outbox, proj.Name, env.Name, id, sum, rest)
+	ev.Type, ev.Pivotal = notifier.PivotalPosted, sum
+	n.Notify(ev)
+	return &sum
 }
 
-func endNotify(n, p, env string, success bool) error {
-	msg := fmt.Sprintf("%s successfully deployed to *%s*.", p, env)
-	if !success {
-		msg = fmt.Sprintf("%s deployment to *%s* failed.", p, env)
+// postToGithubIssues comments the deployment of "deploy" into "env" on the GitHub issues referred by its commits if configured.
+// The same pivotal_events of the environment decide which events are commented as on Pivotal stories.
+func postToGithubIssues(ctx context.Context, c config.Config, proj config.Project, env config.Environment, deploy RevRange, ev notifier.Event, pev config.PivotalEvent) {
+	if c.GithubIssues == nil || !env.PostsToPivotal(pev) {
+		return
+	}
+	sum, err := config.PostToGithubIssues(c.GithubIssues, proj, pev, env.Name, string(deploy.From), string(deploy.To), ev.User, ev.Note)
+	if err == config.ErrFirstDeploy || err == config.ErrBaseMissing {
+		reqlog.Infof(ctx, "Skipped posting %s of %s-%s to GitHub issues: %v", pev, proj.Name, env.Name, err)
+		return
 	}
-	err := notify(n, msg)
 	if err != nil {
-		return err
+		reqlog.Errorf(ctx, "Failed to post to GitHub issues: %v", err)
+		return
 	}
-	return nil
+	reqlog.Infof(ctx, "Posted %s of %s-%s to GitHub issues: %s", pev, proj.Name, env.Name, sum)
 }
 
-// deployCommand returns the deployment command for a given
-// environment as a string slice that has been split on spaces.
-func deployCommand(e config.Environment) []string {
-	// TODO(yugui) better handling of shell escape
-	return strings.Split(e.Deploy, " ")
+// deployID returns an identifier of the deployment of "proj" into "env" started at "t".
+func deployID(proj, env string, t time.Time) string {
+	return fmt.Sprintf("%s-%s-%d", proj, env, t.UnixNano())
 }
 
-func (h DeployHandler) insertEntry(ctx context.Context, proj config.Project, env config.Environment, deploy, src RevRange, user string, success bool, time time.Time) error {
-	basename := fmt.Sprintf("%s-%s", proj.Name, env.Name)
-	path := path.Join(*dataPath, basename+".json")
-	err := prepareDataFiles(path)
-	if err != nil {
-		return err
+// durationSamples is the number of recent successful deployments which expectedDuration takes into account.
+const durationSamples = 10
+
+// expectedDuration estimates the duration of the next deployment from the median of the durations of
+// the last successful deployments in "entries".
+// It returns zero if there are no such deployments.
+func expectedDuration(entries []DeployLogEntry) time.Duration {
+	sorted := append([]DeployLogEntry(nil), entries...)
+	sort.Sort(ByTime(sorted))
+	var ds []time.Duration
+	for _, e := range sorted {
+		if !e.Success || e.Duration <= 0 || len(e.Chain) > 0 {
+			continue
+		}
+		ds = append(ds, e.Duration)
+		if len(ds) == durationSamples {
+			break
+		}
 	}
-
-	e, err := readEntries(basename)
-	if err != nil {
-		return err
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Sort(byDuration(ds))
+	n := len(ds)
+	if n%2 == 1 {
+		return ds[n/2]
 	}
+	return (ds[n/2-1] + ds[n/2]) / 2
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
 
+func (h DeployHandler) insertEntry(ctx context.Context, proj config.Project, env config.Environment, deploy, src RevRange, user string, success bool, time time.Time, duration time.Duration, piv *pivotal.Summary, skipped []preflight.Failure, release string, artifacts []artifact.Artifact, opts deployOptions) error {
 	repo := proj.SourceRepo()
-	var msg string
+	var (
+		msg string
+		err error
+	)
 	if src.To != "" {
 		msg, err = h.ctrl.SourceRevMessage(ctx, proj, src.To)
 		if err != nil {
-			glog.Errorf("Failed to get commit %s (%s/%s): %v", src.To, repo.RepoOwner, repo.RepoName, err)
+			reqlog.Errorf(ctx, "Failed to get commit %s (%s/%s): %v", src.To, repo.RepoOwner, repo.RepoName, err)
 			msg = ""
 		}
 	}
@@ -269,19 +718,114 @@ func (h DeployHandler) insertEntry(ctx context.Context, proj config.Project, env
 		diffURL = h.ctrl.SourceDiffURL(proj, src.From, src.To)
 	}
 	d := DeployLogEntry{
+		ID:            deployID(proj.Name, env.Name, time),
 		Range:         deploy,
 		DiffURL:       diffURL,
 		ToRevisionMsg: msg,
 		User:          user,
 		Time:          time,
+		Duration:      duration,
 		Success:       success,
+		ChainID:       opts.ChainID,
+		Pivotal:       piv,
+		Flags:         opts.Flags,
+		Note:          opts.Note,
+		SkippedHosts:  skipped,
+		ReleaseTag:    release,
+		Artifacts:     artifacts,
+		Revisions:     opts.Revisions,
+		Hooks:         opts.Hooks,
+		RequestID:     reqlog.FromContext(ctx),
+	}
+	return appendEntry(proj.Name, env.Name, d)
+}
+
+// runningMessage is pushed to web pages when a deployment starts or finishes.
+type runningMessage struct {
+	Project     string
+	Environment string
+	Running     running.Deploy
+}
+
+// startRunning registers the deployment "d" in progress and pushes it to web pages.
+func (h DeployHandler) startRunning(d running.Deploy) {
+	if err := h.registry.Start(d); err != nil {
+		glog.Errorf("Failed to register deployment %s: %v", d.ID, err)
+	}
+	h.pushRunning(d)
+}
+
+// finishRunning marks the deployment "id" finished with "success" and pushes the outcome to web pages.
+func (h DeployHandler) finishRunning(id string, success bool) {
+	d, err := h.registry.Finish(id, success)
+	if err == running.ErrNotFound {
+		glog.Errorf("Deployment %s finished without registration", id)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to record the outcome of deployment %s: %v", id, err)
+	}
+	h.pushRunning(d)
+}
+
+func (h DeployHandler) pushRunning(d running.Deploy) {
+	buf, err := json.Marshal(runningMessage{Project: d.Project, Environment: d.Environment, Running: d})
+	if err != nil {
+		glog.Errorf("Failed to marshal deployment %s into JSON: %v", d.ID, err)
+		return
+	}
+	h.hub.Broadcast(string(buf))
+}
+
+// historyMu serializes updates of deploy histories.
+var historyMu sync.Mutex
+
+// appendEntry appends "d" to the deploy history of "proj"/"env".
+func appendEntry(proj, env string, d DeployLogEntry) error {
+	return appendEntryIf(proj, env, d, nil)
+}
+
+// appendEntryIf appends "d" to the deploy history of "proj"/"env" unless "check" returns an error for the current history.
+// "check" is called within the same lock as the update. The error of "check" is returned as it is.
+func appendEntryIf(proj, env string, d DeployLogEntry, check func(entries []DeployLogEntry) error) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	basename := fmt.Sprintf("%s-%s", proj, env)
+	path := path.Join(*dataPath, basename+".json")
+	err := prepareDataFiles(path)
+	if err != nil {
+		return err
+	}
+
+	e, err := readEntries(basename)
+	if err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(e); err != nil {
+			return err
+		}
 	}
 	e = append(e, d)
-	err = writeJSON(e, path)
+	return writeJSON(e, path)
+}
+
+// updateEntry applies "f" to the entry "id" in the deploy history of "proj"/"env".
+func updateEntry(proj, env, id string, f func(d *DeployLogEntry)) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	basename := fmt.Sprintf("%s-%s", proj, env)
+	e, err := readEntries(basename)
 	if err != nil {
 		return err
 	}
-	return nil
+	for i := range e {
+		if e[i].ID == id {
+			f(&e[i])
+			return writeJSON(e, path.Join(*dataPath, basename+".json"))
+		}
+	}
+	return fmt.Errorf("no deploy record %s in %s", id, basename)
 }
 
 func prepareDataFiles(path string) error {
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/handlers/comment"
+	"github.com/gengo/goship/handlers/lock"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/etcdtest"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/notification"
+	"github.com/gengo/goship/lib/running"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// newTestDeployHandler returns a DeployHandler which stores into "s", the GitHub client which it posts commit statuses with,
+// and a function which releases them.
+func newTestDeployHandler(s etcdtest.Store) (DeployHandler, *statusClient, func()) {
+	srv := etcdtest.NewServer(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	gcl := &statusClient{statuses: make(map[string]map[string]github.RepoStatus)}
+	h := DeployHandler{
+		ecl:      etcd.NewClient([]string{srv.URL}),
+		hub:      notification.NewHub(ctx),
+		gcl:      gcl,
+		registry: running.NewRegistry(s, time.Minute),
+		feed:     activity.NewFeed(s),
+	}
+	return h, gcl, func() {
+		cancel()
+		srv.Close()
+	}
+}
+
+func TestDeployRefusedWithoutStarting(t *testing.T) {
+	proj := config.Project{
+		Name:           "api",
+		Repo:           config.Repo{RepoOwner: "gengo", RepoName: "api"},
+		RepoType:       config.RepoTypeGithub,
+		CommitStatuses: true,
+	}
+	env := config.Environment{Name: "production", Branch: "master", Deploy: "/bin/true", Hosts: []config.Host{{Name: "prod1"}, {Name: "prod2"}}}
+	for _, spec := range []struct {
+		desc  string
+		env   func(e config.Environment) config.Environment
+		setup func(s etcdtest.Store, now time.Time) error
+		opts  deployOptions
+	}{
+		{
+			desc: "auto-locked environment",
+			env: func(e config.Environment) config.Environment {
+				e.AutoLock = &config.AutoLock{Reason: "auto-locked: deploy api-production-1 failed", By: config.AutoLockOwner}
+				return e
+			},
+		},
+		{
+			desc: "all hosts drained",
+			setup: func(s etcdtest.Store, now time.Time) error {
+				for _, host := range []string{"prod1", "prod2"} {
+					if _, err := drain.Set(s, "api", "production", host, "alice", time.Hour, now); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			desc: "locked host in strict mode",
+			setup: func(s etcdtest.Store, now time.Time) error {
+				_, err := hostlock.Set(s, "api", "production", "prod2", "alice", "disk replacement", time.Hour, now)
+				return err
+			},
+			opts: deployOptions{Strict: true},
+		},
+		{
+			desc: "unknown host",
+			opts: deployOptions{Hosts: []string{"prod9"}},
+		},
+	} {
+		withDataPath(t, func() {
+			s := etcdtest.NewStore()
+			if spec.setup != nil {
+				if err := spec.setup(s, time.Now()); err != nil {
+					t.Fatalf("setup of %s failed with %v", spec.desc, err)
+				}
+			}
+			h, gcl, done := newTestDeployHandler(s)
+			defer done()
+			e := env
+			if spec.env != nil {
+				e = spec.env(e)
+			}
+			rng := RevRange{From: "abc123", To: "def456"}
+			ok, err := h.deploy(context.Background(), config.Config{}, "alice", proj, e, rng, RevRange{}, spec.opts)
+			if ok || err == nil {
+				t.Errorf("h.deploy(...) = %t, %v on %s; want a refusal", ok, err, spec.desc)
+			}
+			if gcl.calls != 0 {
+				t.Errorf("h.deploy(...) posted %d commit statuses on %s; want none", gcl.calls, spec.desc)
+			}
+			for key := range s.Values {
+				if strings.HasPrefix(key, "/goship/activity/") || strings.HasPrefix(key, "/goship/running/") {
+					t.Errorf("h.deploy(...) stored %s on %s; want nothing recorded as started", key, spec.desc)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitStatusOnlyOnceCommandStarts(t *testing.T) {
+	proj := config.Project{
+		Name:           "api",
+		Repo:           config.Repo{RepoOwner: "gengo", RepoName: "api"},
+		RepoType:       config.RepoTypeGithub,
+		CommitStatuses: true,
+	}
+	env := config.Environment{Name: "production", Branch: "master", Deploy: "/bin/true", Hosts: []config.Host{{Name: "prod1"}}}
+	for _, spec := range []struct {
+		desc      string
+		preDeploy []string
+		want      []string
+	}{
+		{desc: "deployment", want: []string{"success"}},
+		{desc: "failed pre-deploy hook", preDeploy: []string{"/bin/false"}},
+	} {
+		withDataPath(t, func() {
+			h, gcl, done := newTestDeployHandler(etcdtest.NewStore())
+			defer done()
+			e := env
+			if spec.preDeploy != nil {
+				e.PreDeploy = &config.Hook{Command: spec.preDeploy}
+			}
+			h.deploy(context.Background(), config.Config{}, "alice", proj, e, RevRange{From: "abc123", To: "def456"}, RevRange{}, deployOptions{})
+
+			var got []string
+			for _, st := range gcl.statuses["gengo/api@def456"] {
+				got = append(got, *st.State)
+			}
+			if !reflect.DeepEqual(got, spec.want) {
+				t.Errorf("commit statuses = %q after %s; want %q", got, spec.desc, spec.want)
+			}
+			if want := 2 * len(spec.want); gcl.calls != want {
+				t.Errorf("CreateStatus called %d times on %s; want %d", gcl.calls, spec.desc, want)
+			}
+		})
+	}
+}
+
+func TestPersistBranchAfterSuccess(t *testing.T) {
+	for _, spec := range []struct {
+		deploy string
+		want   string
+	}{
+		{deploy: "/bin/true", want: "feature"},
+		{deploy: "/bin/false", want: "master"},
+	} {
+		withDataPath(t, func() {
+			s := etcdtest.NewStore()
+			env := config.Environment{Name: "production", Branch: "master", Deploy: spec.deploy, Hosts: []config.Host{{Name: "prod1"}}}
+			proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{env}}
+			if err := config.Store(s, config.Config{Projects: []config.Project{proj}}); err != nil {
+				t.Fatalf("config.Store(s, ...) failed with %v", err)
+			}
+			h, _, done := newTestDeployHandler(s)
+			defer done()
+			opts := deployOptions{Branch: "feature", PersistBranch: true}
+			h.deploy(context.Background(), config.Config{}, "alice", proj, env, RevRange{From: "abc123", To: "def456"}, RevRange{}, opts)
+
+			c, err := config.Load(s)
+			if err != nil {
+				t.Fatalf("config.Load(s) failed with %v", err)
+			}
+			if got := c.Projects[0].Environments[0].Branch; got != spec.want {
+				t.Errorf("branch = %q after deploying with %s; want %q", got, spec.deploy, spec.want)
+			}
+		})
+	}
+}
+
+// TestHandlersDenyGroupsWithoutDeploy makes sure that users in groups which can only read a project cannot deploy it,
+// nor lock or comment on its environments.
+func TestHandlersDenyGroupsWithoutDeploy(t *testing.T) {
+	auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+	auth.SetProvider(auth.Anonymous(auth.User{Name: "contractor@example.com", Provider: auth.ProviderOIDC, Groups: []string{"contractors"}}))
+	defer auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+
+	s := etcdtest.NewStore()
+	cfg := config.Config{
+		OIDC: &config.OIDCConfiguration{Groups: []config.GroupRule{{Group: "contractors", Repos: []string{"gengo/*"}}}},
+		Projects: []config.Project{{
+			Name:         "api",
+			Repo:         config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			Environments: []config.Environment{{Name: "production", Branch: "master", Deploy: "/bin/true", Hosts: []config.Host{{Name: "prod1"}}}},
+		}},
+	}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	h, gcl, done := newTestDeployHandler(s)
+	defer done()
+	h.ac = acl.Null
+	feed := activity.NewFeed(s)
+
+	target := url.Values{"project": {"api"}, "environment": {"production"}}
+	for _, spec := range []struct {
+		path string
+		h    http.Handler
+		form url.Values
+		body string
+	}{
+		{
+			path: "/deploy_handler",
+			h:    h,
+			form: url.Values{"project": {"api"}, "environment": {"production"}, "from_revision": {"abc123"}, "to_revision": {"def456"}},
+		},
+		{
+			path: "/api/v1/projects/api/deploy-batch",
+			h:    batchHandler{h},
+			body: `{"environments": ["production"], "revision": "def456"}`,
+		},
+		{path: "/lock", h: lock.NewLock(acl.Null, h.ecl, feed), form: target},
+		{path: "/unlock", h: lock.NewUnlock(acl.Null, h.ecl, feed), form: target},
+		{path: "/comment", h: comment.New(acl.Null, h.ecl, feed), form: url.Values{"project": {"api"}, "environment": {"production"}, "comment": {"DONOTDEPLOY"}}},
+	} {
+		before := make(map[string]string)
+		for k, v := range s.Values {
+			before[k] = v
+		}
+		body := spec.body
+		if spec.form != nil {
+			body = spec.form.Encode()
+		}
+		r, err := http.NewRequest("POST", "http://goship.example"+spec.path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q) failed with %v", spec.path, err)
+		}
+		if spec.form != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		spec.h.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("POST %s = %d %s; want %d", spec.path, w.Code, w.Body.String(), http.StatusForbidden)
+		}
+		if !reflect.DeepEqual(s.Values, before) {
+			t.Errorf("POST %s changed the store to %q; want %q", spec.path, s.Values, before)
+		}
+	}
+	if gcl.calls != 0 {
+		t.Errorf("handlers posted %d commit statuses; want none", gcl.calls)
+	}
+}
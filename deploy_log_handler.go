@@ -2,17 +2,18 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
-	"html/template"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"path"
 	"sort"
 	"time"
 
+	"github.com/gengo/goship/lib/artifact"
 	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/gengo/goship/lib/preflight"
 	"github.com/gengo/goship/lib/revision"
 	helpers "github.com/gengo/goship/lib/view-helpers"
 	"github.com/golang/glog"
@@ -23,25 +24,33 @@ type DeployLogHandler struct {
 	assets helpers.Assets
 }
 
-func (h DeployLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, fullEnv string, environment config.Environment, projectName string) {
+func (h DeployLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, fullEnv string, environment config.Environment, proj config.Project) {
 	u, err := auth.CurrentUser(r)
 	if err != nil {
 		glog.Errorf("Failed to get current user: %v", err)
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	d, err := readEntries(fullEnv)
 	if err != nil {
 		glog.Errorf("Failed to read entries: %v", err)
 	}
-	t, err := template.New("deploy_log.html").ParseFiles("templates/deploy_log.html", "templates/base.html")
+	l := i18n.FromRequest(w, r).In(proj.CommitAge.Location())
+	t, err := h.assets.Page("deploy_log.html", l.Funcs())
 	if err != nil {
 		glog.Errorf("Failed to parse templates: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	now := time.Now()
 	for i := range d {
-		d[i].FormattedTime = formatTime(d[i].Time)
+		d[i].FormattedTime = l.Ago(d[i].Time, now)
 	}
 	sort.Sort(ByTime(d))
 	js, css := h.assets.Templates()
@@ -50,41 +59,15 @@ func (h DeployLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, full
 		"Javascript":  js,
 		"Stylesheet":  css,
 		"Deployments": d,
+		"CSRFToken":   token,
 		"User":        u,
 		"Env":         fullEnv,
 		"Environment": environment,
-		"ProjectName": projectName,
+		"ProjectName": proj.Name,
 	}
 	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
 }
 
-func formatTime(t time.Time) string {
-	s := time.Since(t)
-	switch {
-	case s.Seconds() < 60:
-		f := "second"
-		if math.Floor(s.Seconds()) > 1 {
-			f += "s"
-		}
-		return fmt.Sprintf("%d "+f+" ago", int(s.Seconds()))
-	case s.Minutes() < 60:
-		f := "minute"
-		if math.Floor(s.Minutes()) > 1 {
-			f += "s"
-		}
-		return fmt.Sprintf("%d "+f+" ago", int(s.Minutes()))
-	case s.Hours() < 24:
-		f := "hour"
-		if math.Floor(s.Hours()) > 1 {
-			f += "s"
-		}
-		return fmt.Sprintf("%d "+f+" ago", int(s.Hours()))
-	default:
-		layout := "Jan 2, 2006 at 3:04pm (MST)"
-		return t.Format(layout)
-	}
-}
-
 func readEntries(env string) ([]DeployLogEntry, error) {
 	var d []DeployLogEntry
 	b, err := ioutil.ReadFile(path.Join(*dataPath, env+".json"))
@@ -109,12 +92,45 @@ type RevRange struct {
 }
 
 type DeployLogEntry struct {
+	ID            string   `json:"id,omitempty"`
 	Range         RevRange `json:"range"`
 	DiffURL       string
 	ToRevisionMsg string
 	User          string
 	Success       bool
 	Time          time.Time
+	// Duration is how long the deployment took.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Imported is true if the entry was not made by a deployment but imported from the hosts by bootstrap.
+	Imported bool `json:"imported,omitempty"`
+	// External is true if the entry was reported by an external deploy tool rather than deployed by goship.
+	External bool `json:"external,omitempty"`
+	// LogURL is the URL to the output of an external deployment.
+	LogURL string `json:"log_url,omitempty"`
+	// ChainID identifies the chained deployment which the entry is a step of.
+	ChainID string `json:"chain_id,omitempty"`
+	// Chain is the status of all steps if the entry records a chained deployment as a whole.
+	Chain []ChainStep `json:"chain,omitempty"`
+	// Batch is true if Chain is the status of environments deployed together in a batch rather than a chain.
+	Batch bool `json:"batch,omitempty"`
+	// Pivotal is the result of posting comments to Pivotal stories about the deployment.
+	Pivotal *pivotal.Summary `json:"pivotal,omitempty"`
+	// Flags are the deploy flags given to the deployment.
+	Flags map[string]string `json:"flags,omitempty"`
+	// Note is the reason of the deployment given by the user.
+	Note string `json:"note,omitempty"`
+	// SkippedHosts are the hosts which were excluded from the deployment since they failed the preflight checks.
+	SkippedHosts []preflight.Failure `json:"skipped_hosts,omitempty"`
+	// ReleaseTag is the tag of the GitHub release of the deployed revision.
+	ReleaseTag string `json:"release_tag,omitempty"`
+	// Artifacts are the products of the deployment declared by the deploy command. See package artifact.
+	Artifacts []artifact.Artifact `json:"artifacts,omitempty"`
+	// Hooks are the results of the pre-deploy and post-deploy hooks which ran.
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// Revisions are the revisions of all the repositories which the deployment of a multi-repo project shipped.
+	Revisions config.Revisions `json:"revisions,omitempty"`
+	// RequestID identifies the HTTP request which started the deployment. See package reqlog.
+	RequestID     string `json:"request_id,omitempty"`
 	FormattedTime string `json:",omitempty"`
 }
 
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/artifact"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+)
+
+func TestDeployLogArtifacts(t *testing.T) {
+	pages, err := newPages("")
+	if err != nil {
+		t.Fatalf("newPages failed with %v", err)
+	}
+	tmpl, err := pages.Lookup("deploy_log.html", nil)
+	if err != nil {
+		t.Fatalf("pages.Lookup(%q) failed with %v", "deploy_log.html", err)
+	}
+	entries := []DeployLogEntry{
+		{
+			User: "alice", Success: true, Time: time.Date(2016, 3, 1, 9, 30, 0, 0, time.UTC),
+			Artifacts: []artifact.Artifact{
+				{Name: "tarball", URL: "https://builds.example.com/api-1234.tar.gz"},
+				{Name: "report", URL: "https://ci.example.com/report?build=1234&format=html"},
+			},
+		},
+		{User: "bob", Success: true, Time: time.Date(2016, 3, 1, 8, 30, 0, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, "body", map[string]interface{}{
+		"Deployments": entries,
+		"Env":         "api-production",
+		"Environment": config.Environment{Name: "production"},
+		"ProjectName": "api",
+	})
+	if err != nil {
+		t.Fatalf("tmpl.ExecuteTemplate failed with %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<a href="https://builds.example.com/api-1234.tar.gz" target="_blank">tarball</a> | <a href="https://ci.example.com/report?build=1234&amp;format=html" target="_blank">report</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("deploy log does not contain %q:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, `class="artifacts"`); n != 1 {
+		t.Errorf("deploy log has %d lists of artifacts; want 1 of the deployment with artifacts", n)
+	}
+}
+
+func TestDeployLogLocales(t *testing.T) {
+	pages, err := newPages("")
+	if err != nil {
+		t.Fatalf("newPages failed with %v", err)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+	deployed := time.Date(2016, 3, 1, 9, 30, 0, 0, time.UTC)
+	for _, spec := range []struct {
+		lang string
+		want []string
+	}{
+		{
+			lang: i18n.English,
+			want: []string{`<html lang="en">`, "<h2>Deployment Log</h2>", "Mar 1, 2016 at 6:30pm (JST)", `<span class="label label-success">Success</span>`, `<a href="?lang=ja">`},
+		},
+		{
+			lang: i18n.Japanese,
+			want: []string{`<html lang="ja">`, "<h2>デプロイ履歴</h2>", "2016年3月1日 18:30 (JST)", `<span class="label label-success">成功</span>`, `<a href="?lang=en">`},
+		},
+	} {
+		l := i18n.New(spec.lang, tokyo)
+		tmpl, err := pages.Lookup("deploy_log.html", l.Funcs())
+		if err != nil {
+			t.Fatalf("pages.Lookup(%q) failed with %v", "deploy_log.html", err)
+		}
+		entries := []DeployLogEntry{{User: "alice", Success: true, Time: deployed, FormattedTime: l.Ago(deployed, deployed.Add(48*time.Hour))}}
+		var buf bytes.Buffer
+		err = tmpl.ExecuteTemplate(&buf, "base", map[string]interface{}{
+			"Deployments": entries,
+			"User":        auth.User{Name: "alice"},
+			"Env":         "api-production",
+			"Environment": config.Environment{Name: "production"},
+			"ProjectName": "api",
+		})
+		if err != nil {
+			t.Fatalf("tmpl.ExecuteTemplate failed with %v in %q", err, spec.lang)
+		}
+		got := buf.String()
+		for _, want := range spec.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("deploy log in %q does not contain %q:\n%s", spec.lang, want, got)
+			}
+		}
+	}
+}
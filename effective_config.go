@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// secretEnvVars are the environment variables of credentials which goship reads besides the config.
+var secretEnvVars = []string{"GITHUB_API_TOKEN"}
+
+// effectiveConfig is the config which goship actually runs with, with the secret values masked.
+type effectiveConfig struct {
+	// Config is the config loaded from etcd in the form of config.Masked.
+	Config interface{} `json:"config"`
+	// Environment has the secret environment variables which are set.
+	Environment map[string]string `json:"environment"`
+	// Files has the paths to the files which goship reads, keyed by their flags.
+	Files map[string]string `json:"files"`
+	// Sources maps paths in this object to where the values under them come from, e.g. an etcd key.
+	Sources map[string]string `json:"sources"`
+}
+
+func newEffectiveConfig(c config.Config, keyPath string) effectiveConfig {
+	ec := effectiveConfig{
+		Config:      config.Masked(c),
+		Environment: make(map[string]string),
+		Files:       map[string]string{"k": keyPath},
+		Sources:     map[string]string{"files/k": "flag:-k"},
+	}
+	for k, v := range config.Sources(c) {
+		ec.Sources[strings.TrimSuffix("config/"+k, "/")] = v
+	}
+	for _, name := range secretEnvVars {
+		if os.Getenv(name) != "" {
+			ec.Environment[name] = config.Mask
+			ec.Sources["environment/"+name] = "env:" + name
+		}
+	}
+	return ec
+}
+
+// revealSecret returns the unmasked value at "path" of effectiveConfig.
+func revealSecret(c config.Config, path string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(path, "config/"):
+		return config.Reveal(c, strings.TrimPrefix(path, "config/"))
+	case strings.HasPrefix(path, "environment/"):
+		name := strings.TrimPrefix(path, "environment/")
+		for _, n := range secretEnvVars {
+			if n == name {
+				return os.Getenv(name), nil
+			}
+		}
+	}
+	return nil, &config.Error{Kind: config.ErrInvalid, Msg: fmt.Sprintf("no secret at %q", path)}
+}
+
+// effectiveConfigHandler shows the effective config with the secret values masked, and reveals a value on POST.
+// Only admins can use it, and reveals are recorded in the activity feed.
+// i.e. http://127.0.0.1:8000/admin/config/effective
+// i.e. http://127.0.0.1:8000/admin/config/effective?reveal=config/projects/0/travis_token
+type effectiveConfigHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	// feed records reveals.
+	feed *activity.Feed
+	// keyPath is the path to the private SSH key.
+	keyPath string
+}
+
+func (h effectiveConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load config: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var resp interface{}
+	if r.Method == "POST" {
+		p := r.FormValue("reveal")
+		if p == "" {
+			http.Error(w, "reveal is required", http.StatusBadRequest)
+			return
+		}
+		v, err := revealSecret(c, p)
+		if err != nil {
+			http.Error(w, err.Error(), config.StatusCode(err))
+			return
+		}
+		glog.Infof("%s revealed %s of the config", u.Name, p)
+		h.feed.Record(activity.Entry{Type: activity.SecretRevealed, User: u.Name, Summary: fmt.Sprintf("%s revealed %s of the config", u.Name, p)})
+		resp = map[string]interface{}{"path": p, "value": v}
+	} else {
+		resp = newEffectiveConfig(c, h.keyPath)
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	defer os.Setenv("GITHUB_API_TOKEN", os.Getenv("GITHUB_API_TOKEN"))
+	os.Setenv("GITHUB_API_TOKEN", "github-token")
+	c := config.Config{
+		Projects: []config.Project{{Name: "api", TravisToken: "travis-token", Environments: []config.Environment{{Name: "staging"}}}},
+	}
+
+	ec := newEffectiveConfig(c, "id_rsa")
+	if got := ec.Environment["GITHUB_API_TOKEN"]; got != config.Mask {
+		t.Errorf("environment/GITHUB_API_TOKEN = %q; want %q", got, config.Mask)
+	}
+	for p, want := range map[string]string{
+		"config":                       "etcd:/goship/config",
+		"config/projects/0/envs/0":     "etcd:/goship/projects/api/environments/staging",
+		"environment/GITHUB_API_TOKEN": "env:GITHUB_API_TOKEN",
+	} {
+		if got := ec.Sources[p]; got != want {
+			t.Errorf("sources[%q] = %q; want %q", p, got, want)
+		}
+	}
+
+	for p, want := range map[string]string{
+		"config/projects/0/travis_token": "travis-token",
+		"environment/GITHUB_API_TOKEN":   "github-token",
+	} {
+		got, err := revealSecret(c, p)
+		if err != nil {
+			t.Errorf("revealSecret(c, %q) failed with %v", p, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("revealSecret(c, %q) = %v; want %q", p, got, want)
+		}
+	}
+	for _, p := range []string{"environment/HOME", "files/k", "config/projects/0/missing"} {
+		if _, err := revealSecret(c, p); config.Cause(err) != config.ErrInvalid {
+			t.Errorf("revealSecret(c, %q) = _, %v; want %v", p, err, config.ErrInvalid)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// maxWebhookPayload is the maximum size of webhook payloads which are accepted.
+const maxWebhookPayload = 5 << 20
+
+// branchEvent is the part of payloads of GitHub "push", "create" and "delete" events which ephemeral environments depend on.
+type branchEvent struct {
+	// Ref is "refs/heads/<branch>" in push events, and the bare branch name in create and delete events.
+	Ref     string `json:"ref"`
+	RefType string `json:"ref_type"`
+	// Deleted is true if the push deleted the branch.
+	Deleted    bool `json:"deleted"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// branch returns the name of the pushed, created or deleted branch, or "" if the event is not about a branch.
+func (ev branchEvent) branch(event string) string {
+	switch event {
+	case "push":
+		if strings.HasPrefix(ev.Ref, "refs/heads/") {
+			return strings.TrimPrefix(ev.Ref, "refs/heads/")
+		}
+	case "create", "delete":
+		if ev.RefType == "branch" {
+			return ev.Ref
+		}
+	}
+	return ""
+}
+
+// ephemeralChange is a change of an ephemeral environment made by a webhook.
+type ephemeralChange struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Action is one of "created", "extended" and "removed".
+	Action string `json:"action"`
+}
+
+// applyBranchEvent creates, extends or removes ephemeral environments in "c" for the GitHub "event" with "payload" at "now".
+func applyBranchEvent(s config.RenameStore, c config.Config, event string, payload []byte, now time.Time) ([]ephemeralChange, error) {
+	var ev branchEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, &config.Error{Kind: config.ErrInvalid, Msg: fmt.Sprintf("malformed payload: %v", err)}
+	}
+	changes := []ephemeralChange{}
+	branch := ev.branch(event)
+	if branch == "" {
+		return changes, nil
+	}
+	deleted := event == "delete" || (event == "push" && ev.Deleted)
+	for _, p := range c.Projects {
+		repo := p.SourceRepo()
+		if !strings.EqualFold(fmt.Sprintf("%s/%s", repo.RepoOwner, repo.RepoName), ev.Repository.FullName) {
+			continue
+		}
+		if deleted {
+			name, err := config.RemoveEphemeral(s, c, p.Name, branch)
+			if err != nil {
+				return changes, err
+			}
+			if name != "" {
+				changes = append(changes, ephemeralChange{Project: p.Name, Environment: name, Action: "removed"})
+			}
+			continue
+		}
+		rule, ok := p.EphemeralRuleFor(branch)
+		if !ok {
+			continue
+		}
+		env, created, err := config.PushEphemeral(s, c, p.Name, rule, branch, now)
+		if err != nil {
+			return changes, err
+		}
+		action := "extended"
+		if created {
+			action = "created"
+		}
+		changes = append(changes, ephemeralChange{Project: p.Name, Environment: env.Name, Action: action})
+	}
+	return changes, nil
+}
+
+// validSignature returns true iff "sig" in X-Hub-Signature is the HMAC-SHA1 of "payload" with "secret".
+func validSignature(sig string, payload []byte, secret string) bool {
+	if !strings.HasPrefix(sig, "sha1=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha1="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// githubWebhookHandler creates and removes ephemeral environments on branch events delivered by GitHub webhooks.
+// Deliveries must be signed with github_webhook_secret of the config, and are ignored unless they are about branches.
+// i.e. POST http://127.0.0.1:8000/webhooks/github with X-GitHub-Event: push
+type githubWebhookHandler struct {
+	s config.RenameStore
+	// feed records changes of ephemeral environments.
+	feed *activity.Feed
+	now  func() time.Time
+}
+
+func (h githubWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := config.Load(h.s)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if c.GitHubWebhookSecret == "" {
+		http.Error(w, "github_webhook_secret not configured", http.StatusForbidden)
+		return
+	}
+	if !validSignature(r.Header.Get("X-Hub-Signature"), payload, c.GitHubWebhookSecret) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	event := r.Header.Get("X-GitHub-Event")
+	changes, err := applyBranchEvent(h.s, c, event, payload, h.now())
+	for _, ch := range changes {
+		glog.Infof("%s ephemeral environment %s of %s on %s", ch.Action, ch.Environment, ch.Project, event)
+		if ch.Action != "extended" {
+			h.feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: ch.Project, Environment: ch.Environment, Summary: fmt.Sprintf("%s ephemeral environment %s", ch.Action, ch.Environment)})
+		}
+	}
+	if err != nil {
+		glog.Errorf("Failed to apply %s event to ephemeral environments: %v", event, err)
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	buf, err := json.Marshal(changes)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// ephemeralExpiryInterval is the interval of removing expired ephemeral environments.
+const ephemeralExpiryInterval = 10 * time.Minute
+
+// runEphemeralExpiry removes ephemeral environments which have expired, e.g. whose branches were deleted while webhooks were not delivered.
+func runEphemeralExpiry(ctx context.Context, s config.RenameStore, feed *activity.Feed) {
+	c, err := config.Load(s)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	removed, err := config.RemoveExpiredEphemeral(s, c, time.Now())
+	for _, ref := range removed {
+		glog.Infof("Removed expired ephemeral environment %s", ref)
+		feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: ref.Project, Environment: ref.Environment, Summary: fmt.Sprintf("removed expired ephemeral environment %s", ref.Environment)})
+	}
+	if err != nil {
+		glog.Errorf("Failed to remove expired ephemeral environments: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+)
+
+// webhookStore is a config.RenameStore which keeps values in memory.
+type webhookStore map[string]string
+
+func (s webhookStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	n := s.dir(key)
+	if n == nil {
+		return nil, &etcd.EtcdError{ErrorCode: 100}
+	}
+	return &etcd.Response{Node: n}, nil
+}
+
+func (s webhookStore) dir(key string) *etcd.Node {
+	n := &etcd.Node{Key: key, Dir: true}
+	seen := make(map[string]bool)
+	for k := range s {
+		if !strings.HasPrefix(k, key+"/") {
+			continue
+		}
+		child := key + "/" + strings.SplitN(strings.TrimPrefix(k, key+"/"), "/", 2)[0]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if v, ok := s[child]; ok {
+			n.Nodes = append(n.Nodes, &etcd.Node{Key: child, Value: v})
+		} else {
+			n.Nodes = append(n.Nodes, s.dir(child))
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	return n
+}
+
+func (s webhookStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (s webhookStore) Delete(key string, recursive bool) (*etcd.Response, error) {
+	for k := range s {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(s, k)
+		}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key}}, nil
+}
+
+func sign(payload, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGithubWebhookEphemeral(t *testing.T) {
+	s := make(webhookStore)
+	cfg := config.Config{
+		GitHubWebhookSecret: "secret",
+		Projects: []config.Project{
+			{
+				Name:                  "api",
+				Repo:                  config.Repo{RepoOwner: "gengo", RepoName: "api"},
+				EphemeralEnvironments: []config.EphemeralRule{{Branch: "review/*", Template: "staging", TTLHours: 24}},
+				Environments:          []config.Environment{{Name: "staging", Branch: "master", Hosts: []config.Host{{Name: "review1"}}}},
+			},
+		},
+	}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := githubWebhookHandler{s: s, now: func() time.Time { return now }}
+
+	for _, spec := range []struct {
+		desc, event, payload string
+		// signature defaults to the valid one.
+		signature string
+		code      int
+		response  string
+		// exists is whether the ephemeral environment exists after the event.
+		exists bool
+	}{
+		{
+			desc:      "forged",
+			event:     "create",
+			payload:   `{"ref": "review/login", "ref_type": "branch", "repository": {"full_name": "gengo/api"}}`,
+			signature: "sha1=0123",
+			code:      http.StatusForbidden,
+		},
+		{
+			desc:     "other repo",
+			event:    "create",
+			payload:  `{"ref": "review/login", "ref_type": "branch", "repository": {"full_name": "gengo/web"}}`,
+			code:     http.StatusOK,
+			response: `[]`,
+		},
+		{
+			desc:     "unmatched branch",
+			event:    "push",
+			payload:  `{"ref": "refs/heads/feature/login", "repository": {"full_name": "gengo/api"}}`,
+			code:     http.StatusOK,
+			response: `[]`,
+		},
+		{
+			desc:     "create",
+			event:    "create",
+			payload:  `{"ref": "review/login", "ref_type": "branch", "repository": {"full_name": "gengo/api"}}`,
+			code:     http.StatusOK,
+			response: `[{"project":"api","environment":"review_login","action":"created"}]`,
+			exists:   true,
+		},
+		{
+			desc:     "push",
+			event:    "push",
+			payload:  `{"ref": "refs/heads/review/login", "repository": {"full_name": "Gengo/API"}}`,
+			code:     http.StatusOK,
+			response: `[{"project":"api","environment":"review_login","action":"extended"}]`,
+			exists:   true,
+		},
+		{
+			desc:     "tag",
+			event:    "delete",
+			payload:  `{"ref": "review/login", "ref_type": "tag", "repository": {"full_name": "gengo/api"}}`,
+			code:     http.StatusOK,
+			response: `[]`,
+			exists:   true,
+		},
+		{
+			desc:     "delete",
+			event:    "delete",
+			payload:  `{"ref": "review/login", "ref_type": "branch", "repository": {"full_name": "gengo/api"}}`,
+			code:     http.StatusOK,
+			response: `[{"project":"api","environment":"review_login","action":"removed"}]`,
+		},
+		{
+			desc:     "push after delete",
+			event:    "push",
+			payload:  `{"ref": "refs/heads/review/login", "deleted": true, "repository": {"full_name": "gengo/api"}}`,
+			code:     http.StatusOK,
+			response: `[]`,
+		},
+	} {
+		now = now.Add(time.Hour)
+		req, err := http.NewRequest("POST", "http://localhost/webhooks/github", strings.NewReader(spec.payload))
+		if err != nil {
+			t.Fatalf("http.NewRequest(...) failed with %v", err)
+		}
+		req.Header.Set("X-GitHub-Event", spec.event)
+		sig := spec.signature
+		if sig == "" {
+			sig = sign(spec.payload, "secret")
+		}
+		req.Header.Set("X-Hub-Signature", sig)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != spec.code {
+			t.Errorf("h.ServeHTTP(w, req) responded %d on %s; want %d", w.Code, spec.desc, spec.code)
+			continue
+		}
+		if spec.code == http.StatusOK && w.Body.String() != spec.response {
+			t.Errorf("h.ServeHTTP(w, req) responded %s on %s; want %s", w.Body.String(), spec.desc, spec.response)
+		}
+		c, err := config.Load(s)
+		if err != nil {
+			t.Fatalf("config.Load(s) failed with %v", err)
+		}
+		_, env, err := config.EnvironmentFromName(c.Projects, "api", "review_login")
+		if exists := err == nil; exists != spec.exists {
+			t.Errorf("review_login exists = %v after %s; want %v", exists, spec.desc, spec.exists)
+		}
+		if err == nil && !env.Ephemeral.ExpiresAt.Equal(now.Add(24*time.Hour)) && spec.desc != "tag" {
+			t.Errorf("review_login expires at %v after %s; want %v", env.Ephemeral.ExpiresAt, spec.desc, now.Add(24*time.Hour))
+		}
+	}
+}
+
+func TestValidSignature(t *testing.T) {
+	payload := `{"zen": "Keep it logically awesome."}`
+	for _, spec := range []struct {
+		sig  string
+		want bool
+	}{
+		{sig: sign(payload, "secret"), want: true},
+		{sig: sign(payload, "other")},
+		{sig: strings.TrimPrefix(sign(payload, "secret"), "sha1=")},
+		{sig: "sha1=not-hex"},
+		{sig: ""},
+	} {
+		if got := validSignature(spec.sig, []byte(payload), "secret"); got != spec.want {
+			t.Errorf("validSignature(%q, payload, %q) = %v; want %v", spec.sig, "secret", got, spec.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+// externalDeployRequest is a deployment which an external deploy tool reports.
+type externalDeployRequest struct {
+	Revision revision.Revision `json:"revision"`
+	// From is the revision deployed before. It defaults to the revision of the latest successful deployment in the history.
+	From revision.Revision `json:"from"`
+	// Deployer is the user who deployed with the tool.
+	Deployer string `json:"deployer"`
+	// Status is either "succeeded" or "failed".
+	Status string `json:"status"`
+	// LogURL is the URL to the output of the deployment in the tool.
+	LogURL string `json:"log_url"`
+	// Time is when the deployment finished. It defaults to the time of the report.
+	Time *time.Time `json:"time"`
+	Note string     `json:"note"`
+}
+
+func (req externalDeployRequest) validate() error {
+	if req.Revision == "" {
+		return fmt.Errorf("revision: no revision specified")
+	}
+	if strings.TrimSpace(req.Deployer) == "" {
+		return fmt.Errorf("deployer: no deployer specified")
+	}
+	if req.Status != chainSucceeded && req.Status != chainFailed {
+		return fmt.Errorf("status: must be %q or %q", chainSucceeded, chainFailed)
+	}
+	return nil
+}
+
+// staleEntryError means that a reported deployment is older than the latest one in the history.
+type staleEntryError struct {
+	latest time.Time
+}
+
+func (e staleEntryError) Error() string {
+	return fmt.Sprintf("older than the latest deployment at %s; retry with force=true to record anyway", e.latest.Format(time.RFC3339))
+}
+
+// externalDeployHandler records deployments reported by external deploy tools as if goship deployed them.
+// Reports must be authenticated with API tokens of users who can deploy the project.
+// Deployments older than the latest one in the history are refused with 409 unless "force" is true.
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/environments/production/external-deploy
+// with {"revision": "abc123", "deployer": "alice", "status": "succeeded", "log_url": "https://ci.example.com/builds/1"}
+type externalDeployHandler struct {
+	ac       acl.AccessControl
+	ecl      *etcd.Client
+	deployed *revision.DeployedCache
+	// notify returns a Notifier of the deployments into "env" of "proj" as configured in "c".
+	notify func(c config.Config, proj, env string) notifier.Notifier
+	now    func() time.Time
+}
+
+func newExternalDeployHandler(ac acl.AccessControl, ecl *etcd.Client, deployed *revision.DeployedCache) externalDeployHandler {
+	return externalDeployHandler{ac: ac, ecl: ecl, deployed: deployed, notify: notifier.ForEnvironment, now: time.Now}
+}
+
+func (h externalDeployHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 8 || components[4] == "" || components[5] != "environments" || components[6] == "" || components[7] != "external-deploy" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+	id := reqlog.FromRequest(r)
+	ctx := reqlog.NewContext(context.Background(), id)
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch current user: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if auth.Enabled() && u.Provider != auth.ProviderToken {
+		reqlog.Error(w, id, "external deployments must be reported with an API token", http.StatusForbidden)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch latest configuration: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, env, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		respondTargetError(w, id, err)
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		reqlog.Error(w, id, "permission denied", http.StatusForbidden)
+		return
+	}
+	var req externalDeployRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.record(ctx, c, *proj, *env, u.Name, req, r.FormValue("force") == "true")
+	if _, ok := err.(staleEntryError); ok {
+		reqlog.Error(w, id, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to record an external deployment of %s-%s: %v", projName, envName, err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to marshal response: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write(buf); err != nil {
+		reqlog.Errorf(ctx, "Failed to send response: %v", err)
+	}
+}
+
+// record appends "req" reported by "reporter" to the deploy history of "env", and notifies it and posts it to Pivotal
+// like deployments by goship unless the environment is quiet about external deployments.
+// It returns staleEntryError if "req" is older than the latest deployment in the history unless "force".
+func (h externalDeployHandler) record(ctx context.Context, c config.Config, proj config.Project, env config.Environment, reporter string, req externalDeployRequest, force bool) (DeployLogEntry, error) {
+	t := h.now()
+	if req.Time != nil {
+		t = *req.Time
+	}
+	success := req.Status == chainSucceeded
+	checkOrder := func(entries []DeployLogEntry) error {
+		if force {
+			return nil
+		}
+		for _, e := range entries {
+			if e.Time.After(t) {
+				return staleEntryError{latest: e.Time}
+			}
+		}
+		return nil
+	}
+	// checks the order before notifications, and again when appending the entry.
+	if entries, err := readEntries(fmt.Sprintf("%s-%s", proj.Name, env.Name)); err == nil {
+		if err := checkOrder(entries); err != nil {
+			return DeployLogEntry{}, err
+		}
+		if req.From == "" {
+			req.From = latestDeployed(entries)
+		}
+	}
+	entry := DeployLogEntry{
+		ID:        deployID(proj.Name, env.Name, t),
+		Range:     RevRange{From: req.From, To: req.Revision},
+		User:      req.Deployer,
+		Success:   success,
+		Time:      t,
+		External:  true,
+		LogURL:    req.LogURL,
+		Note:      strings.TrimSpace(req.Note),
+		RequestID: reqlog.FromContext(ctx),
+	}
+	ev := notifier.Event{
+		ID:          entry.ID,
+		Project:     proj.Name,
+		Environment: env.Name,
+		User:        req.Deployer,
+		From:        string(req.From),
+		To:          string(req.Revision),
+		Note:        entry.Note,
+		RequestID:   entry.RequestID,
+	}
+	if !env.QuietExternalDeploys {
+		n := h.notify(c, proj.Name, env.Name)
+		ev.Type = notifier.DeploySucceeded
+		if !success {
+			ev.Type = notifier.DeployFailed
+		}
+		n.Notify(ev)
+		entry.Pivotal = postToPivotal(ctx, c, n, ev, proj, env, entry.Range, nil, pivotalEvent(success, false), h.ecl, entry.ID)
+		postToGithubIssues(ctx, c, proj, env, entry.Range, ev, pivotalEvent(success, false))
+	}
+
+	if err := appendEntryIf(proj.Name, env.Name, entry, checkOrder); err != nil {
+		return DeployLogEntry{}, err
+	}
+	reqlog.Infof(ctx, "%s reported an external deployment of %s-%s to %s by %s: %s", reporter, proj.Name, env.Name, req.Revision, req.Deployer, req.Status)
+
+	if success && h.deployed != nil {
+		drains, err := drain.Load(h.ecl, t)
+		if err != nil {
+			reqlog.Errorf(ctx, "Could not load drained hosts: %v", err)
+		}
+		for _, host := range drains.Active(proj.Name, env.Name, env.Hosts) {
+			h.deployed.Put(proj.Name, env.Name, host.Name, req.Revision, req.Revision, nil)
+		}
+	}
+	return entry, nil
+}
+
+// latestDeployed returns the revision of the latest successful deployment in "entries".
+func latestDeployed(entries []DeployLogEntry) revision.Revision {
+	var (
+		rev    revision.Revision
+		latest time.Time
+	)
+	for _, e := range entries {
+		if e.Success && len(e.Chain) == 0 && !e.Time.Before(latest) {
+			rev, latest = e.Range.To, e.Time
+		}
+	}
+	return rev
+}
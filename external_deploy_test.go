@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"golang.org/x/net/context"
+)
+
+// recordingNotifier records notified events.
+type recordingNotifier struct {
+	events *[]notifier.Event
+}
+
+func (n recordingNotifier) Notify(e notifier.Event) error {
+	*n.events = append(*n.events, e)
+	return nil
+}
+
+func newTestExternalDeployHandler(events *[]notifier.Event, now time.Time) externalDeployHandler {
+	return externalDeployHandler{
+		notify: func(config.Config, string, string) notifier.Notifier { return recordingNotifier{events: events} },
+		now:    func() time.Time { return now },
+	}
+}
+
+func TestExternalDeployOrdering(t *testing.T) {
+	withDataPath(t, func() {
+		proj := config.Project{Name: "api"}
+		env := config.Environment{Name: "production"}
+		now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+		var events []notifier.Event
+		h := newTestExternalDeployHandler(&events, now)
+
+		req := externalDeployRequest{Revision: "abc", Deployer: "alice", Status: chainSucceeded, LogURL: "https://ci.example.com/1"}
+		if _, err := h.record(context.Background(), config.Config{}, proj, env, "ci", req, false); err != nil {
+			t.Fatalf("h.record(ctx, c, proj, env, %q, %#v, false) failed with %v", "ci", req, err)
+		}
+		// a report of a deployment which finished before the latest one.
+		earlier := now.Add(-time.Minute)
+		stale := externalDeployRequest{Revision: "old", Deployer: "bob", Status: chainSucceeded, Time: &earlier}
+		if _, err := h.record(context.Background(), config.Config{}, proj, env, "ci", stale, false); err == nil {
+			t.Errorf("h.record(ctx, c, proj, env, %q, stale, false) succeeded; want failure", "ci")
+		} else if _, ok := err.(staleEntryError); !ok {
+			t.Errorf("h.record(ctx, c, proj, env, %q, stale, false) failed with %v; want staleEntryError", "ci", err)
+		}
+		if _, err := h.record(context.Background(), config.Config{}, proj, env, "ci", stale, true); err != nil {
+			t.Errorf("h.record(ctx, c, proj, env, %q, stale, true) failed with %v", "ci", err)
+		}
+		h.now = func() time.Time { return now.Add(time.Minute) }
+		next := externalDeployRequest{Revision: "def", Deployer: "alice", Status: chainFailed}
+		if _, err := h.record(context.Background(), config.Config{}, proj, env, "ci", next, false); err != nil {
+			t.Errorf("h.record(ctx, c, proj, env, %q, next, false) failed with %v", "ci", err)
+		}
+
+		entries, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		var got []RevRange
+		for _, e := range entries {
+			if !e.External {
+				t.Errorf("entry %#v is not external", e)
+			}
+			got = append(got, e.Range)
+		}
+		want := []RevRange{{To: "abc"}, {From: "abc", To: "old"}, {From: "abc", To: "def"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ranges = %#v; want %#v", got, want)
+		}
+		if got, want := entries[0].LogURL, req.LogURL; got != want {
+			t.Errorf("entries[0].LogURL = %q; want %q", got, want)
+		}
+		if entries[2].Success {
+			t.Errorf("entries[2].Success = true; want false")
+		}
+		if got := len(events); got != 3 {
+			t.Errorf("len(events) = %d; want 3 without the refused one", got)
+		}
+	})
+}
+
+func TestExternalDeployNotification(t *testing.T) {
+	for _, spec := range []struct {
+		quiet  bool
+		status string
+		want   []notifier.EventType
+	}{
+		{status: chainSucceeded, want: []notifier.EventType{notifier.DeploySucceeded}},
+		{status: chainFailed, want: []notifier.EventType{notifier.DeployFailed}},
+		{quiet: true, status: chainSucceeded},
+		{quiet: true, status: chainFailed},
+	} {
+		withDataPath(t, func() {
+			proj := config.Project{Name: "api"}
+			env := config.Environment{Name: "production", QuietExternalDeploys: spec.quiet}
+			var events []notifier.Event
+			h := newTestExternalDeployHandler(&events, time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC))
+			req := externalDeployRequest{Revision: "abc", Deployer: "alice", Status: spec.status}
+			if _, err := h.record(context.Background(), config.Config{}, proj, env, "ci", req, false); err != nil {
+				t.Fatalf("h.record(ctx, c, proj, env, %q, %#v, false) failed with %v", "ci", req, err)
+			}
+			var got []notifier.EventType
+			for _, e := range events {
+				got = append(got, e.Type)
+				if e.User != "alice" || e.To != "abc" {
+					t.Errorf("event = %#v; want deployment of %q by %q", e, "abc", "alice")
+				}
+			}
+			if !reflect.DeepEqual(got, spec.want) {
+				t.Errorf("events of %s with quiet=%v = %q; want %q", spec.status, spec.quiet, got, spec.want)
+			}
+		})
+	}
+}
+
+func TestExternalDeployRequestValidate(t *testing.T) {
+	for _, req := range []externalDeployRequest{
+		{Deployer: "alice", Status: chainSucceeded},
+		{Revision: "abc", Status: chainSucceeded},
+		{Revision: "abc", Deployer: "alice"},
+		{Revision: "abc", Deployer: "alice", Status: "skipped"},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("%#v.validate() succeeded; want failure", req)
+		}
+	}
+	if err := (externalDeployRequest{Revision: "abc", Deployer: "alice", Status: chainFailed}).validate(); err != nil {
+		t.Errorf("validate() failed with %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/golang/glog"
+)
+
+// installationsTTL is how long the installations of projects are cached before the config is loaded again.
+const installationsTTL = time.Minute
+
+// newGithubClient returns the client of GitHub APIs which goship calls them with.
+// It authenticates as the GitHub App in the config if configured, or with GITHUB_API_TOKEN otherwise.
+// The config package calls GitHub APIs with the same client.
+func newGithubClient(ecl *etcd.Client) (githublib.Client, error) {
+	var app *config.GitHubAppConfiguration
+	c, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load config for GitHub authentication: %v", err)
+	} else {
+		app = c.GitHubApp
+	}
+
+	var gcl githublib.Client
+	if app != nil {
+		a, err := githublib.NewApp(app.AppID, []byte(app.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid github_app: %v", err)
+		}
+		r := &installationResolver{load: func() (config.Config, error) { return config.Load(ecl) }, now: time.Now}
+		gcl = githublib.NewAppClient(a, app.InstallationID, r.installationOf)
+		glog.Infof("Authenticating to GitHub as app %d", app.AppID)
+	} else {
+		gt := os.Getenv(gitHubAPITokenEnvVar)
+		if gt == "" {
+			return nil, fmt.Errorf("environment variable %s not defined and github_app not configured", gitHubAPITokenEnvVar)
+		}
+		gcl = githublib.NewClient(gt)
+	}
+	config.SetGitHubClient(gcl)
+	return githublib.WithCompareCache(gcl, compareCacheSize), nil
+}
+
+// installationResolver finds the GitHub App installations of repositories in the config,
+// which it caches for installationsTTL since GitHub APIs are called far more often than the config changes.
+type installationResolver struct {
+	load func() (config.Config, error)
+	now  func() time.Time
+
+	mu     sync.Mutex
+	c      config.Config
+	loaded time.Time
+}
+
+// installationOf returns the installation of the project of "owner/repo", or 0 for the default one.
+// The last loaded config is used if the config fails to load.
+func (r *installationResolver) installationOf(owner, repo string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := r.now(); now.Sub(r.loaded) >= installationsTTL {
+		c, err := r.load()
+		if err != nil {
+			glog.Errorf("Failed to load config for GitHub App installations: %v", err)
+		} else {
+			r.c = c
+		}
+		r.loaded = now
+	}
+	return r.c.GitHubInstallationOf(owner, repo)
+}
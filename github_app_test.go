@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestInstallationResolver(t *testing.T) {
+	now := time.Date(2016, 7, 11, 12, 0, 0, 0, time.UTC)
+	loads := 0
+	var loadErr error
+	configWith := func(id int) config.Config {
+		return config.Config{Projects: []config.Project{
+			{Name: "partner", Repo: config.Repo{RepoOwner: "partner", RepoName: "web"}, GitHubInstallationID: id},
+		}}
+	}
+	c := configWith(7)
+	r := &installationResolver{
+		load: func() (config.Config, error) {
+			loads++
+			return c, loadErr
+		},
+		now: func() time.Time { return now },
+	}
+	check := func(want, wantLoads int) {
+		if got := r.installationOf("partner", "web"); got != want {
+			t.Errorf("r.installationOf(%q, %q) = %d at %s; want %d", "partner", "web", got, now, want)
+		}
+		if loads != wantLoads {
+			t.Errorf("config loaded %d times by %s; want %d", loads, now, wantLoads)
+		}
+	}
+	check(7, 1)
+
+	// cached until installationsTTL passes
+	c = configWith(8)
+	now = now.Add(installationsTTL / 2)
+	check(7, 1)
+	now = now.Add(installationsTTL)
+	check(8, 2)
+
+	// the last loaded config is kept on failures
+	loadErr = errors.New("etcd unavailable")
+	c = config.Config{}
+	now = now.Add(installationsTTL)
+	check(8, 3)
+}
@@ -0,0 +1,212 @@
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+	"github.com/golang/glog"
+)
+
+const (
+	// defaultLimit is the number of entries per page unless specified.
+	defaultLimit = 50
+	// maxLimit is the maximum number of entries per page.
+	maxLimit = 500
+)
+
+type handler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which lists activities in projects readable by the current user from the newest.
+// "before" is the cursor returned as "next" in the previous page. "project" and "type" select activities.
+// i.e. http://127.0.0.1:8000/api/v1/activity?limit=50&before=00001443700800000000000&project=goship&type=deploy_failed
+func New(ac acl.AccessControl, ecl *etcd.Client) http.Handler {
+	return handler{ac: ac, ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	limit := defaultLimit
+	if s := r.FormValue("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > maxLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	visible, err := visibility(h.ac, h.ecl, u)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page, err := activity.List(h.ecl, activity.Query{
+		Limit:   limit,
+		Before:  r.FormValue("before"),
+		Project: r.FormValue("project"),
+		Type:    r.FormValue("type"),
+		Visible: visible,
+	})
+	if err != nil {
+		glog.Errorf("Failed to list activities: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := json.Marshal(page)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// visibility returns a function which tells if "u" can see an activity.
+// Activities of projects are visible iff the projects are readable. Other activities are visible to everyone.
+func visibility(ac acl.AccessControl, ecl *etcd.Client, u auth.User) (func(activity.Entry) bool, error) {
+	c, err := config.Load(ecl)
+	if err != nil {
+		return nil, err
+	}
+	readable := make(map[string]bool)
+	for _, p := range acl.ReadableProjects(acl.ForUser(ac, c, u), c.Projects, u) {
+		readable[p.Name] = true
+	}
+	return func(e activity.Entry) bool {
+		return e.Project == "" || readable[e.Project]
+	}, nil
+}
+
+type stream struct {
+	ac   acl.AccessControl
+	ecl  *etcd.Client
+	feed *activity.Feed
+}
+
+// NewStream returns an http.Handler which sends activities visible to the current user as server-sent events
+// as soon as they are recorded into "feed". "project" and "type" select activities like New.
+// i.e. http://127.0.0.1:8000/api/v1/activity/stream?project=goship
+func NewStream(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed) http.Handler {
+	return stream{ac: ac, ecl: ecl, feed: feed}
+}
+
+func (h stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	visible, err := visibility(h.ac, h.ecl, u)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := activity.Query{Project: r.FormValue("project"), Type: r.FormValue("type"), Visible: visible}
+
+	entries, cancel := h.feed.Subscribe()
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case e := <-entries:
+			if !q.Matches(e) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				glog.Errorf("Failed to send activity: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes "e" as a server-sent event.
+func writeEvent(w http.ResponseWriter, e activity.Entry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.ID, buf)
+	return err
+}
+
+type page struct {
+	assets helpers.Assets
+}
+
+// NewPage returns an http.Handler which renders the activity feed.
+// i.e. http://127.0.0.1:8000/activity
+func NewPage(assets helpers.Assets) http.Handler {
+	return page{assets: assets}
+}
+
+func (h page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t, err := h.assets.Page("activity.html", i18n.FromRequest(w, r).Funcs())
+	if err != nil {
+		glog.Errorf("Failed to parse templates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	js, css := h.assets.Templates()
+	params := map[string]interface{}{
+		"Javascript": js,
+		"Stylesheet": css,
+		"CSRFToken":  token,
+		"User":       u,
+		"Page":       "activity",
+	}
+	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
+}
@@ -0,0 +1,136 @@
+package annotations
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/annotation"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which manages the annotations of an environment.
+// GET lists the active annotations, POST pins a new one, PUT replaces the one in "id" and DELETE dismisses it.
+// Users who can read the project can list its annotations, and only users who can deploy it can change them.
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/environments/production/annotations
+// with {"message": "DB migration in progress", "severity": "critical", "blocks_deploys": true, "ttl": "2h"}
+func New(ac acl.AccessControl, ecl *etcd.Client) http.Handler {
+	return handler{ac: ac, ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 8 || components[4] == "" || components[5] != "environments" || components[6] == "" ||
+		components[7] != "annotations" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "PUT" && r.Method != "DELETE" {
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	p, _, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := p.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "no such project", http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" && !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	var resp interface{}
+	switch r.Method {
+	case "GET":
+		as, err := annotation.Load(h.ecl, time.Now())
+		if err != nil {
+			glog.Errorf("Failed to load annotations: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := as.Of(projName, envName)
+		if list == nil {
+			list = []annotation.Annotation{}
+		}
+		resp = list
+	case "DELETE":
+		id := r.FormValue("id")
+		if err := annotation.Dismiss(h.ecl, projName, envName, id); err != nil {
+			if err == annotation.ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			glog.Errorf("Failed to dismiss annotation %s of %s-%s: %v", id, projName, envName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("%s dismissed annotation %s of %s-%s", u.Name, id, projName, envName)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		var params annotation.Params
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "malformed annotation: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var a annotation.Annotation
+		if r.Method == "POST" {
+			a, err = annotation.Create(h.ecl, projName, envName, u.Name, params, time.Now())
+		} else {
+			a, err = annotation.Update(h.ecl, projName, envName, r.FormValue("id"), u.Name, params, time.Now())
+		}
+		if err == annotation.ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			// validation errors of params are the most likely ones.
+			glog.Warningf("Failed to annotate %s-%s: %v", projName, envName, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("%s annotated %s-%s with a %s annotation %s: %s", u.Name, projName, envName, a.Severity, a.ID, a.Message)
+		resp = a
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package branches
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+const (
+	// cacheTTL is how long lists of branches are cached.
+	cacheTTL = time.Minute
+	// perPage is the number of branches fetched from GitHub at once.
+	perPage = 100
+)
+
+// Branch is a branch in a repository.
+type Branch struct {
+	Name string `json:"name"`
+	// Revision is the head commit of the branch.
+	Revision string `json:"revision"`
+	// Date is when the head commit was committed.
+	Date time.Time `json:"date"`
+}
+
+type handler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+	l   *lister
+}
+
+// New returns an http.Handler which lists branches of a project, most recently committed first.
+// i.e. http://127.0.0.1:8000/api/v1/projects/my-project/branches
+func New(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client) http.Handler {
+	return handler{ac: ac, ecl: ecl, l: newLister(gcl)}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 6 || components[4] == "" || components[5] != "branches" {
+		http.NotFound(w, r)
+		return
+	}
+	projName := components[4]
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	p, err := acl.FindProject(ac, c.Projects, u, projName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := p.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	branches, err := h.l.list(p.RepoOwner, p.RepoName)
+	if err != nil {
+		glog.Errorf("Failed to list branches of %s/%s: %v", p.RepoOwner, p.RepoName, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	buf, err := json.Marshal(branches)
+	if err != nil {
+		glog.Errorf("Failed to marshal branches: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+type cacheEntry struct {
+	branches []Branch
+	expires  time.Time
+}
+
+// lister lists branches in GitHub repositories and caches them.
+type lister struct {
+	gcl githublib.Client
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+	// dates maps commit SHAs to their commit dates. Commits never change, so they are cached forever.
+	dates map[string]time.Time
+}
+
+func newLister(gcl githublib.Client) *lister {
+	return &lister{
+		gcl:   gcl,
+		now:   time.Now,
+		cache: make(map[string]cacheEntry),
+		dates: make(map[string]time.Time),
+	}
+}
+
+// list returns all branches in the repository, most recently committed first.
+func (l *lister) list(owner, repo string) ([]Branch, error) {
+	key := owner + "/" + repo
+	l.mu.Lock()
+	e, ok := l.cache[key]
+	l.mu.Unlock()
+	if ok && l.now().Before(e.expires) {
+		return e.branches, nil
+	}
+
+	var branches []Branch
+	opt := &github.ListOptions{PerPage: perPage}
+	for {
+		bs, resp, err := l.gcl.ListBranches(owner, repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bs {
+			if b.Name == nil || b.Commit == nil || b.Commit.SHA == nil {
+				continue
+			}
+			br := Branch{Name: *b.Name, Revision: *b.Commit.SHA}
+			if br.Date, err = l.commitDate(owner, repo, br.Revision); err != nil {
+				glog.Errorf("Failed to get commit %s in %s: %v", br.Revision, key, err)
+			}
+			branches = append(branches, br)
+		}
+		if resp == nil || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	sort.Sort(byDate(branches))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache[key] = cacheEntry{branches: branches, expires: l.now().Add(cacheTTL)}
+	return branches, nil
+}
+
+func (l *lister) commitDate(owner, repo, sha string) (time.Time, error) {
+	l.mu.Lock()
+	d, ok := l.dates[sha]
+	l.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+	c, _, err := l.gcl.GetCommit(owner, repo, sha)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if c.Commit != nil && c.Commit.Committer != nil && c.Commit.Committer.Date != nil {
+		d = *c.Commit.Committer.Date
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dates[sha] = d
+	return d, nil
+}
+
+// byDate sorts branches by date, most recent first, and then by name.
+type byDate []Branch
+
+func (b byDate) Len() int      { return len(b) }
+func (b byDate) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byDate) Less(i, j int) bool {
+	if !b[i].Date.Equal(b[j].Date) {
+		return b[i].Date.After(b[j].Date)
+	}
+	return b[i].Name < b[j].Name
+}
@@ -0,0 +1,106 @@
+package branches
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// pagedClient is a githublib.Client which returns branches page by page.
+type pagedClient struct {
+	githublib.Client
+	pages [][]github.Branch
+	dates map[string]time.Time
+	// calls is the number of calls of ListBranches.
+	calls *int
+}
+
+func (c pagedClient) ListBranches(owner, repo string, opt *github.ListOptions) ([]github.Branch, *github.Response, error) {
+	*c.calls++
+	page := opt.Page
+	if page == 0 {
+		page = 1
+	}
+	if page > len(c.pages) {
+		return nil, nil, fmt.Errorf("unexpected page %d", page)
+	}
+	resp := new(github.Response)
+	if page < len(c.pages) {
+		resp.NextPage = page + 1
+	}
+	return c.pages[page-1], resp, nil
+}
+
+func (c pagedClient) GetCommit(owner, repo, sha1 string) (*github.RepositoryCommit, *github.Response, error) {
+	d, ok := c.dates[sha1]
+	if !ok {
+		return nil, nil, fmt.Errorf("no such commit %s", sha1)
+	}
+	return &github.RepositoryCommit{
+		SHA:    github.String(sha1),
+		Commit: &github.Commit{Committer: &github.CommitAuthor{Date: &d}},
+	}, nil, nil
+}
+
+func branch(name, sha string) github.Branch {
+	return github.Branch{Name: github.String(name), Commit: &github.Commit{SHA: github.String(sha)}}
+}
+
+func TestList(t *testing.T) {
+	base := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	gcl := pagedClient{
+		pages: [][]github.Branch{
+			{branch("master", "aaa"), branch("feature-a", "bbb")},
+			{branch("feature-b", "ccc"), branch("feature-c", "aaa")},
+			{branch("old", "ddd")},
+		},
+		dates: map[string]time.Time{
+			"aaa": base.Add(2 * time.Hour),
+			"bbb": base.Add(3 * time.Hour),
+			"ccc": base.Add(time.Hour),
+			"ddd": base,
+		},
+		calls: &calls,
+	}
+	now := base.Add(24 * time.Hour)
+	l := newLister(gcl)
+	l.now = func() time.Time { return now }
+
+	got, err := l.list("gengo", "goship")
+	if err != nil {
+		t.Fatalf("l.list(%q, %q) failed with %v", "gengo", "goship", err)
+	}
+	want := []Branch{
+		{Name: "feature-a", Revision: "bbb", Date: base.Add(3 * time.Hour)},
+		{Name: "feature-c", Revision: "aaa", Date: base.Add(2 * time.Hour)},
+		{Name: "master", Revision: "aaa", Date: base.Add(2 * time.Hour)},
+		{Name: "feature-b", Revision: "ccc", Date: base.Add(time.Hour)},
+		{Name: "old", Revision: "ddd", Date: base},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("l.list(%q, %q) = %#v; want %#v", "gengo", "goship", got, want)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d; want %d", calls, 3)
+	}
+
+	if _, err := l.list("gengo", "goship"); err != nil {
+		t.Fatalf("l.list(%q, %q) failed with %v", "gengo", "goship", err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d; want %d; branches must be cached", calls, 3)
+	}
+
+	now = now.Add(cacheTTL)
+	if _, err := l.list("gengo", "goship"); err != nil {
+		t.Fatalf("l.list(%q, %q) failed with %v", "gengo", "goship", err)
+	}
+	if calls != 6 {
+		t.Errorf("calls = %d; want %d; cache must expire", calls, 6)
+	}
+}
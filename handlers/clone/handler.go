@@ -0,0 +1,70 @@
+package clone
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/proxy"
+	"github.com/golang/glog"
+)
+
+// handler creates a new environment like an existing one.
+type handler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	feed    *activity.Feed
+}
+
+// New returns an http.Handler which clones an environment. Only users for whom "isAdmin" returns true can use it.
+// Clones are recorded into "feed".
+// "hosts" is a comma- or newline-separated list of hosts of the new environment.
+// i.e. http://127.0.0.1:8000/clone_environment?project=admin&environment=staging&name=staging2&hosts=web3.example.com,web4.example.com
+func New(ecl *etcd.Client, isAdmin func(user string) bool, feed *activity.Feed) http.Handler {
+	return handler{ecl: ecl, isAdmin: isAdmin, feed: feed}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	p := r.FormValue("project")
+	envName := r.FormValue("environment")
+	name := strings.TrimSpace(r.FormValue("name"))
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, src, err := config.ResolveTarget(c.Projects, p, envName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	env := config.CloneEnvironment(*src, name, config.ParseHosts(r.FormValue("hosts")))
+	if err := config.AddEnvironment(h.ecl, c, p, env); err != nil {
+		glog.Errorf("Failed to clone %s-%s into %s: %v", p, envName, name, err)
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	glog.Infof("%s cloned %s-%s into %s", u.Name, p, envName, name)
+	h.feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: p, Environment: name, User: u.Name, Summary: fmt.Sprintf("%s cloned %s-%s into %s", u.Name, p, envName, name)})
+	http.Redirect(w, r, proxy.Path("/"), http.StatusSeeOther)
+}
@@ -1,32 +1,64 @@
 package comment
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/proxy"
 	"github.com/golang/glog"
 )
 
 // CommentHandler allows you to update a comment on an environment
 // i.e. http://127.0.0.1:8000/comment?environment=staging&project=admin&comment=DONOTDEPLOYPLEASE!
+// Comments are recorded into "feed". Only users who can deploy the project can comment on its environments.
 type handler struct {
-	ecl *etcd.Client
+	ac   acl.AccessControl
+	ecl  *etcd.Client
+	feed *activity.Feed
 }
 
-func New(ecl *etcd.Client) http.Handler {
-	return handler{ecl: ecl}
+func New(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed) http.Handler {
+	return handler{ac: ac, ecl: ecl, feed: feed}
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	p := r.FormValue("project")
 	env := r.FormValue("environment")
 	comment := r.FormValue("comment")
-	err := config.SetComment(h.ecl, p, env, comment)
+	c, err := config.Load(h.ecl)
 	if err != nil {
-		glog.Errorf("Failed to store comment for project=%s env=%s: %v", p, env, err)
+		glog.Errorf("Failed to load configuration: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	ac := acl.ForUser(h.ac, c, u)
+	proj, _, err := acl.ResolveTarget(ac, c.Projects, u, p, env)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	err = config.SetComment(h.ecl, p, env, comment)
+	if err != nil {
+		glog.Errorf("Failed to store comment for project=%s env=%s: %v", p, env, err)
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	h.feed.Record(activity.Entry{Type: activity.Commented, Project: p, Environment: env, User: u.Name, Summary: fmt.Sprintf("%s commented on %s-%s: %s", u.Name, p, env, comment)})
+	http.Redirect(w, r, proxy.Path("/"), http.StatusSeeOther)
 }
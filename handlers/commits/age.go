@@ -0,0 +1,240 @@
+package commits
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/golang/glog"
+)
+
+// pendingAge describes the oldest commit which is in the tip of an environment but not deployed yet.
+type pendingAge struct {
+	SHA string `json:"sha"`
+	// Date is the committer date of the commit in the timezone of the project.
+	Date time.Time `json:"date"`
+	// WaitingSeconds is how long the commit has been waiting to be deployed.
+	WaitingSeconds int64 `json:"waitingSeconds"`
+	// Level is "warning" or "danger" if the commit has waited beyond the thresholds of the project.
+	Level string `json:"level,omitempty"`
+	// Pending is the number of commits waiting to be deployed.
+	Pending int `json:"pending"`
+}
+
+// annotateAges sets how long each of "commits" has been waiting to be deployed at "now" with the thresholds in "ages",
+// and returns the age of the oldest one. It returns nil if none of the commits have dates.
+func annotateAges(commits []compareCommit, ages *config.CommitAgeConfiguration, now time.Time) *pendingAge {
+	var oldest *pendingAge
+	loc := ages.Location()
+	for i := range commits {
+		c := &commits[i]
+		if c.Date == nil {
+			continue
+		}
+		date := c.Date.In(loc)
+		age := now.Sub(date)
+		c.Date, c.WaitingSeconds, c.AgeLevel = &date, int64(age/time.Second), ages.Level(age)
+		if oldest == nil || date.Before(oldest.Date) {
+			oldest = &pendingAge{SHA: c.SHA, Date: date, WaitingSeconds: c.WaitingSeconds, Level: c.AgeLevel}
+		}
+	}
+	if oldest != nil {
+		oldest.Pending = len(commits)
+	}
+	return oldest
+}
+
+// oldestUndeployed returns the age of the oldest commit in "tip" but not in "deployed" of "proj" at "now".
+// The commits are compared with "gcl", which should cache the comparisons.
+// It returns nil if there are no such commits or either revision is unknown.
+func oldestUndeployed(gcl githublib.Client, proj config.Project, deployed, tip revision.Revision, now time.Time) (*pendingAge, error) {
+	if deployed == "" || tip == "" || deployed == tip {
+		return nil, nil
+	}
+	repo := proj.SourceRepo()
+	res, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(deployed), string(tip))
+	if err != nil {
+		return nil, err
+	}
+	return annotateAges(compareCommits(res.Commits), proj.CommitAge, now), nil
+}
+
+// mostCommon returns the revision which appears the most in "revs" ignoring empty ones.
+// Ties are broken by the order of "revs". It returns an empty revision if all are empty.
+func mostCommon(revs []revision.Revision) revision.Revision {
+	var (
+		best   revision.Revision
+		counts = make(map[revision.Revision]int)
+	)
+	for _, rev := range revs {
+		if rev == "" {
+			continue
+		}
+		counts[rev]++
+		if counts[rev] > counts[best] {
+			best = rev
+		}
+	}
+	return best
+}
+
+// envAge is an environment in the drift-by-age view.
+type envAge struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Deployed is the source code revision deployed into most of the undrained hosts.
+	Deployed revision.Revision `json:"deployed"`
+	// Tip is the source code revision of the latest deployable revision.
+	Tip revision.Revision `json:"tip,omitempty"`
+	// Oldest is nil for unconfigured environments, which have nothing deployed.
+	Oldest *pendingAge `json:"oldestUndeployed,omitempty"`
+	// Risk is the risk of deploying the commits pending in the first repository, if any.
+	Risk *pendingRisk `json:"risk,omitempty"`
+	// State is "unconfigured" if the environment has no hosts yet, or empty otherwise.
+	State string `json:"state,omitempty"`
+}
+
+// waitingSeconds returns how long the oldest undeployed commit has waited, or -1 if the environment is unconfigured.
+func (a envAge) waitingSeconds() int64 {
+	if a.Oldest == nil {
+		return -1
+	}
+	return a.Oldest.WaitingSeconds
+}
+
+// byWaiting sorts environments from the longest waiting. Unconfigured environments come last.
+type byWaiting []envAge
+
+func (b byWaiting) Len() int      { return len(b) }
+func (b byWaiting) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byWaiting) Less(i, j int) bool {
+	if wi, wj := b[i].waitingSeconds(), b[j].waitingSeconds(); wi != wj {
+		return wi > wj
+	}
+	if b[i].Project != b[j].Project {
+		return b[i].Project < b[j].Project
+	}
+	return b[i].Environment < b[j].Environment
+}
+
+type driftAgeHandler struct {
+	handler
+	now func() time.Time
+}
+
+// NewDriftByAge returns a new http.Handler which lists environments readable by the user which have undeployed commits,
+// from the one whose oldest undeployed commit has waited the longest, followed by ones without hosts in the state "unconfigured".
+// Ephemeral environments are left out.
+// Revisions are served only from "tips" and "deployed" like NewStatus, and commits are compared with "gcl",
+// which should cache the comparisons. Repositories of multi-repo projects other than the first one count as well
+// with their revisions returned by "repoRevisions". Risks of deploying the commits count the days since "lastDeploy" like New.
+// i.e. http://127.0.0.1:8000/api/v1/drift/age
+func NewDriftByAge(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, tips *revision.TipCache, deployed *revision.DeployedCache, repoRevisions func(proj, env string) config.Revisions, lastDeploy func(proj, env string) (time.Time, bool)) http.Handler {
+	return driftAgeHandler{handler: handler{ac: ac, ecl: ecl, gcl: gcl, tips: tips, deployed: deployed, repoRevisions: repoRevisions, lastDeploy: lastDeploy}, now: time.Now}
+}
+
+func (h driftAgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	projs := acl.ReadableProjects(acl.ForUser(h.ac, c, u), withoutEphemeral(c.Projects), u)
+	buf, err := json.Marshal(h.driftByAge(projs, h.loadDrains().Active))
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// driftByAge returns the environments of "projs" which have undeployed commits sorted by the age of the oldest ones,
+// and the unconfigured ones. "active" returns the undrained hosts of an environment.
+// Environments whose revisions are not cached yet are skipped.
+func (h driftAgeHandler) driftByAge(projs []config.Project, active func(proj, env string, hosts []config.Host) []config.Host) []envAge {
+	envs := []envAge{}
+	now := h.now()
+	for _, p := range projs {
+		for _, e := range p.Environments {
+			if e.Unconfigured() {
+				envs = append(envs, envAge{Project: p.Name, Environment: e.Name, State: stateUnconfigured})
+				continue
+			}
+			tip, ok := h.tips.Peek(p, e)
+			if !ok || tip.SrcRev == "" {
+				continue
+			}
+			var revs []revision.Revision
+			for _, host := range active(p.Name, e.Name, e.Hosts) {
+				if dep, ok := h.deployed.Get(p.Name, e.Name, host.Name); ok {
+					revs = append(revs, dep.SrcRev)
+				}
+			}
+			deployed := mostCommon(revs)
+			oldest, err := oldestUndeployed(h.gcl, p, deployed, tip.SrcRev, now)
+			if err != nil {
+				glog.Errorf("Failed to compare %s and %s of %s-%s: %v", deployed, tip.SrcRev, p.Name, e.Name, err)
+				continue
+			}
+			var risk *pendingRisk
+			if oldest != nil {
+				risk = h.risk(p, e.Name, deployed, tip.SrcRev, now)
+			}
+			oldest = olderPending(oldest, h.otherReposOldest(p, e, now))
+			if oldest == nil {
+				continue
+			}
+			envs = append(envs, envAge{Project: p.Name, Environment: e.Name, Deployed: deployed, Tip: tip.SrcRev, Oldest: oldest, Risk: risk})
+		}
+	}
+	sort.Sort(byWaiting(envs))
+	return envs
+}
+
+// otherReposOldest returns the age of the oldest undeployed commit in the repositories of "p" but the first one in "e".
+// Repositories whose tips are not cached yet or which cannot be compared are skipped.
+func (h driftAgeHandler) otherReposOldest(p config.Project, e config.Environment, now time.Time) *pendingAge {
+	if len(p.Repos) < 2 {
+		return nil
+	}
+	revs := h.deployedRepoRevisions(p.Name, e.Name)
+	var oldest *pendingAge
+	for _, r := range p.Repos[1:] {
+		rp := p.ForRepo(r)
+		tip, ok := h.tips.Peek(rp, r.EnvironmentFor(e))
+		if !ok || tip.SrcRev == "" {
+			continue
+		}
+		deployed := revision.Revision(revs[r.Name()])
+		o, err := oldestUndeployed(h.gcl, rp, deployed, tip.SrcRev, now)
+		if err != nil {
+			glog.Errorf("Failed to compare %s and %s of %s in %s-%s: %v", deployed, tip.SrcRev, r.Name(), p.Name, e.Name, err)
+			continue
+		}
+		oldest = olderPending(oldest, o)
+	}
+	return oldest
+}
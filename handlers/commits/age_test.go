@@ -0,0 +1,183 @@
+package commits
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// datedCommit is a testCommit committed at "date".
+func datedCommit(sha string, date time.Time) github.RepositoryCommit {
+	c := testCommit(sha, "Commit "+sha, "alice")
+	c.Commit.Committer = &github.CommitAuthor{Date: &date}
+	return c
+}
+
+func TestOldestUndeployed(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"fresh...tip": {Commits: []github.RepositoryCommit{datedCommit("tip", now.Add(-time.Hour))}},
+		// exactly at the warning threshold
+		"boundary...tip": {Commits: []github.RepositoryCommit{datedCommit("c1", now.Add(-48*time.Hour)), datedCommit("tip", now.Add(-time.Hour))}},
+		"amber...tip":    {Commits: []github.RepositoryCommit{datedCommit("c2", now.Add(-48*time.Hour-time.Second)), datedCommit("tip", now.Add(-time.Hour))}},
+		"red...tip":      {Commits: []github.RepositoryCommit{datedCommit("c3", now.Add(-8*24*time.Hour)), datedCommit("c2", now.Add(-3*24*time.Hour)), datedCommit("tip", now)}},
+		"undated...tip":  {Commits: []github.RepositoryCommit{testCommit("tip", "Fix it", "bob")}},
+	}}
+	proj := config.Project{Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+
+	for _, spec := range []struct {
+		deployed revision.Revision
+		want     *pendingAge
+	}{
+		{deployed: "tip"},
+		{deployed: ""},
+		{deployed: "undated"},
+		{
+			deployed: "fresh",
+			want:     &pendingAge{SHA: "tip", Date: now.Add(-time.Hour), WaitingSeconds: 3600, Pending: 1},
+		},
+		{
+			deployed: "boundary",
+			want:     &pendingAge{SHA: "c1", Date: now.Add(-48 * time.Hour), WaitingSeconds: 48 * 3600, Pending: 2},
+		},
+		{
+			deployed: "amber",
+			want:     &pendingAge{SHA: "c2", Date: now.Add(-48*time.Hour - time.Second), WaitingSeconds: 48*3600 + 1, Level: config.CommitAgeWarning, Pending: 2},
+		},
+		{
+			deployed: "red",
+			want:     &pendingAge{SHA: "c3", Date: now.Add(-8 * 24 * time.Hour), WaitingSeconds: 8 * 24 * 3600, Level: config.CommitAgeDanger, Pending: 3},
+		},
+	} {
+		got, err := oldestUndeployed(gcl, proj, spec.deployed, "tip", now)
+		if err != nil {
+			t.Errorf("oldestUndeployed(gcl, proj, %q, %q, now) failed with %v", spec.deployed, "tip", err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("oldestUndeployed(gcl, proj, %q, %q, now) = %#v; want %#v", spec.deployed, "tip", got, spec.want)
+		}
+	}
+}
+
+func TestHandlerOldestUndeployedMissingCommit(t *testing.T) {
+	h := handler{gcl: compareClient{missing: map[revision.Revision]bool{"gone": true}}}
+	proj := config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+	env := &environment{
+		Name:         "production",
+		sourceStatus: sourceStatus{SourceCodeRevision: "tip"},
+		Deployments:  []deployStatus{{HostName: "app1", SourceCodeRevision: "gone"}},
+	}
+	oldest, unavailable := h.oldestUndeployed(proj, env, time.Now())
+	if oldest != nil {
+		t.Errorf("h.oldestUndeployed(...) = %#v; want nil", oldest)
+	}
+	if unavailable == "" {
+		t.Errorf("h.oldestUndeployed(...) explains nothing; want why the diff is unavailable")
+	}
+
+	// other failures are not explained as missing commits
+	h.gcl = compareClient{}
+	if oldest, unavailable := h.oldestUndeployed(proj, env, time.Now()); oldest != nil || unavailable != "" {
+		t.Errorf("h.oldestUndeployed(...) = %#v, %q on other failures; want nil, \"\"", oldest, unavailable)
+	}
+}
+
+func TestAnnotateAgesTimezone(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	commits := compareCommits([]github.RepositoryCommit{datedCommit("c1", now.Add(-3*time.Hour)), testCommit("c2", "Undated", "bob")})
+	ages := &config.CommitAgeConfiguration{WarningHours: 2, DangerHours: 4, Timezone: "Asia/Tokyo"}
+
+	oldest := annotateAges(commits, ages, now)
+	if oldest == nil || oldest.SHA != "c1" || oldest.Level != config.CommitAgeWarning || oldest.Pending != 2 {
+		t.Errorf("annotateAges(commits, ages, now) = %#v; want c1 in warning of 2 pending commits", oldest)
+	}
+	if got, want := commits[0].Date.Format(time.RFC3339), "2015-10-10T18:00:00+09:00"; got != want {
+		t.Errorf("commits[0].Date = %s; want %s", got, want)
+	}
+	if commits[0].WaitingSeconds != 3*3600 || commits[0].AgeLevel != config.CommitAgeWarning {
+		t.Errorf("commits[0] = %#v; want waiting for 3 hours in warning", commits[0])
+	}
+	if commits[1].Date != nil || commits[1].WaitingSeconds != 0 || commits[1].AgeLevel != "" {
+		t.Errorf("commits[1] = %#v; want no age without a date", commits[1])
+	}
+}
+
+// tipControl is a revision.Control whose latest revisions are the branches of environments.
+type tipControl struct {
+	revision.Control
+}
+
+func (c tipControl) Latest(ctx context.Context, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	return revision.Revision(env.Branch), revision.Revision(env.Branch), nil
+}
+
+func TestDriftByAge(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"old...stg-tip":  {Commits: []github.RepositoryCommit{datedCommit("stg-tip", now.Add(-3*24*time.Hour))}},
+		"old...prod-tip": {Commits: []github.RepositoryCommit{datedCommit("prod-tip", now.Add(-10*24*time.Hour))}},
+	}}
+	proj := config.Project{
+		Name: "goship",
+		Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"},
+		Environments: []config.Environment{
+			{Name: "staging", Branch: "stg-tip", Hosts: []config.Host{{Name: "stg1"}, {Name: "stg2"}, {Name: "stg3"}}},
+			{Name: "production", Branch: "prod-tip", Hosts: []config.Host{{Name: "prod1"}}},
+			{Name: "qa", Branch: "qa-tip", Hosts: []config.Host{{Name: "qa1"}}},
+			// not cached yet
+			{Name: "sandbox", Branch: "sandbox-tip", Hosts: []config.Host{{Name: "sandbox1"}}},
+			// no hosts yet
+			{Name: "canary", Branch: "canary-tip"},
+		},
+	}
+	tips := revision.NewTipCache(time.Hour)
+	for _, e := range proj.Environments[:3] {
+		tips.Refresh(context.Background(), tipControl{}, proj, e)
+	}
+	deployed := revision.NewDeployedCache()
+	deployed.Put("goship", "staging", "stg1", "old", "old", nil)
+	deployed.Put("goship", "staging", "stg2", "old", "old", nil)
+	// drained
+	deployed.Put("goship", "staging", "stg3", "stg-tip", "stg-tip", nil)
+	deployed.Put("goship", "production", "prod1", "old", "old", nil)
+	deployed.Put("goship", "qa", "qa1", "qa-tip", "qa-tip", nil)
+
+	h := driftAgeHandler{handler: handler{ac: acl.Null, gcl: gcl, tips: tips, deployed: deployed}, now: func() time.Time { return now }}
+	active := func(proj, env string, hosts []config.Host) []config.Host {
+		if env == "staging" {
+			return hosts[:2]
+		}
+		return hosts
+	}
+	got := h.driftByAge([]config.Project{proj}, active)
+	// a commit by alice
+	risk := &pendingRisk{Level: config.RiskLow, Score: 3, Factors: []config.RiskTerm{
+		{Factor: config.RiskFactorCommits, Value: 1, Points: 1},
+		{Factor: config.RiskFactorLines},
+		{Factor: config.RiskFactorAuthors, Value: 1, Points: 2},
+		{Factor: config.RiskFactorMigrations},
+	}}
+	want := []envAge{
+		{
+			Project: "goship", Environment: "production", Deployed: "old", Tip: "prod-tip",
+			Oldest: &pendingAge{SHA: "prod-tip", Date: now.Add(-10 * 24 * time.Hour), WaitingSeconds: 10 * 24 * 3600, Level: config.CommitAgeDanger, Pending: 1},
+			Risk:   risk,
+		},
+		{
+			Project: "goship", Environment: "staging", Deployed: "old", Tip: "stg-tip",
+			Oldest: &pendingAge{SHA: "stg-tip", Date: now.Add(-3 * 24 * time.Hour), WaitingSeconds: 3 * 24 * 3600, Level: config.CommitAgeWarning, Pending: 1},
+			Risk:   risk,
+		},
+		{Project: "goship", Environment: "canary", State: stateUnconfigured},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("h.driftByAge(projs, active) = %#v; want %#v", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+package commits
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/blocklist"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// Statuses of comparisons of environments, which are the same as GitHub's.
+const (
+	compareAhead     = "ahead"
+	compareBehind    = "behind"
+	compareIdentical = "identical"
+	compareDiverged  = "diverged"
+	// compareUnavailable means that GitHub cannot compare the revisions, e.g. since either no longer exists after a history rewrite.
+	compareUnavailable = "unavailable"
+)
+
+// envRevision is the source code revision deployed into an environment.
+type envRevision struct {
+	Environment string            `json:"environment"`
+	Revision    revision.Revision `json:"revision"`
+}
+
+// compareCommit is a commit in a comparison.
+type compareCommit struct {
+	SHA     string `json:"sha"`
+	Message string `json:"message"`
+	Author  string `json:"author"`
+	URL     string `json:"url"`
+	// Date is the committer date of the commit, in the timezone of the project if annotated by annotateAges.
+	Date *time.Time `json:"date,omitempty"`
+	// WaitingSeconds is how long the commit has been waiting to be deployed.
+	WaitingSeconds int64 `json:"waitingSeconds,omitempty"`
+	// AgeLevel is "warning" or "danger" if the commit has waited beyond the thresholds of the project.
+	AgeLevel string `json:"ageLevel,omitempty"`
+	// Blocklisted is the blocklist entry of the commit if it must not be deployed.
+	Blocklisted *blocklist.Entry `json:"blocklisted,omitempty"`
+}
+
+// comparison describes the difference between revisions deployed into two environments.
+type comparison struct {
+	From envRevision `json:"from"`
+	To   envRevision `json:"to"`
+	// Status is "ahead" if From has commits which To does not have, "behind" in reverse, "identical" or
+	// "diverged" if both have commits which the other does not have. It is "unavailable" if they cannot be compared.
+	Status string `json:"status"`
+	// Unavailable explains why the revisions cannot be compared if Status is "unavailable".
+	Unavailable string `json:"unavailable,omitempty"`
+	AheadBy     int    `json:"aheadBy"`
+	BehindBy    int    `json:"behindBy"`
+	// Commits are the commits in From but not in To.
+	Commits []compareCommit `json:"commits"`
+	// BehindCommits are the commits in To but not in From.
+	BehindCommits []compareCommit `json:"behindCommits,omitempty"`
+	URL           string          `json:"url"`
+	// Oldest is the age of the oldest commit in Commits, which is waiting to be deployed into To.
+	Oldest *pendingAge `json:"oldestUndeployed,omitempty"`
+}
+
+type compareHandler struct {
+	handler
+}
+
+// NewCompare returns a new http.Handler which compares the revisions deployed into two environments of a project.
+// Comparisons are fetched with "gcl", which should cache them.
+// i.e. http://127.0.0.1:8000/api/v1/projects/my-project/compare?from=staging&to=production
+func NewCompare(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker) http.Handler {
+	return compareHandler{handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys}}
+}
+
+func (h compareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 6 || components[4] == "" || components[5] != "compare" {
+		http.NotFound(w, r)
+		return
+	}
+	projName := components[4]
+	fromName, toName := r.FormValue("from"), r.FormValue("to")
+	if fromName == "" || toName == "" {
+		http.Error(w, "from and to must be specified", http.StatusBadRequest)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	p, cfg, err := h.loadProject(projName, u)
+	if err == projectUnaccessible {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var envs []config.Environment
+	for _, name := range []string{fromName, toName} {
+		_, env, err := config.ResolveTarget([]config.Project{p}, projName, name)
+		if err != nil {
+			http.Error(w, err.Error(), config.StatusCode(err))
+			return
+		}
+		envs = append(envs, *env)
+	}
+	c, err := h.newControl(p, cfg.DeployUser)
+	if err != nil {
+		glog.Errorf("Failed to build revision control of %s: %v", projName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := context.Background()
+	drains := h.loadDrains()
+	var revs [2]envRevision
+	for i, env := range envs {
+		revs[i].Environment = env.Name
+		if revs[i].Revision, err = deployedSourceRev(ctx, c, p, env, drains); err != nil {
+			glog.Errorf("Failed to get revision deployed into %s-%s: %v", projName, env.Name, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	comp, err := compareRevisions(h.gcl, p, revs[0], revs[1])
+	if err != nil {
+		glog.Errorf("Failed to compare %s and %s of %s: %v", fromName, toName, projName, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	comp.Oldest = annotateAges(comp.Commits, p.CommitAge, time.Now())
+	if list, err := blocklist.Load(h.ecl); err != nil {
+		glog.Errorf("Failed to load blocklist: %v", err)
+	} else {
+		markBlocklisted(comp.Commits, list.For(projName))
+		markBlocklisted(comp.BehindCommits, list.For(projName))
+	}
+	buf, err := json.Marshal(comp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// deployedSourceRev returns the source code revision deployed into most of the hosts in "env".
+// Ties are broken by the order of the hosts. Hosts in "drains" are ignored since they may be left behind on purpose.
+func deployedSourceRev(ctx context.Context, c revision.Control, proj config.Project, env config.Environment, drains drain.Drains) (revision.Revision, error) {
+	env.Hosts = drains.Active(proj.Name, env.Name, env.Hosts)
+	if len(env.Hosts) == 0 {
+		return "", fmt.Errorf("no undrained hosts in %s", env.Name)
+	}
+	var (
+		wg   sync.WaitGroup
+		revs = make([]revision.Revision, len(env.Hosts))
+		errs = make([]error, len(env.Hosts))
+	)
+	for i, host := range env.Hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			_, revs[i], errs[i] = c.LatestDeployed(ctx, host, proj, env)
+		}(i, host.Name)
+	}
+	wg.Wait()
+
+	for i := range revs {
+		if errs[i] != nil {
+			revs[i] = ""
+		}
+	}
+	best := mostCommon(revs)
+	if best == "" {
+		return "", fmt.Errorf("no hosts in %s are reachable: %v", env.Name, errs[0])
+	}
+	return best, nil
+}
+
+// compareRevisions compares the revisions in "from" and "to" in the source repository of "p" with GitHub.
+// If GitHub cannot compare them since either no longer exists, the comparison is "unavailable" but not a failure.
+func compareRevisions(gcl githublib.Client, p config.Project, from, to envRevision) (comparison, error) {
+	repo := p.SourceRepo()
+	comp := comparison{From: from, To: to, Commits: []compareCommit{}}
+	if from.Revision == to.Revision {
+		comp.Status = compareIdentical
+		return comp, nil
+	}
+	// GitHub compares "head" with "base", so "ahead" means From is ahead of To.
+	res, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(to.Revision), string(from.Revision))
+	if githublib.IsMissingCommit(err) {
+		comp.Status, comp.Unavailable = compareUnavailable, missingCommitReason(to.Revision, from.Revision)
+		return comp, nil
+	}
+	if err != nil {
+		return comparison{}, err
+	}
+	if res.Status != nil {
+		comp.Status = *res.Status
+	}
+	switch comp.Status {
+	case compareAhead, compareBehind, compareIdentical, compareDiverged:
+	default:
+		return comparison{}, fmt.Errorf("unknown status %q of comparison %s...%s", comp.Status, to.Revision, from.Revision)
+	}
+	if res.AheadBy != nil {
+		comp.AheadBy = *res.AheadBy
+	}
+	if res.BehindBy != nil {
+		comp.BehindBy = *res.BehindBy
+	}
+	// the comparison of go-github has no HTML URL, and the project may link diffs elsewhere anyway.
+	comp.URL = p.CompareURL(string(to.Revision), string(from.Revision))
+	comp.Commits = compareCommits(res.Commits)
+
+	if comp.BehindBy > 0 {
+		rev, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(from.Revision), string(to.Revision))
+		switch {
+		case githublib.IsMissingCommit(err):
+			// the counts are known anyway
+		case err != nil:
+			return comparison{}, err
+		default:
+			comp.BehindCommits = compareCommits(rev.Commits)
+		}
+	}
+	return comp, nil
+}
+
+// missingCommitReason explains that GitHub cannot compare "base" and "head".
+func missingCommitReason(base, head revision.Revision) string {
+	return fmt.Sprintf("GitHub cannot compare %s with %s; either may have been removed by a history rewrite", base.Short(), head.Short())
+}
+
+// markBlocklisted sets the entries in "list" to the commits in "commits" which they match.
+func markBlocklisted(commits []compareCommit, list blocklist.List) {
+	for i := range commits {
+		if e, ok := list.Find(commits[i].SHA); ok {
+			commits[i].Blocklisted = &e
+		}
+	}
+}
+
+func compareCommits(commits []github.RepositoryCommit) []compareCommit {
+	list := make([]compareCommit, 0, len(commits))
+	for _, c := range commits {
+		var cc compareCommit
+		if c.SHA != nil {
+			cc.SHA = *c.SHA
+		}
+		if c.HTMLURL != nil {
+			cc.URL = *c.HTMLURL
+		}
+		if c.Commit != nil {
+			if c.Commit.Message != nil {
+				cc.Message = strings.SplitN(*c.Commit.Message, "\n", 2)[0]
+			}
+			if c.Commit.Author != nil && c.Commit.Author.Name != nil {
+				cc.Author = *c.Commit.Author.Name
+			}
+			if c.Commit.Committer != nil && c.Commit.Committer.Date != nil {
+				date := *c.Commit.Committer.Date
+				cc.Date = &date
+			}
+		}
+		list = append(list, cc)
+	}
+	return list
+}
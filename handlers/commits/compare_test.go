@@ -0,0 +1,249 @@
+package commits
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/blocklist"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// compareClient is a githublib.Client which serves comparisons keyed by "base...head".
+// Comparisons with revisions in "missing" fail like GitHub does for garbage-collected commits.
+type compareClient struct {
+	githublib.Client
+	comps   map[string]*github.CommitsComparison
+	missing map[revision.Revision]bool
+}
+
+func (c compareClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	if c.missing[revision.Revision(base)] || c.missing[revision.Revision(head)] {
+		resp := &http.Response{StatusCode: 422}
+		return nil, &github.Response{Response: resp}, &github.ErrorResponse{Response: resp, Message: "No common ancestor between " + base + " and " + head + "."}
+	}
+	comp, ok := c.comps[base+"..."+head]
+	if !ok {
+		return nil, nil, errors.New("not found")
+	}
+	return comp, nil, nil
+}
+
+func testCommit(sha, msg, author string) github.RepositoryCommit {
+	return github.RepositoryCommit{
+		SHA:     github.String(sha),
+		HTMLURL: github.String("https://github.com/gengo/goship/commit/" + sha),
+		Commit: &github.Commit{
+			Message: github.String(msg),
+			Author:  &github.CommitAuthor{Name: github.String(author)},
+		},
+	}
+}
+
+func TestCompareRevisions(t *testing.T) {
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"prod...stg": {
+			Status:   github.String("ahead"),
+			AheadBy:  github.Int(2),
+			BehindBy: github.Int(0),
+			Commits:  []github.RepositoryCommit{testCommit("c1", "Add a feature\n\nDetails", "alice"), testCommit("stg", "Fix it", "bob")},
+		},
+		"stg...prod": {
+			Status:   github.String("behind"),
+			AheadBy:  github.Int(0),
+			BehindBy: github.Int(2),
+		},
+		"prod...hotfix": {
+			Status:   github.String("diverged"),
+			AheadBy:  github.Int(1),
+			BehindBy: github.Int(1),
+			Commits:  []github.RepositoryCommit{testCommit("hotfix", "Hotfix", "carol")},
+		},
+		"hotfix...prod": {
+			Status:   github.String("diverged"),
+			AheadBy:  github.Int(1),
+			BehindBy: github.Int(1),
+			Commits:  []github.RepositoryCommit{testCommit("prod", "Release", "dave")},
+		},
+	}}
+	proj := config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+	staging := envRevision{Environment: "staging", Revision: "stg"}
+	production := envRevision{Environment: "production", Revision: "prod"}
+	hotfix := envRevision{Environment: "hotfix", Revision: "hotfix"}
+
+	for _, spec := range []struct {
+		from, to envRevision
+		want     comparison
+	}{
+		{
+			from: staging,
+			to:   production,
+			want: comparison{
+				From: staging, To: production, Status: "ahead", AheadBy: 2,
+				Commits: []compareCommit{
+					{SHA: "c1", Message: "Add a feature", Author: "alice", URL: "https://github.com/gengo/goship/commit/c1"},
+					{SHA: "stg", Message: "Fix it", Author: "bob", URL: "https://github.com/gengo/goship/commit/stg"},
+				},
+				URL: "https://github.com/gengo/goship/compare/prod...stg",
+			},
+		},
+		{
+			from: production,
+			to:   staging,
+			want: comparison{
+				From: production, To: staging, Status: "behind", BehindBy: 2,
+				Commits: []compareCommit{},
+				BehindCommits: []compareCommit{
+					{SHA: "c1", Message: "Add a feature", Author: "alice", URL: "https://github.com/gengo/goship/commit/c1"},
+					{SHA: "stg", Message: "Fix it", Author: "bob", URL: "https://github.com/gengo/goship/commit/stg"},
+				},
+				URL: "https://github.com/gengo/goship/compare/stg...prod",
+			},
+		},
+		{
+			from: staging,
+			to:   envRevision{Environment: "canary", Revision: "stg"},
+			want: comparison{From: staging, To: envRevision{Environment: "canary", Revision: "stg"}, Status: "identical", Commits: []compareCommit{}},
+		},
+		{
+			from: hotfix,
+			to:   production,
+			want: comparison{
+				From: hotfix, To: production, Status: "diverged", AheadBy: 1, BehindBy: 1,
+				Commits:       []compareCommit{{SHA: "hotfix", Message: "Hotfix", Author: "carol", URL: "https://github.com/gengo/goship/commit/hotfix"}},
+				BehindCommits: []compareCommit{{SHA: "prod", Message: "Release", Author: "dave", URL: "https://github.com/gengo/goship/commit/prod"}},
+				URL:           "https://github.com/gengo/goship/compare/prod...hotfix",
+			},
+		},
+	} {
+		got, err := compareRevisions(gcl, proj, spec.from, spec.to)
+		if err != nil {
+			t.Errorf("compareRevisions(gcl, proj, %#v, %#v) failed with %v", spec.from, spec.to, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("compareRevisions(gcl, proj, %#v, %#v) = %#v; want %#v", spec.from, spec.to, got, spec.want)
+		}
+	}
+
+	proj.DiffURLTemplate = "https://review.example/{{.Repo}}/diff/{{.From}}..{{.To}}"
+	if got, err := compareRevisions(gcl, proj, staging, production); err != nil || got.URL != "https://review.example/goship/diff/prod..stg" {
+		t.Errorf("compareRevisions(gcl, proj, %#v, %#v).URL = %q, %v; want the URL by diff_url_template", staging, production, got.URL, err)
+	}
+
+	unknown := envRevision{Environment: "qa", Revision: "unknown"}
+	if got, err := compareRevisions(gcl, proj, unknown, production); err == nil {
+		t.Errorf("compareRevisions(gcl, proj, %#v, %#v) = %#v; want failure", unknown, production, got)
+	}
+}
+
+func TestCompareRevisionsUnavailable(t *testing.T) {
+	gcl := compareClient{missing: map[revision.Revision]bool{"0123456789abcdef": true}}
+	proj := config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+	staging := envRevision{Environment: "staging", Revision: "stg"}
+	gone := envRevision{Environment: "production", Revision: "0123456789abcdef"}
+
+	got, err := compareRevisions(gcl, proj, staging, gone)
+	if err != nil {
+		t.Fatalf("compareRevisions(gcl, proj, %#v, %#v) failed with %v; want an unavailable comparison", staging, gone, err)
+	}
+	if got.Status != compareUnavailable || got.Unavailable == "" {
+		t.Errorf("compareRevisions(gcl, proj, %#v, %#v) = %#v; want unavailable with the reason", staging, gone, got)
+	}
+	if got.Commits == nil || len(got.Commits) != 0 {
+		t.Errorf("got.Commits = %#v; want empty", got.Commits)
+	}
+}
+
+// deployedControl is a revision.Control which serves deployed source revisions per host.
+type deployedControl struct {
+	revision.Control
+	revs map[string]revision.Revision
+}
+
+func (c deployedControl) LatestDeployed(ctx context.Context, host string, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	r, ok := c.revs[host]
+	if !ok {
+		return "", "", errors.New("unreachable")
+	}
+	return "image-" + r, r, nil
+}
+
+func TestMarkBlocklisted(t *testing.T) {
+	list := blocklist.List{
+		{SHA: "bad0001", Project: "api", Reason: "corrupts sessions"},
+		{SHA: "bad0002", Project: "web", Reason: "breaks web only"},
+		{SHA: "bad0003fedcba", Reason: "leaks tokens"},
+	}
+	commits := []compareCommit{{SHA: "bad0001abcdef"}, {SHA: "bad0002abcdef"}, {SHA: "bad0003fedcba9876"}, {SHA: "0123456789"}}
+	markBlocklisted(commits, list.For("api"))
+	var got []string
+	for _, c := range commits {
+		var reason string
+		if c.Blocklisted != nil {
+			reason = c.Blocklisted.Reason
+		}
+		got = append(got, reason)
+	}
+	if want := []string{"corrupts sessions", "", "leaks tokens", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reasons of blocklisted commits = %q; want %q", got, want)
+	}
+}
+
+func TestDeployedSourceRev(t *testing.T) {
+	c := deployedControl{revs: map[string]revision.Revision{"web1": "old", "web2": "new", "web3": "new", "db1": "old"}}
+	for _, spec := range []struct {
+		hosts []string
+		want  revision.Revision
+	}{
+		{hosts: []string{"web1", "web2", "web3"}, want: "new"},
+		// ties are broken by the order
+		{hosts: []string{"db1", "web2"}, want: "old"},
+		{hosts: []string{"unreachable", "web2"}, want: "new"},
+	} {
+		env := config.Environment{Name: "production"}
+		for _, h := range spec.hosts {
+			env.Hosts = append(env.Hosts, config.Host{Name: h})
+		}
+		got, err := deployedSourceRev(context.Background(), c, config.Project{}, env, nil)
+		if err != nil {
+			t.Errorf("deployedSourceRev(ctx, c, proj, %q) failed with %v", spec.hosts, err)
+			continue
+		}
+		if got != spec.want {
+			t.Errorf("deployedSourceRev(ctx, c, proj, %q) = %q; want %q", spec.hosts, got, spec.want)
+		}
+	}
+
+	env := config.Environment{Name: "production", Hosts: []config.Host{{Name: "unreachable"}}}
+	if got, err := deployedSourceRev(context.Background(), c, config.Project{}, env, nil); err == nil {
+		t.Errorf("deployedSourceRev(ctx, c, proj, env) = %q; want failure", got)
+	}
+}
+
+func TestDeployedSourceRevIgnoresDrained(t *testing.T) {
+	c := deployedControl{revs: map[string]revision.Revision{"web1": "new", "web2": "old", "web3": "old"}}
+	proj := config.Project{Name: "api"}
+	env := config.Environment{Name: "production", Hosts: []config.Host{{Name: "web1"}, {Name: "web2"}, {Name: "web3"}}}
+	since := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	drains := drain.Drains{
+		"api/production/web2": {By: "alice", Since: since},
+		"api/production/web3": {By: "alice", Since: since},
+		"api/staging/web1":    {By: "bob", Since: since},
+	}
+	if got, err := deployedSourceRev(context.Background(), c, proj, env, drains); err != nil || got != "new" {
+		t.Errorf("deployedSourceRev(ctx, c, proj, env, drains) = %q, %v; want %q", got, err, "new")
+	}
+
+	drains["api/production/web1"] = drain.Drain{By: "alice", Since: since}
+	if got, err := deployedSourceRev(context.Background(), c, proj, env, drains); err == nil {
+		t.Errorf("deployedSourceRev(ctx, c, proj, env, drains) = %q with all hosts drained; want failure", got)
+	}
+}
@@ -7,15 +7,24 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/annotation"
 	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
 	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/inventory"
+	"github.com/gengo/goship/lib/revision"
 	gcrrev "github.com/gengo/goship/lib/revision/gcr"
 	githubrev "github.com/gengo/goship/lib/revision/github"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/schedule"
 	"github.com/gengo/goship/lib/ssh"
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
@@ -31,11 +40,34 @@ type handler struct {
 	gcl        githublib.Client
 	dcl        *docker.Client
 	sshKeyPath string
+	// hostKeys verifies keys of hosts if not nil.
+	hostKeys ssh.HostKeyChecker
+	// pool keeps connections to hosts across requests if not nil.
+	pool *ssh.Pool
+	tips *revision.TipCache
+	// deployed records revisions observed in hosts if not nil.
+	deployed *revision.DeployedCache
+	// running lists deployments in progress and just finished if not nil.
+	running func() []running.Deploy
+	// settle is how long hosts are still "deploying" after deployments finish.
+	settle time.Duration
+	// repoRevisions returns the revisions of the repositories of a multi-repo project deployed last into an environment if not nil.
+	repoRevisions func(proj, env string) config.Revisions
+	// lastDeploy returns when an environment was deployed into successfully last, or false if unknown, if not nil.
+	lastDeploy func(proj, env string) (time.Time, bool)
+	// records returns the deployments of an environment in the deploy log if not nil.
+	records func(proj, env string) []DeployRecord
 }
 
 // New returns a new http.Handler which serves latest revisions in deploy targets and the revision control system.
-func New(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string) http.Handler {
-	return handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath}
+// Latest deployable revisions are served from "tips", and revisions observed in hosts are recorded into "deployed".
+// Hosts are "deploying" while their environments have deployments in "running", and for "settle" after they finish.
+// Connections to hosts are reused across requests if "pool" is not nil.
+// Repositories of multi-repo projects other than the first one are compared with their revisions returned by "repoRevisions".
+// The risk of deploying pending commits counts the days since the deployments returned by "lastDeploy".
+// Environments whose hosts are on different revisions are reconciled with their deployments returned by "records".
+func New(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, pool *ssh.Pool, tips *revision.TipCache, deployed *revision.DeployedCache, running func() []running.Deploy, settle time.Duration, repoRevisions func(proj, env string) config.Revisions, lastDeploy func(proj, env string) (time.Time, bool), records func(proj, env string) []DeployRecord) http.Handler {
+	return handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys, pool: pool, tips: tips, deployed: deployed, running: running, settle: settle, repoRevisions: repoRevisions, lastDeploy: lastDeploy, records: records}
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -56,7 +88,19 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	envs, err := h.fetchStatuses(ctx, projName, u)
+	sel, err := config.ParseTagSelector(r.URL.Query()["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := parseHostOrder(r.FormValue("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	envs, err := h.fetchStatuses(ctx, projName, u, sel, order)
 	if err == projectUnaccessible {
 		glog.Errorf("project %s is not accessible for %s", projName, u.Name)
 		http.Error(w, err.Error(), http.StatusForbidden)
@@ -81,64 +125,132 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h handler) fetchStatuses(ctx context.Context, projName string, u auth.User) ([]environment, error) {
-	p, deployUser, err := h.loadProject(projName, u)
+func (h handler) fetchStatuses(ctx context.Context, projName string, u auth.User, sel config.TagSelector, order hostOrder) ([]environment, error) {
+	p, c, err := h.loadProject(projName, u)
 	if err != nil {
 		return nil, err
 	}
-	envs, err := h.retrieveCommits(ctx, p, deployUser)
+	ac := acl.ForUser(h.ac, c, u)
+	envs, err := h.retrieveCommits(ctx, p, c.DeployUser, sel)
 	if err != nil {
 		glog.Errorf("Failed to retrieve commits: %v", err)
 		return nil, err
 	}
 
+	now := time.Now()
+	settling := make(map[envKey]bool)
+	if h.running != nil {
+		settling = settlingEnvironments(h.running(), h.settle, now)
+	}
 	for i := range envs {
 		env := &envs[i]
-		locked, comments := func() (bool, []string) {
-			var comments []string
-			if c := env.Comment; c != "" {
-				comments = append(comments, c)
-			}
-			if env.Locked {
-				return true, append(comments, "repo is locked.")
-			}
-			repo := p.SourceRepo()
-			if !h.ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
-				return true, append(comments, "you do not have permission to deploy")
-			}
-			return false, comments
-		}()
-		env.Locked = locked
-		env.Comment = strings.Join(comments, " | ")
+		env.Locked, env.Comment = lockStatus(ac, p, env.Comment, env.Locked, u)
+		env.Deploying = settling[envKey{project: p.Name, environment: env.Name}]
+		env.OldestUndeployed, env.DiffUnavailable = h.oldestUndeployed(p, env, now)
+		if env.OldestUndeployed != nil {
+			env.Risk = h.risk(p, env.Name, deployedRevision(env), env.SourceCodeRevision, now)
+		}
+		h.annotateRepos(p, env, now)
+		sortHosts(env, p.Environments[i].Hosts, order)
+		env.State = environmentHealth(p.Environments[i], observedStates(env.Deployments))
+		// hosts disagree only for a moment while deploying.
+		if h.records != nil && !env.Deploying && disagree(env.Deployments) {
+			env.Reconciliation = reconcile(env.Deployments, h.records(p.Name, env.Name))
+		}
 	}
 
 	return envs, nil
 }
 
-func (h handler) loadProject(projName string, u auth.User) (p config.Project, deployUser string, err error) {
-	c, err := config.Load(h.ecl)
+// oldestUndeployed returns the age of the oldest commit in the tip of "env" of "p" but not deployed into most of
+// its undrained hosts at "now". Failures are logged and regarded as unknown.
+// If GitHub cannot compare them, e.g. since the deployed revision is gone after a history rewrite, it also returns why.
+func (h handler) oldestUndeployed(p config.Project, env *environment, now time.Time) (*pendingAge, string) {
+	deployed := deployedRevision(env)
+	oldest, err := oldestUndeployed(h.gcl, p, deployed, env.SourceCodeRevision, now)
+	if githublib.IsMissingCommit(err) {
+		glog.Warningf("Cannot compare %s and %s of %s-%s: %v", deployed, env.SourceCodeRevision, p.Name, env.Name, err)
+		return nil, missingCommitReason(deployed, env.SourceCodeRevision)
+	}
+	if err != nil {
+		glog.Errorf("Failed to compare %s and %s of %s-%s: %v", deployed, env.SourceCodeRevision, p.Name, env.Name, err)
+		return nil, ""
+	}
+	return oldest, ""
+}
+
+// deployedRevision returns the source code revision deployed into most of the undrained hosts in "env".
+func deployedRevision(env *environment) revision.Revision {
+	var revs []revision.Revision
+	for _, d := range env.Deployments {
+		if d.Drained == nil {
+			revs = append(revs, d.SourceCodeRevision)
+		}
+	}
+	return mostCommon(revs)
+}
+
+// lockStatus returns true if "u" cannot deploy into an environment of "p" with "comment", which is locked if "locked".
+// It also returns the comment with the reasons appended.
+func lockStatus(ac acl.AccessControl, p config.Project, comment string, locked bool, u auth.User) (bool, string) {
+	var comments []string
+	if comment != "" {
+		comments = append(comments, comment)
+	}
+	if locked {
+		return true, strings.Join(append(comments, "repo is locked."), " | ")
+	}
+	repo := p.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		return true, strings.Join(append(comments, "you do not have permission to deploy"), " | ")
+	}
+	return false, strings.Join(comments, " | ")
+}
+
+// environmentComment returns the comment of "e" followed by the reason of its lock after a failed deployment, if any.
+func environmentComment(e config.Environment) string {
+	switch {
+	case e.AutoLock == nil:
+		return e.Comment
+	case e.Comment == "":
+		return e.AutoLock.Reason
+	}
+	return e.Comment + " | " + e.AutoLock.Reason
+}
+
+func (h handler) loadProject(projName string, u auth.User) (p config.Project, c config.Config, err error) {
+	c, err = config.Load(h.ecl)
 	if err != nil {
 		glog.Errorf("Parsing etc: %v", err)
-		return config.Project{}, "", err
+		return config.Project{}, config.Config{}, err
 	}
-	p, err = config.ProjectFromName(c.Projects, projName)
+	ac := acl.ForUser(h.ac, c, u)
+	found, err := acl.FindProject(ac, c.Projects, u, projName)
 	if err != nil {
 		glog.Errorf("Failed to get project from name: %v", err)
-		return config.Project{}, "", err
+		return config.Project{}, config.Config{}, err
 	}
-	repo := p.SourceRepo()
-	if !h.ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
-		return config.Project{}, "", projectUnaccessible
+	repo := found.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		return config.Project{}, config.Config{}, projectUnaccessible
 	}
-	return p, c.DeployUser, nil
+	return *found, c, nil
 
 }
 
-func (h handler) retrieveCommits(ctx context.Context, proj config.Project, deployUser string) ([]environment, error) {
+// newControl returns a revision.Control for "proj".
+func (h handler) newControl(proj config.Project, deployUser string) (revision.Control, error) {
 	s, err := ssh.WithPrivateKeyFile(deployUser, h.sshKeyPath)
 	if err != nil {
 		return nil, err
 	}
+	if h.hostKeys != nil {
+		s = s.WithHostKeys(h.hostKeys)
+	}
+	if h.pool != nil {
+		s = s.WithPool(h.pool)
+	}
+	s = config.WithSSHAuth(s, proj.Environments...)
 
 	c := githubrev.New(h.gcl, s)
 	switch t := proj.RepoType; t {
@@ -148,22 +260,113 @@ func (h handler) retrieveCommits(ctx context.Context, proj config.Project, deplo
 	default:
 		return nil, fmt.Errorf("unknown repository type %q", t)
 	}
+	return c, nil
+}
+
+// loadHostKeys returns the known SSH host keys, or none if host keys are not verified.
+// Failures are logged and regarded as no keys like loadDrains.
+func (h handler) loadHostKeys() hostkeys.HostKeys {
+	if h.hostKeys == nil {
+		return hostkeys.HostKeys{}
+	}
+	keys, err := hostkeys.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load host keys: %v", err)
+		return hostkeys.HostKeys{}
+	}
+	return keys
+}
+
+// hostKeyState returns the state of the host key of "host" in "keys" unless it is trusted.
+func hostKeyState(keys hostkeys.HostKeys, host string) string {
+	if st := keys.State(host); st != hostkeys.StateTrusted {
+		return st
+	}
+	return ""
+}
+
+// loadDrains returns the drained hosts. Failures are logged and regarded as no drains
+// since they should not hide the state of other hosts.
+func (h handler) loadDrains() drain.Drains {
+	ds, err := drain.Load(h.ecl, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to load drained hosts: %v", err)
+		return drain.Drains{}
+	}
+	return ds
+}
+
+// loadHostLocks returns the locked hosts. Failures are logged and regarded as no locks like loadDrains.
+func (h handler) loadHostLocks() hostlock.Locks {
+	ls, err := hostlock.Load(h.ecl, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to load host locks: %v", err)
+		return hostlock.Locks{}
+	}
+	return ls
+}
+
+// loadAnnotations returns the active annotations of environments. Failures are logged and regarded as no annotations like loadDrains.
+func (h handler) loadAnnotations() annotation.Annotations {
+	as, err := annotation.Load(h.ecl, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to load annotations: %v", err)
+		return annotation.Annotations{}
+	}
+	return as
+}
+
+// loadInventory returns the host inventories of environments. Failures are logged and regarded as no changes like loadDrains.
+func (h handler) loadInventory() inventory.Inventories {
+	inv, err := inventory.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load host inventory: %v", err)
+		return inventory.Inventories{}
+	}
+	return inv
+}
+
+func (h handler) retrieveCommits(ctx context.Context, proj config.Project, deployUser string, sel config.TagSelector) ([]environment, error) {
+	c, err := h.newControl(proj, deployUser)
+	if err != nil {
+		return nil, err
+	}
+	drains := h.loadDrains()
+	locks := h.loadHostLocks()
+	keys := h.loadHostKeys()
+	sched := schedule.NewEtcdStore(h.ecl)
+	now := time.Now()
 
 	var wg sync.WaitGroup
 	envs := make([]environment, len(proj.Environments))
 	for i, e := range proj.Environments {
+		hosts := sel.SelectHosts(e.Hosts)
 		envs[i] = environment{
 			Name:        e.Name,
-			Locked:      e.IsLocked,
-			Deployments: make([]deployStatus, len(e.Hosts)),
+			Comment:     environmentComment(e),
+			Locked:      e.IsLocked(),
+			State:       environmentState(e),
+			Deployments: make([]deployStatus, len(hosts)),
+			Schedules:   upcomingSchedules(sched, proj.Name, e, now),
 		}
 		env := &envs[i]
 
-		for j, host := range e.Hosts {
+		for j, host := range hosts {
+			env.Deployments[j].HostName = host.Name
+			if d, ok := drains.Get(proj.Name, e.Name, host.Name); ok {
+				env.Deployments[j].Drained = &d
+			}
+			if l, ok := locks.Get(proj.Name, e.Name, host.Name); ok {
+				env.Deployments[j].HostLock = &l
+			}
+			env.Deployments[j].HostKey = hostKeyState(keys, host.Name)
 			wg.Add(1)
 			go func(st *deployStatus, host string, e config.Environment) {
 				defer wg.Done()
 				rev, srcRev, err := c.LatestDeployed(ctx, host, proj, e)
+				if h.deployed != nil {
+					h.deployed.Put(proj.Name, e.Name, host, rev, srcRev, err)
+				}
 				if err != nil {
 					st.Revision = ""
 					return
@@ -172,29 +375,30 @@ func (h handler) retrieveCommits(ctx context.Context, proj config.Project, deplo
 				st.ShortRevision = rev.Short()
 				st.RevisionURL = c.RevisionURL(proj, rev)
 				st.SourceCodeRevision = srcRev
-			}(&env.Deployments[j], host, e)
+			}(&env.Deployments[j], host.Name, e)
+		}
+		// environments without hosts are not compared with the tip, so it is not worth fetching.
+		if e.Unconfigured() {
+			continue
 		}
 		wg.Add(1)
 		go func(env *environment, e config.Environment) {
 			defer wg.Done()
-			rev, srcRev, err := c.Latest(ctx, proj, e)
-			if err != nil {
-				env.Revision = ""
-				return
-			}
-			env.Revision = rev
-			env.SourceCodeRevision = srcRev
-			env.ShortRevision = rev.Short()
+			env.sourceStatus = newSourceStatus(h.tips.Get(ctx, c, proj, e))
 		}(env, e)
 	}
 	wg.Wait()
 
 	for i := range envs {
 		env := &envs[i]
+		if env.State == stateUnconfigured {
+			continue
+		}
 		for j := range env.Deployments {
 			d := &env.Deployments[j]
 			d.SourceCodeDiffURL = c.SourceDiffURL(proj, d.SourceCodeRevision, env.SourceCodeRevision)
 		}
+		env.Repos = h.repoStatuses(ctx, c, proj, proj.Environments[i], env.sourceStatus, deployedRevision(env))
 	}
 	return envs, nil
 }
@@ -0,0 +1,196 @@
+package commits
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/golang/glog"
+)
+
+// envMetrics are the gauges of an environment.
+type envMetrics struct {
+	project, environment string
+	// total is the number of hosts in the config, including drained ones.
+	total int
+	// behind and unknown are the numbers of undrained hosts in the states of hostState.
+	behind, unknown int
+	// oldestAge is how long the oldest commit not deployed into some undrained host has waited.
+	// It is negative if unknown, i.e. the tip is not cached or a comparison of a behind host is not cached.
+	oldestAge time.Duration
+	// health is the state of the environment as a whole by environmentHealth.
+	health string
+}
+
+// healthLevels are the values of the health gauge. The other states have no value.
+var healthLevels = map[string]float64{config.HealthRed: 0, config.HealthYellow: 1, config.HealthGreen: 2}
+
+// gauge is a metric of environments in the Prometheus text format.
+type gauge struct {
+	name, help string
+	value      func(m envMetrics) (float64, bool)
+}
+
+var envGauges = []gauge{
+	{
+		name:  "goship_environment_hosts_total",
+		help:  "Number of hosts of the environment including drained ones.",
+		value: func(m envMetrics) (float64, bool) { return float64(m.total), true },
+	},
+	{
+		name:  "goship_environment_hosts_behind",
+		help:  "Number of undrained hosts which are not on the latest deployable revision.",
+		value: func(m envMetrics) (float64, bool) { return float64(m.behind), true },
+	},
+	{
+		name:  "goship_environment_hosts_unknown",
+		help:  "Number of undrained hosts whose deployed or latest deployable revision is not cached.",
+		value: func(m envMetrics) (float64, bool) { return float64(m.unknown), true },
+	},
+	{
+		name: "goship_environment_oldest_undeployed_commit_age_seconds",
+		help: "How long the oldest commit not deployed into an undrained host has waited. Absent while unknown.",
+		value: func(m envMetrics) (float64, bool) {
+			return m.oldestAge.Seconds(), m.oldestAge >= 0
+		},
+	},
+	{
+		name: "goship_environment_health",
+		help: "Health of the environment by its status thresholds: 2 for green, 1 for yellow and 0 for red. Absent while unknown.",
+		value: func(m envMetrics) (float64, bool) {
+			v, ok := healthLevels[m.health]
+			return v, ok
+		},
+	},
+}
+
+type metricsHandler struct {
+	handler
+	now func() time.Time
+	// extra write more metrics after the ones of environments.
+	extra []func(w io.Writer) error
+}
+
+// NewMetrics returns a new http.Handler which exports gauges of the drift of all the environments in the Prometheus text format.
+// Ephemeral environments are left out. Revisions are served only from "tips" and "deployed" like NewStatus,
+// and commits are compared only if "gcl" has cached the comparisons, so that scrapes make no requests to GitHub or hosts.
+// Metrics of other components, e.g. caches, are appended by "extra".
+// i.e. http://127.0.0.1:8000/metrics
+func NewMetrics(ecl *etcd.Client, gcl githublib.Client, tips *revision.TipCache, deployed *revision.DeployedCache, extra ...func(w io.Writer) error) http.Handler {
+	return metricsHandler{handler: handler{ecl: ecl, gcl: gcl, tips: tips, deployed: deployed}, now: time.Now, extra: extra}
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write(formatMetrics(h.metrics(withoutEphemeral(c.Projects), h.loadDrains()))); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+		return
+	}
+	for _, write := range h.extra {
+		if err := write(w); err != nil {
+			glog.Errorf("Failed to send response: %v", err)
+			return
+		}
+	}
+}
+
+// metrics returns the gauges of the environments of "projs" from the caches.
+func (h metricsHandler) metrics(projs []config.Project, drains drain.Drains) []envMetrics {
+	var ms []envMetrics
+	now := h.now()
+	for _, p := range projs {
+		for _, e := range p.Environments {
+			m := envMetrics{project: p.Name, environment: e.Name, total: len(e.Hosts)}
+			tip, _ := h.tips.Peek(p, e)
+			var (
+				behind   []revision.Revision
+				observed []string
+			)
+			for _, host := range e.Hosts {
+				d := deployStatus{}
+				if dr, ok := drains.Get(p.Name, e.Name, host.Name); ok {
+					d.Drained = &dr
+				}
+				dep, _ := h.deployed.Get(p.Name, e.Name, host.Name)
+				d.Revision = dep.Rev
+				state := hostState(d, tip.Rev)
+				observed = append(observed, state)
+				switch state {
+				case stateBehind:
+					m.behind++
+					behind = append(behind, dep.SrcRev)
+				case stateUnknown:
+					m.unknown++
+				}
+			}
+			m.oldestAge = h.cachedOldestAge(p, behind, tip.SrcRev, now)
+			m.health = environmentHealth(e, observed)
+			ms = append(ms, m)
+		}
+	}
+	return ms
+}
+
+// cachedOldestAge returns how long the oldest commit in "tip" but not in one of "deployed" of "proj" has waited at "now".
+// It returns zero if "deployed" is empty, and -1 if "tip" is unknown or any of the comparisons is not cached.
+func (h metricsHandler) cachedOldestAge(proj config.Project, deployed []revision.Revision, tip revision.Revision, now time.Time) time.Duration {
+	if tip == "" {
+		return -1
+	}
+	repo := proj.SourceRepo()
+	var oldest time.Duration
+	for _, rev := range deployed {
+		if rev == "" {
+			return -1
+		}
+		if rev == tip {
+			continue
+		}
+		res, ok := githublib.CachedComparison(h.gcl, repo.RepoOwner, repo.RepoName, string(rev), string(tip))
+		if !ok {
+			return -1
+		}
+		age := annotateAges(compareCommits(res.Commits), proj.CommitAge, now)
+		if age != nil && time.Duration(age.WaitingSeconds)*time.Second > oldest {
+			oldest = time.Duration(age.WaitingSeconds) * time.Second
+		}
+	}
+	return oldest
+}
+
+// formatMetrics renders "ms" in the Prometheus text format, grouped by the gauges.
+func formatMetrics(ms []envMetrics) []byte {
+	var buf bytes.Buffer
+	for _, g := range envGauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, m := range ms {
+			if v, ok := g.value(m); ok {
+				fmt.Fprintf(&buf, "%s{project=\"%s\",environment=\"%s\"} %s\n", g.name, labelEscaper.Replace(m.project), labelEscaper.Replace(m.environment), strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,123 @@
+package commits
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// countingCompareClient is a compareClient which counts comparisons.
+type countingCompareClient struct {
+	compareClient
+	calls *int
+}
+
+func (c countingCompareClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	*c.calls++
+	return c.compareClient.CompareCommits(owner, repo, base, head)
+}
+
+func TestMetrics(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	var calls int
+	gcl := githublib.WithCompareCache(countingCompareClient{
+		compareClient: compareClient{comps: map[string]*github.CommitsComparison{
+			"old...prod-tip":   {Commits: []github.RepositoryCommit{datedCommit("c1", now.Add(-2*time.Hour)), datedCommit("prod-tip", now.Add(-time.Hour))}},
+			"older...prod-tip": {Commits: []github.RepositoryCommit{datedCommit("c0", now.Add(-5*time.Hour)), datedCommit("prod-tip", now.Add(-time.Hour))}},
+			"stale...qa-tip":   {Commits: []github.RepositoryCommit{datedCommit("qa-tip", now.Add(-time.Hour))}},
+		}},
+		calls: &calls,
+	}, 10)
+	// "older...prod-tip" is compared only for the drained host, and "stale...qa-tip" is not cached.
+	for _, base := range []string{"old", "older"} {
+		if _, _, err := gcl.CompareCommits("gengo", "goship", base, "prod-tip"); err != nil {
+			t.Fatalf("gcl.CompareCommits(%q, %q) failed with %v", base, "prod-tip", err)
+		}
+	}
+	proj := config.Project{
+		Name: "goship",
+		Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"},
+		Environments: []config.Environment{
+			{Name: "production", Branch: "prod-tip", Hosts: []config.Host{{Name: "prod1"}, {Name: "prod2"}, {Name: "prod3"}}},
+			{Name: "staging", Branch: "stg-tip", Hosts: []config.Host{{Name: "stg1"}, {Name: "stg2"}}},
+			{Name: "qa", Branch: "qa-tip", Hosts: []config.Host{{Name: "qa1"}}},
+			// not cached yet
+			{Name: "sandbox", Branch: "sandbox-tip", Hosts: []config.Host{{Name: "sandbox1"}}},
+		},
+	}
+	tips := revision.NewTipCache(time.Hour)
+	for _, e := range proj.Environments[:3] {
+		tips.Refresh(context.Background(), tipControl{}, proj, e)
+	}
+	deployed := revision.NewDeployedCache()
+	deployed.Put("goship", "production", "prod1", "old", "old", nil)
+	deployed.Put("goship", "production", "prod2", "prod-tip", "prod-tip", nil)
+	deployed.Put("goship", "production", "prod3", "older", "older", nil)
+	deployed.Put("goship", "staging", "stg1", "stg-tip", "stg-tip", nil)
+	deployed.Put("goship", "qa", "qa1", "stale", "stale", nil)
+	deployed.Put("goship", "sandbox", "sandbox1", "old", "old", nil)
+	drains := drain.Drains{"goship/production/prod3": {By: "bob", Since: now}}
+
+	h := metricsHandler{handler: handler{gcl: gcl, tips: tips, deployed: deployed}, now: func() time.Time { return now }}
+	calls = 0
+	got := string(formatMetrics(h.metrics([]config.Project{proj}, drains)))
+	want := `# HELP goship_environment_hosts_total Number of hosts of the environment including drained ones.
+# TYPE goship_environment_hosts_total gauge
+goship_environment_hosts_total{project="goship",environment="production"} 3
+goship_environment_hosts_total{project="goship",environment="staging"} 2
+goship_environment_hosts_total{project="goship",environment="qa"} 1
+goship_environment_hosts_total{project="goship",environment="sandbox"} 1
+# HELP goship_environment_hosts_behind Number of undrained hosts which are not on the latest deployable revision.
+# TYPE goship_environment_hosts_behind gauge
+goship_environment_hosts_behind{project="goship",environment="production"} 1
+goship_environment_hosts_behind{project="goship",environment="staging"} 0
+goship_environment_hosts_behind{project="goship",environment="qa"} 1
+goship_environment_hosts_behind{project="goship",environment="sandbox"} 0
+# HELP goship_environment_hosts_unknown Number of undrained hosts whose deployed or latest deployable revision is not cached.
+# TYPE goship_environment_hosts_unknown gauge
+goship_environment_hosts_unknown{project="goship",environment="production"} 0
+goship_environment_hosts_unknown{project="goship",environment="staging"} 1
+goship_environment_hosts_unknown{project="goship",environment="qa"} 0
+goship_environment_hosts_unknown{project="goship",environment="sandbox"} 1
+# HELP goship_environment_oldest_undeployed_commit_age_seconds How long the oldest commit not deployed into an undrained host has waited. Absent while unknown.
+# TYPE goship_environment_oldest_undeployed_commit_age_seconds gauge
+goship_environment_oldest_undeployed_commit_age_seconds{project="goship",environment="production"} 7200
+goship_environment_oldest_undeployed_commit_age_seconds{project="goship",environment="staging"} 0
+# HELP goship_environment_health Health of the environment by its status thresholds: 2 for green, 1 for yellow and 0 for red. Absent while unknown.
+# TYPE goship_environment_health gauge
+goship_environment_health{project="goship",environment="production"} 0
+goship_environment_health{project="goship",environment="staging"} 2
+goship_environment_health{project="goship",environment="qa"} 0
+`
+	if got != want {
+		t.Errorf("formatMetrics(h.metrics(projs, drains)) = %s; want %s", got, want)
+	}
+	if calls != 0 {
+		t.Errorf("calls = %d during the scrape; want no requests to GitHub", calls)
+	}
+}
+
+func TestFormatMetricsEscape(t *testing.T) {
+	got := string(formatMetrics([]envMetrics{{project: `a"b\c`, environment: "d\ne", total: 1, oldestAge: -1}}))
+	want := `goship_environment_hosts_total{project="a\"b\\c",environment="d\ne"} 1`
+	if !containsLine(got, want) {
+		t.Errorf("formatMetrics(ms) = %s; want a line %s", got, want)
+	}
+}
+
+// containsLine returns true if "text" has the line "line".
+func containsLine(text, line string) bool {
+	for _, l := range strings.Split(text, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,11 @@
 package commits
 
 import (
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/hostlock"
 	"github.com/gengo/goship/lib/revision"
 )
 
@@ -12,8 +17,73 @@ type environment struct {
 	Comment string `json:"comment"`
 	// Locked is true iff the project is not ready for deployment.
 	Locked bool `json:"isLocked"`
+	// State is "unconfigured" if the environment has no hosts yet, or its health by its status thresholds otherwise,
+	// i.e. "green", "yellow", "red" or "unknown". See config.StatusThresholds.
+	State string `json:"state,omitempty"`
 	// Deployments are per-host status of deployments
 	Deployments []deployStatus `json:"deployments"`
+	// Groups summarize groups of Deployments if they are grouped by a tag.
+	Groups []groupSummary `json:"groups,omitempty"`
+	// Deploying is true while the environment has a deployment in progress or settling.
+	Deploying bool `json:"deployInProgress,omitempty"`
+	// OldestUndeployed is the age of the oldest commit in the tip but not deployed into most of the hosts, if any.
+	OldestUndeployed *pendingAge `json:"oldestUndeployed,omitempty"`
+	// DiffUnavailable explains why the tip cannot be compared with the deployed revision, if so.
+	DiffUnavailable string `json:"diffUnavailable,omitempty"`
+	// Risk is the risk of deploying the commits pending in the first repository, if any.
+	Risk *pendingRisk `json:"risk,omitempty"`
+	// Repos are the status of each repository if the project has several. OldestUndeployed aggregates all of them.
+	Repos []repoStatus `json:"repos,omitempty"`
+	// Schedules are the next runs of the enabled schedules of the environment.
+	Schedules []scheduledDeploy `json:"schedules,omitempty"`
+	// Reconciliation suggests how to bring the hosts back to one revision if they disagree with each other.
+	Reconciliation *reconciliation `json:"reconciliation,omitempty"`
+}
+
+// stateUnconfigured is the state of environments which have no hosts yet, e.g. placeholders of new projects.
+// They are not compared with the tip and cannot be deployed into.
+const stateUnconfigured = "unconfigured"
+
+// environmentState returns the state of "e" as a whole, which is empty unless it has no hosts.
+func environmentState(e config.Environment) string {
+	if e.Unconfigured() {
+		return stateUnconfigured
+	}
+	return ""
+}
+
+// environmentHealth returns the state of "e" as a whole from the "observed" states of its hosts, i.e. "unconfigured"
+// if it has no hosts, or its health by e.StatusThresholds otherwise. Drained and deploying hosts are not counted,
+// so the states suppressed while deploying must be given instead.
+func environmentHealth(e config.Environment, observed []string) string {
+	if e.Unconfigured() {
+		return stateUnconfigured
+	}
+	var onTip, behind, unknown int
+	for _, s := range observed {
+		switch s {
+		case stateOnTip:
+			onTip++
+		case stateBehind:
+			behind++
+		case stateUnknown:
+			unknown++
+		}
+	}
+	return e.StatusThresholds.Health(onTip, behind, unknown)
+}
+
+// observedStates returns the states of "ds", or the ones suppressed while deploying if any.
+func observedStates(ds []deployStatus) []string {
+	states := make([]string, 0, len(ds))
+	for _, d := range ds {
+		if d.ObservedState != "" {
+			states = append(states, d.ObservedState)
+		} else {
+			states = append(states, d.State)
+		}
+	}
+	return states
 }
 
 // sourceStatus describes a latest deployable revision of a project
@@ -25,6 +95,23 @@ type sourceStatus struct {
 	// SourceCodeRevision can be equal to Revision if the underlying revision control system itself is
 	// a soruce code management system,
 	SourceCodeRevision revision.Revision `json:"sourceCodeRevision"`
+	// FetchedAt is when Revision was fetched.
+	FetchedAt time.Time `json:"latestFetchedAt"`
+	// FetchError is the error of the last fetch of the revision, if any.
+	FetchError string `json:"latestFetchError,omitempty"`
+}
+
+func newSourceStatus(tip revision.Tip) sourceStatus {
+	st := sourceStatus{
+		Revision:           tip.Rev,
+		ShortRevision:      tip.Rev.Short(),
+		SourceCodeRevision: tip.SrcRev,
+		FetchedAt:          tip.FetchedAt,
+	}
+	if tip.Err != nil {
+		st.FetchError = tip.Err.Error()
+	}
+	return st
 }
 
 // deployStatus describes a latest deployed revision of a project in a host
@@ -43,4 +130,20 @@ type deployStatus struct {
 	// SourceCodeDiffURL is an URL to a human-readable resource which describes difference between
 	// the latest deployable source code and SourceCodeRevision.
 	SourceCodeDiffURL string `json:"sourceCodeDiffURL"`
+	// State is one of "on_tip", "behind" and "unknown" compared with the latest deployable revision,
+	// "drained" if the host is drained, or "deploying" if the environment is deploying.
+	State string `json:"state"`
+	// ObservedState is the state compared with the latest deployable revision if State is "deploying".
+	ObservedState string `json:"observedState,omitempty"`
+	// Group is the value of the tag which the hosts are grouped by.
+	Group string `json:"group,omitempty"`
+	// Drained is the drain of the host if it is drained.
+	Drained *drain.Drain `json:"drained,omitempty"`
+	// HostLock is the lock of the host if it is locked.
+	HostLock *hostlock.Lock `json:"hostLock,omitempty"`
+	// HostKey is the state of the SSH host key of the host unless it is trusted, i.e. "pending" or "blocked".
+	HostKey string `json:"hostKey,omitempty"`
+	// Record compares Revision with the latest successful deployment in the deploy log, i.e. "on_record",
+	// "ahead_of_record", "behind_record" or "unrecorded". It is set only while the hosts of the environment disagree.
+	Record string `json:"record,omitempty"`
 }
@@ -0,0 +1,143 @@
+package commits
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcdtest"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+// TestReloadPollAndServe is meant for the race detector.
+// The configuration changes in etcd and falls back to the last valid definition, while pollers refresh the caches and requests read them.
+func TestReloadPollAndServe(t *testing.T) {
+	auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+	defer config.SetFallback(nil)
+	config.SetFallback(config.NewFallback())
+
+	s := etcdtest.NewStore()
+	cfg := config.Config{Projects: []config.Project{{
+		Name: "goship",
+		Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"},
+		Environments: []config.Environment{
+			{Name: "staging", Branch: "master", Deploy: "/bin/true", Hosts: []config.Host{{Name: "stg1", Tags: map[string]string{"role": "app"}}, {Name: "stg2"}}},
+			{Name: "production", Branch: "release", Deploy: "/bin/true", Hosts: []config.Host{{Name: "prod1"}}},
+		},
+	}}}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	etcdSrv := etcdtest.NewServer(s)
+	defer etcdSrv.Close()
+	ecl := etcd.NewClient([]string{etcdSrv.URL})
+	// keeps the valid definition in the fallback
+	if _, err := config.Load(ecl); err != nil {
+		t.Fatalf("config.Load(ecl) failed with %v", err)
+	}
+
+	tips := revision.NewTipCache(0)
+	deployed := revision.NewDeployedCache()
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/status", statusHandler{
+		handler:    handler{ac: acl.Null, ecl: ecl, tips: tips, deployed: deployed},
+		now:        time.Now,
+		urlControl: func(config.Project, string) (revision.Control, error) { return countingControl{}, nil },
+	})
+	mux.Handle("/metrics", metricsHandler{handler: handler{ecl: ecl, tips: tips, deployed: deployed}, now: time.Now})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	const (
+		envKey  = "/goship/projects/goship/environments/staging"
+		invalid = `{"deploy": "/bin/true", "pivotal_events": ["unknown"]}`
+		rounds  = 20
+	)
+	resp, err := ecl.Get(envKey, false, false)
+	if err != nil {
+		t.Fatalf("ecl.Get(%q, false, false) failed with %v", envKey, err)
+	}
+	valid := resp.Node.Value
+
+	var wg sync.WaitGroup
+	// reloads
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			v := valid
+			if i%2 == 0 {
+				v = invalid
+			}
+			if _, err := ecl.Set(envKey, v, 0); err != nil {
+				t.Errorf("ecl.Set(%q, %q, 0) failed with %v", envKey, v, err)
+				return
+			}
+			c, err := config.Load(ecl)
+			if err != nil {
+				t.Errorf("config.Load(ecl) failed with %v", err)
+				return
+			}
+			// callers modify what they loaded, e.g. while filtering hosts
+			for _, e := range c.Projects[0].Environments {
+				for k, h := range e.Hosts {
+					e.Hosts[k].Name = "modified"
+					if h.Tags != nil {
+						h.Tags["role"] = "modified"
+					}
+				}
+			}
+		}
+	}()
+	// pollers
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				c, err := config.Load(ecl)
+				if err != nil {
+					t.Errorf("config.Load(ecl) failed with %v", err)
+					return
+				}
+				for _, p := range c.Projects {
+					for _, e := range p.Environments {
+						tips.Refresh(context.Background(), tipControl{}, p, e)
+						for _, h := range e.Hosts {
+							deployed.Put(p.Name, e.Name, h.Name, revision.Revision(e.Branch), revision.Revision(e.Branch), nil)
+						}
+					}
+				}
+			}
+		}()
+	}
+	// requests
+	for _, path := range []string{"/api/v1/status", "/metrics", "/api/v1/status"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				resp, err := http.Get(srv.URL + path)
+				if err != nil {
+					t.Errorf("http.Get(%q) failed with %v", path, err)
+					return
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("GET %s = %d %s; want %d", path, resp.StatusCode, body, http.StatusOK)
+					return
+				}
+			}
+		}(path)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,124 @@
+package commits
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/revision"
+)
+
+// Labels of hosts in environments whose hosts disagree with each other. They compare the hosts with the latest
+// successful deployment in the deploy log rather than the tip, which tells which of the revisions is the intended one.
+const (
+	recordOn     = "on_record"
+	recordAhead  = "ahead_of_record"
+	recordBehind = "behind_record"
+	// recordUnknown is the label of hosts on revisions which the deploy log has no deployment of, e.g. shipped by hand.
+	recordUnknown = "unrecorded"
+)
+
+// DeployRecord is a deployment of an environment in the deploy log.
+type DeployRecord struct {
+	// Revision is the revision which the deployment shipped.
+	Revision revision.Revision
+	// Time is when the deployment started.
+	Time time.Time
+	// Success is true if the deployment succeeded.
+	Success bool
+}
+
+// reconciliation describes an environment whose hosts are on different revisions, e.g. after a partially failed
+// deployment, and suggests redeploying the revision of the latest successful deployment into the odd hosts.
+type reconciliation struct {
+	// Recorded is the revision of the latest successful deployment, or empty if the deploy log has none.
+	Recorded      revision.Revision `json:"recordedRevision,omitempty"`
+	ShortRecorded revision.Revision `json:"shortRecordedRevision,omitempty"`
+	// OnRecord, Ahead, Behind and Unrecorded count the hosts by their labels.
+	OnRecord   int `json:"onRecord"`
+	Ahead      int `json:"ahead"`
+	Behind     int `json:"behind"`
+	Unrecorded int `json:"unrecorded"`
+	// Retry are the hosts to redeploy with Recorded. Locked hosts are left out since deploys into them are refused.
+	Retry []string `json:"retryHosts,omitempty"`
+}
+
+// reconcilable returns true if "d" counts in reconciliation, i.e. it is undrained and its revision is known.
+func reconcilable(d deployStatus) bool {
+	return d.Drained == nil && d.Revision != ""
+}
+
+// disagree returns true if the hosts in "ds" which count in reconciliation are on more than one revision.
+func disagree(ds []deployStatus) bool {
+	var first revision.Revision
+	for _, d := range ds {
+		switch {
+		case !reconcilable(d):
+		case first == "":
+			first = d.Revision
+		case d.Revision != first:
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile labels the hosts in "ds" by the deployments in "records" of their environment, and suggests how to
+// bring them back to one revision. It returns nil and leaves the hosts unlabeled if they agree with each other.
+// Nothing is retried if none of "records" succeeded, since then no revision is known to be good.
+func reconcile(ds []deployStatus, records []DeployRecord) *reconciliation {
+	if !disagree(ds) {
+		return nil
+	}
+	var (
+		latest DeployRecord
+		// last is when each revision was deployed last, whether successfully or not.
+		last = make(map[revision.Revision]time.Time)
+	)
+	for _, r := range records {
+		if r.Success && r.Time.After(latest.Time) {
+			latest = r
+		}
+		if r.Time.After(last[r.Revision]) {
+			last[r.Revision] = r.Time
+		}
+	}
+	rc := &reconciliation{Recorded: latest.Revision, ShortRecorded: latest.Revision.Short()}
+	for i := range ds {
+		d := &ds[i]
+		if !reconcilable(*d) {
+			continue
+		}
+		d.Record = recordLabel(d.Revision, latest, last)
+		switch d.Record {
+		case recordOn:
+			rc.OnRecord++
+			continue
+		case recordAhead:
+			rc.Ahead++
+		case recordBehind:
+			rc.Behind++
+		case recordUnknown:
+			rc.Unrecorded++
+		}
+		if latest.Revision != "" && d.HostLock == nil {
+			rc.Retry = append(rc.Retry, d.HostName)
+		}
+	}
+	return rc
+}
+
+// recordLabel returns the label of a host on "rev", given the "latest" successful deployment and when each revision
+// was deployed "last". A host is ahead if its revision was deployed after the latest success, e.g. by a deployment
+// which failed halfway, and behind if only before it, e.g. when the host was skipped.
+func recordLabel(rev revision.Revision, latest DeployRecord, last map[revision.Revision]time.Time) string {
+	if rev == latest.Revision {
+		return recordOn
+	}
+	t, ok := last[rev]
+	switch {
+	case !ok:
+		return recordUnknown
+	case t.After(latest.Time):
+		return recordAhead
+	}
+	return recordBehind
+}
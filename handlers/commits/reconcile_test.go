@@ -0,0 +1,113 @@
+package commits
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/revision"
+)
+
+// hostsOn returns hosts "web1", "web2", ... on the revisions in "revs" in order. Empty revisions are unknown.
+func hostsOn(revs ...revision.Revision) []deployStatus {
+	ds := make([]deployStatus, len(revs))
+	for i, rev := range revs {
+		ds[i] = deployStatus{HostName: fmt.Sprintf("web%d", i+1), Revision: rev}
+	}
+	return ds
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	records := []DeployRecord{
+		{Revision: "a0", Time: now.Add(-3 * time.Hour), Success: true},
+		{Revision: "a1", Time: now.Add(-2 * time.Hour), Success: true},
+		// failed halfway
+		{Revision: "a2", Time: now.Add(-time.Hour)},
+	}
+	drained := hostsOn("a1", "a2", "a9")
+	drained[2].Drained = &drain.Drain{By: "alice"}
+	drainedOnly := hostsOn("a1", "a9")
+	drainedOnly[1].Drained = &drain.Drain{By: "alice"}
+	locked := hostsOn("a1", "a2", "a2")
+	locked[2].HostLock = &hostlock.Lock{By: "bob"}
+
+	for _, spec := range []struct {
+		name    string
+		hosts   []deployStatus
+		records []DeployRecord
+		// want is nil if the hosts agree.
+		want       *reconciliation
+		wantLabels []string
+	}{
+		{name: "clean", hosts: hostsOn("a1", "a1", "a1"), records: records},
+		{name: "clean on an unrecorded revision", hosts: hostsOn("a9", "a9"), records: records},
+		{name: "unknown hosts do not disagree", hosts: hostsOn("a1", "", "a1"), records: records},
+		{name: "drained hosts do not disagree", hosts: drainedOnly, records: records},
+		{
+			name: "partial deploy ahead of record", hosts: hostsOn("a1", "a2", "a2", "a1"), records: records,
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", OnRecord: 2, Ahead: 2, Retry: []string{"web2", "web3"}},
+			wantLabels: []string{recordOn, recordAhead, recordAhead, recordOn},
+		},
+		{
+			name: "hosts left behind", hosts: hostsOn("a1", "a0", "a1"), records: records,
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", OnRecord: 2, Behind: 1, Retry: []string{"web2"}},
+			wantLabels: []string{recordOn, recordBehind, recordOn},
+		},
+		{
+			name: "drained hosts are left out", hosts: drained, records: records,
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", OnRecord: 1, Ahead: 1, Retry: []string{"web2"}},
+			wantLabels: []string{recordOn, recordAhead, ""},
+		},
+		{
+			name: "locked hosts are not retried", hosts: locked, records: records,
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", OnRecord: 1, Ahead: 2, Retry: []string{"web2"}},
+			wantLabels: []string{recordOn, recordAhead, recordAhead},
+		},
+		{
+			name: "fully diverged", hosts: hostsOn("a2", "a0", "a9"), records: records,
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", Ahead: 1, Behind: 1, Unrecorded: 1, Retry: []string{"web1", "web2", "web3"}},
+			wantLabels: []string{recordAhead, recordBehind, recordUnknown},
+		},
+		{
+			name: "a revision deployed again after the record", hosts: hostsOn("a1", "a0"),
+			records:    append([]DeployRecord{{Revision: "a0", Time: now, Success: false}}, records...),
+			want:       &reconciliation{Recorded: "a1", ShortRecorded: "a1", OnRecord: 1, Ahead: 1, Retry: []string{"web2"}},
+			wantLabels: []string{recordOn, recordAhead},
+		},
+		{
+			name: "no successful deployment", hosts: hostsOn("a2", "a0", "a9"), records: records[2:],
+			want:       &reconciliation{Ahead: 1, Unrecorded: 2},
+			wantLabels: []string{recordAhead, recordUnknown, recordUnknown},
+		},
+		{
+			name: "no deploy log", hosts: hostsOn("a1", "a2"),
+			want:       &reconciliation{Unrecorded: 2},
+			wantLabels: []string{recordUnknown, recordUnknown},
+		},
+	} {
+		got := reconcile(spec.hosts, spec.records)
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("%s: reconcile(hosts, records) = %#v; want %#v", spec.name, got, spec.want)
+		}
+		var labels []string
+		for _, d := range spec.hosts {
+			labels = append(labels, d.Record)
+		}
+		if spec.want == nil {
+			for _, l := range labels {
+				if l != "" {
+					t.Errorf("%s: labels = %q; want none", spec.name, labels)
+					break
+				}
+			}
+			continue
+		}
+		if !reflect.DeepEqual(labels, spec.wantLabels) {
+			t.Errorf("%s: labels = %q; want %q", spec.name, labels, spec.wantLabels)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package commits
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+type refreshHandler struct {
+	handler
+}
+
+// NewRefresh returns a new http.Handler which refreshes the latest deployable revision of an environment in "tips".
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/environments/staging/refresh
+func NewRefresh(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, tips *revision.TipCache) http.Handler {
+	return refreshHandler{handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys, tips: tips}}
+}
+
+func (h refreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 8 || components[4] == "" || components[5] != "environments" || components[6] == "" || components[7] != "refresh" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	p, cfg, err := h.loadProject(projName, u)
+	if err == projectUnaccessible {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	_, env, err := config.ResolveTarget([]config.Project{p}, projName, envName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	c, err := h.newControl(p, cfg.DeployUser)
+	if err != nil {
+		glog.Errorf("Failed to build revision control of %s: %v", projName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tip := h.tips.Refresh(context.Background(), c, p, *env)
+	buf, err := json.Marshal(newSourceStatus(tip))
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package commits
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// repoStatus describes a repository of a multi-repo project in an environment, which is shown as a sub-row of the environment.
+type repoStatus struct {
+	// Name is "owner/name" of the repository.
+	Name string `json:"name"`
+	// Branch is the branch of the repository deployed into the environment.
+	Branch string `json:"branch"`
+	sourceStatus
+	// Deployed is the revision of the repository deployed into the environment, if known.
+	Deployed      revision.Revision `json:"deployed,omitempty"`
+	ShortDeployed revision.Revision `json:"shortDeployed,omitempty"`
+	// DiffURL is an URL to the difference between Deployed and the tip of the repository.
+	DiffURL string `json:"diffURL,omitempty"`
+	// OldestUndeployed is the age of the oldest commit in the tip of the repository but not deployed, if any.
+	OldestUndeployed *pendingAge `json:"oldestUndeployed,omitempty"`
+	// DiffUnavailable explains why the tip cannot be compared with Deployed, if so.
+	DiffUnavailable string `json:"diffUnavailable,omitempty"`
+}
+
+// repoStatuses returns the status of each repository of "proj" in "e" unless it is a single-repo project.
+// The first repository is the one whose tip is "primary" and which is deployed into the hosts as "deployed".
+// The others are not observable in the hosts, so their revisions deployed last are looked up by repoRevisions.
+func (h handler) repoStatuses(ctx context.Context, c revision.Control, proj config.Project, e config.Environment, primary sourceStatus, deployed revision.Revision) []repoStatus {
+	if len(proj.Repos) == 0 {
+		return nil
+	}
+	revs := h.deployedRepoRevisions(proj.Name, e.Name)
+	var sts []repoStatus
+	for i, r := range proj.SourceRepos() {
+		st := repoStatus{Name: r.Name(), Branch: r.BranchFor(e), sourceStatus: primary, Deployed: deployed}
+		rp := proj.ForRepo(r)
+		if i > 0 {
+			st.sourceStatus = newSourceStatus(h.tips.Get(ctx, c, rp, r.EnvironmentFor(e)))
+			st.Deployed = revision.Revision(revs[r.Name()])
+		}
+		st.ShortDeployed = st.Deployed.Short()
+		if st.Deployed != "" && st.SourceCodeRevision != "" {
+			st.DiffURL = c.SourceDiffURL(rp, st.Deployed, st.SourceCodeRevision)
+		}
+		sts = append(sts, st)
+	}
+	return sts
+}
+
+// deployedRepoRevisions returns the revisions of the repositories of a multi-repo project deployed last into "env" of "proj".
+func (h handler) deployedRepoRevisions(proj, env string) config.Revisions {
+	if h.repoRevisions == nil {
+		return nil
+	}
+	return h.repoRevisions(proj, env)
+}
+
+// annotateRepos sets the ages of the undeployed commits in each repository of "env" of "p" at "now",
+// and aggregates them into the age of the environment. The first repository takes the age of the environment as is.
+func (h handler) annotateRepos(p config.Project, env *environment, now time.Time) {
+	for i := range env.Repos {
+		st := &env.Repos[i]
+		if i == 0 {
+			st.OldestUndeployed, st.DiffUnavailable = env.OldestUndeployed, env.DiffUnavailable
+			continue
+		}
+		oldest, err := oldestUndeployed(h.gcl, p.ForRepo(p.Repos[i]), st.Deployed, st.SourceCodeRevision, now)
+		switch {
+		case githublib.IsMissingCommit(err):
+			glog.Warningf("Cannot compare %s and %s of %s in %s-%s: %v", st.Deployed, st.SourceCodeRevision, st.Name, p.Name, env.Name, err)
+			st.DiffUnavailable = missingCommitReason(st.Deployed, st.SourceCodeRevision)
+		case err != nil:
+			glog.Errorf("Failed to compare %s and %s of %s in %s-%s: %v", st.Deployed, st.SourceCodeRevision, st.Name, p.Name, env.Name, err)
+		default:
+			st.OldestUndeployed = oldest
+			env.OldestUndeployed = olderPending(env.OldestUndeployed, oldest)
+		}
+	}
+}
+
+// olderPending returns the older of "a" and "b" with the number of the commits pending in both.
+// It returns either if the other is nil.
+func olderPending(a, b *pendingAge) *pendingAge {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	older := *a
+	if b.Date.Before(a.Date) {
+		older = *b
+	}
+	older.Pending = a.Pending + b.Pending
+	return &older
+}
@@ -0,0 +1,126 @@
+package commits
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// diffControl is a tipControl which links diffs like GitHub.
+type diffControl struct {
+	tipControl
+}
+
+func (c diffControl) SourceDiffURL(p config.Project, from, to revision.Revision) string {
+	repo := p.SourceRepo()
+	return "https://github.com/" + repo.RepoOwner + "/" + repo.RepoName + "/compare/" + string(from) + "..." + string(to)
+}
+
+// multiRepoProject returns a project of gengo/api and gengo/web, whose tips in tipControl are "api-tip" and "web-tip".
+func multiRepoProject() config.Project {
+	api := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+	web := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}, Branch: "web-tip"}
+	return config.Project{
+		Name:         "shop",
+		Repo:         api.Repo,
+		RepoType:     config.RepoTypeGithub,
+		Repos:        []config.RepoRef{api, web},
+		Environments: []config.Environment{{Name: "production", Branch: "api-tip", Hosts: []config.Host{{Name: "app1"}}}},
+	}
+}
+
+func TestRepoStatuses(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"api-old...api-tip": {Commits: []github.RepositoryCommit{datedCommit("api-tip", now.Add(-time.Hour))}},
+		"web-old...web-tip": {Commits: []github.RepositoryCommit{datedCommit("web-1", now.Add(-5*24*time.Hour)), datedCommit("web-tip", now.Add(-2*time.Hour))}},
+	}}
+	proj := multiRepoProject()
+	h := handler{
+		gcl:  gcl,
+		tips: revision.NewTipCache(time.Hour),
+		repoRevisions: func(proj, env string) config.Revisions {
+			return config.Revisions{"gengo/api": "api-old", "gengo/web": "web-old"}
+		},
+	}
+	env := &environment{
+		Name:         "production",
+		sourceStatus: sourceStatus{SourceCodeRevision: "api-tip"},
+		Deployments:  []deployStatus{{HostName: "app1", SourceCodeRevision: "api-old"}},
+	}
+	env.Repos = h.repoStatuses(context.Background(), diffControl{}, proj, proj.Environments[0], env.sourceStatus, deployedRevision(env))
+	env.OldestUndeployed, env.DiffUnavailable = h.oldestUndeployed(proj, env, now)
+	h.annotateRepos(proj, env, now)
+
+	if len(env.Repos) != 2 {
+		t.Fatalf("env.Repos = %#v; want gengo/api and gengo/web", env.Repos)
+	}
+	for i, spec := range []struct {
+		name, branch       string
+		tip, deployed      revision.Revision
+		diffURL, oldestSHA string
+	}{
+		{name: "gengo/api", branch: "api-tip", tip: "api-tip", deployed: "api-old", diffURL: "https://github.com/gengo/api/compare/api-old...api-tip", oldestSHA: "api-tip"},
+		{name: "gengo/web", branch: "web-tip", tip: "web-tip", deployed: "web-old", diffURL: "https://github.com/gengo/web/compare/web-old...web-tip", oldestSHA: "web-1"},
+	} {
+		st := env.Repos[i]
+		if st.Name != spec.name || st.Branch != spec.branch || st.SourceCodeRevision != spec.tip || st.Deployed != spec.deployed || st.DiffURL != spec.diffURL {
+			t.Errorf("env.Repos[%d] = %#v; want %s@%s deployed %s and tip %s with diff %s", i, st, spec.name, spec.branch, spec.deployed, spec.tip, spec.diffURL)
+		}
+		if st.OldestUndeployed == nil || st.OldestUndeployed.SHA != spec.oldestSHA {
+			t.Errorf("env.Repos[%d].OldestUndeployed = %#v; want %s", i, st.OldestUndeployed, spec.oldestSHA)
+		}
+	}
+	want := &pendingAge{SHA: "web-1", Date: now.Add(-5 * 24 * time.Hour), WaitingSeconds: 5 * 24 * 3600, Level: config.CommitAgeWarning, Pending: 3}
+	if !reflect.DeepEqual(env.OldestUndeployed, want) {
+		t.Errorf("env.OldestUndeployed = %#v; want %#v aggregated across the repositories", env.OldestUndeployed, want)
+	}
+
+	single := config.Project{Name: "api", Repo: proj.Repo, Environments: proj.Environments}
+	if got := h.repoStatuses(context.Background(), diffControl{}, single, single.Environments[0], env.sourceStatus, "api-old"); got != nil {
+		t.Errorf("h.repoStatuses(...) = %#v for a single-repo project; want nil", got)
+	}
+}
+
+func TestDriftByAgeMultiRepo(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"web-old...web-tip": {Commits: []github.RepositoryCommit{datedCommit("web-tip", now.Add(-3*24*time.Hour))}},
+	}}
+	proj := multiRepoProject()
+	tips := revision.NewTipCache(time.Hour)
+	env := proj.Environments[0]
+	tips.Refresh(context.Background(), tipControl{}, proj, env)
+	tips.Refresh(context.Background(), tipControl{}, proj.ForRepo(proj.Repos[1]), proj.Repos[1].EnvironmentFor(env))
+	deployed := revision.NewDeployedCache()
+	// the first repository is up to date.
+	deployed.Put("shop", "production", "app1", "api-tip", "api-tip", nil)
+
+	h := driftAgeHandler{
+		handler: handler{
+			ac:       acl.Null,
+			gcl:      gcl,
+			tips:     tips,
+			deployed: deployed,
+			repoRevisions: func(proj, env string) config.Revisions {
+				return config.Revisions{"gengo/api": "api-tip", "gengo/web": "web-old"}
+			},
+		},
+		now: func() time.Time { return now },
+	}
+	active := func(proj, env string, hosts []config.Host) []config.Host { return hosts }
+	got := h.driftByAge([]config.Project{proj}, active)
+	want := []envAge{{
+		Project: "shop", Environment: "production", Deployed: "api-tip", Tip: "api-tip",
+		Oldest: &pendingAge{SHA: "web-tip", Date: now.Add(-3 * 24 * time.Hour), WaitingSeconds: 3 * 24 * 3600, Level: config.CommitAgeWarning, Pending: 1},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("h.driftByAge(projs, active) = %#v; want %#v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package commits
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+)
+
+// pendingRisk is the risk of deploying the commits pending for an environment, scored by config.RiskConfiguration.
+type pendingRisk struct {
+	// Level is "low", "medium" or "high".
+	Level string  `json:"level"`
+	Score float64 `json:"score"`
+	// Factors break Score down into the points of each factor, which the dashboard shows on hover.
+	Factors []config.RiskTerm `json:"factors"`
+}
+
+// riskFactors returns the factors of the risk of deploying the commits compared in "cmp" into an environment of "proj",
+// which was deployed into successfully at "last" (zero if unknown), at "now".
+func riskFactors(proj config.Project, cmp *github.CommitsComparison, last, now time.Time) config.RiskFactors {
+	f := config.RiskFactors{Commits: len(cmp.Commits)}
+	authors := make(map[string]bool)
+	for _, c := range cmp.Commits {
+		var author string
+		switch {
+		case c.Author != nil && c.Author.Login != nil:
+			author = *c.Author.Login
+		case c.Commit != nil && c.Commit.Author != nil && c.Commit.Author.Email != nil:
+			author = *c.Commit.Author.Email
+		case c.Commit != nil && c.Commit.Author != nil && c.Commit.Author.Name != nil:
+			author = *c.Commit.Author.Name
+		}
+		if author != "" && !authors[author] {
+			authors[author] = true
+			f.Authors++
+		}
+	}
+	for _, file := range cmp.Files {
+		if file.Additions != nil {
+			f.Lines += *file.Additions
+		}
+		if file.Deletions != nil {
+			f.Lines += *file.Deletions
+		}
+		if file.Filename != nil && proj.Risk.IsMigration(*file.Filename) {
+			f.Migrations = true
+		}
+	}
+	if !last.IsZero() && now.After(last) {
+		f.SinceLastDeploy = now.Sub(last)
+	}
+	return f
+}
+
+// assessRisk returns the risk of deploying the commits in "tip" but not in "deployed" of "proj" into an environment
+// deployed into successfully at "last" (zero if unknown), at "now". The commits are compared with "gcl", which should cache the comparisons.
+// It returns nil if there are no such commits or either revision is unknown.
+func assessRisk(gcl githublib.Client, proj config.Project, deployed, tip revision.Revision, last, now time.Time) (*pendingRisk, error) {
+	if deployed == "" || tip == "" || deployed == tip {
+		return nil, nil
+	}
+	repo := proj.SourceRepo()
+	cmp, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(deployed), string(tip))
+	if err != nil {
+		return nil, err
+	}
+	if len(cmp.Commits) == 0 {
+		return nil, nil
+	}
+	score, level, terms := proj.Risk.Assess(riskFactors(proj, cmp, last, now))
+	return &pendingRisk{Level: level, Score: score, Factors: terms}, nil
+}
+
+// risk returns the risk of deploying the commits in "tip" but not in "deployed" into "env" of "p" at "now",
+// or nil if there are none. Only the first repository of multi-repo projects counts.
+// Failures are only logged by oldestUndeployed, which compares the same revisions first.
+func (h handler) risk(p config.Project, env string, deployed, tip revision.Revision, now time.Time) *pendingRisk {
+	var last time.Time
+	if h.lastDeploy != nil {
+		last, _ = h.lastDeploy(p.Name, env)
+	}
+	r, err := assessRisk(h.gcl, p, deployed, tip, last, now)
+	if err != nil {
+		return nil
+	}
+	return r
+}
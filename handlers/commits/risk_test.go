@@ -0,0 +1,125 @@
+package commits
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+)
+
+// changedFile is a file in a comparison with "lines" added.
+func changedFile(name string, lines int) github.CommitFile {
+	return github.CommitFile{Filename: github.String(name), Additions: github.Int(lines), Deletions: github.Int(0)}
+}
+
+// loginCommit is a testCommit of a GitHub user "login".
+func loginCommit(sha, login string) github.RepositoryCommit {
+	c := testCommit(sha, "Commit "+sha, "Someone")
+	c.Author = &github.User{Login: github.String(login)}
+	return c
+}
+
+func TestAssessRisk(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	gcl := compareClient{comps: map[string]*github.CommitsComparison{
+		"typo...tip": {
+			Commits: []github.RepositoryCommit{loginCommit("c1", "alice")},
+			Files:   []github.CommitFile{changedFile("README.md", 2)},
+		},
+		"feature...tip": {
+			Commits: []github.RepositoryCommit{loginCommit("c1", "alice"), loginCommit("c2", "bob"), loginCommit("c3", "alice")},
+			Files:   []github.CommitFile{changedFile("app/search.go", 150), changedFile("app/search_test.go", 100)},
+		},
+		"schema...tip": {
+			Commits: []github.RepositoryCommit{loginCommit("c1", "alice")},
+			Files:   []github.CommitFile{changedFile("db/migrate/20151010_add_index.rb", 5)},
+		},
+		"release...tip": {
+			Commits: []github.RepositoryCommit{
+				loginCommit("c1", "alice"), loginCommit("c2", "bob"), loginCommit("c3", "carol"), loginCommit("c4", "dave"),
+				loginCommit("c5", "alice"), loginCommit("c6", "bob"), loginCommit("c7", "carol"), loginCommit("c8", "dave"),
+				// the same author without a GitHub account
+				testCommit("c9", "Bump version", "Dave"),
+			},
+			Files: []github.CommitFile{changedFile("app/billing.go", 600), changedFile("migrations/0042_invoices.sql", 40)},
+		},
+	}}
+	proj := config.Project{Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+
+	for _, spec := range []struct {
+		deployed  revision.Revision
+		last      time.Time
+		wantLevel string
+		wantScore float64
+	}{
+		{deployed: "tip"},
+		{deployed: ""},
+		// 1 commit + 2 lines + 1 author
+		{deployed: "typo", last: now.Add(-24 * time.Hour), wantLevel: config.RiskLow, wantScore: 1 + 0.02 + 2 + 0.5},
+		// 3 commits + 250 lines + 2 authors
+		{deployed: "feature", wantLevel: config.RiskLow, wantScore: 3 + 2.5 + 4},
+		// 3 commits + 250 lines + 2 authors + 3 days
+		{deployed: "feature", last: now.Add(-3 * 24 * time.Hour), wantLevel: config.RiskMedium, wantScore: 3 + 2.5 + 4 + 1.5},
+		// 1 commit + 5 lines + 1 author + migrations
+		{deployed: "schema", wantLevel: config.RiskMedium, wantScore: 1 + 0.05 + 2 + 10},
+		// 9 commits + 640 lines + 5 authors + migrations
+		{deployed: "release", wantLevel: config.RiskHigh, wantScore: 9 + 6.4 + 10 + 10},
+	} {
+		got, err := assessRisk(gcl, proj, spec.deployed, "tip", spec.last, now)
+		if err != nil {
+			t.Errorf("assessRisk(gcl, proj, %q, %q, %s, now) failed with %v", spec.deployed, "tip", spec.last, err)
+			continue
+		}
+		if spec.wantLevel == "" {
+			if got != nil {
+				t.Errorf("assessRisk(gcl, proj, %q, %q, %s, now) = %#v; want nil", spec.deployed, "tip", spec.last, got)
+			}
+			continue
+		}
+		if got == nil || got.Level != spec.wantLevel || !closeTo(got.Score, spec.wantScore) {
+			t.Errorf("assessRisk(gcl, proj, %q, %q, %s, now) = %#v; want %s with %g", spec.deployed, "tip", spec.last, got, spec.wantLevel, spec.wantScore)
+		}
+	}
+
+	// custom migration paths only
+	proj.Risk = &config.RiskConfiguration{MigrationPaths: []string{"schema"}}
+	if got, err := assessRisk(gcl, proj, "schema", "tip", time.Time{}, now); err != nil || got == nil || got.Level != config.RiskLow {
+		t.Errorf("assessRisk(gcl, proj, %q, %q, ...) = %#v, %v with migration_paths %q; want low risk", "schema", "tip", got, err, proj.Risk.MigrationPaths)
+	}
+}
+
+func TestHandlerRisk(t *testing.T) {
+	now := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	h := handler{
+		gcl: compareClient{comps: map[string]*github.CommitsComparison{
+			"old...tip": {Commits: []github.RepositoryCommit{loginCommit("tip", "alice")}},
+		}},
+		lastDeploy: func(proj, env string) (time.Time, bool) {
+			if proj == "goship" && env == "production" {
+				return now.Add(-10 * 24 * time.Hour), true
+			}
+			return time.Time{}, false
+		},
+	}
+	proj := config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+
+	got := h.risk(proj, "production", "old", "tip", now)
+	if got == nil || len(got.Factors) != 5 || got.Factors[4].Factor != config.RiskFactorDays || got.Factors[4].Value != 10 {
+		t.Errorf("h.risk(proj, %q, ...) = %#v; want 10 days since the last deployment", "production", got)
+	}
+	if got := h.risk(proj, "staging", "old", "tip", now); got == nil || len(got.Factors) != 4 {
+		t.Errorf("h.risk(proj, %q, ...) = %#v; want no days without deployments", "staging", got)
+	}
+	// failures are left to oldestUndeployed.
+	if got := h.risk(proj, "production", "gone", "tip", now); got != nil {
+		t.Errorf("h.risk(proj, %q, %q, ...) = %#v; want nil", "production", "gone", got)
+	}
+}
+
+// closeTo returns true if "a" and "b" are the same except errors of floating point arithmetic.
+func closeTo(a, b float64) bool {
+	d := a - b
+	return -1e-9 < d && d < 1e-9
+}
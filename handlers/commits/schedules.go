@@ -0,0 +1,40 @@
+package commits
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/schedule"
+	"github.com/golang/glog"
+)
+
+// scheduledDeploy is the next run of an enabled schedule of an environment.
+type scheduledDeploy struct {
+	// Index is the index of the schedule in the environment, which the skip button refers to.
+	Index int    `json:"index"`
+	Cron  string `json:"cron"`
+	schedule.Upcoming
+}
+
+// upcomingSchedules returns the next runs of the enabled schedules of "e" of "proj" after "now" in "s".
+// Schedules whose state cannot be loaded are logged and left out like loadDrains.
+func upcomingSchedules(s schedule.Store, proj string, e config.Environment, now time.Time) []scheduledDeploy {
+	var upcoming []scheduledDeploy
+	for i, sc := range e.Schedules {
+		if !sc.Enabled {
+			continue
+		}
+		expr, err := sc.Expr()
+		if err != nil {
+			glog.Errorf("Invalid schedule %d of %s-%s: %v", i, proj, e.Name, err)
+			continue
+		}
+		next, err := schedule.Next(s, schedule.Key(proj, e.Name, i), expr, now)
+		if err != nil {
+			glog.Errorf("Failed to load schedule %d of %s-%s: %v", i, proj, e.Name, err)
+			continue
+		}
+		upcoming = append(upcoming, scheduledDeploy{Index: i, Cron: sc.Cron, Upcoming: next})
+	}
+	return upcoming
+}
@@ -0,0 +1,36 @@
+package commits
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/schedule"
+)
+
+func TestUpcomingSchedules(t *testing.T) {
+	s := schedule.NewMemoryStore()
+	if err := schedule.SetSkipNext(s, schedule.Key("api", "staging", 2), true); err != nil {
+		t.Fatalf("schedule.SetSkipNext(...) failed with %v", err)
+	}
+	e := config.Environment{Name: "staging", Schedules: []config.Schedule{
+		{Cron: "0 2 * * *", Enabled: true},
+		{Cron: "0 3 * * *"},
+		{Cron: "30 12 * * *", Timezone: "UTC", Enabled: true},
+	}}
+	now := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	got := upcomingSchedules(s, "api", e, now)
+	want := []scheduledDeploy{
+		{Index: 0, Cron: "0 2 * * *", Upcoming: schedule.Upcoming{At: time.Date(2016, 3, 2, 2, 0, 0, 0, time.UTC)}},
+		{Index: 2, Cron: "30 12 * * *", Upcoming: schedule.Upcoming{At: time.Date(2016, 3, 1, 12, 30, 0, 0, time.UTC), Skipped: true}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("upcomingSchedules(...) = %#v; want %#v", got, want)
+	}
+	for i := range want {
+		if got[i].Index != want[i].Index || got[i].Cron != want[i].Cron || !got[i].At.Equal(want[i].At) || got[i].Skipped != want[i].Skipped {
+			t.Errorf("upcomingSchedules(...)[%d] = %#v; want %#v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package commits
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/running"
+)
+
+// envKey identifies an environment of a project.
+type envKey struct {
+	project, environment string
+}
+
+// settlingEnvironments returns the environments which have deployments in progress in "ds", or whose deployments
+// finished within "settle" before "now". Their hosts report a mix of old and new revisions meanwhile,
+// which is not a drift from the tip.
+func settlingEnvironments(ds []running.Deploy, settle time.Duration, now time.Time) map[envKey]bool {
+	envs := make(map[envKey]bool)
+	for _, d := range ds {
+		if d.FinishedAt == nil || now.Sub(*d.FinishedAt) < settle {
+			envs[envKey{project: d.Project, environment: d.Environment}] = true
+		}
+	}
+	return envs
+}
+
+// settledState returns the state of a host observed as "observed", and also the observed state if it is suppressed
+// because the environment is "settling". Drained hosts keep their state since they are not compared anyway.
+func settledState(observed string, settling bool) (state, suppressed string) {
+	if !settling || observed == stateDrained {
+		return observed, ""
+	}
+	return stateDeploying, observed
+}
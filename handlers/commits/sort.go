@@ -0,0 +1,131 @@
+package commits
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+)
+
+// States of hosts compared with the latest deployable revision
+const (
+	stateBehind  = "behind"
+	stateUnknown = "unknown"
+	stateOnTip   = "on_tip"
+	// stateDrained is the state of drained hosts, which are not compared with the tip.
+	stateDrained = "drained"
+	// stateDeploying is the state of hosts in environments with deployments in progress or settling,
+	// which are not compared with the tip until they settle.
+	stateDeploying = "deploying"
+)
+
+// stateRanks is the order of states in sorting. Hosts which need attention come first.
+var stateRanks = map[string]int{stateBehind: 0, stateUnknown: 1, stateDeploying: 2, stateOnTip: 3, stateDrained: 4}
+
+// hostState returns the state of "d" compared with "tip".
+func hostState(d deployStatus, tip revision.Revision) string {
+	switch {
+	case d.Drained != nil:
+		return stateDrained
+	case d.Revision == "" || tip == "":
+		return stateUnknown
+	case d.Revision == tip:
+		return stateOnTip
+	}
+	return stateBehind
+}
+
+// hostOrder is an order of hosts in an environment.
+type hostOrder struct {
+	// by is one of "" (config order), "name", "state" and "tag".
+	by string
+	// tag is the key of the tag to sort and group hosts by.
+	tag string
+}
+
+// parseHostOrder parses a value of "sort" parameter: "name", "state" or "tag:<key>".
+// An empty value means the config order.
+func parseHostOrder(s string) (hostOrder, error) {
+	switch {
+	case s == "" || s == "name" || s == "state":
+		return hostOrder{by: s}, nil
+	case strings.HasPrefix(s, "tag:") && len(s) > len("tag:"):
+		return hostOrder{by: "tag", tag: strings.TrimPrefix(s, "tag:")}, nil
+	}
+	return hostOrder{}, fmt.Errorf("unknown sort order %q; want name, state or tag:<key>", s)
+}
+
+// groupSummary is the number of hosts on the tip in a group of hosts. Drained hosts are not counted.
+type groupSummary struct {
+	// Name is the value of the tag of the group. It is empty for hosts without the tag.
+	Name  string `json:"name"`
+	OnTip int    `json:"onTip"`
+	Total int    `json:"total"`
+}
+
+// sortHosts sets states of the hosts in "env" and sorts them by "o". The states are suppressed if env.Deploying.
+// Ties are broken by host names so that the order does not change across refreshes.
+// If "o" sorts by a tag, the hosts are also grouped by the tag and the groups are summarized.
+func sortHosts(env *environment, hosts []config.Host, o hostOrder) {
+	tags := make(map[string]map[string]string)
+	for _, h := range hosts {
+		tags[h.Name] = h.Tags
+	}
+	for i := range env.Deployments {
+		d := &env.Deployments[i]
+		d.State, d.ObservedState = settledState(hostState(*d, env.Revision), env.Deploying)
+		if o.by == "tag" {
+			d.Group = tags[d.HostName][o.tag]
+		}
+	}
+	if o.by == "" {
+		return
+	}
+	sort.Stable(byHostOrder{ds: env.Deployments, by: o.by})
+	if o.by != "tag" {
+		return
+	}
+
+	env.Groups = nil
+	for _, d := range env.Deployments {
+		if n := len(env.Groups); n == 0 || env.Groups[n-1].Name != d.Group {
+			env.Groups = append(env.Groups, groupSummary{Name: d.Group})
+		}
+		g := &env.Groups[len(env.Groups)-1]
+		if d.State == stateDrained {
+			continue
+		}
+		g.Total++
+		if d.State == stateOnTip {
+			g.OnTip++
+		}
+	}
+}
+
+type byHostOrder struct {
+	ds []deployStatus
+	by string
+}
+
+func (b byHostOrder) Len() int      { return len(b.ds) }
+func (b byHostOrder) Swap(i, j int) { b.ds[i], b.ds[j] = b.ds[j], b.ds[i] }
+func (b byHostOrder) Less(i, j int) bool {
+	x, y := b.ds[i], b.ds[j]
+	switch b.by {
+	case "state":
+		if rx, ry := stateRanks[x.State], stateRanks[y.State]; rx != ry {
+			return rx < ry
+		}
+	case "tag":
+		// hosts without the tag come last.
+		if (x.Group == "") != (y.Group == "") {
+			return y.Group == ""
+		}
+		if x.Group != y.Group {
+			return x.Group < y.Group
+		}
+	}
+	return x.HostName < y.HostName
+}
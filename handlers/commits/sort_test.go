@@ -0,0 +1,183 @@
+package commits
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+)
+
+func testEnvironment() (environment, []config.Host) {
+	hosts := []config.Host{
+		{Name: "web2", Tags: map[string]string{"role": "web"}},
+		{Name: "db1", Tags: map[string]string{"role": "db"}},
+		{Name: "batch1"},
+		{Name: "web1", Tags: map[string]string{"role": "web"}},
+		{Name: "web3", Tags: map[string]string{"role": "web"}},
+	}
+	env := environment{
+		Name:         "production",
+		sourceStatus: sourceStatus{Revision: "tip"},
+		Deployments: []deployStatus{
+			{HostName: "web2", Revision: "tip"},
+			{HostName: "db1", Revision: "old"},
+			// failed to get the deployed revision
+			{HostName: "batch1"},
+			{HostName: "web1", Revision: "old"},
+			{HostName: "web3", Revision: "tip"},
+		},
+	}
+	return env, hosts
+}
+
+func hostNames(env environment) []string {
+	var names []string
+	for _, d := range env.Deployments {
+		names = append(names, d.HostName)
+	}
+	return names
+}
+
+func TestSortHosts(t *testing.T) {
+	for _, spec := range []struct {
+		sort   string
+		want   []string
+		groups []groupSummary
+	}{
+		{
+			sort: "",
+			want: []string{"web2", "db1", "batch1", "web1", "web3"},
+		},
+		{
+			sort: "name",
+			want: []string{"batch1", "db1", "web1", "web2", "web3"},
+		},
+		{
+			sort: "state",
+			want: []string{"db1", "web1", "batch1", "web2", "web3"},
+		},
+		{
+			sort: "tag:role",
+			want: []string{"db1", "web1", "web2", "web3", "batch1"},
+			groups: []groupSummary{
+				{Name: "db", OnTip: 0, Total: 1},
+				{Name: "web", OnTip: 2, Total: 3},
+				{Name: "", OnTip: 0, Total: 1},
+			},
+		},
+		{
+			sort:   "tag:zone",
+			want:   []string{"batch1", "db1", "web1", "web2", "web3"},
+			groups: []groupSummary{{Name: "", OnTip: 2, Total: 5}},
+		},
+	} {
+		o, err := parseHostOrder(spec.sort)
+		if err != nil {
+			t.Errorf("parseHostOrder(%q) failed with %v", spec.sort, err)
+			continue
+		}
+		env, hosts := testEnvironment()
+		sortHosts(&env, hosts, o)
+		if got := hostNames(env); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("hosts sorted by %q = %q; want %q", spec.sort, got, spec.want)
+		}
+		if !reflect.DeepEqual(env.Groups, spec.groups) {
+			t.Errorf("groups sorted by %q = %#v; want %#v", spec.sort, env.Groups, spec.groups)
+		}
+
+		// sorting again must not change the order.
+		sorted := hostNames(env)
+		env.Groups = nil
+		sortHosts(&env, hosts, o)
+		if got := hostNames(env); !reflect.DeepEqual(got, sorted) {
+			t.Errorf("hosts sorted by %q twice = %q; want %q", spec.sort, got, sorted)
+		}
+	}
+}
+
+func TestHostState(t *testing.T) {
+	env, hosts := testEnvironment()
+	sortHosts(&env, hosts, hostOrder{})
+	want := []string{stateOnTip, stateBehind, stateUnknown, stateBehind, stateOnTip}
+	var got []string
+	for _, d := range env.Deployments {
+		got = append(got, d.State)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("states = %q; want %q", got, want)
+	}
+
+	// hosts are unknown if the tip could not be fetched.
+	if got := hostState(deployStatus{Revision: "old"}, ""); got != stateUnknown {
+		t.Errorf("hostState(%q, %q) = %q; want %q", "old", "", got, stateUnknown)
+	}
+	// drained hosts are not compared with the tip.
+	d := deployStatus{Revision: "tip", Drained: &drain.Drain{By: "alice"}}
+	if got := hostState(d, "tip"); got != stateDrained {
+		t.Errorf("hostState(%#v, %q) = %q; want %q", d, "tip", got, stateDrained)
+	}
+}
+
+func TestSortHostsDeploying(t *testing.T) {
+	env, hosts := testEnvironment()
+	env.Deploying = true
+	env.Deployments[1].Drained = &drain.Drain{By: "alice"}
+	sortHosts(&env, hosts, hostOrder{by: "state"})
+	// drained hosts are not suppressed, and others are sorted by names while deploying.
+	if got, want := hostNames(env), []string{"batch1", "web1", "web2", "web3", "db1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts sorted by state = %q; want %q", got, want)
+	}
+	var states, observed []string
+	for _, d := range env.Deployments {
+		states, observed = append(states, d.State), append(observed, d.ObservedState)
+	}
+	if want := []string{stateDeploying, stateDeploying, stateDeploying, stateDeploying, stateDrained}; !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %q; want %q", states, want)
+	}
+	if want := []string{stateUnknown, stateBehind, stateOnTip, stateOnTip, ""}; !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed states = %q; want %q", observed, want)
+	}
+}
+
+func TestSortHostsExcludesDrained(t *testing.T) {
+	env, hosts := testEnvironment()
+	// web3 is on the tip and db1 is behind but both are drained.
+	for i := range env.Deployments {
+		if n := env.Deployments[i].HostName; n == "web3" || n == "db1" {
+			env.Deployments[i].Drained = &drain.Drain{By: "alice"}
+		}
+	}
+	o, err := parseHostOrder("tag:role")
+	if err != nil {
+		t.Fatalf("parseHostOrder(%q) failed with %v", "tag:role", err)
+	}
+	sortHosts(&env, hosts, o)
+	if got, want := hostNames(env), []string{"db1", "web1", "web2", "web3", "batch1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts sorted by tag:role = %q; want %q", got, want)
+	}
+	want := []groupSummary{
+		{Name: "db", OnTip: 0, Total: 0},
+		{Name: "web", OnTip: 1, Total: 2},
+		{Name: "", OnTip: 0, Total: 1},
+	}
+	if !reflect.DeepEqual(env.Groups, want) {
+		t.Errorf("groups = %#v; want %#v", env.Groups, want)
+	}
+
+	if o, err = parseHostOrder("state"); err != nil {
+		t.Fatalf("parseHostOrder(%q) failed with %v", "state", err)
+	}
+	sortHosts(&env, hosts, o)
+	if got, want := hostNames(env), []string{"web1", "batch1", "web2", "db1", "web3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts sorted by state = %q; want %q", got, want)
+	}
+}
+
+func TestParseHostOrderInvalid(t *testing.T) {
+	for _, s := range []string{"random", "tag:", "state:desc"} {
+		if o, err := parseHostOrder(s); err == nil {
+			t.Errorf("parseHostOrder(%q) = %#v; want failure", s, o)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package commits
+
+import (
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/annotation"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/inventory"
+	"github.com/gengo/goship/lib/preferences"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// dashboard is the state of all the projects readable by a user.
+type dashboard struct {
+	Projects []projectStatus `json:"projects"`
+	Running  []runningStatus `json:"running,omitempty"`
+}
+
+// runningStatus is a deployment in progress or just finished.
+type runningStatus struct {
+	running.Deploy
+	// ElapsedSeconds is how long the deployment has been running. It is zero once it has finished.
+	ElapsedSeconds int64 `json:"elapsedSeconds,omitempty"`
+}
+
+type projectStatus struct {
+	Name string `json:"name"`
+	// ConfigErrors are the problems of the project in etcd if its last valid definition is shown instead.
+	ConfigErrors []string    `json:"configErrors,omitempty"`
+	Environments []envStatus `json:"environments"`
+}
+
+// envStatus is a compact version of environment. Empty fields are omitted to keep the payload small.
+type envStatus struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+	// Ephemeral is true if the environment was created for a branch. See config.EphemeralRule.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Locked is true iff the project is not ready for deployment.
+	Locked bool `json:"isLocked,omitempty"`
+	// State is "unconfigured" for environments without hosts, so that wallboards grey them out,
+	// or "green", "yellow", "red" or "unknown" by the status thresholds of the environment otherwise.
+	State string `json:"state,omitempty"`
+	// Deploying is true while the environment has a deployment in progress or settling.
+	Deploying          bool              `json:"deployInProgress,omitempty"`
+	Revision           revision.Revision `json:"latestDeployable,omitempty"`
+	SourceCodeRevision revision.Revision `json:"sourceCodeRevision,omitempty"`
+	// FetchedAt is nil if the latest deployable revision has not been fetched into the cache yet.
+	FetchedAt  *time.Time `json:"latestFetchedAt,omitempty"`
+	FetchError string     `json:"latestFetchError,omitempty"`
+	// Annotations are the active announcements pinned to the environment from the most serious one.
+	Annotations []annotation.Annotation `json:"annotations,omitempty"`
+	// HostChanges are the changes of the hosts within recentHostChanges from the newest one.
+	HostChanges []inventory.Change `json:"hostChanges,omitempty"`
+	Deployments []hostStatus       `json:"deployments"`
+}
+
+// hostStatus is a compact version of deployStatus.
+type hostStatus struct {
+	HostName           string            `json:"hostname"`
+	Revision           revision.Revision `json:"revision,omitempty"`
+	RevisionURL        string            `json:"revisionURL,omitempty"`
+	SourceCodeRevision revision.Revision `json:"sourceCodeRevision,omitempty"`
+	SourceCodeDiffURL  string            `json:"sourceCodeDiffURL,omitempty"`
+	State              string            `json:"state"`
+	// ObservedState is the state compared with the latest deployable revision if State is "deploying".
+	ObservedState string       `json:"observedState,omitempty"`
+	Drained       *drain.Drain `json:"drained,omitempty"`
+	HostKey       string       `json:"hostKey,omitempty"`
+}
+
+// recentHostChanges is how long changes of hosts are shown on the dashboard.
+const recentHostChanges = 24 * time.Hour
+
+type statusHandler struct {
+	handler
+	now func() time.Time
+	// urlControl returns a revision.Control which renders URLs of revisions of "proj".
+	urlControl func(proj config.Project, deployUser string) (revision.Control, error)
+}
+
+// NewStatus returns a new http.Handler which serves the state of all the projects at once.
+// Revisions are served only from "tips" and "deployed", which are filled by Warm and the handler returned by New,
+// so that it does not make requests to GitHub or hosts. "running" lists deployments in progress and just finished.
+// Hosts are "deploying" instead of compared with the tips while their environments are deploying, and for "settle" afterwards.
+// Ephemeral environments are left out unless "ephemeral" is true. Projects starred by the user come first,
+// and only they are served if "mine" is true.
+// i.e. http://127.0.0.1:8000/api/v1/status?ephemeral=true&mine=true
+func NewStatus(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, tips *revision.TipCache, deployed *revision.DeployedCache, running func() []running.Deploy, settle time.Duration) http.Handler {
+	h := handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys, tips: tips, deployed: deployed, running: running, settle: settle}
+	return statusHandler{handler: h, now: time.Now, urlControl: h.newControl}
+}
+
+func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("ephemeral") != "true" {
+		c.Projects = withoutEphemeral(c.Projects)
+	}
+	prefs, err := preferences.Load(h.ecl, u.Name)
+	if err != nil {
+		glog.Errorf("Failed to load preferences of %s: %v", u.Name, err)
+	}
+	c.Projects = prefs.Listing(c.Projects, r.FormValue("mine") == "true")
+	buf, err := json.Marshal(h.dashboard(c, h.loadDrains(), h.loadHostKeys(), h.loadAnnotations(), h.loadInventory(), u))
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCompressed(w, r, buf)
+}
+
+// dashboard assembles the state of the projects in "c" readable by "u" from the caches, "drains", host "keys", "notes" and host inventories.
+func (h statusHandler) dashboard(c config.Config, drains drain.Drains, keys hostkeys.HostKeys, notes annotation.Annotations, inv inventory.Inventories, u auth.User) dashboard {
+	ac := acl.ForUser(h.ac, c, u)
+	d := dashboard{Projects: []projectStatus{}}
+	readable := acl.ReadableProjects(ac, c.Projects, u)
+	settling := make(map[envKey]bool)
+	if h.running != nil {
+		ds := h.running()
+		d.Running = runningStatuses(ds, readable, h.now())
+		settling = settlingEnvironments(ds, h.settle, h.now())
+	}
+	for _, p := range readable {
+		ctl, err := h.urlControl(p, c.DeployUser)
+		if err != nil {
+			glog.Errorf("Failed to build revision control of %s: %v", p.Name, err)
+		}
+		ps := projectStatus{Name: p.Name, ConfigErrors: p.ConfigErrors, Environments: make([]envStatus, 0, len(p.Environments))}
+		for _, e := range p.Environments {
+			es := envStatus{Name: e.Name, Ephemeral: e.Ephemeral != nil, Deployments: make([]hostStatus, 0, len(e.Hosts))}
+			es.Locked, es.Comment = lockStatus(ac, p, environmentComment(e), e.IsLocked(), u)
+			es.Deploying = settling[envKey{project: p.Name, environment: e.Name}]
+			es.Annotations = notes.Of(p.Name, e.Name)
+			es.HostChanges = inv.Recent(p.Name, e.Name, h.now().Add(-recentHostChanges))
+			if tip, ok := h.tips.Peek(p, e); ok && !e.Unconfigured() {
+				es.Revision, es.SourceCodeRevision = tip.Rev, tip.SrcRev
+				if !tip.FetchedAt.IsZero() {
+					fetchedAt := tip.FetchedAt
+					es.FetchedAt = &fetchedAt
+				}
+				if tip.Err != nil {
+					es.FetchError = tip.Err.Error()
+				}
+			}
+			observed := make([]string, 0, len(e.Hosts))
+			for _, host := range e.Hosts {
+				hs := hostStatus{HostName: host.Name, HostKey: hostKeyState(keys, host.Name)}
+				if d, ok := drains.Get(p.Name, e.Name, host.Name); ok {
+					hs.Drained = &d
+				}
+				if dep, ok := h.deployed.Get(p.Name, e.Name, host.Name); ok {
+					hs.Revision, hs.SourceCodeRevision = dep.Rev, dep.SrcRev
+				}
+				if ctl != nil && hs.Revision != "" {
+					hs.RevisionURL = ctl.RevisionURL(p, hs.Revision)
+					if hs.SourceCodeRevision != "" && es.SourceCodeRevision != "" {
+						hs.SourceCodeDiffURL = ctl.SourceDiffURL(p, hs.SourceCodeRevision, es.SourceCodeRevision)
+					}
+				}
+				state := hostState(deployStatus{Revision: hs.Revision, Drained: hs.Drained}, es.Revision)
+				hs.State, hs.ObservedState = settledState(state, es.Deploying)
+				es.Deployments = append(es.Deployments, hs)
+				observed = append(observed, state)
+			}
+			es.State = environmentHealth(e, observed)
+			ps.Environments = append(ps.Environments, es)
+		}
+		d.Projects = append(d.Projects, ps)
+	}
+	return d
+}
+
+// withoutEphemeral returns copies of "projs" without ephemeral environments.
+func withoutEphemeral(projs []config.Project) []config.Project {
+	var filtered []config.Project
+	for _, p := range projs {
+		var envs []config.Environment
+		for _, e := range p.Environments {
+			if e.Ephemeral == nil {
+				envs = append(envs, e)
+			}
+		}
+		p.Environments = envs
+		filtered = append(filtered, p)
+	}
+	return filtered
+}
+
+// runningStatuses returns the deployments in "ds" of the projects in "projs" with their elapsed time at "now".
+func runningStatuses(ds []running.Deploy, projs []config.Project, now time.Time) []runningStatus {
+	readable := make(map[string]bool)
+	for _, p := range projs {
+		readable[p.Name] = true
+	}
+	var rs []runningStatus
+	for _, d := range ds {
+		if !readable[d.Project] {
+			continue
+		}
+		r := runningStatus{Deploy: d}
+		if d.FinishedAt == nil {
+			r.ElapsedSeconds = int64(now.Sub(d.StartedAt) / time.Second)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// writeCompressed sends "buf" as a JSON response tagged with its digest.
+// It responds 304 if the client already has it, and compresses it with gzip if the client accepts.
+func writeCompressed(w http.ResponseWriter, r *http.Request, buf []byte) {
+	// weak since the same tag is used for both encodings.
+	etag := fmt.Sprintf(`W/"%x"`, sha1.Sum(buf))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept-Encoding")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if _, err := w.Write(buf); err != nil {
+			glog.Errorf("Failed to send response: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// Warm fetches the revisions deployed into all the hosts into "deployed", and the latest deployable revisions of
+// all the environments into "tips", so that the handler returned by NewStatus can serve them.
+// Connections to hosts are reused across calls if "pool" is not nil.
+func Warm(ctx context.Context, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, pool *ssh.Pool, tips *revision.TipCache, deployed *revision.DeployedCache) error {
+	h := handler{ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys, pool: pool, tips: tips, deployed: deployed}
+	c, err := config.Load(ecl)
+	if err != nil {
+		return err
+	}
+	for _, p := range c.Projects {
+		if _, err := h.retrieveCommits(ctx, p, c.DeployUser, nil); err != nil {
+			glog.Errorf("Failed to retrieve commits of %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
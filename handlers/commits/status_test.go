@@ -0,0 +1,411 @@
+package commits
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/etcdtest"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/preferences"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/running"
+	"golang.org/x/net/context"
+)
+
+// countingControl is a revision.Control which counts upstream calls.
+type countingControl struct {
+	revision.Control
+	calls *int
+}
+
+func (c countingControl) Latest(ctx context.Context, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	*c.calls++
+	return "tip", "tip", nil
+}
+
+func (c countingControl) LatestDeployed(ctx context.Context, hostname string, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	*c.calls++
+	return "old", "old", nil
+}
+
+func (c countingControl) SourceRevMessage(ctx context.Context, p config.Project, rev revision.Revision) (string, error) {
+	*c.calls++
+	return "Commit message", nil
+}
+
+func (c countingControl) RevisionURL(p config.Project, rev revision.Revision) string {
+	return "https://github.com/gengo/goship/commit/" + string(rev)
+}
+
+func (c countingControl) SourceDiffURL(p config.Project, from, to revision.Revision) string {
+	if from == to {
+		return ""
+	}
+	return "https://github.com/gengo/goship/compare/" + string(from) + "..." + string(to)
+}
+
+func TestStatusDashboard(t *testing.T) {
+	proj := config.Project{
+		Name: "goship",
+		Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"},
+		Environments: []config.Environment{
+			{Name: "staging", Branch: "master", Hosts: []config.Host{{Name: "stg1"}, {Name: "stg2"}}},
+			{Name: "production", Branch: "release", Comment: "release day", Lock: &config.EnvironmentLock{By: "alice"}, Hosts: []config.Host{{Name: "prod1"}}},
+			{Name: "qa", Branch: "qa", Hosts: []config.Host{{Name: "qa1"}}},
+			{Name: "canary", Branch: "master"},
+		},
+	}
+	c := config.Config{Projects: []config.Project{proj}}
+
+	var warmCalls int
+	tips := revision.NewTipCache(time.Hour)
+	tips.Refresh(context.Background(), countingControl{calls: &warmCalls}, proj, proj.Environments[0])
+	tips.Refresh(context.Background(), failingLatest{countingControl{calls: &warmCalls}}, proj, proj.Environments[1])
+	deployed := revision.NewDeployedCache()
+	deployed.Put("goship", "staging", "stg1", "tip", "tip", nil)
+	deployed.Put("goship", "staging", "stg2", "old", "old", nil)
+	deployed.Put("goship", "production", "prod1", "", "", errors.New("unreachable"))
+
+	var calls int
+	started := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(-time.Minute)
+	deploys := []running.Deploy{
+		{ID: "goship-qa-1", Project: "goship", Environment: "qa", User: "bob", StartedAt: started.Add(-2 * time.Minute), FinishedAt: &finished},
+		{ID: "goship-staging-1", Project: "goship", Environment: "staging", User: "alice", From: "old", To: "tip", StartedAt: started, LogURL: "/output/goship-staging/1"},
+		{ID: "secret-prod-1", Project: "secret", Environment: "prod", User: "carol", StartedAt: started},
+	}
+	h := statusHandler{
+		handler:    handler{ac: acl.Null, tips: tips, deployed: deployed, running: func() []running.Deploy { return deploys }},
+		now:        func() time.Time { return started.Add(90 * time.Second) },
+		urlControl: func(config.Project, string) (revision.Control, error) { return countingControl{calls: &calls}, nil },
+	}
+	drains := drain.Drains{"goship/staging/stg2": {By: "bob", Since: started}}
+	keys := hostkeys.HostKeys{
+		"stg1":  {Host: "stg1", State: hostkeys.StateTrusted},
+		"prod1": {Host: "prod1", State: hostkeys.StateBlocked},
+	}
+	got := h.dashboard(c, drains, keys, nil, nil, auth.User{Name: "alice"})
+	if calls != 0 {
+		t.Errorf("h.dashboard(c, drains, u) made %d upstream calls; want 0", calls)
+	}
+
+	buf, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("json.Marshal(%#v) failed with %v", got, err)
+	}
+	var payload interface{}
+	if err := json.Unmarshal(buf, &payload); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed with %v", buf, err)
+	}
+	var want interface{}
+	wantJSON := `{
+		"projects": [{
+			"name": "goship",
+			"environments": [
+				{
+					"name": "staging",
+					"latestDeployable": "tip",
+					"sourceCodeRevision": "tip",
+					"latestFetchedAt": "` + mustFetchedAt(t, tips, proj, proj.Environments[0]) + `",
+					"state": "green",
+					"deployInProgress": true,
+					"deployments": [
+						{"hostname": "stg1", "revision": "tip", "revisionURL": "https://github.com/gengo/goship/commit/tip", "sourceCodeRevision": "tip", "state": "deploying", "observedState": "on_tip"},
+						{"hostname": "stg2", "revision": "old", "revisionURL": "https://github.com/gengo/goship/commit/old", "sourceCodeRevision": "old", "sourceCodeDiffURL": "https://github.com/gengo/goship/compare/old...tip", "state": "drained", "drained": {"by": "bob", "since": "2015-10-01T12:00:00Z"}}
+					]
+				},
+				{
+					"name": "production",
+					"comment": "release day | repo is locked.",
+					"isLocked": true,
+					"state": "unknown",
+					"latestFetchError": "GitHub is down",
+					"deployments": [{"hostname": "prod1", "state": "unknown", "hostKey": "blocked"}]
+				},
+				{
+					"name": "qa",
+					"state": "unknown",
+					"deployments": [{"hostname": "qa1", "state": "unknown"}]
+				},
+				{
+					"name": "canary",
+					"state": "unconfigured",
+					"deployments": []
+				}
+			]
+		}],
+		"running": [
+			{"id": "goship-qa-1", "project": "goship", "environment": "qa", "user": "bob", "startedAt": "2015-10-01T11:58:00Z", "finishedAt": "2015-10-01T11:59:00Z"},
+			{"id": "goship-staging-1", "project": "goship", "environment": "staging", "user": "alice", "from": "old", "to": "tip", "startedAt": "2015-10-01T12:00:00Z", "logURL": "/output/goship-staging/1", "elapsedSeconds": 90}
+		]
+	}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatalf("json.Unmarshal(wantJSON) failed with %v", err)
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("h.dashboard(c, drains, u) = %s; want %s", buf, wantJSON)
+	}
+}
+
+func TestStatusSettling(t *testing.T) {
+	proj := config.Project{
+		Name:         "goship",
+		Environments: []config.Environment{{Name: "production", Branch: "master", Hosts: []config.Host{{Name: "prod1"}, {Name: "prod2"}}}},
+	}
+	c := config.Config{Projects: []config.Project{proj}}
+	var calls int
+	tips := revision.NewTipCache(time.Hour)
+	tips.Refresh(context.Background(), countingControl{calls: &calls}, proj, proj.Environments[0])
+	// polled in the middle of the deployment
+	deployed := revision.NewDeployedCache()
+	deployed.Put("goship", "production", "prod1", "tip", "tip", nil)
+	deployed.Put("goship", "production", "prod2", "old", "old", nil)
+
+	started := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := started.Add(30 * time.Second)
+	d := running.Deploy{ID: "goship-production-1", Project: "goship", Environment: "production", StartedAt: started}
+	h := statusHandler{
+		handler:    handler{ac: acl.Null, tips: tips, deployed: deployed, running: func() []running.Deploy { return []running.Deploy{d} }, settle: 2 * time.Minute},
+		now:        func() time.Time { return now },
+		urlControl: func(config.Project, string) (revision.Control, error) { return countingControl{calls: &calls}, nil },
+	}
+	finished := started.Add(time.Minute)
+	for _, spec := range []struct {
+		desc       string
+		finishedAt *time.Time
+		now        time.Time
+		deploying  bool
+		states     []string
+		observed   []string
+	}{
+		{desc: "in progress", now: now, deploying: true, states: []string{stateDeploying, stateDeploying}, observed: []string{stateOnTip, stateBehind}},
+		{desc: "settling", finishedAt: &finished, now: finished.Add(time.Minute), deploying: true, states: []string{stateDeploying, stateDeploying}, observed: []string{stateOnTip, stateBehind}},
+		{desc: "settled", finishedAt: &finished, now: finished.Add(2 * time.Minute), states: []string{stateOnTip, stateBehind}, observed: []string{"", ""}},
+	} {
+		d.FinishedAt, now = spec.finishedAt, spec.now
+		es := h.dashboard(c, nil, nil, nil, nil, auth.User{Name: "alice"}).Projects[0].Environments[0]
+		if es.Deploying != spec.deploying {
+			t.Errorf("es.Deploying = %v when %s; want %v", es.Deploying, spec.desc, spec.deploying)
+		}
+		var states, observed, revs []string
+		for _, hs := range es.Deployments {
+			states, observed, revs = append(states, hs.State), append(observed, hs.ObservedState), append(revs, string(hs.Revision))
+		}
+		if !reflect.DeepEqual(states, spec.states) || !reflect.DeepEqual(observed, spec.observed) {
+			t.Errorf("states = %q observed as %q when %s; want %q observed as %q", states, observed, spec.desc, spec.states, spec.observed)
+		}
+		// raw revisions are kept for debugging.
+		if want := []string{"tip", "old"}; !reflect.DeepEqual(revs, want) {
+			t.Errorf("revisions = %q when %s; want %q", revs, spec.desc, want)
+		}
+	}
+}
+
+func TestSettlingEnvironments(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	recent, old := now.Add(-time.Minute), now.Add(-5*time.Minute)
+	ds := []running.Deploy{
+		{Project: "api", Environment: "staging", StartedAt: now},
+		{Project: "api", Environment: "production", StartedAt: recent, FinishedAt: &recent},
+		{Project: "web", Environment: "production", StartedAt: old, FinishedAt: &old},
+	}
+	got := settlingEnvironments(ds, 2*time.Minute, now)
+	want := map[envKey]bool{{project: "api", environment: "staging"}: true, {project: "api", environment: "production"}: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("settlingEnvironments(ds, 2m, now) = %v; want %v", got, want)
+	}
+	// without the settle period, only deployments in progress suppress drifts.
+	got = settlingEnvironments(ds, 0, now)
+	want = map[envKey]bool{{project: "api", environment: "staging"}: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("settlingEnvironments(ds, 0, now) = %v; want %v", got, want)
+	}
+}
+
+// failingLatest is a revision.Control which fails to fetch the latest revision.
+type failingLatest struct {
+	countingControl
+}
+
+func (c failingLatest) Latest(ctx context.Context, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	return "", "", errors.New("GitHub is down")
+}
+
+func mustFetchedAt(t *testing.T, tips *revision.TipCache, proj config.Project, env config.Environment) string {
+	tip, ok := tips.Peek(proj, env)
+	if !ok {
+		t.Fatalf("tips.Peek(proj, %q) = _, false; want true", env.Name)
+	}
+	buf, err := tip.FetchedAt.MarshalJSON()
+	if err != nil {
+		t.Fatalf("tip.FetchedAt.MarshalJSON() failed with %v", err)
+	}
+	return string(bytes.Trim(buf, `"`))
+}
+
+func TestWriteCompressed(t *testing.T) {
+	body := []byte(`{"projects":[]}`)
+
+	req, _ := http.NewRequest("GET", "http://goship.example/api/v1/status", nil)
+	w := httptest.NewRecorder()
+	writeCompressed(w, req, body)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("ETag is not set")
+	}
+	if got := w.Body.String(); got != string(body) || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("body = %q with Content-Encoding %q; want %q without encoding", got, w.Header().Get("Content-Encoding"), body)
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w = httptest.NewRecorder()
+	writeCompressed(w, req, body)
+	if got, want := w.Header().Get("Content-Encoding"), "gzip"; got != want {
+		t.Errorf("Content-Encoding = %q; want %q", got, want)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag = %q with gzip; want %q", got, etag)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(w.Body) failed with %v", err)
+	}
+	if got, err := ioutil.ReadAll(gz); err != nil || string(got) != string(body) {
+		t.Errorf("decompressed body = %q, %v; want %q", got, err, body)
+	}
+
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	writeCompressed(w, req, body)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("w.Code = %d with %d bytes; want %d without body", w.Code, w.Body.Len(), http.StatusNotModified)
+	}
+
+	w = httptest.NewRecorder()
+	writeCompressed(w, req, []byte(`{"projects":[{"name":"goship"}]}`))
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d for changed body; want %d", w.Code, http.StatusOK)
+	}
+}
+
+// TestStatusMine makes sure that the API lists projects like the home screen, with the favorites of the user first
+// and only them with "mine=true".
+func TestStatusMine(t *testing.T) {
+	auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+	s := etcdtest.NewStore()
+	cfg := config.Config{Projects: []config.Project{
+		{Name: "api", Environments: []config.Environment{{Name: "production", Branch: "master", Deploy: "/bin/true"}}},
+		{Name: "db", Environments: []config.Environment{{Name: "production", Branch: "master", Deploy: "/bin/true"}}},
+		{Name: "worker", Environments: []config.Environment{{Name: "production", Branch: "master", Deploy: "/bin/true"}}},
+	}}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	if err := preferences.Save(s, "alice", preferences.Preferences{Favorites: []string{"worker", "db"}}); err != nil {
+		t.Fatalf("preferences.Save(s, %q, ...) failed with %v", "alice", err)
+	}
+	srv := etcdtest.NewServer(s)
+	defer srv.Close()
+	h := statusHandler{
+		handler:    handler{ac: acl.Null, ecl: etcd.NewClient([]string{srv.URL}), tips: revision.NewTipCache(0), deployed: revision.NewDeployedCache()},
+		now:        time.Now,
+		urlControl: func(config.Project, string) (revision.Control, error) { return countingControl{}, nil },
+	}
+	for _, spec := range []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"db", "worker", "api"}},
+		{query: "?mine=true", want: []string{"db", "worker"}},
+	} {
+		r, err := http.NewRequest("GET", "http://goship.example/api/v1/status"+spec.query, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(...) failed with %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET /api/v1/status%s = %d %s; want %d", spec.query, w.Code, w.Body.String(), http.StatusOK)
+			continue
+		}
+		var d dashboard
+		if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+			t.Errorf("json.Unmarshal(%q, &d) failed with %v", w.Body.String(), err)
+			continue
+		}
+		var got []string
+		for _, p := range d.Projects {
+			got = append(got, p.Name)
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("projects of GET /api/v1/status%s = %q; want %q", spec.query, got, spec.want)
+		}
+	}
+}
+
+func TestWithoutEphemeral(t *testing.T) {
+	projs := []config.Project{
+		{
+			Name: "goship",
+			Environments: []config.Environment{
+				{Name: "staging"},
+				{Name: "review_login", Ephemeral: &config.Ephemeral{Branch: "review/login"}},
+			},
+		},
+	}
+	got := withoutEphemeral(projs)
+	if len(got) != 1 || len(got[0].Environments) != 1 || got[0].Environments[0].Name != "staging" {
+		t.Errorf("withoutEphemeral(projs) = %#v; want only staging", got)
+	}
+	if len(projs[0].Environments) != 2 {
+		t.Errorf("withoutEphemeral(projs) modified projs: %#v", projs)
+	}
+}
+
+func TestEnvironmentHealth(t *testing.T) {
+	// states returns the observed states of hosts by the numbers of hosts in each state.
+	states := func(counts map[string]int) []string {
+		var ss []string
+		for s, n := range counts {
+			for i := 0; i < n; i++ {
+				ss = append(ss, s)
+			}
+		}
+		return ss
+	}
+	configured := config.Environment{Name: "production", Hosts: []config.Host{{Name: "prod1"}}}
+	behind := configured
+	behind.StatusThresholds = &config.StatusThresholds{Unknown: config.UnknownHostsBehind}
+	for _, spec := range []struct {
+		e        config.Environment
+		observed []string
+		want     string
+	}{
+		{e: configured, observed: states(map[string]int{stateOnTip: 60}), want: config.HealthGreen},
+		{e: configured, observed: states(map[string]int{stateOnTip: 59, stateBehind: 1}), want: config.HealthYellow},
+		{e: configured, observed: states(map[string]int{stateOnTip: 30, stateBehind: 30}), want: config.HealthRed},
+		// drained hosts are not counted.
+		{e: configured, observed: states(map[string]int{stateOnTip: 59, stateDrained: 1}), want: config.HealthGreen},
+		{e: configured, observed: states(map[string]int{stateOnTip: 58, stateUnknown: 2}), want: config.HealthGreen},
+		{e: behind, observed: states(map[string]int{stateOnTip: 58, stateUnknown: 2}), want: config.HealthYellow},
+		{e: behind, observed: states(map[string]int{stateUnknown: 60}), want: config.HealthUnknown},
+		{e: config.Environment{Name: "canary"}, want: stateUnconfigured},
+	} {
+		if got := environmentHealth(spec.e, spec.observed); got != spec.want {
+			t.Errorf("environmentHealth(%#v, %q) = %q; want %q", spec.e.StatusThresholds, spec.observed, got, spec.want)
+		}
+	}
+}
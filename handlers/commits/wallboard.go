@@ -0,0 +1,234 @@
+package commits
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/gengo/goship/lib/tokens"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+	"github.com/golang/glog"
+)
+
+const (
+	// wallboardPushInterval is how often the wallboard stream checks for changes of the state.
+	wallboardPushInterval = 5 * time.Second
+	// defaultWallboardInterval is how long the wallboard shows each project by default.
+	defaultWallboardInterval = 15 * time.Second
+	// minWallboardInterval and maxWallboardInterval bound the "interval" of the wallboard.
+	minWallboardInterval = 5 * time.Second
+	maxWallboardInterval = 10 * time.Minute
+)
+
+// wallboardHandler serves the state of the projects shared by share tokens to wallboards.
+type wallboardHandler struct {
+	statusHandler
+}
+
+// NewWallboardStatus returns an http.Handler which serves the state of projects like NewStatus to wallboards.
+// It is authenticated by a share token in "token" rather than a session, and serves only the projects shared by the token
+// and readable by its owner, selected by the comma-separated "projects" if given. Ephemeral environments are left out.
+// i.e. http://127.0.0.1:8000/api/v1/wallboard/status?token=goship_0123456789abcdef_...&projects=api,web
+func NewWallboardStatus(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, tips *revision.TipCache, deployed *revision.DeployedCache, running func() []running.Deploy, settle time.Duration) http.Handler {
+	return newWallboardHandler(ac, ecl, gcl, dcl, sshKeyPath, hostKeys, tips, deployed, running, settle)
+}
+
+func newWallboardHandler(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, tips *revision.TipCache, deployed *revision.DeployedCache, running func() []running.Deploy, settle time.Duration) wallboardHandler {
+	h := handler{ac: ac, ecl: ecl, gcl: gcl, dcl: dcl, sshKeyPath: sshKeyPath, hostKeys: hostKeys, tips: tips, deployed: deployed, running: running, settle: settle}
+	return wallboardHandler{statusHandler: statusHandler{handler: h, now: time.Now, urlControl: h.newControl}}
+}
+
+func (h wallboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buf, code, err := h.sharedDashboard(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	writeCompressed(w, r, buf)
+}
+
+// sharedDashboard returns the JSON of the dashboard of the projects shared by the token in "r".
+// It returns an error with the status code to respond if the token is invalid or does not share the projects.
+func (h wallboardHandler) sharedDashboard(r *http.Request) ([]byte, int, error) {
+	t, err := tokens.VerifyShare(h.ecl, r.FormValue("token"), h.now())
+	if err != nil {
+		glog.Errorf("Failed to verify share token: %v", err)
+		return nil, http.StatusUnauthorized, err
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return nil, http.StatusInternalServerError, err
+	}
+	if c.Projects, err = sharedProjects(withoutEphemeral(c.Projects), t, r.FormValue("projects")); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	buf, err := json.Marshal(h.dashboard(c, h.loadDrains(), h.loadHostKeys(), h.loadAnnotations(), h.loadInventory(), t.Owner()))
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		return nil, http.StatusInternalServerError, err
+	}
+	return buf, http.StatusOK, nil
+}
+
+// sharedProjects returns the projects in "projs" shared by "t", selected by the comma-separated names in "requested" if not empty.
+// It returns an error if any of the requested projects is not shared. Projects which no longer exist are left out.
+func sharedProjects(projs []config.Project, t tokens.Token, requested string) ([]config.Project, error) {
+	selected := make(map[string]bool)
+	if requested == "" {
+		for _, name := range t.Projects {
+			selected[name] = true
+		}
+	}
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !t.Shares(name) {
+			return nil, fmt.Errorf("token %s does not share %s", t.ID, name)
+		}
+		selected[name] = true
+	}
+	var shared []config.Project
+	for _, p := range projs {
+		if selected[p.Name] {
+			shared = append(shared, p)
+		}
+	}
+	return shared, nil
+}
+
+type wallboardStream struct {
+	wallboardHandler
+}
+
+// NewWallboardStream returns an http.Handler which sends the state served by NewWallboardStatus as server-sent "status" events.
+// It sends the state at first and whenever it changes, and ends the stream once the token is revoked or expires.
+// i.e. http://127.0.0.1:8000/api/v1/wallboard/stream?token=goship_0123456789abcdef_...&projects=api,web
+func NewWallboardStream(ac acl.AccessControl, ecl *etcd.Client, gcl githublib.Client, dcl *docker.Client, sshKeyPath string, hostKeys ssh.HostKeyChecker, tips *revision.TipCache, deployed *revision.DeployedCache, running func() []running.Deploy, settle time.Duration) http.Handler {
+	return wallboardStream{newWallboardHandler(ac, ecl, gcl, dcl, sshKeyPath, hostKeys, tips, deployed, running, settle)}
+}
+
+func (h wallboardStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	buf, code, err := h.sharedDashboard(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	ticker := time.NewTicker(wallboardPushInterval)
+	defer ticker.Stop()
+	var last string
+	for {
+		if s := string(buf); s != last {
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", buf); err != nil {
+				glog.Errorf("Failed to send wallboard status: %v", err)
+				return
+			}
+			flusher.Flush()
+			last = s
+		}
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		if buf, _, err = h.sharedDashboard(r); err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+type wallboardPage struct {
+	assets helpers.Assets
+	ecl    *etcd.Client
+	now    func() time.Time
+}
+
+// NewWallboardPage returns an http.Handler which renders the full-screen wallboard of the projects shared by a share token.
+// It rotates the projects every "interval", which defaults to 15 seconds.
+// i.e. http://127.0.0.1:8000/wallboard?token=goship_0123456789abcdef_...&projects=api,web&interval=15s
+func NewWallboardPage(assets helpers.Assets, ecl *etcd.Client) http.Handler {
+	return wallboardPage{assets: assets, ecl: ecl, now: time.Now}
+}
+
+func (h wallboardPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	t, err := tokens.VerifyShare(h.ecl, token, h.now())
+	if err != nil {
+		glog.Errorf("Failed to verify share token: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	interval, err := wallboardInterval(r.FormValue("interval"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	projects := r.FormValue("projects")
+	if _, err := sharedProjects(nil, t, projects); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	tmpl, err := h.assets.Page("wallboard.html", nil)
+	if err != nil {
+		glog.Errorf("Failed to parse templates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params := map[string]interface{}{
+		"Token":          token,
+		"Projects":       projects,
+		"IntervalMillis": int64(interval / time.Millisecond),
+	}
+	helpers.RespondWithTemplate(w, "text/html", tmpl, "wallboard", params)
+}
+
+// wallboardInterval parses "s" as the interval of the rotation of the wallboard. It returns the default if "s" is empty.
+func wallboardInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultWallboardInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q: %v", s, err)
+	}
+	if d < minWallboardInterval || d > maxWallboardInterval {
+		return 0, fmt.Errorf("interval must be between %s and %s", minWallboardInterval, maxWallboardInterval)
+	}
+	return d, nil
+}
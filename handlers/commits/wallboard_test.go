@@ -0,0 +1,122 @@
+package commits
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/tokens"
+)
+
+func projectNames(projs []config.Project) []string {
+	var names []string
+	for _, p := range projs {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestSharedProjects(t *testing.T) {
+	projs := []config.Project{{Name: "api"}, {Name: "web"}, {Name: "secret"}}
+	share := tokens.Token{ID: "0123", Scopes: []string{tokens.ScopeShare}, Projects: []string{"api", "web", "removed"}}
+	for _, spec := range []struct {
+		token     tokens.Token
+		requested string
+		want      []string
+		wantErr   bool
+	}{
+		{token: share, want: []string{"api", "web"}},
+		{token: share, requested: "web", want: []string{"web"}},
+		{token: share, requested: " web , api,", want: []string{"api", "web"}},
+		{token: share, requested: "removed"},
+		{token: share, requested: "api,secret", wantErr: true},
+		// only share tokens share projects.
+		{token: tokens.Token{ID: "4567", Scopes: []string{tokens.ScopeRead}, Projects: []string{"api"}}, requested: "api", wantErr: true},
+	} {
+		got, err := sharedProjects(projs, spec.token, spec.requested)
+		if spec.wantErr {
+			if err == nil {
+				t.Errorf("sharedProjects(projs, %#v, %q) = %q; want an error", spec.token, spec.requested, projectNames(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sharedProjects(projs, %#v, %q) failed with %v", spec.token, spec.requested, err)
+			continue
+		}
+		if names := projectNames(got); !reflect.DeepEqual(names, spec.want) {
+			t.Errorf("sharedProjects(projs, %#v, %q) = %q; want %q", spec.token, spec.requested, names, spec.want)
+		}
+	}
+}
+
+func TestWallboardDashboard(t *testing.T) {
+	c := config.Config{Projects: []config.Project{
+		{Name: "api", Environments: []config.Environment{{Name: "production", Branch: "master", Hosts: []config.Host{{Name: "api1"}}}}},
+		{Name: "secret", Environments: []config.Environment{{Name: "production", Branch: "master", Hosts: []config.Host{{Name: "secret1"}}}}},
+	}}
+	share := tokens.Token{ID: "0123", User: "alice", Scopes: []string{tokens.ScopeShare}, Projects: []string{"api"}}
+	projs, err := sharedProjects(c.Projects, share, "")
+	if err != nil {
+		t.Fatalf("sharedProjects(projs, share, %q) failed with %v", "", err)
+	}
+	c.Projects = projs
+
+	started := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	deploys := []running.Deploy{
+		{ID: "api-production-1", Project: "api", Environment: "production", User: "bob", StartedAt: started},
+		{ID: "secret-production-1", Project: "secret", Environment: "production", User: "carol", StartedAt: started},
+	}
+	var calls int
+	h := statusHandler{
+		handler:    handler{ac: acl.Null, tips: revision.NewTipCache(time.Hour), deployed: revision.NewDeployedCache(), running: func() []running.Deploy { return deploys }},
+		now:        func() time.Time { return started.Add(time.Minute) },
+		urlControl: func(config.Project, string) (revision.Control, error) { return countingControl{calls: &calls}, nil },
+	}
+	d := h.dashboard(c, nil, nil, nil, nil, share.Owner())
+	var names []string
+	for _, p := range d.Projects {
+		names = append(names, p.Name)
+	}
+	if want := []string{"api"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("projects = %q; want %q", names, want)
+	}
+	var ids []string
+	for _, r := range d.Running {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{"api-production-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("running deployments = %q; want %q", ids, want)
+	}
+}
+
+func TestWallboardInterval(t *testing.T) {
+	for _, spec := range []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "", want: 15 * time.Second},
+		{s: "30s", want: 30 * time.Second},
+		{s: "5s", want: 5 * time.Second},
+		{s: "10m", want: 10 * time.Minute},
+		{s: "1s", wantErr: true},
+		{s: "1h", wantErr: true},
+		{s: "15", wantErr: true},
+	} {
+		got, err := wallboardInterval(spec.s)
+		if spec.wantErr {
+			if err == nil {
+				t.Errorf("wallboardInterval(%q) = %s; want an error", spec.s, got)
+			}
+			continue
+		}
+		if err != nil || got != spec.want {
+			t.Errorf("wallboardInterval(%q) = %s, %v; want %s", spec.s, got, err, spec.want)
+		}
+	}
+}
@@ -1,38 +1,25 @@
 package deploypage
 
 import (
-	"fmt"
-	"html/template"
 	"net/http"
 	"net/url"
 
 	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/i18n"
 	helpers "github.com/gengo/goship/lib/view-helpers"
 	"github.com/golang/glog"
 )
 
 // New return an http handler which renders deploy page.
-// "pushAddr" is an absolute URL to the websocket endpoint of push notification.
-//
-// pushAddr is defined for backward compatibility
-// TODO(yugui) is it really a right way to solve that?  Is it safe for reverse-proxy or some bind addresses?
-func New(assets helpers.Assets, pushAddr string) (http.Handler, error) {
-	addr, err := url.Parse(pushAddr)
-	if err != nil {
-		return nil, err
-	}
-	if !addr.IsAbs() {
-		return nil, fmt.Errorf("not an absolute URL: %s", pushAddr)
-	}
-	if addr.Scheme != "ws" {
-		return nil, fmt.Errorf("not a websocket URL: %s", pushAddr)
-	}
-	return deployPage{assets: assets, pushAddr: addr}, nil
+// "pushAddr" returns the websocket URL of push notification as seen by the client of a request,
+// so that the page connects to it through reverse proxies.
+func New(assets helpers.Assets, pushAddr func(r *http.Request) *url.URL) http.Handler {
+	return deployPage{assets: assets, pushAddr: pushAddr}
 }
 
 type deployPage struct {
 	assets   helpers.Assets
-	pushAddr *url.URL
+	pushAddr func(r *http.Request) *url.URL
 }
 
 func (h deployPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,6 +29,12 @@ func (h deployPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	p := r.FormValue("project")
 	env := r.FormValue("environment")
 	fromRevision := r.FormValue("from_revision")
@@ -49,7 +42,13 @@ func (h deployPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	repoOwner := r.FormValue("repo_owner")
 	repoName := r.FormValue("repo_name")
 	timestamp := r.FormValue("timestamp")
-	t, err := template.New("deploy.html").ParseFiles("templates/deploy.html", "templates/base.html")
+	withDependencies := r.FormValue("with_dependencies") == "true"
+	branch := r.FormValue("branch")
+	persist := r.FormValue("persist") == "true"
+	flags := r.FormValue("flags")
+	note := r.FormValue("note")
+	confirm := r.FormValue("confirm")
+	t, err := h.assets.Page("deploy.html", i18n.FromRequest(w, r).Funcs())
 	if err != nil {
 		glog.Errorf("Failed to parse templates: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -58,17 +57,24 @@ func (h deployPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	js, css := h.assets.Templates()
 
 	params := map[string]interface{}{
-		"Javascript":   js,
-		"Stylesheet":   css,
-		"Project":      p,
-		"Env":          env,
-		"User":         user,
-		"PushAddress":  h.pushAddr,
-		"RepoOwner":    repoOwner,
-		"RepoName":     repoName,
-		"ToRevision":   toRevision,
-		"FromRevision": fromRevision,
-		"Timestamp":    timestamp,
+		"Javascript":       js,
+		"Stylesheet":       css,
+		"Project":          p,
+		"Env":              env,
+		"CSRFToken":        token,
+		"User":             user,
+		"PushAddress":      h.pushAddr(r),
+		"RepoOwner":        repoOwner,
+		"RepoName":         repoName,
+		"ToRevision":       toRevision,
+		"FromRevision":     fromRevision,
+		"Timestamp":        timestamp,
+		"WithDependencies": withDependencies,
+		"Branch":           branch,
+		"Persist":          persist,
+		"Flags":            flags,
+		"Note":             note,
+		"Confirm":          confirm,
 	}
 	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
 }
@@ -0,0 +1,41 @@
+package healthz
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gengo/goship/lib/leader"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	elector *leader.Elector
+}
+
+// New returns an http.Handler which reports liveness of this instance and whether it is the leader.
+// i.e. http://127.0.0.1:8000/healthz
+func New(elector *leader.Elector) http.Handler {
+	return handler{elector: elector}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := struct {
+		Status   string `json:"status"`
+		Instance string `json:"instance"`
+		Leader   bool   `json:"leader"`
+	}{
+		Status:   "ok",
+		Instance: h.elector.ID(),
+		Leader:   h.elector.IsLeader(),
+	}
+	buf, err := json.Marshal(status)
+	if err != nil {
+		glog.Errorf("Failed to marshal health status: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
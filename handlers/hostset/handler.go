@@ -0,0 +1,124 @@
+package hostset
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostset"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+	hs  hostset.Set
+}
+
+// New returns an http.Handler which marks a host as a member of "hs", or clears the mark, e.g. drains a host.
+// POST marks the host until DELETE, or for the duration in "ttl" if specified. It takes "reason" if the set requires reasons.
+// Only users who can deploy the project can mark its hosts.
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/environments/production/hosts/web1/lock?reason=investigating&ttl=2h
+func New(ac acl.AccessControl, ecl *etcd.Client, hs hostset.Set) http.Handler {
+	return handler{ac: ac, ecl: ecl, hs: hs}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 10 || components[4] == "" || components[5] != "environments" || components[6] == "" ||
+		components[7] != "hosts" || components[8] == "" || components[9] != h.hs.Verb {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" && r.Method != "DELETE" {
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName, hostName := components[4], components[6], components[8]
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	p, env, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	if !hasHost(*env, hostName) {
+		http.Error(w, "no such host", http.StatusNotFound)
+		return
+	}
+	repo := p.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if err := h.hs.Remove(h.ecl, projName, envName, hostName); err != nil {
+			glog.Errorf("Failed to %s %s in %s-%s: %v", h.hs.Undo, hostName, projName, envName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("%s %sed %s in %s-%s", u.Name, h.hs.Undo, hostName, projName, envName)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var ttl time.Duration
+	if s := r.FormValue("ttl"); s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			http.Error(w, "ttl: must be a positive duration, e.g. 2h", http.StatusBadRequest)
+			return
+		}
+	}
+	var reason string
+	if h.hs.RequireReason {
+		if reason = strings.TrimSpace(r.FormValue("reason")); reason == "" {
+			http.Error(w, "reason: must not be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	m, err := h.hs.Add(h.ecl, projName, envName, hostName, u.Name, reason, ttl, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to %s %s in %s-%s: %v", h.hs.Verb, hostName, projName, envName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s %sed %s in %s-%s for %s: %s", u.Name, h.hs.Verb, hostName, projName, envName, ttl, reason)
+	buf, err := json.Marshal(m)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+func hasHost(env config.Environment, name string) bool {
+	for _, h := range env.Hosts {
+		if h.Name == name {
+			return true
+		}
+	}
+	return false
+}
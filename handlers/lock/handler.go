@@ -1,41 +1,80 @@
 package lock
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/proxy"
 	"github.com/golang/glog"
 )
 
 // http://127.0.0.1:8000/lock?environment=staging&project=admin
-func NewLock(ecl *etcd.Client) http.Handler {
+// Locks are recorded into "feed". Only users who can deploy the project can lock its environments.
+func NewLock(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handler(ecl, w, r, true)
+		handler(ac, ecl, feed, w, r, true)
 	})
 }
 
-func NewUnlock(ecl *etcd.Client) http.Handler {
+func NewUnlock(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handler(ecl, w, r, false)
+		handler(ac, ecl, feed, w, r, false)
 	})
 }
 
 // handler allows you to lock or unlock an environment
-func handler(ecl *etcd.Client, w http.ResponseWriter, r *http.Request, lock bool) {
+func handler(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed, w http.ResponseWriter, r *http.Request, lock bool) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
 	p := r.FormValue("project")
 	env := r.FormValue("environment")
+	c, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac = acl.ForUser(ac, c, u)
+	proj, _, err := acl.ResolveTarget(ac, c.Projects, u, p, env)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
 
-	lockStr := "false"
+	var l *config.EnvironmentLock
 	if lock {
-		lockStr = "true"
+		l = &config.EnvironmentLock{By: u.Name, Since: time.Now()}
+	}
+	err = config.LockEnvironment(ecl, p, env, l)
+	if err == nil && !lock {
+		// locks after failed deployments are released only by users.
+		err = config.ClearAutoLock(ecl, p, env)
 	}
-	err := config.LockEnvironment(ecl, p, env, lockStr)
 	if err != nil {
 		glog.Errorf("Failed to lock/unlock project=%s env=%s: %v", p, env, err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), config.StatusCode(err))
 		return
 	}
+	e := activity.Entry{Type: activity.Unlocked, Project: p, Environment: env, User: u.Name, Summary: fmt.Sprintf("%s unlocked %s-%s", u.Name, p, env)}
+	if lock {
+		e.Type, e.Summary = activity.Locked, fmt.Sprintf("%s locked %s-%s", u.Name, p, env)
+	}
+	feed.Record(e)
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, proxy.Path("/"), http.StatusSeeOther)
 }
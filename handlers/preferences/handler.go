@@ -0,0 +1,65 @@
+package preferences
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/preferences"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which reads or updates preferences of the current user.
+// i.e. GET or PUT http://127.0.0.1:8000/api/v1/me/preferences
+func New(ecl *etcd.Client) http.Handler {
+	return handler{ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var p preferences.Preferences
+	switch r.Method {
+	case "GET":
+		if p, err = preferences.Load(h.ecl, u.Name); err != nil {
+			glog.Errorf("Failed to load preferences of %s: %v", u.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := preferences.Save(h.ecl, u.Name, p); err != nil {
+			glog.Errorf("Failed to store preferences of %s: %v", u.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		glog.Errorf("Failed to marshal preferences: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
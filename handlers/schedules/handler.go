@@ -0,0 +1,87 @@
+package schedules
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/schedule"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which skips the next run of a schedule of an environment, or cancels the skip.
+// POST skips the next run and DELETE runs it again. Only users who can deploy the project can skip its schedules.
+// i.e. POST http://127.0.0.1:8000/api/v1/projects/my-project/environments/staging/schedules/0/skip
+func New(ac acl.AccessControl, ecl *etcd.Client) http.Handler {
+	return handler{ac: ac, ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 10 || components[4] == "" || components[5] != "environments" || components[6] == "" ||
+		components[7] != "schedules" || components[9] != "skip" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" && r.Method != "DELETE" {
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+	index, err := strconv.Atoi(components[8])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	p, env, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	if index < 0 || index >= len(env.Schedules) {
+		http.Error(w, "no such schedule", http.StatusNotFound)
+		return
+	}
+	repo := p.SourceRepo()
+	if !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	skip := r.Method == "POST"
+	if err := schedule.SetSkipNext(schedule.NewEtcdStore(h.ecl), schedule.Key(projName, envName, index), skip); err != nil {
+		glog.Errorf("Failed to update schedule %d of %s-%s: %v", index, projName, envName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if skip {
+		glog.Infof("%s skipped the next run of schedule %d of %s-%s", u.Name, index, projName, envName)
+	} else {
+		glog.Infof("%s restored the next run of schedule %d of %s-%s", u.Name, index, projName, envName)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
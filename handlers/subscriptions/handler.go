@@ -0,0 +1,111 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/subscriptions"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+	"github.com/golang/glog"
+)
+
+type handler struct {
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which reads or replaces the notification subscriptions of the current user.
+// i.e. GET or PUT http://127.0.0.1:8000/api/v1/me/subscriptions
+func New(ecl *etcd.Client) http.Handler {
+	return handler{ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var s subscriptions.Settings
+	switch r.Method {
+	case "GET":
+		if s, err = subscriptions.Load(h.ecl, u.Name); err != nil {
+			glog.Errorf("Failed to load subscriptions of %s: %v", u.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := subscriptions.Save(h.ecl, u.Name, s); err != nil {
+			glog.Errorf("Failed to store subscriptions of %s: %v", u.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		glog.Errorf("Failed to marshal subscriptions: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+type page struct {
+	assets helpers.Assets
+}
+
+// NewPage returns an http.Handler which renders the page to manage the subscriptions of the current user.
+// i.e. http://127.0.0.1:8000/subscriptions
+func NewPage(assets helpers.Assets) http.Handler {
+	return page{assets: assets}
+}
+
+func (h page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t, err := h.assets.Page("subscriptions.html", i18n.FromRequest(w, r).Funcs())
+	if err != nil {
+		glog.Errorf("Failed to parse templates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	js, css := h.assets.Templates()
+	params := map[string]interface{}{
+		"Javascript": js,
+		"Stylesheet": css,
+		"CSRFToken":  token,
+		"User":       u,
+		"Page":       "subscriptions",
+	}
+	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
+}
@@ -0,0 +1,213 @@
+package tokens
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/tokens"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+	"github.com/golang/glog"
+)
+
+// createRequest is a request to create a token.
+type createRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Projects are the projects which a token of the "share" scope can view on the wallboard.
+	Projects []string `json:"projects,omitempty"`
+	// ExpiresInDays is the lifetime of the token in days. The token does not expire if zero.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// createResponse is the response to createRequest. It is the only chance to see the secret.
+type createResponse struct {
+	Token  tokens.Token `json:"token"`
+	Secret string       `json:"secret"`
+}
+
+type handler struct {
+	ecl *etcd.Client
+}
+
+// New returns an http.Handler which lists, creates or revokes API tokens of the current user.
+// i.e. GET or POST http://127.0.0.1:8000/api/v1/me/tokens, or DELETE http://127.0.0.1:8000/api/v1/me/tokens?id=0123456789abcdef
+func New(ecl *etcd.Client) http.Handler {
+	return handler{ecl: ecl}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		list(w, h.ecl, u.Name)
+	case "POST":
+		if u.Provider == auth.ProviderToken {
+			http.Error(w, "tokens cannot be created with tokens", http.StatusForbidden)
+			return
+		}
+		var req createRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresInDays < 0 {
+			http.Error(w, "expires_in_days: must not be negative", http.StatusBadRequest)
+			return
+		}
+		ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		var (
+			t      tokens.Token
+			secret string
+		)
+		if len(req.Scopes) == 1 && req.Scopes[0] == tokens.ScopeShare {
+			t, secret, err = tokens.CreateShare(h.ecl, u, req.Name, req.Projects, ttl, time.Now())
+		} else {
+			t, secret, err = tokens.Create(h.ecl, u, req.Name, req.Scopes, ttl, time.Now())
+		}
+		if err != nil {
+			glog.Errorf("Failed to create a token of %s: %v", u.Name, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("%s created token %s (%s)", u.Name, t.ID, t.Name)
+		writeJSON(w, http.StatusCreated, createResponse{Token: t, Secret: secret})
+	case "DELETE":
+		revoke(w, r, h.ecl, u.Name, u.Name)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type allHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+}
+
+// NewAll returns an http.Handler which lists or revokes API tokens of all users. Only admins can use it.
+// i.e. GET http://127.0.0.1:8000/api/v1/tokens, or DELETE http://127.0.0.1:8000/api/v1/tokens?id=0123456789abcdef
+func NewAll(ecl *etcd.Client, isAdmin func(user string) bool) http.Handler {
+	return allHandler{ecl: ecl, isAdmin: isAdmin}
+}
+
+func (h allHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		list(w, h.ecl, "")
+	case "DELETE":
+		revoke(w, r, h.ecl, "", u.Name)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// list responds the tokens of "user", or of all users if "user" is empty.
+func list(w http.ResponseWriter, ecl *etcd.Client, user string) {
+	ts, err := tokens.List(ecl, user)
+	if err != nil {
+		glog.Errorf("Failed to list tokens: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ts == nil {
+		ts = []tokens.Token{}
+	}
+	writeJSON(w, http.StatusOK, ts)
+}
+
+// revoke revokes the token in the "id" parameter of "r" on behalf of "actor".
+// Only tokens of "owner" can be revoked unless "owner" is empty.
+func revoke(w http.ResponseWriter, r *http.Request, ecl *etcd.Client, owner, actor string) {
+	id := r.FormValue("id")
+	err := tokens.Revoke(ecl, id, owner)
+	if err == tokens.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to revoke token %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s revoked token %s", actor, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+type page struct {
+	assets  helpers.Assets
+	isAdmin func(user string) bool
+}
+
+// NewPage returns an http.Handler which renders the page to manage API tokens of the current user.
+// Admins also see tokens of all users there.
+// i.e. http://127.0.0.1:8000/tokens
+func NewPage(assets helpers.Assets, isAdmin func(user string) bool) http.Handler {
+	return page{assets: assets, isAdmin: isAdmin}
+}
+
+func (h page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t, err := h.assets.Page("tokens.html", i18n.FromRequest(w, r).Funcs())
+	if err != nil {
+		glog.Errorf("Failed to parse templates: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	js, css := h.assets.Templates()
+	params := map[string]interface{}{
+		"Javascript": js,
+		"Stylesheet": css,
+		"CSRFToken":  token,
+		"User":       u,
+		"Page":       "tokens",
+		"IsAdmin":    h.isAdmin(u.Name),
+	}
+	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
+}
@@ -1,25 +1,36 @@
 package main
 
 import (
-	"html/template"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/gengo/goship/lib/acl"
 	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/preferences"
 	helpers "github.com/gengo/goship/lib/view-helpers"
 	"github.com/gengo/goship/plugins/plugin"
 	"github.com/golang/glog"
 )
 
-// HomeHandler is the main home screen
+// HomeHandler is the main home screen.
+// It renders only the shell of the rows of environments, which the page hydrates with the fragments of homeRowHandler,
+// unless "nojs=1" asks for the full rows for browsers without JavaScript.
 type HomeHandler struct {
 	ac     acl.AccessControl
 	ecl    *etcd.Client
 	assets helpers.Assets
+	// pushAddr returns the websocket endpoint of push notifications for the client of a request.
+	pushAddr func(r *http.Request) *url.URL
+	// lookups finds stale branches and closed pull requests for the cleanup column.
+	lookups *githublib.Lookups
 }
 
 func (h HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -35,28 +46,53 @@ func (h HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-	t, err := template.New("index.html").ParseFiles("templates/index.html", "templates/base.html")
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		glog.Errorf("Failed to issue CSRF token: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tags := r.URL.Query()["tag"]
+	sel, err := config.ParseTagSelector(tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefs, err := preferences.Load(h.ecl, u.Name)
+	if err != nil {
+		glog.Errorf("Failed to load preferences of %s: %v", u.Name, err)
+	}
+	l := i18n.FromRequest(w, r)
+	funcs := l.Funcs()
+	funcs["renderHeader"] = plugin.RenderHeader
+	funcs["renderDetail"] = plugin.RenderDetail
+	funcs["hostTags"] = func(h config.Host) []string {
+		return h.SortedTags(c.HostTags)
+	}
+	funcs["isFavorite"] = func(name string) bool {
+		return prefs.IsFavorite(name)
+	}
+	funcs["hasDependents"] = func(name string) bool {
+		return config.HasDependents(c.Projects, name)
+	}
+	t, err := h.assets.Page("index.html", funcs)
 	if err != nil {
 		glog.Errorf("Failed to parse template: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	projs := acl.ReadableProjects(h.ac, c.Projects, u)
-
-	sort.Sort(ByName(c.Projects))
+	projs := prefs.Listing(filterHosts(acl.ReadableProjects(acl.ForUser(h.ac, c, u), c.Projects, u), sel), r.FormValue("mine") == "true")
 
-	// columns maps a plugin name to a list of columns
-	columns := make(map[string][]plugin.Column)
-	for _, pl := range plugin.Plugins {
-		for _, p := range c.Projects {
-			cols, err := pl.Apply(p)
-			if err != nil {
-				glog.Errorf("Failed to apply plugin: %s", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			columns[p.Name] = append(columns[p.Name], cols...)
+	// columns maps a project name to the columns of its table
+	columns := make(map[string]*plugin.Columns)
+	for _, p := range projs {
+		cols, err := plugin.TableFor(p, tableParams(c, p, u, token, l, h.lookups))
+		if err != nil {
+			glog.Errorf("Failed to apply plugin: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		columns[p.Name] = cols
 	}
 	js, css := h.assets.Templates()
 	gt := os.Getenv(gitHubAPITokenEnvVar)
@@ -66,22 +102,143 @@ func (h HomeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	params := map[string]interface{}{
-		"Javascript":        js,
-		"Stylesheet":        css,
-		"Projects":          projs,
-		"PluginColumns":     columns,
-		"User":              u,
-		"Page":              "home",
-		"ConfirmDeployFlag": *confirmDeployFlag,
-		"GithubToken":       gt,
-		"PivotalToken":      pt,
+		"Javascript":          js,
+		"Stylesheet":          css,
+		"Projects":            projs,
+		"Columns":             columns,
+		"CSRFToken":           token,
+		"User":                u,
+		"Page":                "home",
+		"ConfirmDeployFlag":   *confirmDeployFlag,
+		"MinDeployNoteLength": config.MinDeployNoteLength,
+		"GithubToken":         gt,
+		"PivotalToken":        pt,
+		"TagQuery":            tagQuery(tags),
+		"Favorites":           prefs.Favorites,
+		"HostSort":            prefs.HostSort,
+		"HostTagKeys":         c.HostTags,
+		"ConfigErrors":        c.ConfigErrors,
+		"IsAdmin":             isAdmin(u.Name),
+		"PushAddress":         h.pushAddr(r).String(),
+		"Hydrate":             r.FormValue("nojs") != "1",
+		"NoJSQuery":           noJSQuery(r.URL.Query()),
 	}
 	helpers.RespondWithTemplate(w, "text/html", t, "base", params)
 }
 
-// ByName is the interface for sorting projects
-type ByName []config.Project
+// tableParams returns the parameters of the table of "p" in "c" which "u" sees in the language of "l".
+// "csrf" is the CSRF token of the session of "u", which the deploy forms post.
+func tableParams(c config.Config, p config.Project, u auth.User, csrf string, l *i18n.Localizer, lookups *githublib.Lookups) plugin.TableParams {
+	return plugin.TableParams{
+		HostTags:            c.HostTags,
+		MinDeployNoteLength: config.MinDeployNoteLength,
+		LastDeploy:          lastDeployOf(p.Name),
+		Cleanup:             cleanupOf(lookups, p, time.Now()),
+		Localizer:           l.In(p.CommitAge.Location()),
+		HostEditor:          isAdmin(u.Name),
+		CSRFToken:           csrf,
+	}
+}
+
+// lastDeployOf returns a function which returns the latest deployment of an environment of the project "proj" in the deploy log.
+func lastDeployOf(proj string) func(env string) (plugin.LastDeploy, bool) {
+	return func(env string) (plugin.LastDeploy, bool) {
+		entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+		if err != nil || len(entries) == 0 {
+			return plugin.LastDeploy{}, false
+		}
+		sort.Sort(ByTime(entries))
+		return plugin.LastDeploy{Time: entries[0].Time, User: entries[0].User, Success: entries[0].Success}, true
+	}
+}
+
+// cleanupOf returns a function which suggests cleanups of environments of "proj" at "now".
+// Environments whose lookups fail get no suggestion rather than breaking the page.
+func cleanupOf(l *githublib.Lookups, proj config.Project, now time.Time) func(env string) (plugin.Cleanup, bool) {
+	return func(env string) (plugin.Cleanup, bool) {
+		if l == nil || proj.RepoType == config.RepoTypeDocker {
+			return plugin.Cleanup{}, false
+		}
+		_, e, err := config.ResolveTarget([]config.Project{proj}, proj.Name, env)
+		if err != nil || e.Branch == "" {
+			return plugin.Cleanup{}, false
+		}
+
+		var c plugin.Cleanup
+		updated, err := l.LastCommitTime(proj.RepoOwner, proj.RepoName, e.Branch)
+		if err != nil {
+			glog.Warningf("Failed to get the last commit of %s/%s@%s: %v", proj.RepoOwner, proj.RepoName, e.Branch, err)
+		} else if now.Sub(updated) > proj.StaleBranchAge() {
+			c.StaleSince = updated
+		}
 
-func (slice ByName) Len() int           { return len(slice) }
-func (slice ByName) Less(i, j int) bool { return slice[i].Name < slice[j].Name }
-func (slice ByName) Swap(i, j int)      { slice[i], slice[j] = slice[j], slice[i] }
+		if sha := lastDeployedRevision(proj.Name, env); sha != "" {
+			pull, err := l.ClosedPullRequest(proj.RepoOwner, proj.RepoName, e.Branch, sha)
+			if err != nil {
+				glog.Warningf("Failed to search pull requests of %s/%s@%s: %v", proj.RepoOwner, proj.RepoName, e.Branch, err)
+			} else if pull != nil && pull.Number != nil && pull.HTMLURL != nil {
+				c.PullRequest = &plugin.PullRequest{Number: *pull.Number, URL: *pull.HTMLURL}
+				if pull.Title != nil {
+					c.PullRequest.Title = *pull.Title
+				}
+			}
+		}
+		return c, !c.StaleSince.IsZero() || c.PullRequest != nil
+	}
+}
+
+// lastDeployedRevision returns the revision which the latest successful deployment to "env" of "proj" deployed.
+func lastDeployedRevision(proj, env string) string {
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+	if err != nil {
+		return ""
+	}
+	sort.Sort(ByTime(entries))
+	for _, e := range entries {
+		if e.Success {
+			return string(e.Range.To)
+		}
+	}
+	return ""
+}
+
+// filterHosts returns "projs" with only the hosts which match "sel".
+// Environments without matching hosts are omitted.
+func filterHosts(projs []config.Project, sel config.TagSelector) []config.Project {
+	if len(sel) == 0 {
+		return projs
+	}
+	var filtered []config.Project
+	for _, p := range projs {
+		var envs []config.Environment
+		for _, e := range p.Environments {
+			if e.Hosts = sel.SelectHosts(e.Hosts); len(e.Hosts) > 0 {
+				envs = append(envs, e)
+			}
+		}
+		if len(envs) > 0 {
+			p.Environments = envs
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// noJSQuery returns a query string of the home screen with "q" which renders the rows in full.
+func noJSQuery(q url.Values) string {
+	v := url.Values{"nojs": {"1"}}
+	for k, vs := range q {
+		if k != "nojs" {
+			v[k] = vs
+		}
+	}
+	return "?" + v.Encode()
+}
+
+// tagQuery returns a query string which passes "tags" to /commits.
+func tagQuery(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "?" + url.Values{"tag": tags}.Encode()
+}
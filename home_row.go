@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/plugins/plugin"
+	"golang.org/x/net/context"
+)
+
+// homeRowHandler renders the cells of the row of an environment on the home screen as an HTML fragment.
+// The home screen fills the shells of its rows with them, and replaces them when deployments to the environment finish.
+// The cell of the environment name is not included since the shell already has it. Hosts are filtered by "tag" like the home screen.
+// i.e. GET http://127.0.0.1:8000/api/v1/projects/my-project/environments/production/row
+type homeRowHandler struct {
+	ac   acl.AccessControl
+	load func() (config.Config, error)
+	// lookups finds stale branches and closed pull requests for the cleanup column.
+	lookups *githublib.Lookups
+}
+
+func newHomeRowHandler(ac acl.AccessControl, ecl *etcd.Client, lookups *githublib.Lookups) homeRowHandler {
+	return homeRowHandler{
+		ac:      ac,
+		load:    func() (config.Config, error) { return config.Load(ecl) },
+		lookups: lookups,
+	}
+}
+
+func (h homeRowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 8 || components[4] == "" || components[5] != "environments" || components[6] == "" || components[7] != "row" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	projName, envName := components[4], components[6]
+	id := reqlog.FromRequest(r)
+	ctx := reqlog.NewContext(context.Background(), id)
+
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch current user: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	sel, err := config.ParseTagSelector(r.URL.Query()["tag"])
+	if err != nil {
+		reqlog.Error(w, id, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := h.load()
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to fetch latest configuration: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, _, err := acl.ResolveTarget(ac, c.Projects, u, projName, envName)
+	if err != nil {
+		respondTargetError(w, id, err)
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		reqlog.Error(w, id, "permission denied", http.StatusForbidden)
+		return
+	}
+	// the environment may have no hosts with the tags.
+	projs := filterHosts([]config.Project{*proj}, sel)
+	if _, _, err := config.ResolveTarget(projs, projName, envName); err != nil {
+		respondTargetError(w, id, err)
+		return
+	}
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to issue CSRF token: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cols, err := plugin.TableFor(projs[0], tableParams(c, projs[0], u, token, i18n.FromRequest(w, r), h.lookups))
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to apply plugin: %v", err)
+		reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	for _, col := range cols.Row(envName) {
+		cell, err := plugin.RenderDetail(col, envName)
+		if err != nil {
+			reqlog.Errorf(ctx, "Failed to render the row of %s-%s: %v", projName, envName, err)
+			reqlog.Error(w, id, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		buf.WriteString(string(cell))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		reqlog.Errorf(ctx, "Failed to send response: %v", err)
+	}
+}
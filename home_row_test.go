@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/plugins/plugin"
+)
+
+// rowAccessControl allows to read only the repositories in "readable".
+type rowAccessControl struct {
+	readable map[string]bool
+}
+
+func (a rowAccessControl) Readable(owner, repo, user string) bool {
+	return a.readable[repo]
+}
+
+func (a rowAccessControl) Deployable(owner, repo, user string) bool {
+	return a.readable[repo]
+}
+
+func rowFixture() config.Config {
+	return config.Config{
+		Projects: []config.Project{
+			{
+				Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"},
+				Environments: []config.Environment{
+					{Name: "production", Branch: "master", Hosts: []config.Host{{Name: "api-1.example.com"}}},
+					{Name: "canary", Branch: "master"},
+				},
+			},
+			{
+				Name: "billing", Repo: config.Repo{RepoOwner: "gengo", RepoName: "billing"},
+				Environments: []config.Environment{{Name: "production", Branch: "master", Hosts: []config.Host{{Name: "billing-1.example.com"}}}},
+			},
+		},
+	}
+}
+
+func TestHomeRow(t *testing.T) {
+	auth.Initialize(auth.User{Name: "alice"}, []byte("secret"))
+	h := homeRowHandler{
+		ac:   rowAccessControl{readable: map[string]bool{"api": true}},
+		load: func() (config.Config, error) { return rowFixture(), nil },
+	}
+	for _, spec := range []struct {
+		method, path string
+		wantCode     int
+		want         []string
+	}{
+		{
+			method: "GET", path: "/api/v1/projects/api/environments/production/row", wantCode: http.StatusOK,
+			want: []string{`<td class="hosts">`, `class="form-deploy`, `value="production"`, `name="csrf_token"`},
+		},
+		{
+			method: "GET", path: "/api/v1/projects/api/environments/canary/row", wantCode: http.StatusOK,
+			want: []string{`<td class="hosts unconfigured">`},
+		},
+		{method: "GET", path: "/api/v1/projects/api/environments/staging/row", wantCode: http.StatusNotFound},
+		{method: "GET", path: "/api/v1/projects/web/environments/production/row", wantCode: http.StatusNotFound},
+		{method: "GET", path: "/api/v1/projects/billing/environments/production/row", wantCode: http.StatusForbidden},
+		{method: "POST", path: "/api/v1/projects/api/environments/production/row", wantCode: http.StatusMethodNotAllowed},
+	} {
+		r, err := http.NewRequest(spec.method, spec.path, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q, %q, nil) failed with %v", spec.method, spec.path, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != spec.wantCode {
+			t.Errorf("%s %s responded %d; want %d: %s", spec.method, spec.path, w.Code, spec.wantCode, w.Body)
+			continue
+		}
+		if spec.wantCode != http.StatusOK {
+			continue
+		}
+		got := w.Body.String()
+		if ct := w.HeaderMap.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("Content-Type of %s = %q; want text/html", spec.path, ct)
+		}
+		for _, want := range spec.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("row of %s does not contain %q:\n%s", spec.path, want, got)
+			}
+		}
+		// the shell of the row on the home screen already has the name of the environment.
+		if strings.Contains(got, "/deployLog/") || strings.Contains(got, "<tr") {
+			t.Errorf("row of %s = %q; want only the cells after the name", spec.path, got)
+		}
+	}
+}
+
+func TestHomeHydrate(t *testing.T) {
+	pages, err := newPages("")
+	if err != nil {
+		t.Fatalf("newPages failed with %v", err)
+	}
+	c := rowFixture()
+	l := i18n.New(i18n.English, time.UTC)
+	columns := make(map[string]*plugin.Columns)
+	for _, p := range c.Projects {
+		cols, err := plugin.TableFor(p, tableParams(c, p, auth.User{Name: "alice"}, "", l, nil))
+		if err != nil {
+			t.Fatalf("plugin.TableFor(%q, ...) failed with %v", p.Name, err)
+		}
+		columns[p.Name] = cols
+	}
+	funcs := l.Funcs()
+	funcs["renderHeader"] = plugin.RenderHeader
+	funcs["renderDetail"] = plugin.RenderDetail
+	funcs["hostTags"] = func(h config.Host) []string { return nil }
+	funcs["isFavorite"] = func(name string) bool { return false }
+	tmpl, err := pages.Lookup("index.html", funcs)
+	if err != nil {
+		t.Fatalf("pages.Lookup(%q) failed with %v", "index.html", err)
+	}
+
+	for _, hydrate := range []bool{true, false} {
+		var buf bytes.Buffer
+		err := tmpl.ExecuteTemplate(&buf, "body", map[string]interface{}{
+			"Projects":  c.Projects,
+			"Columns":   columns,
+			"Hydrate":   hydrate,
+			"NoJSQuery": noJSQuery(nil),
+		})
+		if err != nil {
+			t.Fatalf("tmpl.ExecuteTemplate with Hydrate=%t failed with %v", hydrate, err)
+		}
+		got := buf.String()
+		want := 0
+		if hydrate {
+			want = 3
+		}
+		if n := strings.Count(got, `<td class="row-loading`); n != want {
+			t.Errorf("home screen with Hydrate=%t has %d rows to hydrate; want %d", hydrate, n, want)
+		}
+		if rendered := strings.Contains(got, `<td class="hosts">`); rendered == hydrate {
+			t.Errorf("home screen with Hydrate=%t renders cells = %t; want %t", hydrate, rendered, !hydrate)
+		}
+		if noscript := strings.Contains(got, `<a href="?nojs=1">`); noscript != hydrate {
+			t.Errorf("home screen with Hydrate=%t links to the page without JavaScript = %t; want %t", hydrate, noscript, hydrate)
+		}
+	}
+	if got, want := noJSQuery(map[string][]string{"tag": {"role:web"}, "nojs": {"0"}}), "?nojs=1&tag=role%3Aweb"; got != want {
+		t.Errorf("noJSQuery(...) = %q; want %q", got, want)
+	}
+}
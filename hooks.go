@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+// Names of the hooks of deployments, which mark their sections of the deploy log.
+const (
+	preDeployHook  = "pre_deploy"
+	postDeployHook = "post_deploy"
+)
+
+// HookResult is the outcome of a hook of a deployment, which is recorded in the deploy log.
+type HookResult struct {
+	// Name is either "pre_deploy" or "post_deploy".
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	// Advisory is true if the failure of the hook did not affect the deployment.
+	Advisory bool          `json:"advisory,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Error describes why the hook failed.
+	Error string `json:"error,omitempty"`
+}
+
+func (r HookResult) String() string {
+	if r.Success {
+		return fmt.Sprintf("%s ok", r.Name)
+	}
+	if r.Advisory {
+		return fmt.Sprintf("%s failed (advisory)", r.Name)
+	}
+	return fmt.Sprintf("%s failed", r.Name)
+}
+
+// Blocks returns true if the hook failed and the deployment must fail with it.
+func (r HookResult) Blocks() bool {
+	return !r.Success && !r.Advisory
+}
+
+// runWithHooks runs the pre-deploy hook of "env", "run" which runs the deploy command, and the post-deploy hook in order.
+// The deploy command does not run if the pre-deploy hook fails, and the post-deploy hook only runs after the command has succeeded.
+// It returns the results of the hooks which ran, why the deployment failed if so, and the error of "run" if it could not run the command at all.
+func runWithHooks(env config.Environment, p config.DeployParams, dir string, cmdEnv []string, output func(line string), run func() (failure, err error)) ([]HookResult, error, error) {
+	var hooks []HookResult
+	if pre := runHook(preDeployHook, env.PreDeploy, p, dir, cmdEnv, output); pre != nil {
+		hooks = append(hooks, *pre)
+		if pre.Blocks() {
+			return hooks, fmt.Errorf("%s hook failed: %s", preDeployHook, pre.Error), nil
+		}
+	}
+	failure, err := run()
+	if err != nil || failure != nil {
+		return hooks, failure, err
+	}
+	if post := runHook(postDeployHook, env.PostDeploy, p, dir, cmdEnv, output); post != nil {
+		hooks = append(hooks, *post)
+		if post.Blocks() {
+			return hooks, fmt.Errorf("%s hook failed: %s", postDeployHook, post.Error), nil
+		}
+	}
+	return hooks, nil, nil
+}
+
+// runHook runs "hook" of a deployment as "name" with "p" in "dir" with the environment variables "env",
+// and passes each line of its output to "output" between section markers, so that it reads apart from the deploy command.
+// It returns nil if "hook" is nil.
+func runHook(name string, hook *config.Hook, p config.DeployParams, dir string, env []string, output func(line string)) *HookResult {
+	if hook == nil {
+		return nil
+	}
+	start := time.Now()
+	res := &HookResult{Name: name, Advisory: hook.Advisory()}
+	output(fmt.Sprintf("==> %s", name))
+	err := execHook(hook, p, dir, env, output)
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Error = err.Error()
+		output(fmt.Sprintf("<== %s failed after %s: %v", name, res.Duration, err))
+		return res
+	}
+	res.Success = true
+	output(fmt.Sprintf("<== %s finished in %s", name, res.Duration))
+	return res
+}
+
+// execHook runs the command of "hook" until it exits or times out.
+func execHook(hook *config.Hook, p config.DeployParams, dir string, env []string, output func(line string)) error {
+	argv, err := hook.Argv(p)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir, cmd.Env = dir, env
+	cmd.Stdout, cmd.Stderr = pw, pw
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			output(stripANSICodes(strings.TrimSpace(s.Text())))
+		}
+		// Drains the rest if a line is too long, so that the command does not block.
+		io.Copy(ioutil.Discard, pr)
+	}()
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		<-scanned
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(hook.Timeout()):
+		cmd.Process.Kill()
+		<-done
+		err = fmt.Errorf("timed out after %s", hook.Timeout())
+	}
+	pw.Close()
+	<-scanned
+	return err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+// shHook returns a hook which runs "script" with /bin/sh.
+func shHook(script string, policy config.HookPolicy) *config.Hook {
+	return &config.Hook{Command: []string{"/bin/sh", "-c", script}, OnFailure: policy}
+}
+
+func TestRunWithHooks(t *testing.T) {
+	params := config.DeployParams{Revision: "abc123", Environment: "production"}
+	for _, spec := range []struct {
+		desc string
+		env  config.Environment
+		// cmdFailure is what the deploy command fails with.
+		cmdFailure error
+		wantRun    bool
+		// wantHooks are "name success advisory" of the results.
+		wantHooks   []string
+		wantFailure string
+	}{
+		{
+			desc:    "no hooks",
+			wantRun: true,
+		},
+		{
+			desc: "successful hooks",
+			env: config.Environment{
+				PreDeploy:  shHook("echo maintenance on", ""),
+				PostDeploy: shHook("echo smoke test of {{.Revision}}", ""),
+			},
+			wantRun:   true,
+			wantHooks: []string{"pre_deploy true false", "post_deploy true false"},
+		},
+		{
+			desc: "pre_deploy failure aborts",
+			env: config.Environment{
+				PreDeploy:  shHook("echo cannot scale down; exit 3", config.HookFail),
+				PostDeploy: shHook("echo smoke test", ""),
+			},
+			wantHooks:   []string{"pre_deploy false false"},
+			wantFailure: "pre_deploy hook failed: exit status 3",
+		},
+		{
+			desc:      "advisory pre_deploy failure",
+			env:       config.Environment{PreDeploy: shHook("exit 1", config.HookAdvisory)},
+			wantRun:   true,
+			wantHooks: []string{"pre_deploy false true"},
+		},
+		{
+			desc:      "advisory post_deploy failure",
+			env:       config.Environment{PostDeploy: shHook("echo cache warm failed; exit 1", config.HookAdvisory)},
+			wantRun:   true,
+			wantHooks: []string{"post_deploy false true"},
+		},
+		{
+			desc:        "post_deploy failure fails the deployment",
+			env:         config.Environment{PostDeploy: shHook("exit 2", "")},
+			wantRun:     true,
+			wantHooks:   []string{"post_deploy false false"},
+			wantFailure: "post_deploy hook failed: exit status 2",
+		},
+		{
+			desc:        "no post_deploy after a failed command",
+			env:         config.Environment{PostDeploy: shHook("echo smoke test", "")},
+			cmdFailure:  errors.New("exit status 1"),
+			wantRun:     true,
+			wantFailure: "exit status 1",
+		},
+	} {
+		ran := false
+		run := func() (error, error) {
+			ran = true
+			return spec.cmdFailure, nil
+		}
+		hooks, failure, err := runWithHooks(spec.env, params, "", os.Environ(), func(string) {}, run)
+		if err != nil {
+			t.Errorf("runWithHooks(...) failed with %v on %s", err, spec.desc)
+			continue
+		}
+		if ran != spec.wantRun {
+			t.Errorf("ran = %t on %s; want %t", ran, spec.desc, spec.wantRun)
+		}
+		var got []string
+		for _, r := range hooks {
+			got = append(got, fmt.Sprintf("%s %t %t", r.Name, r.Success, r.Advisory))
+		}
+		if !reflect.DeepEqual(got, spec.wantHooks) {
+			t.Errorf("hooks = %q on %s; want %q", got, spec.desc, spec.wantHooks)
+		}
+		switch {
+		case spec.wantFailure == "" && failure != nil:
+			t.Errorf("failure = %v on %s; want none", failure, spec.desc)
+		case spec.wantFailure != "" && (failure == nil || failure.Error() != spec.wantFailure):
+			t.Errorf("failure = %v on %s; want %q", failure, spec.desc, spec.wantFailure)
+		}
+	}
+}
+
+func TestRunHookSections(t *testing.T) {
+	var lines []string
+	output := func(line string) { lines = append(lines, line) }
+	hook := shHook("echo warming {{.Environment}}; echo \"\x1b[31mdone\x1b[0m\" >&2", "")
+	res := runHook(postDeployHook, hook, config.DeployParams{Environment: "production"}, "", os.Environ(), output)
+	if res == nil || !res.Success || res.Error != "" {
+		t.Fatalf("runHook(...) = %#v; want success", res)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("output = %q; want the output of the hook between the markers", lines)
+	}
+	if lines[0] != "==> post_deploy" || !strings.HasPrefix(lines[3], "<== post_deploy finished in ") {
+		t.Errorf("output = %q; want sections marked", lines)
+	}
+	if got, want := lines[1:3], []string{"warming production", "done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output of the hook = %q; want %q", got, want)
+	}
+
+	lines = nil
+	hook = &config.Hook{Command: []string{"/bin/sh", "-c", "echo started; exec sleep 10"}, TimeoutSeconds: 1}
+	res = runHook(preDeployHook, hook, config.DeployParams{}, "", os.Environ(), output)
+	if res == nil || res.Success || res.Error != "timed out after 1s" {
+		t.Errorf("runHook(...) = %#v for a slow hook; want a timeout", res)
+	}
+	if len(lines) != 3 || lines[1] != "started" || !strings.HasPrefix(lines[2], "<== pre_deploy failed after ") {
+		t.Errorf("output = %q; want the failure marked", lines)
+	}
+
+	if res := runHook(preDeployHook, nil, config.DeployParams{}, "", os.Environ(), output); res != nil {
+		t.Errorf("runHook(...) = %#v without a hook; want nil", res)
+	}
+}
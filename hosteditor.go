@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// hostEditorHandler replaces the hosts of an environment, e.g. to configure a placeholder environment of a new project.
+// "hosts" is a comma- or newline-separated list of hosts. Only admins can edit hosts.
+// i.e. POST http://127.0.0.1:8000/admin/hosts?project=api&environment=staging&hosts=web1.example.com,web2.example.com
+type hostEditorHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	// feed records the changes of hosts.
+	feed *activity.Feed
+}
+
+func (h hostEditorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	proj, env := r.FormValue("project"), r.FormValue("environment")
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, _, err := config.ResolveTarget(c.Projects, proj, env); err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	hosts := config.ParseHosts(r.FormValue("hosts"))
+	if err := config.SetHosts(h.ecl, proj, env, hosts); err != nil {
+		glog.Errorf("Failed to set hosts of %s-%s: %v", proj, env, err)
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	glog.Infof("%s set %d hosts of %s-%s", u.Name, len(hosts), proj, env)
+	h.feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: proj, Environment: env, User: u.Name, Summary: fmt.Sprintf("%s set the hosts of %s-%s to %s", u.Name, proj, env, config.HostList(config.HostNames(hosts)))})
+	recordConfigVersion(h.ecl, proj, u.Name, fmt.Sprintf("set the hosts of %s", env))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/inventory"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// runHostInventory compares the hosts of each environment with the previous refresh, and notifies changes which persisted
+// across two consecutive refreshes. It also forgets the inventories of removed environments.
+func runHostInventory(ctx context.Context, ecl *etcd.Client, feed *activity.Feed) {
+	c, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	notify := func(proj, env string, ch inventory.Change) {
+		glog.Infof("Hosts of %s-%s changed: %s", proj, env, ch)
+		notifier.ForEnvironment(c, proj, env).Notify(notifier.Event{
+			Type:         notifier.HostsChanged,
+			Project:      proj,
+			Environment:  env,
+			AddedHosts:   ch.Added,
+			RemovedHosts: ch.Removed,
+		})
+		feed.Record(activity.Entry{Type: activity.HostsChanged, Project: proj, Environment: env, Summary: fmt.Sprintf("%s %s", env, ch)})
+	}
+	if err := observeHosts(ecl, c, time.Now(), notify); err != nil {
+		glog.Errorf("Failed to update host inventory: %v", err)
+	}
+}
+
+// observeHosts records the hosts of the environments in "c" as observed at "now", and calls "notify" for each confirmed change.
+// It returns the first error but observes all the environments.
+func observeHosts(s inventory.Store, c config.Config, now time.Time, notify func(proj, env string, ch inventory.Change)) error {
+	var first error
+	known := make(map[string]bool)
+	for _, p := range c.Projects {
+		for _, e := range p.Environments {
+			known[path.Join(p.Name, e.Name)] = true
+			var hosts []string
+			for _, h := range e.Hosts {
+				hosts = append(hosts, h.Name)
+			}
+			ch, err := inventory.Observe(s, p.Name, e.Name, hosts, now)
+			if err != nil {
+				glog.Errorf("Failed to observe hosts of %s-%s: %v", p.Name, e.Name, err)
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+			if ch != nil {
+				notify(p.Name, e.Name, *ch)
+			}
+		}
+	}
+	inv, err := inventory.Load(s)
+	if err != nil {
+		if first == nil {
+			first = err
+		}
+		return first
+	}
+	for _, st := range inv {
+		if known[path.Join(st.Project, st.Environment)] {
+			continue
+		}
+		if err := inventory.Forget(s, st.Project, st.Environment); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/inventory"
+)
+
+func TestObserveHosts(t *testing.T) {
+	s := webhookStore{}
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	withHosts := func(names ...string) config.Config {
+		var hosts []config.Host
+		for _, n := range names {
+			hosts = append(hosts, config.Host{Name: n})
+		}
+		return config.Config{Projects: []config.Project{
+			{Name: "api", Environments: []config.Environment{
+				{Name: "production", Hosts: hosts},
+				{Name: "staging", Hosts: []config.Host{{Name: "stg-001"}}},
+			}},
+		}}
+	}
+	var notified []string
+	notify := func(proj, env string, ch inventory.Change) {
+		notified = append(notified, proj+"-"+env+" "+ch.String())
+	}
+	for i, c := range []config.Config{
+		withHosts("web-017", "web-041"),
+		withHosts("web-041", "web-042"),
+		withHosts("web-041", "web-042"),
+	} {
+		if err := observeHosts(s, c, now.Add(time.Duration(i)*time.Minute), notify); err != nil {
+			t.Fatalf("observeHosts(s, c, now+%dm, notify) failed with %v", i, err)
+		}
+	}
+	if want := []string{"api-production gained web-042, lost web-017"}; !reflect.DeepEqual(notified, want) {
+		t.Errorf("notified = %q; want %q", notified, want)
+	}
+
+	// staging was removed.
+	c := withHosts("web-041", "web-042")
+	c.Projects[0].Environments = c.Projects[0].Environments[:1]
+	if err := observeHosts(s, c, now.Add(3*time.Minute), notify); err != nil {
+		t.Fatalf("observeHosts(s, c, now+3m, notify) failed with %v", err)
+	}
+	inv, err := inventory.Load(s)
+	if err != nil {
+		t.Fatalf("inventory.Load(s) failed with %v", err)
+	}
+	if _, ok := inv["api/staging"]; ok {
+		t.Errorf("inventory of api-staging = %#v; want forgotten", inv["api/staging"])
+	}
+	if _, ok := inv["api/production"]; !ok {
+		t.Errorf("inventory of api-production is missing")
+	}
+}
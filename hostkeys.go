@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/golang/glog"
+)
+
+// knownHostsEnvName is the name of the environment variable which exports the path to the known_hosts file
+// of the trusted host keys to the deployment command, e.g. for ssh -o UserKnownHostsFile=$GOSHIP_KNOWN_HOSTS.
+const knownHostsEnvName = "GOSHIP_KNOWN_HOSTS"
+
+// refuseBlockedHosts returns an error if any of "hosts" is blocked because its host key has changed.
+func refuseBlockedHosts(keys hostkeys.HostKeys, hosts config.HostList) error {
+	for _, h := range hosts {
+		if keys.State(h) == hostkeys.StateBlocked {
+			return fmt.Errorf("%s is blocked since its host key has changed; ask an admin to approve the new key", h)
+		}
+	}
+	return nil
+}
+
+// writeKnownHosts writes the trusted keys in "keys" into the known_hosts file in the data directory and returns its path.
+// The file is replaced atomically since concurrent deployments may be reading it.
+func writeKnownHosts(keys hostkeys.HostKeys) (string, error) {
+	f, err := ioutil.TempFile(*dataPath, "known_hosts")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(keys.KnownHosts()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	fname := path.Join(*dataPath, "known_hosts")
+	if err := os.Rename(f.Name(), fname); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return fname, nil
+}
+
+// hostKeyView is a host key with the fingerprints of the keys for admins to compare with the hosts.
+type hostKeyView struct {
+	hostkeys.HostKey
+	Fingerprint        string `json:"fingerprint,omitempty"`
+	OfferedFingerprint string `json:"offeredFingerprint,omitempty"`
+}
+
+// hostKeysHandler lists known host keys, or approves the key offered by a host. Only admins can access host keys.
+// i.e. GET http://127.0.0.1:8000/admin/hostkeys?state=pending
+// or POST http://127.0.0.1:8000/admin/hostkeys?host=web1&fingerprint=SHA256:...
+type hostKeysHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	// feed records approvals.
+	feed *activity.Feed
+}
+
+func (h hostKeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	var resp interface{}
+	if r.Method == "POST" {
+		host, fp := r.FormValue("host"), r.FormValue("fingerprint")
+		if host == "" || fp == "" {
+			http.Error(w, "host and fingerprint are required", http.StatusBadRequest)
+			return
+		}
+		hk, err := hostkeys.Approve(h.ecl, host, fp, u.Name, time.Now())
+		if err != nil {
+			glog.Errorf("Failed to approve host key of %s: %v", host, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		glog.Infof("%s approved host key %s of %s", u.Name, fp, host)
+		h.feed.Record(activity.Entry{Type: activity.HostKeyApproved, User: u.Name, Summary: fmt.Sprintf("%s approved host key %s of %s", u.Name, fp, host)})
+		resp = newHostKeyView(hk)
+	} else {
+		keys, err := hostkeys.Load(h.ecl)
+		if err != nil {
+			glog.Errorf("Failed to load host keys: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		state := r.FormValue("state")
+		views := []hostKeyView{}
+		for _, hk := range keys.Sorted() {
+			if state == "" || hk.State == state {
+				views = append(views, newHostKeyView(hk))
+			}
+		}
+		resp = views
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+func newHostKeyView(hk hostkeys.HostKey) hostKeyView {
+	return hostKeyView{
+		HostKey:            hk,
+		Fingerprint:        hostkeys.Fingerprint(hk.Key),
+		OfferedFingerprint: hostkeys.Fingerprint(hk.Offered),
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostkeys"
+)
+
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHnQ6b8cIn8cnSJ5nCMGpcPEObiz3+0+TWEGsk8MAh4T"
+
+func TestRefuseBlockedHosts(t *testing.T) {
+	keys := hostkeys.HostKeys{
+		"web1": {Host: "web1", State: hostkeys.StateTrusted},
+		"web2": {Host: "web2", State: hostkeys.StatePending},
+		"web3": {Host: "web3", State: hostkeys.StateBlocked},
+	}
+	if err := refuseBlockedHosts(keys, config.HostList{"web1", "web2", "web4"}); err != nil {
+		t.Errorf("refuseBlockedHosts(keys, hosts) failed with %v; want success without blocked hosts", err)
+	}
+	if err := refuseBlockedHosts(keys, config.HostList{"web1", "web3"}); err == nil {
+		t.Errorf("refuseBlockedHosts(keys, hosts) succeeded with web3; want failure")
+	}
+}
+
+func TestWriteKnownHosts(t *testing.T) {
+	withDataPath(t, func() {
+		keys := hostkeys.HostKeys{
+			"web1": {Host: "web1", State: hostkeys.StateTrusted, Key: testHostKey},
+			"web2": {Host: "web2", State: hostkeys.StateBlocked, Key: testHostKey},
+		}
+		fname, err := writeKnownHosts(keys)
+		if err != nil {
+			t.Fatalf("writeKnownHosts(keys) failed with %v", err)
+		}
+		buf, err := ioutil.ReadFile(fname)
+		if want := "web1 " + testHostKey + "\n"; err != nil || string(buf) != want {
+			t.Errorf("ioutil.ReadFile(%q) = %q, %v; want %q", fname, buf, err, want)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/preflight"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// onlyHosts returns "hosts" narrowed down to the ones in "only" in their order, or "hosts" as they are if "only" is empty.
+// It is an error if any of "only" is not in "hosts", e.g. drained or not in the environment.
+func onlyHosts(proj, env string, hosts config.HostList, only []string) (config.HostList, error) {
+	if len(only) == 0 {
+		return hosts, nil
+	}
+	wanted := make(map[string]bool)
+	for _, host := range only {
+		wanted[host] = true
+	}
+	var narrowed config.HostList
+	for _, h := range hosts {
+		if wanted[h] {
+			narrowed = append(narrowed, h)
+			delete(wanted, h)
+		}
+	}
+	for _, host := range only {
+		if wanted[host] {
+			return nil, fmt.Errorf("%s is not a deployable host of %s-%s", host, proj, env)
+		}
+	}
+	return narrowed, nil
+}
+
+// excludeLockedHosts returns "hosts" of "env" of "proj" without the ones in "locks", and the locked ones as skipped.
+// Each locked host is warned about through "report". Locked hosts abort the deployment instead if "strict".
+// It is an error if all the hosts are locked, since deploying into none of them is not what the user wants.
+func excludeLockedHosts(ctx context.Context, proj, env string, hosts config.HostList, locks hostlock.Locks, strict bool, report func(string)) (config.HostList, []preflight.Failure, error) {
+	unlocked, locked := locks.Split(proj, env, hosts)
+	if len(locked) == 0 {
+		return hosts, nil, nil
+	}
+	var (
+		skipped []preflight.Failure
+		reasons []string
+	)
+	for _, host := range locked {
+		l, _ := locks.Get(proj, env, host)
+		reqlog.Warningf(ctx, "%s in %s-%s is %s", host, proj, env, l)
+		report(fmt.Sprintf("hostlock: %s: %s", host, l))
+		skipped = append(skipped, preflight.Failure{Host: host, Reason: l.String()})
+		reasons = append(reasons, fmt.Sprintf("%s %s", host, l))
+	}
+	if strict {
+		return nil, skipped, fmt.Errorf("%d hosts in %s-%s are locked: %s", len(locked), proj, env, strings.Join(reasons, "; "))
+	}
+	if len(unlocked) == 0 {
+		return nil, skipped, fmt.Errorf("all hosts in %s-%s are locked: %s", proj, env, strings.Join(reasons, "; "))
+	}
+	reqlog.Infof(ctx, "Skipping %d locked hosts in %s-%s", len(locked), proj, env)
+	return config.HostList(unlocked), skipped, nil
+}
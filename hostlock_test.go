@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/preflight"
+	"golang.org/x/net/context"
+)
+
+func TestExcludeLockedHosts(t *testing.T) {
+	since := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	locks := hostlock.Locks{
+		"api/production/web2": {Reason: "investigating memory leak", By: "alice", Since: since},
+		// locks of the same host name in other environments do not matter
+		"api/staging/web1": {Reason: "load test", By: "bob", Since: since},
+	}
+	hosts := config.HostList{"web1", "web2", "web3"}
+	for _, spec := range []struct {
+		hosts  config.HostList
+		strict bool
+		want   config.HostList
+		// msg is a part of the error, or empty if the deployment proceeds.
+		msg string
+	}{
+		{hosts: hosts, want: config.HostList{"web1", "web3"}},
+		{hosts: config.HostList{"web1", "web3"}, strict: true, want: config.HostList{"web1", "web3"}},
+		{hosts: hosts, strict: true, msg: "1 hosts in api-production are locked: web2 locked by alice: investigating memory leak"},
+		{hosts: config.HostList{"web2"}, msg: "all hosts in api-production are locked"},
+	} {
+		var reported []string
+		got, skipped, err := excludeLockedHosts(context.Background(), "api", "production", spec.hosts, locks, spec.strict, func(line string) { reported = append(reported, line) })
+		if spec.msg != "" {
+			if err == nil || !strings.Contains(err.Error(), spec.msg) {
+				t.Errorf("excludeLockedHosts(ctx, %q, %q, %q, locks, %t, report) = %q, %v; want an error with %q", "api", "production", spec.hosts, spec.strict, got, err, spec.msg)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("excludeLockedHosts(ctx, %q, %q, %q, locks, %t, report) = %q, %v; want %q", "api", "production", spec.hosts, spec.strict, got, err, spec.want)
+		}
+
+		var wantSkipped []preflight.Failure
+		var wantReported []string
+		for _, h := range spec.hosts {
+			if h == "web2" {
+				wantSkipped = append(wantSkipped, preflight.Failure{Host: "web2", Reason: "locked by alice: investigating memory leak"})
+				wantReported = append(wantReported, "hostlock: web2: locked by alice: investigating memory leak")
+			}
+		}
+		if !reflect.DeepEqual(skipped, wantSkipped) {
+			t.Errorf("skipped hosts of %q = %#v; want %#v", spec.hosts, skipped, wantSkipped)
+		}
+		if !reflect.DeepEqual(reported, wantReported) {
+			t.Errorf("reported %q for %q; want %q", reported, spec.hosts, wantReported)
+		}
+	}
+}
+
+func TestOnlyHosts(t *testing.T) {
+	hosts := config.HostList{"web1", "web2", "web3"}
+	for _, spec := range []struct {
+		only []string
+		want config.HostList
+	}{
+		{want: hosts},
+		{only: []string{"web2"}, want: config.HostList{"web2"}},
+		{only: []string{"web3", "web1"}, want: config.HostList{"web1", "web3"}},
+		{only: []string{"web2", "web2"}, want: config.HostList{"web2"}},
+	} {
+		if got, err := onlyHosts("api", "production", hosts, spec.only); err != nil || !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("onlyHosts(%q, %q, %q, %q) = %q, %v; want %q", "api", "production", hosts, spec.only, got, err, spec.want)
+		}
+	}
+	for _, only := range [][]string{{"web4"}, {"web1", "web4"}} {
+		if got, err := onlyHosts("api", "production", hosts, only); err == nil {
+			t.Errorf("onlyHosts(%q, %q, %q, %q) = %q; want failure", "api", "production", hosts, only, got)
+		}
+	}
+}
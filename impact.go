@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// impactResponse is the impact of deploying a project which the user can see.
+type impactResponse struct {
+	config.Impact
+	// Hidden is the number of impacted environments of projects which the user cannot read.
+	Hidden int `json:"hidden,omitempty"`
+}
+
+// impactHandler returns the environments of other projects which depend on a project or which it depends on,
+// with their locks and next scheduled deployments, so that users see what deploying the project may break.
+// i.e. GET http://127.0.0.1:8000/api/v1/projects/lib/impact
+type impactHandler struct {
+	ac   acl.AccessControl
+	load func() (config.Config, error)
+	now  func() time.Time
+}
+
+func newImpactHandler(ac acl.AccessControl, ecl *etcd.Client) impactHandler {
+	return impactHandler{
+		ac:   ac,
+		load: func() (config.Config, error) { return config.Load(ecl) },
+		now:  time.Now,
+	}
+}
+
+func (h impactHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	components := strings.Split(r.URL.Path, "/")
+	if len(components) != 6 || components[4] == "" || components[5] != "impact" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := h.load()
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	proj, err := acl.FindProject(ac, c.Projects, u, components[4])
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := proj.SourceRepo()
+	if !ac.Readable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	imp, err := config.ProjectImpact(c.Projects, proj.Name, h.now())
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+
+	readable := make(map[string]bool)
+	for _, p := range acl.ReadableProjects(ac, c.Projects, u) {
+		readable[p.Name] = true
+	}
+	resp := impactResponse{Impact: imp}
+	resp.Environments = make([]config.ImpactedEnvironment, 0, len(imp.Environments))
+	for _, e := range imp.Environments {
+		if !readable[e.Project] {
+			resp.Hidden++
+			continue
+		}
+		resp.Environments = append(resp.Environments, e)
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
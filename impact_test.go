@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestImpactHandler(t *testing.T) {
+	c := config.Config{Projects: []config.Project{
+		{Name: "lib", Repo: config.Repo{RepoOwner: "gengo", RepoName: "lib"}, Impacts: []string{"api", "billing"}},
+		{
+			Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			Environments: []config.Environment{{Name: "production", Lock: &config.EnvironmentLock{By: "alice"}}},
+		},
+		{Name: "billing", Repo: config.Repo{RepoOwner: "gengo", RepoName: "billing"}, Environments: []config.Environment{{Name: "production"}}},
+	}}
+	h := impactHandler{
+		ac:   rowAccessControl{readable: map[string]bool{"lib": true, "api": true}},
+		load: func() (config.Config, error) { return c, nil },
+		now:  func() time.Time { return time.Date(2016, 5, 2, 12, 0, 0, 0, time.UTC) },
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest(%q, %q, nil) failed with %v", method, path, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("GET", "/api/v1/projects/lib/impact")
+	var resp impactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET impact of lib = %d %s; want the impact", w.Code, w.Body)
+	}
+	if len(resp.Environments) != 1 || resp.Environments[0].Project != "api" || !resp.Environments[0].Locked || resp.Hidden != 1 {
+		t.Errorf("impact of lib = %s; want api/production locked and billing hidden", w.Body)
+	}
+
+	for _, spec := range []struct {
+		method, path string
+		code         int
+	}{
+		{method: "GET", path: "/api/v1/projects/billing/impact", code: http.StatusForbidden},
+		{method: "GET", path: "/api/v1/projects/web/impact", code: http.StatusNotFound},
+		{method: "POST", path: "/api/v1/projects/lib/impact", code: http.StatusMethodNotAllowed},
+	} {
+		if w := serve(spec.method, spec.path); w.Code != spec.code {
+			t.Errorf("%s %s = %d %s; want %d", spec.method, spec.path, w.Code, w.Body, spec.code)
+		}
+	}
+}
@@ -30,3 +30,22 @@ func ReadableProjects(a AccessControl, projects []config.Project, u auth.User) [
 	}
 	return readables
 }
+
+// ResolveTarget is like config.ResolveTarget, but suggests only the projects readable by "u" instead of an unknown project,
+// so that the suggestions do not reveal the others.
+func ResolveTarget(a AccessControl, projects []config.Project, u auth.User, proj, env string) (*config.Project, *config.Environment, error) {
+	p, e, err := config.ResolveTarget(projects, proj, env)
+	if config.Cause(err) == config.ErrProjectNotFound {
+		_, _, err = config.ResolveTarget(ReadableProjects(a, projects, u), proj, env)
+	}
+	return p, e, err
+}
+
+// FindProject is like config.FindProject, but suggests only the projects readable by "u" like ResolveTarget.
+func FindProject(a AccessControl, projects []config.Project, u auth.User, name string) (*config.Project, error) {
+	p, err := config.FindProject(projects, name)
+	if err != nil {
+		_, err = config.FindProject(ReadableProjects(a, projects, u), name)
+	}
+	return p, err
+}
@@ -0,0 +1,50 @@
+package acl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+)
+
+func resolveFixture() (config.Config, auth.User) {
+	c := config.Config{
+		OIDC: &config.OIDCConfiguration{
+			Groups: []config.GroupRule{{Group: "contractors", Repos: []string{"gengo/billing"}}},
+		},
+		Projects: []config.Project{
+			{Name: "billing", Repo: config.Repo{RepoOwner: "gengo", RepoName: "billing"}, Environments: []config.Environment{{Name: "production"}}},
+			{Name: "bulling", Repo: config.Repo{RepoOwner: "gengo", RepoName: "bulling"}, Environments: []config.Environment{{Name: "production"}}},
+		},
+	}
+	return c, auth.User{Name: "contractor@example.com", Provider: auth.ProviderOIDC, Groups: []string{"contractors"}}
+}
+
+func TestResolveTarget(t *testing.T) {
+	c, u := resolveFixture()
+	ac := ForUser(Null, c, u)
+
+	_, _, err := ResolveTarget(ac, c.Projects, u, "bolling", "production")
+	if got, want := config.Suggestions(err), []string{"billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("config.Suggestions(%v) = %q; want %q", err, got, want)
+	}
+	// Readability is checked by the callers, so that they can tell not found from forbidden.
+	p, _, err := ResolveTarget(ac, c.Projects, u, "bulling", "production")
+	if err != nil || p != &c.Projects[1] {
+		t.Errorf("ResolveTarget(ac, projects, u, %q, %q) = %p, _, %v; want %p", "bulling", "production", p, err, &c.Projects[1])
+	}
+}
+
+func TestFindProject(t *testing.T) {
+	c, u := resolveFixture()
+	ac := ForUser(Null, c, u)
+
+	_, err := FindProject(ac, c.Projects, u, "bolling")
+	if got, want := config.Suggestions(err), []string{"billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("config.Suggestions(%v) = %q; want %q", err, got, want)
+	}
+	if p, err := FindProject(ac, c.Projects, u, "bulling"); err != nil || p != &c.Projects[1] {
+		t.Errorf("FindProject(ac, projects, u, %q) = %p, %v; want %p", "bulling", p, err, &c.Projects[1])
+	}
+}
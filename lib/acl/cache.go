@@ -0,0 +1,57 @@
+package acl
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheKey identifies a permission check.
+type cacheKey struct {
+	deploy            bool
+	owner, repo, user string
+}
+
+type cacheEntry struct {
+	allowed   bool
+	checkedAt time.Time
+}
+
+// cachingAccessControl remembers results of permission checks of another AccessControl.
+type cachingAccessControl struct {
+	ac  AccessControl
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+// NewCache returns an AccessControl which remembers results of "ac" for "ttl",
+// so that repeated checks do not reach the upstream of "ac".
+func NewCache(ac AccessControl, ttl time.Duration) AccessControl {
+	return &cachingAccessControl{ac: ac, ttl: ttl, now: time.Now, entries: make(map[cacheKey]cacheEntry)}
+}
+
+// Readable determines if "user" is allowed to read the repository with the cached result if any.
+func (c *cachingAccessControl) Readable(owner, repo, user string) bool {
+	return c.check(cacheKey{owner: owner, repo: repo, user: user}, c.ac.Readable)
+}
+
+// Deployable determines if "user" is allowed to deploy from the repository with the cached result if any.
+func (c *cachingAccessControl) Deployable(owner, repo, user string) bool {
+	return c.check(cacheKey{deploy: true, owner: owner, repo: repo, user: user}, c.ac.Deployable)
+}
+
+func (c *cachingAccessControl) check(key cacheKey, f func(owner, repo, user string) bool) bool {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Sub(e.checkedAt) < c.ttl {
+		return e.allowed
+	}
+	e = cacheEntry{allowed: f(key.owner, key.repo, key.user), checkedAt: c.now()}
+	c.mu.Lock()
+	c.entries[key] = e
+	c.mu.Unlock()
+	return e.allowed
+}
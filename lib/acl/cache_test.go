@@ -0,0 +1,48 @@
+package acl
+
+import (
+	"testing"
+	"time"
+)
+
+// countingAccessControl allows only "alice" and counts checks.
+type countingAccessControl struct {
+	calls int
+}
+
+func (c *countingAccessControl) Readable(owner, repo, user string) bool {
+	c.calls++
+	return user == "alice"
+}
+
+func (c *countingAccessControl) Deployable(owner, repo, user string) bool {
+	c.calls++
+	return user == "alice"
+}
+
+func TestCache(t *testing.T) {
+	var (
+		upstream countingAccessControl
+		now      = time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC)
+	)
+	ac := NewCache(&upstream, time.Minute).(*cachingAccessControl)
+	ac.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !ac.Readable("gengo", "goship", "alice") {
+			t.Errorf("ac.Readable(%q, %q, %q) = false; want true", "gengo", "goship", "alice")
+		}
+		if ac.Deployable("gengo", "goship", "bob") {
+			t.Errorf("ac.Deployable(%q, %q, %q) = true; want false", "gengo", "goship", "bob")
+		}
+	}
+	if got, want := upstream.calls, 2; got != want {
+		t.Errorf("upstream.calls = %d; want %d", got, want)
+	}
+
+	now = now.Add(time.Minute)
+	ac.Readable("gengo", "goship", "alice")
+	if got, want := upstream.calls, 3; got != want {
+		t.Errorf("upstream.calls = %d after expiry; want %d", got, want)
+	}
+}
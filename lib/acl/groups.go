@@ -0,0 +1,59 @@
+package acl
+
+import (
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+)
+
+// groupAccessControl determines permissions of a user by the groups of the user.
+type groupAccessControl struct {
+	rules  []config.GroupRule
+	groups []string
+}
+
+// ForUser returns the AccessControl which determines permissions of "u".
+// Users who logged in with OpenID Connect, or whose API tokens were created so, get permissions by the group rules in "c",
+// and others by "ac".
+func ForUser(ac AccessControl, c config.Config, u auth.User) AccessControl {
+	if u.Origin() != auth.ProviderOIDC {
+		return ac
+	}
+	var rules []config.GroupRule
+	if c.OIDC != nil {
+		rules = c.OIDC.Groups
+	}
+	return groupAccessControl{rules: rules, groups: u.Groups}
+}
+
+// Readable returns true iff any group of the user has a rule on the repository.
+func (g groupAccessControl) Readable(owner, repo, user string) bool {
+	return g.allows(owner, repo, false)
+}
+
+// Deployable returns true iff any group of the user has a rule on the repository which allows deployment.
+func (g groupAccessControl) Deployable(owner, repo, user string) bool {
+	return g.allows(owner, repo, true)
+}
+
+func (g groupAccessControl) allows(owner, repo string, deploy bool) bool {
+	for _, r := range g.rules {
+		if deploy && !r.Deploy || !g.member(r.Group) {
+			continue
+		}
+		for _, pat := range r.Repos {
+			if pat == "*" || pat == owner+"/*" || pat == owner+"/"+repo {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g groupAccessControl) member(group string) bool {
+	for _, gr := range g.groups {
+		if gr == group {
+			return true
+		}
+	}
+	return false
+}
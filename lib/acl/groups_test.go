@@ -0,0 +1,48 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestForUser(t *testing.T) {
+	c := config.Config{
+		OIDC: &config.OIDCConfiguration{
+			Groups: []config.GroupRule{
+				{Group: "ops", Repos: []string{"gengo/*"}, Deploy: true},
+				{Group: "contractors", Repos: []string{"gengo/goship"}},
+				{Group: "auditors", Repos: []string{"*"}},
+			},
+		},
+	}
+	for _, spec := range []struct {
+		groups           []string
+		owner, repo      string
+		read, deployable bool
+	}{
+		{groups: []string{"ops"}, owner: "gengo", repo: "goship", read: true, deployable: true},
+		{groups: []string{"ops"}, owner: "other", repo: "goship"},
+		{groups: []string{"contractors"}, owner: "gengo", repo: "goship", read: true},
+		{groups: []string{"contractors"}, owner: "gengo", repo: "api"},
+		{groups: []string{"contractors", "ops"}, owner: "gengo", repo: "api", read: true, deployable: true},
+		{groups: []string{"auditors"}, owner: "other", repo: "repo", read: true},
+		{groups: nil, owner: "gengo", repo: "goship"},
+	} {
+		u := auth.User{Name: "contractor@example.com", Provider: auth.ProviderOIDC, Groups: spec.groups}
+		ac := ForUser(Null, c, u)
+		if got := ac.Readable(spec.owner, spec.repo, u.Name); got != spec.read {
+			t.Errorf("Readable(%q, %q) for %q = %v; want %v", spec.owner, spec.repo, spec.groups, got, spec.read)
+		}
+		if got := ac.Deployable(spec.owner, spec.repo, u.Name); got != spec.deployable {
+			t.Errorf("Deployable(%q, %q) for %q = %v; want %v", spec.owner, spec.repo, spec.groups, got, spec.deployable)
+		}
+	}
+
+	// GitHub users are not affected by the group rules.
+	u := auth.User{Name: "alice", Provider: auth.ProviderGithub, Groups: []string{"ops"}}
+	if ac := ForUser(Null, c, u); ac != Null {
+		t.Errorf("ForUser(Null, c, %#v) = %#v; want Null", u, ac)
+	}
+}
@@ -0,0 +1,241 @@
+// Package activity records what happened in goship, e.g. deployments, locks and comments, into a chronological feed in etcd.
+// Entries are denormalized so that they can be rendered without looking up projects or users.
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains entries keyed by their IDs.
+	keyPrefix = "/goship/activity"
+
+	// subscriberBuffer is the number of entries buffered for a subscriber. Slower subscribers miss entries.
+	subscriberBuffer = 64
+)
+
+// Types of entries
+const (
+	DeployStarted   = "deploy_started"
+	DeploySucceeded = "deploy_succeeded"
+	DeployFailed    = "deploy_failed"
+	Locked          = "locked"
+	Unlocked        = "unlocked"
+	Commented       = "commented"
+	// ConfigChanged means that the config was changed, e.g. an environment was cloned or a project was renamed.
+	ConfigChanged = "config_changed"
+	// HostKeyApproved means that an admin approved an SSH host key.
+	HostKeyApproved = "host_key_approved"
+	// SecretRevealed means that an admin revealed a secret value of the config.
+	SecretRevealed = "secret_revealed"
+	// HostsChanged means that hosts were added to or removed from an environment.
+	HostsChanged = "hosts_changed"
+	// BlocklistChanged means that an admin added a commit to or removed one from the blocklist.
+	BlocklistChanged = "blocklist_changed"
+	// BlocklistOverridden means that a user deployed blocklisted commits on purpose.
+	BlocklistOverridden = "blocklist_overridden"
+	// BakeOverridden means that a user deployed a revision which had not baked long enough on purpose.
+	BakeOverridden = "bake_overridden"
+	// ScheduleSkipped means that a scheduled deployment did not run, e.g. since the environment was locked.
+	ScheduleSkipped = "schedule_skipped"
+)
+
+// Entry is something which happened in goship.
+type Entry struct {
+	// ID identifies the entry. IDs are ordered by Time, so that they work as cursors of pagination.
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Project     string    `json:"project,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	User        string    `json:"user,omitempty"`
+	// Summary is a human readable description of the entry.
+	Summary string `json:"summary"`
+	// URL is a page which describes the entry in detail, e.g. the output of a deployment.
+	URL string `json:"url,omitempty"`
+}
+
+// Store is the subset of etcd.Client which stores entries.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Feed records entries into a Store and publishes them to the subscribers in this instance.
+type Feed struct {
+	s   Store
+	now func() time.Time
+
+	mu sync.Mutex
+	// last is the timestamp of the last ID, so that IDs are unique in this instance.
+	last int64
+	subs map[chan Entry]struct{}
+}
+
+// NewFeed returns a new Feed which records entries into "s".
+func NewFeed(s Store) *Feed {
+	return &Feed{s: s, now: time.Now, subs: make(map[chan Entry]struct{})}
+}
+
+// Record stores "e" with a new ID and the current time, and publishes it to the subscribers.
+// Failures are logged but not returned since they should not fail what is being recorded. A nil Feed records nothing.
+func (f *Feed) Record(e Entry) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.Time = f.now()
+	ts := e.Time.UnixNano()
+	if ts <= f.last {
+		ts = f.last + 1
+	}
+	f.last = ts
+	e.ID = fmt.Sprintf("%020d", ts)
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		glog.Errorf("Failed to marshal activity %#v: %v", e, err)
+		return
+	}
+	if _, err := f.s.Set(path.Join(keyPrefix, e.ID), string(buf), 0); err != nil {
+		glog.Errorf("Failed to record activity %q: %v", e.Summary, err)
+		return
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- e:
+		default:
+			glog.Warningf("Dropped activity %s for a slow subscriber", e.ID)
+		}
+	}
+}
+
+// Subscribe returns a channel which receives entries recorded afterwards by this Feed, and a function which unsubscribes it.
+func (f *Feed) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, subscriberBuffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+	}
+}
+
+// Query selects entries to list.
+type Query struct {
+	// Limit is the maximum number of entries to list. Zero means no limit.
+	Limit int
+	// Before is the cursor to list entries older than. Entries are listed from the newest if empty.
+	Before string
+	// Project and Type select entries of the project and type if not empty.
+	Project, Type string
+	// Visible selects entries if not nil, e.g. ones of projects readable by a user.
+	Visible func(Entry) bool
+}
+
+// Page is a page of entries from the newest.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	// Next is the cursor of the next page, or empty if this is the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// Matches returns true if "e" is selected by "q" regardless of Limit and Before.
+func (q Query) Matches(e Entry) bool {
+	if q.Project != "" && e.Project != q.Project {
+		return false
+	}
+	if q.Type != "" && e.Type != q.Type {
+		return false
+	}
+	return q.Visible == nil || q.Visible(e)
+}
+
+// List returns the entries in "s" selected by "q" from the newest.
+func List(s Store, q Query) (Page, error) {
+	stored, err := listEntries(s)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Entries: []Entry{}}
+	for i := len(stored) - 1; i >= 0; i-- {
+		if q.Before != "" && stored[i].id >= q.Before {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(stored[i].value), &e); err != nil {
+			return Page{}, fmt.Errorf("malformed activity %s: %v", stored[i].id, err)
+		}
+		if !q.Matches(e) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Entries) == q.Limit {
+			page.Next = page.Entries[len(page.Entries)-1].ID
+			break
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	return page, nil
+}
+
+type storedEntry struct {
+	id, value string
+}
+
+// listEntries returns the stored entries from the oldest.
+func listEntries(s Store) ([]storedEntry, error) {
+	resp, err := s.Get(keyPrefix, true, false)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []storedEntry
+	for _, n := range resp.Node.Nodes {
+		entries = append(entries, storedEntry{id: path.Base(n.Key), value: n.Value})
+	}
+	sort.Sort(byID(entries))
+	return entries, nil
+}
+
+// Prune deletes entries in "s" which are older than or beyond the most recent ones allowed by "p" at "now".
+// It returns the number of deleted entries.
+func Prune(s Store, p config.RetentionPolicy, now time.Time) (int, error) {
+	entries, err := listEntries(s)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := fmt.Sprintf("%020d", now.Add(-time.Duration(p.MaxAgeDays)*24*time.Hour).UnixNano())
+	var pruned int
+	for i, e := range entries {
+		rank := len(entries) - 1 - i
+		if (p.MaxCount > 0 && rank >= p.MaxCount) || (p.MaxAgeDays > 0 && e.id < cutoff) {
+			if _, err := s.Delete(path.Join(keyPrefix, e.id), false); err != nil && !etcderr.IsKeyNotFound(err) {
+				return pruned, err
+			}
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+type byID []storedEntry
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byID) Less(i, j int) bool { return b[i].id < b[j].id }
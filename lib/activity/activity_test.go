@@ -0,0 +1,130 @@
+package activity
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestFeed returns a Feed whose clock is fixed at "now", so that IDs of entries recorded at once must still be unique.
+func newTestFeed(s Store) *Feed {
+	f := NewFeed(s)
+	f.now = func() time.Time { return now }
+	return f
+}
+
+func summaries(entries []Entry) []string {
+	var s []string
+	for _, e := range entries {
+		s = append(s, e.Summary)
+	}
+	return s
+}
+
+func TestListPagination(t *testing.T) {
+	s := etcdtest.NewStore()
+	f := newTestFeed(s)
+	for i := 0; i < 7; i++ {
+		proj := "goship"
+		if i%2 == 1 {
+			proj = "other"
+		}
+		f.Record(Entry{Type: Locked, Project: proj, Summary: fmt.Sprintf("entry %d", i)})
+	}
+
+	var got []string
+	q := Query{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("List(s, q) did not reach the last page")
+		}
+		page, err := List(s, q)
+		if err != nil {
+			t.Fatalf("List(s, %#v) failed with %v", q, err)
+		}
+		if len(page.Entries) > q.Limit {
+			t.Errorf("List(s, %#v) returned %d entries; want at most %d", q, len(page.Entries), q.Limit)
+		}
+		got = append(got, summaries(page.Entries)...)
+		if page.Next == "" {
+			break
+		}
+		q.Before = page.Next
+	}
+	want := []string{"entry 6", "entry 5", "entry 4", "entry 3", "entry 2", "entry 1", "entry 0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries over pages = %q; want %q", got, want)
+	}
+
+	// a new entry does not shift pages after the cursor.
+	page, err := List(s, Query{Limit: 2, Project: "goship"})
+	if err != nil {
+		t.Fatalf("List(s, q) failed with %v", err)
+	}
+	if got, want := summaries(page.Entries), []string{"entry 6", "entry 4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first page of goship = %q; want %q", got, want)
+	}
+	f.Record(Entry{Type: Locked, Project: "goship", Summary: "entry 7"})
+	page, err = List(s, Query{Limit: 2, Project: "goship", Before: page.Next})
+	if err != nil {
+		t.Fatalf("List(s, q) failed with %v", err)
+	}
+	if got, want := summaries(page.Entries), []string{"entry 2", "entry 0"}; !reflect.DeepEqual(got, want) || page.Next != "" {
+		t.Errorf("second page of goship = %q, next %q; want %q on the last page", got, page.Next, want)
+	}
+
+	page, err = List(s, Query{Type: Commented})
+	if err != nil || len(page.Entries) != 0 {
+		t.Errorf("List(s, {Type: %q}) = %#v, %v; want no entries", Commented, page, err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	f := newTestFeed(etcdtest.NewStore())
+	ch, cancel := f.Subscribe()
+	f.Record(Entry{Type: Commented, Project: "goship", Environment: "staging", User: "alice", Summary: "alice commented"})
+	select {
+	case e := <-ch:
+		if e.Summary != "alice commented" || e.ID == "" || !e.Time.Equal(now) {
+			t.Errorf("subscribed entry = %#v; want the recorded one with its ID and time", e)
+		}
+	default:
+		t.Errorf("subscriber received nothing; want the recorded entry")
+	}
+
+	cancel()
+	f.Record(Entry{Type: Commented, Summary: "after cancel"})
+	select {
+	case e := <-ch:
+		t.Errorf("subscriber received %#v after cancel; want nothing", e)
+	default:
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := etcdtest.NewStore()
+	f := NewFeed(s)
+	for i := 0; i < 5; i++ {
+		at := now.Add(-time.Duration(5-i) * 24 * time.Hour)
+		f.now = func() time.Time { return at }
+		f.Record(Entry{Type: Locked, Summary: fmt.Sprintf("%d days ago", 5-i)})
+	}
+	n, err := Prune(s, config.RetentionPolicy{MaxAgeDays: 3}, now)
+	if err != nil || n != 2 {
+		t.Errorf("Prune(s, {MaxAgeDays: 3}, now) = %d, %v; want 2", n, err)
+	}
+	n, err = Prune(s, config.RetentionPolicy{MaxCount: 1}, now)
+	if err != nil || n != 2 {
+		t.Errorf("Prune(s, {MaxCount: 1}, now) = %d, %v; want 2", n, err)
+	}
+	page, err := List(s, Query{})
+	if got, want := summaries(page.Entries), []string{"1 days ago"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("List(s, q) = %q, %v after pruning; want %q", got, err, want)
+	}
+}
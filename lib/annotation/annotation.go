@@ -0,0 +1,308 @@
+// Package annotation manages announcements pinned to environments, e.g. "DB migration in progress, expect elevated latency".
+// Annotations are stored apart from the configuration like drains, and disappear when they expire or are dismissed.
+package annotation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains annotations in "<project>/<environment>/<id>".
+	keyPrefix = "/goship/annotations"
+)
+
+// Store is the subset of etcd.Client which stores annotations.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Severity is how serious an annotation is.
+type Severity string
+
+// Severities of annotations
+const (
+	Info     Severity = "info"
+	Warning  Severity = "warning"
+	Critical Severity = "critical"
+)
+
+// rank orders severities from the most serious one.
+func (s Severity) rank() int {
+	switch s {
+	case Critical:
+		return 0
+	case Warning:
+		return 1
+	}
+	return 2
+}
+
+// Valid returns true iff "s" is a known severity.
+func (s Severity) Valid() bool {
+	return s == Info || s == Warning || s == Critical
+}
+
+// Annotation is an announcement pinned to an environment.
+type Annotation struct {
+	ID          string   `json:"id"`
+	Project     string   `json:"project"`
+	Environment string   `json:"environment"`
+	Message     string   `json:"message"`
+	Severity    Severity `json:"severity"`
+	// By is the user who annotated the environment last.
+	By      string    `json:"by"`
+	Created time.Time `json:"created"`
+	// Until is when the annotation expires. It is nil if the annotation lasts until dismissed.
+	Until *time.Time `json:"until,omitempty"`
+	// BlocksDeploys refuses deployments into the environment while the annotation is active. Only critical annotations can block.
+	BlocksDeploys bool `json:"blocks_deploys,omitempty"`
+}
+
+// Params are the fields of an annotation which users write.
+type Params struct {
+	Message       string   `json:"message"`
+	Severity      Severity `json:"severity"`
+	BlocksDeploys bool     `json:"blocks_deploys,omitempty"`
+	// TTL is how long the annotation lasts, e.g. "2h". It lasts until dismissed if empty.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// ttl returns the lifetime of the annotation, or an error if "p" is malformed.
+func (p Params) ttl() (time.Duration, error) {
+	if strings.TrimSpace(p.Message) == "" {
+		return 0, fmt.Errorf("message: no message specified")
+	}
+	if !p.Severity.Valid() {
+		return 0, fmt.Errorf("severity: must be %s, %s or %s", Info, Warning, Critical)
+	}
+	if p.BlocksDeploys && p.Severity != Critical {
+		return 0, fmt.Errorf("blocks_deploys: only %s annotations can block deployments", Critical)
+	}
+	if p.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(p.TTL)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("ttl: must be a positive duration, e.g. 2h")
+	}
+	return ttl, nil
+}
+
+// expired returns true iff the annotation has expired by "now".
+func (a Annotation) expired(now time.Time) bool {
+	return a.Until != nil && !now.Before(*a.Until)
+}
+
+// Blocking returns true iff "a" refuses deployments.
+func (a Annotation) Blocking() bool {
+	return a.BlocksDeploys && a.Severity == Critical
+}
+
+func key(proj, env, id string) (string, error) {
+	for _, name := range []string{proj, env, id} {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid name %q", name)
+		}
+	}
+	return path.Join(keyPrefix, proj, env, id), nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Create pins a new annotation with "p" to "env" of "proj" on behalf of "by".
+func Create(s Store, proj, env, by string, p Params, now time.Time) (Annotation, error) {
+	ttl, err := p.ttl()
+	if err != nil {
+		return Annotation{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Annotation{}, err
+	}
+	return store(s, Annotation{ID: id, Project: proj, Environment: env, By: by, Created: now}, p, ttl, now)
+}
+
+// Update replaces the fields of the annotation "id" of "env" of "proj" with "p" on behalf of "by".
+// The expiry is counted from "now".
+func Update(s Store, proj, env, id, by string, p Params, now time.Time) (Annotation, error) {
+	ttl, err := p.ttl()
+	if err != nil {
+		return Annotation{}, err
+	}
+	a, err := get(s, proj, env, id, now)
+	if err != nil {
+		return Annotation{}, err
+	}
+	a.By = by
+	return store(s, a, p, ttl, now)
+}
+
+// store stores "a" with the fields in "p" so that etcd clears it after "ttl" unless "ttl" is zero, and returns the stored one.
+func store(s Store, a Annotation, p Params, ttl time.Duration, now time.Time) (Annotation, error) {
+	k, err := key(a.Project, a.Environment, a.ID)
+	if err != nil {
+		return Annotation{}, err
+	}
+	a.Message, a.Severity, a.BlocksDeploys, a.Until = strings.TrimSpace(p.Message), p.Severity, p.BlocksDeploys, nil
+	var seconds uint64
+	if ttl > 0 {
+		until := now.Add(ttl)
+		a.Until = &until
+		// rounds up so that etcd does not clear the annotation before Until.
+		seconds = uint64((ttl + time.Second - 1) / time.Second)
+	}
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return Annotation{}, err
+	}
+	if _, err := s.Set(k, string(buf), seconds); err != nil {
+		return Annotation{}, err
+	}
+	return a, nil
+}
+
+// ErrNotFound means that the annotation does not exist or has expired.
+var ErrNotFound = fmt.Errorf("annotation not found")
+
+func get(s Store, proj, env, id string, now time.Time) (Annotation, error) {
+	k, err := key(proj, env, id)
+	if err != nil {
+		return Annotation{}, err
+	}
+	resp, err := s.Get(k, false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return Annotation{}, ErrNotFound
+	}
+	if err != nil {
+		return Annotation{}, err
+	}
+	var a Annotation
+	if err := json.Unmarshal([]byte(resp.Node.Value), &a); err != nil {
+		return Annotation{}, fmt.Errorf("malformed annotation %s: %v", k, err)
+	}
+	if a.expired(now) {
+		return Annotation{}, ErrNotFound
+	}
+	return a, nil
+}
+
+// Dismiss removes the annotation "id" of "env" of "proj". It is ErrNotFound if there is no such annotation.
+func Dismiss(s Store, proj, env, id string) error {
+	k, err := key(proj, env, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Delete(k, false); err != nil {
+		if etcderr.IsKeyNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Annotations are active annotations keyed by "<project>/<environment>".
+type Annotations map[string][]Annotation
+
+// Load returns the annotations active at "now". Those of each environment are sorted from the most serious one,
+// and then from the newest one.
+func Load(s Store, now time.Time) (Annotations, error) {
+	resp, err := s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return Annotations{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	as := make(Annotations)
+	var walk func(n *etcd.Node) error
+	walk = func(n *etcd.Node) error {
+		if n.Dir {
+			for _, c := range n.Nodes {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		var a Annotation
+		if err := json.Unmarshal([]byte(n.Value), &a); err != nil {
+			return fmt.Errorf("malformed annotation %s: %v", n.Key, err)
+		}
+		if !a.expired(now) {
+			k := path.Join(a.Project, a.Environment)
+			as[k] = append(as[k], a)
+		}
+		return nil
+	}
+	if err := walk(resp.Node); err != nil {
+		return nil, err
+	}
+	for _, list := range as {
+		sort.Sort(bySeverity(list))
+	}
+	return as, nil
+}
+
+// Of returns the active annotations of "env" of "proj".
+func (as Annotations) Of(proj, env string) []Annotation {
+	return as[path.Join(proj, env)]
+}
+
+// Rename moves the annotations of the project "from" to the project "to" as of "now".
+func Rename(s Store, from, to string, now time.Time) error {
+	as, err := Load(s, now)
+	if err != nil {
+		return err
+	}
+	for _, list := range as {
+		for _, a := range list {
+			if a.Project != from {
+				continue
+			}
+			p := Params{Message: a.Message, Severity: a.Severity, BlocksDeploys: a.BlocksDeploys}
+			var ttl time.Duration
+			if a.Until != nil {
+				ttl = a.Until.Sub(now)
+			}
+			moved := a
+			moved.Project = to
+			if _, err := store(s, moved, p, ttl, now); err != nil {
+				return err
+			}
+			if err := Dismiss(s, from, a.Environment, a.ID); err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type bySeverity []Annotation
+
+func (as bySeverity) Len() int      { return len(as) }
+func (as bySeverity) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
+func (as bySeverity) Less(i, j int) bool {
+	if ri, rj := as[i].Severity.rank(), as[j].Severity.rank(); ri != rj {
+		return ri < rj
+	}
+	return as[i].Created.After(as[j].Created)
+}
@@ -0,0 +1,144 @@
+package annotation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestCreateValidation(t *testing.T) {
+	for _, spec := range []struct {
+		params Params
+		ok     bool
+	}{
+		{params: Params{Message: "DB migration in progress", Severity: Info}, ok: true},
+		{params: Params{Message: "DB migration in progress", Severity: Critical, BlocksDeploys: true, TTL: "2h"}, ok: true},
+		{params: Params{Message: " ", Severity: Info}},
+		{params: Params{Message: "DB migration in progress", Severity: "fatal"}},
+		{params: Params{Message: "DB migration in progress", Severity: Warning, BlocksDeploys: true}},
+		{params: Params{Message: "DB migration in progress", Severity: Info, TTL: "-1h"}},
+		{params: Params{Message: "DB migration in progress", Severity: Info, TTL: "soon"}},
+	} {
+		s := etcdtest.NewStore()
+		_, err := Create(s, "api", "production", "alice", spec.params, now)
+		if spec.ok && err != nil {
+			t.Errorf("Create(s, %q, %q, %q, %#v, now) failed with %v", "api", "production", "alice", spec.params, err)
+		}
+		if !spec.ok && err == nil {
+			t.Errorf("Create(s, %q, %q, %q, %#v, now) succeeded; want failure", "api", "production", "alice", spec.params)
+		}
+		if !spec.ok && len(s.Values) != 0 {
+			t.Errorf("Create(s, %q, %q, %q, %#v, now) stored %v; want nothing", "api", "production", "alice", spec.params, s.Values)
+		}
+	}
+}
+
+func TestLoadSkipsExpired(t *testing.T) {
+	s := etcdtest.NewStore()
+	if as, err := Load(s, now); err != nil || len(as) != 0 {
+		t.Fatalf("Load(s, now) = %v, %v; want no annotations", as, err)
+	}
+	info, err := Create(s, "api", "production", "alice", Params{Message: "new dashboards", Severity: Info}, now)
+	if err != nil {
+		t.Fatalf("Create(info) failed with %v", err)
+	}
+	crit, err := Create(s, "api", "production", "bob", Params{Message: "DB migration", Severity: Critical, TTL: "90m"}, now)
+	if err != nil {
+		t.Fatalf("Create(critical) failed with %v", err)
+	}
+	if _, err := Create(s, "api", "staging", "bob", Params{Message: "flaky", Severity: Warning}, now); err != nil {
+		t.Fatalf("Create(warning) failed with %v", err)
+	}
+	k, _ := key("api", "production", crit.ID)
+	if got, want := s.TTLs[k], uint64(90*60); got != want {
+		t.Errorf("ttl of %s = %d; want %d", k, got, want)
+	}
+
+	as, err := Load(s, now.Add(89*time.Minute))
+	if err != nil {
+		t.Fatalf("Load(s, now+89m) failed with %v", err)
+	}
+	// the most serious one first
+	if got := ids(as.Of("api", "production")); !reflect.DeepEqual(got, []string{crit.ID, info.ID}) {
+		t.Errorf("annotations of api-production = %v; want %v", got, []string{crit.ID, info.ID})
+	}
+	if got := as.Of("api", "staging"); len(got) != 1 || got[0].Severity != Warning {
+		t.Errorf("annotations of api-staging = %v; want the warning", got)
+	}
+
+	// etcd may not have cleared it yet.
+	as, err = Load(s, now.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("Load(s, now+90m) failed with %v", err)
+	}
+	if got := ids(as.Of("api", "production")); !reflect.DeepEqual(got, []string{info.ID}) {
+		t.Errorf("annotations of api-production after expiry = %v; want %v", got, []string{info.ID})
+	}
+	if _, err := Update(s, "api", "production", crit.ID, "bob", Params{Message: "still migrating", Severity: Critical}, now.Add(2*time.Hour)); err != ErrNotFound {
+		t.Errorf("Update(expired) failed with %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestUpdateAndDismiss(t *testing.T) {
+	s := etcdtest.NewStore()
+	a, err := Create(s, "api", "production", "alice", Params{Message: "DB migration", Severity: Warning, TTL: "1h"}, now)
+	if err != nil {
+		t.Fatalf("Create failed with %v", err)
+	}
+	later := now.Add(30 * time.Minute)
+	got, err := Update(s, "api", "production", a.ID, "bob", Params{Message: "DB migration stuck", Severity: Critical, BlocksDeploys: true}, later)
+	if err != nil {
+		t.Fatalf("Update failed with %v", err)
+	}
+	if got.ID != a.ID || got.By != "bob" || !got.Created.Equal(now) || got.Until != nil || !got.Blocking() {
+		t.Errorf("Update(...) = %#v; want the blocking annotation %s by bob without expiry", got, a.ID)
+	}
+	k, _ := key("api", "production", a.ID)
+	if ttl := s.TTLs[k]; ttl != 0 {
+		t.Errorf("ttl of %s = %d; want none", k, ttl)
+	}
+
+	if err := Dismiss(s, "api", "production", a.ID); err != nil {
+		t.Fatalf("Dismiss failed with %v", err)
+	}
+	if err := Dismiss(s, "api", "production", a.ID); err != ErrNotFound {
+		t.Errorf("Dismiss again failed with %v; want %v", err, ErrNotFound)
+	}
+	if err := Dismiss(s, "api", "production", "../x"); err == nil {
+		t.Errorf("Dismiss(%q) succeeded; want failure", "../x")
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := etcdtest.NewStore()
+	a, err := Create(s, "api", "production", "alice", Params{Message: "DB migration", Severity: Critical, BlocksDeploys: true, TTL: "1h"}, now)
+	if err != nil {
+		t.Fatalf("Create failed with %v", err)
+	}
+	if err := Rename(s, "api", "gateway", now.Add(10*time.Minute)); err != nil {
+		t.Fatalf("Rename failed with %v", err)
+	}
+	as, err := Load(s, now.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("Load failed with %v", err)
+	}
+	if got := as.Of("api", "production"); len(got) != 0 {
+		t.Errorf("annotations of api-production = %v; want none", got)
+	}
+	got := as.Of("gateway", "production")
+	if len(got) != 1 || got[0].ID != a.ID || !got[0].Until.Equal(*a.Until) || !got[0].Blocking() {
+		t.Errorf("annotations of gateway-production = %v; want %v", got, a)
+	}
+}
+
+func ids(as []Annotation) []string {
+	var ids []string
+	for _, a := range as {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
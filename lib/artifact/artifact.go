@@ -0,0 +1,101 @@
+// Package artifact parses artifacts which deploy commands declare in their output, e.g.
+//
+//	GOSHIP_ARTIFACT tarball https://builds.example.com/api-1234.tar.gz
+//
+// Artifacts are recorded with the deployment and linked from its history and notifications.
+// Lines which are not valid declarations are ordinary output.
+package artifact
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// Directive is the first word of lines which declare artifacts.
+	Directive = "GOSHIP_ARTIFACT"
+	// DefaultLimit is the number of artifacts recorded per deployment unless configured.
+	DefaultLimit = 10
+	// maxNameLen is the longest name of artifacts.
+	maxNameLen = 64
+)
+
+// Artifact is a product of a deployment, e.g. a build tarball, a changelog or a test report.
+type Artifact struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Parse returns the artifact declared by "line" in the form of "GOSHIP_ARTIFACT <name> <url>".
+// It returns false if "line" is not a declaration or the URL is not an absolute http(s) URL.
+func Parse(line string) (Artifact, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != Directive {
+		return Artifact{}, false
+	}
+	name, raw := fields[1], fields[2]
+	if len(name) > maxNameLen {
+		return Artifact{}, false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Artifact{}, false
+	}
+	return Artifact{Name: name, URL: u.String()}, true
+}
+
+// Collector collects artifacts declared in lines of output of a deployment up to a limit.
+// It is safe for concurrent use since stdout and stderr are scanned concurrently.
+type Collector struct {
+	limit int
+
+	mu        sync.Mutex
+	artifacts []Artifact
+	dropped   int
+}
+
+// NewCollector returns a Collector which records up to "limit" artifacts, or DefaultLimit if "limit" is not positive.
+func NewCollector(limit int) *Collector {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Collector{limit: limit}
+}
+
+// Scan records the artifact declared by "line" if any, and returns true if it is a valid declaration.
+// An artifact replaces the one declared earlier with the same name. Artifacts over the limit are dropped.
+func (c *Collector) Scan(line string) bool {
+	a, ok := Parse(line)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, prev := range c.artifacts {
+		if prev.Name == a.Name {
+			c.artifacts[i] = a
+			return true
+		}
+	}
+	if len(c.artifacts) >= c.limit {
+		c.dropped++
+		return true
+	}
+	c.artifacts = append(c.artifacts, a)
+	return true
+}
+
+// Artifacts returns the recorded artifacts in the order of declaration.
+func (c *Collector) Artifacts() []Artifact {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Artifact(nil), c.artifacts...)
+}
+
+// Dropped returns the number of artifacts dropped over the limit.
+func (c *Collector) Dropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
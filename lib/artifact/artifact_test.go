@@ -0,0 +1,86 @@
+package artifact_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/artifact"
+)
+
+func TestParse(t *testing.T) {
+	for _, spec := range []struct {
+		line string
+		want artifact.Artifact
+		ok   bool
+	}{
+		{
+			line: "GOSHIP_ARTIFACT tarball https://builds.example.com/api-1234.tar.gz",
+			want: artifact.Artifact{Name: "tarball", URL: "https://builds.example.com/api-1234.tar.gz"},
+			ok:   true,
+		},
+		{
+			line: "  GOSHIP_ARTIFACT report\thttp://ci.example.com/report?build=1234  ",
+			want: artifact.Artifact{Name: "report", URL: "http://ci.example.com/report?build=1234"},
+			ok:   true,
+		},
+		{line: "Deploying api to web-001"},
+		{line: "GOSHIP_ARTIFACT tarball"},
+		{line: "GOSHIP_ARTIFACT test report https://ci.example.com/report"},
+		{line: "GOSHIP_ARTIFACT tarball /builds/api-1234.tar.gz"},
+		{line: "GOSHIP_ARTIFACT tarball javascript:alert(1)"},
+		{line: "GOSHIP_ARTIFACT tarball ftp://builds.example.com/api.tar.gz"},
+		{line: "GOSHIP_ARTIFACT tarball https://"},
+		{line: "GOSHIP_ARTIFACT " + strings.Repeat("a", 65) + " https://builds.example.com/"},
+		{line: "echo GOSHIP_ARTIFACT tarball https://builds.example.com/api.tar.gz"},
+	} {
+		got, ok := artifact.Parse(spec.line)
+		if ok != spec.ok || got != spec.want {
+			t.Errorf("artifact.Parse(%q) = %#v, %t; want %#v, %t", spec.line, got, ok, spec.want, spec.ok)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	output := []string{
+		"Fetching revision 1234",
+		"GOSHIP_ARTIFACT tarball https://builds.example.com/api-1234.tar.gz",
+		"GOSHIP_ARTIFACT changelog not-a-url",
+		"GOSHIP_ARTIFACT changelog https://builds.example.com/api-1234/CHANGES",
+		"GOSHIP_ARTIFACT tarball https://mirror.example.com/api-1234.tar.gz",
+		"GOSHIP_ARTIFACT report https://ci.example.com/report/1234",
+		"GOSHIP_ARTIFACT coverage https://ci.example.com/coverage/1234",
+		"Done",
+	}
+	c := artifact.NewCollector(3)
+	var declared []string
+	for _, line := range output {
+		if c.Scan(line) {
+			declared = append(declared, line)
+		}
+	}
+	if got, want := len(declared), 5; got != want {
+		t.Errorf("declarations = %q; want %d of them", declared, want)
+	}
+	want := []artifact.Artifact{
+		{Name: "tarball", URL: "https://mirror.example.com/api-1234.tar.gz"},
+		{Name: "changelog", URL: "https://builds.example.com/api-1234/CHANGES"},
+		{Name: "report", URL: "https://ci.example.com/report/1234"},
+	}
+	if got := c.Artifacts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("c.Artifacts() = %#v; want %#v", got, want)
+	}
+	if got, want := c.Dropped(), 1; got != want {
+		t.Errorf("c.Dropped() = %d; want %d", got, want)
+	}
+}
+
+func TestCollectorDefaultLimit(t *testing.T) {
+	c := artifact.NewCollector(0)
+	for i := 0; i < artifact.DefaultLimit+2; i++ {
+		c.Scan("GOSHIP_ARTIFACT " + strings.Repeat("a", i+1) + " https://builds.example.com/")
+	}
+	if got := len(c.Artifacts()); got != artifact.DefaultLimit {
+		t.Errorf("len(c.Artifacts()) = %d; want %d", got, artifact.DefaultLimit)
+	}
+}
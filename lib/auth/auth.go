@@ -1,10 +1,10 @@
 package auth
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/gorilla/sessions"
@@ -19,8 +19,10 @@ const (
 var (
 	// enabled is true iff client authentication is enabled.
 	enabled bool
-	// defaultUser is the value which CurrentUser returns if client authentication is disabled.
-	defaultUser User
+	// githubEnabled is true iff authentication by GitHub OAuth is enabled.
+	githubEnabled bool
+	// secureCookies is true iff goship is served over https, so that session cookies must not be sent over http.
+	secureCookies bool
 
 	githubCallbackBase string
 
@@ -30,6 +32,7 @@ var (
 // Initialize collects server-side credential from environment variables and prepare for authentication with Github OAuth.
 //
 // Client authentication is disabled and CurrentUser always returns "anonymous" if any of the environment variables are missing.
+// SetProvider selects another provider.
 func Initialize(anynomous User, cookieSecret []byte) {
 	store = sessions.NewCookieStore(cookieSecret)
 	githubCallbackBase = os.Getenv("GITHUB_CALLBACK_URL")
@@ -42,7 +45,6 @@ func Initialize(anynomous User, cookieSecret []byte) {
 		os.Getenv("GITHUB_OMNI_AUTH_ID"),
 		os.Getenv("GITHUB_OMNI_AUTH_KEY"),
 	}
-	defaultUser = anynomous
 
 	if cred.githubRandomHashKey == "" || cred.githubOmniauthID == "" || cred.githubOmniauthKey == "" || githubCallbackBase == "" {
 		glog.Warningf(
@@ -52,7 +54,8 @@ func Initialize(anynomous User, cookieSecret []byte) {
 			cred.githubOmniauthKey,
 			githubCallbackBase,
 		)
-		enabled = false
+		githubEnabled = false
+		SetProvider(Anonymous(anynomous))
 		return
 	}
 	url := fmt.Sprintf("%s/auth/github/callback", githubCallbackBase)
@@ -62,39 +65,47 @@ func Initialize(anynomous User, cookieSecret []byte) {
 		githubOauth.New(cred.githubOmniauthID, cred.githubOmniauthKey, url),
 	)
 	glog.Infof("Enabled authentication by github OAuth2")
-	enabled = true
+	githubEnabled = true
+	SetProvider(Github)
+	secureCookies = strings.HasPrefix(githubCallbackBase, "https://")
 }
 
+// Enabled returns true iff client authentication is enabled by any provider.
 func Enabled() bool {
 	return enabled
 }
 
+// GithubEnabled returns true iff authentication by GitHub OAuth is enabled.
+func GithubEnabled() bool {
+	return githubEnabled
+}
+
 // User is the user who the current request is on behalf of.
 type User struct {
 	// Name is the name of the user
 	Name string
 	// Avatar is the URL to the avatar of the user
 	Avatar string
+	// Provider is the name of the provider which authenticated the user: ProviderGithub, ProviderOIDC, ProviderHeader, ProviderToken or ProviderSlack.
+	// It is empty for the default user.
+	Provider string
+	// Groups are groups of the user given by the OpenID Connect provider.
+	// For API tokens, they are the groups of the user when the token was created.
+	Groups []string
+	// TokenProvider is the provider which had authenticated the user who created the API token if Provider is ProviderToken.
+	TokenProvider string
+}
+
+// Origin returns the provider which authenticated the user in person, i.e. TokenProvider for API tokens.
+func (u User) Origin() string {
+	if u.Provider == ProviderToken {
+		return u.TokenProvider
+	}
+	return u.Provider
 }
 
-// CurrentUser returns the current login user of the request.
+// CurrentUser returns the user of the request authenticated by the current Provider.
 // It returns the default user if client authentication is disabled in the current context.
 func CurrentUser(r *http.Request) (User, error) {
-	if !enabled {
-		return defaultUser, nil
-	}
-	session, err := store.Get(r, sessionName)
-	if err != nil {
-		glog.Errorf("Failed to fetch current session: %v", err)
-		return User{}, err
-	}
-	name, ok := session.Values["userName"].(string)
-	if !ok {
-		return User{}, errors.New("no username")
-	}
-	avatar, ok := session.Values["avatarURL"].(string)
-	if !ok {
-		return User{}, errors.New("no avatar")
-	}
-	return User{Name: name, Avatar: avatar}, nil
+	return provider.Authenticate(r)
 }
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"fmt"
+	"html/template"
 	"net/http"
 	"os"
 
+	"github.com/gengo/goship/lib/proxy"
 	"github.com/golang/glog"
 	"github.com/gorilla/sessions"
 	"github.com/stretchr/gomniauth"
@@ -12,19 +14,37 @@ import (
 )
 
 const (
-	providerName = "github"
+	providerName = ProviderGithub
 )
 
-// Authenticate decorates "h" with github OAuth authentication.
+// Authenticate decorates "h" with authentication by the current Provider.
+// Unauthenticated users are sent to GitHub login, or to the login page to choose a provider if OpenID Connect is enabled.
+// They are rejected if neither is enabled.
+//
+// Mutating requests must also carry the CSRF token of the session (see CSRFToken) unless they are authenticated by API tokens,
+// which browsers do not send on their own. They are rejected with 403 and CSRFErrorCode otherwise.
 func Authenticate(h http.Handler) http.Handler {
-	callback := fmt.Sprintf("%s/auth/github/login", githubCallbackBase)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := CurrentUser(r)
+		u, err := CurrentUser(r)
 		if err != nil {
 			glog.Warningf("Failed to fetch the current user: %v", err)
-			http.Redirect(w, r, callback, http.StatusSeeOther)
+			switch {
+			case OIDCEnabled():
+				http.Redirect(w, r, proxy.Path("/auth/login"), http.StatusSeeOther)
+			case githubEnabled:
+				http.Redirect(w, r, fmt.Sprintf("%s/auth/github/login", githubCallbackBase), http.StatusSeeOther)
+			default:
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			}
 			return
 		}
+		if isMutating(r.Method) && u.Provider != ProviderToken {
+			if err := checkCSRF(r); err != nil {
+				glog.Warningf("Rejected %s %s by %s: %v", r.Method, r.URL.Path, u.Name, err)
+				respondCSRFError(w, err)
+				return
+			}
+		}
 		h.ServeHTTP(w, r)
 	})
 }
@@ -35,7 +55,7 @@ func AuthenticateFunc(h http.HandlerFunc) http.Handler {
 
 // LoginHandler begins github OAuth2 authentication
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if !enabled {
+	if !githubEnabled {
 		return
 	}
 
@@ -59,7 +79,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 // CallbackHandler receives callback from github OAuth provider
 func CallbackHandler(w http.ResponseWriter, r *http.Request) {
-	if !enabled {
+	if !githubEnabled {
 		http.Error(w, "authenticatin disabled", http.StatusBadRequest)
 		return
 	}
@@ -91,22 +111,165 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	u := User{Name: user.Nickname(), Avatar: user.AvatarURL(), Provider: ProviderGithub}
+	if err := saveUser(w, r, u); err != nil {
+		glog.Errorf("Failed to save session of %s: %v", u.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, os.Getenv("GITHUB_CALLBACK_URL"), http.StatusFound)
+}
+
+// sessionOptions returns options of session cookies with "maxAge" seconds.
+func sessionOptions(maxAge int) *sessions.Options {
+	return &sessions.Options{
+		Path:     proxy.Path("/"),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secureCookies,
+	}
+}
+
+// saveUser stores "u" as the current user into the session with a new CSRF token.
+func saveUser(w http.ResponseWriter, r *http.Request, u User) error {
 	session, err := store.Get(r, sessionName)
 	if err != nil {
-		glog.Errorf("Failed to fetch current session: %v", err)
+		return err
+	}
+	session.Options = sessionOptions(86400 * 7)
+	session.Values["userName"] = u.Name
+	session.Values["avatarURL"] = u.Avatar
+	session.Values["provider"] = u.Provider
+	session.Values["groups"] = u.Groups
+	delete(session.Values, "oidcState")
+	delete(session.Values, "oidcNonce")
+	if err := rotateCSRFToken(session); err != nil {
+		return err
+	}
+	return saveSession(w, r, session)
+}
+
+// LogoutHandler clears the session of the current user.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		glog.Warningf("Failed to fetch current session: %v", err)
+	}
+	session.Options = sessionOptions(-1)
+	session.Values = make(map[interface{}]interface{})
+	if err := saveSession(w, r, session); err != nil {
+		glog.Errorf("Failed to clear session: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	http.Redirect(w, r, proxy.Path("/"), http.StatusFound)
+}
 
-	session.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7,
-		HttpOnly: true,
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in to GoShip</title></head>
+<body>
+  <h1>Sign in to GoShip</h1>
+  <ul>
+    {{if .Github}}<li><a href="{{.GithubURL}}">Sign in with GitHub</a></li>{{end}}
+    {{if .OIDC}}<li><a href="{{.OIDCURL}}">Sign in with {{.Issuer}}</a></li>{{end}}
+  </ul>
+</body>
+</html>
+`))
+
+// LoginPageHandler lets users choose a provider to sign in with.
+func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
+	params := map[string]interface{}{
+		"Github":    githubEnabled,
+		"GithubURL": fmt.Sprintf("%s/auth/github/login", githubCallbackBase),
+		"OIDC":      OIDCEnabled(),
+		"OIDCURL":   proxy.Path("/auth/oidc/login"),
+	}
+	if oidc != nil {
+		params["Issuer"] = oidc.cfg.Issuer
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := loginPage.Execute(w, params); err != nil {
+		glog.Errorf("Failed to render login page: %v", err)
+	}
+}
 
-	session.Values["userName"] = user.Nickname()
-	session.Values["avatarURL"] = user.AvatarURL()
-	session.Save(r, w)
+// OIDCLoginHandler begins the authorization code flow of OpenID Connect.
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	state, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	authURL, err := oidc.authURL(state, nonce)
+	if err != nil {
+		glog.Errorf("Failed to discover OpenID Connect provider %s: %v", oidc.cfg.Issuer, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
 
-	http.Redirect(w, r, os.Getenv("GITHUB_CALLBACK_URL"), http.StatusFound)
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		glog.Warningf("Failed to fetch current session: %v", err)
+	}
+	// short-lived until the callback
+	session.Options = sessionOptions(600)
+	session.Values["oidcState"] = state
+	session.Values["oidcNonce"] = nonce
+	if err := saveSession(w, r, session); err != nil {
+		glog.Errorf("Failed to save session: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler receives the authorization code from the OpenID Connect provider, and logs the user in.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		http.Error(w, fmt.Sprintf("authentication failed: %s", e), http.StatusUnauthorized)
+		return
+	}
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		glog.Errorf("Failed to fetch current session: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	state, _ := session.Values["oidcState"].(string)
+	nonce, _ := session.Values["oidcNonce"].(string)
+	if state == "" || r.FormValue("state") != state {
+		http.Error(w, "state mismatch", http.StatusBadRequest)
+		return
+	}
+
+	id, err := oidc.exchange(r.FormValue("code"), nonce)
+	if err != nil {
+		glog.Errorf("Failed to authenticate with %s: %v", oidc.cfg.Issuer, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	u := User{Name: id.Name, Avatar: id.Avatar, Provider: ProviderOIDC, Groups: id.Groups}
+	if err := saveUser(w, r, u); err != nil {
+		glog.Errorf("Failed to save session of %s: %v", u.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s logged in with %s as a member of %q", u.Name, oidc.cfg.Issuer, u.Groups)
+	http.Redirect(w, r, proxy.Path("/"), http.StatusFound)
 }
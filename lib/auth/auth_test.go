@@ -12,7 +12,7 @@ func TestCurrentUser(t *testing.T) {
 	anonymous := User{Name: "T-600", Avatar: "http://avatar.example/600"}
 	Initialize(anonymous, []byte("12345"))
 
-	enabled = true
+	SetProvider(Github)
 
 	req, err := http.NewRequest("GET", "http://host.example", nil)
 	if err != nil {
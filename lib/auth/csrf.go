@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// CSRFHeader is the header which scripts send the CSRF token of the session in.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFField is the form field which plain HTML forms send the CSRF token of the session in.
+	CSRFField = "csrf_token"
+	// CSRFErrorCode is the "code" of 403 responses to mutating requests without the CSRF token of the session,
+	// so that the UI can tell users to reload the page rather than that they lack permissions.
+	CSRFErrorCode = "csrf_token_invalid"
+
+	// csrfTokenKey is the key of the CSRF token in session values.
+	csrfTokenKey = "csrfToken"
+)
+
+// errCSRFToken is the error of requests whose CSRF tokens are missing or do not match their sessions.
+var errCSRFToken = errors.New("missing or invalid CSRF token; reload the page and try again")
+
+// CSRFToken returns the CSRF token of the session of "r", issuing one into the session if it has none yet.
+// Pages embed it into their forms and scripts, since Authenticate rejects mutating requests of the session without it.
+func CSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	// a cookie which fails to decode, e.g. signed with an old secret, comes with a new session to replace it.
+	session, err := store.Get(r, sessionName)
+	if session == nil {
+		return "", err
+	}
+	if token, ok := session.Values[csrfTokenKey].(string); ok && token != "" {
+		return token, nil
+	}
+	token, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	session.Options = sessionOptions(86400 * 7)
+	session.Values[csrfTokenKey] = token
+	if err := saveSession(w, r, session); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateCSRFToken replaces the CSRF token in "session" with a new one, so that tokens issued before login are useless.
+func rotateCSRFToken(session *sessions.Session) error {
+	token, err := randomString()
+	if err != nil {
+		return err
+	}
+	session.Values[csrfTokenKey] = token
+	return nil
+}
+
+// isMutating returns true iff requests of "method" can change the state of goship.
+func isMutating(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+	return true
+}
+
+// checkCSRF returns errCSRFToken unless "r" carries the CSRF token of its session in CSRFHeader or CSRFField.
+func checkCSRF(r *http.Request) error {
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		return errCSRFToken
+	}
+	want, _ := session.Values[csrfTokenKey].(string)
+	got := r.Header.Get(CSRFHeader)
+	if got == "" {
+		got = r.PostFormValue(CSRFField)
+	}
+	if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return errCSRFToken
+	}
+	return nil
+}
+
+// respondCSRFError rejects a request without the valid CSRF token with CSRFErrorCode.
+func respondCSRFError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "code": CSRFErrorCode})
+}
+
+// saveSession saves "session" into the response with SameSite=Lax, so that browsers do not send the session cookie
+// with requests which other sites make, e.g. by posting forms in them.
+// sessions.Options has no field for the attribute, so it is appended to the cookie after the fact.
+func saveSession(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
+	if err := session.Save(r, w); err != nil {
+		return err
+	}
+	cookies := w.Header()["Set-Cookie"]
+	for i, c := range cookies {
+		if strings.HasPrefix(c, sessionName+"=") && !strings.Contains(strings.ToLower(c), "samesite") {
+			cookies[i] = c + "; SameSite=Lax"
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfSession returns the cookies of a new session which has seen a page, and the CSRF token of the session.
+func csrfSession(t *testing.T) ([]*http.Cookie, string) {
+	r, err := http.NewRequest("GET", "http://goship.example/", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(%q, %q, nil) failed with %v", "GET", "http://goship.example/", err)
+	}
+	w := httptest.NewRecorder()
+	token, err := CSRFToken(w, r)
+	if err != nil {
+		t.Fatalf("CSRFToken(w, r) failed with %v", err)
+	}
+	return (&http.Response{Header: w.Header()}).Cookies(), token
+}
+
+// csrfRequest returns a request of "method" with "cookies", which sends "header" in CSRFHeader and "field" in CSRFField if not empty.
+func csrfRequest(t *testing.T, method string, cookies []*http.Cookie, header, field string) *http.Request {
+	var form url.Values
+	if field != "" {
+		form = url.Values{CSRFField: {field}}
+	}
+	r, err := http.NewRequest(method, "http://goship.example/lock", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("http.NewRequest(%q, %q, body) failed with %v", method, "http://goship.example/lock", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if header != "" {
+		r.Header.Set(CSRFHeader, header)
+	}
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+// serveCSRF serves "r" by a handler decorated with Authenticate, and returns the response and whether the handler ran.
+func serveCSRF(r *http.Request) (*httptest.ResponseRecorder, bool) {
+	var served bool
+	h := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w, served
+}
+
+func TestAuthenticateCSRF(t *testing.T) {
+	Initialize(User{Name: "alice"}, []byte("12345"))
+	defer SetProvider(Anonymous(User{}))
+	cookies, token := csrfSession(t)
+	for _, spec := range []struct {
+		method        string
+		noSession     bool
+		header, field string
+		provider      string
+		want          bool
+	}{
+		{method: "GET", want: true},
+		{method: "HEAD", want: true},
+		{method: "POST", header: token, want: true},
+		{method: "POST", field: token, want: true},
+		{method: "PUT", header: token, want: true},
+		{method: "DELETE", header: token, want: true},
+		// the header takes precedence over the field.
+		{method: "POST", header: "wrong", field: token},
+
+		// missing
+		{method: "POST"},
+		{method: "PUT"},
+		{method: "DELETE"},
+		{method: "POST", noSession: true, header: token},
+		{method: "POST", noSession: true, header: ""},
+		// wrong
+		{method: "POST", header: "wrong"},
+		{method: "POST", field: "wrong"},
+		{method: "POST", header: token[1:]},
+		{method: "PATCH", header: token + "x"},
+
+		// API tokens are not sent by browsers on their own.
+		{method: "POST", provider: ProviderToken, want: true},
+		{method: "POST", provider: ProviderHeader},
+	} {
+		SetProvider(Anonymous(User{Name: "alice", Provider: spec.provider}))
+		c := cookies
+		if spec.noSession {
+			c = nil
+		}
+		w, served := serveCSRF(csrfRequest(t, spec.method, c, spec.header, spec.field))
+		if served != spec.want {
+			t.Errorf("served %s with header %q and field %q by %q = %t; want %t", spec.method, spec.header, spec.field, spec.provider, served, spec.want)
+			continue
+		}
+		if spec.want {
+			continue
+		}
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s with header %q and field %q responded %d; want %d", spec.method, spec.header, spec.field, w.Code, http.StatusForbidden)
+		}
+		var resp struct {
+			Error, Code string
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != CSRFErrorCode {
+			t.Errorf("code of %s with header %q and field %q = %q, %v; want %q", spec.method, spec.header, spec.field, resp.Code, err, CSRFErrorCode)
+		}
+	}
+}
+
+func TestCSRFTokenRotatedOnLogin(t *testing.T) {
+	Initialize(User{Name: "alice"}, []byte("12345"))
+	defer SetProvider(Anonymous(User{}))
+	cookies, before := csrfSession(t)
+
+	// the same session keeps its token over pages.
+	r := csrfRequest(t, "GET", cookies, "", "")
+	if got, err := CSRFToken(httptest.NewRecorder(), r); err != nil || got != before {
+		t.Errorf("CSRFToken(w, r) = %q, %v for the same session; want %q", got, err, before)
+	}
+
+	w := httptest.NewRecorder()
+	if err := saveUser(w, csrfRequest(t, "GET", cookies, "", ""), User{Name: "alice", Provider: ProviderGithub}); err != nil {
+		t.Fatalf("saveUser(w, r, u) failed with %v", err)
+	}
+	loggedIn := (&http.Response{Header: w.Header()}).Cookies()
+	after, err := CSRFToken(httptest.NewRecorder(), csrfRequest(t, "GET", loggedIn, "", ""))
+	if err != nil {
+		t.Fatalf("CSRFToken(w, r) failed with %v", err)
+	}
+	if after == before || after == "" {
+		t.Errorf("CSRFToken(w, r) = %q after login; want a new token other than %q", after, before)
+	}
+
+	SetProvider(Github)
+	if _, served := serveCSRF(csrfRequest(t, "POST", loggedIn, before, "")); served {
+		t.Errorf("served POST with the CSRF token issued before login; want rejected")
+	}
+	if w, served := serveCSRF(csrfRequest(t, "POST", loggedIn, after, "")); !served {
+		t.Errorf("rejected POST with the CSRF token issued on login: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestSessionCookieSameSite(t *testing.T) {
+	Initialize(User{Name: "alice"}, []byte("12345"))
+	r := csrfRequest(t, "GET", nil, "", "")
+	w := httptest.NewRecorder()
+	if _, err := CSRFToken(w, r); err != nil {
+		t.Fatalf("CSRFToken(w, r) failed with %v", err)
+	}
+	w2 := httptest.NewRecorder()
+	if err := saveUser(w2, r, User{Name: "alice", Provider: ProviderGithub}); err != nil {
+		t.Fatalf("saveUser(w, r, u) failed with %v", err)
+	}
+	for _, w := range []*httptest.ResponseRecorder{w, w2} {
+		cookies := w.HeaderMap["Set-Cookie"]
+		if len(cookies) != 1 {
+			t.Errorf("Set-Cookie = %q; want a session cookie", cookies)
+			continue
+		}
+		for _, attr := range []string{sessionName + "=", "; HttpOnly", "; SameSite=Lax"} {
+			if !strings.Contains(cookies[0], attr) {
+				t.Errorf("Set-Cookie = %q; want %q", cookies[0], attr)
+			}
+		}
+	}
+}
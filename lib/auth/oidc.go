@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// ProviderGithub is the name of the GitHub OAuth provider.
+	ProviderGithub = "github"
+	// ProviderOIDC is the name of the OpenID Connect provider.
+	ProviderOIDC = "oidc"
+
+	defaultGroupsClaim = "groups"
+)
+
+// OIDCConfig is a configuration of an OpenID Connect provider.
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the provider. Its discovery document must be served at "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of /auth/oidc/callback of goship.
+	RedirectURL string
+	// GroupsClaim is the name of the claim of the ID token which lists groups of the user. Defaults to "groups".
+	GroupsClaim string
+}
+
+// oidc is the configured OpenID Connect provider, or nil.
+var oidc *oidcProvider
+
+// EnableOIDC enables login with the OpenID Connect provider in addition to GitHub.
+// Initialize must be called before.
+func EnableOIDC(cfg OIDCConfig) {
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = defaultGroupsClaim
+	}
+	oidc = newOIDCProvider(cfg, http.DefaultClient)
+	if githubEnabled {
+		SetProvider(Any(Github, OIDC))
+	} else {
+		SetProvider(OIDC)
+	}
+	secureCookies = secureCookies || strings.HasPrefix(cfg.RedirectURL, "https://")
+	glog.Infof("Enabled authentication by OpenID Connect provider %s", cfg.Issuer)
+}
+
+// OIDCEnabled returns true iff login with an OpenID Connect provider is enabled.
+func OIDCEnabled() bool {
+	return oidc != nil
+}
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func newOIDCProvider(cfg OIDCConfig, client *http.Client) *oidcProvider {
+	return &oidcProvider{cfg: cfg, client: client, now: time.Now}
+}
+
+func (p *oidcProvider) getJSON(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %d from %s", resp.StatusCode, u)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover fetches the discovery document of the provider on the first call.
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// authURL returns the URL of the authorization endpoint to begin the authorization code flow.
+func (p *oidcProvider) authURL(state, nonce string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.ClientID},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"scope":         {"openid profile email " + p.cfg.GroupsClaim},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// oidcIdentity is the user identified by an ID token.
+type oidcIdentity struct {
+	Name   string
+	Avatar string
+	Groups []string
+}
+
+// exchange exchanges the authorization code for an ID token, and returns the user identified by the token.
+func (p *oidcProvider) exchange(code, nonce string) (oidcIdentity, error) {
+	d, err := p.discover()
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	resp, err := p.client.PostForm(d.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+	})
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return oidcIdentity{}, fmt.Errorf("unexpected HTTP status %d from the token endpoint", resp.StatusCode)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return oidcIdentity{}, err
+	}
+	claims, err := p.verify(tok.IDToken)
+	if err != nil {
+		return oidcIdentity{}, err
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return oidcIdentity{}, errors.New("nonce mismatch in the ID token")
+	}
+	return p.identity(claims)
+}
+
+// identity returns the user described by the claims of an ID token.
+func (p *oidcProvider) identity(claims map[string]interface{}) (oidcIdentity, error) {
+	var id oidcIdentity
+	for _, c := range []string{"preferred_username", "email", "sub"} {
+		if v, ok := claims[c].(string); ok && v != "" {
+			id.Name = v
+			break
+		}
+	}
+	if id.Name == "" {
+		return oidcIdentity{}, errors.New("no user name in the ID token")
+	}
+	id.Avatar, _ = claims["picture"].(string)
+	switch gs := claims[p.cfg.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range gs {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = []string{gs}
+	}
+	return id, nil
+}
+
+// verify verifies the signature, the issuer, the audience and the expiry of the ID token, and returns its claims.
+func (p *oidcProvider) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid signature of the ID token: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != p.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q of the ID token", iss)
+	}
+	if !hasAudience(claims["aud"], p.cfg.ClientID) {
+		return nil, errors.New("the ID token is not for goship")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || !p.now().Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("the ID token has expired")
+	}
+	return claims, nil
+}
+
+func hasAudience(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if v == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the public key "kid" of the provider. It fetches the keys again if "kid" is unknown, since keys rotate.
+func (p *oidcProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	k, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return k, nil
+	}
+
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q of the ID token", kid)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// randomString returns a random string for state and nonce parameters.
+func randomString() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
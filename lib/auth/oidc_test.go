@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOIDC is a fake OpenID Connect provider.
+type fakeOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// claims are the claims of ID tokens issued for the code "valid-code" in addition to iss, aud, exp and nonce.
+	claims map[string]interface{}
+	// nonces maps codes to nonces requested with the codes.
+	nonces map[string]string
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey(...) failed with %v", err)
+	}
+	f := &fakeOIDC{t: t, key: key, nonces: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": f.server.URL + "/authorize",
+			"token_endpoint":         f.server.URL + "/token",
+			"jwks_uri":               f.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "secret" || r.FormValue("code") != "valid-code" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   f.server.URL,
+			"aud":   "goship",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": f.nonces["valid-code"],
+		}
+		for k, v := range f.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.sign(claims)})
+	})
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeOIDC) sign(claims map[string]interface{}) string {
+	enc := func(v interface{}) string {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			f.t.Fatalf("json.Marshal(%#v) failed with %v", v, err)
+		}
+		return base64.RawURLEncoding.EncodeToString(buf)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "kid": "key-1"}) + "." + enc(claims)
+	h := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, h[:])
+	if err != nil {
+		f.t.Fatalf("rsa.SignPKCS1v15(...) failed with %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// withOIDC enables the fake provider during "f".
+func withOIDC(t *testing.T, f func(p *fakeOIDC)) {
+	Initialize(User{Name: "anonymous"}, []byte("12345"))
+	p := newFakeOIDC(t)
+	defer p.server.Close()
+	EnableOIDC(OIDCConfig{
+		Issuer:       p.server.URL,
+		ClientID:     "goship",
+		ClientSecret: "secret",
+		RedirectURL:  "http://goship.example/auth/oidc/callback",
+	})
+	defer func() {
+		oidc = nil
+		SetProvider(Anonymous(User{Name: "anonymous"}))
+	}()
+	f(p)
+}
+
+func cookies(w *httptest.ResponseRecorder) []*http.Cookie {
+	return (&http.Response{Header: w.Header()}).Cookies()
+}
+
+// login runs the code flow and returns the cookies of the session after the callback.
+func login(t *testing.T, p *fakeOIDC, code string) (*httptest.ResponseRecorder, []*http.Cookie) {
+	req, _ := http.NewRequest("GET", "http://goship.example/auth/oidc/login", nil)
+	w := httptest.NewRecorder()
+	OIDCLoginHandler(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("w.Code = %d; want %d; body=%q", w.Code, http.StatusFound, w.Body.String())
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("url.Parse(%q) failed with %v", w.Header().Get("Location"), err)
+	}
+	if got, want := loc.Scheme+"://"+loc.Host+loc.Path, p.server.URL+"/authorize"; got != want {
+		t.Errorf("redirected to %q; want %q", got, want)
+	}
+	q := loc.Query()
+	if got, want := q.Get("client_id"), "goship"; got != want {
+		t.Errorf("client_id = %q; want %q", got, want)
+	}
+	p.nonces[code] = q.Get("nonce")
+
+	cb := fmt.Sprintf("http://goship.example/auth/oidc/callback?code=%s&state=%s", code, url.QueryEscape(q.Get("state")))
+	req, _ = http.NewRequest("GET", cb, nil)
+	for _, c := range cookies(w) {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	OIDCCallbackHandler(w, req)
+	return w, cookies(w)
+}
+
+func TestOIDCCodeFlow(t *testing.T) {
+	withOIDC(t, func(p *fakeOIDC) {
+		p.claims = map[string]interface{}{
+			"sub":                "1234",
+			"preferred_username": "contractor@example.com",
+			"groups":             []string{"ops", "contractors"},
+		}
+		w, cs := login(t, p, "valid-code")
+		if w.Code != http.StatusFound {
+			t.Fatalf("w.Code = %d; want %d; body=%q", w.Code, http.StatusFound, w.Body.String())
+		}
+
+		req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+		for _, c := range cs {
+			req.AddCookie(c)
+		}
+		u, err := CurrentUser(req)
+		if err != nil {
+			t.Fatalf("CurrentUser(req) failed with %v", err)
+		}
+		want := User{Name: "contractor@example.com", Provider: ProviderOIDC, Groups: []string{"ops", "contractors"}}
+		if !reflect.DeepEqual(u, want) {
+			t.Errorf("CurrentUser(req) = %#v; want %#v", u, want)
+		}
+
+		w = httptest.NewRecorder()
+		LogoutHandler(w, req)
+		req, _ = http.NewRequest("GET", "http://goship.example/", nil)
+		for _, c := range cookies(w) {
+			req.AddCookie(c)
+		}
+		if u, err := CurrentUser(req); err == nil {
+			t.Errorf("CurrentUser(req) = %#v after logout; want failure", u)
+		}
+	})
+}
+
+func TestOIDCCallbackFailures(t *testing.T) {
+	withOIDC(t, func(p *fakeOIDC) {
+		p.claims = map[string]interface{}{"sub": "1234"}
+		if w, _ := login(t, p, "invalid-code"); w.Code != http.StatusUnauthorized {
+			t.Errorf("w.Code = %d; want %d", w.Code, http.StatusUnauthorized)
+		}
+
+		// the callback without the state in the session
+		req, _ := http.NewRequest("GET", "http://goship.example/auth/oidc/callback?code=valid-code&state=forged", nil)
+		w := httptest.NewRecorder()
+		OIDCCallbackHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("w.Code = %d; want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestOIDCVerify(t *testing.T) {
+	withOIDC(t, func(p *fakeOIDC) {
+		valid := map[string]interface{}{
+			"iss": p.server.URL,
+			"aud": []string{"other", "goship"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"sub": "1234",
+		}
+		if _, err := oidc.verify(p.sign(valid)); err != nil {
+			t.Errorf("oidc.verify(...) failed with %v; want success", err)
+		}
+
+		for _, spec := range []struct {
+			name  string
+			claim string
+			value interface{}
+		}{
+			{name: "wrong issuer", claim: "iss", value: "https://evil.example"},
+			{name: "wrong audience", claim: "aud", value: "other"},
+			{name: "expired", claim: "exp", value: time.Now().Add(-time.Minute).Unix()},
+		} {
+			claims := make(map[string]interface{})
+			for k, v := range valid {
+				claims[k] = v
+			}
+			claims[spec.claim] = spec.value
+			if _, err := oidc.verify(p.sign(claims)); err == nil {
+				t.Errorf("oidc.verify(...) succeeded with %s; want failure", spec.name)
+			}
+		}
+
+		tampered := strings.Split(p.sign(valid), ".")
+		buf, _ := json.Marshal(map[string]interface{}{"iss": p.server.URL, "aud": "goship", "exp": valid["exp"], "sub": "admin"})
+		tampered[1] = base64.RawURLEncoding.EncodeToString(buf)
+		if _, err := oidc.verify(strings.Join(tampered, ".")); err == nil {
+			t.Errorf("oidc.verify(...) succeeded with a tampered token; want failure")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gengo/goship/lib/proxy"
+)
+
+const (
+	// ProviderHeader is the name of the provider which trusts a header set by an authenticating proxy.
+	ProviderHeader = "header"
+	// ProviderToken is the name of the provider which authenticates API tokens.
+	ProviderToken = "token"
+	// ProviderSlack is the name of the provider of users who run slash commands in Slack. See config.SlackConfiguration.Users.
+	ProviderSlack = "slack"
+)
+
+// Provider authenticates requests.
+type Provider interface {
+	// Authenticate returns the user who "r" is on behalf of, or an error if "r" is not authenticated.
+	Authenticate(r *http.Request) (User, error)
+}
+
+var (
+	// provider authenticates requests in CurrentUser.
+	provider Provider = Anonymous(User{})
+
+	// Github authenticates users by sessions issued by GitHub OAuth login.
+	Github Provider = sessionProvider(ProviderGithub)
+	// OIDC authenticates users by sessions issued by OpenID Connect login.
+	OIDC Provider = sessionProvider(ProviderOIDC)
+)
+
+// SetProvider makes CurrentUser authenticate requests with "p".
+func SetProvider(p Provider) {
+	provider = p
+	_, anon := p.(anonymous)
+	enabled = !anon
+}
+
+// CurrentProvider returns the Provider which CurrentUser authenticates requests with.
+func CurrentProvider() Provider {
+	return provider
+}
+
+// sessionProvider authenticates users by sessions issued by login with the provider of the name.
+type sessionProvider string
+
+func (p sessionProvider) Authenticate(r *http.Request) (User, error) {
+	u, err := sessionUser(r)
+	if err != nil {
+		return User{}, err
+	}
+	if u.Provider != string(p) {
+		return User{}, fmt.Errorf("%s logged in with %s but not %s", u.Name, u.Provider, p)
+	}
+	return u, nil
+}
+
+// sessionUser returns the user stored in the session of "r" by saveUser.
+func sessionUser(r *http.Request) (User, error) {
+	session, err := store.Get(r, sessionName)
+	if err != nil {
+		return User{}, err
+	}
+	name, ok := session.Values["userName"].(string)
+	if !ok {
+		return User{}, errors.New("no username")
+	}
+	avatar, ok := session.Values["avatarURL"].(string)
+	if !ok {
+		return User{}, errors.New("no avatar")
+	}
+	provider, _ := session.Values["provider"].(string)
+	if provider == "" {
+		// sessions issued before OpenID Connect was supported
+		provider = ProviderGithub
+	}
+	groups, _ := session.Values["groups"].([]string)
+	return User{Name: name, Avatar: avatar, Provider: provider, Groups: groups}, nil
+}
+
+// anyProvider authenticates users with the first provider which succeeds.
+type anyProvider []Provider
+
+// Any returns a Provider which tries "providers" in order.
+func Any(providers ...Provider) Provider {
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return anyProvider(providers)
+}
+
+func (ps anyProvider) Authenticate(r *http.Request) (User, error) {
+	err := errors.New("no authentication providers")
+	for _, p := range ps {
+		var u User
+		if u, err = p.Authenticate(r); err == nil {
+			return u, nil
+		}
+	}
+	return User{}, err
+}
+
+// anonymous regards all requests as on behalf of a fixed user.
+type anonymous User
+
+// Anonymous returns a Provider which authenticates all requests as "u". It disables client authentication.
+func Anonymous(u User) Provider {
+	return anonymous(u)
+}
+
+func (a anonymous) Authenticate(r *http.Request) (User, error) {
+	return User(a), nil
+}
+
+// headerProvider trusts a header set by authenticating proxies.
+type headerProvider struct {
+	header  string
+	proxies proxy.Networks
+}
+
+// NewHeaderProvider returns a Provider which takes the name of the user from "header" of requests,
+// i.e. X-Remote-User set by an SSO proxy.
+// Requests are rejected unless they come from "proxies", which are CIDRs or IP addresses of the proxies.
+func NewHeaderProvider(header string, proxies []string) (Provider, error) {
+	if header == "" {
+		return nil, errors.New("no header specified")
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("no trusted proxies specified")
+	}
+	ns, err := proxy.ParseNetworks(proxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	return headerProvider{header: header, proxies: ns}, nil
+}
+
+func (p headerProvider) Authenticate(r *http.Request) (User, error) {
+	// RemoteAddr is the client rather than the proxy if forwarded by trusted proxies.
+	peer := proxy.Peer(r)
+	if !p.proxies.Contains(peer) {
+		return User{}, fmt.Errorf("request from %s which is not a trusted proxy", peer)
+	}
+	name := strings.TrimSpace(r.Header.Get(p.header))
+	if name == "" {
+		return User{}, fmt.Errorf("no %s header", p.header)
+	}
+	return User{Name: name, Provider: ProviderHeader}, nil
+}
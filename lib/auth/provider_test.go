@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// sessionRequest returns a request with a session of "u".
+func sessionRequest(t *testing.T, u User) *http.Request {
+	req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+	w := httptest.NewRecorder()
+	if err := saveUser(w, req, u); err != nil {
+		t.Fatalf("saveUser(w, req, %#v) failed with %v", u, err)
+	}
+	req, _ = http.NewRequest("GET", "http://goship.example/", nil)
+	for _, c := range cookies(w) {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestSessionProviders(t *testing.T) {
+	Initialize(User{Name: "anonymous"}, []byte("12345"))
+	alice := User{Name: "alice", Avatar: "http://avatar.example/alice", Provider: ProviderGithub}
+	bob := User{Name: "bob", Provider: ProviderOIDC, Groups: []string{"ops"}}
+	noSession, _ := http.NewRequest("GET", "http://goship.example/", nil)
+
+	for _, spec := range []struct {
+		name string
+		p    Provider
+		req  *http.Request
+		want *User
+	}{
+		{name: "github", p: Github, req: sessionRequest(t, alice), want: &alice},
+		{name: "github", p: Github, req: sessionRequest(t, bob)},
+		{name: "github", p: Github, req: noSession},
+		{name: "oidc", p: OIDC, req: sessionRequest(t, bob), want: &bob},
+		{name: "oidc", p: OIDC, req: sessionRequest(t, alice)},
+		{name: "any", p: Any(Github, OIDC), req: sessionRequest(t, alice), want: &alice},
+		{name: "any", p: Any(Github, OIDC), req: sessionRequest(t, bob), want: &bob},
+		{name: "any", p: Any(Github, OIDC), req: noSession},
+	} {
+		u, err := spec.p.Authenticate(spec.req)
+		if spec.want == nil {
+			if err == nil {
+				t.Errorf("%s.Authenticate(req) = %#v; want failure", spec.name, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s.Authenticate(req) failed with %v; want success", spec.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(u, *spec.want) {
+			t.Errorf("%s.Authenticate(req) = %#v; want %#v", spec.name, u, *spec.want)
+		}
+	}
+}
+
+func TestLegacySession(t *testing.T) {
+	Initialize(User{Name: "anonymous"}, []byte("12345"))
+	req := sessionRequest(t, User{Name: "alice", Avatar: "http://avatar.example/alice"})
+	u, err := Github.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Github.Authenticate(req) failed with %v; want success", err)
+	}
+	if got, want := u.Provider, ProviderGithub; got != want {
+		t.Errorf("u.Provider = %q; want %q", got, want)
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	want := User{Name: "T-600", Avatar: "http://avatar.example/600"}
+	SetProvider(Anonymous(want))
+	defer SetProvider(Anonymous(User{}))
+	if Enabled() {
+		t.Errorf("Enabled() = true with anonymous; want false")
+	}
+	req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+	u, err := CurrentUser(req)
+	if err != nil {
+		t.Fatalf("CurrentUser(req) failed with %v; want success", err)
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("CurrentUser(req) = %#v; want %#v", u, want)
+	}
+}
+
+func TestHeaderProvider(t *testing.T) {
+	p, err := NewHeaderProvider("X-Remote-User", []string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("NewHeaderProvider(...) failed with %v", err)
+	}
+	for _, spec := range []struct {
+		remoteAddr string
+		user       string
+		want       string
+	}{
+		{remoteAddr: "10.1.2.3:54321", user: "alice", want: "alice"},
+		{remoteAddr: "192.168.1.10:80", user: " bob ", want: "bob"},
+		{remoteAddr: "[fd12::1]:443", user: "carol", want: "carol"},
+		// not from the proxies
+		{remoteAddr: "192.168.1.11:80", user: "alice"},
+		{remoteAddr: "11.0.0.1:80", user: "alice"},
+		{remoteAddr: "[fe80::1]:443", user: "alice"},
+		{remoteAddr: "garbage", user: "alice"},
+		// no header
+		{remoteAddr: "10.1.2.3:54321"},
+	} {
+		req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+		req.RemoteAddr = spec.remoteAddr
+		if spec.user != "" {
+			req.Header.Set("X-Remote-User", spec.user)
+		}
+		u, err := p.Authenticate(req)
+		if spec.want == "" {
+			if err == nil {
+				t.Errorf("p.Authenticate(req) from %q with %q = %#v; want failure", spec.remoteAddr, spec.user, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("p.Authenticate(req) from %q with %q failed with %v; want success", spec.remoteAddr, spec.user, err)
+			continue
+		}
+		if want := (User{Name: spec.want, Provider: ProviderHeader}); !reflect.DeepEqual(u, want) {
+			t.Errorf("p.Authenticate(req) from %q with %q = %#v; want %#v", spec.remoteAddr, spec.user, u, want)
+		}
+	}
+}
+
+func TestNewHeaderProviderFailure(t *testing.T) {
+	for _, spec := range []struct {
+		header  string
+		proxies []string
+	}{
+		{header: "", proxies: []string{"10.0.0.0/8"}},
+		{header: "X-Remote-User", proxies: nil},
+		{header: "X-Remote-User", proxies: []string{"10.0.0.0/33"}},
+		{header: "X-Remote-User", proxies: []string{"proxy.example"}},
+	} {
+		if _, err := NewHeaderProvider(spec.header, spec.proxies); err == nil {
+			t.Errorf("NewHeaderProvider(%q, %q) succeeded; want failure", spec.header, spec.proxies)
+		}
+	}
+}
+
+func TestAuthenticateRejectsWithoutLogin(t *testing.T) {
+	Initialize(User{Name: "anonymous"}, []byte("12345"))
+	p, err := NewHeaderProvider("X-Remote-User", []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewHeaderProvider(...) failed with %v", err)
+	}
+	SetProvider(p)
+	defer SetProvider(Anonymous(User{}))
+
+	h := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set("X-Remote-User", "mallory")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	req.RemoteAddr = "10.0.0.1:1234"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,358 @@
+// Package backup exports all the state of goship into an archive and restores it, e.g. around upgrades of etcd.
+//
+// An archive is a gzipped tarball of a manifest, the keys under Root in etcd and the deploy history files.
+// Keys with TTLs, e.g. host locks and drains, are restored with the TTLs left at the export. Transient keys, i.e.
+// deployments in progress, the leadership and rate limits, are left out.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// Version is the schema version of archives written by Export. Import rejects archives of newer versions.
+	// Version 2 added Manifest.TTLs.
+	Version = 2
+	// Root is the etcd directory which has all the state of goship.
+	Root = "/goship"
+
+	manifestName = "manifest.json"
+	// etcdDir is the directory of the archive which has the values of keys at their paths.
+	etcdDir = "etcd"
+	// historyDir is the directory of the archive which has the deploy history files.
+	historyDir = "history"
+)
+
+// transientDirs are the etcd directories of keys which make sense only to the running instances.
+var transientDirs = []string{"/goship/running", "/goship/leader", "/goship/ratelimit"}
+
+// ErrNotEmpty means that Import refused to restore into a store which already has state.
+var ErrNotEmpty = errors.New("the store is not empty; restore with force to overwrite it")
+
+// InvalidError means that Import rejected the archive, which is broken or has values rejected by Options.Check.
+// Nothing is written then.
+type InvalidError struct {
+	Err error
+}
+
+func (e InvalidError) Error() string {
+	return e.Err.Error()
+}
+
+// Store is the subset of etcd.Client which is backed up.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Keys is the number of etcd keys in the archive.
+	Keys int `json:"keys"`
+	// Files is the number of deploy history files in the archive.
+	Files int `json:"files"`
+	// TTLs are the seconds which the keys with TTLs had left at the export, e.g. host locks and drains.
+	TTLs map[string]int64 `json:"ttls,omitempty"`
+}
+
+// Export writes an archive of the keys under Root in "s" and the deploy history files in "dataDir" into "w".
+func Export(w io.Writer, s Store, dataDir string, now time.Time) (Manifest, error) {
+	keys, ttls, err := readKeys(s)
+	if err != nil {
+		return Manifest{}, err
+	}
+	files, err := readHistory(dataDir)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m := Manifest{Version: Version, Created: now.UTC(), Keys: len(keys), Files: len(files)}
+	if len(ttls) > 0 {
+		m.TTLs = ttls
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, content []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: m.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	if err := add(manifestName, buf); err != nil {
+		return Manifest{}, err
+	}
+	for _, key := range sortedKeys(keys) {
+		if err := add(etcdDir+key, []byte(keys[key])); err != nil {
+			return Manifest{}, err
+		}
+	}
+	for _, name := range sortedNames(files) {
+		if err := add(path.Join(historyDir, name), files[name]); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// Options configures Import.
+type Options struct {
+	// Force restores into a store which already has state. Keys and files in the archive overwrite the existing ones,
+	// and the others are kept.
+	Force bool
+	// Check validates the value of each key before anything is written if not nil, e.g. that its secrets can be decrypted.
+	Check func(key, value string) error
+}
+
+// Import restores the archive in "r" written by Export into "s" and "dataDir".
+// The whole archive is read and validated before anything is written, so that a broken archive changes nothing.
+// It fails with InvalidError if the archive is rejected, and with ErrNotEmpty if "s" or "dataDir" already has state unless Force is set.
+func Import(r io.Reader, s Store, dataDir string, opts Options) (Manifest, error) {
+	m, keys, files, err := readArchive(r)
+	if err != nil {
+		return Manifest{}, InvalidError{Err: err}
+	}
+	if opts.Check != nil {
+		for _, key := range sortedKeys(keys) {
+			if err := opts.Check(key, keys[key]); err != nil {
+				return Manifest{}, InvalidError{Err: fmt.Errorf("invalid %s: %v", key, err)}
+			}
+		}
+	}
+	if !opts.Force {
+		existing, _, err := readKeys(s)
+		if err != nil {
+			return Manifest{}, err
+		}
+		history, err := readHistory(dataDir)
+		if err != nil {
+			return Manifest{}, err
+		}
+		if len(existing) > 0 || len(history) > 0 {
+			return Manifest{}, ErrNotEmpty
+		}
+	}
+
+	for _, key := range sortedKeys(keys) {
+		if _, err := s.Set(key, keys[key], uint64(m.TTLs[key])); err != nil {
+			return Manifest{}, fmt.Errorf("failed to restore %s: %v", key, err)
+		}
+	}
+	if len(files) > 0 {
+		if err := os.MkdirAll(dataDir, 0777); err != nil {
+			return Manifest{}, err
+		}
+	}
+	for _, name := range sortedNames(files) {
+		if err := writeFile(filepath.Join(dataDir, name), files[name]); err != nil {
+			return Manifest{}, fmt.Errorf("failed to restore %s: %v", name, err)
+		}
+	}
+	return m, nil
+}
+
+// readArchive reads and validates all the entries of the archive in "r".
+func readArchive(r io.Reader) (m Manifest, keys map[string]string, files map[string][]byte, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, nil, nil, fmt.Errorf("not a backup archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	keys, files = make(map[string]string), make(map[string][]byte)
+	var found bool
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, nil, nil, fmt.Errorf("broken backup archive: %v", err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return Manifest{}, nil, nil, fmt.Errorf("broken backup archive: %v", err)
+		}
+		switch name := hdr.Name; {
+		case name == manifestName:
+			if err := json.Unmarshal(content, &m); err != nil {
+				return Manifest{}, nil, nil, fmt.Errorf("broken manifest: %v", err)
+			}
+			found = true
+		case strings.HasPrefix(name, etcdDir+"/"):
+			key := strings.TrimPrefix(name, etcdDir)
+			if !validKey(key) {
+				return Manifest{}, nil, nil, fmt.Errorf("invalid key %q in the archive", key)
+			}
+			keys[key] = string(content)
+		case strings.HasPrefix(name, historyDir+"/"):
+			base := strings.TrimPrefix(name, historyDir+"/")
+			if !validHistoryName(base) {
+				return Manifest{}, nil, nil, fmt.Errorf("invalid history file %q in the archive", name)
+			}
+			var entries []json.RawMessage
+			if err := json.Unmarshal(content, &entries); err != nil {
+				return Manifest{}, nil, nil, fmt.Errorf("broken history file %s: %v", base, err)
+			}
+			files[base] = content
+		default:
+			return Manifest{}, nil, nil, fmt.Errorf("unknown entry %q in the archive", name)
+		}
+	}
+	switch {
+	case !found:
+		return Manifest{}, nil, nil, errors.New("no manifest in the archive")
+	case m.Version < 1 || m.Version > Version:
+		return Manifest{}, nil, nil, fmt.Errorf("unsupported version %d of the archive; want %d or older", m.Version, Version)
+	case m.Keys != len(keys) || m.Files != len(files):
+		return Manifest{}, nil, nil, fmt.Errorf("truncated archive: %d keys and %d files; want %d and %d", len(keys), len(files), m.Keys, m.Files)
+	}
+	for key, ttl := range m.TTLs {
+		if _, ok := keys[key]; !ok || ttl <= 0 {
+			return Manifest{}, nil, nil, fmt.Errorf("invalid TTL %d of %q in the manifest", ttl, key)
+		}
+	}
+	return m, keys, files, nil
+}
+
+// validKey returns true iff "key" is a clean path under Root.
+func validKey(key string) bool {
+	return strings.HasPrefix(key, Root+"/") && path.Clean(key) == key
+}
+
+// validHistoryName returns true iff "name" is a deploy history file directly in the data directory.
+func validHistoryName(name string) bool {
+	return strings.HasSuffix(name, ".json") && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+// readKeys returns the values of the keys under Root in "s" except transient ones, and the TTLs of the keys which have any.
+// Keys in directories with TTLs get the TTLs of the directories, since the directories cannot be restored as such.
+func readKeys(s Store) (map[string]string, map[string]int64, error) {
+	keys, ttls := make(map[string]string), make(map[string]int64)
+	resp, err := s.Get(Root, true, true)
+	if err != nil {
+		if etcderr.IsKeyNotFound(err) {
+			return keys, ttls, nil
+		}
+		return nil, nil, err
+	}
+	var walk func(n *etcd.Node, ttl int64)
+	walk = func(n *etcd.Node, ttl int64) {
+		if transient(n.Key) {
+			return
+		}
+		left := n.TTL
+		if n.Expiration != nil && left <= 0 {
+			// expiring within the second
+			left = 1
+		}
+		if left > 0 && (ttl == 0 || left < ttl) {
+			ttl = left
+		}
+		if !n.Dir {
+			keys[n.Key] = n.Value
+			if ttl > 0 {
+				ttls[n.Key] = ttl
+			}
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child, ttl)
+		}
+	}
+	walk(resp.Node, 0)
+	return keys, ttls, nil
+}
+
+// transient returns true if "key" is in transientDirs.
+func transient(key string) bool {
+	for _, dir := range transientDirs {
+		if key == dir || strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// readHistory returns the contents of the deploy history files in "dataDir" by their names.
+func readHistory(dataDir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	names, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !validHistoryName(filepath.Base(name)) {
+			continue
+		}
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Base(name)] = buf
+	}
+	return files, nil
+}
+
+// writeFile writes "content" into "name" through a temporary file, so that readers never see a half-written file.
+func writeFile(name string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".restore")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func sortedKeys(keys map[string]string) []string {
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func sortedNames(files map[string][]byte) []string {
+	var sorted []string
+	for name := range files {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
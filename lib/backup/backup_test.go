@@ -0,0 +1,305 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// memStore is a Store in memory, which keeps the TTLs of keys in seconds in "ttls".
+type memStore struct {
+	values map[string]string
+	ttls   map[string]int64
+}
+
+func newMemStore() memStore {
+	return memStore{values: make(map[string]string), ttls: make(map[string]int64)}
+}
+
+func (s memStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s.values[key]; ok {
+		return &etcd.Response{Node: s.leaf(key, v)}, nil
+	}
+	n := s.dir(key)
+	if n == nil {
+		return nil, &etcd.EtcdError{ErrorCode: 100}
+	}
+	return &etcd.Response{Node: n}, nil
+}
+
+func (s memStore) leaf(key, value string) *etcd.Node {
+	return &etcd.Node{Key: key, Value: value, TTL: s.ttls[key]}
+}
+
+func (s memStore) dir(key string) *etcd.Node {
+	children := make(map[string]bool)
+	for k := range s.values {
+		if strings.HasPrefix(k, key+"/") {
+			children[key+"/"+strings.SplitN(strings.TrimPrefix(k, key+"/"), "/", 2)[0]] = true
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	n := &etcd.Node{Key: key, Dir: true}
+	for _, k := range keys {
+		if v, ok := s.values[k]; ok {
+			n.Nodes = append(n.Nodes, s.leaf(k, v))
+		} else {
+			n.Nodes = append(n.Nodes, s.dir(k))
+		}
+	}
+	return n
+}
+
+func (s memStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s.values[key] = value
+	if ttl > 0 {
+		s.ttls[key] = int64(ttl)
+	} else {
+		delete(s.ttls, key)
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+// populated returns a store with state of every kind and a data directory with deploy history.
+func populated(t *testing.T) (memStore, string) {
+	s := newMemStore()
+	for key, value := range map[string]string{
+		"/goship/config":                                    `{"deploy_user": "deployer", "pivotal": {"token": "enc:v1:0badcafe:c2VjcmV0"}}`,
+		"/goship/projects/api/config":                       `{"repo_owner": "gengo", "repo_name": "api"}`,
+		"/goship/projects/api/environments/production":      `{"branch": "master", "deploy": "/bin/true"}`,
+		"/goship/activity/20160401T000000Z-1":               `{"type": "lock", "user": "alice"}`,
+		"/goship/tokens/0123abcd":                           `{"id": "0123abcd", "user": "alice", "digest": "5e88489"}`,
+		"/goship/users/alice":                               `{"favorites": ["api"]}`,
+		"/goship/hostlocks/api/production/app1.example.com": `{"user": "alice"}`,
+		"/goship/drains/api/production/app2.example.com":    `{"by": "bob"}`,
+		"/goship/running/api-production-1":                  `{"project": "api"}`,
+		"/goship/ratelimit/alice":                           `{"tokens": 3}`,
+	} {
+		s.values[key] = value
+	}
+	s.ttls["/goship/hostlocks/api/production/app1.example.com"] = 3600
+	s.ttls["/goship/drains/api/production/app2.example.com"] = 120
+	s.ttls["/goship/running/api-production-1"] = 60
+
+	dir, err := ioutil.TempDir("", "goship-backup")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(...) failed with %v", err)
+	}
+	for name, content := range map[string]string{
+		"api-production.json": `[{"user": "alice", "success": true}]`,
+		"known_hosts":         "app1.example.com ssh-ed25519 AAAA",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(%q) failed with %v", name, err)
+		}
+	}
+	return s, dir
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "goship-restore")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(...) failed with %v", err)
+	}
+	return dir
+}
+
+func TestRoundTrip(t *testing.T) {
+	src, srcDir := populated(t)
+	defer os.RemoveAll(srcDir)
+	var buf bytes.Buffer
+	now := time.Date(2016, 4, 1, 9, 0, 0, 0, time.UTC)
+	m, err := Export(&buf, src, srcDir, now)
+	if err != nil {
+		t.Fatalf("Export(...) failed with %v", err)
+	}
+	ttls := map[string]int64{
+		"/goship/hostlocks/api/production/app1.example.com": 3600,
+		"/goship/drains/api/production/app2.example.com":    120,
+	}
+	if want := (Manifest{Version: Version, Created: now, Keys: 8, Files: 1, TTLs: ttls}); !reflect.DeepEqual(m, want) {
+		t.Errorf("Export(...) = %#v; want %#v", m, want)
+	}
+
+	dst, dstDir := newMemStore(), tempDir(t)
+	defer os.RemoveAll(dstDir)
+	var checked []string
+	check := func(key, value string) error {
+		checked = append(checked, key)
+		return nil
+	}
+	got, err := Import(bytes.NewReader(buf.Bytes()), dst, dstDir, Options{Check: check})
+	if err != nil {
+		t.Fatalf("Import(...) failed with %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("Import(...) = %#v; want %#v", got, m)
+	}
+	delete(src.values, "/goship/running/api-production-1")
+	delete(src.values, "/goship/ratelimit/alice")
+	if !reflect.DeepEqual(dst.values, src.values) {
+		t.Errorf("restored %q; want %q without transient keys", dst.values, src.values)
+	}
+	if !reflect.DeepEqual(dst.ttls, ttls) {
+		t.Errorf("restored TTLs %v; want %v", dst.ttls, ttls)
+	}
+	if len(checked) != 8 {
+		t.Errorf("checked %q; want all the keys", checked)
+	}
+	history, err := ioutil.ReadFile(filepath.Join(dstDir, "api-production.json"))
+	if err != nil || string(history) != `[{"user": "alice", "success": true}]` {
+		t.Errorf("history = %q, %v; want restored", history, err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "known_hosts")); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(known_hosts) = %v; want not restored", err)
+	}
+}
+
+func TestImportRefusesNonEmptyStore(t *testing.T) {
+	src, srcDir := populated(t)
+	defer os.RemoveAll(srcDir)
+	var buf bytes.Buffer
+	if _, err := Export(&buf, src, srcDir, time.Now()); err != nil {
+		t.Fatalf("Export(...) failed with %v", err)
+	}
+
+	dst, dstDir := newMemStore(), tempDir(t)
+	defer os.RemoveAll(dstDir)
+	dst.values["/goship/users/bob"] = `{"favorites": ["web"]}`
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, dstDir, Options{}); err != ErrNotEmpty {
+		t.Fatalf("Import(...) failed with %v; want %v", err, ErrNotEmpty)
+	}
+	if len(dst.values) != 1 {
+		t.Errorf("store = %q after refusal; want it unchanged", dst.values)
+	}
+
+	// transient keys alone do not make the store non-empty
+	empty := newMemStore()
+	empty.values["/goship/leader"] = "goship-1"
+	empty.ttls["/goship/leader"] = 10
+	if _, err := Import(bytes.NewReader(buf.Bytes()), empty, dstDir, Options{}); err != nil {
+		t.Errorf("Import(...) into a store with only transient keys failed with %v", err)
+	}
+
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, dstDir, Options{Force: true}); err != nil {
+		t.Fatalf("Import(...) with force failed with %v", err)
+	}
+	if got, want := dst.values["/goship/users/bob"], `{"favorites": ["web"]}`; got != want {
+		t.Errorf("unrelated key = %q after forced restore; want %q kept", got, want)
+	}
+	if got, want := dst.values["/goship/config"], src.values["/goship/config"]; got != want {
+		t.Errorf("config = %q after forced restore; want %q", got, want)
+	}
+}
+
+func isInvalid(err error) bool {
+	_, ok := err.(InvalidError)
+	return ok
+}
+
+func TestImportValidatesBeforeWriting(t *testing.T) {
+	src, srcDir := populated(t)
+	defer os.RemoveAll(srcDir)
+	var buf bytes.Buffer
+	if _, err := Export(&buf, src, srcDir, time.Now()); err != nil {
+		t.Fatalf("Export(...) failed with %v", err)
+	}
+
+	dst, dstDir := newMemStore(), tempDir(t)
+	defer os.RemoveAll(dstDir)
+	check := func(key, value string) error {
+		if key == "/goship/config" {
+			return errors.New("secret is encrypted with unknown key 0badcafe")
+		}
+		return nil
+	}
+	if _, err := Import(bytes.NewReader(buf.Bytes()), dst, dstDir, Options{Check: check}); !isInvalid(err) {
+		t.Errorf("Import(...) failed with %v with an undecryptable secret; want InvalidError", err)
+	}
+	// truncated archive
+	if _, err := Import(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), dst, dstDir, Options{}); err == nil {
+		t.Errorf("Import(...) succeeded with a truncated archive; want failure")
+	}
+	if len(dst.values) != 0 {
+		t.Errorf("store = %q after failures; want nothing written", dst.values)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dstDir, "*")); len(names) != 0 {
+		t.Errorf("data directory = %q after failures; want nothing written", names)
+	}
+}
+
+// archive returns an archive of "entries" by their names in order.
+func archive(t *testing.T, entries ...[2]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0600, Size: int64(len(e[1]))}); err != nil {
+			t.Fatalf("tw.WriteHeader(...) failed with %v", err)
+		}
+		tw.Write([]byte(e[1]))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestImportRejectsMalformedArchives(t *testing.T) {
+	manifest := [2]string{"manifest.json", `{"version": 1, "keys": 1}`}
+	for _, spec := range []struct {
+		desc    string
+		archive []byte
+	}{
+		{desc: "not gzipped", archive: []byte("config")},
+		{desc: "no manifest", archive: archive(t, [2]string{"etcd/goship/config", "{}"})},
+		{desc: "unknown version", archive: archive(t, [2]string{"manifest.json", `{"version": 3, "keys": 1}`}, [2]string{"etcd/goship/config", "{}"})},
+		{desc: "TTL of a missing key", archive: archive(t, [2]string{"manifest.json", `{"version": 2, "keys": 1, "ttls": {"/goship/drains/api": 60}}`}, [2]string{"etcd/goship/config", "{}"})},
+		{desc: "negative TTL", archive: archive(t, [2]string{"manifest.json", `{"version": 2, "keys": 1, "ttls": {"/goship/config": -1}}`}, [2]string{"etcd/goship/config", "{}"})},
+		{desc: "missing keys", archive: archive(t, manifest)},
+		{desc: "outside of the root", archive: archive(t, manifest, [2]string{"etcd/other/config", "{}"})},
+		{desc: "path traversal", archive: archive(t, manifest, [2]string{"etcd/goship/../other", "{}"})},
+		{desc: "history outside of the data directory", archive: archive(t, [2]string{"manifest.json", `{"version": 1, "files": 1}`}, [2]string{"history/../api-production.json", "[]"})},
+		{desc: "broken history", archive: archive(t, [2]string{"manifest.json", `{"version": 1, "files": 1}`}, [2]string{"history/api-production.json", "{"})},
+		{desc: "unknown entry", archive: archive(t, manifest, [2]string{"etcd/goship/config", "{}"}, [2]string{"scripts/deploy.sh", "rm -rf /"})},
+	} {
+		dst := newMemStore()
+		dir := tempDir(t)
+		if _, err := Import(bytes.NewReader(spec.archive), dst, dir, Options{}); !isInvalid(err) {
+			t.Errorf("Import(...) failed with %v with %s; want InvalidError", err, spec.desc)
+		}
+		if len(dst.values) != 0 {
+			t.Errorf("store = %q with %s; want nothing written", dst.values, spec.desc)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestImportVersion1(t *testing.T) {
+	dst, dir := newMemStore(), tempDir(t)
+	defer os.RemoveAll(dir)
+	a := archive(t, [2]string{"manifest.json", `{"version": 1, "keys": 1}`}, [2]string{"etcd/goship/config", "{}"})
+	if _, err := Import(bytes.NewReader(a), dst, dir, Options{}); err != nil {
+		t.Fatalf("Import(...) failed with %v with an archive of version 1", err)
+	}
+	if got := dst.values["/goship/config"]; got != "{}" || len(dst.ttls) != 0 {
+		t.Errorf("config = %q with TTLs %v; want restored without TTLs", got, dst.ttls)
+	}
+}
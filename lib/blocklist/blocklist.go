@@ -0,0 +1,187 @@
+// Package blocklist manages commits which must not be deployed anywhere, e.g. a bad commit found in an incident, until they are reverted.
+// Entries are managed by admins and apply to all projects or to a single project.
+package blocklist
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains entries in "global/<sha>" or "projects/<project>/<sha>".
+	keyPrefix = "/goship/blocklist"
+)
+
+// Store is the subset of etcd.Client which stores the blocklist.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Entry is a blocklisted commit.
+type Entry struct {
+	// SHA is the commit, which is abbreviated to 7 characters or longer.
+	SHA string `json:"sha"`
+	// Project is the project which the entry applies to. It applies to all projects if empty.
+	Project string    `json:"project,omitempty"`
+	Reason  string    `json:"reason"`
+	By      string    `json:"by"`
+	Created time.Time `json:"created"`
+}
+
+// Matches returns true iff the full or abbreviated commit "sha" is the commit of "e".
+func (e Entry) Matches(sha string) bool {
+	if len(sha) < minSHALength {
+		return false
+	}
+	return strings.HasPrefix(sha, e.SHA) || strings.HasPrefix(e.SHA, sha)
+}
+
+// minSHALength is the shortest abbreviation of commits accepted, which is the default of git.
+const minSHALength = 7
+
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// ErrNotFound means that the commit is not blocklisted.
+var ErrNotFound = fmt.Errorf("commit not blocklisted")
+
+func key(project, sha string) (string, error) {
+	if !shaPattern.MatchString(sha) {
+		return "", fmt.Errorf("sha: must be a commit of 7 to 40 lowercase hex digits")
+	}
+	if project == "" {
+		return path.Join(keyPrefix, "global", sha), nil
+	}
+	if project == "." || project == ".." || strings.Contains(project, "/") {
+		return "", fmt.Errorf("invalid project name %q", project)
+	}
+	return path.Join(keyPrefix, "projects", project, sha), nil
+}
+
+// Add blocklists the commit in "e" on behalf of "by" at "now", and returns the stored entry.
+func Add(s Store, e Entry, by string, now time.Time) (Entry, error) {
+	e.SHA, e.Reason = strings.ToLower(strings.TrimSpace(e.SHA)), strings.TrimSpace(e.Reason)
+	k, err := key(e.Project, e.SHA)
+	if err != nil {
+		return Entry{}, err
+	}
+	if e.Reason == "" {
+		return Entry{}, fmt.Errorf("reason: no reason specified")
+	}
+	e.By, e.Created = by, now
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, err := s.Set(k, string(buf), 0); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Remove removes the commit "sha" from the blocklist of "project", or from the global one if "project" is empty.
+func Remove(s Store, project, sha string) error {
+	k, err := key(project, strings.ToLower(sha))
+	if err != nil {
+		return err
+	}
+	if _, err := s.Delete(k, false); err != nil {
+		if etcderr.IsKeyNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// List is the blocklisted commits sorted from the newest one.
+type List []Entry
+
+// Load returns all the blocklisted commits.
+func Load(s Store) (List, error) {
+	resp, err := s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return List{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := List{}
+	var walk func(n *etcd.Node) error
+	walk = func(n *etcd.Node) error {
+		if n.Dir {
+			for _, c := range n.Nodes {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(n.Value), &e); err != nil {
+			return fmt.Errorf("malformed blocklist entry %s: %v", n.Key, err)
+		}
+		list = append(list, e)
+		return nil
+	}
+	if err := walk(resp.Node); err != nil {
+		return nil, err
+	}
+	sort.Sort(byCreated(list))
+	return list, nil
+}
+
+// For returns the entries which apply to "project".
+func (l List) For(project string) List {
+	var applied List
+	for _, e := range l {
+		if e.Project == "" || e.Project == project {
+			applied = append(applied, e)
+		}
+	}
+	return applied
+}
+
+// Find returns the first entry in "l" which matches "sha".
+func (l List) Find(sha string) (Entry, bool) {
+	for _, e := range l {
+		if e.Matches(sha) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Contained returns the entries in "l" which match any of "shas".
+func (l List) Contained(shas []string) List {
+	var found List
+	for _, e := range l {
+		for _, sha := range shas {
+			if e.Matches(sha) {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+type byCreated List
+
+func (l byCreated) Len() int      { return len(l) }
+func (l byCreated) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byCreated) Less(i, j int) bool {
+	if !l[i].Created.Equal(l[j].Created) {
+		return l[i].Created.After(l[j].Created)
+	}
+	return l[i].SHA < l[j].SHA
+}
@@ -0,0 +1,110 @@
+package blocklist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestAddValidation(t *testing.T) {
+	for _, e := range []Entry{
+		{SHA: "0123ab", Reason: "too short"},
+		{SHA: "0123abz", Reason: "not hex"},
+		{SHA: strings.Repeat("a", 41), Reason: "too long"},
+		{SHA: "0123abc"},
+		{SHA: "0123abc", Project: "../api", Reason: "invalid project"},
+	} {
+		s := etcdtest.NewStore()
+		if got, err := Add(s, e, "alice", now); err == nil {
+			t.Errorf("Add(s, %#v, %q, now) = %#v; want failure", e, "alice", got)
+		}
+		if len(s.Values) != 0 {
+			t.Errorf("Add(s, %#v, %q, now) stored %v; want nothing", e, "alice", s.Values)
+		}
+	}
+	got, err := Add(etcdtest.NewStore(), Entry{SHA: " 0123ABC ", Reason: " corrupts sessions "}, "alice", now)
+	if err != nil {
+		t.Fatalf("Add failed with %v", err)
+	}
+	if want := (Entry{SHA: "0123abc", Reason: "corrupts sessions", By: "alice", Created: now}); got != want {
+		t.Errorf("Add(...) = %#v; want %#v", got, want)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	s := etcdtest.NewStore()
+	for i, e := range []Entry{
+		{SHA: "bad0001", Reason: "leaks tokens"},
+		{SHA: "bad0002", Project: "api", Reason: "corrupts sessions"},
+		{SHA: "bad0003", Project: "web", Reason: "breaks web"},
+		// the same commit in another scope
+		{SHA: "bad0001", Project: "api", Reason: "leaks tokens of api"},
+	} {
+		if _, err := Add(s, e, "alice", now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("Add(s, %#v, %q, now) failed with %v", e, "alice", err)
+		}
+	}
+	list, err := Load(s)
+	if err != nil {
+		t.Fatalf("Load(s) failed with %v", err)
+	}
+	if got, want := reasons(list), []string{"leaks tokens of api", "breaks web", "corrupts sessions", "leaks tokens"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Load(s) = %q; want %q from the newest", got, want)
+	}
+	if got, want := reasons(list.For("api")), []string{"leaks tokens of api", "corrupts sessions", "leaks tokens"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list.For(%q) = %q; want %q", "api", got, want)
+	}
+	if got, want := reasons(list.For("worker")), []string{"leaks tokens"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list.For(%q) = %q; want %q", "worker", got, want)
+	}
+
+	if err := Remove(s, "", "bad0001"); err != nil {
+		t.Fatalf("Remove(s, %q, %q) failed with %v", "", "bad0001", err)
+	}
+	if err := Remove(s, "web", "bad0002"); err != ErrNotFound {
+		t.Errorf("Remove(s, %q, %q) failed with %v; want %v", "web", "bad0002", err, ErrNotFound)
+	}
+	if list, err = Load(s); err != nil {
+		t.Fatalf("Load(s) failed with %v", err)
+	}
+	if got, want := reasons(list.For("worker")), []string(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("list.For(%q) after Remove = %q; want %q", "worker", got, want)
+	}
+}
+
+func TestContained(t *testing.T) {
+	list := List{
+		{SHA: "bad0001", Reason: "abbreviated"},
+		{SHA: "bad0002cafebabe", Reason: "full"},
+		{SHA: "bad0003", Reason: "not in range"},
+	}
+	for _, spec := range []struct {
+		shas []string
+		want []string
+	}{
+		{shas: nil},
+		{shas: []string{"0123456789abcdef"}},
+		{shas: []string{"0123456789abcdef", "bad0001ffffffff"}, want: []string{"abbreviated"}},
+		// abbreviated revisions
+		{shas: []string{"bad0002", "bad0001f"}, want: []string{"abbreviated", "full"}},
+		// too short to match
+		{shas: []string{"bad000"}},
+	} {
+		if got := reasons(list.Contained(spec.shas)); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("list.Contained(%q) = %q; want %q", spec.shas, got, spec.want)
+		}
+	}
+}
+
+func reasons(list List) []string {
+	var rs []string
+	for _, e := range list {
+		rs = append(rs, e.Reason)
+	}
+	return rs
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxHostnameLength is the maximum length of a host name in RFC 1035.
+	maxHostnameLength = 253
+	// maxLabelLength is the maximum length of a label in a host name in RFC 1035.
+	maxLabelLength = 63
+)
+
+// HostAddress is the address of a host in the form of RFC 3986, i.e. a host name, an IPv4 address or
+// a bracketed IPv6 address, optionally followed by ":port".
+type HostAddress struct {
+	// Host is a host name, an IPv4 address or an IPv6 address without brackets.
+	Host string
+	// Port is empty if not specified.
+	Port string
+}
+
+// ParseHostAddress parses "s" into a HostAddress.
+// It accepts "host", "host:port", "1.2.3.4", "1.2.3.4:port", "[2001:db8::1]", "[2001:db8::1]:port" and bare "2001:db8::1".
+func ParseHostAddress(s string) (HostAddress, error) {
+	if s == "" {
+		return HostAddress{}, errorf(ErrInvalid, "empty host address")
+	}
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return HostAddress{}, errorf(ErrInvalid, "host address %q: missing ']' after the IPv6 address", s)
+		}
+		ip, rest := s[1:end], s[end+1:]
+		if !isIPv6(ip) {
+			return HostAddress{}, errorf(ErrInvalid, "host address %q: %q in brackets is not an IPv6 address", s, ip)
+		}
+		a := HostAddress{Host: canonicalIP(ip)}
+		if rest == "" {
+			return a, nil
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return HostAddress{}, errorf(ErrInvalid, "host address %q: unexpected %q after the IPv6 address", s, rest)
+		}
+		port, err := parsePort(s, rest[1:])
+		if err != nil {
+			return HostAddress{}, err
+		}
+		a.Port = port
+		return a, nil
+	}
+
+	switch strings.Count(s, ":") {
+	case 0:
+		return parseHostname(s, s, "")
+	case 1:
+		i := strings.Index(s, ":")
+		port, err := parsePort(s, s[i+1:])
+		if err != nil {
+			return HostAddress{}, err
+		}
+		return parseHostname(s, s[:i], port)
+	}
+	if !isIPv6(s) {
+		return HostAddress{}, errorf(ErrInvalid, "host address %q: not an IPv6 address; bracket IPv6 addresses with ports like [2001:db8::1]:22", s)
+	}
+	return HostAddress{Host: canonicalIP(s)}, nil
+}
+
+// parseHostname parses "name" in the host address "s" as a host name or an IPv4 address.
+func parseHostname(s, name, port string) (HostAddress, error) {
+	if net.ParseIP(name) != nil {
+		return HostAddress{Host: name, Port: port}, nil
+	}
+	if name == "" {
+		return HostAddress{}, errorf(ErrInvalid, "host address %q: empty host name", s)
+	}
+	if len(name) > maxHostnameLength {
+		return HostAddress{}, errorf(ErrInvalid, "host address %q: host name longer than %d characters", s, maxHostnameLength)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if err := validateLabel(label); err != nil {
+			return HostAddress{}, errorf(ErrInvalid, "host address %q: %v", s, err)
+		}
+	}
+	return HostAddress{Host: name, Port: port}, nil
+}
+
+// validateLabel returns an error unless "label" is a valid label of a host name.
+// It allows "_" for compatibility with internal names.
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label in the host name")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q longer than %d characters", label, maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q starts or ends with '-'", label)
+	}
+	for _, c := range label {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("invalid character %q in label %q", c, label)
+		}
+	}
+	return nil
+}
+
+func parsePort(s, port string) (string, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 || strings.HasPrefix(port, "+") {
+		return "", errorf(ErrInvalid, "host address %q: port %q is not a number between 1 and 65535", s, port)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// isIPv6 returns true iff "s" is an IPv6 address, optionally with a zone like "fe80::1%eth0".
+func isIPv6(s string) bool {
+	if i := strings.Index(s, "%"); i >= 0 {
+		if i == len(s)-1 {
+			return false
+		}
+		s = s[:i]
+	}
+	return strings.Contains(s, ":") && net.ParseIP(s) != nil
+}
+
+// canonicalIP returns the IPv6 address "s" in the canonical form of RFC 5952.
+func canonicalIP(s string) string {
+	var zone string
+	if i := strings.Index(s, "%"); i >= 0 {
+		s, zone = s[:i], s[i:]
+	}
+	return net.ParseIP(s).String() + zone
+}
+
+// String returns the address with IPv6 addresses bracketed, e.g. "[2001:db8::1]" or "[2001:db8::1]:2222".
+func (a HostAddress) String() string {
+	if a.Port != "" {
+		return net.JoinHostPort(a.Host, a.Port)
+	}
+	if strings.Contains(a.Host, ":") {
+		return "[" + a.Host + "]"
+	}
+	return a.Host
+}
+
+// normalizeHosts validates the addresses of "hosts" and replaces them with the normalized forms.
+func normalizeHosts(hosts []Host) error {
+	for i, h := range hosts {
+		a, err := ParseHostAddress(h.Name)
+		if err != nil {
+			return err
+		}
+		hosts[i].Name = a.String()
+	}
+	return nil
+}
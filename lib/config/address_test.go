@@ -0,0 +1,85 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestParseHostAddress(t *testing.T) {
+	for _, spec := range []struct {
+		addr string
+		want config.HostAddress
+		// str is the normalized form.
+		str string
+	}{
+		{addr: "web1.example.com", want: config.HostAddress{Host: "web1.example.com"}, str: "web1.example.com"},
+		{addr: "web1.example.com.", want: config.HostAddress{Host: "web1.example.com."}, str: "web1.example.com."},
+		{addr: "web1", want: config.HostAddress{Host: "web1"}, str: "web1"},
+		{addr: "web_1.internal", want: config.HostAddress{Host: "web_1.internal"}, str: "web_1.internal"},
+		{addr: "web1.example.com:2222", want: config.HostAddress{Host: "web1.example.com", Port: "2222"}, str: "web1.example.com:2222"},
+		{addr: "10.0.0.1", want: config.HostAddress{Host: "10.0.0.1"}, str: "10.0.0.1"},
+		{addr: "10.0.0.1:22", want: config.HostAddress{Host: "10.0.0.1", Port: "22"}, str: "10.0.0.1:22"},
+		{addr: "2001:db8::1", want: config.HostAddress{Host: "2001:db8::1"}, str: "[2001:db8::1]"},
+		{addr: "2001:DB8:0:0::1", want: config.HostAddress{Host: "2001:db8::1"}, str: "[2001:db8::1]"},
+		{addr: "::1", want: config.HostAddress{Host: "::1"}, str: "[::1]"},
+		{addr: "[2001:db8::1]", want: config.HostAddress{Host: "2001:db8::1"}, str: "[2001:db8::1]"},
+		{addr: "[2001:db8::1]:2222", want: config.HostAddress{Host: "2001:db8::1", Port: "2222"}, str: "[2001:db8::1]:2222"},
+		{addr: "[fe80::1%eth0]:22", want: config.HostAddress{Host: "fe80::1%eth0", Port: "22"}, str: "[fe80::1%eth0]:22"},
+		{addr: "fe80::1%eth0", want: config.HostAddress{Host: "fe80::1%eth0"}, str: "[fe80::1%eth0]"},
+	} {
+		got, err := config.ParseHostAddress(spec.addr)
+		if err != nil {
+			t.Errorf("config.ParseHostAddress(%q) failed with %v", spec.addr, err)
+			continue
+		}
+		if got != spec.want {
+			t.Errorf("config.ParseHostAddress(%q) = %#v; want %#v", spec.addr, got, spec.want)
+		}
+		if got := got.String(); got != spec.str {
+			t.Errorf("config.ParseHostAddress(%q).String() = %q; want %q", spec.addr, got, spec.str)
+		}
+	}
+}
+
+func TestParseHostAddressInvalid(t *testing.T) {
+	for _, spec := range []struct {
+		addr string
+		// msg is a part of the expected error message.
+		msg string
+	}{
+		{addr: "", msg: "empty host address"},
+		{addr: "[2001:db8::1", msg: "missing ']'"},
+		{addr: "[web1.example.com]:22", msg: "is not an IPv6 address"},
+		{addr: "[10.0.0.1]", msg: "is not an IPv6 address"},
+		{addr: "[2001:db8::1]2222", msg: "unexpected"},
+		{addr: "[2001:db8::1]:", msg: "is not a number"},
+		{addr: "[2001:db8::1]:ssh", msg: "is not a number"},
+		{addr: "2001:db8::1:2222:", msg: "not an IPv6 address"},
+		{addr: "2001:db8::g", msg: "not an IPv6 address"},
+		{addr: "web1:22:22", msg: "not an IPv6 address"},
+		{addr: "web1:0", msg: "is not a number"},
+		{addr: "web1:65536", msg: "is not a number"},
+		{addr: "web1:+22", msg: "is not a number"},
+		{addr: ":22", msg: "empty host name"},
+		{addr: "web1..example.com", msg: "empty label"},
+		{addr: "-web1.example.com", msg: "starts or ends with '-'"},
+		{addr: "web 1", msg: "invalid character"},
+		{addr: "user@web1", msg: "invalid character"},
+		{addr: strings.Repeat("a", 64) + ".example.com", msg: "longer than 63"},
+		{addr: strings.Repeat("a.", 127) + "com", msg: "longer than 253"},
+	} {
+		got, err := config.ParseHostAddress(spec.addr)
+		if err == nil {
+			t.Errorf("config.ParseHostAddress(%q) = %#v; want failure", spec.addr, got)
+			continue
+		}
+		if !strings.Contains(err.Error(), spec.msg) {
+			t.Errorf("config.ParseHostAddress(%q) failed with %q; want an error with %q", spec.addr, err, spec.msg)
+		}
+		if !strings.Contains(err.Error(), spec.addr) {
+			t.Errorf("config.ParseHostAddress(%q) failed with %q; want an error with the address", spec.addr, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import "time"
+
+// BakeRequirement requires revisions to run in another environment of the project for a while
+// before they are deployed into the environment, e.g. in staging for 2 hours before production.
+type BakeRequirement struct {
+	// Environment is the name of the environment of the same project which revisions bake in.
+	Environment string `json:"environment" yaml:"environment"`
+	// Minutes is how long revisions must have been deployed into Environment.
+	Minutes int `json:"minutes" yaml:"minutes"`
+}
+
+// Duration returns how long revisions must bake.
+func (b BakeRequirement) Duration() time.Duration {
+	return time.Duration(b.Minutes) * time.Minute
+}
+
+// validateBakeRequirements returns an error if RequiresBake of an environment of "p" refers to an unknown environment
+// or has no positive duration.
+func (p Project) validateBakeRequirements() error {
+	for _, e := range p.Environments {
+		b := e.RequiresBake
+		if b == nil {
+			continue
+		}
+		if b.Minutes <= 0 {
+			return errorf(ErrInvalid, "requires_bake: minutes of %s of %s must be positive", e.Name, p.Name)
+		}
+		if b.Environment == e.Name {
+			return errorf(ErrInvalid, "requires_bake: %s of %s cannot bake in itself", e.Name, p.Name)
+		}
+		if _, _, err := EnvironmentFromName([]Project{p}, p.Name, b.Environment); err != nil {
+			return errorf(ErrInvalid, "requires_bake: unknown environment %q in %s of %s", b.Environment, e.Name, p.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestBakeRequirementValidate(t *testing.T) {
+	for _, spec := range []struct {
+		b   *config.BakeRequirement
+		msg string
+	}{
+		{},
+		{b: &config.BakeRequirement{Environment: "staging", Minutes: 120}},
+		{b: &config.BakeRequirement{Environment: "staging"}, msg: "must be positive"},
+		{b: &config.BakeRequirement{Environment: "production", Minutes: 120}, msg: "cannot bake in itself"},
+		{b: &config.BakeRequirement{Environment: "qa", Minutes: 120}, msg: `unknown environment "qa"`},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name: "api",
+			Environments: []config.Environment{
+				{Name: "staging", Deploy: "/bin/true"},
+				{Name: "production", Deploy: "/bin/true", RequiresBake: spec.b},
+			},
+		}}}, spec.msg)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// validEnvironmentName matches names of environments which can be used in etcd keys and URLs.
+var validEnvironmentName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// CloneEnvironment returns a copy of "src" which is named "name" and deploys to "hosts".
+// The lock, the comment and the expiry of "src" are not copied since they are about the state of "src".
+func CloneEnvironment(src Environment, name string, hosts []Host) Environment {
+	env := src
+	env.Name = name
+	env.Comment = ""
+	env.Lock = nil
+	env.AutoLock = nil
+	env.Ephemeral = nil
+	env.DeployCommand = append([]string(nil), src.DeployCommand...)
+	env.PivotalEvents = append([]PivotalEvent(nil), src.PivotalEvents...)
+	env.DependsOn = append([]string(nil), src.DependsOn...)
+	env.AllowedFlags = append([]string(nil), src.AllowedFlags...)
+	env.Hosts = nil
+	for _, h := range hosts {
+		tags := make(map[string]string)
+		for k, v := range h.Tags {
+			tags[k] = v
+		}
+		if len(tags) == 0 {
+			tags = nil
+		}
+		env.Hosts = append(env.Hosts, Host{Name: h.Name, Tags: tags})
+	}
+	return env
+}
+
+// AddEnvironment stores "env" as a new environment of the project "proj" in "c".
+// It returns an error if the name of "env" is invalid or already used in the project.
+func AddEnvironment(client ETCDInterface, c Config, proj string, env Environment) error {
+	if !validEnvironmentName.MatchString(env.Name) {
+		return errorf(ErrInvalid, "invalid environment name %q", env.Name)
+	}
+	p, err := ProjectFromName(c.Projects, proj)
+	if err != nil {
+		return err
+	}
+	for _, e := range p.Environments {
+		if e.Name == env.Name {
+			return errorf(ErrAlreadyExists, "environment %s already exists in %s", env.Name, proj)
+		}
+	}
+	if err := env.validateDeployCommand(); err != nil {
+		return err
+	}
+	return storeEnvironment(client, env, fmt.Sprintf("/goship/projects/%s/environments", proj))
+}
@@ -0,0 +1,80 @@
+package config_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestCloneEnvironment(t *testing.T) {
+	src := config.Environment{
+		Name:          "staging",
+		DeployCommand: []string{"/usr/bin/deploy", "{{.Revision}}"},
+		RepoPath:      "/srv/app",
+		Hosts:         []config.Host{{Name: "web1.example.com"}},
+		Branch:        "develop",
+		Comment:       "DO NOT DEPLOY",
+		Lock:          &config.EnvironmentLock{By: "alice"},
+		PivotalEvents: []config.PivotalEvent{config.PivotalDeployFailed},
+		DependsOn:     []string{"api/staging"},
+	}
+	hosts := []config.Host{{Name: "web3.example.com", Tags: map[string]string{"role": "web"}}, {Name: "web4.example.com"}}
+	got := config.CloneEnvironment(src, "staging2", hosts)
+	want := config.Environment{
+		Name:          "staging2",
+		DeployCommand: []string{"/usr/bin/deploy", "{{.Revision}}"},
+		RepoPath:      "/srv/app",
+		Hosts:         hosts,
+		Branch:        "develop",
+		PivotalEvents: []config.PivotalEvent{config.PivotalDeployFailed},
+		DependsOn:     []string{"api/staging"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config.CloneEnvironment(%#v, %q, %#v) = %#v; want %#v", src, "staging2", hosts, got, want)
+	}
+
+	// the clone must not share slices and maps with the source
+	got.DeployCommand[0] = "/bin/false"
+	got.DependsOn[0] = "web/staging"
+	got.Hosts[0].Tags["role"] = "db"
+	if src.DeployCommand[0] != "/usr/bin/deploy" || src.DependsOn[0] != "api/staging" || hosts[0].Tags["role"] != "web" {
+		t.Errorf("modifying the clone changed the source: %#v, %#v", src, hosts)
+	}
+}
+
+func TestAddEnvironment(t *testing.T) {
+	c := config.Config{
+		Projects: []config.Project{
+			{Name: "test_project", Environments: []config.Environment{{Name: "staging"}}},
+		},
+	}
+	env := config.Environment{Name: "staging2", RepoPath: "/srv/app", Branch: "master"}
+	buf, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("json.Marshal(%#v) failed with %v", env, err)
+	}
+	ecl := mockEtcdClient{
+		setExpectation: map[string]string{
+			"/goship/projects/test_project/environments/staging2": string(buf),
+		},
+	}
+	if err := config.AddEnvironment(ecl, c, "test_project", env); err != nil {
+		t.Errorf("config.AddEnvironment(ecl, c, %q, %#v) failed with %v; want success", "test_project", env, err)
+	}
+
+	for _, spec := range []struct {
+		proj, name string
+	}{
+		{proj: "test_project", name: "staging"},
+		{proj: "test_project", name: ""},
+		{proj: "test_project", name: "../config"},
+		{proj: "unknown_project", name: "staging2"},
+	} {
+		env := config.Environment{Name: spec.name}
+		if err := config.AddEnvironment(ecl, c, spec.proj, env); err == nil {
+			t.Errorf("config.AddEnvironment(ecl, c, %q, %#v) succeeded; want failure", spec.proj, env)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package config
+
+import "time"
+
+// Keys of the columns of the dashboard which projects order in "columns".
+// The environment column always comes first and is not configurable.
+const (
+	// ColumnHosts lists the hosts of the environment with their tags.
+	ColumnHosts = "hosts"
+	// ColumnCommit is the revision deployed into each host. It includes diffs to the tip unless ColumnDiff is listed too.
+	ColumnCommit = "commit"
+	// ColumnDiff is the diff between the revision of each host and the tip.
+	ColumnDiff = "diff"
+	// ColumnDeploy is the deploy form.
+	ColumnDeploy = "deploy"
+	// ColumnComment is the comment of the environment, shown as a popover.
+	ColumnComment = "comment"
+	// ColumnBranch is the branch which the environment deploys from.
+	ColumnBranch = "branch"
+	// ColumnLastDeploy is the time of the latest deployment of the environment.
+	ColumnLastDeploy = "last_deploy"
+	// ColumnDeployer is who made the latest deployment of the environment.
+	ColumnDeployer = "deployer"
+	// ColumnCleanup suggests cleaning up the environment: it hints branches without recent commits and links
+	// the merged or closed pull request of the branch which the deployed revision belongs to.
+	ColumnCleanup = "cleanup"
+	// ColumnRisk is the risk of deploying the pending commits, filled by the dashboard with its breakdown on hover.
+	ColumnRisk = "risk"
+	// ColumnPlugins is where the plugin columns are. Plugin columns are hidden unless it is listed.
+	ColumnPlugins = "plugins"
+)
+
+// DefaultColumns are the columns of projects without "columns".
+var DefaultColumns = []string{ColumnHosts, ColumnPlugins, ColumnCommit, ColumnDeploy, ColumnComment}
+
+// knownColumns are the valid keys in "columns".
+var knownColumns = map[string]bool{
+	ColumnHosts:      true,
+	ColumnCommit:     true,
+	ColumnDiff:       true,
+	ColumnDeploy:     true,
+	ColumnComment:    true,
+	ColumnBranch:     true,
+	ColumnLastDeploy: true,
+	ColumnDeployer:   true,
+	ColumnCleanup:    true,
+	ColumnRisk:       true,
+	ColumnPlugins:    true,
+}
+
+// defaultStaleBranchDays is the default of Project.StaleBranchDays.
+const defaultStaleBranchDays = 30
+
+// StaleBranchAge returns how long branches of environments of "p" have received no commits before ColumnCleanup hints them.
+func (p Project) StaleBranchAge() time.Duration {
+	days := p.StaleBranchDays
+	if days <= 0 {
+		days = defaultStaleBranchDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ColumnKeys returns the keys of the columns of "p" in order, which default to DefaultColumns.
+func (p Project) ColumnKeys() []string {
+	if len(p.Columns) == 0 {
+		return DefaultColumns
+	}
+	return p.Columns
+}
+
+// validateColumns returns an error if "columns" of "p" has unknown or duplicate keys, or "stale_branch_days" is negative.
+func (p Project) validateColumns() error {
+	if p.StaleBranchDays < 0 {
+		return errorf(ErrInvalid, "negative stale_branch_days in %s", p.Name)
+	}
+	seen := make(map[string]bool)
+	for _, key := range p.Columns {
+		if !knownColumns[key] {
+			return errorf(ErrInvalid, "unknown column %q in columns of %s", key, p.Name)
+		}
+		if seen[key] {
+			return errorf(ErrInvalid, "column %q listed twice in columns of %s", key, p.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// PluginColumn configures a column of a plugin registered by name, e.g. {type: travis, params: {token: ...}}.
+type PluginColumn struct {
+	// ID identifies the column among the columns of the project for environments. It defaults to Type.
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Type is the name which the column factory is registered with.
+	Type   string            `json:"type" yaml:"type"`
+	Params map[string]string `json:"params,omitempty" yaml:"params,omitempty" goship:"secret"`
+}
+
+// Key returns the ID of "c", which defaults to its type.
+func (c PluginColumn) Key() string {
+	if c.ID != "" {
+		return c.ID
+	}
+	return c.Type
+}
+
+// Override returns "c" of a project overridden by "o" of an environment.
+// Params of "o" take precedence over ones of "c", and the type defaults to the one of "c".
+func (c PluginColumn) Override(o PluginColumn) PluginColumn {
+	if o.Type != "" && o.Type != c.Type {
+		return o
+	}
+	merged := PluginColumn{ID: c.ID, Type: c.Type, Params: make(map[string]string)}
+	for k, v := range c.Params {
+		merged.Params[k] = v
+	}
+	for k, v := range o.Params {
+		merged.Params[k] = v
+	}
+	return merged
+}
+
+// EnvironmentColumns customizes the plugin columns which an environment inherits from its project, e.g.
+// {add: [{type: jenkins, params: {job: api-staging}}], disable: [travis]}.
+type EnvironmentColumns struct {
+	// Add are columns of the environment. Ones with the same key as a column of the project override it,
+	// and the others are added after the columns of the project.
+	Add []PluginColumn `json:"add,omitempty" yaml:"add,omitempty"`
+	// Disable are the keys of columns of the project which are not rendered in the environment.
+	Disable []string `json:"disable,omitempty" yaml:"disable,omitempty"`
+}
+
+// ColumnsOf returns the plugin columns rendered in "env" of "p" in order.
+// The columns of the project come first in their order, overridden by ones of "env" with the same key and
+// excluding disabled ones, followed by the other columns of "env" in their order.
+func (p Project) ColumnsOf(env Environment) []PluginColumn {
+	if env.PluginColumns == nil {
+		return p.PluginColumns
+	}
+	disabled := make(map[string]bool)
+	for _, key := range env.PluginColumns.Disable {
+		disabled[key] = true
+	}
+	overrides := make(map[string]PluginColumn)
+	for _, c := range env.PluginColumns.Add {
+		overrides[c.Key()] = c
+	}
+	var cols []PluginColumn
+	inherited := make(map[string]bool)
+	for _, c := range p.PluginColumns {
+		key := c.Key()
+		inherited[key] = true
+		if disabled[key] {
+			continue
+		}
+		if o, ok := overrides[key]; ok {
+			c = c.Override(o)
+		}
+		cols = append(cols, c)
+	}
+	for _, c := range env.PluginColumns.Add {
+		if !inherited[c.Key()] {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// ParamsFor returns the params of "c" for the project "p".
+// Params not given in "c" default to "project", "repo_owner", "repo_name" and "travis_token" of "p".
+func (c PluginColumn) ParamsFor(p Project) map[string]string {
+	params := map[string]string{
+		"project":    p.Name,
+		"repo_owner": p.RepoOwner,
+		"repo_name":  p.RepoName,
+	}
+	if p.TravisToken != "" {
+		params["travis_token"] = p.TravisToken
+	}
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	return params
+}
+
+// columnCheck instantiates a plugin column to validate it. See SetColumnCheck.
+var columnCheck func(p Project, c PluginColumn) error
+
+// SetColumnCheck makes Load validate each PluginColumns of projects with "check".
+// The column registry sets it so that unknown types and bad params are found at load.
+func SetColumnCheck(check func(p Project, c PluginColumn) error) {
+	columnCheck = check
+}
+
+// validatePluginColumns returns an error if any of PluginColumns of "p" cannot be instantiated.
+func (p Project) validatePluginColumns() error {
+	for i, c := range p.PluginColumns {
+		if c.Type == "" {
+			return errorf(ErrInvalid, "type of plugin_columns[%d] of %s not configured", i, p.Name)
+		}
+		if columnCheck == nil {
+			continue
+		}
+		if err := columnCheck(p, c); err != nil {
+			return errorf(ErrInvalid, "invalid plugin_columns[%d] (%s) of %s: %v", i, c.Type, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateEnvironmentColumns returns an error if columns of any environment of "p" are malformed.
+// Keys which environments refer to must identify exactly one column of "p".
+func (p Project) validateEnvironmentColumns() error {
+	count := make(map[string]int)
+	for _, c := range p.PluginColumns {
+		count[c.Key()]++
+	}
+	for _, e := range p.Environments {
+		ec := e.PluginColumns
+		if ec == nil {
+			continue
+		}
+		for _, key := range ec.Disable {
+			switch count[key] {
+			case 0:
+				return errorf(ErrInvalid, "unknown column %q disabled in %s of %s", key, e.Name, p.Name)
+			case 1:
+			default:
+				return errorf(ErrInvalid, "column %q disabled in %s of %s is ambiguous; set id of the columns", key, e.Name, p.Name)
+			}
+		}
+		added := make(map[string]bool)
+		for i, c := range ec.Add {
+			key := c.Key()
+			if key == "" {
+				return errorf(ErrInvalid, "type of plugin_columns.add[%d] of %s of %s not configured", i, e.Name, p.Name)
+			}
+			if added[key] {
+				return errorf(ErrInvalid, "column %q added twice in %s of %s", key, e.Name, p.Name)
+			}
+			added[key] = true
+			if count[key] > 1 {
+				return errorf(ErrInvalid, "column %q overridden in %s of %s is ambiguous; set id of the columns", key, e.Name, p.Name)
+			}
+		}
+		for _, c := range p.ColumnsOf(e) {
+			if c.Type == "" {
+				return errorf(ErrInvalid, "type of column %q of %s of %s not configured", c.Key(), e.Name, p.Name)
+			}
+			if columnCheck == nil {
+				continue
+			}
+			if err := columnCheck(p, c); err != nil {
+				return errorf(ErrInvalid, "invalid column %q (%s) of %s of %s: %v", c.Key(), c.Type, e.Name, p.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+)
+
+// DeployParams are the values which placeholders in Environment.DeployCommand refer to.
+type DeployParams struct {
+	// Revision is the revision to be deployed.
+	Revision string
+	// Environment is the name of the environment.
+	Environment string
+	// Branch is the branch which the revision is deployed from.
+	Branch string
+	// Hosts are the names of hosts in the environment.
+	Hosts HostList
+}
+
+// HostList is a list of host names. It is rendered into a comma-separated list in templates.
+type HostList []string
+
+func (l HostList) String() string {
+	return strings.Join(l, ",")
+}
+
+// DeployArgv returns the program and arguments of the deployment command of the environment.
+//
+// Each element of DeployCommand is rendered as a template with "p" into an argument without any shell,
+// so values in "p" never change the structure of the command.
+// If DeployCommand is empty, it falls back to the legacy Deploy string, which is split on spaces,
+// or is passed to /bin/sh if Shell is true.
+func (e Environment) DeployArgv(p DeployParams) ([]string, error) {
+	if len(e.DeployCommand) > 0 {
+		return renderArgv(e.DeployCommand, p)
+	}
+	if e.Shell {
+		glog.Warningf("Deploying %s with a shell command. Consider using deploy_command instead", e.Name)
+		return []string{"/bin/sh", "-c", e.Deploy}, nil
+	}
+	// TODO(yugui) better handling of shell escape
+	return strings.Split(e.Deploy, " "), nil
+}
+
+// validateDeployCommand returns an error if DeployCommand of the environment cannot be rendered,
+// e.g. because a placeholder refers to an unknown field.
+func (e Environment) validateDeployCommand() error {
+	if len(e.DeployCommand) == 0 {
+		return nil
+	}
+	if _, err := e.DeployArgv(DeployParams{}); err != nil {
+		return errorf(ErrInvalid, "invalid deploy_command in %s: %v", e.Name, err)
+	}
+	return nil
+}
+
+// validateWorkDir returns an error if WorkDir of the environment is relative but goes out of the directory which it is relative to.
+func (e Environment) validateWorkDir() error {
+	if e.WorkDir == "" || filepath.IsAbs(e.WorkDir) {
+		return nil
+	}
+	if d := filepath.Clean(e.WorkDir); d == ".." || strings.HasPrefix(d, "../") {
+		return errorf(ErrInvalid, "work_dir %q of %s goes out of the script repo", e.WorkDir, e.Name)
+	}
+	return nil
+}
+
+// CommandDir returns the working directory of the deployment command of the environment, where "scriptDir" is the checkout
+// of the script repo or empty if the project has none. It returns "" for the working directory of goship.
+func (e Environment) CommandDir(scriptDir string) string {
+	if scriptDir == "" || filepath.IsAbs(e.WorkDir) {
+		return e.WorkDir
+	}
+	return filepath.Join(scriptDir, e.WorkDir)
+}
+
+// renderArgv renders each of "args" as a template with "p" into an argument.
+func renderArgv(args []string, p DeployParams) ([]string, error) {
+	argv := make([]string, 0, len(args))
+	for i, arg := range args {
+		t, err := parseArg(i, arg)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, p); err != nil {
+			return nil, err
+		}
+		argv = append(argv, buf.String())
+	}
+	return argv, nil
+}
+
+func parseArg(i int, arg string) (*template.Template, error) {
+	return template.New(fmt.Sprintf("arg%d", i)).Parse(arg)
+}
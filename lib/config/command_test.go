@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestDeployArgv(t *testing.T) {
+	params := config.DeployParams{
+		Revision:    "abc123; rm -rf /",
+		Environment: "production",
+		Branch:      "release/1.0",
+		Hosts:       config.HostList{"web1", "web2"},
+	}
+	for _, spec := range []struct {
+		env  config.Environment
+		want []string
+	}{
+		{
+			env: config.Environment{
+				DeployCommand: []string{"/usr/bin/deploy", "-e={{.Environment}}", "--rev", "{{.Revision}}", "--hosts={{.Hosts}}", "-b={{.Branch}}"},
+			},
+			// the revision stays in a single argument without being interpreted by a shell
+			want: []string{"/usr/bin/deploy", "-e=production", "--rev", "abc123; rm -rf /", "--hosts=web1,web2", "-b=release/1.0"},
+		},
+		{
+			env: config.Environment{
+				DeployCommand: []string{"deploy", "it's a \"quoted\" $HOME"},
+			},
+			want: []string{"deploy", "it's a \"quoted\" $HOME"},
+		},
+		{
+			// DeployCommand takes precedence
+			env: config.Environment{
+				Deploy:        "legacy -p=proj",
+				DeployCommand: []string{"deploy", "{{.Environment}}"},
+			},
+			want: []string{"deploy", "production"},
+		},
+		{
+			// legacy
+			env:  config.Environment{Deploy: "/tmp/deploy -p=my-project -e=staging"},
+			want: []string{"/tmp/deploy", "-p=my-project", "-e=staging"},
+		},
+		{
+			env:  config.Environment{Deploy: "cd /app && make deploy", Shell: true},
+			want: []string{"/bin/sh", "-c", "cd /app && make deploy"},
+		},
+	} {
+		got, err := spec.env.DeployArgv(params)
+		if err != nil {
+			t.Errorf("env.DeployArgv(%#v) failed with %v; want success; env=%#v", params, err, spec.env)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("env.DeployArgv(%#v) = %q; want %q; env=%#v", params, got, spec.want, spec.env)
+		}
+	}
+}
+
+func TestDeployArgvUnknownField(t *testing.T) {
+	for _, cmd := range [][]string{
+		{"deploy", "{{.Password}}"},
+		{"deploy", "{{.Revision"},
+	} {
+		env := config.Environment{DeployCommand: cmd}
+		if got, err := env.DeployArgv(config.DeployParams{}); err == nil {
+			t.Errorf("env.DeployArgv(...) = %q with %q; want failure", got, cmd)
+		}
+	}
+}
+
+func TestCommandDir(t *testing.T) {
+	for _, spec := range []struct {
+		workDir, scriptDir, want string
+	}{
+		{workDir: "", scriptDir: "", want: ""},
+		{workDir: "/srv/app", scriptDir: "", want: "/srv/app"},
+		{workDir: "", scriptDir: "/data/scripts/api.worktrees/1", want: "/data/scripts/api.worktrees/1"},
+		{workDir: "deploy/api", scriptDir: "/data/scripts/api.worktrees/1", want: "/data/scripts/api.worktrees/1/deploy/api"},
+		{workDir: "/srv/app", scriptDir: "/data/scripts/api.worktrees/1", want: "/srv/app"},
+	} {
+		env := config.Environment{WorkDir: spec.workDir}
+		if got := env.CommandDir(spec.scriptDir); got != spec.want {
+			t.Errorf("env.CommandDir(%q) = %q with work_dir %q; want %q", spec.scriptDir, got, spec.workDir, spec.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import "time"
+
+const (
+	// defaultCommitAgeWarningHours is CommitAgeConfiguration.WarningHours by default, i.e. 2 days.
+	defaultCommitAgeWarningHours = 48
+	// defaultCommitAgeDangerHours is CommitAgeConfiguration.DangerHours by default, i.e. 7 days.
+	defaultCommitAgeDangerHours = 168
+)
+
+// Levels of ages of undeployed commits
+const (
+	// CommitAgeWarning means that the commit has waited longer than the warning threshold.
+	CommitAgeWarning = "warning"
+	// CommitAgeDanger means that the commit has waited longer than the danger threshold.
+	CommitAgeDanger = "danger"
+)
+
+// CommitAgeConfiguration is how long commits can wait to be deployed before they are highlighted.
+type CommitAgeConfiguration struct {
+	// WarningHours is the age over which commits are shown in amber. It defaults to 48 hours.
+	WarningHours int `json:"warning_hours,omitempty" yaml:"warning_hours,omitempty"`
+	// DangerHours is the age over which commits are shown in red. It defaults to 168 hours.
+	DangerHours int `json:"danger_hours,omitempty" yaml:"danger_hours,omitempty"`
+	// Timezone is the IANA name of the timezone which dates of commits are shown in, e.g. "Asia/Tokyo". Dates are in UTC if empty.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+func (c *CommitAgeConfiguration) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.WarningHours < 0 || c.DangerHours < 0 {
+		return errorf(ErrInvalid, "commit_age: negative threshold")
+	}
+	if w, d := c.thresholds(); w > d {
+		return errorf(ErrInvalid, "commit_age: warning_hours %d is longer than danger_hours %d", c.WarningHours, c.DangerHours)
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return errorf(ErrInvalid, "commit_age: unknown timezone %q", c.Timezone)
+	}
+	return nil
+}
+
+// thresholds returns the warning and danger thresholds with the defaults.
+func (c *CommitAgeConfiguration) thresholds() (warning, danger time.Duration) {
+	w, d := defaultCommitAgeWarningHours, defaultCommitAgeDangerHours
+	if c != nil && c.WarningHours > 0 {
+		w = c.WarningHours
+	}
+	if c != nil && c.DangerHours > 0 {
+		d = c.DangerHours
+	}
+	return time.Duration(w) * time.Hour, time.Duration(d) * time.Hour
+}
+
+// Level returns the level of a commit which has waited for "age", i.e. CommitAgeWarning, CommitAgeDanger or empty if neither.
+// A commit exactly at a threshold is not over it. "c" can be nil for the defaults.
+func (c *CommitAgeConfiguration) Level(age time.Duration) string {
+	warning, danger := c.thresholds()
+	switch {
+	case age > danger:
+		return CommitAgeDanger
+	case age > warning:
+		return CommitAgeWarning
+	}
+	return ""
+}
+
+// Location returns the timezone which dates of commits are shown in. "c" can be nil for UTC.
+func (c *CommitAgeConfiguration) Location() *time.Location {
+	if c == nil || c.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
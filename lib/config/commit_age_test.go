@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestCommitAgeLevel(t *testing.T) {
+	custom := &config.CommitAgeConfiguration{WarningHours: 1, DangerHours: 3}
+	for _, spec := range []struct {
+		c    *config.CommitAgeConfiguration
+		age  time.Duration
+		want string
+	}{
+		{age: 0},
+		{age: 48 * time.Hour},
+		{age: 48*time.Hour + time.Second, want: config.CommitAgeWarning},
+		{age: 168 * time.Hour, want: config.CommitAgeWarning},
+		{age: 168*time.Hour + time.Second, want: config.CommitAgeDanger},
+		{c: custom, age: time.Hour},
+		{c: custom, age: 2 * time.Hour, want: config.CommitAgeWarning},
+		{c: custom, age: 4 * time.Hour, want: config.CommitAgeDanger},
+		// only the warning threshold is customized.
+		{c: &config.CommitAgeConfiguration{WarningHours: 100}, age: 99 * time.Hour},
+		{c: &config.CommitAgeConfiguration{WarningHours: 100}, age: 169 * time.Hour, want: config.CommitAgeDanger},
+	} {
+		if got := spec.c.Level(spec.age); got != spec.want {
+			t.Errorf("%#v.Level(%s) = %q; want %q", spec.c, spec.age, got, spec.want)
+		}
+	}
+	if got := (&config.CommitAgeConfiguration{Timezone: "Asia/Tokyo"}).Location().String(); got != "Asia/Tokyo" {
+		t.Errorf("Location() = %q; want %q", got, "Asia/Tokyo")
+	}
+}
+
+func TestCommitAgeValidate(t *testing.T) {
+	for _, spec := range []struct {
+		c   *config.CommitAgeConfiguration
+		msg string
+	}{
+		{},
+		{c: &config.CommitAgeConfiguration{WarningHours: 24, DangerHours: 24, Timezone: "Asia/Tokyo"}},
+		{c: &config.CommitAgeConfiguration{WarningHours: -1}, msg: "negative threshold"},
+		{c: &config.CommitAgeConfiguration{WarningHours: 24, DangerHours: 12}, msg: "longer than danger_hours"},
+		// longer than the default danger threshold.
+		{c: &config.CommitAgeConfiguration{WarningHours: 200}, msg: "longer than danger_hours"},
+		{c: &config.CommitAgeConfiguration{Timezone: "Mars/Olympus"}, msg: "unknown timezone"},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name:         "api",
+			CommitAge:    spec.c,
+			Environments: []config.Environment{{Name: "production", Deploy: "/bin/true"}},
+		}}}, spec.msg)
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConfirmChallenge is the name of the challenge which deployments into environments with ConfirmPhrase must answer.
+const ConfirmChallenge = "confirm_phrase"
+
+// ConfirmationError means that a deployment into an environment with ConfirmPhrase was requested without the phrase.
+// It names the environment but never the phrase.
+type ConfirmationError struct {
+	EnvironmentRef
+}
+
+func (e ConfirmationError) Error() string {
+	return fmt.Sprintf("confirm: deployments into %s require its %s", e.EnvironmentRef, ConfirmChallenge)
+}
+
+// ValidateConfirmation returns a ConfirmationError of "proj" if "phrase" does not match ConfirmPhrase of the environment.
+// Surrounding spaces of "phrase" are ignored.
+func (e Environment) ValidateConfirmation(proj, phrase string) error {
+	if e.ConfirmPhrase == "" || strings.TrimSpace(phrase) == e.ConfirmPhrase {
+		return nil
+	}
+	return ConfirmationError{EnvironmentRef: EnvironmentRef{Project: proj, Environment: e.Name}}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvironmentRef refers to an environment of a project.
+type EnvironmentRef struct {
+	Project, Environment string
+}
+
+// ParseEnvironmentRef parses a reference in the form of "project/env".
+func ParseEnvironmentRef(ref string) (EnvironmentRef, error) {
+	kv := strings.SplitN(ref, "/", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return EnvironmentRef{}, errorf(ErrInvalid, "invalid environment reference %q; want project/env", ref)
+	}
+	return EnvironmentRef{Project: kv[0], Environment: kv[1]}, nil
+}
+
+func (r EnvironmentRef) String() string {
+	return fmt.Sprintf("%s/%s", r.Project, r.Environment)
+}
+
+// DeployChain returns the environments which must be deployed before "proj"/"env" in the order of deployment,
+// followed by "proj"/"env" itself.
+func DeployChain(projects []Project, proj, env string) ([]EnvironmentRef, error) {
+	var (
+		chain []EnvironmentRef
+		// state is 1 while visiting dependencies of an environment, and 2 after that.
+		state = make(map[EnvironmentRef]int)
+	)
+	var visit func(ref EnvironmentRef, path []string) error
+	visit = func(ref EnvironmentRef, path []string) error {
+		path = append(path, ref.String())
+		switch state[ref] {
+		case 1:
+			return errorf(ErrInvalid, "dependency cycle: %s", strings.Join(path, " -> "))
+		case 2:
+			return nil
+		}
+		state[ref] = 1
+		_, e, err := EnvironmentFromName(projects, ref.Project, ref.Environment)
+		if err != nil {
+			return errorf(ErrInvalid, "unknown environment %s in dependencies of %s", ref, strings.Join(path[:len(path)-1], " -> "))
+		}
+		for _, dep := range e.DependsOn {
+			depRef, err := ParseEnvironmentRef(dep)
+			if err != nil {
+				return err
+			}
+			if err := visit(depRef, path); err != nil {
+				return err
+			}
+		}
+		state[ref] = 2
+		chain = append(chain, ref)
+		return nil
+	}
+	if err := visit(EnvironmentRef{Project: proj, Environment: env}, nil); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// validateDependencies returns an error if DependsOn of an environment refers to an unknown environment
+// or the dependencies form a cycle.
+func validateDependencies(projects []Project) error {
+	for _, p := range projects {
+		for _, e := range p.Environments {
+			if _, err := DeployChain(projects, p.Name, e.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
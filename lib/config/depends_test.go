@@ -0,0 +1,98 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func projectsWithDeps(deps map[string][]string) []config.Project {
+	var projs []config.Project
+	for ref, ds := range deps {
+		r, err := config.ParseEnvironmentRef(ref)
+		if err != nil {
+			panic(err)
+		}
+		p, err := config.ProjectFromName(projs, r.Project)
+		if err != nil {
+			projs = append(projs, config.Project{Name: r.Project})
+			p = projs[len(projs)-1]
+		}
+		for i := range projs {
+			if projs[i].Name == p.Name {
+				projs[i].Environments = append(projs[i].Environments, config.Environment{Name: r.Environment, DependsOn: ds})
+			}
+		}
+	}
+	return projs
+}
+
+func TestDeployChain(t *testing.T) {
+	projs := projectsWithDeps(map[string][]string{
+		"web/production":    {"api/production", "worker/production"},
+		"worker/production": {"api/production"},
+		"api/production":    {"db/production"},
+		"db/production":     nil,
+		"api/staging":       nil,
+	})
+	for _, spec := range []struct {
+		proj, env string
+		want      []string
+	}{
+		{proj: "api", env: "staging", want: []string{"api/staging"}},
+		{proj: "api", env: "production", want: []string{"db/production", "api/production"}},
+		{
+			// diamond dependencies are deployed only once
+			proj: "web", env: "production",
+			want: []string{"db/production", "api/production", "worker/production", "web/production"},
+		},
+	} {
+		chain, err := config.DeployChain(projs, spec.proj, spec.env)
+		if err != nil {
+			t.Errorf("config.DeployChain(projs, %q, %q) failed with %v; want success", spec.proj, spec.env, err)
+			continue
+		}
+		var got []string
+		for _, ref := range chain {
+			got = append(got, ref.String())
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.DeployChain(projs, %q, %q) = %q; want %q", spec.proj, spec.env, got, spec.want)
+		}
+	}
+}
+
+func TestDeployChainErrors(t *testing.T) {
+	for _, spec := range []struct {
+		deps map[string][]string
+		want string
+	}{
+		{
+			deps: map[string][]string{"api/production": {"api/production"}},
+			want: "cycle",
+		},
+		{
+			deps: map[string][]string{
+				"api/production":    {"worker/production"},
+				"worker/production": {"web/production"},
+				"web/production":    {"api/production"},
+			},
+			want: "cycle",
+		},
+		{
+			deps: map[string][]string{"api/production": {"db/production"}},
+			want: "unknown environment db/production",
+		},
+		{
+			deps: map[string][]string{"api/production": {"db"}},
+			want: "invalid environment reference",
+		},
+	} {
+		projs := projectsWithDeps(spec.deps)
+		if _, err := config.DeployChain(projs, "api", "production"); err == nil || !strings.Contains(err.Error(), spec.want) {
+			t.Errorf("config.DeployChain(projs, %q, %q) failed with %v; want an error containing %q; deps=%v", "api", "production", err, spec.want, spec.deps)
+		}
+	}
+}
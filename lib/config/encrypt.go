@@ -0,0 +1,352 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+)
+
+const (
+	// encryptedPrefix is the prefix of encrypted values of secret fields, followed by the version of the format,
+	// the ID of the master key and the base64-encoded nonce and ciphertext, i.e. "enc:v1:<key ID>:<data>".
+	// Values without the prefix are plaintext written before encryption was enabled.
+	encryptedPrefix = "enc:"
+	// encryptedVersion is the current version of the format of encrypted values.
+	encryptedVersion = "v1"
+
+	// minMasterKeyLen is the minimum length of master keys in bytes.
+	minMasterKeyLen = 16
+)
+
+// Environment variables which master keys are read from by LoadKeyring.
+const (
+	// MasterKeyEnvVar has the master key which secrets are encrypted with.
+	MasterKeyEnvVar = "GOSHIP_MASTER_KEY"
+	// MasterKeyFileEnvVar has the path to the file of the master key, which is used if MasterKeyEnvVar is not set.
+	MasterKeyFileEnvVar = "GOSHIP_MASTER_KEY_FILE"
+	// PreviousMasterKeyEnvVar has the master key before a rotation, which secrets are still decrypted with until rekeyed.
+	PreviousMasterKeyEnvVar = "GOSHIP_PREVIOUS_MASTER_KEY"
+	// PreviousMasterKeyFileEnvVar has the path to the file of the previous master key.
+	PreviousMasterKeyFileEnvVar = "GOSHIP_PREVIOUS_MASTER_KEY_FILE"
+)
+
+// Keyring encrypts and decrypts the values of the fields tagged with `goship:"secret"`.
+// Values are encrypted with AES-GCM under a data key derived from the primary master key, and decrypted with
+// the data key of the master key whose ID is in the value, so that values encrypted before a rotation are still readable.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a Keyring which encrypts with "primary" and decrypts with it or any of "previous".
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for i, master := range append([][]byte{primary}, previous...) {
+		if len(master) < minMasterKeyLen {
+			return nil, errorf(ErrInvalid, "master key must be at least %d bytes", minMasterKeyLen)
+		}
+		id, aead, err := deriveDataKey(master)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			k.primary = id
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// deriveDataKey returns the ID of "master" and the cipher of the data key derived from it.
+func deriveDataKey(master []byte) (string, cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, master)
+	io.WriteString(mac, "goship config data key "+encryptedVersion)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", nil, err
+	}
+	mac = hmac.New(sha256.New, master)
+	io.WriteString(mac, "goship config key id")
+	return hex.EncodeToString(mac.Sum(nil)[:4]), aead, nil
+}
+
+// LoadKeyring returns the Keyring of the master keys in the environment variables, or nil if no master key is set.
+// Each key is read from its variable, or from the file which the variable with the "_FILE" suffix points to.
+func LoadKeyring() (*Keyring, error) {
+	primary, err := readMasterKey(MasterKeyEnvVar, MasterKeyFileEnvVar)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := readMasterKey(PreviousMasterKeyEnvVar, PreviousMasterKeyFileEnvVar)
+	if err != nil {
+		return nil, err
+	}
+	if primary == nil {
+		if previous != nil {
+			return nil, errorf(ErrInvalid, "%s is set without %s", PreviousMasterKeyEnvVar, MasterKeyEnvVar)
+		}
+		return nil, nil
+	}
+	if previous == nil {
+		return NewKeyring(primary)
+	}
+	return NewKeyring(primary, previous)
+}
+
+func readMasterKey(name, fileName string) ([]byte, error) {
+	if v := os.Getenv(name); v != "" {
+		return []byte(v), nil
+	}
+	file := os.Getenv(fileName)
+	if file == "" {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(buf))), nil
+}
+
+// keyring encrypts secrets written by Store and decrypts them on Load if not nil.
+var keyring *Keyring
+
+// SetKeyring makes Store encrypt secrets with "k" and Load decrypt them. Secrets are stored in plaintext if "k" is nil.
+// It must be called before the config is loaded or stored.
+func SetKeyring(k *Keyring) {
+	keyring = k
+}
+
+// encrypt returns "s" encrypted with the primary key.
+func (k *Keyring) encrypt(s string) (string, error) {
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nonce, nonce, []byte(s), []byte(encryptedVersion))
+	return strings.Join([]string{"enc", encryptedVersion, k.primary, base64.StdEncoding.EncodeToString(data)}, ":"), nil
+}
+
+// decrypt returns the plaintext of "s", or "s" itself if it is not encrypted. "k" can be nil if "s" is not encrypted.
+func (k *Keyring) decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return s, nil
+	}
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) != 4 || parts[1] != encryptedVersion {
+		return "", errorf(ErrInvalid, "unknown format of encrypted secret %q", strings.Join(parts[:len(parts)-1], ":"))
+	}
+	if k == nil {
+		return "", errorf(ErrInvalid, "secret is encrypted with key %s but no master key is set in %s", parts[2], MasterKeyEnvVar)
+	}
+	aead, ok := k.keys[parts[2]]
+	if !ok {
+		return "", errorf(ErrInvalid, "secret is encrypted with unknown key %s", parts[2])
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errorf(ErrInvalid, "malformed encrypted secret with key %s", parts[2])
+	}
+	buf, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(encryptedVersion))
+	if err != nil {
+		return "", errorf(ErrInvalid, "cannot decrypt secret with key %s: %v", parts[2], err)
+	}
+	return string(buf), nil
+}
+
+// marshalSecrets marshals "v" into JSON with its secrets encrypted with "k" if not nil.
+func marshalSecrets(v interface{}, k *Keyring) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil || k == nil {
+		return buf, err
+	}
+	// encrypts a copy since "v" shares maps and slices with the caller.
+	cp := reflect.New(reflect.TypeOf(v))
+	if err := json.Unmarshal(buf, cp.Interface()); err != nil {
+		return nil, err
+	}
+	if err := walkSecrets(cp.Elem(), false, k.encrypt); err != nil {
+		return nil, err
+	}
+	return json.Marshal(cp.Interface())
+}
+
+// unmarshalSecrets unmarshals JSON in "buf" into "v" and decrypts its secrets with "k".
+// Plaintext secrets are kept as they are.
+func unmarshalSecrets(buf []byte, v interface{}, k *Keyring) error {
+	if err := json.Unmarshal(buf, v); err != nil {
+		return err
+	}
+	return walkSecrets(reflect.ValueOf(v), false, k.decrypt)
+}
+
+// walkSecrets replaces non-empty strings in the secret fields under "v" with the results of "f".
+// "secret" means "v" is under a secret field. "v" must be settable unless it is a pointer.
+func walkSecrets(v reflect.Value, secret bool, f func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return walkSecrets(v.Elem(), secret, f)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if err := walkSecrets(v.Field(i), secret || field.Tag.Get("goship") == secretTag, f); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkSecrets(v.Index(i), secret, f); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// map values are not settable.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := walkSecrets(elem, secret, f); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		if !secret || v.Len() == 0 {
+			return nil
+		}
+		s, err := f(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	}
+	return nil
+}
+
+// Rekey re-encrypts all the secrets in the config with the primary key of "k", e.g. after a rotation of the master key.
+// Secrets are decrypted with any key of "k", and plaintext ones are encrypted too. It returns the number of rewritten keys.
+func Rekey(client ETCDInterface, k *Keyring) (int, error) {
+	if k == nil {
+		return 0, errorf(ErrInvalid, "no master key is set in %s", MasterKeyEnvVar)
+	}
+	n := 0
+	rekey := func(key string, v interface{}) error {
+		resp, err := client.Get(key, false, false)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalSecrets([]byte(resp.Node.Value), v, k); err != nil {
+			return errorf(ErrInvalid, "%s: %v", key, err)
+		}
+		buf, err := marshalSecrets(reflect.ValueOf(v).Elem().Interface(), k)
+		if err != nil {
+			return err
+		}
+		if _, err := client.Set(key, string(buf), 0); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+	if err := rekey("/goship/config", new(Config)); err != nil {
+		return n, err
+	}
+	var projs etcd.Nodes
+	resp, err := client.Get("/goship/projects", false, true)
+	switch {
+	case err == nil:
+		projs = resp.Node.Nodes
+	case !etcderr.IsKeyNotFound(err):
+		return n, err
+	}
+	for _, node := range projs {
+		for _, child := range node.Nodes {
+			switch path.Base(child.Key) {
+			case "config":
+				err = rekey(child.Key, new(Project))
+			case "environments":
+				for _, env := range child.Nodes {
+					if err = rekey(env.Key, new(Environment)); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	glog.Infof("Re-encrypted secrets in %d keys with master key %s", n, k.primary)
+	return n, nil
+}
+
+// CheckSecrets returns an error unless the secrets in "value" of the config key "key" can be decrypted with the keyring set by SetKeyring.
+// It also returns true if any of them is not encrypted with the primary key, which Rekey fixes.
+// Keys other than the ones of the config are ignored.
+func CheckSecrets(key, value string) (stale bool, err error) {
+	v := configValueOf(key)
+	if v == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return false, err
+	}
+	err = walkSecrets(reflect.ValueOf(v), false, func(s string) (string, error) {
+		if !keyring.isCurrent(s) {
+			stale = true
+		}
+		return keyring.decrypt(s)
+	})
+	return stale, err
+}
+
+// configValueOf returns a pointer to the type of the config stored at "key", or nil if "key" is not a config.
+func configValueOf(key string) interface{} {
+	if key == "/goship/config" {
+		return new(Config)
+	}
+	if !strings.HasPrefix(key, "/goship/projects/") {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(key, "/goship/projects/"), "/")
+	switch {
+	case len(parts) == 2 && parts[1] == "config":
+		return new(Project)
+	case len(parts) == 3 && parts[1] == "environments":
+		return new(Environment)
+	}
+	return nil
+}
+
+// isCurrent returns true iff "s" is encrypted with the primary key, or "k" is nil.
+func (k *Keyring) isCurrent(s string) bool {
+	if k == nil {
+		return true
+	}
+	return strings.HasPrefix(s, strings.Join([]string{"enc", encryptedVersion, k.primary, ""}, ":"))
+}
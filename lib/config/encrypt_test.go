@@ -0,0 +1,252 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+var (
+	oldMasterKey = []byte("old-master-key-0123456789")
+	newMasterKey = []byte("new-master-key-9876543210")
+)
+
+// secretTestConfig returns a config which has secrets at every level.
+func secretTestConfig() config.Config {
+	return config.Config{
+		DeployUser:          "deployer",
+		Pivotal:             &config.PivotalConfiguration{Token: "pivotal-token"},
+		GitHubWebhookSecret: "webhook-secret",
+		Projects: []config.Project{{
+			Name:          "api",
+			Repo:          config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			TravisToken:   "travis-token",
+			PluginColumns: []config.PluginColumn{{Type: "travis", Params: map[string]string{"token": "column-token"}}},
+			Environments: []config.Environment{{
+				Name:                  "production",
+				Branch:                "master",
+				Deploy:                "/bin/true",
+				NotificationOverrides: map[string]config.NotificationOverride{"slack": {WebhookURL: "https://hooks.slack.example/T0/B0"}},
+			}},
+		}},
+	}
+}
+
+// secretsOf returns the secret values in "c".
+func secretsOf(c config.Config) []string {
+	var secrets []string
+	if c.Pivotal != nil {
+		secrets = append(secrets, c.Pivotal.Token)
+	}
+	secrets = append(secrets, c.GitHubWebhookSecret)
+	for _, p := range c.Projects {
+		secrets = append(secrets, p.TravisToken)
+		for _, col := range p.PluginColumns {
+			secrets = append(secrets, col.Params["token"])
+		}
+		for _, e := range p.Environments {
+			secrets = append(secrets, e.NotificationOverrides["slack"].WebhookURL)
+		}
+	}
+	return secrets
+}
+
+// checkEncrypted fails unless all the secrets in "s" are encrypted.
+func checkEncrypted(t *testing.T, s memStore, c config.Config) {
+	for key, v := range s.values {
+		for _, secret := range secretsOf(c) {
+			if strings.Contains(v, secret) {
+				t.Errorf("%s = %s; want %q encrypted", key, v, secret)
+			}
+		}
+	}
+	for _, key := range []string{"/goship/config", "/goship/projects/api/config", "/goship/projects/api/environments/production"} {
+		if !strings.Contains(s.values[key], `"enc:v1:`) {
+			t.Errorf("%s = %s; want encrypted secrets", key, s.values[key])
+		}
+	}
+}
+
+func TestEncryptedSecretsRoundTrip(t *testing.T) {
+	defer config.SetKeyring(nil)
+	k, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(k)
+
+	s := memStore{values: make(map[string]string)}
+	cfg := secretTestConfig()
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	if want := secretTestConfig(); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config.Store(s, cfg) modified cfg into %#v; want %#v", cfg, want)
+	}
+	checkEncrypted(t, s, cfg)
+
+	got, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if got, want := secretsOf(got), secretsOf(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("secrets = %q; want %q", got, want)
+	}
+
+	// encrypted secrets cannot be read without the key.
+	config.SetKeyring(nil)
+	if _, err := config.Load(s); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.Load(s) without the key failed with %v; want %v", err, config.ErrInvalid)
+	}
+	other, err := config.NewKeyring(newMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(other)
+	if _, err := config.Load(s); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.Load(s) with another key failed with %v; want %v", err, config.ErrInvalid)
+	}
+}
+
+func TestEncryptedSecretsLegacy(t *testing.T) {
+	defer config.SetKeyring(nil)
+	s := memStore{values: make(map[string]string)}
+	cfg := secretTestConfig()
+	// stored before the encryption is enabled
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	if !strings.Contains(s.values["/goship/projects/api/config"], "travis-token") {
+		t.Errorf("project config = %s; want plaintext without a key", s.values["/goship/projects/api/config"])
+	}
+
+	k, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(k)
+	got, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if got, want := secretsOf(got), secretsOf(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("secrets = %q; want %q", got, want)
+	}
+
+	// rekey encrypts legacy values too.
+	if n, err := config.Rekey(s, k); err != nil || n != 3 {
+		t.Fatalf("config.Rekey(s, k) = %d, %v; want 3 keys", n, err)
+	}
+	checkEncrypted(t, s, cfg)
+}
+
+func TestRekey(t *testing.T) {
+	defer config.SetKeyring(nil)
+	old, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(old)
+	s := memStore{values: make(map[string]string)}
+	cfg := secretTestConfig()
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+
+	rotated, err := config.NewKeyring(newMasterKey, oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(new, old) failed with %v", err)
+	}
+	if _, err := config.Rekey(s, rotated); err != nil {
+		t.Fatalf("config.Rekey(s, rotated) failed with %v", err)
+	}
+	checkEncrypted(t, s, cfg)
+
+	// the old key is no longer needed.
+	k, err := config.NewKeyring(newMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(k)
+	got, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) with the new key failed with %v", err)
+	}
+	if got, want := secretsOf(got), secretsOf(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("secrets = %q; want %q", got, want)
+	}
+	config.SetKeyring(old)
+	if _, err := config.Load(s); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.Load(s) with the old key failed with %v; want %v", err, config.ErrInvalid)
+	}
+
+	if _, err := config.NewKeyring([]byte("short")); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.NewKeyring(short) failed with %v; want %v", err, config.ErrInvalid)
+	}
+}
+
+func TestRekeyWithoutProjects(t *testing.T) {
+	k, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, config.Config{DeployUser: "deployer"}); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	if _, ok := s.values["/goship/config"]; !ok {
+		t.Fatalf("s.values = %q; want /goship/config", s.values)
+	}
+	if n, err := config.Rekey(s, k); err != nil || n != 1 {
+		t.Errorf("config.Rekey(s, k) = %d, %v; want 1 key", n, err)
+	}
+}
+
+func TestCheckSecrets(t *testing.T) {
+	defer config.SetKeyring(nil)
+	old, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(old)
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, secretTestConfig()); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	s.values["/goship/users/alice"] = `{"favorites": ["api"]}`
+
+	check := func(wantStale bool) {
+		for key, v := range s.values {
+			stale, err := config.CheckSecrets(key, v)
+			if err != nil {
+				t.Errorf("config.CheckSecrets(%q, ...) failed with %v", key, err)
+			}
+			if stale != wantStale && key != "/goship/users/alice" {
+				t.Errorf("config.CheckSecrets(%q, ...) = %v; want %v", key, stale, wantStale)
+			}
+		}
+	}
+	check(false)
+
+	rotated, err := config.NewKeyring(newMasterKey, oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(new, old) failed with %v", err)
+	}
+	config.SetKeyring(rotated)
+	check(true)
+
+	k, err := config.NewKeyring(newMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(key) failed with %v", err)
+	}
+	config.SetKeyring(k)
+	if _, err := config.CheckSecrets("/goship/config", s.values["/goship/config"]); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.CheckSecrets(...) failed with %v without the old key; want %v", err, config.ErrInvalid)
+	}
+	config.SetKeyring(nil)
+	if _, err := config.CheckSecrets("/goship/config", s.values["/goship/config"]); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.CheckSecrets(...) failed with %v without keys; want %v", err, config.ErrInvalid)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// defaultEphemeralTTL is how long ephemeral environments live after the last push unless configured.
+const defaultEphemeralTTL = 72 * time.Hour
+
+// EphemeralRule maps branches to transient environments, e.g. review apps of "review/*" branches.
+// Environments are created when a matching branch is pushed, and removed when the branch is deleted or after TTL.
+type EphemeralRule struct {
+	// Branch is a glob of branch names in the syntax of path.Match, e.g. "review/*".
+	Branch string `json:"branch" yaml:"branch"`
+	// Template is the name of the environment of the project which ephemeral environments are cloned from.
+	Template string `json:"template" yaml:"template"`
+	// TTLHours is how many hours ephemeral environments live after the last push. It defaults to 72 hours.
+	TTLHours int `json:"ttl_hours,omitempty" yaml:"ttl_hours,omitempty"`
+}
+
+// TTL returns how long environments created by "r" live after the last push.
+func (r EphemeralRule) TTL() time.Duration {
+	if r.TTLHours <= 0 {
+		return defaultEphemeralTTL
+	}
+	return time.Duration(r.TTLHours) * time.Hour
+}
+
+// Ephemeral marks an environment which was created for a branch by an EphemeralRule.
+type Ephemeral struct {
+	Branch    string    `json:"branch" yaml:"branch"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// validateEphemeralRules returns an error if any of EphemeralEnvironments of "p" is malformed.
+func (p Project) validateEphemeralRules() error {
+	for i, r := range p.EphemeralEnvironments {
+		if _, err := path.Match(r.Branch, ""); err != nil || r.Branch == "" {
+			return errorf(ErrInvalid, "invalid branch %q of ephemeral_environments[%d] of %s", r.Branch, i, p.Name)
+		}
+		if r.Template == "" {
+			return errorf(ErrInvalid, "template of ephemeral_environments[%d] of %s not configured", i, p.Name)
+		}
+	}
+	return nil
+}
+
+// EphemeralRuleFor returns the first rule of "p" which matches "branch".
+func (p Project) EphemeralRuleFor(branch string) (EphemeralRule, bool) {
+	for _, r := range p.EphemeralEnvironments {
+		if ok, _ := path.Match(r.Branch, branch); ok {
+			return r, true
+		}
+	}
+	return EphemeralRule{}, false
+}
+
+// EphemeralEnvironmentName returns the name of the ephemeral environment of "branch", e.g. "review_login" for "review/login".
+// Characters which cannot be used in environment names are replaced with "_". "-" is replaced too since it separates
+// projects from environments in the paths of deploy logs.
+func EphemeralEnvironmentName(branch string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.':
+			return r
+		}
+		return '_'
+	}, branch)
+	return strings.TrimLeft(name, "_.")
+}
+
+// PushEphemeral creates the ephemeral environment of "branch" in the project "proj" in "c" by cloning the template of "rule",
+// or extends the lifetime of the existing one. It returns the environment and whether it has been created.
+func PushEphemeral(client ETCDInterface, c Config, proj string, rule EphemeralRule, branch string, now time.Time) (Environment, bool, error) {
+	p, err := ProjectFromName(c.Projects, proj)
+	if err != nil {
+		return Environment{}, false, err
+	}
+	name := EphemeralEnvironmentName(branch)
+	if !validEnvironmentName.MatchString(name) {
+		return Environment{}, false, errorf(ErrInvalid, "no valid environment name for branch %q", branch)
+	}
+	dir := fmt.Sprintf("/goship/projects/%s/environments", proj)
+	for _, e := range p.Environments {
+		if e.Name != name {
+			continue
+		}
+		if e.Ephemeral == nil || e.Ephemeral.Branch != branch {
+			return Environment{}, false, errorf(ErrAlreadyExists, "environment %s already exists in %s", name, proj)
+		}
+		e.Ephemeral = &Ephemeral{Branch: branch, ExpiresAt: now.Add(rule.TTL())}
+		return e, false, storeEnvironment(client, e, dir)
+	}
+	_, tmpl, err := EnvironmentFromName(c.Projects, proj, rule.Template)
+	if err != nil {
+		return Environment{}, false, errorf(Cause(err), "template of ephemeral environments of %s: %v", proj, err)
+	}
+	env := CloneEnvironment(*tmpl, name, tmpl.Hosts)
+	env.Branch = branch
+	env.Ephemeral = &Ephemeral{Branch: branch, ExpiresAt: now.Add(rule.TTL())}
+	if err := storeEnvironment(client, env, dir); err != nil {
+		return Environment{}, false, err
+	}
+	return env, true, nil
+}
+
+// RemoveEphemeral removes the ephemeral environment of "branch" from the project "proj" in "c".
+// It returns the name of the removed environment, or "" if the branch has none.
+func RemoveEphemeral(client RenameStore, c Config, proj, branch string) (string, error) {
+	p, err := ProjectFromName(c.Projects, proj)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range p.Environments {
+		if e.Ephemeral == nil || e.Ephemeral.Branch != branch {
+			continue
+		}
+		if _, err := client.Delete(fmt.Sprintf("/goship/projects/%s/environments/%s", proj, e.Name), false); err != nil {
+			glog.Errorf("Failed to remove ephemeral environment %s of %s: %v", e.Name, proj, err)
+			return "", err
+		}
+		return e.Name, nil
+	}
+	return "", nil
+}
+
+// RemoveExpiredEphemeral removes the ephemeral environments in "c" which have expired by "now".
+// It returns the removed environments.
+func RemoveExpiredEphemeral(client RenameStore, c Config, now time.Time) ([]EnvironmentRef, error) {
+	var removed []EnvironmentRef
+	for _, p := range c.Projects {
+		for _, e := range p.Environments {
+			if e.Ephemeral == nil || now.Before(e.Ephemeral.ExpiresAt) {
+				continue
+			}
+			if _, err := client.Delete(fmt.Sprintf("/goship/projects/%s/environments/%s", p.Name, e.Name), false); err != nil {
+				glog.Errorf("Failed to remove expired environment %s of %s: %v", e.Name, p.Name, err)
+				return removed, err
+			}
+			removed = append(removed, EnvironmentRef{Project: p.Name, Environment: e.Name})
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,159 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func ephemeralTestStore(t *testing.T) memStore {
+	s := memStore{values: make(map[string]string)}
+	cfg := config.Config{
+		Projects: []config.Project{
+			{
+				Name:                  "api",
+				EphemeralEnvironments: []config.EphemeralRule{{Branch: "review/*", Template: "staging", TTLHours: 24}},
+				Environments: []config.Environment{
+					{Name: "staging", Branch: "master", RepoPath: "/srv/api", Hosts: []config.Host{{Name: "review1.example.com"}}, Lock: &config.EnvironmentLock{By: "alice"}},
+				},
+			},
+		},
+	}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	return s
+}
+
+func TestEphemeralRuleFor(t *testing.T) {
+	p := config.Project{EphemeralEnvironments: []config.EphemeralRule{{Branch: "review/*", Template: "staging"}}}
+	for _, spec := range []struct {
+		branch string
+		ok     bool
+	}{
+		{branch: "review/login", ok: true},
+		{branch: "review/login/v2"},
+		{branch: "master"},
+	} {
+		if _, ok := p.EphemeralRuleFor(spec.branch); ok != spec.ok {
+			t.Errorf("p.EphemeralRuleFor(%q) = _, %v; want %v", spec.branch, ok, spec.ok)
+		}
+	}
+}
+
+func TestEphemeralEnvironmentName(t *testing.T) {
+	for _, spec := range []struct {
+		branch, want string
+	}{
+		{branch: "review/login", want: "review_login"},
+		{branch: "review/fix-typo.v2", want: "review_fix_typo.v2"},
+		{branch: "_wip", want: "wip"},
+	} {
+		if got := config.EphemeralEnvironmentName(spec.branch); got != spec.want {
+			t.Errorf("config.EphemeralEnvironmentName(%q) = %q; want %q", spec.branch, got, spec.want)
+		}
+	}
+}
+
+func TestEphemeralLifecycle(t *testing.T) {
+	s := ephemeralTestStore(t)
+	load := func() config.Config {
+		c, err := config.Load(s)
+		if err != nil {
+			t.Fatalf("config.Load(s) failed with %v", err)
+		}
+		return c
+	}
+	c := load()
+	rule, _ := c.Projects[0].EphemeralRuleFor("review/login")
+
+	// created on the first push
+	env, created, err := config.PushEphemeral(s, c, "api", rule, "review/login", now)
+	if err != nil {
+		t.Fatalf("config.PushEphemeral(s, c, %q, rule, %q, now) failed with %v", "api", "review/login", err)
+	}
+	if !created {
+		t.Errorf("config.PushEphemeral(...) did not create an environment on the first push")
+	}
+	_, got, err := config.EnvironmentFromName(load().Projects, "api", "review_login")
+	if err != nil {
+		t.Fatalf("config.EnvironmentFromName(projects, %q, %q) failed with %v", "api", "review_login", err)
+	}
+	want := config.Environment{
+		Name:      "review_login",
+		RepoPath:  "/srv/api",
+		Hosts:     []config.Host{{Name: "review1.example.com"}},
+		Branch:    "review/login",
+		Ephemeral: &config.Ephemeral{Branch: "review/login", ExpiresAt: now.Add(24 * time.Hour)},
+	}
+	if !reflect.DeepEqual(*got, want) || !reflect.DeepEqual(env, want) {
+		t.Errorf("ephemeral environment = %#v; want %#v", *got, want)
+	}
+
+	// extended on later pushes
+	later := now.Add(12 * time.Hour)
+	if _, created, err = config.PushEphemeral(s, load(), "api", rule, "review/login", later); err != nil || created {
+		t.Errorf("config.PushEphemeral(...) = _, %v, %v on the second push; want false, nil", created, err)
+	}
+	if _, got, _ = config.EnvironmentFromName(load().Projects, "api", "review_login"); !got.Ephemeral.ExpiresAt.Equal(later.Add(24 * time.Hour)) {
+		t.Errorf("expiry = %v after the second push; want %v", got.Ephemeral.ExpiresAt, later.Add(24*time.Hour))
+	}
+
+	// not expired yet
+	removed, err := config.RemoveExpiredEphemeral(s, load(), now.Add(24*time.Hour))
+	if err != nil || len(removed) != 0 {
+		t.Errorf("config.RemoveExpiredEphemeral(s, c, now+24h) = %v, %v; want nothing removed", removed, err)
+	}
+
+	// removed on branch deletion
+	name, err := config.RemoveEphemeral(s, load(), "api", "review/login")
+	if err != nil || name != "review_login" {
+		t.Errorf("config.RemoveEphemeral(s, c, %q, %q) = %q, %v; want %q, nil", "api", "review/login", name, err, "review_login")
+	}
+	if _, _, err := config.EnvironmentFromName(load().Projects, "api", "review_login"); err == nil {
+		t.Errorf("review_login still exists after the branch is deleted")
+	}
+	if name, err = config.RemoveEphemeral(s, load(), "api", "review/login"); err != nil || name != "" {
+		t.Errorf("config.RemoveEphemeral(...) = %q, %v for a deleted branch; want \"\", nil", name, err)
+	}
+	if _, _, err := config.EnvironmentFromName(load().Projects, "api", "staging"); err != nil {
+		t.Errorf("the template was removed: %v", err)
+	}
+}
+
+func TestRemoveExpiredEphemeral(t *testing.T) {
+	s := ephemeralTestStore(t)
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	rule, _ := c.Projects[0].EphemeralRuleFor("review/login")
+	if _, _, err := config.PushEphemeral(s, c, "api", rule, "review/login", now); err != nil {
+		t.Fatalf("config.PushEphemeral(...) failed with %v", err)
+	}
+	if c, err = config.Load(s); err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	removed, err := config.RemoveExpiredEphemeral(s, c, now.Add(25*time.Hour))
+	if err != nil {
+		t.Fatalf("config.RemoveExpiredEphemeral(s, c, now+25h) failed with %v", err)
+	}
+	if want := []config.EnvironmentRef{{Project: "api", Environment: "review_login"}}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("config.RemoveExpiredEphemeral(s, c, now+25h) = %v; want %v", removed, want)
+	}
+}
+
+func TestPushEphemeralConflict(t *testing.T) {
+	s := ephemeralTestStore(t)
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	// "staging" is a permanent environment, which must not be taken over.
+	rule := config.EphemeralRule{Branch: "*", Template: "staging"}
+	if _, _, err := config.PushEphemeral(s, c, "api", rule, "staging", now); err == nil {
+		t.Errorf("config.PushEphemeral(s, c, %q, rule, %q, now) succeeded; want failure", "api", "staging")
+	}
+}
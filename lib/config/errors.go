@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+)
+
+// Kinds of errors returned by this package. Errors are wrapped in *Error with details, so compare Cause(err) with them.
+var (
+	// ErrProjectNotFound means that no project has the given name.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrEnvironmentNotFound means that the project has no environment of the given name.
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	// ErrAlreadyExists means that a project or an environment of the given name already exists.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrInvalid means that the configuration or the parameters are malformed.
+	ErrInvalid = errors.New("invalid configuration")
+	// ErrGitHubUnavailable means that GitHub failed to serve a request, e.g. it is down or unreachable.
+	ErrGitHubUnavailable = errors.New("GitHub unavailable")
+	// ErrPivotalUnauthorized means that Pivotal cannot be accessed without a valid token.
+	ErrPivotalUnauthorized = errors.New("Pivotal unauthorized")
+	// ErrLocked means that the environment is locked against deployments until a user unlocks it.
+	ErrLocked = errors.New("environment locked")
+	// ErrUnconfigured means that the environment has no hosts to deploy into yet.
+	ErrUnconfigured = errors.New("environment unconfigured")
+	// ErrVersionNotFound means that the config history of the project has no version of the given number.
+	ErrVersionNotFound = errors.New("config version not found")
+)
+
+// Error is an error of one of the kinds above with the details.
+type Error struct {
+	// Kind is one of the errors above.
+	Kind error
+	// Msg describes the error.
+	Msg string
+	// Suggestions are the known names close to an unknown one of ErrProjectNotFound or ErrEnvironmentNotFound.
+	Suggestions []string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns the kind of "e" so that errors.Is works with newer versions of Go.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Cause returns the kind of "err" if it is an *Error, or "err" itself otherwise.
+func Cause(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return err
+}
+
+// StatusCode returns the HTTP status code which handlers should respond with on "err".
+func StatusCode(err error) int {
+	switch Cause(err) {
+	case ErrProjectNotFound, ErrEnvironmentNotFound, ErrVersionNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrLocked, ErrUnconfigured:
+		return http.StatusConflict
+	case ErrInvalid:
+		return http.StatusBadRequest
+	case ErrGitHubUnavailable:
+		return http.StatusBadGateway
+	case ErrPivotalUnauthorized:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// errorf returns a new *Error of "kind" with the message formatted like fmt.Errorf.
+func errorf(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// githubError wraps an error from GitHub in ErrGitHubUnavailable unless GitHub rejected the request itself,
+// e.g. with 404 for unknown commits.
+func githubError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*github.ErrorResponse); ok && e.Response != nil && e.Response.StatusCode < 500 {
+		return err
+	}
+	return errorf(ErrGitHubUnavailable, "GitHub unavailable: %v", err)
+}
@@ -0,0 +1,98 @@
+package config_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// failingGithub fails to compare commits with "err".
+type failingGithub struct {
+	githublib.Client
+	err error
+}
+
+func (c failingGithub) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	return nil, nil, c.err
+}
+
+func TestErrorKinds(t *testing.T) {
+	projs := []config.Project{{Name: "api", Environments: []config.Environment{{Name: "staging"}}}}
+	c := config.Config{Projects: projs}
+	s := memStore{values: make(map[string]string)}
+
+	_, errProj := config.ProjectFromName(projs, "web")
+	_, _, errEnv := config.EnvironmentFromName(projs, "api", "production")
+	_, _, errEnvProj := config.EnvironmentFromName(projs, "web", "production")
+	errExists := config.AddEnvironment(s, c, "api", config.Environment{Name: "staging"})
+	errName := config.AddEnvironment(s, c, "api", config.Environment{Name: "-staging"})
+	errLocked := config.Environment{Name: "production", AutoLock: &config.AutoLock{Reason: "auto-locked: deploy 1 failed", By: config.AutoLockOwner}}.AllowsDeploy(false)
+	_, _, errPivotal := config.PostToPivotal(&config.PivotalConfiguration{}, config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}, config.PivotalDeploySucceeded, "staging", "a", "b", "alice", "")
+	_, errVersion := config.GetConfigVersion(s, "api", 1)
+	for _, spec := range []struct {
+		desc string
+		err  error
+		kind error
+		code int
+	}{
+		{desc: "unknown project", err: errProj, kind: config.ErrProjectNotFound, code: http.StatusNotFound},
+		{desc: "unknown environment", err: errEnv, kind: config.ErrEnvironmentNotFound, code: http.StatusNotFound},
+		{desc: "environment of unknown project", err: errEnvProj, kind: config.ErrProjectNotFound, code: http.StatusNotFound},
+		{desc: "existing environment", err: errExists, kind: config.ErrAlreadyExists, code: http.StatusConflict},
+		{desc: "invalid name", err: errName, kind: config.ErrInvalid, code: http.StatusBadRequest},
+		{desc: "auto-locked environment", err: errLocked, kind: config.ErrLocked, code: http.StatusConflict},
+		{desc: "no pivotal token", err: errPivotal, kind: config.ErrPivotalUnauthorized, code: http.StatusUnauthorized},
+		{desc: "unknown config version", err: errVersion, kind: config.ErrVersionNotFound, code: http.StatusNotFound},
+	} {
+		if spec.err == nil {
+			t.Errorf("no error on %s; want %v", spec.desc, spec.kind)
+			continue
+		}
+		if got := config.Cause(spec.err); got != spec.kind {
+			t.Errorf("config.Cause(%v) = %v on %s; want %v", spec.err, got, spec.desc, spec.kind)
+		}
+		if _, ok := spec.err.(*config.Error); !ok {
+			t.Errorf("%v on %s is %T; want *config.Error", spec.err, spec.desc, spec.err)
+		}
+		if got := config.StatusCode(spec.err); got != spec.code {
+			t.Errorf("config.StatusCode(%v) = %d on %s; want %d", spec.err, got, spec.desc, spec.code)
+		}
+	}
+
+	// messages are kept for the existing callers.
+	if got, want := errProj.Error(), "No project found: web"; got != want {
+		t.Errorf("errProj.Error() = %q; want %q", got, want)
+	}
+}
+
+func TestStatusCodeOfOtherErrors(t *testing.T) {
+	err := errors.New("etcd unavailable")
+	if got := config.Cause(err); got != err {
+		t.Errorf("config.Cause(%v) = %v; want the error itself", err, got)
+	}
+	if got, want := config.StatusCode(err), http.StatusInternalServerError; got != want {
+		t.Errorf("config.StatusCode(%v) = %d; want %d", err, got, want)
+	}
+}
+
+func TestPivotalStoryIDsGitHubErrors(t *testing.T) {
+	notFound := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}, Message: "No commit found"}
+	down := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}, Message: "Server Error"}
+	for _, spec := range []struct {
+		err  error
+		code int
+	}{
+		{err: notFound, code: http.StatusInternalServerError},
+		{err: down, code: http.StatusBadGateway},
+		{err: errors.New("connection refused"), code: http.StatusBadGateway},
+	} {
+		_, err := config.PivotalStoryIDs(failingGithub{err: spec.err}, nil, "gengo", "api", "a", "b", now)
+		if got := config.StatusCode(err); got != spec.code {
+			t.Errorf("config.StatusCode(%v) = %d when GitHub fails with %v; want %d", err, got, spec.err, spec.code)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"sync"
+)
+
+// Fallback keeps the last valid definitions of the global settings and of each project loaded by Load,
+// so that a malformed change to one of them in etcd neither breaks the others nor takes effect.
+// Load uses the last valid definition in place of an invalid one, with the problems in ConfigErrors.
+type Fallback struct {
+	mu       sync.Mutex
+	global   *Config
+	projects map[string]Project
+}
+
+// NewFallback returns a new Fallback which has no valid definitions yet.
+func NewFallback() *Fallback {
+	return &Fallback{projects: make(map[string]Project)}
+}
+
+// fallback keeps the definitions loaded by Load if not nil.
+var fallback *Fallback
+
+// SetFallback makes Load keep the last valid definitions in "f". Invalid projects are skipped and invalid global settings fail Load if "f" is nil.
+func SetFallback(f *Fallback) {
+	fallback = f
+}
+
+// loadedGlobal records "cfg" as the last valid global settings, and returns them.
+func (f *Fallback) loadedGlobal(cfg Config) Config {
+	if f == nil {
+		return cfg
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cfg.Projects, cfg.ConfigErrors = nil, nil
+	f.global = &cfg
+	return cfg
+}
+
+// invalidGlobal returns the last valid global settings with "err", or false if there are none.
+func (f *Fallback) invalidGlobal(err error) (Config, bool) {
+	if f == nil {
+		return Config{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.global == nil {
+		return Config{}, false
+	}
+	cfg := *f.global
+	cfg.ConfigErrors = []string{err.Error()}
+	return cfg, true
+}
+
+// loadedProject records "proj" as the last valid definition of the project.
+func (f *Fallback) loadedProject(proj Project) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.projects[proj.Name] = cloneProject(proj)
+}
+
+// invalidProject returns the last valid definition of the project "name" with "err", or false if there is none.
+func (f *Fallback) invalidProject(name string, err error) (Project, bool) {
+	if f == nil {
+		return Project{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	proj, ok := f.projects[name]
+	if !ok {
+		return Project{}, false
+	}
+	proj = cloneProject(proj)
+	proj.ConfigErrors = []string{err.Error()}
+	return proj, true
+}
+
+// cloneProject returns a copy of "proj" which shares no environments, hosts, host tags or locks with it,
+// so that callers of Load can modify what they get while other goroutines read the kept definition.
+func cloneProject(proj Project) Project {
+	envs := make([]Environment, len(proj.Environments))
+	for i, e := range proj.Environments {
+		hosts := make([]Host, len(e.Hosts))
+		for j, h := range e.Hosts {
+			if h.Tags != nil {
+				tags := make(map[string]string, len(h.Tags))
+				for k, v := range h.Tags {
+					tags[k] = v
+				}
+				h.Tags = tags
+			}
+			hosts[j] = h
+		}
+		e.Hosts = hosts
+		if e.AutoLock != nil {
+			l := *e.AutoLock
+			e.AutoLock = &l
+		}
+		envs[i] = e
+	}
+	proj.Environments = envs
+	if proj.Repos != nil {
+		proj.Repos = append([]RepoRef(nil), proj.Repos...)
+	}
+	return proj
+}
+
+// retain forgets the projects which are not in "names" any longer, so that deleted projects are not revived.
+func (f *Fallback) retain(names map[string]bool) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name := range f.projects {
+		if !names[name] {
+			delete(f.projects, name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package config_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func fallbackTestConfig() config.Config {
+	env := config.Environment{Name: "production", Branch: "master", Deploy: "/bin/true"}
+	return config.Config{
+		DeployUser: "deployer",
+		Notify:     "/usr/local/bin/notify",
+		Projects: []config.Project{
+			{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{env}},
+			{Name: "web", Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}, Environments: []config.Environment{env}},
+		},
+	}
+}
+
+// projectsByName returns the projects in "c" by their names.
+func projectsByName(c config.Config) map[string]config.Project {
+	projs := make(map[string]config.Project)
+	for _, p := range c.Projects {
+		projs[p.Name] = p
+	}
+	return projs
+}
+
+func projectNames(projs []config.Project) []string {
+	var names []string
+	for _, p := range projs {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestFallback(t *testing.T) {
+	defer config.SetFallback(nil)
+	config.SetFallback(config.NewFallback())
+
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, fallbackTestConfig()); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	if _, err := config.Load(s); err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+
+	// a mixed update: api and the global settings break while web changes validly and a broken project is added.
+	s.values["/goship/config"] = `{"deploy_user": "other", "notify": 1}`
+	s.values["/goship/projects/api/environments/production"] = `{"deploy": "/bin/true", "pivotal_events": ["unknown"]}`
+	s.values["/goship/projects/web/config"] = `{"repo_owner": "gengo", "repo_name": "web2"}`
+	s.values["/goship/projects/broken/config"] = `{"host_type": "unknown"}`
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if c.DeployUser != "deployer" || c.Notify != "/usr/local/bin/notify" || len(c.ConfigErrors) != 1 {
+		t.Errorf("global settings = %q, %q with errors %q; want the last valid ones with an error", c.DeployUser, c.Notify, c.ConfigErrors)
+	}
+	projs := projectsByName(c)
+	if got, want := len(projs), 2; got != want {
+		t.Errorf("loaded %d projects; want %d without the broken one", got, want)
+	}
+	api := projs["api"]
+	if len(api.ConfigErrors) != 1 || len(api.Environments) != 1 || len(api.Environments[0].PivotalEvents) != 0 {
+		t.Errorf("api = %#v; want the last valid definition with an error", api)
+	}
+	web := projs["web"]
+	if web.RepoName != "web2" || web.ConfigErrors != nil {
+		t.Errorf("web = %#v; want the new definition without errors", web)
+	}
+
+	// fixes take effect and clear the errors.
+	s.values["/goship/config"] = `{"deploy_user": "other"}`
+	s.values["/goship/projects/api/environments/production"] = `{"deploy": "/bin/false"}`
+	c, err = config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if c.DeployUser != "other" || c.ConfigErrors != nil {
+		t.Errorf("global settings = %q with errors %q; want the new ones without errors", c.DeployUser, c.ConfigErrors)
+	}
+	if api := projectsByName(c)["api"]; api.ConfigErrors != nil || api.Environments[0].Deploy != "/bin/false" {
+		t.Errorf("api = %#v; want the new definition without errors", api)
+	}
+
+	// deleted projects are not revived even if they come back broken.
+	for _, key := range []string{"/goship/projects/api/config", "/goship/projects/api/environments/production"} {
+		delete(s.values, key)
+	}
+	if _, err := config.Load(s); err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	s.values["/goship/projects/api/config"] = `{"host_type": "unknown"}`
+	c, err = config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if got, want := projectNames(c.Projects), []string{"web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("projects = %q; want %q", got, want)
+	}
+}
+
+func TestLoadWithoutFallback(t *testing.T) {
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, fallbackTestConfig()); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	s.values["/goship/projects/api/config"] = `{"host_type": "unknown"}`
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if got, want := projectNames(c.Projects), []string{"web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("projects = %q; want %q", got, want)
+	}
+	s.values["/goship/config"] = `{"deploy_user": 1}`
+	if c, err := config.Load(s); err == nil {
+		t.Errorf("config.Load(s) = %#v; want failure", c)
+	}
+}
+
+func TestFallbackIsolatesLoadedProjects(t *testing.T) {
+	defer config.SetFallback(nil)
+	config.SetFallback(config.NewFallback())
+
+	cfg := fallbackTestConfig()
+	cfg.Projects[0].Environments[0].Hosts = []config.Host{{Name: "app1.example.com", Tags: map[string]string{"role": "app"}}}
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	// callers modify what they loaded, e.g. while filtering hosts
+	api := projectsByName(c)["api"]
+	api.Environments[0].Hosts[0].Tags["role"] = "modified"
+	api.Environments[0].Hosts[0].Name = "modified.example.com"
+
+	s.values["/goship/projects/api/environments/production"] = `{"deploy": "/bin/true", "pivotal_events": ["unknown"]}`
+	// concurrent requests modify the last valid definition they got while others load it
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				c, err := config.Load(s)
+				if err != nil {
+					t.Errorf("config.Load(s) failed with %v", err)
+					return
+				}
+				h := projectsByName(c)["api"].Environments[0].Hosts[0]
+				if h.Name != "app1.example.com" || h.Tags["role"] != "app" {
+					t.Errorf("host = %#v; want the last valid definition", h)
+					return
+				}
+				h.Tags["role"] = "modified"
+			}
+		}()
+	}
+	wg.Wait()
+}
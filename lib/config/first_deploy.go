@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// Ways to find Pivotal stories on the first deployment into an environment, where no revision is known to compare with.
+const (
+	// FirstDeploySkip comments no stories.
+	FirstDeploySkip = "skip"
+	// FirstDeployLookback comments stories referred by the recent commits up to the deployed revision.
+	FirstDeployLookback = "lookback"
+)
+
+const (
+	// defaultLookbackHours is how far FirstDeployLookback looks back unless limited otherwise.
+	defaultLookbackHours = 24
+	// maxLookbackCommits is the maximum number of commits which FirstDeployLookback takes into account.
+	maxLookbackCommits = 100
+)
+
+// ErrFirstDeploy means that no stories are commented since no revision is known to compare the deployed one with.
+var ErrFirstDeploy = errors.New("first deploy, skipping story comments")
+
+// ErrBaseMissing means that no stories are commented since the previously deployed revision no longer exists on GitHub,
+// e.g. after a history rewrite, and cannot be compared with the deployed one.
+var ErrBaseMissing = errors.New("previous revision missing on GitHub, story extraction skipped")
+
+// FirstDeployConfiguration is how stories are found on the first deployment into an environment of a project.
+type FirstDeployConfiguration struct {
+	// Mode is either FirstDeploySkip or FirstDeployLookback. It defaults to FirstDeploySkip.
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// LookbackHours limits the commits which FirstDeployLookback takes into account to ones committed within the hours.
+	// It defaults to 24 hours unless LookbackCommits is set.
+	LookbackHours int `json:"lookback_hours,omitempty" yaml:"lookback_hours,omitempty"`
+	// LookbackCommits limits the commits which FirstDeployLookback takes into account to the number of latest ones, up to 100.
+	LookbackCommits int `json:"lookback_commits,omitempty" yaml:"lookback_commits,omitempty"`
+}
+
+func (f *FirstDeployConfiguration) validate() error {
+	if f == nil {
+		return nil
+	}
+	switch f.Mode {
+	case "", FirstDeploySkip, FirstDeployLookback:
+	default:
+		return errorf(ErrInvalid, "pivotal_first_deploy: unknown mode %q", f.Mode)
+	}
+	if f.LookbackHours < 0 || f.LookbackCommits < 0 {
+		return errorf(ErrInvalid, "pivotal_first_deploy: negative lookback")
+	}
+	return nil
+}
+
+// lookback returns the options to list the commits up to "head" which FirstDeployLookback takes into account at "now".
+func (f FirstDeployConfiguration) lookback(head string, now time.Time) *github.CommitsListOptions {
+	opts := &github.CommitsListOptions{SHA: head}
+	hours := f.LookbackHours
+	if hours == 0 && f.LookbackCommits == 0 {
+		hours = defaultLookbackHours
+	}
+	if hours > 0 {
+		opts.Since = now.Add(-time.Duration(hours) * time.Hour)
+	}
+	opts.PerPage = maxLookbackCommits
+	if f.LookbackCommits > 0 && f.LookbackCommits < maxLookbackCommits {
+		opts.PerPage = f.LookbackCommits
+	}
+	return opts
+}
+
+// PivotalStoryIDs returns the IDs of Pivotal stories referred by the commits after "base" up to "head" in the repository.
+// If "base" is empty, it finds stories as configured in "first", or returns ErrFirstDeploy.
+// It returns ErrBaseMissing if "base" no longer exists on GitHub. Other failures of GitHub are ErrGitHubUnavailable.
+func PivotalStoryIDs(gcl githublib.Client, first *FirstDeployConfiguration, owner, repoName, base, head string, now time.Time) ([]int, error) {
+	commits, err := storyCommits(gcl, first, owner, repoName, base, head, now)
+	if err != nil {
+		return nil, err
+	}
+	return pivotalIDs(commits)
+}
+
+// PivotalStoryCommits is like PivotalStoryIDs, but returns the commits which refer to each story too.
+func PivotalStoryCommits(gcl githublib.Client, first *FirstDeployConfiguration, owner, repoName, base, head string, now time.Time) (StoryCommits, error) {
+	commits, err := storyCommits(gcl, first, owner, repoName, base, head, now)
+	if err != nil {
+		return nil, err
+	}
+	return pivotalCommits(commits)
+}
+
+// storyCommits returns the commits which PivotalStoryIDs looks for stories in.
+func storyCommits(gcl githublib.Client, first *FirstDeployConfiguration, owner, repoName, base, head string, now time.Time) ([]github.RepositoryCommit, error) {
+	if base != "" {
+		comp, _, err := gcl.CompareCommits(owner, repoName, base, head)
+		if githublib.IsMissingCommit(err) {
+			return nil, ErrBaseMissing
+		}
+		if err != nil {
+			return nil, githubError(err)
+		}
+		return comp.Commits, nil
+	}
+	if first == nil || first.Mode != FirstDeployLookback {
+		return nil, ErrFirstDeploy
+	}
+	commits, _, err := gcl.ListCommits(owner, repoName, first.lookback(head, now))
+	if err != nil {
+		return nil, githubError(err)
+	}
+	return commits, nil
+}
@@ -0,0 +1,165 @@
+package config_test
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// commitsClient serves "commits" as the history of any branch.
+type commitsClient struct {
+	githublib.Client
+	commits []github.RepositoryCommit
+	// listed is the options of the last ListCommits call.
+	listed *github.CommitsListOptions
+	// compared is the base and the head of the last CompareCommits call.
+	compared []string
+}
+
+func (c *commitsClient) ListCommits(owner, repo string, opts *github.CommitsListOptions) ([]github.RepositoryCommit, *github.Response, error) {
+	c.listed = opts
+	return c.commits, nil, nil
+}
+
+func (c *commitsClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	c.compared = []string{base, head}
+	return &github.CommitsComparison{Commits: c.commits}, nil, nil
+}
+
+func newCommitsClient(messages ...string) *commitsClient {
+	c := new(commitsClient)
+	for i, m := range messages {
+		c.commits = append(c.commits, github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("sha%d", i)),
+			Commit: &github.Commit{Message: github.String(m)},
+		})
+	}
+	return c
+}
+
+func TestPivotalStoryIDsFirstDeploy(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, spec := range []struct {
+		first *config.FirstDeployConfiguration
+		// wantErr is the expected error. nil means success.
+		wantErr error
+		wantIDs []int
+		// wantOpts is the expected options of listing commits. nil means no listing.
+		wantOpts *github.CommitsListOptions
+	}{
+		{wantErr: config.ErrFirstDeploy},
+		{first: &config.FirstDeployConfiguration{Mode: config.FirstDeploySkip}, wantErr: config.ErrFirstDeploy},
+		{
+			first:   &config.FirstDeployConfiguration{Mode: config.FirstDeployLookback},
+			wantIDs: []int{123, 456},
+			wantOpts: &github.CommitsListOptions{
+				SHA:         "head",
+				Since:       now.Add(-24 * time.Hour),
+				ListOptions: github.ListOptions{PerPage: 100},
+			},
+		},
+		{
+			first:   &config.FirstDeployConfiguration{Mode: config.FirstDeployLookback, LookbackHours: 3},
+			wantIDs: []int{123, 456},
+			wantOpts: &github.CommitsListOptions{
+				SHA:         "head",
+				Since:       now.Add(-3 * time.Hour),
+				ListOptions: github.ListOptions{PerPage: 100},
+			},
+		},
+		{
+			first:   &config.FirstDeployConfiguration{Mode: config.FirstDeployLookback, LookbackCommits: 20},
+			wantIDs: []int{123, 456},
+			wantOpts: &github.CommitsListOptions{
+				SHA:         "head",
+				ListOptions: github.ListOptions{PerPage: 20},
+			},
+		},
+	} {
+		gcl := newCommitsClient("[#123] fix", "no story", "[finishes #456] feature", "[#123] again")
+		ids, err := config.PivotalStoryIDs(gcl, spec.first, "owner", "repo", "", "head", now)
+		if err != spec.wantErr {
+			t.Errorf("config.PivotalStoryIDs(gcl, %#v, owner, repo, %q, %q, now) failed with %v; want %v", spec.first, "", "head", err, spec.wantErr)
+		}
+		if !reflect.DeepEqual(ids, spec.wantIDs) {
+			t.Errorf("config.PivotalStoryIDs(gcl, %#v, owner, repo, %q, %q, now) = %v; want %v", spec.first, "", "head", ids, spec.wantIDs)
+		}
+		if !reflect.DeepEqual(gcl.listed, spec.wantOpts) {
+			t.Errorf("listed commits with %#v; want %#v", gcl.listed, spec.wantOpts)
+		}
+		if gcl.compared != nil {
+			t.Errorf("compared %q without the base", gcl.compared)
+		}
+	}
+}
+
+func TestPivotalStoryIDsCompare(t *testing.T) {
+	gcl := newCommitsClient("[#123] fix")
+	first := &config.FirstDeployConfiguration{Mode: config.FirstDeployLookback}
+	ids, err := config.PivotalStoryIDs(gcl, first, "owner", "repo", "base", "head", time.Now())
+	if err != nil {
+		t.Fatalf("config.PivotalStoryIDs(gcl, first, owner, repo, %q, %q, now) failed with %v", "base", "head", err)
+	}
+	if want := []int{123}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("config.PivotalStoryIDs(gcl, first, owner, repo, %q, %q, now) = %v; want %v", "base", "head", ids, want)
+	}
+	if want := []string{"base", "head"}; !reflect.DeepEqual(gcl.compared, want) {
+		t.Errorf("compared %q; want %q", gcl.compared, want)
+	}
+	if gcl.listed != nil {
+		t.Errorf("listed commits with %#v; want comparison", gcl.listed)
+	}
+}
+
+func TestPivotalStoryCommits(t *testing.T) {
+	gcl := newCommitsClient("[#123] fix", "refactor", "[finishes #456] feature", "[#123] fix again")
+	sc, err := config.PivotalStoryCommits(gcl, nil, "owner", "repo", "base", "head", time.Now())
+	if err != nil {
+		t.Fatalf("config.PivotalStoryCommits(gcl, nil, owner, repo, %q, %q, now) failed with %v", "base", "head", err)
+	}
+	want := config.StoryCommits{123: {"sha0", "sha3"}, 456: {"sha2"}}
+	if !reflect.DeepEqual(sc, want) {
+		t.Errorf("config.PivotalStoryCommits(...) = %v; want %v", sc, want)
+	}
+	if got, want := sc.IDs(), []int{123, 456}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sc.IDs() = %v; want %v", got, want)
+	}
+
+	if _, err := config.PivotalStoryCommits(gcl, nil, "owner", "repo", "", "head", time.Now()); err != config.ErrFirstDeploy {
+		t.Errorf("config.PivotalStoryCommits(...) failed with %v without the base; want %v", err, config.ErrFirstDeploy)
+	}
+}
+
+// missingClient fails comparisons like GitHub does when the base no longer exists.
+type missingClient struct {
+	githublib.Client
+	status  int
+	message string
+}
+
+func (c missingClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	resp := &http.Response{StatusCode: c.status}
+	return nil, &github.Response{Response: resp}, &github.ErrorResponse{Response: resp, Message: c.message}
+}
+
+func TestPivotalStoryCommitsBaseMissing(t *testing.T) {
+	for _, gcl := range []missingClient{
+		{status: 404, message: "Not Found"},
+		{status: 422, message: "No common ancestor between base and head."},
+	} {
+		if _, err := config.PivotalStoryCommits(gcl, nil, "owner", "repo", "base", "head", time.Now()); err != config.ErrBaseMissing {
+			t.Errorf("config.PivotalStoryCommits(...) failed with %v on %d %q; want %v", err, gcl.status, gcl.message, config.ErrBaseMissing)
+		}
+	}
+
+	gcl := missingClient{status: 422, message: "Validation Failed"}
+	if _, err := config.PivotalStoryCommits(gcl, nil, "owner", "repo", "base", "head", time.Now()); err == nil || err == config.ErrBaseMissing {
+		t.Errorf("config.PivotalStoryCommits(...) failed with %v on other 422; want the error of GitHub", err)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// flagEnvPrefix is the prefix of the names of environment variables which carry deploy flags.
+const flagEnvPrefix = "GOSHIP_FLAG_"
+
+// ParseDeployFlags parses deploy flags given as "key=value" lines.
+// Blank lines are ignored. Whitespace around keys and values is trimmed.
+func ParseDeployFlags(s string) (map[string]string, error) {
+	flags := make(map[string]string)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, errorf(ErrInvalid, "invalid flag %q; want key=value", line)
+		}
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, errorf(ErrInvalid, "invalid flag %q; empty key", line)
+		}
+		if _, ok := flags[key]; ok {
+			return nil, errorf(ErrInvalid, "duplicate flag %q", key)
+		}
+		flags[key] = strings.TrimSpace(kv[1])
+	}
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	return flags, nil
+}
+
+// ValidateFlags returns an error if a key in "flags" is not in AllowedFlags of the environment,
+// or two keys map to the same environment variable.
+func (e Environment) ValidateFlags(flags map[string]string) error {
+	allowed := make(map[string]bool)
+	for _, k := range e.AllowedFlags {
+		allowed[k] = true
+	}
+	names := make(map[string]string)
+	for _, k := range FlagKeys(flags) {
+		if !allowed[k] {
+			return errorf(ErrInvalid, "flag %q is not allowed in %s", k, e.Name)
+		}
+		if strings.ContainsRune(flags[k], 0) {
+			return errorf(ErrInvalid, "flag %q contains a NUL character", k)
+		}
+		name := FlagEnvName(k)
+		if other, ok := names[name]; ok {
+			return errorf(ErrInvalid, "flags %q and %q are both exported as %s", other, k, name)
+		}
+		names[name] = k
+	}
+	return nil
+}
+
+// FlagEnvName returns the name of the environment variable which carries the flag "key".
+// Letters are upper-cased, and characters other than ASCII letters, digits and underscores are replaced with underscores.
+func FlagEnvName(key string) string {
+	name := make([]byte, 0, len(flagEnvPrefix)+len(key))
+	name = append(name, flagEnvPrefix...)
+	for _, c := range key {
+		switch {
+		case 'a' <= c && c <= 'z':
+			name = append(name, byte(c-'a'+'A'))
+		case 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_':
+			name = append(name, byte(c))
+		default:
+			name = append(name, '_')
+		}
+	}
+	return string(name)
+}
+
+// FlagEnv returns "flags" as environment variables in the form of "GOSHIP_FLAG_<KEY>=value", sorted by key.
+func FlagEnv(flags map[string]string) []string {
+	var env []string
+	for _, k := range FlagKeys(flags) {
+		env = append(env, FlagEnvName(k)+"="+flags[k])
+	}
+	return env
+}
+
+// FlagKeys returns the keys of "flags" in sorted order.
+func FlagKeys(flags map[string]string) []string {
+	keys := make([]string, 0, len(flags))
+	for k := range flags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
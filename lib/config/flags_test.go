@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestParseDeployFlags(t *testing.T) {
+	for _, spec := range []struct {
+		input string
+		want  map[string]string
+	}{
+		{input: "", want: nil},
+		{input: "\n  \n", want: nil},
+		{
+			input: "new_checkout=on\n beta.search = 50% \nmsg=a=b",
+			want:  map[string]string{"new_checkout": "on", "beta.search": "50%", "msg": "a=b"},
+		},
+		{input: "empty=", want: map[string]string{"empty": ""}},
+	} {
+		got, err := config.ParseDeployFlags(spec.input)
+		if err != nil {
+			t.Errorf("config.ParseDeployFlags(%q) failed with %v; want success", spec.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.ParseDeployFlags(%q) = %q; want %q", spec.input, got, spec.want)
+		}
+	}
+
+	for _, input := range []string{"no-value", "=value", "a=1\na=2"} {
+		if got, err := config.ParseDeployFlags(input); err == nil {
+			t.Errorf("config.ParseDeployFlags(%q) = %q; want failure", input, got)
+		}
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	env := config.Environment{Name: "production", AllowedFlags: []string{"new_checkout", "beta.search", "beta-search"}}
+	for _, flags := range []map[string]string{
+		nil,
+		{"new_checkout": "on"},
+		{"new_checkout": "off", "beta.search": "50%"},
+	} {
+		if err := env.ValidateFlags(flags); err != nil {
+			t.Errorf("env.ValidateFlags(%q) failed with %v; want success", flags, err)
+		}
+	}
+	for _, flags := range []map[string]string{
+		{"unknown": "on"},
+		{"new_checkout": "on", "NEW_CHECKOUT": "off"},
+		// both are exported as GOSHIP_FLAG_BETA_SEARCH
+		{"beta.search": "on", "beta-search": "off"},
+		{"new_checkout": "on\x00"},
+	} {
+		if err := env.ValidateFlags(flags); err == nil {
+			t.Errorf("env.ValidateFlags(%q) succeeded; want failure", flags)
+		}
+	}
+}
+
+func TestFlagEnv(t *testing.T) {
+	flags := map[string]string{
+		"new_checkout": "on",
+		"beta.search":  "50% of \"users\"; $HOME",
+		"ünïcode-key":  "line1\nline2",
+	}
+	got := config.FlagEnv(flags)
+	want := []string{
+		"GOSHIP_FLAG_BETA_SEARCH=50% of \"users\"; $HOME",
+		"GOSHIP_FLAG_NEW_CHECKOUT=on",
+		"GOSHIP_FLAG__N_CODE_KEY=line1\nline2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config.FlagEnv(%q) = %q; want %q", flags, got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+
+	githublib "github.com/gengo/goship/lib/github"
+)
+
+// GitHubAppConfiguration authenticates goship to GitHub as a GitHub App instead of the personal token in GITHUB_API_TOKEN.
+type GitHubAppConfiguration struct {
+	// AppID is the ID of the GitHub App.
+	AppID int `json:"app_id" yaml:"app_id"`
+	// InstallationID is the installation of the app used for projects without their own installations.
+	InstallationID int `json:"installation_id" yaml:"installation_id"`
+	// PrivateKey is the private key of the app in PEM, which installation tokens are minted with.
+	PrivateKey string `json:"private_key" yaml:"private_key" goship:"secret"`
+}
+
+// GitHubInstallationOf returns the GitHub App installation of the project of the repository "owner/repo",
+// or 0 if the project uses the default installation or no project has the repository.
+func (c Config) GitHubInstallationOf(owner, repo string) int {
+	for _, p := range c.Projects {
+		if p.GitHubInstallationID == 0 {
+			continue
+		}
+		if r := p.Repo; r.RepoOwner == owner && r.RepoName == repo {
+			return p.GitHubInstallationID
+		}
+		if r := p.SourceRepo(); r.RepoOwner == owner && r.RepoName == repo {
+			return p.GitHubInstallationID
+		}
+	}
+	return 0
+}
+
+// gitHubClient is the client of GitHub APIs which the config package calls. See SetGitHubClient.
+var gitHubClient githublib.Client
+
+// SetGitHubClient makes the config package call GitHub APIs with "c",
+// so that the same credentials and rate limits apply as the rest of goship.
+func SetGitHubClient(c githublib.Client) {
+	gitHubClient = c
+}
+
+// newGithubClient returns the client set by SetGitHubClient, or one with GITHUB_API_TOKEN if none.
+func newGithubClient() githublib.Client {
+	if gitHubClient != nil {
+		return gitHubClient
+	}
+	return githublib.NewClient(os.Getenv(gitHubAPITokenEnvVar))
+}
@@ -0,0 +1,35 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestGitHubInstallationOf(t *testing.T) {
+	c := config.Config{
+		Projects: []config.Project{
+			{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}},
+			{Name: "partner", Repo: config.Repo{RepoOwner: "partner", RepoName: "web"}, GitHubInstallationID: 7},
+			{
+				Name:                 "image",
+				Repo:                 config.Repo{RepoOwner: "gengo", RepoName: "image"},
+				Source:               &config.Repo{RepoOwner: "partner", RepoName: "image-src"},
+				GitHubInstallationID: 8,
+			},
+		},
+	}
+	for _, spec := range []struct {
+		owner, repo string
+		want        int
+	}{
+		{owner: "gengo", repo: "api"},
+		{owner: "partner", repo: "web", want: 7},
+		{owner: "partner", repo: "image-src", want: 8},
+		{owner: "unknown", repo: "repo"},
+	} {
+		if got := c.GitHubInstallationOf(spec.owner, spec.repo); got != spec.want {
+			t.Errorf("c.GitHubInstallationOf(%q, %q) = %d; want %d", spec.owner, spec.repo, got, spec.want)
+		}
+	}
+}
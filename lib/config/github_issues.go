@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+// GithubIssuesConfiguration comments deployments on the GitHub issues which the deployed commits refer to,
+// like PivotalConfiguration does on Pivotal stories.
+type GithubIssuesConfiguration struct {
+	// Label adds "deployed:<environment>" to the issues on successful deployments.
+	Label bool `json:"label,omitempty" yaml:"label,omitempty"`
+	// CrossRepo comments the issues of other repositories referred as "owner/repo#123" too.
+	// Such references are skipped with a log otherwise.
+	CrossRepo bool `json:"cross_repo,omitempty" yaml:"cross_repo,omitempty"`
+}
+
+// IssueRef refers to an issue of a GitHub repository.
+type IssueRef struct {
+	Owner, Repo string
+	Number      int
+}
+
+// String returns "owner/repo#123".
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+// IssueCommits maps the issues referred by commits to the SHAs of the commits which refer to them, in the order of the commits.
+type IssueCommits map[IssueRef][]string
+
+// Refs returns the issues in the order of their repositories and numbers.
+func (ic IssueCommits) Refs() []IssueRef {
+	refs := make([]IssueRef, 0, len(ic))
+	for r := range ic {
+		refs = append(refs, r)
+	}
+	sort.Sort(byIssueRef(refs))
+	return refs
+}
+
+type byIssueRef []IssueRef
+
+func (rs byIssueRef) Len() int      { return len(rs) }
+func (rs byIssueRef) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs byIssueRef) Less(i, j int) bool {
+	if a, b := rs[i].Owner+"/"+rs[i].Repo, rs[j].Owner+"/"+rs[j].Repo; a != b {
+		return a < b
+	}
+	return rs[i].Number < rs[j].Number
+}
+
+var (
+	// issueRE matches "#123" and "owner/repo#123" which are not a part of words, paths or HTML entities.
+	issueRE = regexp.MustCompile(`(?:^|[^\w/&#])(?:([\w.-]+)/([\w.-]+))?#(\d+)\b`)
+	// bracketRE matches the Pivotal references like "[#123]" and "[finishes #123]", which are not GitHub issues.
+	bracketRE = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+// IssueRefsOf returns the GitHub issues which the commit message "msg" refers to, e.g. "#123", "Fixes #123" or
+// "owner/repo#123". References without a repository are of "owner/repo". Pivotal stories in brackets are ignored.
+func IssueRefsOf(msg, owner, repo string) []IssueRef {
+	var refs []IssueRef
+	for _, m := range issueRE.FindAllStringSubmatch(bracketRE.ReplaceAllString(msg, ""), -1) {
+		n, err := strconv.Atoi(m[3])
+		if err != nil || n == 0 {
+			continue
+		}
+		r := IssueRef{Owner: owner, Repo: repo, Number: n}
+		if m[1] != "" {
+			r.Owner, r.Repo = m[1], m[2]
+		}
+		refs = append(refs, r)
+	}
+	return refs
+}
+
+// issueCommits returns the issues referred by the messages of "commits" of "owner/repo" with the SHAs of the commits.
+func issueCommits(commits []github.RepositoryCommit, owner, repo string) IssueCommits {
+	ic := make(IssueCommits)
+	for _, commit := range commits {
+		if commit.SHA == nil || commit.Commit == nil || commit.Commit.Message == nil {
+			continue
+		}
+		for _, r := range IssueRefsOf(*commit.Commit.Message, owner, repo) {
+			shas := ic[r]
+			if len(shas) > 0 && shas[len(shas)-1] == *commit.SHA {
+				continue
+			}
+			ic[r] = append(shas, *commit.SHA)
+		}
+	}
+	return ic
+}
+
+// IssuesSummary is the result of commenting a deployment on GitHub issues.
+type IssuesSummary struct {
+	// Posted is the number of the issues commented.
+	Posted int `json:"posted"`
+	// Closed is the number of the commented issues which had already been closed, e.g. by "Fixes #123".
+	Closed int `json:"closed,omitempty"`
+	// Skipped are the issues of other repositories which are not commented unless CrossRepo.
+	Skipped []string `json:"skipped,omitempty"`
+	// Failed are the issues which could not be commented, e.g. for lack of permissions.
+	Failed []string `json:"failed,omitempty"`
+}
+
+func (s IssuesSummary) String() string {
+	msg := fmt.Sprintf("%d posted (%d closed), %d skipped, %d failed", s.Posted, s.Closed, len(s.Skipped), len(s.Failed))
+	if len(s.Failed) > 0 {
+		msg += ": " + strings.Join(s.Failed, ", ")
+	}
+	return msg
+}
+
+// DeployedLabel returns the label which marks issues deployed into "env".
+func DeployedLabel(env string) string {
+	return "deployed:" + env
+}
+
+// PostToGithubIssues posts a comment about the deployment event "ev" by "user" to the GitHub issues referred by the commits
+// of "proj" between "current" and "latest", in the same way as PostToPivotal. Commits are found as PostToPivotal does,
+// so it returns ErrFirstDeploy and ErrBaseMissing in the same cases.
+// Issues which cannot be commented are logged and counted as failed in the summary rather than failing the whole post.
+func PostToGithubIssues(gi *GithubIssuesConfiguration, proj Project, ev PivotalEvent, env, current, latest, user, note string) (IssuesSummary, error) {
+	return postToGithubIssues(newGithubClient(), *gi, proj, ev, env, current, latest, user, note, time.Now())
+}
+
+func postToGithubIssues(gcl githublib.Client, gi GithubIssuesConfiguration, proj Project, ev PivotalEvent, env, current, latest, user, note string, now time.Time) (IssuesSummary, error) {
+	base, head := current, latest
+	if ev == PivotalRollback {
+		base, head = latest, current
+	}
+	repo := proj.SourceRepo()
+	commits, err := storyCommits(gcl, proj.PivotalFirstDeploy, repo.RepoOwner, repo.RepoName, base, head, now)
+	if err != nil {
+		return IssuesSummary{}, err
+	}
+	ic := issueCommits(commits, repo.RepoOwner, repo.RepoName)
+	msg := PivotalMessage(ev, env, repo.RepoName, current, latest, commentTimestamp(now), user, note)
+
+	var sum IssuesSummary
+	for _, r := range ic.Refs() {
+		if (r.Owner != repo.RepoOwner || r.Repo != repo.RepoName) && !gi.CrossRepo {
+			glog.Infof("Skipped %s referred by %s of %s since cross_repo is not enabled", r, strings.Join(ic[r], ", "), proj.Name)
+			sum.Skipped = append(sum.Skipped, r.String())
+			continue
+		}
+		issue, _, err := gcl.GetIssue(r.Owner, r.Repo, r.Number)
+		if err != nil {
+			glog.Errorf("Failed to get %s: %v", r, issueError(err))
+			sum.Failed = append(sum.Failed, r.String())
+			continue
+		}
+		body := msg + "\n\n" + PivotalCommitLinks(proj, ic[r], base, head)
+		if _, _, err := gcl.CreateIssueComment(r.Owner, r.Repo, r.Number, &github.IssueComment{Body: github.String(body)}); err != nil {
+			glog.Errorf("Failed to comment on %s: %v", r, issueError(err))
+			sum.Failed = append(sum.Failed, r.String())
+			continue
+		}
+		sum.Posted++
+		if issue.State != nil && *issue.State == "closed" {
+			sum.Closed++
+		}
+		if gi.Label && ev == PivotalDeploySucceeded {
+			if _, _, err := gcl.AddLabelsToIssue(r.Owner, r.Repo, r.Number, []string{DeployedLabel(env)}); err != nil {
+				// The comment is posted anyway, so the issue is not counted as failed.
+				glog.Errorf("Failed to label %s: %v", r, issueError(err))
+			}
+		}
+	}
+	return sum, nil
+}
+
+// issueError explains failures of the Issues API which mean that goship is not allowed to touch the issue.
+func issueError(err error) error {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil {
+		return err
+	}
+	switch e.Response.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("no permission to the issue or it does not exist: %v", err)
+	}
+	return err
+}
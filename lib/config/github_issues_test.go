@@ -0,0 +1,165 @@
+package config_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/google/go-github/github"
+)
+
+func TestIssueRefsOf(t *testing.T) {
+	for _, spec := range []struct {
+		msg  string
+		want []config.IssueRef
+	}{
+		{msg: "Fix typo"},
+		{msg: "Fix typo (#12)", want: []config.IssueRef{{Owner: "gengo", Repo: "api", Number: 12}}},
+		{msg: "Add cache\n\nFixes #34, closes #56", want: []config.IssueRef{{Owner: "gengo", Repo: "api", Number: 34}, {Owner: "gengo", Repo: "api", Number: 56}}},
+		{msg: "Bump client\n\nRefs gengo/web#7", want: []config.IssueRef{{Owner: "gengo", Repo: "web", Number: 7}}},
+		// Pivotal stories, anchors and HTML entities are not issues.
+		{msg: "[finishes #123456] Add a button"},
+		{msg: "See https://example.com/docs/index.html#3 and &#39;"},
+	} {
+		if got := config.IssueRefsOf(spec.msg, "gengo", "api"); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.IssueRefsOf(%q, %q, %q) = %v; want %v", spec.msg, "gengo", "api", got, spec.want)
+		}
+	}
+}
+
+// issuesClient mocks the Issues API on the commits of newCommitsClient.
+type issuesClient struct {
+	*commitsClient
+	// states maps "owner/repo#number" to the states of the issues. Missing issues are forbidden.
+	states map[string]string
+	// comments and labels map "owner/repo#number" to the posted bodies and labels.
+	comments map[string][]string
+	labels   map[string][]string
+}
+
+func newIssuesClient(states map[string]string, messages ...string) *issuesClient {
+	return &issuesClient{
+		commitsClient: newCommitsClient(messages...),
+		states:        states,
+		comments:      make(map[string][]string),
+		labels:        make(map[string][]string),
+	}
+}
+
+func (c *issuesClient) check(owner, repo string, number int) (string, *github.Response, error) {
+	ref := config.IssueRef{Owner: owner, Repo: repo, Number: number}.String()
+	if _, ok := c.states[ref]; !ok {
+		resp := &http.Response{StatusCode: http.StatusForbidden}
+		return ref, &github.Response{Response: resp}, &github.ErrorResponse{Response: resp, Message: "Resource not accessible by integration"}
+	}
+	return ref, nil, nil
+}
+
+func (c *issuesClient) GetIssue(owner, repo string, number int) (*github.Issue, *github.Response, error) {
+	ref, resp, err := c.check(owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &github.Issue{Number: github.Int(number), State: github.String(c.states[ref])}, nil, nil
+}
+
+func (c *issuesClient) CreateIssueComment(owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	ref, resp, err := c.check(owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	c.comments[ref] = append(c.comments[ref], *comment.Body)
+	return comment, nil, nil
+}
+
+func (c *issuesClient) AddLabelsToIssue(owner, repo string, number int, labels []string) ([]github.Label, *github.Response, error) {
+	ref, resp, err := c.check(owner, repo, number)
+	if err != nil {
+		return nil, resp, err
+	}
+	c.labels[ref] = append(c.labels[ref], labels...)
+	return nil, nil, nil
+}
+
+func TestPostToGithubIssues(t *testing.T) {
+	defer config.SetGitHubClient(nil)
+	proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+	for _, spec := range []struct {
+		gi           config.GithubIssuesConfiguration
+		ev           config.PivotalEvent
+		want         config.IssuesSummary
+		wantComments []string
+		wantLabels   map[string][]string
+	}{
+		{
+			ev:           config.PivotalDeploySucceeded,
+			want:         config.IssuesSummary{Posted: 2, Closed: 1, Skipped: []string{"gengo/web#7"}, Failed: []string{"gengo/api#99"}},
+			wantComments: []string{"gengo/api#12", "gengo/api#34"},
+			wantLabels:   map[string][]string{},
+		},
+		{
+			gi:           config.GithubIssuesConfiguration{Label: true, CrossRepo: true},
+			ev:           config.PivotalDeploySucceeded,
+			want:         config.IssuesSummary{Posted: 3, Closed: 1, Failed: []string{"gengo/api#99"}},
+			wantComments: []string{"gengo/api#12", "gengo/api#34", "gengo/web#7"},
+			wantLabels: map[string][]string{
+				"gengo/api#12": {"deployed:production"},
+				"gengo/api#34": {"deployed:production"},
+				"gengo/web#7":  {"deployed:production"},
+			},
+		},
+		{
+			gi:           config.GithubIssuesConfiguration{Label: true, CrossRepo: true},
+			ev:           config.PivotalDeployFailed,
+			want:         config.IssuesSummary{Posted: 3, Closed: 1, Failed: []string{"gengo/api#99"}},
+			wantComments: []string{"gengo/api#12", "gengo/api#34", "gengo/web#7"},
+			wantLabels:   map[string][]string{},
+		},
+	} {
+		gcl := newIssuesClient(
+			map[string]string{"gengo/api#12": "open", "gengo/api#34": "closed", "gengo/web#7": "open"},
+			"Fix typo (#12)",
+			"Add cache\n\nFixes #34",
+			"Bump client for gengo/web#7",
+			// not permitted to the issue.
+			"Revert #99",
+		)
+		config.SetGitHubClient(gcl)
+
+		gi := spec.gi
+		got, err := config.PostToGithubIssues(&gi, proj, spec.ev, "production", "prev", "next", "alice", "")
+		if err != nil {
+			t.Errorf("config.PostToGithubIssues(%#v, ...) failed with %v", spec.gi, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.PostToGithubIssues(%#v, ...) = %#v; want %#v", spec.gi, got, spec.want)
+		}
+		var commented []string
+		for ref, bodies := range gcl.comments {
+			commented = append(commented, ref)
+			if len(bodies) != 1 || !strings.Contains(bodies[0], "production by alice") || !strings.Contains(bodies[0], "Commits:") {
+				t.Errorf("comments on %s = %q; want a comment about the deployment with the commits", ref, bodies)
+			}
+		}
+		if len(commented) != len(spec.wantComments) {
+			t.Errorf("commented %v; want %v", commented, spec.wantComments)
+		}
+		for _, ref := range spec.wantComments {
+			if len(gcl.comments[ref]) == 0 {
+				t.Errorf("no comment on %s; want one", ref)
+			}
+		}
+		if !reflect.DeepEqual(gcl.labels, spec.wantLabels) {
+			t.Errorf("labels = %v; want %v", gcl.labels, spec.wantLabels)
+		}
+	}
+
+	gcl := newIssuesClient(nil, "Fix typo (#12)")
+	config.SetGitHubClient(gcl)
+	if _, err := config.PostToGithubIssues(&config.GithubIssuesConfiguration{}, proj, config.PivotalDeploySucceeded, "production", "", "next", "alice", ""); err != config.ErrFirstDeploy {
+		t.Errorf("config.PostToGithubIssues(...) failed with %v without the previous revision; want %v", err, config.ErrFirstDeploy)
+	}
+}
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// historyDir is the etcd directory of the config history. Versions of each project are under its name.
+	historyDir = "/goship/history"
+	// historySecretsDir keeps the secrets which snapshots refer to, keyed by their references.
+	historySecretsDir = "/goship/history-secrets"
+	// secretRefPrefix prefixes the references which replace secrets in snapshots.
+	secretRefPrefix = "ref:"
+)
+
+// ConfigVersion is a snapshot of the config of a project, which is taken whenever it is changed through goship.
+// Secrets in the snapshot are replaced by references, so that the history never keeps them in plaintext.
+type ConfigVersion struct {
+	// Version numbers the snapshots of a project from 1.
+	Version int       `json:"version"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	// Summary describes the change, e.g. "rolled back to version 3".
+	Summary string `json:"summary,omitempty"`
+	// Project is the config of the project without its environments.
+	Project Project `json:"project"`
+	// Environments are the configs of the environments of the project keyed by their names.
+	Environments map[string]Environment `json:"environments"`
+}
+
+// ConfigChange is a value which differs between two versions of the config of a project.
+type ConfigChange struct {
+	// Path is a "/"-separated list of the YAML names of fields, map keys and slice indices as in Reveal.
+	// Environments are keyed by their names, e.g. "envs/production/hosts/0/name".
+	Path string `json:"path"`
+	// From and To are the values in the older and the newer versions. They are nil if the value is missing or empty.
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// historyMu serializes the numbering of versions.
+var historyMu sync.Mutex
+
+// RecordVersion takes a snapshot of the project "proj" in "c" as a new version changed by "author" at "now".
+// The secrets are stored apart from the snapshot, encrypted if a keyring is set.
+func RecordVersion(client ETCDInterface, c Config, proj, author, summary string, now time.Time) (ConfigVersion, error) {
+	p, err := ProjectFromName(c.Projects, proj)
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	versions, err := ConfigHistory(client, proj)
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	v := ConfigVersion{Version: 1, Author: author, Time: now, Summary: summary, Environments: make(map[string]Environment)}
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1].Version + 1
+	}
+	// snapshots a copy since "p" shares maps and slices with "c".
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	if err := json.Unmarshal(buf, &v.Project); err != nil {
+		return ConfigVersion{}, err
+	}
+	v.Project.Name = proj
+	for _, env := range p.Environments {
+		var cp Environment
+		buf, err := json.Marshal(env)
+		if err != nil {
+			return ConfigVersion{}, err
+		}
+		if err := json.Unmarshal(buf, &cp); err != nil {
+			return ConfigVersion{}, err
+		}
+		cp.Name = env.Name
+		v.Environments[env.Name] = cp
+	}
+	ref := func(s string) (string, error) { return storeSecretRef(client, s) }
+	if err := walkSecrets(reflect.ValueOf(&v.Project), false, ref); err != nil {
+		return ConfigVersion{}, err
+	}
+	if err := walkSecrets(reflect.ValueOf(v.Environments), false, ref); err != nil {
+		return ConfigVersion{}, err
+	}
+	if buf, err = json.Marshal(v); err != nil {
+		return ConfigVersion{}, err
+	}
+	if _, err := client.Set(versionKey(proj, v.Version), string(buf), 0); err != nil {
+		return ConfigVersion{}, err
+	}
+	return v, nil
+}
+
+// ConfigHistory returns the versions of the config of the project "proj", oldest first.
+func ConfigHistory(client ETCDInterface, proj string) ([]ConfigVersion, error) {
+	resp, err := client.Get(path.Join(historyDir, proj), true, false)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []ConfigVersion
+	for _, node := range resp.Node.Nodes {
+		v, err := unmarshalVersion(proj, node.Value)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	sort.Sort(byVersion(versions))
+	return versions, nil
+}
+
+// GetConfigVersion returns the version "version" of the config of the project "proj".
+// It fails with ErrVersionNotFound if there is no such version.
+func GetConfigVersion(client ETCDInterface, proj string, version int) (ConfigVersion, error) {
+	resp, err := client.Get(versionKey(proj, version), false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return ConfigVersion{}, errorf(ErrVersionNotFound, "no version %d of the config of %s", version, proj)
+	}
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	return unmarshalVersion(proj, resp.Node.Value)
+}
+
+// DiffVersions returns the values which differ between "from" and "to", sorted by their paths.
+// Secrets are compared by their references, so changed secrets are shown as changed references.
+func DiffVersions(from, to ConfigVersion) []ConfigChange {
+	a, b := from.flatten(), to.flatten()
+	var changes []ConfigChange
+	for p, v := range a {
+		if w, ok := b[p]; !ok || !reflect.DeepEqual(v, w) {
+			changes = append(changes, ConfigChange{Path: p, From: v, To: w})
+		}
+	}
+	for p, w := range b {
+		if _, ok := a[p]; !ok {
+			changes = append(changes, ConfigChange{Path: p, To: w})
+		}
+	}
+	sort.Sort(byPath(changes))
+	return changes
+}
+
+// RollbackProject restores the config of the project "proj" in "c" to the version "version" of its history,
+// and records the result as a new version by "author" at "now". Environments added after the version are removed.
+// Locks and comments of the environments are kept as they are, since they are not part of the config.
+func RollbackProject(client RenameStore, c Config, proj string, version int, author string, now time.Time) (ConfigVersion, error) {
+	cur, err := ProjectFromName(c.Projects, proj)
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	v, err := GetConfigVersion(client, proj, version)
+	if err != nil {
+		return ConfigVersion{}, err
+	}
+	resolve := func(s string) (string, error) { return loadSecretRef(client, s) }
+	if err := walkSecrets(reflect.ValueOf(&v.Project), false, resolve); err != nil {
+		return ConfigVersion{}, err
+	}
+	if err := walkSecrets(reflect.ValueOf(v.Environments), false, resolve); err != nil {
+		return ConfigVersion{}, err
+	}
+	restored := v.project()
+	for i, env := range restored.Environments {
+		if _, e, err := EnvironmentFromName(c.Projects, proj, env.Name); err == nil {
+			restored.Environments[i].Comment, restored.Environments[i].Lock, restored.Environments[i].AutoLock = e.Comment, e.Lock, e.AutoLock
+		}
+	}
+	dir := path.Join("/goship/projects", proj, "environments")
+	for _, env := range cur.Environments {
+		if _, ok := v.Environments[env.Name]; ok {
+			continue
+		}
+		if _, err := client.Delete(path.Join(dir, env.Name), true); err != nil {
+			return ConfigVersion{}, err
+		}
+	}
+	if err := storeProject(client, restored, "/goship"); err != nil {
+		return ConfigVersion{}, err
+	}
+	// "c" shares the projects with the caller.
+	c.Projects = append([]Project(nil), c.Projects...)
+	for i, p := range c.Projects {
+		if p.Name == proj {
+			c.Projects[i] = restored
+		}
+	}
+	return RecordVersion(client, c, proj, author, fmt.Sprintf("rolled back to version %d", version), now)
+}
+
+// project returns the project of "v" with its environments sorted by their names.
+func (v ConfigVersion) project() Project {
+	p := v.Project
+	p.Environments = nil
+	var names []string
+	for name := range v.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env := v.Environments[name]
+		env.Name = name
+		p.Environments = append(p.Environments, env)
+	}
+	return p
+}
+
+// flatten returns the values in the tree of "v" keyed by their paths in ConfigChange.
+func (v ConfigVersion) flatten() map[string]interface{} {
+	values := make(map[string]interface{})
+	p := v.Project
+	p.Environments = nil
+	flattenTree(tree(reflect.ValueOf(p), false, false), "", values)
+	delete(values, "envs")
+	for name, env := range v.Environments {
+		flattenTree(tree(reflect.ValueOf(env), false, false), "envs/"+name, values)
+	}
+	return values
+}
+
+// flattenTree puts the leaves of "node", a tree of Masked, into "values" keyed by their paths under "prefix".
+func flattenTree(node interface{}, prefix string, values map[string]interface{}) {
+	join := func(seg string) string {
+		if prefix == "" {
+			return seg
+		}
+		return prefix + "/" + seg
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, child := range n {
+			flattenTree(child, join(k), values)
+		}
+	case []interface{}:
+		for i, child := range n {
+			flattenTree(child, join(strconv.Itoa(i)), values)
+		}
+	default:
+		// empty values are left out like missing ones, so that new environments do not list all their fields.
+		if n != nil && !isEmpty(reflect.ValueOf(n)) {
+			values[prefix] = n
+		}
+	}
+}
+
+// storeSecretRef stores the secret "s" in historySecretsDir and returns the reference to it.
+func storeSecretRef(client ETCDInterface, s string) (string, error) {
+	if strings.HasPrefix(s, secretRefPrefix) {
+		return s, nil
+	}
+	sum := sha256.Sum256([]byte(s))
+	id := hex.EncodeToString(sum[:16])
+	value := s
+	if keyring != nil {
+		var err error
+		if value, err = keyring.encrypt(s); err != nil {
+			return "", err
+		}
+	}
+	if _, err := client.Set(path.Join(historySecretsDir, id), value, 0); err != nil {
+		return "", err
+	}
+	return secretRefPrefix + id, nil
+}
+
+// loadSecretRef returns the secret which "ref" refers to, or "ref" itself if it is not a reference.
+func loadSecretRef(client ETCDInterface, ref string) (string, error) {
+	if !strings.HasPrefix(ref, secretRefPrefix) {
+		return ref, nil
+	}
+	resp, err := client.Get(path.Join(historySecretsDir, strings.TrimPrefix(ref, secretRefPrefix)), false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return "", errorf(ErrInvalid, "secret %s of the config history is missing", ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	return keyring.decrypt(resp.Node.Value)
+}
+
+func unmarshalVersion(proj, value string) (ConfigVersion, error) {
+	var v ConfigVersion
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return ConfigVersion{}, err
+	}
+	v.Project.Name = proj
+	for name, env := range v.Environments {
+		env.Name = name
+		v.Environments[name] = env
+	}
+	return v, nil
+}
+
+// versionKey returns the etcd key of the version "version" of "proj", which sorts in the order of versions.
+func versionKey(proj string, version int) string {
+	return path.Join(historyDir, proj, fmt.Sprintf("%08d", version))
+}
+
+type byVersion []ConfigVersion
+
+func (b byVersion) Len() int           { return len(b) }
+func (b byVersion) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byVersion) Less(i, j int) bool { return b[i].Version < b[j].Version }
+
+type byPath []ConfigChange
+
+func (b byPath) Len() int           { return len(b) }
+func (b byPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPath) Less(i, j int) bool { return b[i].Path < b[j].Path }
@@ -0,0 +1,166 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func historyTestConfig(token, branch string, envs ...string) config.Config {
+	p := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, TravisToken: token}
+	for _, name := range envs {
+		p.Environments = append(p.Environments, config.Environment{
+			Name:   name,
+			Branch: branch,
+			NotificationOverrides: map[string]config.NotificationOverride{
+				config.NotifyTargetSlack: {WebhookURL: "https://hooks.slack.com/services/" + token},
+			},
+		})
+	}
+	return config.Config{Projects: []config.Project{p}}
+}
+
+func TestRecordVersion(t *testing.T) {
+	s := memStore{values: make(map[string]string)}
+	for i, c := range []config.Config{
+		historyTestConfig("travis-secret-1", "master", "staging"),
+		historyTestConfig("travis-secret-2", "release", "staging", "production"),
+	} {
+		v, err := config.RecordVersion(s, c, "api", "alice", "", now.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("config.RecordVersion(s, c, %q, ...) failed with %v", "api", err)
+		}
+		if v.Version != i+1 {
+			t.Errorf("v.Version = %d; want %d", v.Version, i+1)
+		}
+	}
+	if _, err := config.RecordVersion(s, config.Config{}, "api", "alice", "", now); config.Cause(err) != config.ErrProjectNotFound {
+		t.Errorf("config.RecordVersion(s, config.Config{}, %q, ...) failed with %v; want %v", "api", err, config.ErrProjectNotFound)
+	}
+
+	for k, v := range s.values {
+		if strings.HasPrefix(k, "/goship/history/") && strings.Contains(v, "travis-secret") {
+			t.Errorf("%s = %s; want no plaintext secrets", k, v)
+		}
+	}
+	versions, err := config.ConfigHistory(s, "api")
+	if err != nil {
+		t.Fatalf("config.ConfigHistory(s, %q) failed with %v", "api", err)
+	}
+	if len(versions) != 2 || versions[0].Author != "alice" || !versions[1].Time.Equal(now.Add(time.Hour)) || len(versions[1].Environments) != 2 {
+		t.Fatalf("config.ConfigHistory(s, %q) = %#v; want 2 versions", "api", versions)
+	}
+	if got := versions[0].Project.TravisToken; !strings.HasPrefix(got, "ref:") {
+		t.Errorf("travis_token of version 1 = %q; want a reference", got)
+	}
+	if got, err := config.ConfigHistory(s, "web"); err != nil || len(got) != 0 {
+		t.Errorf("config.ConfigHistory(s, %q) = %#v, %v; want no versions", "web", got, err)
+	}
+
+	changes := config.DiffVersions(versions[0], versions[1])
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	want := []string{
+		"envs/production/branch",
+		"envs/production/name",
+		"envs/production/notification_overrides/slack/webhook_url",
+		"envs/staging/branch",
+		"envs/staging/notification_overrides/slack/webhook_url",
+		"travis_token",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("config.DiffVersions(v1, v2) changed %q; want %q", paths, want)
+	}
+	for _, c := range changes {
+		if c.Path == "envs/staging/branch" && (c.From != "master" || c.To != "release") {
+			t.Errorf("change of %s = %#v; want master to release", c.Path, c)
+		}
+		if c.Path == "envs/production/branch" && c.From != nil {
+			t.Errorf("change of %s = %#v; want an addition", c.Path, c)
+		}
+	}
+}
+
+func TestRecordVersionEncryptsSecrets(t *testing.T) {
+	k, err := config.NewKeyring(oldMasterKey)
+	if err != nil {
+		t.Fatalf("config.NewKeyring(...) failed with %v", err)
+	}
+	config.SetKeyring(k)
+	defer config.SetKeyring(nil)
+
+	s := memStore{values: make(map[string]string)}
+	if _, err := config.RecordVersion(s, historyTestConfig("travis-secret-1", "master", "staging"), "api", "alice", "", now); err != nil {
+		t.Fatalf("config.RecordVersion(s, c, %q, ...) failed with %v", "api", err)
+	}
+	for k, v := range s.values {
+		if strings.Contains(v, "travis-secret") {
+			t.Errorf("%s = %s; want no plaintext secrets", k, v)
+		}
+	}
+}
+
+func TestRollbackProject(t *testing.T) {
+	s := memStore{values: make(map[string]string)}
+	old := historyTestConfig("travis-secret-1", "master", "staging")
+	if err := config.Store(s, old); err != nil {
+		t.Fatalf("config.Store(s, old) failed with %v", err)
+	}
+	if _, err := config.RecordVersion(s, old, "api", "alice", "", now); err != nil {
+		t.Fatalf("config.RecordVersion(s, old, ...) failed with %v", err)
+	}
+	cur := historyTestConfig("travis-secret-2", "release", "staging", "production")
+	cur.Projects[0].Environments[0].Lock, cur.Projects[0].Environments[0].Comment = &config.EnvironmentLock{By: "bob", Since: now}, "freeze"
+	if err := config.Store(s, cur); err != nil {
+		t.Fatalf("config.Store(s, cur) failed with %v", err)
+	}
+	if _, err := config.RecordVersion(s, cur, "api", "bob", "", now.Add(time.Hour)); err != nil {
+		t.Fatalf("config.RecordVersion(s, cur, ...) failed with %v", err)
+	}
+
+	v, err := config.RollbackProject(s, cur, "api", 1, "carol", now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("config.RollbackProject(s, cur, %q, 1, ...) failed with %v", "api", err)
+	}
+	if v.Version != 3 || v.Author != "carol" || v.Summary != "rolled back to version 1" {
+		t.Errorf("config.RollbackProject(...) = %#v; want version 3 by carol", v)
+	}
+	if cur.Projects[0].TravisToken != "travis-secret-2" {
+		t.Errorf("travis_token of the given config = %q; want it untouched", cur.Projects[0].TravisToken)
+	}
+
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	p, err := config.ProjectFromName(c.Projects, "api")
+	if err != nil {
+		t.Fatalf("config.ProjectFromName(c.Projects, %q) failed with %v", "api", err)
+	}
+	if p.TravisToken != "travis-secret-1" || len(p.Environments) != 1 {
+		t.Fatalf("api = %#v; want version 1 with the secret restored", p)
+	}
+	env := p.Environments[0]
+	if env.Branch != "master" || env.NotificationOverrides[config.NotifyTargetSlack].WebhookURL != "https://hooks.slack.com/services/travis-secret-1" {
+		t.Errorf("staging = %#v; want version 1", env)
+	}
+	if !env.IsLocked() || env.Lock.By != "bob" || env.Comment != "freeze" {
+		t.Errorf("staging = %#v; want the lock kept", env)
+	}
+
+	versions, err := config.ConfigHistory(s, "api")
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("config.ConfigHistory(s, %q) = %d versions, %v; want 3", "api", len(versions), err)
+	}
+	if changes := config.DiffVersions(versions[0], versions[2]); len(changes) != 3 {
+		t.Errorf("config.DiffVersions(v1, v3) = %#v; want only the lock and the comment", changes)
+	}
+	if _, err := config.RollbackProject(s, c, "api", 7, "carol", now); config.Cause(err) != config.ErrVersionNotFound {
+		t.Errorf("config.RollbackProject(s, c, %q, 7, ...) failed with %v; want %v", "api", err, config.ErrVersionNotFound)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import "time"
+
+// HookPolicy is what a deployment does when one of its hooks fails.
+type HookPolicy string
+
+const (
+	// HookFail aborts the deployment before the deploy command if a pre-deploy hook fails,
+	// and fails the deployment if a post-deploy hook fails. It is the default.
+	HookFail HookPolicy = "fail"
+	// HookAdvisory only records the failure of the hook. The deployment goes on as if it had succeeded.
+	HookAdvisory HookPolicy = "advisory"
+)
+
+// defaultHookTimeout is how long a hook can run unless specified.
+const defaultHookTimeout = 5 * time.Minute
+
+// Hook is a command run before or after the deploy command of an environment,
+// e.g. to show a maintenance page or to run smoke tests.
+type Hook struct {
+	// Command is the program and arguments of the hook, which can contain the same placeholders as DeployCommand.
+	Command []string `json:"command" yaml:"command"`
+	// TimeoutSeconds is how long the hook can run before it is killed and fails. It defaults to 5 minutes.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+	// OnFailure is either HookFail (default) or HookAdvisory.
+	OnFailure HookPolicy `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+}
+
+// Timeout returns how long the hook can run.
+func (h Hook) Timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return defaultHookTimeout
+}
+
+// Advisory returns true if failures of the hook do not affect the deployment.
+func (h Hook) Advisory() bool {
+	return h.OnFailure == HookAdvisory
+}
+
+// Argv returns the program and arguments of the hook rendered with "p" like Environment.DeployArgv.
+func (h Hook) Argv(p DeployParams) ([]string, error) {
+	return renderArgv(h.Command, p)
+}
+
+// validate returns an error if the hook "name" of the environment "env" is malformed. A nil hook is valid.
+func (h *Hook) validate(name, env string) error {
+	if h == nil {
+		return nil
+	}
+	if len(h.Command) == 0 {
+		return errorf(ErrInvalid, "%s of %s has no command", name, env)
+	}
+	if h.TimeoutSeconds < 0 {
+		return errorf(ErrInvalid, "negative timeout_seconds of %s in %s", name, env)
+	}
+	switch h.OnFailure {
+	case "", HookFail, HookAdvisory:
+	default:
+		return errorf(ErrInvalid, "invalid on_failure %q of %s in %s", h.OnFailure, name, env)
+	}
+	if _, err := h.Argv(DeployParams{}); err != nil {
+		return errorf(ErrInvalid, "invalid command of %s in %s: %v", name, env, err)
+	}
+	return nil
+}
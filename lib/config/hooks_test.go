@@ -0,0 +1,56 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestLoadHooks(t *testing.T) {
+	for _, spec := range []struct {
+		pre, post *config.Hook
+		// msg is a part of the error, or empty if valid.
+		msg string
+	}{
+		{},
+		{
+			pre:  &config.Hook{Command: []string{"/usr/local/bin/maintenance", "on", "{{.Environment}}"}, OnFailure: config.HookFail},
+			post: &config.Hook{Command: []string{"/usr/local/bin/smoke", "{{.Revision}}"}, TimeoutSeconds: 60, OnFailure: config.HookAdvisory},
+		},
+		{pre: &config.Hook{}, msg: "pre_deploy of production has no command"},
+		{post: &config.Hook{Command: []string{"/bin/true"}, TimeoutSeconds: -1}, msg: "negative timeout_seconds of post_deploy"},
+		{post: &config.Hook{Command: []string{"/bin/true"}, OnFailure: "ignore"}, msg: `invalid on_failure "ignore"`},
+		{pre: &config.Hook{Command: []string{"{{.Unknown}}"}}, msg: "invalid command of pre_deploy"},
+	} {
+		s := memStore{values: make(map[string]string)}
+		env := config.Environment{Name: "production", Branch: "master", Deploy: "/bin/true", PreDeploy: spec.pre, PostDeploy: spec.post}
+		proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{env}}
+		if err := config.Store(s, config.Config{Projects: []config.Project{proj}}); err != nil {
+			t.Fatalf("config.Store(s, cfg) failed with %v", err)
+		}
+		results, err := config.Lint(s, config.LintOptions{})
+		if err != nil {
+			t.Fatalf("config.Lint(s, opts) failed with %v", err)
+		}
+		if spec.msg == "" {
+			if len(results) != 1 || len(results[0].Problems) != 0 {
+				t.Errorf("config.Lint(s, opts) = %#v with hooks %#v and %#v; want no problems", results, spec.pre, spec.post)
+			}
+			continue
+		}
+		if len(results) != 1 || len(results[0].Problems) != 1 || !strings.Contains(results[0].Problems[0], spec.msg) {
+			t.Errorf("config.Lint(s, opts) = %#v with hooks %#v and %#v; want a problem with %q", results, spec.pre, spec.post, spec.msg)
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	if got, want := (config.Hook{}).Timeout(), 5*time.Minute; got != want {
+		t.Errorf("Timeout() = %s by default; want %s", got, want)
+	}
+	if got, want := (config.Hook{TimeoutSeconds: 30}).Timeout(), 30*time.Second; got != want {
+		t.Errorf("Timeout() = %s; want %s", got, want)
+	}
+}
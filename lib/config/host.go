@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Host is a deploy target host in an environment.
+// It is marshaled into a plain host name if it has no tags, so that configs without tags stay compatible.
+type Host struct {
+	Name string            `json:"name" yaml:"name"`
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// SSH overrides the SSH auth of the environment for this host.
+	SSH *SSHAuth `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+}
+
+// hostFields has the same fields as Host, but without the custom (un)marshalers.
+type hostFields struct {
+	Name string            `json:"name" yaml:"name"`
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	SSH  *SSHAuth          `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h Host) MarshalJSON() ([]byte, error) {
+	if len(h.Tags) == 0 && h.SSH == nil {
+		return json.Marshal(h.Name)
+	}
+	return json.Marshal(hostFields(h))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either a host name or an object with name and tags.
+func (h *Host) UnmarshalJSON(buf []byte) error {
+	var name string
+	if err := json.Unmarshal(buf, &name); err == nil {
+		*h = Host{Name: name}
+		return nil
+	}
+	var f hostFields
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return err
+	}
+	*h = Host(f)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (h Host) MarshalYAML() (interface{}, error) {
+	if len(h.Tags) == 0 && h.SSH == nil {
+		return h.Name, nil
+	}
+	return hostFields(h), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. It accepts either a host name or a mapping with name and tags.
+func (h *Host) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*h = Host{Name: name}
+		return nil
+	}
+	var f hostFields
+	if err := unmarshal(&f); err != nil {
+		return err
+	}
+	*h = Host(f)
+	return nil
+}
+
+// SortedTags returns the tags of the host in the form of "key:value", ordered by keys.
+// If "keys" is not empty, only the tags with the keys are returned.
+func (h Host) SortedTags(keys []string) []string {
+	var tags []string
+	for k, v := range h.Tags {
+		if len(keys) > 0 && !containsString(keys, k) {
+			continue
+		}
+		tags = append(tags, fmt.Sprintf("%s:%s", k, v))
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// HostNames returns the names of "hosts".
+func HostNames(hosts []Host) []string {
+	names := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+// TagSelector selects hosts by their tags.
+// A host matches the selector iff it has all the tags in the selector.
+// An empty value in the selector matches any value of the key.
+type TagSelector map[string]string
+
+// ParseTagSelector parses selectors in the form of "key:value" or "key".
+func ParseTagSelector(specs []string) (TagSelector, error) {
+	s := make(TagSelector)
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, ":", 2)
+		k := strings.TrimSpace(kv[0])
+		if k == "" {
+			return nil, errorf(ErrInvalid, "invalid tag selector %q", spec)
+		}
+		var v string
+		if len(kv) == 2 {
+			v = strings.TrimSpace(kv[1])
+		}
+		s[k] = v
+	}
+	return s, nil
+}
+
+// Matches returns true iff "h" matches the selector.
+func (s TagSelector) Matches(h Host) bool {
+	for k, v := range s {
+		actual, ok := h.Tags[k]
+		if !ok || (v != "" && actual != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectHosts returns the hosts in "hosts" which match the selector.
+func (s TagSelector) SelectHosts(hosts []Host) []Host {
+	if len(s) == 0 {
+		return hosts
+	}
+	var selected []Host
+	for _, h := range hosts {
+		if s.Matches(h) {
+			selected = append(selected, h)
+		}
+	}
+	return selected
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
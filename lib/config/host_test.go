@@ -0,0 +1,114 @@
+package config_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestUnmarshalHosts(t *testing.T) {
+	want := []config.Host{
+		{Name: "host1"},
+		{Name: "host2", Tags: map[string]string{"role": "web", "az": "a"}},
+	}
+
+	var got []config.Host
+	j := `["host1", {"name": "host2", "tags": {"role": "web", "az": "a"}}]`
+	if err := json.Unmarshal([]byte(j), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v", j, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Unmarshal(%q) = %#v; want %#v", j, got, want)
+	}
+
+	got = nil
+	y := "- host1\n- name: host2\n  tags:\n    role: web\n    az: a\n"
+	if err := yaml.Unmarshal([]byte(y), &got); err != nil {
+		t.Fatalf("yaml.Unmarshal(%q) failed with %v", y, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("yaml.Unmarshal(%q) = %#v; want %#v", y, got, want)
+	}
+}
+
+func TestMarshalHosts(t *testing.T) {
+	hosts := []config.Host{
+		{Name: "host1"},
+		{Name: "host2", Tags: map[string]string{"role": "web"}},
+	}
+	buf, err := json.Marshal(hosts)
+	if err != nil {
+		t.Fatalf("json.Marshal(%#v) failed with %v", hosts, err)
+	}
+	if got, want := string(buf), `["host1",{"name":"host2","tags":{"role":"web"}}]`; got != want {
+		t.Errorf("json.Marshal(%#v) = %s; want %s", hosts, got, want)
+	}
+}
+
+func TestParseTagSelector(t *testing.T) {
+	for _, spec := range []struct {
+		specs []string
+		want  config.TagSelector
+	}{
+		{specs: nil, want: config.TagSelector{}},
+		{specs: []string{"role:web"}, want: config.TagSelector{"role": "web"}},
+		{specs: []string{"role:web", "az:a"}, want: config.TagSelector{"role": "web", "az": "a"}},
+		{specs: []string{"canary"}, want: config.TagSelector{"canary": ""}},
+		{specs: []string{"url:http://example.com"}, want: config.TagSelector{"url": "http://example.com"}},
+	} {
+		got, err := config.ParseTagSelector(spec.specs)
+		if err != nil {
+			t.Errorf("config.ParseTagSelector(%q) failed with %v; want success", spec.specs, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.ParseTagSelector(%q) = %v; want %v", spec.specs, got, spec.want)
+		}
+	}
+
+	for _, specs := range [][]string{{""}, {":web"}} {
+		if got, err := config.ParseTagSelector(specs); err == nil {
+			t.Errorf("config.ParseTagSelector(%q) = %v; want failure", specs, got)
+		}
+	}
+}
+
+func TestTagSelectorMatches(t *testing.T) {
+	web := config.Host{Name: "web1", Tags: map[string]string{"role": "web", "az": "a"}}
+	db := config.Host{Name: "db1", Tags: map[string]string{"role": "db", "az": "a", "canary": "true"}}
+	bare := config.Host{Name: "bare"}
+	for _, spec := range []struct {
+		sel  config.TagSelector
+		want []string
+	}{
+		{sel: config.TagSelector{}, want: []string{"web1", "db1", "bare"}},
+		{sel: config.TagSelector{"role": "web"}, want: []string{"web1"}},
+		{sel: config.TagSelector{"az": "a"}, want: []string{"web1", "db1"}},
+		{sel: config.TagSelector{"az": "a", "role": "db"}, want: []string{"db1"}},
+		{sel: config.TagSelector{"az": "b", "role": "db"}, want: []string{}},
+		{sel: config.TagSelector{"canary": ""}, want: []string{"db1"}},
+	} {
+		got := config.HostNames(spec.sel.SelectHosts([]config.Host{web, db, bare}))
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("%v.SelectHosts(...) = %q; want %q", spec.sel, got, spec.want)
+		}
+	}
+}
+
+func TestSortedTags(t *testing.T) {
+	h := config.Host{Name: "web1", Tags: map[string]string{"role": "web", "az": "a", "rack": "12"}}
+	for _, spec := range []struct {
+		keys []string
+		want []string
+	}{
+		{keys: nil, want: []string{"az:a", "rack:12", "role:web"}},
+		{keys: []string{"role", "az"}, want: []string{"az:a", "role:web"}},
+	} {
+		if got := h.SortedTags(spec.keys); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("h.SortedTags(%q) = %q; want %q", spec.keys, got, spec.want)
+		}
+	}
+}
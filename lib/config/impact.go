@@ -0,0 +1,283 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImpactDirection is how an environment relates to the project whose impact is evaluated.
+type ImpactDirection string
+
+const (
+	// ImpactDependent is an environment which depends on the project, i.e. which deploying the project may break.
+	ImpactDependent ImpactDirection = "dependent"
+	// ImpactDependency is an environment which the project depends on, i.e. which must be in place before deploying the project.
+	ImpactDependency ImpactDirection = "dependency"
+)
+
+// Impact is the environments of other projects which deploying a project affects, through DependsOn and Impacts of the projects.
+type Impact struct {
+	Project      string                `json:"project"`
+	Environments []ImpactedEnvironment `json:"environments"`
+	// Problems are the cycles and the unknown references found while walking the dependencies, which do not stop the walk.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ImpactedEnvironment is an environment in an Impact with the status which matters before deploying, i.e. its lock and its next scheduled deployment.
+type ImpactedEnvironment struct {
+	Project     string          `json:"project"`
+	Environment string          `json:"environment"`
+	Direction   ImpactDirection `json:"direction"`
+	// Path is the chain of the references walked from the project to the environment, e.g. ["lib/production", "api/production"].
+	Path   []string         `json:"path"`
+	Locked bool             `json:"locked"`
+	Lock   *EnvironmentLock `json:"lock,omitempty"`
+	// NextSchedule is when the earliest enabled schedule of the environment deploys it next, if any.
+	NextSchedule *time.Time `json:"next_schedule,omitempty"`
+}
+
+// label returns "r" for paths, which is only the project for the project itself as a source of Impacts.
+func (r EnvironmentRef) label() string {
+	if r.Environment == "" {
+		return r.Project
+	}
+	return r.String()
+}
+
+// impactGraph is the edges between environments where deploying the source may affect the target.
+type impactGraph struct {
+	projects   []Project
+	dependents map[EnvironmentRef][]EnvironmentRef
+	// dependencies are the edges reversed.
+	dependencies map[EnvironmentRef][]EnvironmentRef
+	problems     []string
+	// cycles are the members of the cycles already reported, so that a cycle found in both directions is reported once.
+	cycles map[string]bool
+}
+
+func newImpactGraph(projects []Project) *impactGraph {
+	g := &impactGraph{
+		projects:     projects,
+		dependents:   make(map[EnvironmentRef][]EnvironmentRef),
+		dependencies: make(map[EnvironmentRef][]EnvironmentRef),
+		cycles:       make(map[string]bool),
+	}
+	for _, p := range projects {
+		for _, e := range p.Environments {
+			to := EnvironmentRef{Project: p.Name, Environment: e.Name}
+			for _, dep := range e.DependsOn {
+				from, err := ParseEnvironmentRef(dep)
+				if err != nil {
+					g.problems = append(g.problems, err.Error())
+					continue
+				}
+				if _, _, err := EnvironmentFromName(projects, from.Project, from.Environment); err != nil {
+					g.problems = append(g.problems, "unknown environment "+dep+" in depends_on of "+to.String())
+					continue
+				}
+				g.add(from, to)
+			}
+		}
+		// the project itself is a source of Impacts too, so that projects without environments like libraries have impacts.
+		sources := []EnvironmentRef{{Project: p.Name}}
+		for _, e := range p.Environments {
+			sources = append(sources, EnvironmentRef{Project: p.Name, Environment: e.Name})
+		}
+		for _, ref := range p.Impacts {
+			targets, err := g.resolve(ref)
+			if err != nil {
+				g.problems = append(g.problems, err.Error()+" in impacts of "+p.Name)
+				continue
+			}
+			for _, from := range sources {
+				for _, to := range targets {
+					g.add(from, to)
+				}
+			}
+		}
+	}
+	for _, edges := range []map[EnvironmentRef][]EnvironmentRef{g.dependents, g.dependencies} {
+		for _, refs := range edges {
+			sort.Sort(environmentRefs(refs))
+		}
+	}
+	return g
+}
+
+func (g *impactGraph) add(from, to EnvironmentRef) {
+	g.dependents[from] = append(g.dependents[from], to)
+	g.dependencies[to] = append(g.dependencies[to], from)
+}
+
+// resolve returns the environments which "ref" in Impacts refers to, i.e. all the environments of a project or one in the form of "project/env".
+func (g *impactGraph) resolve(ref string) ([]EnvironmentRef, error) {
+	if !strings.Contains(ref, "/") {
+		p, err := ProjectFromName(g.projects, ref)
+		if err != nil {
+			return nil, errorf(ErrInvalid, "unknown project %s", ref)
+		}
+		var refs []EnvironmentRef
+		for _, e := range p.Environments {
+			refs = append(refs, EnvironmentRef{Project: p.Name, Environment: e.Name})
+		}
+		return refs, nil
+	}
+	r, err := ParseEnvironmentRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := EnvironmentFromName(g.projects, r.Project, r.Environment); err != nil {
+		return nil, errorf(ErrInvalid, "unknown environment %s", ref)
+	}
+	return []EnvironmentRef{r}, nil
+}
+
+// walk visits the environments reachable from "start" along "edges" in depth-first order, and returns the path to each of them.
+// Cycles are added to the problems of "g" with "arrow" between their members instead of being followed.
+func (g *impactGraph) walk(start []EnvironmentRef, edges map[EnvironmentRef][]EnvironmentRef, arrow string) map[EnvironmentRef][]string {
+	paths := make(map[EnvironmentRef][]string)
+	// state is 1 while visiting the environments after an environment, and 2 after that.
+	state := make(map[EnvironmentRef]int)
+	var visit func(ref EnvironmentRef, path []string)
+	visit = func(ref EnvironmentRef, path []string) {
+		path = append(path, ref.label())
+		switch state[ref] {
+		case 1:
+			cycle := path[indexOf(path, ref.label()):]
+			members := append([]string(nil), cycle[1:]...)
+			sort.Strings(members)
+			if key := strings.Join(members, " "); !g.cycles[key] {
+				g.cycles[key] = true
+				g.problems = append(g.problems, "dependency cycle: "+strings.Join(cycle, arrow))
+			}
+			return
+		case 2:
+			return
+		}
+		state[ref] = 1
+		if _, ok := paths[ref]; !ok {
+			paths[ref] = append([]string(nil), path...)
+		}
+		for _, next := range edges[ref] {
+			visit(next, path)
+		}
+		state[ref] = 2
+	}
+	for _, ref := range start {
+		visit(ref, nil)
+	}
+	return paths
+}
+
+// indexOf returns the first index of "s" in "list".
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// ProjectImpact returns the environments of other projects which depend on "proj" or which "proj" depends on, directly or not,
+// through DependsOn of environments and Impacts of projects, with their status at "now".
+// Cycles and unknown references are reported in Problems instead of failing, since they should not hide the rest of the impact.
+func ProjectImpact(projects []Project, proj string, now time.Time) (Impact, error) {
+	p, err := ProjectFromName(projects, proj)
+	if err != nil {
+		return Impact{}, err
+	}
+	g := newImpactGraph(projects)
+	imp := Impact{Project: p.Name, Environments: []ImpactedEnvironment{}}
+	for _, spec := range []struct {
+		direction ImpactDirection
+		edges     map[EnvironmentRef][]EnvironmentRef
+		arrow     string
+	}{
+		{direction: ImpactDependent, edges: g.dependents, arrow: " -> "},
+		{direction: ImpactDependency, edges: g.dependencies, arrow: " <- "},
+	} {
+		paths := g.walk(sourcesOf(p), spec.edges, spec.arrow)
+		refs := othersIn(paths, p.Name)
+		for _, ref := range refs {
+			_, e, err := EnvironmentFromName(projects, ref.Project, ref.Environment)
+			if err != nil {
+				continue
+			}
+			imp.Environments = append(imp.Environments, ImpactedEnvironment{
+				Project:      ref.Project,
+				Environment:  ref.Environment,
+				Direction:    spec.direction,
+				Path:         paths[ref],
+				Locked:       e.IsLocked(),
+				Lock:         e.Lock,
+				NextSchedule: nextSchedule(*e, now),
+			})
+		}
+	}
+	imp.Problems = g.problems
+	return imp, nil
+}
+
+// HasDependents returns true if any environment of another project depends on "proj" or is impacted by it.
+func HasDependents(projects []Project, proj string) bool {
+	p, err := ProjectFromName(projects, proj)
+	if err != nil {
+		return false
+	}
+	g := newImpactGraph(projects)
+	return len(othersIn(g.walk(sourcesOf(p), g.dependents, " -> "), p.Name)) > 0
+}
+
+// sourcesOf returns the environments of "p" and "p" itself, where walks about "p" start.
+func sourcesOf(p Project) []EnvironmentRef {
+	refs := []EnvironmentRef{{Project: p.Name}}
+	for _, e := range p.Environments {
+		refs = append(refs, EnvironmentRef{Project: p.Name, Environment: e.Name})
+	}
+	return refs
+}
+
+// othersIn returns the environments in "paths" of projects other than "proj" in order.
+func othersIn(paths map[EnvironmentRef][]string, proj string) []EnvironmentRef {
+	var refs []EnvironmentRef
+	for ref := range paths {
+		if ref.Project != proj && ref.Environment != "" {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Sort(environmentRefs(refs))
+	return refs
+}
+
+// nextSchedule returns when the enabled schedules of "env" deploy it next after "now", or nil if none is enabled.
+func nextSchedule(env Environment, now time.Time) *time.Time {
+	var next *time.Time
+	for _, s := range env.Schedules {
+		if !s.Enabled {
+			continue
+		}
+		expr, err := s.Expr()
+		if err != nil {
+			continue
+		}
+		t := expr.Next(now)
+		if next == nil || t.Before(*next) {
+			next = &t
+		}
+	}
+	return next
+}
+
+// environmentRefs sorts references by their projects and then environments.
+type environmentRefs []EnvironmentRef
+
+func (rs environmentRefs) Len() int      { return len(rs) }
+func (rs environmentRefs) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs environmentRefs) Less(i, j int) bool {
+	if rs[i].Project != rs[j].Project {
+		return rs[i].Project < rs[j].Project
+	}
+	return rs[i].Environment < rs[j].Environment
+}
@@ -0,0 +1,149 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+// impactFixture is a shared library "lib" without environments consumed by "api" and "worker",
+// whose production depends on the database, and "web" which depends on "api".
+func impactFixture() []config.Project {
+	projs := projectsWithDeps(map[string][]string{
+		"db/production":     nil,
+		"api/staging":       nil,
+		"api/production":    {"db/production"},
+		"worker/production": {"api/production"},
+		"web/production":    {"api/production"},
+		"admin/production":  nil,
+	})
+	projs = append(projs, config.Project{Name: "lib", Impacts: []string{"api", "worker/production"}})
+	for i := range projs {
+		if projs[i].Name != "web" {
+			continue
+		}
+		env := &projs[i].Environments[0]
+		env.Lock = &config.EnvironmentLock{By: "alice", Since: time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)}
+		env.Schedules = []config.Schedule{
+			{Cron: "0 2 * * *", Enabled: true},
+			{Cron: "0 1 * * *"},
+		}
+	}
+	return projs
+}
+
+// summarize returns the environments of "imp" in the form of "direction project/env via path".
+func summarize(imp config.Impact) []string {
+	var got []string
+	for _, e := range imp.Environments {
+		got = append(got, string(e.Direction)+" "+e.Project+"/"+e.Environment+" via "+strings.Join(e.Path, " "))
+	}
+	return got
+}
+
+func TestProjectImpact(t *testing.T) {
+	now := time.Date(2016, 5, 2, 12, 0, 0, 0, time.UTC)
+	projs := impactFixture()
+	for _, spec := range []struct {
+		proj string
+		want []string
+	}{
+		{
+			proj: "lib",
+			want: []string{
+				"dependent api/production via lib api/production",
+				"dependent api/staging via lib api/staging",
+				"dependent web/production via lib api/production web/production",
+				"dependent worker/production via lib api/production worker/production",
+			},
+		},
+		{
+			proj: "api",
+			want: []string{
+				"dependent web/production via api/production web/production",
+				"dependent worker/production via api/production worker/production",
+				"dependency db/production via api/production db/production",
+			},
+		},
+		{
+			proj: "web",
+			want: []string{
+				"dependency api/production via web/production api/production",
+				"dependency db/production via web/production api/production db/production",
+			},
+		},
+		{proj: "admin"},
+	} {
+		imp, err := config.ProjectImpact(projs, spec.proj, now)
+		if err != nil {
+			t.Errorf("config.ProjectImpact(projs, %q, now) failed with %v", spec.proj, err)
+			continue
+		}
+		if got := summarize(imp); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.ProjectImpact(projs, %q, now) = %q; want %q", spec.proj, got, spec.want)
+		}
+		if len(imp.Problems) != 0 {
+			t.Errorf("problems of config.ProjectImpact(projs, %q, now) = %q; want none", spec.proj, imp.Problems)
+		}
+		if got, want := config.HasDependents(projs, spec.proj), spec.proj == "lib" || spec.proj == "api"; got != want {
+			t.Errorf("config.HasDependents(projs, %q) = %t; want %t", spec.proj, got, want)
+		}
+	}
+
+	imp, err := config.ProjectImpact(projs, "api", now)
+	if err != nil {
+		t.Fatalf("config.ProjectImpact(projs, %q, now) failed with %v", "api", err)
+	}
+	web := imp.Environments[0]
+	if !web.Locked || web.Lock == nil || web.Lock.By != "alice" {
+		t.Errorf("web/production = %#v; want locked by alice", web)
+	}
+	if want := time.Date(2016, 5, 3, 2, 0, 0, 0, time.UTC); web.NextSchedule == nil || !web.NextSchedule.Equal(want) {
+		t.Errorf("next schedule of web/production = %v; want %v of the enabled schedule", web.NextSchedule, want)
+	}
+	if worker := imp.Environments[1]; worker.Locked || worker.NextSchedule != nil {
+		t.Errorf("worker/production = %#v; want neither locked nor scheduled", worker)
+	}
+
+	if _, err := config.ProjectImpact(projs, "missing", now); err == nil {
+		t.Errorf("config.ProjectImpact(projs, %q, now) succeeded; want an error", "missing")
+	}
+}
+
+func TestProjectImpactProblems(t *testing.T) {
+	projs := impactFixture()
+	for i := range projs {
+		switch projs[i].Name {
+		case "web":
+			projs[i].Impacts = []string{"lib2", "api/canary", "worker"}
+		case "worker":
+			projs[i].Impacts = []string{"web/production"}
+		}
+	}
+
+	imp, err := config.ProjectImpact(projs, "api", time.Now())
+	if err != nil {
+		t.Fatalf("config.ProjectImpact(projs, %q, now) failed with %v", "api", err)
+	}
+	want := []string{
+		"dependent web/production via api/production web/production",
+		"dependent worker/production via api/production web/production worker/production",
+		"dependency db/production via api/production db/production",
+	}
+	if got := summarize(imp); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.ProjectImpact(projs, %q, now) = %q; want %q despite the problems", "api", got, want)
+	}
+	var cycles int
+	for _, p := range imp.Problems {
+		if strings.HasPrefix(p, "dependency cycle: ") {
+			cycles++
+		}
+	}
+	joined := strings.Join(imp.Problems, "\n")
+	if cycles != 1 || !strings.Contains(joined, "unknown project lib2 in impacts of web") || !strings.Contains(joined, "unknown environment api/canary in impacts of web") {
+		t.Errorf("problems of config.ProjectImpact(projs, %q, now) = %q; want one cycle and the unknown references", "api", imp.Problems)
+	}
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckArg is the argument appended to deployment commands of environments with DeployCheck to check themselves.
+const CheckArg = "--goship-check"
+
+// defaultCheckTimeout is how long a self-check of a deployment command can take unless specified.
+const defaultCheckTimeout = 30 * time.Second
+
+// LintOptions configures Lint.
+type LintOptions struct {
+	// Path is the search path of programs in the form of $PATH. The PATH of goship is used if empty.
+	Path string
+	// SelfCheck runs the deployment commands of environments with DeployCheck with CheckArg.
+	SelfCheck bool
+	// CheckTimeout is how long a self-check can take. Defaults to 30 seconds.
+	CheckTimeout time.Duration
+
+	// scriptRepo means that the deployment command runs in a checkout of the script repo,
+	// where relative paths to programs cannot be checked until deploying.
+	scriptRepo bool
+}
+
+// LintResult is the result of linting an environment, or a project if it could not be loaded at all.
+type LintResult struct {
+	Project string
+	// Environment is empty if the problems are of the whole project.
+	Environment string
+	Problems    []string
+	// Check is the output of the self-check of the deployment command, if run.
+	Check string
+}
+
+func (r LintResult) String() string {
+	name := r.Project
+	if r.Environment != "" {
+		name = path.Join(r.Project, r.Environment)
+	}
+	if len(r.Problems) == 0 {
+		if r.Check != "" {
+			return fmt.Sprintf("%s: OK (check: %s)", name, r.Check)
+		}
+		return name + ": OK"
+	}
+	return fmt.Sprintf("%s: %s", name, strings.Join(r.Problems, "; "))
+}
+
+// Lint checks the configuration in "client" more thoroughly than Load. Unlike Load, projects which cannot be loaded
+// are reported instead of skipped, and the deployment commands of all the environments are checked with LintEnvironment.
+func Lint(client ETCDInterface, opts LintOptions) ([]LintResult, error) {
+	resp, err := client.Get("/goship/config", false, false)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(resp.Node.Value), &cfg); err != nil {
+		return nil, errorf(ErrInvalid, "malformed /goship/config: %v", err)
+	}
+	projs, err := client.Get("/goship/projects", false, true)
+	if err != nil {
+		return nil, err
+	}
+	var results []LintResult
+	for _, node := range projs.Node.Nodes {
+		proj, err := loadProject(node)
+		if err != nil {
+			results = append(results, LintResult{Project: path.Base(node.Key), Problems: []string{err.Error()}})
+			continue
+		}
+		cfg.Projects = append(cfg.Projects, proj)
+		envOpts := opts
+		envOpts.scriptRepo = proj.ScriptRepo != nil
+		for _, env := range proj.Environments {
+			r := LintEnvironment(env, envOpts)
+			r.Project = proj.Name
+			results = append(results, r)
+		}
+	}
+	if err := validateDependencies(cfg.Projects); err != nil {
+		results = append(results, LintResult{Project: "depends_on", Problems: []string{err.Error()}})
+	}
+	return results, nil
+}
+
+// LintEnvironment checks that the deployment command of "env" can be rendered, and that its program exists and is executable.
+// Shell commands are not checked beyond /bin/sh. It also checks that the SSH auth of the hosts can be resolved.
+func LintEnvironment(env Environment, opts LintOptions) LintResult {
+	r := LintResult{Environment: env.Name, Problems: lintSSHAuth(env)}
+	if len(env.DeployCommand) == 0 && strings.TrimSpace(env.Deploy) == "" {
+		r.Problems = append(r.Problems, "no deploy command")
+		return r
+	}
+	if err := env.validateDeployCommand(); err != nil {
+		r.Problems = append(r.Problems, err.Error())
+		return r
+	}
+	argv, err := env.DeployArgv(DeployParams{Environment: env.Name, Branch: env.Branch})
+	if err != nil {
+		r.Problems = append(r.Problems, err.Error())
+		return r
+	}
+	if opts.scriptRepo && strings.Contains(argv[0], "/") && !filepath.IsAbs(argv[0]) {
+		return r
+	}
+	if opts.Path == "" {
+		opts.Path = os.Getenv("PATH")
+	}
+	prog, err := lookProgram(argv[0], opts.Path)
+	if err != nil {
+		r.Problems = append(r.Problems, fmt.Sprintf("deploy command %q: %v", argv[0], err))
+		return r
+	}
+	if opts.SelfCheck && env.DeployCheck {
+		out, err := selfCheck(prog, argv[1:], opts.CheckTimeout)
+		if err != nil {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s failed: %v: %s", CheckArg, err, out))
+			return r
+		}
+		r.Check = "passed"
+		if out != "" {
+			r.Check += ": " + out
+		}
+	}
+	return r
+}
+
+// lookProgram returns the path to the program "name" like exec.LookPath searching "pathList",
+// but tells why the program cannot be run.
+func lookProgram(name, pathList string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, checkExecutable(name)
+	}
+	var found error
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			dir = "."
+		}
+		p := filepath.Join(dir, name)
+		err := checkExecutable(p)
+		if err == nil {
+			return p, nil
+		}
+		if found == nil && !os.IsNotExist(err) {
+			found = err
+		}
+	}
+	if found != nil {
+		return "", found
+	}
+	return "", fmt.Errorf("not found in PATH")
+}
+
+// checkExecutable returns an error if "p" is not an executable regular file.
+func checkExecutable(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.IsDir():
+		return fmt.Errorf("%s is a directory", p)
+	case fi.Mode()&0111 == 0:
+		return fmt.Errorf("%s is not executable (mode %s)", p, fi.Mode())
+	}
+	return nil
+}
+
+// selfCheck runs "prog" with "args" and CheckArg, and returns its trimmed output.
+func selfCheck(prog string, args []string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(prog, append(args, CheckArg)...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return strings.TrimSpace(out.String()), err
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-done
+		return strings.TrimSpace(out.String()), fmt.Errorf("timed out after %s", timeout)
+	}
+}
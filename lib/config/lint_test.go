@@ -0,0 +1,189 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+)
+
+// withBinDir runs "f" with a temporary directory which contains files of the names and permission bits in "files".
+func withBinDir(t *testing.T, files map[string]os.FileMode, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "goship-lint-")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, mode := range files {
+		p := filepath.Join(dir, name)
+		if mode.IsDir() {
+			if err := os.Mkdir(p, mode.Perm()); err != nil {
+				t.Fatalf("os.Mkdir(%q) failed with %v", p, err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(p, []byte("#!/bin/sh\necho \"$@\"\n"), mode); err != nil {
+			t.Fatalf("ioutil.WriteFile(%q) failed with %v", p, err)
+		}
+		// WriteFile is subject to umask
+		if err := os.Chmod(p, mode); err != nil {
+			t.Fatalf("os.Chmod(%q) failed with %v", p, err)
+		}
+	}
+	f(dir)
+}
+
+// checkLintProblem lints "cfg" in a new store. It expects a single problem which contains "msg", or none if "msg" is empty.
+func checkLintProblem(t *testing.T, cfg config.Config, msg string) {
+	s := memStore{values: make(map[string]string)}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	results, err := config.Lint(s, config.LintOptions{})
+	if err != nil {
+		t.Fatalf("config.Lint(s, opts) failed with %v", err)
+	}
+	var problems []string
+	for _, r := range results {
+		problems = append(problems, r.Problems...)
+	}
+	if msg == "" {
+		if len(problems) != 0 {
+			t.Errorf("config.Lint(s, opts) found %q; want no problems", problems)
+		}
+		return
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], msg) {
+		t.Errorf("config.Lint(s, opts) found %q; want a problem with %q", problems, msg)
+	}
+}
+
+func TestLintEnvironment(t *testing.T) {
+	files := map[string]os.FileMode{
+		"deploy":     0755,
+		"owner-only": 0700,
+		"noexec":     0644,
+		"subdir":     os.ModeDir | 0755,
+	}
+	withBinDir(t, files, func(dir string) {
+		opts := config.LintOptions{Path: dir}
+		for _, spec := range []struct {
+			env     config.Environment
+			problem string
+		}{
+			{env: config.Environment{Deploy: "deploy --env staging"}},
+			{env: config.Environment{DeployCommand: []string{"owner-only", "{{.Revision}}"}}},
+			{env: config.Environment{DeployCommand: []string{filepath.Join(dir, "deploy"), "{{.Hosts}}"}}},
+			{env: config.Environment{Deploy: "exit 1", Shell: true}},
+			{env: config.Environment{}, problem: "no deploy command"},
+			{env: config.Environment{Deploy: "dpeloy --env staging"}, problem: `"dpeloy": not found in PATH`},
+			{env: config.Environment{Deploy: "noexec"}, problem: "is not executable"},
+			{env: config.Environment{DeployCommand: []string{"subdir"}}, problem: "is a directory"},
+			{env: config.Environment{DeployCommand: []string{filepath.Join(dir, "missing")}}, problem: "no such file or directory"},
+			{env: config.Environment{DeployCommand: []string{filepath.Join(dir, "noexec")}}, problem: "is not executable"},
+			{env: config.Environment{DeployCommand: []string{"deploy", "{{.Revison}}"}}, problem: "invalid deploy_command"},
+		} {
+			spec.env.Name = "staging"
+			r := config.LintEnvironment(spec.env, opts)
+			if spec.problem == "" {
+				if len(r.Problems) != 0 {
+					t.Errorf("config.LintEnvironment(%#v, opts) = %q; want no problems", spec.env, r.Problems)
+				}
+				continue
+			}
+			if len(r.Problems) != 1 || !strings.Contains(r.Problems[0], spec.problem) {
+				t.Errorf("config.LintEnvironment(%#v, opts) = %q; want a problem with %q", spec.env, r.Problems, spec.problem)
+			}
+			if got := r.String(); !strings.HasPrefix(got, "staging: ") || !strings.Contains(got, spec.problem) {
+				t.Errorf("r.String() = %q; want the environment with its problem", got)
+			}
+		}
+	})
+}
+
+func TestLintEnvironmentSelfCheck(t *testing.T) {
+	withBinDir(t, map[string]os.FileMode{"deploy": 0755}, func(dir string) {
+		failing := filepath.Join(dir, "failing")
+		if err := ioutil.WriteFile(failing, []byte("#!/bin/sh\necho missing credentials\nexit 2\n"), 0755); err != nil {
+			t.Fatalf("ioutil.WriteFile(%q) failed with %v", failing, err)
+		}
+		if err := os.Chmod(failing, 0755); err != nil {
+			t.Fatalf("os.Chmod(%q) failed with %v", failing, err)
+		}
+
+		env := config.Environment{Name: "staging", DeployCommand: []string{"deploy", "{{.Environment}}"}, DeployCheck: true}
+		r := config.LintEnvironment(env, config.LintOptions{Path: dir, SelfCheck: true})
+		if len(r.Problems) != 0 || r.Check != "passed: staging "+config.CheckArg {
+			t.Errorf("config.LintEnvironment(%#v, opts) = %#v; want passed with the output", env, r)
+		}
+		// commands run only if they support the check.
+		env.DeployCheck = false
+		if r := config.LintEnvironment(env, config.LintOptions{Path: dir, SelfCheck: true}); r.Check != "" {
+			t.Errorf("config.LintEnvironment(%#v, opts).Check = %q; want not run", env, r.Check)
+		}
+
+		env = config.Environment{Name: "production", Deploy: "failing", DeployCheck: true}
+		r = config.LintEnvironment(env, config.LintOptions{Path: dir, SelfCheck: true})
+		if len(r.Problems) != 1 || !strings.Contains(r.Problems[0], "missing credentials") {
+			t.Errorf("config.LintEnvironment(%#v, opts) = %#v; want failure with the output", env, r)
+		}
+	})
+}
+
+func TestLint(t *testing.T) {
+	withBinDir(t, map[string]os.FileMode{"deploy": 0755}, func(dir string) {
+		ecl := mockEtcdClient{
+			getExpectation: map[string]*etcd.Node{
+				"/goship/config": {Key: "/goship/config", Value: `{"deploy_user": "deployer"}`},
+				"/goship/projects": {
+					Key: "/goship/projects",
+					Dir: true,
+					Nodes: etcd.Nodes{
+						{
+							Key: "/goship/projects/api",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/goship/projects/api/config", Value: `{"repo_owner": "gengo", "repo_name": "api"}`},
+								{
+									Key: "/goship/projects/api/environments",
+									Dir: true,
+									Nodes: etcd.Nodes{
+										{Key: "/goship/projects/api/environments/production", Value: `{"deploy": "deploy production"}`},
+										{Key: "/goship/projects/api/environments/staging", Value: `{"deploy": "depoly staging"}`},
+									},
+								},
+							},
+						},
+						{
+							Key: "/goship/projects/broken",
+							Dir: true,
+							Nodes: etcd.Nodes{
+								{Key: "/goship/projects/broken/config", Value: `{"repo_type": "svn"}`},
+							},
+						},
+					},
+				},
+			},
+		}
+		results, err := config.Lint(ecl, config.LintOptions{Path: dir})
+		if err != nil {
+			t.Fatalf("config.Lint(ecl, opts) failed with %v", err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.String())
+		}
+		want := []string{
+			"api/production: OK",
+			`api/staging: deploy command "depoly": not found in PATH`,
+			`broken: invalid repo_type "svn"`,
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("config.Lint(ecl, opts) = %q; want %q", got, want)
+		}
+	})
+}
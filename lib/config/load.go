@@ -1,8 +1,6 @@
 package config
 
 import (
-	"encoding/json"
-	"fmt"
 	"path"
 
 	"github.com/coreos/go-etcd/etcd"
@@ -15,14 +13,24 @@ func Load(client ETCDInterface) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	// unmarshals into a new value so that invalid settings never partially take effect.
 	var cfg Config
-	if err := json.Unmarshal([]byte(resp.Node.Value), &cfg); err != nil {
+	if err := unmarshalSecrets([]byte(resp.Node.Value), &cfg, keyring); err != nil {
 		glog.Errorf("Failed to unmarshal %s: %v", resp.Node.Value, err)
-		return Config{}, err
+		var ok bool
+		if cfg, ok = fallback.invalidGlobal(err); !ok {
+			return Config{}, err
+		}
+		glog.Errorf("Keeping the last valid global settings: %v", err)
+	} else {
+		cfg = fallback.loadedGlobal(cfg)
 	}
 	if err := loadProjects(client, &cfg, "/goship"); err != nil {
 		return Config{}, err
 	}
+	if err := validateDependencies(cfg.Projects); err != nil {
+		return Config{}, err
+	}
 	glog.V(2).Infof("Loaded config: %#v", cfg)
 	return cfg, nil
 }
@@ -33,16 +41,26 @@ func loadProjects(client ETCDInterface, cfg *Config, basePath string) error {
 		return err
 	}
 	if !projs.Node.Dir {
-		return fmt.Errorf("node %s must be a directory", projs.Node.Key)
+		return errorf(ErrInvalid, "node %s must be a directory", projs.Node.Key)
 	}
+	names := make(map[string]bool)
 	for _, node := range projs.Node.Nodes {
+		name := path.Base(node.Key)
+		names[name] = true
 		proj, err := loadProject(node)
 		if err != nil {
-			glog.Errorf("Skipping Project %s: %v", path.Base(node.Key), err)
-			continue
+			var ok bool
+			if proj, ok = fallback.invalidProject(name, err); !ok {
+				glog.Errorf("Skipping Project %s: %v", name, err)
+				continue
+			}
+			glog.Errorf("Keeping the last valid definition of Project %s: %v", name, err)
+		} else {
+			fallback.loadedProject(proj)
 		}
 		cfg.Projects = append(cfg.Projects, proj)
 	}
+	fallback.retain(names)
 	return nil
 }
 
@@ -53,7 +71,7 @@ func loadProject(node *etcd.Node) (Project, error) {
 	for _, child := range node.Nodes {
 		switch path.Base(child.Key) {
 		case "config":
-			if err := json.Unmarshal([]byte(child.Value), &proj); err != nil {
+			if err := unmarshalSecrets([]byte(child.Value), &proj, keyring); err != nil {
 				glog.Errorf("Failed to unmarshal %s: %v", child.Value, err)
 				return Project{}, err
 			}
@@ -65,28 +83,64 @@ func loadProject(node *etcd.Node) (Project, error) {
 		proj.HostType = HostTypeNode
 	}
 	if !proj.HostType.Valid() {
-		return Project{}, fmt.Errorf("invalid host_type %q", proj.HostType)
+		return Project{}, errorf(ErrInvalid, "invalid host_type %q", proj.HostType)
 	}
 	if proj.RepoType == "" {
 		proj.RepoType = RepoTypeGithub
 	}
 	if !proj.RepoType.Valid() {
-		return Project{}, fmt.Errorf("invalid repo_type %q", proj.RepoType)
+		return Project{}, errorf(ErrInvalid, "invalid repo_type %q", proj.RepoType)
 	}
 	if proj.RepoType == RepoTypeDocker && proj.Source == nil {
-		return Project{}, fmt.Errorf("source repo not configured in %s", name)
+		return Project{}, errorf(ErrInvalid, "source repo not configured in %s", name)
 	}
 
 	proj.Name = name
+	if err := proj.validateRepos(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.validateURLTemplates(); err != nil {
+		return Project{}, err
+	}
+	if proj.ScriptRepo != nil && proj.ScriptRepo.URL == "" {
+		return Project{}, errorf(ErrInvalid, "url of script_repo of %s not configured", name)
+	}
+	if err := proj.PivotalFirstDeploy.validate(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.CommitAge.validate(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.Risk.validate(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.validatePluginColumns(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.validateColumns(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.validateEphemeralRules(); err != nil {
+		return Project{}, err
+	}
+	if err := validateNotificationOverrides(proj.NotificationOverrides, name); err != nil {
+		return Project{}, err
+	}
 	if err := loadEnvironments(envs, &proj); err != nil {
 		return Project{}, err
 	}
+	if err := proj.validateEnvironmentColumns(); err != nil {
+		return Project{}, err
+	}
+	if err := proj.validateBakeRequirements(); err != nil {
+		return Project{}, err
+	}
 	return proj, nil
 }
 
 func loadEnvironments(node *etcd.Node, proj *Project) error {
 	if !node.Dir {
-		return fmt.Errorf("node %s must be a directory", node.Key)
+		return errorf(ErrInvalid, "node %s must be a directory", node.Key)
 	}
 	for _, child := range node.Nodes {
 		env, err := loadEnvironment(child)
@@ -100,13 +154,62 @@ func loadEnvironments(node *etcd.Node, proj *Project) error {
 
 func loadEnvironment(node *etcd.Node) (Environment, error) {
 	var env Environment
-	if err := json.Unmarshal([]byte(node.Value), &env); err != nil {
+	if err := unmarshalSecrets([]byte(node.Value), &env, keyring); err != nil {
 		glog.Errorf("Failed to unmarshal %s: %v", node.Value, err)
 		return Environment{}, err
 	}
+	if err := applyLegacyLock([]byte(node.Value), &env); err != nil {
+		return Environment{}, err
+	}
 	env.Name = path.Base(node.Key)
 	if env.Branch == "" {
 		env.Branch = "master"
 	}
+	for _, ev := range env.PivotalEvents {
+		if !ev.Valid() {
+			return Environment{}, errorf(ErrInvalid, "invalid pivotal_events %q in %s", ev, env.Name)
+		}
+	}
+	if err := env.validateDeployCommand(); err != nil {
+		return Environment{}, err
+	}
+	if err := env.validateWorkDir(); err != nil {
+		return Environment{}, err
+	}
+	if err := env.validatePreflight(); err != nil {
+		return Environment{}, err
+	}
+	if err := env.validateRevisionSource(); err != nil {
+		return Environment{}, err
+	}
+	if err := env.Release.validate(env.Name); err != nil {
+		return Environment{}, err
+	}
+	if err := env.PreDeploy.validate("pre_deploy", env.Name); err != nil {
+		return Environment{}, err
+	}
+	if err := env.PostDeploy.validate("post_deploy", env.Name); err != nil {
+		return Environment{}, err
+	}
+	if err := env.validateSchedules(); err != nil {
+		return Environment{}, err
+	}
+	if err := env.StatusThresholds.validate(env.Name); err != nil {
+		return Environment{}, err
+	}
+	if err := normalizeHosts(env.Hosts); err != nil {
+		return Environment{}, errorf(ErrInvalid, "invalid hosts in %s: %v", env.Name, err)
+	}
+	if err := env.SSH.validate(env.Name); err != nil {
+		return Environment{}, err
+	}
+	for _, h := range env.Hosts {
+		if err := h.SSH.validate(h.Name + " in " + env.Name); err != nil {
+			return Environment{}, err
+		}
+	}
+	if err := validateNotificationOverrides(env.NotificationOverrides, env.Name); err != nil {
+		return Environment{}, err
+	}
 	return env, nil
 }
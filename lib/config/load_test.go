@@ -53,7 +53,7 @@ func TestLoad(t *testing.T) {
 											{
 												"deploy": "deploy-command",
 												"repo_path": "/path/to/prod",
-												"hosts": [ "host1", "host2", "host3" ]
+												"hosts": [ "host1", "host2", "host3", "2001:DB8::1", "[2001:db8::2]:2222" ]
 											}
 										`,
 									},
@@ -74,7 +74,8 @@ func TestLoad(t *testing.T) {
 		DeployUser: "test_user",
 		Notify:     "notify-command",
 		Pivotal: &config.PivotalConfiguration{
-			Token: "pivotal token",
+			Token:   "pivotal token",
+			Project: "11111",
 		},
 		Projects: []config.Project{
 			{
@@ -91,7 +92,11 @@ func TestLoad(t *testing.T) {
 						Deploy:   "deploy-command",
 						RepoPath: "/path/to/prod",
 						Branch:   "master",
-						Hosts:    []string{"host1", "host2", "host3"},
+						Hosts: []config.Host{
+							{Name: "host1"}, {Name: "host2"}, {Name: "host3"},
+							// IPv6 addresses are bracketed
+							{Name: "[2001:db8::1]"}, {Name: "[2001:db8::2]:2222"},
+						},
 					},
 				},
 				TravisToken: "example_token",
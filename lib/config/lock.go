@@ -1,27 +1,149 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"path"
+	"time"
 )
 
 // SetComment will set the  comment field on an environment
-func SetComment(client ETCDInterface, projectName, projectEnv, comment string) (err error) {
-	projectString := fmt.Sprintf("/goship/projects/%s/environments/%s/comment", projectName, projectEnv)
-	// guard against empty values ( simple validation)
-	if projectName == "" || projectEnv == "" {
-		return fmt.Errorf("Missing parameters")
+func SetComment(client ETCDInterface, projectName, projectEnv, comment string) error {
+	return updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		env.Comment = comment
+		return true
+	})
+}
+
+// EnvironmentLock keeps an environment from being deployed until it is unlocked.
+type EnvironmentLock struct {
+	By string `json:"by" yaml:"by"`
+	// Since is zero for locks which predate this struct, when only whether environments were locked was stored.
+	Since time.Time `json:"since" yaml:"since"`
+}
+
+// legacyLock is the "is_locked" flag which environments had instead of Lock before schema 2.
+type legacyLock struct {
+	IsLocked bool `json:"is_locked"`
+}
+
+// applyLegacyLock sets Lock of "env" if its stored JSON "value" is locked by "is_locked" of the old layout.
+// The migration to schema 2 rewrites the flag, but only the leader runs it, so others may read the old layout meanwhile.
+// The lock is attributed to the owner of AutoLock if any, like the migration does.
+func applyLegacyLock(value []byte, env *Environment) error {
+	if env.Lock != nil {
+		return nil
+	}
+	var legacy legacyLock
+	if err := json.Unmarshal(value, &legacy); err != nil {
+		return err
+	}
+	if !legacy.IsLocked {
+		return nil
+	}
+	env.Lock = new(EnvironmentLock)
+	if env.AutoLock != nil {
+		env.Lock.By, env.Lock.Since = env.AutoLock.By, env.AutoLock.Since
+	}
+	return nil
+}
+
+// IsLocked returns true iff "env" is locked by a user or by goship.
+func (env Environment) IsLocked() bool {
+	return env.Lock != nil
+}
+
+// LockEnvironment locks an environment for deploy with "lock", or unlocks it if "lock" is nil.
+func LockEnvironment(client ETCDInterface, projectName, projectEnv string, lock *EnvironmentLock) error {
+	return updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		env.Lock = lock
+		return true
+	})
+}
+
+// SetBranch changes the branch which an environment deploys
+func SetBranch(client ETCDInterface, projectName, projectEnv, branch string) error {
+	if branch == "" {
+		return errorf(ErrInvalid, "Missing parameters")
+	}
+	return updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		env.Branch = branch
+		return true
+	})
+}
+
+// AutoLockOwner is the owner of the locks which goship applies by itself.
+const AutoLockOwner = "goship"
+
+// AutoLock describes a lock of an environment which goship applied after a failed deployment.
+// Unlike locks by users it never expires, so that someone looks into the failure before the next deployment.
+type AutoLock struct {
+	// Reason is why the environment was locked, e.g. "auto-locked: deploy api-production-1 failed".
+	Reason string    `json:"reason" yaml:"reason"`
+	By     string    `json:"by" yaml:"by"`
+	Since  time.Time `json:"since" yaml:"since"`
+	// DeployID identifies the failed deployment.
+	DeployID string `json:"deploy_id" yaml:"deploy_id"`
+}
+
+// AllowsDeploy returns an error unless "env" can be deployed into regardless of its AutoLock.
+// Rollbacks are allowed unless LockBlocksRollback, so that the failed deployment can be reverted.
+func (env Environment) AllowsDeploy(rollback bool) error {
+	switch {
+	case env.AutoLock == nil:
+		return nil
+	case rollback && !env.LockBlocksRollback:
+		return nil
+	}
+	return errorf(ErrLocked, "%s is %s by %s since %s; unlock it after looking into the failure", env.Name, env.AutoLock.Reason, env.AutoLock.By, env.AutoLock.Since.Format(time.RFC3339))
+}
+
+// AutoLockEnvironment locks "projectEnv" of "projectName" at "now" since the deployment "id" into it failed, and returns the lock.
+func AutoLockEnvironment(client ETCDInterface, projectName, projectEnv, id string, now time.Time) (AutoLock, error) {
+	l := AutoLock{
+		Reason:   fmt.Sprintf("auto-locked: deploy %s failed", id),
+		By:       AutoLockOwner,
+		Since:    now,
+		DeployID: id,
 	}
-	_, err = client.Set(projectString, comment, 0)
-	return err
+	err := updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		env.Lock, env.AutoLock = &EnvironmentLock{By: l.By, Since: now}, &l
+		return true
+	})
+	if err != nil {
+		return AutoLock{}, err
+	}
+	return l, nil
+}
+
+// ClearAutoLock unlocks "projectEnv" of "projectName" if goship locked it after a failed deployment.
+// It is not an error if the environment is not auto-locked.
+func ClearAutoLock(client ETCDInterface, projectName, projectEnv string) error {
+	return updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		if env.AutoLock == nil {
+			return false
+		}
+		env.Lock, env.AutoLock = nil, nil
+		return true
+	})
 }
 
-// LockEnvironment Locks or unlock an environment for deploy
-func LockEnvironment(client ETCDInterface, projectName, projectEnv, lock string) (err error) {
-	projectString := fmt.Sprintf("/goship/projects/%s/environments/%s/locked", projectName, projectEnv)
-	// guard against empty values ( simple validation)
+// updateEnvironment stores the environment "projectEnv" of "projectName" modified by "update" unless it returns false.
+func updateEnvironment(client ETCDInterface, projectName, projectEnv string, update func(env *Environment) bool) error {
 	if projectName == "" || projectEnv == "" {
-		return fmt.Errorf("Missing parameters")
+		return errorf(ErrInvalid, "Missing parameters")
+	}
+	key := fmt.Sprintf("/goship/projects/%s/environments/%s", projectName, projectEnv)
+	resp, err := client.Get(key, false, false)
+	if err != nil {
+		return err
+	}
+	env, err := loadEnvironment(resp.Node)
+	if err != nil {
+		return err
+	}
+	if !update(&env) {
+		return nil
 	}
-	_, err = client.Set(projectString, lock, 0)
-	return err
+	return storeEnvironment(client, env, path.Dir(key))
 }
@@ -1,40 +1,183 @@
 package config_test
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/coreos/go-etcd/etcd"
 	"github.com/gengo/goship/lib/config"
 )
 
+func lockTestStore() memStore {
+	return memStore{values: map[string]string{
+		"/goship/config":                            `{}`,
+		"/goship/projects/api/config":               `{}`,
+		"/goship/projects/api/environments/staging": `{"branch": "master"}`,
+	}}
+}
+
 func TestSetComment(t *testing.T) {
-	const key = "/goship/projects/test_project/environments/test_environment/comment"
-	ecl := mockEtcdClient{
-		setExpectation: map[string]string{key: "A comment"},
-	}
-	err := config.SetComment(ecl, "test_project", "test_environment", "A comment")
-	if err != nil {
+	s := lockTestStore()
+	if err := config.SetComment(s, "api", "staging", "A comment"); err != nil {
 		t.Fatalf("Can't set Comment %s", err)
 	}
+	if env := storedEnvironment(t, s, "api", "staging"); env.Comment != "A comment" || env.Branch != "master" {
+		t.Errorf("staging = %#v; want the comment set", env)
+	}
 }
 
 func TestLockingEnvironment(t *testing.T) {
-	const key = "/goship/projects/test_project/environments/test_environment/locked"
+	now := time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := lockTestStore()
+	if err := config.LockEnvironment(s, "api", "staging", &config.EnvironmentLock{By: "alice", Since: now}); err != nil {
+		t.Fatalf("Can't lock %s", err)
+	}
+	env := storedEnvironment(t, s, "api", "staging")
+	if !env.IsLocked() || env.Lock.By != "alice" || !env.Lock.Since.Equal(now) {
+		t.Errorf("staging = %#v with lock %#v; want locked by alice", env, env.Lock)
+	}
+
+	if err := config.LockEnvironment(s, "api", "staging", nil); err != nil {
+		t.Fatalf("Can't unlock %s", err)
+	}
+	if env := storedEnvironment(t, s, "api", "staging"); env.IsLocked() {
+		t.Errorf("staging = %#v; want unlocked", env)
+	}
+	if err := config.LockEnvironment(s, "api", "", nil); config.Cause(err) != config.ErrInvalid {
+		t.Errorf("config.LockEnvironment(s, %q, %q, nil) failed with %v; want %v", "api", "", err, config.ErrInvalid)
+	}
+}
+
+func TestSetBranch(t *testing.T) {
+	const key = "/goship/projects/test_project/environments/test_environment"
+	want, err := json.Marshal(config.Environment{Name: "test_environment", RepoPath: "/srv/app", Branch: "release/1.0"})
+	if err != nil {
+		t.Fatalf("json.Marshal(...) failed with %v", err)
+	}
 	ecl := mockEtcdClient{
-		setExpectation: map[string]string{key: "true"},
+		getExpectation: map[string]*etcd.Node{
+			key: {Key: key, Value: `{"repo_path": "/srv/app", "branch": "master"}`},
+		},
+		setExpectation: map[string]string{key: string(want)},
+	}
+	if err := config.SetBranch(ecl, "test_project", "test_environment", "release/1.0"); err != nil {
+		t.Fatalf("Can't set branch %s", err)
+	}
+}
+
+func TestAutoLockEnvironment(t *testing.T) {
+	now := time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := memStore{values: make(map[string]string)}
+	cfg := config.Config{Projects: []config.Project{{
+		Name: "api",
+		Environments: []config.Environment{
+			{Name: "production", Deploy: "/bin/true", LockOnFailure: true},
+			{Name: "staging", Deploy: "/bin/true", Lock: &config.EnvironmentLock{By: "alice"}},
+		},
+	}}}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
 	}
-	err := config.LockEnvironment(ecl, "test_project", "test_environment", "true")
+
+	l, err := config.AutoLockEnvironment(s, "api", "production", "api-production-1", now)
 	if err != nil {
-		t.Fatalf("Can't lock %s", err)
+		t.Fatalf("config.AutoLockEnvironment(s, %q, %q, %q, now) failed with %v", "api", "production", "api-production-1", err)
+	}
+	want := config.AutoLock{Reason: "auto-locked: deploy api-production-1 failed", By: "goship", Since: now, DeployID: "api-production-1"}
+	if l != want {
+		t.Errorf("config.AutoLockEnvironment(...) = %#v; want %#v", l, want)
+	}
+	env := storedEnvironment(t, s, "api", "production")
+	if !env.IsLocked() || env.AutoLock == nil || !env.AutoLock.Since.Equal(now) || env.AutoLock.Reason != want.Reason || env.AutoLock.By != want.By {
+		t.Errorf("production = %#v with auto lock %#v; want locked with %#v", env, env.AutoLock, want)
+	}
+	if !env.LockOnFailure {
+		t.Errorf("production.LockOnFailure = false; want the rest of the environment kept")
+	}
+
+	if err := config.ClearAutoLock(s, "api", "production"); err != nil {
+		t.Fatalf("config.ClearAutoLock(s, %q, %q) failed with %v", "api", "production", err)
+	}
+	if env := storedEnvironment(t, s, "api", "production"); env.IsLocked() || env.AutoLock != nil {
+		t.Errorf("production = %#v after ClearAutoLock; want unlocked", env)
+	}
+	// locks by users are left alone.
+	if err := config.ClearAutoLock(s, "api", "staging"); err != nil {
+		t.Fatalf("config.ClearAutoLock(s, %q, %q) failed with %v", "api", "staging", err)
+	}
+	if env := storedEnvironment(t, s, "api", "staging"); !env.IsLocked() {
+		t.Errorf("staging = %#v after ClearAutoLock; want still locked", env)
 	}
 }
 
-func TestUnlockingEnvironment(t *testing.T) {
-	const key = "/goship/projects/test_project/environments/test_environment/locked"
-	ecl := mockEtcdClient{
-		setExpectation: map[string]string{key: "false"},
+func TestLegacyIsLocked(t *testing.T) {
+	since := time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := memStore{values: map[string]string{
+		"/goship/config":                               `{}`,
+		"/goship/projects/api/config":                  `{}`,
+		"/goship/projects/api/environments/staging":    `{"is_locked": false}`,
+		"/goship/projects/api/environments/qa":         `{"is_locked": true}`,
+		"/goship/projects/api/environments/production": `{"is_locked": true, "auto_lock": {"by": "goship", "since": "2016-05-01T09:00:00Z"}}`,
+		"/goship/projects/api/environments/canary":     `{"is_locked": true, "lock": {"by": "alice", "since": "2016-05-01T09:00:00Z"}}`,
+	}}
+	for _, spec := range []struct {
+		env  string
+		want *config.EnvironmentLock
+	}{
+		{env: "staging"},
+		{env: "qa", want: &config.EnvironmentLock{}},
+		{env: "production", want: &config.EnvironmentLock{By: "goship", Since: since}},
+		{env: "canary", want: &config.EnvironmentLock{By: "alice", Since: since}},
+	} {
+		env := storedEnvironment(t, s, "api", spec.env)
+		if !reflect.DeepEqual(env.Lock, spec.want) {
+			t.Errorf("lock of %s = %#v; want %#v", spec.env, env.Lock, spec.want)
+		}
 	}
-	err := config.LockEnvironment(ecl, "test_project", "test_environment", "false")
+
+	// unlocking drops the legacy flag, so that the environment is not locked again.
+	if err := config.LockEnvironment(s, "api", "qa", nil); err != nil {
+		t.Fatalf("config.LockEnvironment(s, %q, %q, nil) failed with %v", "api", "qa", err)
+	}
+	if env := storedEnvironment(t, s, "api", "qa"); env.IsLocked() {
+		t.Errorf("qa = %#v after unlocking; want unlocked", env)
+	}
+}
+
+func storedEnvironment(t *testing.T, s memStore, proj, env string) config.Environment {
+	c, err := config.Load(s)
 	if err != nil {
-		t.Fatalf("Can't unlock %s", err)
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	_, e, err := config.EnvironmentFromName(c.Projects, proj, env)
+	if err != nil {
+		t.Fatalf("config.EnvironmentFromName(projs, %q, %q) failed with %v", proj, env, err)
+	}
+	return *e
+}
+
+func TestAllowsDeploy(t *testing.T) {
+	lock := &config.AutoLock{Reason: "auto-locked: deploy api-production-1 failed", By: config.AutoLockOwner}
+	for _, spec := range []struct {
+		env      config.Environment
+		rollback bool
+		allowed  bool
+	}{
+		{env: config.Environment{Name: "production"}, allowed: true},
+		// locked by a user, which the deploy page deals with.
+		{env: config.Environment{Name: "production", Lock: &config.EnvironmentLock{By: "alice"}}, allowed: true},
+		{env: config.Environment{Name: "production", Lock: &config.EnvironmentLock{By: config.AutoLockOwner}, AutoLock: lock}},
+		{env: config.Environment{Name: "production", Lock: &config.EnvironmentLock{By: config.AutoLockOwner}, AutoLock: lock}, rollback: true, allowed: true},
+		{env: config.Environment{Name: "production", Lock: &config.EnvironmentLock{By: config.AutoLockOwner}, AutoLock: lock, LockBlocksRollback: true}, rollback: true},
+	} {
+		err := spec.env.AllowsDeploy(spec.rollback)
+		if spec.allowed && err != nil {
+			t.Errorf("AllowsDeploy(%v) failed with %v for %#v; want allowed", spec.rollback, err, spec.env)
+		}
+		if !spec.allowed && config.Cause(err) != config.ErrLocked {
+			t.Errorf("AllowsDeploy(%v) = %v for %#v; want %v", spec.rollback, err, spec.env, config.ErrLocked)
+		}
 	}
 }
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mask replaces the values of secret fields in Masked.
+const Mask = "****"
+
+// secretTag is the value of the "goship" struct tag which marks fields of credentials, i.e. `goship:"secret"`.
+// All the values in maps and slices under such fields are secret too.
+const secretTag = "secret"
+
+// Masked returns "v" as a tree of maps, slices and values keyed by the YAML names of the fields,
+// where non-empty values of the fields tagged with `goship:"secret"` are replaced with Mask.
+// Fields are masked by the tag instead of names so that new secret fields cannot be missed. See UntaggedSecrets.
+func Masked(v interface{}) interface{} {
+	return tree(reflect.ValueOf(v), true, false)
+}
+
+// Reveal returns the value at "path" in "v" without masking. "path" is a "/"-separated list of
+// the YAML names of fields, map keys and slice indices, e.g. "projects/0/travis_token".
+func Reveal(v interface{}, path string) (interface{}, error) {
+	node := tree(reflect.ValueOf(v), false, false)
+	if path == "" {
+		return node, nil
+	}
+	for _, seg := range strings.Split(path, "/") {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[seg]
+			if !ok {
+				return nil, errorf(ErrInvalid, "no such field %q in %s", seg, path)
+			}
+			node = child
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, errorf(ErrInvalid, "no such index %q in %s", seg, path)
+			}
+			node = n[i]
+		default:
+			return nil, errorf(ErrInvalid, "%q is not a field in %s", seg, path)
+		}
+	}
+	return node, nil
+}
+
+// tree converts "v" into the tree of Masked, masking secret values if "mask" is true. "secret" means "v" is under a secret field.
+func tree(v reflect.Value, mask, secret bool) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return tree(v.Elem(), mask, secret)
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t
+		}
+		m := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name, inline, omitEmpty := yamlField(f)
+			if name == "-" {
+				continue
+			}
+			fv := v.Field(i)
+			if omitEmpty && isEmpty(fv) {
+				continue
+			}
+			child := tree(fv, mask, secret || f.Tag.Get("goship") == secretTag)
+			if sub, ok := child.(map[string]interface{}); ok && inline {
+				for k, v := range sub {
+					m[k] = v
+				}
+				continue
+			}
+			m[name] = child
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		l := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			l = append(l, tree(v.Index(i), mask, secret))
+		}
+		return l
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{})
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = tree(v.MapIndex(k), mask, secret)
+		}
+		return m
+	}
+	if mask && secret && !isEmpty(v) {
+		return Mask
+	}
+	return v.Interface()
+}
+
+// yamlField returns the YAML name of "f", and whether it is inlined or omitted if empty.
+func yamlField(f reflect.StructField) (name string, inline, omitEmpty bool) {
+	parts := strings.Split(f.Tag.Get("yaml"), ",")
+	name = parts[0]
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "inline":
+			inline = true
+		case "omitempty":
+			omitEmpty = true
+		}
+	}
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, inline, omitEmpty
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return v.IsNil() || (v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Len() == 0)
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// secretName matches names of fields which look like credentials.
+var secretName = regexp.MustCompile(`(?i)token|secret|password|passwd|credential|private_?key|api_?key|webhook_?url`)
+
+// UntaggedSecrets returns the paths to the fields in "t" and the types it refers to, which look like credentials by their names
+// but are not tagged with `goship:"secret"`. They would be exposed by Masked.
+func UntaggedSecrets(t reflect.Type) []string {
+	var found []string
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type, path string)
+	walk = func(t reflect.Type, path string) {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := path + "." + f.Name
+			if f.Tag.Get("goship") == secretTag {
+				continue
+			}
+			if secretName.MatchString(f.Name) {
+				found = append(found, strings.TrimPrefix(name, "."))
+			}
+			walk(f.Type, name)
+		}
+	}
+	walk(t, "")
+	sort.Strings(found)
+	return found
+}
+
+// Sources returns where the values in "c" are loaded from, keyed by the paths in Masked.
+// The source of a value is the one of the longest path which is a prefix of its path.
+func Sources(c Config) map[string]string {
+	sources := map[string]string{"": "etcd:/goship/config"}
+	for i, p := range c.Projects {
+		sources[fmt.Sprintf("projects/%d", i)] = fmt.Sprintf("etcd:/goship/projects/%s/config", p.Name)
+		for j, e := range p.Environments {
+			sources[fmt.Sprintf("projects/%d/envs/%d", i, j)] = fmt.Sprintf("etcd:/goship/projects/%s/environments/%s", p.Name, e.Name)
+		}
+	}
+	return sources
+}
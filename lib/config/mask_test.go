@@ -0,0 +1,102 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestConfigSecretsTagged(t *testing.T) {
+	if got := config.UntaggedSecrets(reflect.TypeOf(config.Config{})); len(got) != 0 {
+		t.Errorf("fields %q look like credentials but are not tagged with `goship:\"secret\"`", got)
+	}
+}
+
+func TestUntaggedSecrets(t *testing.T) {
+	type plugin struct {
+		FutureToken string `yaml:"future_token"`
+		Channel     string `yaml:"channel"`
+	}
+	type cfg struct {
+		APIKey   string   `yaml:"api_key" goship:"secret"`
+		Plugins  []plugin `yaml:"plugins"`
+		Password string   `yaml:"password"`
+	}
+	got := config.UntaggedSecrets(reflect.TypeOf(cfg{}))
+	if want := []string{"Password", "Plugins.FutureToken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("config.UntaggedSecrets(cfg) = %q; want %q", got, want)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	c := config.Config{
+		Pivotal:             &config.PivotalConfiguration{Token: "pivotal-token"},
+		GitHubWebhookSecret: "",
+		Projects: []config.Project{
+			{
+				Name:          "api",
+				Repo:          config.Repo{RepoOwner: "gengo", RepoName: "api"},
+				TravisToken:   "travis-token",
+				PluginColumns: []config.PluginColumn{{Type: "jenkins", Params: map[string]string{"user": "ci"}}},
+				Environments:  []config.Environment{{Name: "staging", Branch: "master"}},
+			},
+		},
+	}
+	m := config.Masked(c).(map[string]interface{})
+	pivotal := m["pivotal"].(map[string]interface{})
+	if got := pivotal["token"]; got != config.Mask {
+		t.Errorf("pivotal.token = %v; want %q", got, config.Mask)
+	}
+	if _, ok := m["github_webhook_secret"]; ok {
+		t.Errorf("github_webhook_secret = %v; want omitted since empty", m["github_webhook_secret"])
+	}
+	proj := m["projects"].([]interface{})[0].(map[string]interface{})
+	for k, want := range map[string]interface{}{"name": "api", "repo_owner": "gengo", "travis_token": config.Mask} {
+		if got := proj[k]; got != want {
+			t.Errorf("projects/0/%s = %v; want %v", k, got, want)
+		}
+	}
+	params := proj["plugin_columns"].([]interface{})[0].(map[string]interface{})["params"].(map[string]interface{})
+	if got := params["user"]; got != config.Mask {
+		t.Errorf("projects/0/plugin_columns/0/params/user = %v; want %q", got, config.Mask)
+	}
+
+	for _, spec := range []struct {
+		path string
+		want interface{}
+	}{
+		{path: "pivotal/token", want: "pivotal-token"},
+		{path: "projects/0/travis_token", want: "travis-token"},
+		{path: "projects/0/plugin_columns/0/params/user", want: "ci"},
+		{path: "projects/0/envs/0/name", want: "staging"},
+	} {
+		got, err := config.Reveal(c, spec.path)
+		if err != nil {
+			t.Errorf("config.Reveal(c, %q) failed with %v", spec.path, err)
+			continue
+		}
+		if got != spec.want {
+			t.Errorf("config.Reveal(c, %q) = %v; want %v", spec.path, got, spec.want)
+		}
+	}
+	for _, p := range []string{"pivotal/missing", "projects/1/travis_token", "projects/x", "pivotal/token/more"} {
+		if _, err := config.Reveal(c, p); config.Cause(err) != config.ErrInvalid {
+			t.Errorf("config.Reveal(c, %q) = _, %v; want %v", p, err, config.ErrInvalid)
+		}
+	}
+}
+
+func TestSources(t *testing.T) {
+	c := config.Config{
+		Projects: []config.Project{{Name: "api", Environments: []config.Environment{{Name: "staging"}}}},
+	}
+	want := map[string]string{
+		"":                  "etcd:/goship/config",
+		"projects/0":        "etcd:/goship/projects/api/config",
+		"projects/0/envs/0": "etcd:/goship/projects/api/environments/staging",
+	}
+	if got := config.Sources(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.Sources(c) = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MinDeployNoteLength is the minimum number of characters of deploy notes in environments with RequireDeployNote.
+const MinDeployNoteLength = 10
+
+// ValidateDeployNote returns an error if "note" does not satisfy the requirement of the environment.
+// The error names the "note" field so that clients can show it next to the input.
+func (e Environment) ValidateDeployNote(note string) error {
+	if !e.RequireDeployNote {
+		return nil
+	}
+	if n := utf8.RuneCountInString(strings.TrimSpace(note)); n < MinDeployNoteLength {
+		return errorf(ErrInvalid, "note: deployments into %s require a note of at least %d characters", e.Name, MinDeployNoteLength)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestValidateDeployNote(t *testing.T) {
+	optional := config.Environment{Name: "staging"}
+	required := config.Environment{Name: "production", RequireDeployNote: true}
+	for _, spec := range []struct {
+		env  config.Environment
+		note string
+		ok   bool
+	}{
+		{env: optional, note: "", ok: true},
+		{env: optional, note: "hotfix", ok: true},
+		{env: required, note: "Release 1.2 for the campaign", ok: true},
+		{env: required, note: "障害対応のためのロールバック", ok: true},
+		{env: required, note: ""},
+		{env: required, note: "hotfix"},
+		// surrounding spaces are not counted
+		{env: required, note: "   hotfix   \n"},
+	} {
+		err := spec.env.ValidateDeployNote(spec.note)
+		if spec.ok && err != nil {
+			t.Errorf("%s.ValidateDeployNote(%q) failed with %v; want success", spec.env.Name, spec.note, err)
+		}
+		if !spec.ok && err == nil {
+			t.Errorf("%s.ValidateDeployNote(%q) succeeded; want failure", spec.env.Name, spec.note)
+		}
+	}
+}
+
+func TestValidateConfirmation(t *testing.T) {
+	optional := config.Environment{Name: "staging"}
+	required := config.Environment{Name: "production", ConfirmPhrase: "ship it"}
+	for _, spec := range []struct {
+		env    config.Environment
+		phrase string
+		ok     bool
+	}{
+		{env: optional, phrase: "", ok: true},
+		{env: optional, phrase: "anything", ok: true},
+		{env: required, phrase: "ship it", ok: true},
+		{env: required, phrase: " ship it\n", ok: true},
+		{env: required, phrase: ""},
+		{env: required, phrase: "Ship it"},
+		{env: required, phrase: "production"},
+	} {
+		err := spec.env.ValidateConfirmation("api", spec.phrase)
+		if spec.ok && err != nil {
+			t.Errorf("%s.ValidateConfirmation(%q, %q) failed with %v; want success", spec.env.Name, "api", spec.phrase, err)
+		}
+		if spec.ok {
+			continue
+		}
+		want := config.ConfirmationError{EnvironmentRef: config.EnvironmentRef{Project: "api", Environment: spec.env.Name}}
+		if err != want {
+			t.Errorf("%s.ValidateConfirmation(%q, %q) failed with %v; want %v", spec.env.Name, "api", spec.phrase, err, want)
+		}
+		if strings.Contains(err.Error(), spec.env.ConfirmPhrase) {
+			t.Errorf("error %q reveals the phrase", err)
+		}
+	}
+}
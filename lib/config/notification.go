@@ -0,0 +1,127 @@
+package config
+
+import (
+	"net/url"
+	"sort"
+)
+
+// Names of notification targets, which NotificationOverrides refer to.
+const (
+	// NotifyTargetCommand is the command in Config.Notify.
+	NotifyTargetCommand = "command"
+	// NotifyTargetSlack is the Slack channel in Config.Slack.
+	NotifyTargetSlack = "slack"
+)
+
+// NotificationOverride overrides settings of a notification target for a project or an environment.
+// Empty fields are inherited from the lower precedence. See ResolveNotificationTargets.
+type NotificationOverride struct {
+	// Channel is the Slack channel to post to. Only for slack.
+	Channel string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	// Recipients are chat handles which all the messages mention.
+	Recipients []string `json:"recipients,omitempty" yaml:"recipients,omitempty"`
+	// WebhookURL is a Slack incoming webhook, which is used instead of the bot token. Only for slack.
+	WebhookURL string `json:"webhook_url,omitempty" yaml:"webhook_url,omitempty" goship:"secret"`
+}
+
+// validate returns an error if "o" cannot override the target "name".
+func (o NotificationOverride) validate(name string) error {
+	switch name {
+	case NotifyTargetCommand:
+		if o.Channel != "" || o.WebhookURL != "" {
+			return errorf(ErrInvalid, "channel and webhook_url are not supported by %s", name)
+		}
+	case NotifyTargetSlack:
+		if o.WebhookURL == "" {
+			return nil
+		}
+		u, err := url.Parse(o.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errorf(ErrInvalid, "webhook_url %q is not an absolute http(s) URL", o.WebhookURL)
+		}
+	default:
+		return errorf(ErrInvalid, "unknown notification target %q", name)
+	}
+	return nil
+}
+
+// validateNotificationOverrides returns an error naming "owner" if any of "overrides" is misconfigured.
+func validateNotificationOverrides(overrides map[string]NotificationOverride, owner string) error {
+	var names []string
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := overrides[name].validate(name); err != nil {
+			return errorf(ErrInvalid, "invalid notification_overrides of %s: %v", owner, err)
+		}
+	}
+	return nil
+}
+
+// NotificationTarget is a notification target with the settings resolved for an environment.
+type NotificationTarget struct {
+	// Name is either NotifyTargetCommand or NotifyTargetSlack.
+	Name string
+	// Command is the command to run. Only for command.
+	Command string
+	// Token is the Slack bot token. Only for slack.
+	Token      string
+	Channel    string
+	WebhookURL string
+	Recipients []string
+	// Digest rolls messages to the target up if not nil.
+	Digest *DigestConfiguration
+}
+
+// ResolveNotificationTargets returns the notification targets of deployments into the environment "env" of the project "proj".
+// Settings of each target are merged in the order of precedence:
+//
+//  1. notification_overrides of the environment
+//  2. notification_overrides of the project
+//  3. the global config, i.e. notify, notify_digest and slack
+//
+// A target is resolved only if it can be sent to, i.e. command needs notify, and slack needs its token or webhook_url.
+// Unknown projects and environments resolve to the global targets.
+func ResolveNotificationTargets(cfg Config, proj, env string) []NotificationTarget {
+	var layers []map[string]NotificationOverride
+	if p, err := ProjectFromName(cfg.Projects, proj); err == nil {
+		if _, e, err := EnvironmentFromName(cfg.Projects, proj, env); err == nil {
+			layers = append(layers, e.NotificationOverrides)
+		}
+		layers = append(layers, p.NotificationOverrides)
+	}
+	merge := func(t NotificationTarget) NotificationTarget {
+		// from the lowest precedence
+		for i := len(layers) - 1; i >= 0; i-- {
+			o, ok := layers[i][t.Name]
+			if !ok {
+				continue
+			}
+			if o.Channel != "" {
+				t.Channel = o.Channel
+			}
+			if o.WebhookURL != "" {
+				t.WebhookURL = o.WebhookURL
+			}
+			if len(o.Recipients) > 0 {
+				t.Recipients = o.Recipients
+			}
+		}
+		return t
+	}
+
+	var targets []NotificationTarget
+	if cfg.Notify != "" {
+		targets = append(targets, merge(NotificationTarget{Name: NotifyTargetCommand, Command: cfg.Notify, Digest: cfg.NotifyDigest}))
+	}
+	slack := NotificationTarget{Name: NotifyTargetSlack}
+	if cfg.Slack != nil {
+		slack.Token, slack.Channel, slack.Digest = cfg.Slack.Token, cfg.Slack.Channel, cfg.Slack.Digest
+	}
+	if slack = merge(slack); slack.Token != "" || slack.WebhookURL != "" {
+		targets = append(targets, slack)
+	}
+	return targets
+}
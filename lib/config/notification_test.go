@@ -0,0 +1,120 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestResolveNotificationTargets(t *testing.T) {
+	digest := &config.DigestConfiguration{IntervalMinutes: 5}
+	cfg := config.Config{
+		Notify:       "notify-command",
+		NotifyDigest: digest,
+		Slack:        &config.SlackConfiguration{Token: "bot-token", Channel: "#deploys"},
+		Projects: []config.Project{
+			{
+				Name: "api",
+				NotificationOverrides: map[string]config.NotificationOverride{
+					"slack":   {Channel: "#dev-noise", Recipients: []string{"api-team"}},
+					"command": {Recipients: []string{"api-oncall"}},
+				},
+				Environments: []config.Environment{
+					{Name: "staging"},
+					{
+						Name: "production",
+						NotificationOverrides: map[string]config.NotificationOverride{
+							"slack": {Channel: "#ops"},
+						},
+					},
+					{
+						Name: "sandbox",
+						NotificationOverrides: map[string]config.NotificationOverride{
+							"slack": {WebhookURL: "https://hooks.slack.example/T1", Recipients: []string{"alice"}},
+						},
+					},
+				},
+			},
+			{Name: "web", Environments: []config.Environment{{Name: "production"}}},
+		},
+	}
+	command := func(recipients ...string) config.NotificationTarget {
+		return config.NotificationTarget{Name: "command", Command: "notify-command", Digest: digest, Recipients: recipients}
+	}
+	slack := func(channel, webhook string, recipients ...string) config.NotificationTarget {
+		return config.NotificationTarget{Name: "slack", Token: "bot-token", Channel: channel, WebhookURL: webhook, Recipients: recipients}
+	}
+	for _, spec := range []struct {
+		proj, env string
+		want      []config.NotificationTarget
+	}{
+		// global only
+		{proj: "web", env: "production", want: []config.NotificationTarget{command(), slack("#deploys", "")}},
+		{proj: "unknown", env: "production", want: []config.NotificationTarget{command(), slack("#deploys", "")}},
+		// project over global
+		{proj: "api", env: "staging", want: []config.NotificationTarget{command("api-oncall"), slack("#dev-noise", "", "api-team")}},
+		{proj: "api", env: "unknown", want: []config.NotificationTarget{command("api-oncall"), slack("#dev-noise", "", "api-team")}},
+		// environment over project over global
+		{proj: "api", env: "production", want: []config.NotificationTarget{command("api-oncall"), slack("#ops", "", "api-team")}},
+		{proj: "api", env: "sandbox", want: []config.NotificationTarget{command("api-oncall"), slack("#dev-noise", "https://hooks.slack.example/T1", "alice")}},
+	} {
+		got := config.ResolveNotificationTargets(cfg, spec.proj, spec.env)
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.ResolveNotificationTargets(cfg, %q, %q) = %#v; want %#v", spec.proj, spec.env, got, spec.want)
+		}
+	}
+
+	// webhooks make slack available without the global token.
+	cfg.Notify, cfg.Slack = "", nil
+	if got := config.ResolveNotificationTargets(cfg, "api", "production"); len(got) != 0 {
+		t.Errorf("config.ResolveNotificationTargets(cfg, %q, %q) = %#v; want no targets", "api", "production", got)
+	}
+	want := []config.NotificationTarget{{Name: "slack", Channel: "#dev-noise", WebhookURL: "https://hooks.slack.example/T1", Recipients: []string{"alice"}}}
+	if got := config.ResolveNotificationTargets(cfg, "api", "sandbox"); !reflect.DeepEqual(got, want) {
+		t.Errorf("config.ResolveNotificationTargets(cfg, %q, %q) = %#v; want %#v", "api", "sandbox", got, want)
+	}
+}
+
+func TestInvalidNotificationOverrides(t *testing.T) {
+	for _, spec := range []struct {
+		project, env map[string]config.NotificationOverride
+		// msg is a part of the expected error message.
+		msg string
+	}{
+		{
+			project: map[string]config.NotificationOverride{"hipchat": {Channel: "#ops"}},
+			msg:     `invalid notification_overrides of api: unknown notification target "hipchat"`,
+		},
+		{
+			env: map[string]config.NotificationOverride{"slak": {Channel: "#ops"}},
+			msg: `invalid notification_overrides of production: unknown notification target "slak"`,
+		},
+		{
+			env: map[string]config.NotificationOverride{"command": {Channel: "#ops"}},
+			msg: "channel and webhook_url are not supported by command",
+		},
+		{
+			env: map[string]config.NotificationOverride{"slack": {WebhookURL: "hooks.slack.example"}},
+			msg: "is not an absolute http(s) URL",
+		},
+	} {
+		s := memStore{values: make(map[string]string)}
+		cfg := config.Config{Projects: []config.Project{{
+			Name:                  "api",
+			NotificationOverrides: spec.project,
+			Environments:          []config.Environment{{Name: "production", Deploy: "/bin/true", NotificationOverrides: spec.env}},
+		}}}
+		if err := config.Store(s, cfg); err != nil {
+			t.Fatalf("config.Store(s, cfg) failed with %v", err)
+		}
+		results, err := config.Lint(s, config.LintOptions{})
+		if err != nil {
+			t.Fatalf("config.Lint(s, opts) failed with %v", err)
+		}
+		if len(results) != 1 || results[0].Project != "api" || len(results[0].Problems) != 1 || !strings.Contains(results[0].Problems[0], spec.msg) {
+			t.Errorf("config.Lint(s, opts) = %#v; want a problem of api with %q", results, spec.msg)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PreflightPolicy is what a deployment does when some hosts fail the preflight checks.
+type PreflightPolicy string
+
+const (
+	// PreflightAbort aborts the deployment if any host fails. It is the default.
+	PreflightAbort PreflightPolicy = "abort"
+	// PreflightSkip deploys into the hosts which passed, excluding the failed ones.
+	PreflightSkip PreflightPolicy = "skip"
+)
+
+const (
+	// defaultPreflightTimeout is the time budget of the preflight checks of all the hosts by default.
+	defaultPreflightTimeout = 30 * time.Second
+	// defaultPreflightDiskPath is PreflightConfiguration.DiskPath by default.
+	defaultPreflightDiskPath = "/"
+)
+
+// PreflightConfiguration configures the checks of hosts before deployments.
+// Hosts must be reachable via SSH, and pass the other checks which are configured.
+type PreflightConfiguration struct {
+	// MinFreeDiskMB is the minimum free space in megabytes of DiskPath in each host. It is not checked if zero.
+	MinFreeDiskMB int `json:"min_free_disk_mb,omitempty" yaml:"min_free_disk_mb,omitempty"`
+	// DiskPath is the path whose file system is checked for MinFreeDiskMB. It defaults to "/".
+	DiskPath string `json:"disk_path,omitempty" yaml:"disk_path,omitempty"`
+	// HealthURL is a Go template of the URL which must respond with 200 for each host, e.g. "http://{{.Host}}:8080/healthz".
+	// {{.Host}} is the host name or the IP address without the SSH port. It is not checked if empty.
+	HealthURL string `json:"health_url,omitempty" yaml:"health_url,omitempty"`
+	// TimeoutSeconds is the time budget of the checks of all the hosts. Hosts not checked in time fail. It defaults to 30 seconds.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+}
+
+// healthURLParams are the values which placeholders in PreflightConfiguration.HealthURL and Environment.RevisionSource refer to.
+type healthURLParams struct {
+	Host string
+}
+
+// Timeout returns the time budget of the checks.
+func (c PreflightConfiguration) Timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return defaultPreflightTimeout
+}
+
+// Disk returns the path to check for MinFreeDiskMB.
+func (c PreflightConfiguration) Disk() string {
+	if c.DiskPath != "" {
+		return c.DiskPath
+	}
+	return defaultPreflightDiskPath
+}
+
+// HealthURLFor returns HealthURL rendered for "host", which can have an SSH port.
+// It returns an empty string if HealthURL is not set.
+func (c PreflightConfiguration) HealthURLFor(host string) (string, error) {
+	if c.HealthURL == "" {
+		return "", nil
+	}
+	return hostURL("health_url", c.HealthURL, host)
+}
+
+// hostURL returns the Go template "tmpl" of a URL rendered with healthURLParams for "host", which can have an SSH port.
+func hostURL(name, tmpl, host string) (string, error) {
+	addr, err := ParseHostAddress(host)
+	if err != nil {
+		return "", err
+	}
+	h := addr.Host
+	if strings.Contains(h, ":") {
+		h = "[" + h + "]"
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, healthURLParams{Host: h}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// validatePreflight returns an error if the preflight checks or the policy of "e" are malformed.
+func (e Environment) validatePreflight() error {
+	switch e.OnPreflightFailure {
+	case "", PreflightAbort, PreflightSkip:
+	default:
+		return errorf(ErrInvalid, "invalid on_preflight_failure %q in %s", e.OnPreflightFailure, e.Name)
+	}
+	c := e.Preflight
+	if c == nil {
+		return nil
+	}
+	if c.MinFreeDiskMB < 0 || c.TimeoutSeconds < 0 {
+		return errorf(ErrInvalid, "negative preflight threshold in %s", e.Name)
+	}
+	if _, err := c.HealthURLFor("localhost"); err != nil {
+		return errorf(ErrInvalid, "invalid preflight health_url in %s: %v", e.Name, err)
+	}
+	return nil
+}
+
+// PreflightFailurePolicy returns what a deployment of "e" does when some hosts fail the preflight checks.
+func (e Environment) PreflightFailurePolicy() PreflightPolicy {
+	if e.OnPreflightFailure == "" {
+		return PreflightAbort
+	}
+	return e.OnPreflightFailure
+}
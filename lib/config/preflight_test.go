@@ -0,0 +1,51 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestPreflightConfiguration(t *testing.T) {
+	c := config.PreflightConfiguration{HealthURL: "http://{{.Host}}:8080/healthz"}
+	if got, want := c.Timeout(), 30*time.Second; got != want {
+		t.Errorf("c.Timeout() = %s; want %s", got, want)
+	}
+	if got, want := c.Disk(), "/"; got != want {
+		t.Errorf("c.Disk() = %q; want %q", got, want)
+	}
+	for host, want := range map[string]string{
+		"web1.example.com":    "http://web1.example.com:8080/healthz",
+		"web1.example.com:22": "http://web1.example.com:8080/healthz",
+		"[2001:db8::1]:2222":  "http://[2001:db8::1]:8080/healthz",
+	} {
+		if got, err := c.HealthURLFor(host); err != nil || got != want {
+			t.Errorf("c.HealthURLFor(%q) = %q, %v; want %q", host, got, err, want)
+		}
+	}
+}
+
+func TestPreflightValidate(t *testing.T) {
+	for _, spec := range []struct {
+		c      *config.PreflightConfiguration
+		policy config.PreflightPolicy
+		msg    string
+	}{
+		{},
+		{c: &config.PreflightConfiguration{MinFreeDiskMB: 1024, HealthURL: "http://{{.Host}}/healthz"}, policy: config.PreflightSkip},
+		{policy: "retry", msg: "invalid on_preflight_failure"},
+		{c: &config.PreflightConfiguration{TimeoutSeconds: -1}, msg: "negative preflight threshold"},
+		{c: &config.PreflightConfiguration{HealthURL: "http://{{.Hostname}}/healthz"}, msg: "invalid preflight health_url"},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name: "api",
+			Environments: []config.Environment{{
+				Name:               "production",
+				Deploy:             "/bin/true",
+				Preflight:          spec.c,
+				OnPreflightFailure: spec.policy,
+			}},
+		}}}, spec.msg)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"regexp"
+	"text/template"
+	"time"
+)
+
+// What deployments do when the release of the deployed revision already exists.
+const (
+	// ReleaseSkip keeps the existing release as it is. It is the default.
+	ReleaseSkip = "skip"
+	// ReleaseUpdate replaces the body of the existing release with the one of the deployment.
+	ReleaseUpdate = "update"
+)
+
+// defaultReleaseTag is ReleaseConfiguration.Tag by default, e.g. "deploy-production-20151010-1200".
+const defaultReleaseTag = `deploy-{{.Environment}}-{{.Time.Format "20060102-1504"}}`
+
+// validReleaseTag matches tag names which git accepts and need no escape in URLs.
+var validReleaseTag = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ReleaseConfiguration configures GitHub releases created on successful deployments into an environment.
+type ReleaseConfiguration struct {
+	// Tag is a Go template of the tag name of releases. See ReleaseParams. It defaults to defaultReleaseTag.
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// OnExisting is what redeployments of a released revision do, i.e. ReleaseSkip (default) or ReleaseUpdate.
+	OnExisting string `json:"on_existing,omitempty" yaml:"on_existing,omitempty"`
+}
+
+// ReleaseParams are the values which placeholders in ReleaseConfiguration.Tag refer to.
+type ReleaseParams struct {
+	// Project is the name of the project.
+	Project string
+	// Environment is the name of the environment.
+	Environment string
+	// Revision is the deployed revision.
+	Revision string
+	// Time is when the deployment started, in UTC.
+	Time time.Time
+}
+
+// TagFor returns the tag name of the release of the deployment "p".
+func (c ReleaseConfiguration) TagFor(p ReleaseParams) (string, error) {
+	tmpl := c.Tag
+	if tmpl == "" {
+		tmpl = defaultReleaseTag
+	}
+	t, err := template.New("tag").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	p.Time = p.Time.UTC()
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, p); err != nil {
+		return "", err
+	}
+	tag := buf.String()
+	if !validReleaseTag.MatchString(tag) {
+		return "", errorf(ErrInvalid, "invalid release tag %q", tag)
+	}
+	return tag, nil
+}
+
+// validate returns an error if "c" is malformed.
+func (c *ReleaseConfiguration) validate(env string) error {
+	if c == nil {
+		return nil
+	}
+	switch c.OnExisting {
+	case "", ReleaseSkip, ReleaseUpdate:
+	default:
+		return errorf(ErrInvalid, "release: unknown on_existing %q in %s", c.OnExisting, env)
+	}
+	p := ReleaseParams{Project: "project", Environment: "environment", Revision: "0123456789abcdef", Time: time.Now()}
+	if _, err := c.TagFor(p); err != nil {
+		return errorf(ErrInvalid, "release: invalid tag in %s: %v", env, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+)
+
+// ProjectAlias is an old name of a renamed project, which is resolved to the current name for a grace period.
+type ProjectAlias struct {
+	// Project is the current name of the project.
+	Project string `json:"project" yaml:"project"`
+	// Until is when the old name stops being resolved.
+	Until time.Time `json:"until" yaml:"until"`
+}
+
+// RenameStore is the subset of etcd.Client which renames projects.
+type RenameStore interface {
+	ETCDInterface
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// ResolveProjectName returns the current name of the project which was named "name", if "name" is an alias at "now".
+// Otherwise it returns "name" as is.
+func (c Config) ResolveProjectName(name string, now time.Time) string {
+	if a, ok := c.ProjectAliases[name]; ok && now.Before(a.Until) {
+		return a.Project
+	}
+	return name
+}
+
+// ResolveProject is like ProjectFromName, but also finds projects by their old names during the grace periods of renames.
+func (c Config) ResolveProject(name string, now time.Time) (Project, error) {
+	if p, err := ProjectFromName(c.Projects, name); err == nil {
+		return p, nil
+	}
+	return ProjectFromName(c.Projects, c.ResolveProjectName(name, now))
+}
+
+// RenameProject renames the project "from" in "c" to "to", and keeps "from" as an alias of "to" for "grace".
+// References to environments of the project in DependsOn of all the projects are renamed too.
+//
+// etcd has no transactions over keys, so the project is stored under the new name before the old one is removed,
+// and the changes are reverted if it fails halfway. It fails without reverting only if it fails to remove the old keys at the end.
+func RenameProject(client RenameStore, c Config, from, to string, grace time.Duration, now time.Time) (err error) {
+	if !validEnvironmentName.MatchString(to) {
+		return errorf(ErrInvalid, "invalid project name %q", to)
+	}
+	proj, err := ProjectFromName(c.Projects, from)
+	if err != nil {
+		return err
+	}
+	if _, err := ProjectFromName(c.Projects, to); err == nil {
+		return errorf(ErrAlreadyExists, "project %s already exists", to)
+	}
+
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				glog.Errorf("Failed to revert renaming %s to %s: %v", from, to, uerr)
+			}
+		}
+	}()
+
+	renamed := proj
+	renamed.Name = to
+	renamed.Environments = renameDependencies(proj.Environments, from, to)
+	undo = append(undo, func() error {
+		_, err := client.Delete(path.Join("/goship/projects", to), true)
+		return err
+	})
+	if err := storeProject(client, renamed, "/goship"); err != nil {
+		return err
+	}
+
+	orig := c
+	aliases := make(map[string]ProjectAlias)
+	for name, a := range c.ProjectAliases {
+		if !now.Before(a.Until) || name == to {
+			continue
+		}
+		if a.Project == from {
+			// older names of the project follow the rename.
+			a.Project = to
+		}
+		aliases[name] = a
+	}
+	aliases[from] = ProjectAlias{Project: to, Until: now.Add(grace)}
+	c.ProjectAliases = aliases
+	undo = append(undo, func() error { return storeGlobal(client, orig) })
+	if err := storeGlobal(client, c); err != nil {
+		return err
+	}
+
+	for _, p := range c.Projects {
+		if p.Name == from {
+			continue
+		}
+		dir := path.Join("/goship/projects", p.Name, "environments")
+		for i, env := range renameDependencies(p.Environments, from, to) {
+			if !hasDependencyOn(env, to) {
+				continue
+			}
+			old := p.Environments[i]
+			undo = append(undo, func() error { return storeEnvironment(client, old, dir) })
+			if err := storeEnvironment(client, env, dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := client.Delete(path.Join("/goship/projects", from), true); err != nil {
+		// the project is reachable under both names, which is better than losing either.
+		undo = nil
+		return fmt.Errorf("renamed %s to %s but failed to remove the old keys: %v", from, to, err)
+	}
+	return nil
+}
+
+// renameDependencies returns copies of "envs" whose dependencies on the project "from" are renamed to "to".
+func renameDependencies(envs []Environment, from, to string) []Environment {
+	renamed := make([]Environment, 0, len(envs))
+	for _, env := range envs {
+		deps := make([]string, 0, len(env.DependsOn))
+		for _, d := range env.DependsOn {
+			if strings.HasPrefix(d, from+"/") {
+				d = to + strings.TrimPrefix(d, from)
+			}
+			deps = append(deps, d)
+		}
+		if len(deps) == 0 {
+			deps = nil
+		}
+		env.DependsOn = deps
+		renamed = append(renamed, env)
+	}
+	return renamed
+}
+
+func hasDependencyOn(env Environment, proj string) bool {
+	for _, d := range env.DependsOn {
+		if strings.HasPrefix(d, proj+"/") {
+			return true
+		}
+	}
+	return false
+}
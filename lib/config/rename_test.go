@@ -0,0 +1,205 @@
+package config_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// memStore is a RenameStore which keeps values in memory. Set fails for keys under "fail".
+type memStore struct {
+	values map[string]string
+	fail   string
+}
+
+func (s memStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s.values[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	n := s.dir(key)
+	if n == nil {
+		return nil, &etcd.EtcdError{ErrorCode: 100}
+	}
+	return &etcd.Response{Node: n}, nil
+}
+
+func (s memStore) dir(key string) *etcd.Node {
+	children := make(map[string]bool)
+	for k := range s.values {
+		if strings.HasPrefix(k, key+"/") {
+			children[key+"/"+strings.SplitN(strings.TrimPrefix(k, key+"/"), "/", 2)[0]] = true
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	n := &etcd.Node{Key: key, Dir: true}
+	for _, k := range keys {
+		if v, ok := s.values[k]; ok {
+			n.Nodes = append(n.Nodes, &etcd.Node{Key: k, Value: v})
+		} else {
+			n.Nodes = append(n.Nodes, s.dir(k))
+		}
+	}
+	return n
+}
+
+func (s memStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	if s.fail != "" && strings.HasPrefix(key, s.fail) {
+		return nil, errors.New("unavailable")
+	}
+	s.values[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (s memStore) Delete(key string, recursive bool) (*etcd.Response, error) {
+	for k := range s.values {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(s.values, k)
+		}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key}}, nil
+}
+
+func renameTestStore(t *testing.T) memStore {
+	s := memStore{values: make(map[string]string)}
+	cfg := config.Config{
+		DeployUser: "deployer",
+		ProjectAliases: map[string]config.ProjectAlias{
+			"legacy-api": {Project: "api", Until: now.Add(time.Hour)},
+			"expired":    {Project: "web", Until: now.Add(-time.Hour)},
+		},
+		Projects: []config.Project{
+			{
+				Name: "api",
+				Environments: []config.Environment{
+					{Name: "staging", Branch: "master"},
+					{Name: "production", Branch: "master", Lock: &config.EnvironmentLock{By: "alice"}, Comment: "freeze", DependsOn: []string{"api/staging"}},
+				},
+			},
+			{
+				Name: "web",
+				Environments: []config.Environment{
+					{Name: "production", Branch: "master", DependsOn: []string{"api/production"}},
+				},
+			},
+		},
+	}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+	return s
+}
+
+func TestRenameProject(t *testing.T) {
+	s := renameTestStore(t)
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	if err := config.RenameProject(s, c, "api", "gateway", 24*time.Hour, now); err != nil {
+		t.Fatalf("config.RenameProject(s, c, %q, %q, 24h, now) failed with %v", "api", "gateway", err)
+	}
+
+	if c, err = config.Load(s); err != nil {
+		t.Fatalf("config.Load(s) failed with %v after rename", err)
+	}
+	if _, err := config.ProjectFromName(c.Projects, "api"); err == nil {
+		t.Errorf("project api still exists after rename")
+	}
+	_, prod, err := config.EnvironmentFromName(c.Projects, "gateway", "production")
+	if err != nil {
+		t.Fatalf("config.EnvironmentFromName(projects, %q, %q) failed with %v", "gateway", "production", err)
+	}
+	if !prod.IsLocked() || prod.Comment != "freeze" || !reflect.DeepEqual(prod.DependsOn, []string{"gateway/staging"}) {
+		t.Errorf("gateway/production = %#v; want locked with the comment and depending on gateway/staging", prod)
+	}
+	_, web, err := config.EnvironmentFromName(c.Projects, "web", "production")
+	if err != nil {
+		t.Fatalf("config.EnvironmentFromName(projects, %q, %q) failed with %v", "web", "production", err)
+	}
+	if got, want := web.DependsOn, []string{"gateway/production"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web/production depends on %q; want %q", got, want)
+	}
+
+	want := map[string]config.ProjectAlias{
+		"api":        {Project: "gateway", Until: now.Add(24 * time.Hour)},
+		"legacy-api": {Project: "gateway", Until: now.Add(time.Hour)},
+	}
+	if len(c.ProjectAliases) != len(want) {
+		t.Errorf("c.ProjectAliases = %#v; want %#v", c.ProjectAliases, want)
+	}
+	for name, a := range want {
+		if got := c.ProjectAliases[name]; got.Project != a.Project || !got.Until.Equal(a.Until) {
+			t.Errorf("c.ProjectAliases[%q] = %#v; want %#v", name, got, a)
+		}
+	}
+
+	for _, spec := range []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{name: "api", at: now, want: "gateway"},
+		{name: "legacy-api", at: now, want: "gateway"},
+		{name: "gateway", at: now, want: "gateway"},
+		{name: "web", at: now, want: "web"},
+		{name: "api", at: now.Add(24 * time.Hour), want: ""},
+	} {
+		p, err := c.ResolveProject(spec.name, spec.at)
+		if spec.want == "" {
+			if err == nil {
+				t.Errorf("c.ResolveProject(%q, %s) = %#v; want failure", spec.name, spec.at, p)
+			}
+			continue
+		}
+		if err != nil || p.Name != spec.want {
+			t.Errorf("c.ResolveProject(%q, %s) = %q, %v; want %q", spec.name, spec.at, p.Name, err, spec.want)
+		}
+	}
+}
+
+func TestRenameProjectErrors(t *testing.T) {
+	s := renameTestStore(t)
+	c, err := config.Load(s)
+	if err != nil {
+		t.Fatalf("config.Load(s) failed with %v", err)
+	}
+	for _, spec := range []struct {
+		from, to string
+	}{
+		{from: "api", to: "web"},
+		{from: "api", to: "bad/name"},
+		{from: "api", to: ""},
+		{from: "missing", to: "gateway"},
+	} {
+		if err := config.RenameProject(s, c, spec.from, spec.to, time.Hour, now); err == nil {
+			t.Errorf("config.RenameProject(s, c, %q, %q, 1h, now) succeeded; want failure", spec.from, spec.to)
+		}
+	}
+
+	orig := make(map[string]string)
+	for k, v := range s.values {
+		orig[k] = v
+	}
+	s.fail = "/goship/projects/web"
+	if err := config.RenameProject(s, c, "api", "gateway", time.Hour, now); err == nil {
+		t.Fatalf("config.RenameProject(s, c, %q, %q, 1h, now) succeeded with a failing store; want failure", "api", "gateway")
+	}
+	if !reflect.DeepEqual(s.values, orig) {
+		t.Errorf("store = %q after a failed rename; want reverted to %q", s.values, orig)
+	}
+}
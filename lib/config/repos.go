@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/golang/glog"
+)
+
+// RepoRef is one of the repositories which a multi-repo project deploys together.
+type RepoRef struct {
+	Repo `json:",inline" yaml:",inline"`
+	// Branch is the branch deployed from in all the environments. It defaults to the branch of each environment.
+	// The first repository always follows the environments.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+}
+
+// Name returns "owner/name" of the repository, which identifies it in Revisions.
+func (r RepoRef) Name() string {
+	return r.RepoOwner + "/" + r.RepoName
+}
+
+// BranchFor returns the branch of "r" deployed into "env".
+func (r RepoRef) BranchFor(env Environment) string {
+	if r.Branch == "" {
+		return env.Branch
+	}
+	return r.Branch
+}
+
+// EnvironmentFor returns a copy of "env" which deploys the branch of "r".
+func (r RepoRef) EnvironmentFor(env Environment) Environment {
+	env.Branch = r.BranchFor(env)
+	return env
+}
+
+// SourceRepos returns the repositories which "p" deploys together in order. The first one is SourceRepo of "p".
+// It is only SourceRepo unless Repos are configured.
+func (p Project) SourceRepos() []RepoRef {
+	if len(p.Repos) == 0 {
+		return []RepoRef{{Repo: p.SourceRepo()}}
+	}
+	return p.Repos
+}
+
+// ForRepo returns a copy of "p" whose source repository is "r", so that revisions, comparisons and URLs about
+// another repository of a multi-repo project work as they do for single-repo projects.
+func (p Project) ForRepo(r RepoRef) Project {
+	p.Repo, p.Source, p.Repos = r.Repo, nil, nil
+	return p
+}
+
+// validateRepos returns an error if Repos of "p" are malformed, and fills Repo of "p" with the first of them unless set.
+func (p *Project) validateRepos() error {
+	if len(p.Repos) == 0 {
+		return nil
+	}
+	if p.RepoType != RepoTypeGithub {
+		return errorf(ErrInvalid, "repos of %s require repo_type %s", p.Name, RepoTypeGithub)
+	}
+	seen := make(map[string]bool)
+	for i, r := range p.Repos {
+		if r.RepoOwner == "" || r.RepoName == "" {
+			return errorf(ErrInvalid, "repo_owner and repo_name of repos[%d] of %s not configured", i, p.Name)
+		}
+		if seen[r.Name()] {
+			return errorf(ErrInvalid, "duplicate repository %s in repos of %s", r.Name(), p.Name)
+		}
+		seen[r.Name()] = true
+	}
+	first := p.Repos[0]
+	if first.Branch != "" {
+		return errorf(ErrInvalid, "branch of repos[0] of %s must not be set since it follows the environments", p.Name)
+	}
+	switch p.Repo {
+	case Repo{}:
+		p.Repo = first.Repo
+	case first.Repo:
+	default:
+		return errorf(ErrInvalid, "repo_owner and repo_name of %s differ from repos[0]", p.Name)
+	}
+	return nil
+}
+
+// Revisions map "owner/name" of the repositories of a multi-repo project to the commits deployed from them.
+type Revisions map[string]string
+
+// String encodes "rs" as "owner/name=sha" separated by commas in the order of the names,
+// e.g. "gengo/api=0123abc,gengo/web=4567def".
+func (rs Revisions) String() string {
+	names := make([]string, 0, len(rs))
+	for name := range rs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+rs[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// RepoRange is the range of commits of a repository which a deployment of a multi-repo project ships.
+type RepoRange struct {
+	RepoRef
+	// From is the revision deployed before, or empty if unknown.
+	From string
+	To   string
+}
+
+// RepoRanges returns the ranges of the repositories of "p" except the first one, which are deployed from "prev" to "next".
+// Repositories missing in "next" are omitted.
+func (p Project) RepoRanges(prev, next Revisions) []RepoRange {
+	repos := p.SourceRepos()
+	var ranges []RepoRange
+	for _, r := range repos[1:] {
+		to, ok := next[r.Name()]
+		if !ok {
+			continue
+		}
+		ranges = append(ranges, RepoRange{RepoRef: r, From: prev[r.Name()], To: to})
+	}
+	return ranges
+}
+
+// repoStoryDetails adds the links to the commits in "others" referring to each story to "details".
+// Repositories whose previous revision is unknown or no longer exists are skipped, since the deployment
+// of the first repository decides whether stories are commented at all.
+func repoStoryDetails(gcl githublib.Client, proj Project, ev PivotalEvent, others []RepoRange, details map[int][]string, now time.Time) {
+	for _, r := range others {
+		if r.From == "" || r.From == r.To {
+			continue
+		}
+		base, head := r.From, r.To
+		if ev == PivotalRollback {
+			base, head = head, base
+		}
+		sc, err := PivotalStoryCommits(gcl, nil, r.RepoOwner, r.RepoName, base, head, now)
+		if err != nil {
+			glog.Warningf("Skipped stories in %s of %s: %v", r.Name(), proj.Name, err)
+			continue
+		}
+		for id, shas := range sc {
+			details[id] = append(details[id], fmt.Sprintf("%s\n%s", r.Name(), PivotalCommitLinks(proj.ForRepo(r.RepoRef), shas, base, head)))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestLoadRepos(t *testing.T) {
+	api := config.Repo{RepoOwner: "gengo", RepoName: "api"}
+	web := config.Repo{RepoOwner: "gengo", RepoName: "web"}
+	for _, spec := range []struct {
+		proj config.Project
+		// msg is a part of the error, or empty if valid.
+		msg string
+	}{
+		{proj: config.Project{Repos: []config.RepoRef{{Repo: api}, {Repo: web, Branch: "release"}}}},
+		{proj: config.Project{Repo: api, Repos: []config.RepoRef{{Repo: api}, {Repo: web}}}},
+		{proj: config.Project{Repo: web, Repos: []config.RepoRef{{Repo: api}, {Repo: web}}}, msg: "differ from repos[0]"},
+		{proj: config.Project{Repos: []config.RepoRef{{Repo: api}, {Repo: api, Branch: "release"}}}, msg: "duplicate repository gengo/api"},
+		{proj: config.Project{Repos: []config.RepoRef{{Repo: api}, {Repo: config.Repo{RepoOwner: "gengo"}}}}, msg: "repos[1]"},
+		{proj: config.Project{Repos: []config.RepoRef{{Repo: api, Branch: "release"}, {Repo: web}}}, msg: "branch of repos[0]"},
+		{
+			proj: config.Project{
+				RepoType: config.RepoTypeDocker,
+				Source:   &api,
+				Repos:    []config.RepoRef{{Repo: api}, {Repo: web}},
+			},
+			msg: "require repo_type github",
+		},
+	} {
+		s := memStore{values: make(map[string]string)}
+		proj := spec.proj
+		proj.Name = "shop"
+		proj.Environments = []config.Environment{{Name: "production", Branch: "master", Deploy: "/bin/true"}}
+		if err := config.Store(s, config.Config{Projects: []config.Project{proj}}); err != nil {
+			t.Fatalf("config.Store(s, cfg) failed with %v", err)
+		}
+		if spec.msg != "" {
+			results, err := config.Lint(s, config.LintOptions{})
+			if err != nil {
+				t.Fatalf("config.Lint(s, opts) failed with %v", err)
+			}
+			if len(results) != 1 || len(results[0].Problems) != 1 || !strings.Contains(results[0].Problems[0], spec.msg) {
+				t.Errorf("config.Lint(s, opts) = %#v with repos %#v; want a problem with %q", results, spec.proj.Repos, spec.msg)
+			}
+			continue
+		}
+		c, err := config.Load(s)
+		if err != nil {
+			t.Fatalf("config.Load(s) failed with %v", err)
+		}
+		if len(c.Projects) != 1 {
+			t.Errorf("c.Projects = %#v with repos %#v; want the project", c.Projects, spec.proj.Repos)
+			continue
+		}
+		got := c.Projects[0]
+		if got.Repo != api {
+			t.Errorf("Repo = %#v; want %#v", got.Repo, api)
+		}
+		if !reflect.DeepEqual(got.SourceRepos(), spec.proj.Repos) {
+			t.Errorf("SourceRepos() = %#v; want %#v", got.SourceRepos(), spec.proj.Repos)
+		}
+	}
+}
+
+func TestSourceRepos(t *testing.T) {
+	api := config.Repo{RepoOwner: "gengo", RepoName: "api"}
+	single := config.Project{Name: "api", Repo: api}
+	if got, want := single.SourceRepos(), []config.RepoRef{{Repo: api}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SourceRepos() = %#v; want %#v", got, want)
+	}
+
+	web := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}, Branch: "release"}
+	multi := config.Project{Name: "shop", Repo: api, Repos: []config.RepoRef{{Repo: api}, web}}
+	proj := multi.ForRepo(web)
+	if proj.SourceRepo() != web.Repo || len(proj.SourceRepos()) != 1 {
+		t.Errorf("ForRepo(%#v) = %#v; want a single-repo project of the repository", web, proj)
+	}
+	if proj.Name != "shop" {
+		t.Errorf("ForRepo(%#v).Name = %q; want %q", web, proj.Name, "shop")
+	}
+
+	env := config.Environment{Name: "production", Branch: "master"}
+	for _, spec := range []struct {
+		r    config.RepoRef
+		want string
+	}{
+		{r: config.RepoRef{Repo: api}, want: "master"},
+		{r: web, want: "release"},
+	} {
+		if got := spec.r.EnvironmentFor(env).Branch; got != spec.want {
+			t.Errorf("%s.EnvironmentFor(env).Branch = %q; want %q", spec.r.Name(), got, spec.want)
+		}
+	}
+	if env.Branch != "master" {
+		t.Errorf("env.Branch = %q; want it unchanged", env.Branch)
+	}
+}
+
+func TestRevisionsString(t *testing.T) {
+	for _, spec := range []struct {
+		revs config.Revisions
+		want string
+	}{
+		{revs: nil, want: ""},
+		{revs: config.Revisions{"gengo/api": "0123abc"}, want: "gengo/api=0123abc"},
+		{
+			revs: config.Revisions{"gengo/web": "4567def", "gengo/api": "0123abc", "other/lib": "89ab012"},
+			want: "gengo/api=0123abc,gengo/web=4567def,other/lib=89ab012",
+		},
+	} {
+		if got := spec.revs.String(); got != spec.want {
+			t.Errorf("%#v.String() = %q; want %q", spec.revs, got, spec.want)
+		}
+	}
+}
+
+func TestRepoRanges(t *testing.T) {
+	api := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+	web := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}}
+	worker := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "worker"}, Branch: "stable"}
+	proj := config.Project{Name: "shop", Repo: api.Repo, Repos: []config.RepoRef{api, web, worker}}
+
+	prev := config.Revisions{"gengo/api": "a1", "gengo/web": "w1"}
+	next := config.Revisions{"gengo/api": "a2", "gengo/web": "w2", "gengo/worker": "k2"}
+	want := []config.RepoRange{
+		{RepoRef: web, From: "w1", To: "w2"},
+		// deployed for the first time.
+		{RepoRef: worker, To: "k2"},
+	}
+	if got := proj.RepoRanges(prev, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("proj.RepoRanges(%v, %v) = %#v; want %#v", prev, next, got, want)
+	}
+	if got := (config.Project{Name: "api", Repo: api.Repo}).RepoRanges(prev, next); len(got) != 0 {
+		t.Errorf("RepoRanges of a single-repo project = %#v; want none", got)
+	}
+}
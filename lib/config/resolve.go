@@ -0,0 +1,129 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestionDistance is the largest edit distance of suggested names, which is also limited by a third of the length of the given name.
+const maxSuggestionDistance = 3
+
+// ResolveTarget returns the project "projectName" and its environment "envName" in "projects".
+// They point into "projects", so that changes through them are seen by other users of the slice.
+// Unknown names fail with ErrProjectNotFound or ErrEnvironmentNotFound, which suggest close names. See Suggestions.
+// Since the suggestions reveal the names of projects, pass only the projects which the user can read, or see acl.ResolveTarget.
+func ResolveTarget(projects []Project, projectName, envName string) (*Project, *Environment, error) {
+	p, err := FindProject(projects, projectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range p.Environments {
+		if p.Environments[i].Name == envName {
+			return p, &p.Environments[i], nil
+		}
+	}
+	names := make([]string, 0, len(p.Environments))
+	for _, e := range p.Environments {
+		names = append(names, e.Name)
+	}
+	return nil, nil, notFound(ErrEnvironmentNotFound, "No environment found: "+envName+" in "+p.Name, envName, names)
+}
+
+// FindProject is like ResolveTarget, but for handlers of projects rather than environments.
+func FindProject(projects []Project, name string) (*Project, error) {
+	if p := findProject(projects, name); p != nil {
+		return p, nil
+	}
+	names := make([]string, 0, len(projects))
+	for _, p := range projects {
+		names = append(names, p.Name)
+	}
+	return nil, notFound(ErrProjectNotFound, "No project found: "+name, name, names)
+}
+
+// findProject returns a pointer to the project "name" in "projects", or nil if not found.
+func findProject(projects []Project, name string) *Project {
+	for i := range projects {
+		if projects[i].Name == name {
+			return &projects[i]
+		}
+	}
+	return nil
+}
+
+// notFound returns an *Error of "kind" with the names in "known" which are close to "name" as suggestions.
+func notFound(kind error, msg, name string, known []string) error {
+	suggestions := SuggestNames(name, known)
+	if len(suggestions) > 0 {
+		msg += "; did you mean " + strings.Join(suggestions, " or ") + "?"
+	}
+	return &Error{Kind: kind, Msg: msg, Suggestions: suggestions}
+}
+
+// Suggestions returns the names which "err" suggests instead of an unknown one, if any.
+func Suggestions(err error) []string {
+	if e, ok := err.(*Error); ok {
+		return e.Suggestions
+	}
+	return nil
+}
+
+// SuggestNames returns the names in "known" closest to "name" in edit distance, ignoring cases.
+// All of the equally close names are returned in order when "name" is ambiguous, and none if no name is close enough.
+func SuggestNames(name string, known []string) []string {
+	limit := len(name) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxSuggestionDistance {
+		limit = maxSuggestionDistance
+	}
+	var (
+		best        = limit + 1
+		suggestions []string
+	)
+	for _, k := range known {
+		d := editDistance(strings.ToLower(name), strings.ToLower(k))
+		switch {
+		case d < best:
+			best, suggestions = d, []string{k}
+		case d == best:
+			suggestions = append(suggestions, k)
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions of adjacent bytes
+// to turn "a" into "b", i.e. the optimal string alignment distance.
+func editDistance(a, b string) int {
+	// d[i][j] is the distance between a[:i] and b[:j].
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if v := d[i-1][j] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if v := d[i][j-1] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,83 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func resolveFixture() []config.Project {
+	return []config.Project{
+		{Name: "api", Environments: []config.Environment{{Name: "staging"}, {Name: "production"}}},
+		{Name: "billing", Environments: []config.Environment{{Name: "production"}}},
+		{Name: "billing-v2", Environments: []config.Environment{{Name: "qa"}}},
+		{Name: "bulling", Environments: []config.Environment{{Name: "qa"}}},
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	projects := resolveFixture()
+	p, e, err := config.ResolveTarget(projects, "api", "production")
+	if err != nil {
+		t.Fatalf("config.ResolveTarget(projects, %q, %q) failed with %v", "api", "production", err)
+	}
+	if p != &projects[0] || e != &projects[0].Environments[1] {
+		t.Errorf("config.ResolveTarget(projects, %q, %q) = %p, %p; want %p, %p in projects", "api", "production", p, e, &projects[0], &projects[0].Environments[1])
+	}
+	e.Branch = "release"
+	if got := projects[0].Environments[1].Branch; got != "release" {
+		t.Errorf("branch in projects = %q after changing the resolved environment; want %q", got, "release")
+	}
+}
+
+func TestResolveTargetNotFound(t *testing.T) {
+	for _, spec := range []struct {
+		proj, env string
+		kind      error
+		want      []string
+	}{
+		{proj: "apl", env: "production", kind: config.ErrProjectNotFound, want: []string{"api"}},
+		{proj: "API", env: "production", kind: config.ErrProjectNotFound, want: []string{"api"}},
+		{proj: "api", env: "prodution", kind: config.ErrEnvironmentNotFound, want: []string{"production"}},
+		{proj: "api", env: "stagign", kind: config.ErrEnvironmentNotFound, want: []string{"staging"}},
+		{proj: "billng", env: "production", kind: config.ErrProjectNotFound, want: []string{"billing"}},
+		// ambiguous
+		{proj: "bolling", env: "production", kind: config.ErrProjectNotFound, want: []string{"billing", "bulling"}},
+		// too far
+		{proj: "web", env: "production", kind: config.ErrProjectNotFound},
+		{proj: "api", env: "qa", kind: config.ErrEnvironmentNotFound},
+	} {
+		_, _, err := config.ResolveTarget(resolveFixture(), spec.proj, spec.env)
+		if got := config.Cause(err); got != spec.kind {
+			t.Errorf("config.ResolveTarget(projects, %q, %q) failed with %v; want %v", spec.proj, spec.env, err, spec.kind)
+			continue
+		}
+		if got := config.Suggestions(err); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("config.Suggestions(%v) = %q; want %q", err, got, spec.want)
+		}
+		if hint := strings.Contains(err.Error(), "did you mean"); hint != (len(spec.want) > 0) {
+			t.Errorf("config.ResolveTarget(projects, %q, %q) failed with %q; want a hint only with suggestions", spec.proj, spec.env, err)
+		}
+		for _, s := range spec.want {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("config.ResolveTarget(projects, %q, %q) failed with %q; want it to suggest %q", spec.proj, spec.env, err, s)
+			}
+		}
+	}
+}
+
+func TestFindProject(t *testing.T) {
+	projects := resolveFixture()
+	if p, err := config.FindProject(projects, "billing"); err != nil || p != &projects[1] {
+		t.Errorf("config.FindProject(projects, %q) = %p, %v; want %p", "billing", p, err, &projects[1])
+	}
+	_, err := config.FindProject(projects, "bolling")
+	if got := config.Cause(err); got != config.ErrProjectNotFound {
+		t.Errorf("config.FindProject(projects, %q) failed with %v; want %v", "bolling", err, config.ErrProjectNotFound)
+	}
+	if got, want := config.Suggestions(err), []string{"billing", "bulling"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("config.Suggestions(%v) = %q; want %q", err, got, want)
+	}
+}
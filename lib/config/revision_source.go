@@ -0,0 +1,72 @@
+package config
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// revisionFilePrefix is the prefix of Environment.RevisionSource which reads a file in hosts, e.g. "file:/srv/app/REVISION".
+const revisionFilePrefix = "file:"
+
+// RevisionFile returns the absolute path of the file in hosts which has the deployed revision,
+// or false if RevisionSource of "e" is not a file.
+func (e Environment) RevisionFile() (string, bool) {
+	if !strings.HasPrefix(e.RevisionSource, revisionFilePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(e.RevisionSource, revisionFilePrefix), true
+}
+
+// RevisionURLFor returns the URL which responds with the revision deployed into "host",
+// or an empty string if RevisionSource of "e" is not a URL.
+// RevisionSource is a Go template which can refer to the name of the host as {{.Host}}, e.g. "http://{{.Host}}:8080/version".
+func (e Environment) RevisionURLFor(host string) (string, error) {
+	if e.RevisionSource == "" {
+		return "", nil
+	}
+	if _, ok := e.RevisionFile(); ok {
+		return "", nil
+	}
+	return hostURL("revision_source", e.RevisionSource, host)
+}
+
+// validateRevisionSource returns an error if RevisionSource or RevisionJSONPath of "e" is malformed.
+// Environments without both RevisionSource and RepoPath are valid, but their deployed revisions are unknown.
+func (e Environment) validateRevisionSource() error {
+	if e.RevisionSource == "" {
+		if e.RevisionJSONPath != "" {
+			return errorf(ErrInvalid, "revision_json_path without revision_source in %s", e.Name)
+		}
+		return nil
+	}
+	if e.RepoPath != "" {
+		return errorf(ErrInvalid, "both repo_path and revision_source in %s", e.Name)
+	}
+	if p, ok := e.RevisionFile(); ok {
+		if !path.IsAbs(p) {
+			return errorf(ErrInvalid, "revision_source %q in %s is not an absolute path", e.RevisionSource, e.Name)
+		}
+		if e.RevisionJSONPath != "" {
+			return errorf(ErrInvalid, "revision_json_path with a file in revision_source of %s", e.Name)
+		}
+		return nil
+	}
+	s, err := e.RevisionURLFor("localhost")
+	if err != nil {
+		return errorf(ErrInvalid, "invalid revision_source in %s: %v", e.Name, err)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return errorf(ErrInvalid, "invalid revision_source in %s: %v", e.Name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errorf(ErrInvalid, "revision_source %q in %s is neither a file: path nor an http(s) URL", e.RevisionSource, e.Name)
+	}
+	for _, k := range strings.Split(e.RevisionJSONPath, ".") {
+		if e.RevisionJSONPath != "" && k == "" {
+			return errorf(ErrInvalid, "empty key in revision_json_path %q of %s", e.RevisionJSONPath, e.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestRevisionSource(t *testing.T) {
+	env := config.Environment{RevisionSource: "file:/srv/api/REVISION"}
+	if got, ok := env.RevisionFile(); !ok || got != "/srv/api/REVISION" {
+		t.Errorf("env.RevisionFile() = %q, %t; want %q, true", got, ok, "/srv/api/REVISION")
+	}
+	if got, err := env.RevisionURLFor("web1.example.com"); err != nil || got != "" {
+		t.Errorf("env.RevisionURLFor(%q) = %q, %v; want no URL of a file", "web1.example.com", got, err)
+	}
+
+	env = config.Environment{RevisionSource: "http://{{.Host}}:8080/version"}
+	if got, ok := env.RevisionFile(); ok {
+		t.Errorf("env.RevisionFile() = %q, true; want no file of a URL", got)
+	}
+	for host, want := range map[string]string{
+		"web1.example.com":    "http://web1.example.com:8080/version",
+		"web1.example.com:22": "http://web1.example.com:8080/version",
+		"[2001:db8::1]:2222":  "http://[2001:db8::1]:8080/version",
+	} {
+		if got, err := env.RevisionURLFor(host); err != nil || got != want {
+			t.Errorf("env.RevisionURLFor(%q) = %q, %v; want %q", host, got, err, want)
+		}
+	}
+}
+
+func TestRevisionSourceValidate(t *testing.T) {
+	for _, spec := range []struct {
+		repoPath, source, jsonPath string
+		msg                        string
+	}{
+		{repoPath: "/srv/api/.git"},
+		{source: "file:/srv/api/REVISION"},
+		{source: "https://{{.Host}}/version", jsonPath: "build.sha"},
+		{},
+		{repoPath: "/srv/api/.git", source: "file:/srv/api/REVISION", msg: "both repo_path and revision_source"},
+		{source: "file:REVISION", msg: "not an absolute path"},
+		{source: "file:/srv/api/REVISION", jsonPath: "sha", msg: "revision_json_path with a file"},
+		{source: "ftp://{{.Host}}/version", msg: "neither a file: path nor an http(s) URL"},
+		{source: "/srv/api/REVISION", msg: "neither a file: path nor an http(s) URL"},
+		{source: "http://{{.Hostname}}/version", msg: "invalid revision_source"},
+		{source: "http://{{.Host}}/version", jsonPath: "build..sha", msg: "empty key in revision_json_path"},
+		{jsonPath: "sha", msg: "revision_json_path without revision_source"},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name: "api",
+			Environments: []config.Environment{{
+				Name:             "production",
+				Deploy:           "/bin/true",
+				RepoPath:         spec.repoPath,
+				RevisionSource:   spec.source,
+				RevisionJSONPath: spec.jsonPath,
+			}},
+		}}}, spec.msg)
+	}
+}
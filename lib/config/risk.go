@@ -0,0 +1,170 @@
+package config
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// Levels of the risk of deploying pending commits.
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// Factors of the risk of deploying pending commits, which RiskTerm refers to.
+const (
+	RiskFactorCommits    = "commits"
+	RiskFactorLines      = "lines"
+	RiskFactorAuthors    = "authors"
+	RiskFactorMigrations = "migrations"
+	RiskFactorDays       = "days"
+)
+
+// Defaults of RiskConfiguration.
+const (
+	defaultRiskCommitWeight    = 1
+	defaultRiskLineWeight      = 1
+	defaultRiskAuthorWeight    = 2
+	defaultRiskMigrationWeight = 10
+	defaultRiskDayWeight       = 0.5
+	defaultRiskMediumScore     = 10
+	defaultRiskHighScore       = 25
+)
+
+// defaultMigrationPaths are RiskConfiguration.MigrationPaths by default, i.e. the migrations of Rails, Django and Flyway-like layouts.
+var defaultMigrationPaths = []string{"db/migrate", "migrations", "*/migrations"}
+
+// RiskConfiguration scores the risk of deploying the commits pending for an environment.
+// The score is the sum of the factors multiplied by their weights, and it is of medium risk from MediumScore and of high risk from HighScore.
+// Zero fields take the defaults.
+type RiskConfiguration struct {
+	// CommitWeight is the points of each pending commit. It defaults to 1.
+	CommitWeight float64 `json:"commit_weight,omitempty" yaml:"commit_weight,omitempty"`
+	// LineWeight is the points of each 100 lines added or deleted. It defaults to 1.
+	LineWeight float64 `json:"line_weight,omitempty" yaml:"line_weight,omitempty"`
+	// AuthorWeight is the points of each distinct author of the commits. It defaults to 2.
+	AuthorWeight float64 `json:"author_weight,omitempty" yaml:"author_weight,omitempty"`
+	// MigrationWeight is the points if the commits change any files in MigrationPaths. It defaults to 10.
+	MigrationWeight float64 `json:"migration_weight,omitempty" yaml:"migration_weight,omitempty"`
+	// DayWeight is the points of each day since the last successful deployment into the environment. It defaults to 0.5.
+	DayWeight float64 `json:"day_weight,omitempty" yaml:"day_weight,omitempty"`
+	// MigrationPaths are patterns of path.Match of the files of database migrations. A pattern matching a directory
+	// matches all the files under it. They default to "db/migrate", "migrations" and "*/migrations".
+	MigrationPaths []string `json:"migration_paths,omitempty" yaml:"migration_paths,omitempty"`
+	// MediumScore is the lowest score of medium risk. It defaults to 10.
+	MediumScore float64 `json:"medium_score,omitempty" yaml:"medium_score,omitempty"`
+	// HighScore is the lowest score of high risk. It defaults to 25.
+	HighScore float64 `json:"high_score,omitempty" yaml:"high_score,omitempty"`
+}
+
+// RiskFactors are what the risk of deploying pending commits is scored from.
+type RiskFactors struct {
+	Commits int
+	// Lines is the number of lines added or deleted.
+	Lines   int
+	Authors int
+	// Migrations is true if any files of migrations are changed.
+	Migrations bool
+	// SinceLastDeploy is how long ago the environment was deployed into successfully, or zero if unknown.
+	SinceLastDeploy time.Duration
+}
+
+// RiskTerm is the points which a factor adds to a risk score.
+type RiskTerm struct {
+	// Factor is one of RiskFactorCommits, RiskFactorLines, RiskFactorAuthors, RiskFactorMigrations and RiskFactorDays.
+	Factor string `json:"factor"`
+	// Value is the factor, e.g. the number of commits. It is 1 for changed migrations.
+	Value  float64 `json:"value"`
+	Points float64 `json:"points"`
+}
+
+func (c *RiskConfiguration) validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, w := range []float64{c.CommitWeight, c.LineWeight, c.AuthorWeight, c.MigrationWeight, c.DayWeight, c.MediumScore, c.HighScore} {
+		if w < 0 {
+			return errorf(ErrInvalid, "risk: negative weight or score")
+		}
+	}
+	if medium, high := c.thresholds(); medium > high {
+		return errorf(ErrInvalid, "risk: medium_score %g is higher than high_score %g", medium, high)
+	}
+	for _, p := range c.MigrationPaths {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			return errorf(ErrInvalid, "risk: malformed migration_paths %q", p)
+		}
+	}
+	return nil
+}
+
+// orDefault returns "v" unless it is zero, or "def" otherwise.
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// thresholds returns the lowest scores of medium and high risk with the defaults.
+func (c *RiskConfiguration) thresholds() (medium, high float64) {
+	if c == nil {
+		return defaultRiskMediumScore, defaultRiskHighScore
+	}
+	return orDefault(c.MediumScore, defaultRiskMediumScore), orDefault(c.HighScore, defaultRiskHighScore)
+}
+
+// IsMigration returns true if "file", a path relative to the root of the repository, is a migration in MigrationPaths.
+// "c" can be nil for the defaults.
+func (c *RiskConfiguration) IsMigration(file string) bool {
+	patterns := defaultMigrationPaths
+	if c != nil && len(c.MigrationPaths) > 0 {
+		patterns = c.MigrationPaths
+	}
+	for dir := strings.Trim(file, "/"); dir != "." && dir != ""; dir = path.Dir(dir) {
+		for _, p := range patterns {
+			if ok, _ := path.Match(strings.Trim(p, "/"), dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Assess returns the score and the level of the risk of "f", broken down into the points of each factor.
+// The days since the last deployment count only if it is known. "c" can be nil for the defaults.
+func (c *RiskConfiguration) Assess(f RiskFactors) (score float64, level string, terms []RiskTerm) {
+	var w RiskConfiguration
+	if c != nil {
+		w = *c
+	}
+	add := func(factor string, value, weight float64) {
+		t := RiskTerm{Factor: factor, Value: value, Points: value * weight}
+		score += t.Points
+		terms = append(terms, t)
+	}
+	add(RiskFactorCommits, float64(f.Commits), orDefault(w.CommitWeight, defaultRiskCommitWeight))
+	add(RiskFactorLines, float64(f.Lines), orDefault(w.LineWeight, defaultRiskLineWeight)/100)
+	add(RiskFactorAuthors, float64(f.Authors), orDefault(w.AuthorWeight, defaultRiskAuthorWeight))
+	var migrations float64
+	if f.Migrations {
+		migrations = 1
+	}
+	add(RiskFactorMigrations, migrations, orDefault(w.MigrationWeight, defaultRiskMigrationWeight))
+	if f.SinceLastDeploy > 0 {
+		add(RiskFactorDays, f.SinceLastDeploy.Hours()/24, orDefault(w.DayWeight, defaultRiskDayWeight))
+	}
+
+	medium, high := c.thresholds()
+	switch {
+	case score >= high:
+		level = RiskHigh
+	case score >= medium:
+		level = RiskMedium
+	default:
+		level = RiskLow
+	}
+	return score, level, terms
+}
@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestRiskIsMigration(t *testing.T) {
+	custom := &config.RiskConfiguration{MigrationPaths: []string{"schema/*.sql", "/services/*/alembic/"}}
+	for _, spec := range []struct {
+		c    *config.RiskConfiguration
+		file string
+		want bool
+	}{
+		{file: "db/migrate/20160301_add_users.rb", want: true},
+		{file: "migrations/0001_initial.py", want: true},
+		{file: "accounts/migrations/0002_email.py", want: true},
+		{file: "app/models/user.rb"},
+		{file: "db/seeds.rb"},
+		// only the top level and one level down by default.
+		{file: "src/accounts/migrations/0002_email.py"},
+		{file: "docs/migrations.md"},
+		{c: custom, file: "schema/001.sql", want: true},
+		{c: custom, file: "schema/001.txt"},
+		{c: custom, file: "services/billing/alembic/versions/1a2b.py", want: true},
+		// the defaults are replaced.
+		{c: custom, file: "db/migrate/20160301_add_users.rb"},
+	} {
+		if got := spec.c.IsMigration(spec.file); got != spec.want {
+			t.Errorf("%#v.IsMigration(%q) = %t; want %t", spec.c, spec.file, got, spec.want)
+		}
+	}
+}
+
+func TestRiskAssess(t *testing.T) {
+	for _, spec := range []struct {
+		c         *config.RiskConfiguration
+		f         config.RiskFactors
+		wantScore float64
+		want      string
+	}{
+		{f: config.RiskFactors{Commits: 1, Lines: 20, Authors: 1}, wantScore: 3.2, want: config.RiskLow},
+		{f: config.RiskFactors{Commits: 3, Lines: 200, Authors: 2, SinceLastDeploy: 24 * time.Hour}, wantScore: 9.5, want: config.RiskLow},
+		{f: config.RiskFactors{Commits: 3, Lines: 200, Authors: 2, SinceLastDeploy: 48 * time.Hour}, wantScore: 10, want: config.RiskMedium},
+		{f: config.RiskFactors{Commits: 1, Lines: 50, Authors: 1, Migrations: true}, wantScore: 13.5, want: config.RiskMedium},
+		{f: config.RiskFactors{Commits: 12, Lines: 1500, Authors: 4, SinceLastDeploy: 7 * 24 * time.Hour}, wantScore: 38.5, want: config.RiskHigh},
+		{
+			c:         &config.RiskConfiguration{CommitWeight: 5, MediumScore: 5, HighScore: 50},
+			f:         config.RiskFactors{Commits: 2, Authors: 1},
+			wantScore: 12, want: config.RiskMedium,
+		},
+	} {
+		score, level, terms := spec.c.Assess(spec.f)
+		if score != spec.wantScore || level != spec.want {
+			t.Errorf("%#v.Assess(%#v) = %g, %q; want %g, %q", spec.c, spec.f, score, level, spec.wantScore, spec.want)
+		}
+		var sum float64
+		for _, term := range terms {
+			sum += term.Points
+		}
+		if sum != score {
+			t.Errorf("points of %#v sum up to %g; want %g", terms, sum, score)
+		}
+	}
+
+	_, _, terms := (*config.RiskConfiguration)(nil).Assess(config.RiskFactors{Commits: 2, Lines: 300, Authors: 1, Migrations: true, SinceLastDeploy: 36 * time.Hour})
+	want := []config.RiskTerm{
+		{Factor: config.RiskFactorCommits, Value: 2, Points: 2},
+		{Factor: config.RiskFactorLines, Value: 300, Points: 3},
+		{Factor: config.RiskFactorAuthors, Value: 1, Points: 2},
+		{Factor: config.RiskFactorMigrations, Value: 1, Points: 10},
+		{Factor: config.RiskFactorDays, Value: 1.5, Points: 0.75},
+	}
+	if len(terms) != len(want) {
+		t.Fatalf("Assess(...) broke down into %#v; want %#v", terms, want)
+	}
+	for i := range want {
+		if terms[i] != want[i] {
+			t.Errorf("terms[%d] = %#v; want %#v", i, terms[i], want[i])
+		}
+	}
+}
+
+func TestRiskValidate(t *testing.T) {
+	for _, spec := range []struct {
+		c   *config.RiskConfiguration
+		msg string
+	}{
+		{},
+		{c: &config.RiskConfiguration{MigrationPaths: []string{"db/*/migrate"}, MediumScore: 30, HighScore: 30}},
+		{c: &config.RiskConfiguration{LineWeight: -1}, msg: "negative weight"},
+		// higher than the default high score.
+		{c: &config.RiskConfiguration{MediumScore: 40}, msg: "higher than high_score"},
+		{c: &config.RiskConfiguration{MigrationPaths: []string{"db/[migrate"}}, msg: "malformed migration_paths"},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name:         "api",
+			Risk:         spec.c,
+			Environments: []config.Environment{{Name: "production", Deploy: "/bin/true"}},
+		}}}, spec.msg)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/schedule"
+)
+
+// ScheduleRevision is which revision a scheduled deployment deploys.
+type ScheduleRevision string
+
+const (
+	// ScheduleTip deploys the latest deployable revision of the branch of the environment. It is the default.
+	ScheduleTip ScheduleRevision = "tip"
+	// ScheduleBranch deploys the latest revision of Schedule.Branch instead.
+	ScheduleBranch ScheduleRevision = "branch"
+)
+
+// defaultScheduleGraceMinutes is Schedule.GraceMinutes by default.
+const defaultScheduleGraceMinutes = 30
+
+// Schedule deploys an environment periodically from the leader instance, e.g. staging every night.
+type Schedule struct {
+	// Cron is when to deploy in the five-field cron syntax, e.g. "0 2 * * *" for 02:00 every day.
+	Cron string `json:"cron" yaml:"cron"`
+	// Timezone is the IANA name of the timezone which Cron is evaluated in, e.g. "Asia/Tokyo". It is UTC if empty.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	// Revision is either ScheduleTip (default) or ScheduleBranch.
+	Revision ScheduleRevision `json:"revision,omitempty" yaml:"revision,omitempty"`
+	// Branch is the branch deployed with ScheduleBranch.
+	Branch string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	// Enabled must be set for the schedule to run, so that schedules can be paused without removing them.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// GraceMinutes is how late a deployment can start after the scheduled time, e.g. after goship was down.
+	// Later deployments are skipped as missed. It defaults to 30 minutes.
+	GraceMinutes int `json:"grace_minutes,omitempty" yaml:"grace_minutes,omitempty"`
+}
+
+// Expr returns the parsed Cron in Timezone.
+func (s Schedule) Expr() (schedule.Expr, error) {
+	loc := time.UTC
+	if s.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return schedule.Expr{}, err
+		}
+	}
+	return schedule.Parse(s.Cron, loc)
+}
+
+// Grace returns how late a deployment can start after the scheduled time.
+func (s Schedule) Grace() time.Duration {
+	if s.GraceMinutes > 0 {
+		return time.Duration(s.GraceMinutes) * time.Minute
+	}
+	return defaultScheduleGraceMinutes * time.Minute
+}
+
+// BranchOf returns the branch which the schedule deploys from into "env".
+func (s Schedule) BranchOf(env Environment) string {
+	if s.Revision == ScheduleBranch {
+		return s.Branch
+	}
+	return env.Branch
+}
+
+func (e Environment) validateSchedules() error {
+	for i, s := range e.Schedules {
+		if _, err := s.Expr(); err != nil {
+			return errorf(ErrInvalid, "invalid schedules[%d] of %s: %v", i, e.Name, err)
+		}
+		switch s.Revision {
+		case "", ScheduleTip:
+		case ScheduleBranch:
+			if s.Branch == "" {
+				return errorf(ErrInvalid, "schedules[%d] of %s deploys a branch but has no branch", i, e.Name)
+			}
+		default:
+			return errorf(ErrInvalid, "invalid revision %q of schedules[%d] in %s", s.Revision, i, e.Name)
+		}
+		if s.GraceMinutes < 0 {
+			return errorf(ErrInvalid, "negative grace_minutes of schedules[%d] in %s", i, e.Name)
+		}
+	}
+	return nil
+}
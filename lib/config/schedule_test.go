@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestLoadSchedules(t *testing.T) {
+	for _, spec := range []struct {
+		schedules []config.Schedule
+		// msg is a part of the error, or empty if valid.
+		msg string
+	}{
+		{},
+		{schedules: []config.Schedule{
+			{Cron: "0 2 * * *", Timezone: "Asia/Tokyo", Enabled: true},
+			{Cron: "*/30 9-18 * * 1-5", Revision: config.ScheduleBranch, Branch: "release", GraceMinutes: 10},
+		}},
+		{schedules: []config.Schedule{{Cron: "0 2 * *"}}, msg: "invalid schedules[0] of staging"},
+		{schedules: []config.Schedule{{Cron: "0 2 * * *", Timezone: "Mars/Olympus"}}, msg: "invalid schedules[0] of staging"},
+		{schedules: []config.Schedule{{Cron: "0 2 * * *", Revision: config.ScheduleBranch}}, msg: "deploys a branch but has no branch"},
+		{schedules: []config.Schedule{{Cron: "0 2 * * *", Revision: "tag"}}, msg: `invalid revision "tag"`},
+		{schedules: []config.Schedule{{Cron: "0 2 * * *", GraceMinutes: -1}}, msg: "negative grace_minutes"},
+	} {
+		s := memStore{values: make(map[string]string)}
+		env := config.Environment{Name: "staging", Branch: "master", Deploy: "/bin/true", Schedules: spec.schedules}
+		proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{env}}
+		if err := config.Store(s, config.Config{Projects: []config.Project{proj}}); err != nil {
+			t.Fatalf("config.Store(s, cfg) failed with %v", err)
+		}
+		results, err := config.Lint(s, config.LintOptions{})
+		if err != nil {
+			t.Fatalf("config.Lint(s, opts) failed with %v", err)
+		}
+		if spec.msg == "" {
+			if len(results) != 1 || len(results[0].Problems) != 0 {
+				t.Errorf("config.Lint(s, opts) = %#v with schedules %#v; want no problems", results, spec.schedules)
+			}
+			continue
+		}
+		if len(results) != 1 || len(results[0].Problems) != 1 || !strings.Contains(results[0].Problems[0], spec.msg) {
+			t.Errorf("config.Lint(s, opts) = %#v with schedules %#v; want a problem with %q", results, spec.schedules, spec.msg)
+		}
+	}
+}
+
+func TestScheduleDefaults(t *testing.T) {
+	s := config.Schedule{Cron: "0 2 * * *"}
+	if got, want := s.Grace(), 30*time.Minute; got != want {
+		t.Errorf("Grace() = %s by default; want %s", got, want)
+	}
+	env := config.Environment{Name: "staging", Branch: "develop"}
+	if got, want := s.BranchOf(env), "develop"; got != want {
+		t.Errorf("BranchOf(env) = %q by default; want %q", got, want)
+	}
+	s.Revision, s.Branch = config.ScheduleBranch, "release"
+	if got, want := s.BranchOf(env), "release"; got != want {
+		t.Errorf("BranchOf(env) = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	sshlib "github.com/gengo/goship/lib/ssh"
+)
+
+// SSHAuth configures how goship authenticates to hosts over SSH instead of the private key given by -k.
+// The methods which are set are tried in the order of the private key, the agent and the password.
+type SSHAuth struct {
+	// KeyPath is the path to a private key file in PEM on the goship host.
+	KeyPath string `json:"key_path,omitempty" yaml:"key_path,omitempty"`
+	// Key is a private key in PEM, which is stored encrypted like other secrets. It is exclusive with KeyPath.
+	Key string `json:"key,omitempty" yaml:"key,omitempty" goship:"secret"`
+	// Passphrase decrypts KeyPath or Key if it is encrypted.
+	Passphrase string `json:"passphrase,omitempty" yaml:"passphrase,omitempty" goship:"secret"`
+	// Agent is the path to the socket of an SSH agent, e.g. one which holds only the keys of the environment.
+	Agent string `json:"agent,omitempty" yaml:"agent,omitempty"`
+	// Password is the password of the deploy user.
+	Password string `json:"password,omitempty" yaml:"password,omitempty" goship:"secret"`
+}
+
+// validate returns an error if "a" of "where" is obviously wrong. Whether the key can be read and decrypted
+// is checked by Lint, since it depends on the goship host.
+func (a *SSHAuth) validate(where string) error {
+	switch {
+	case a == nil:
+		return nil
+	case a.KeyPath != "" && a.Key != "":
+		return errorf(ErrInvalid, "both key_path and key are given in ssh of %s", where)
+	case a.Passphrase != "" && a.KeyPath == "" && a.Key == "":
+		return errorf(ErrInvalid, "passphrase is given without a key in ssh of %s", where)
+	case a.KeyPath == "" && a.Key == "" && a.Agent == "" && a.Password == "":
+		return errorf(ErrInvalid, "no auth method is given in ssh of %s", where)
+	}
+	return nil
+}
+
+func (a SSHAuth) auth() sshlib.Auth {
+	return sshlib.Auth{KeyPath: a.KeyPath, Key: a.Key, Passphrase: a.Passphrase, Agent: a.Agent, Password: a.Password}
+}
+
+// SSHAuthOf returns the SSH auth of "h" in "env", which is the one of the host if any, or the one of the environment.
+// It is nil if neither has one, i.e. the private key of goship is used.
+func (env Environment) SSHAuthOf(h Host) *SSHAuth {
+	if h.SSH != nil {
+		return h.SSH
+	}
+	return env.SSH
+}
+
+// WithSSHAuth returns a copy of "s" which authenticates to the hosts of "envs" as configured by SSHAuthOf.
+// Commands on hosts whose auth cannot be resolved fail with the reason without connecting to them.
+func WithSSHAuth(s sshlib.SSH, envs ...Environment) sshlib.SSH {
+	for _, env := range envs {
+		for _, h := range env.Hosts {
+			if a := env.SSHAuthOf(h); a != nil {
+				s = s.WithHostAuth(h.Name, a.auth())
+			}
+		}
+	}
+	return s
+}
+
+// lintSSHAuth returns the problems of resolving the SSH auth of the hosts of "env", e.g. unreadable keys or wrong passphrases.
+func lintSSHAuth(env Environment) []string {
+	var problems []string
+	if env.SSH != nil {
+		if _, err := sshlib.AuthMethods(env.SSH.auth()); err != nil {
+			problems = append(problems, "ssh: "+err.Error())
+		}
+	}
+	for _, h := range env.Hosts {
+		if h.SSH == nil {
+			continue
+		}
+		if _, err := sshlib.AuthMethods(h.SSH.auth()); err != nil {
+			problems = append(problems, "ssh of "+h.Name+": "+err.Error())
+		}
+	}
+	return problems
+}
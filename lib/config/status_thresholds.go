@@ -0,0 +1,87 @@
+package config
+
+// Health of an environment as a whole, by the percentage of its undrained hosts on the latest deployable revision.
+const (
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+	// HealthUnknown means that none of the hosts is known to be on the tip or behind it,
+	// e.g. since the tip has not been fetched yet or all the hosts are drained.
+	HealthUnknown = "unknown"
+)
+
+// UnknownHostPolicy is how StatusThresholds counts hosts whose deployed revisions are unknown.
+type UnknownHostPolicy string
+
+const (
+	// UnknownHostsExcluded leaves the unknown hosts out of the percentage. It is the default.
+	UnknownHostsExcluded UnknownHostPolicy = "exclude"
+	// UnknownHostsBehind counts the unknown hosts as behind the tip.
+	UnknownHostsBehind UnknownHostPolicy = "behind"
+)
+
+// Defaults of StatusThresholds.
+const (
+	defaultGreenPercent  = 100
+	defaultYellowPercent = 90
+)
+
+// StatusThresholds decides the health of an environment from the percentage of its undrained hosts on the tip,
+// so that an environment with 59 of 60 hosts on the tip does not look like one with 30 of 60.
+// It is green from GreenPercent, yellow from YellowPercent and red below. Zero fields take the defaults.
+type StatusThresholds struct {
+	// GreenPercent is the lowest percentage of hosts on the tip of a green environment. It defaults to 100.
+	GreenPercent float64 `json:"green_percent,omitempty" yaml:"green_percent,omitempty"`
+	// YellowPercent is the lowest percentage of hosts on the tip of a yellow environment. It defaults to 90.
+	YellowPercent float64 `json:"yellow_percent,omitempty" yaml:"yellow_percent,omitempty"`
+	// Unknown is how hosts whose deployed revisions are unknown are counted, i.e. "exclude" (default) or "behind".
+	Unknown UnknownHostPolicy `json:"unknown,omitempty" yaml:"unknown,omitempty"`
+}
+
+// validate returns an error if a percentage of "t" of the environment "env" is out of range or the policy is unknown.
+func (t *StatusThresholds) validate(env string) error {
+	if t == nil {
+		return nil
+	}
+	for _, p := range []float64{t.GreenPercent, t.YellowPercent} {
+		if p < 0 || p > 100 {
+			return errorf(ErrInvalid, "status_thresholds: percentage %g of %s is not within 0 and 100", p, env)
+		}
+	}
+	if green, yellow := t.percents(); yellow > green {
+		return errorf(ErrInvalid, "status_thresholds: yellow_percent %g of %s is higher than green_percent %g", yellow, env, green)
+	}
+	switch t.Unknown {
+	case "", UnknownHostsExcluded, UnknownHostsBehind:
+		return nil
+	}
+	return errorf(ErrInvalid, "status_thresholds: unknown %q of %s; want exclude or behind", t.Unknown, env)
+}
+
+// percents returns the lowest percentages of green and yellow environments with the defaults.
+func (t *StatusThresholds) percents() (green, yellow float64) {
+	if t == nil {
+		return defaultGreenPercent, defaultYellowPercent
+	}
+	return orDefault(t.GreenPercent, defaultGreenPercent), orDefault(t.YellowPercent, defaultYellowPercent)
+}
+
+// Health returns the health of an environment whose undrained hosts are "onTip" on the tip, "behind" it and "unknown".
+// It is HealthUnknown if no host is known either way, whatever the policy. "t" can be nil for the defaults.
+func (t *StatusThresholds) Health(onTip, behind, unknown int) string {
+	if onTip+behind == 0 {
+		return HealthUnknown
+	}
+	total := onTip + behind
+	if t != nil && t.Unknown == UnknownHostsBehind {
+		total += unknown
+	}
+	green, yellow := t.percents()
+	switch percent := 100 * float64(onTip) / float64(total); {
+	case percent >= green:
+		return HealthGreen
+	case percent >= yellow:
+		return HealthYellow
+	}
+	return HealthRed
+}
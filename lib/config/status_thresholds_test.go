@@ -0,0 +1,65 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestStatusThresholdsHealth(t *testing.T) {
+	custom := &config.StatusThresholds{GreenPercent: 95, YellowPercent: 50}
+	behind := &config.StatusThresholds{Unknown: config.UnknownHostsBehind}
+	for _, spec := range []struct {
+		t                      *config.StatusThresholds
+		onTip, behind, unknown int
+		want                   string
+	}{
+		// the defaults: green only with all the hosts, yellow from 90%.
+		{onTip: 60, want: config.HealthGreen},
+		{onTip: 59, behind: 1, want: config.HealthYellow},
+		{onTip: 54, behind: 6, want: config.HealthYellow},
+		{onTip: 53, behind: 7, want: config.HealthRed},
+		{onTip: 30, behind: 30, want: config.HealthRed},
+		{behind: 60, want: config.HealthRed},
+		{t: custom, onTip: 57, behind: 3, want: config.HealthGreen},
+		{t: custom, onTip: 56, behind: 4, want: config.HealthYellow},
+		{t: custom, onTip: 30, behind: 30, want: config.HealthYellow},
+		{t: custom, onTip: 29, behind: 31, want: config.HealthRed},
+
+		// unknown hosts are excluded by default.
+		{onTip: 50, unknown: 10, want: config.HealthGreen},
+		{onTip: 45, behind: 5, unknown: 10, want: config.HealthYellow},
+		{t: behind, onTip: 50, unknown: 10, want: config.HealthRed},
+		{t: behind, onTip: 54, unknown: 6, want: config.HealthYellow},
+		{t: behind, onTip: 53, behind: 1, unknown: 6, want: config.HealthRed},
+
+		// nothing known either way
+		{unknown: 60, want: config.HealthUnknown},
+		{t: behind, unknown: 60, want: config.HealthUnknown},
+		{want: config.HealthUnknown},
+	} {
+		if got := spec.t.Health(spec.onTip, spec.behind, spec.unknown); got != spec.want {
+			t.Errorf("%#v.Health(%d, %d, %d) = %q; want %q", spec.t, spec.onTip, spec.behind, spec.unknown, got, spec.want)
+		}
+	}
+}
+
+func TestStatusThresholdsValidate(t *testing.T) {
+	for _, spec := range []struct {
+		t   *config.StatusThresholds
+		msg string
+	}{
+		{},
+		{t: &config.StatusThresholds{GreenPercent: 80, YellowPercent: 80, Unknown: config.UnknownHostsBehind}},
+		{t: &config.StatusThresholds{GreenPercent: 120}, msg: "not within 0 and 100"},
+		{t: &config.StatusThresholds{YellowPercent: -1}, msg: "not within 0 and 100"},
+		// higher than the default green percentage.
+		{t: &config.StatusThresholds{GreenPercent: 80}, msg: "higher than green_percent"},
+		{t: &config.StatusThresholds{Unknown: "ignore"}, msg: "want exclude or behind"},
+	} {
+		checkLintProblem(t, config.Config{Projects: []config.Project{{
+			Name:         "api",
+			Environments: []config.Environment{{Name: "production", Deploy: "/bin/true", StatusThresholds: spec.t}},
+		}}}, spec.msg)
+	}
+}
@@ -1,15 +1,27 @@
 package config
 
 import (
-	"encoding/json"
 	"path"
 
 	"github.com/golang/glog"
 )
 
-// Store stores "cfg" to etcd
+// Store stores "cfg" to etcd. Secrets are encrypted if a keyring is set by SetKeyring.
 func Store(client ETCDInterface, cfg Config) error {
-	buf, err := json.Marshal(cfg)
+	if err := storeGlobal(client, cfg); err != nil {
+		return err
+	}
+	for _, p := range cfg.Projects {
+		if err := storeProject(client, p, "/goship"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeGlobal stores the global part of "cfg" without projects.
+func storeGlobal(client ETCDInterface, cfg Config) error {
+	buf, err := marshalSecrets(cfg, keyring)
 	if err != nil {
 		glog.Errorf("Failed to marshal global config: %v", err)
 		return err
@@ -18,16 +30,11 @@ func Store(client ETCDInterface, cfg Config) error {
 		glog.Errorf("Failed to store global config: %v", err)
 		return err
 	}
-	for _, p := range cfg.Projects {
-		if err := storeProject(client, p, "/goship"); err != nil {
-			return err
-		}
-	}
 	return nil
 }
 
 func storeProject(client ETCDInterface, p Project, base string) error {
-	buf, err := json.Marshal(p)
+	buf, err := marshalSecrets(p, keyring)
 	if err != nil {
 		glog.Errorf("Failed to marshal project config of %s: %v", p.Name, err)
 		return err
@@ -46,7 +53,7 @@ func storeProject(client ETCDInterface, p Project, base string) error {
 }
 
 func storeEnvironment(client ETCDInterface, env Environment, dir string) error {
-	buf, err := json.Marshal(env)
+	buf, err := marshalSecrets(env, keyring)
 	if err != nil {
 		glog.Errorf("Failed to marshal environment config of %s: %v", env.Name, err)
 		return err
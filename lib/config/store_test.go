@@ -27,7 +27,7 @@ func TestStore(t *testing.T) {
 						Deploy:   "deploy-command",
 						RepoPath: "/path/to/prod",
 						Branch:   "master",
-						Hosts:    []string{"host1", "host2", "host3"},
+						Hosts:    []config.Host{{Name: "host1"}, {Name: "host2"}, {Name: "host3"}},
 					},
 				},
 				TravisToken: "example_token",
@@ -2,16 +2,17 @@ package config
 
 import (
 	"fmt"
-	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-etcd/etcd"
+	githublib "github.com/gengo/goship/lib/github"
 	"github.com/gengo/goship/lib/pivotal"
 	"github.com/golang/glog"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 const (
@@ -20,10 +21,53 @@ const (
 
 // Config is a set of Goship configurations
 type Config struct {
-	Projects   []Project             `json:"-" yaml:"projects,omitempty"`
-	DeployUser string                `json:"deploy_user" yaml:"deploy_user"`
-	Notify     string                `json:"notify" yaml:"notify"`
-	Pivotal    *PivotalConfiguration `json:"pivotal,omitempty" yaml:"pivotal,omitempty"`
+	Projects   []Project `json:"-" yaml:"projects,omitempty"`
+	DeployUser string    `json:"deploy_user" yaml:"deploy_user"`
+	Notify     string    `json:"notify" yaml:"notify"`
+	// NotifyDigest rolls messages to Notify up if not nil.
+	NotifyDigest *DigestConfiguration  `json:"notify_digest,omitempty" yaml:"notify_digest,omitempty"`
+	Pivotal      *PivotalConfiguration `json:"pivotal,omitempty" yaml:"pivotal,omitempty"`
+	Slack        *SlackConfiguration   `json:"slack,omitempty" yaml:"slack,omitempty"`
+	// Email sends notifications to the users who subscribed by email if not nil.
+	Email *EmailConfiguration `json:"email,omitempty" yaml:"email,omitempty"`
+	// GithubIssues comments deployments on the GitHub issues referred by the deployed commits if not nil.
+	GithubIssues *GithubIssuesConfiguration `json:"github_issues,omitempty" yaml:"github_issues,omitempty"`
+	// HostTags are the keys of host tags displayed in the host table. All tags are displayed if empty.
+	HostTags []string `json:"host_tags,omitempty" yaml:"host_tags,omitempty"`
+	// ChatHandles maps GitHub logins to handles in chat rooms which notifications mention.
+	ChatHandles map[string]string `json:"chat_handles,omitempty" yaml:"chat_handles,omitempty"`
+	// OIDC enables login with an OpenID Connect provider in addition to GitHub.
+	OIDC *OIDCConfiguration `json:"oidc,omitempty" yaml:"oidc,omitempty"`
+	// Auth selects how users are authenticated.
+	Auth *AuthConfiguration `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// Retention limits how long records of deployments are kept.
+	Retention *RetentionConfiguration `json:"retention,omitempty" yaml:"retention,omitempty"`
+	// ProjectAliases maps old names of renamed projects to the current names. See RenameProject.
+	ProjectAliases map[string]ProjectAlias `json:"project_aliases,omitempty" yaml:"project_aliases,omitempty"`
+	// HostKeys configures verification of SSH host keys of hosts.
+	HostKeys *HostKeysConfiguration `json:"host_keys,omitempty" yaml:"host_keys,omitempty"`
+	// Reports enables usage reports of deployments. They are disabled if nil.
+	Reports *ReportsConfiguration `json:"reports,omitempty" yaml:"reports,omitempty"`
+	// MaxArtifacts is the number of artifacts recorded per deployment. It defaults to artifact.DefaultLimit if zero.
+	MaxArtifacts int `json:"max_artifacts,omitempty" yaml:"max_artifacts,omitempty"`
+	// GitHubApp authenticates goship to GitHub as a GitHub App if not nil. GITHUB_API_TOKEN is used otherwise.
+	GitHubApp *GitHubAppConfiguration `json:"github_app,omitempty" yaml:"github_app,omitempty"`
+	// GitHubWebhookSecret is the secret which GitHub webhook deliveries are signed with. Webhooks are refused if empty.
+	GitHubWebhookSecret string `json:"github_webhook_secret,omitempty" yaml:"github_webhook_secret,omitempty" goship:"secret"`
+	// ConfigErrors are the problems of the global settings in etcd if they are invalid and the last valid ones are used instead. See Fallback.
+	ConfigErrors []string `json:"-" yaml:"-"`
+}
+
+// ChatHandlesOf returns the chat handles of GitHub users "logins". Logins without mapping are used as they are.
+func (c Config) ChatHandlesOf(logins []string) []string {
+	var handles []string
+	for _, l := range logins {
+		if h, ok := c.ChatHandles[l]; ok {
+			l = h
+		}
+		handles = append(handles, l)
+	}
+	return handles
 }
 
 // Project stores information about a GitHub project, such as its GitHub URL and repo name, and a list of extra columns (PluginColumns)
@@ -33,12 +77,61 @@ type Project struct {
 	RepoType     RepositoryType `json:"repo_type" yaml:"repo_type"`
 	HostType     HostType       `json:"host_type" yaml:"host_type"`
 	Environments []Environment  `json:"-" yaml:"envs"`
-	TravisToken  string         `json:"travis_token" yaml:"travis_token"`
+	TravisToken  string         `json:"travis_token" yaml:"travis_token" goship:"secret"`
 	K8sResource  string         `json:"k8s_resource" yaml:"k8s_resource"`
 	K8sSelector  string         `json:"k8s_selector" yaml:"k8s_selector"`
 	// Source is an additional revision control system.
 	// It is effective only if RepoType does not serve source codes.
 	Source *Repo `json:"source,omitempty" yaml:"source,omitempty"`
+	// Repos are the repositories which the project deploys together, as an alternative to the single Repo.
+	// The first one is the primary repository, which Repo defaults to. See SourceRepos.
+	Repos []RepoRef `json:"repos,omitempty" yaml:"repos,omitempty"`
+	// RemoteColumns are URLs of external HTTP endpoints which render additional columns.
+	RemoteColumns []string `json:"remote_columns,omitempty" yaml:"remote_columns,omitempty"`
+	// PluginColumns are additional columns rendered by plugins registered by name. See PluginColumn.
+	PluginColumns []PluginColumn `json:"plugin_columns,omitempty" yaml:"plugin_columns,omitempty"`
+	// Columns are the keys of the columns of the dashboard in order, e.g. [hosts, commit, diff, plugins, deploy].
+	// Columns not listed are hidden. It defaults to DefaultColumns. See ColumnKeys.
+	Columns []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	// StaleBranchDays is how many days branches of environments receive no commits before ColumnCleanup hints them. It defaults to 30.
+	StaleBranchDays int `json:"stale_branch_days,omitempty" yaml:"stale_branch_days,omitempty"`
+	// NotificationOverrides override settings of notification targets by their names for all the environments of the project.
+	NotificationOverrides map[string]NotificationOverride `json:"notification_overrides,omitempty" yaml:"notification_overrides,omitempty"`
+	// Approvers are GitHub logins of the default reviewers of deployment approval requests.
+	Approvers []string `json:"approvers,omitempty" yaml:"approvers,omitempty"`
+	// CommitURLTemplate overrides the URLs of commits, e.g. "https://review.example.com/{{.Repo}}/commit/{{.SHA}}". See URLParams.
+	CommitURLTemplate string `json:"commit_url_template,omitempty" yaml:"commit_url_template,omitempty"`
+	// DiffURLTemplate overrides the URLs of differences between commits, e.g.
+	// "https://bitbucket.org/{{.Owner}}/{{.Repo}}/branches/compare/{{.To}}..{{.From}}". See URLParams.
+	DiffURLTemplate string `json:"diff_url_template,omitempty" yaml:"diff_url_template,omitempty"`
+	// GitHubInstallationID is the installation of the GitHub App which GitHub APIs about the project are called with.
+	// Projects in organizations with their own installations set it. The default installation in GitHubApp is used if zero.
+	GitHubInstallationID int `json:"github_installation_id,omitempty" yaml:"github_installation_id,omitempty"`
+	// CommitStatuses posts GitHub commit statuses like "goship/production" to the deployed revisions.
+	CommitStatuses bool `json:"commit_statuses,omitempty" yaml:"commit_statuses,omitempty"`
+	// PivotalFirstDeploy is how Pivotal stories are found on the first deployment into an environment. Stories are not commented if nil.
+	PivotalFirstDeploy *FirstDeployConfiguration `json:"pivotal_first_deploy,omitempty" yaml:"pivotal_first_deploy,omitempty"`
+	// EphemeralEnvironments create transient environments for branches pushed to the repository. See EphemeralRule.
+	EphemeralEnvironments []EphemeralRule `json:"ephemeral_environments,omitempty" yaml:"ephemeral_environments,omitempty"`
+	// ScriptRepo is a git repository of deploy scripts which is checked out for each deployment if not nil.
+	ScriptRepo *ScriptRepo `json:"script_repo,omitempty" yaml:"script_repo,omitempty"`
+	// CommitAge highlights commits which have waited long to be deployed. The defaults apply if nil.
+	CommitAge *CommitAgeConfiguration `json:"commit_age,omitempty" yaml:"commit_age,omitempty"`
+	// Risk weighs the risk of deploying the pending commits shown in the column "risk". The defaults apply if nil.
+	Risk *RiskConfiguration `json:"risk,omitempty" yaml:"risk,omitempty"`
+	// Impacts are projects, or environments in the form of "project/env", which deploying the project affects
+	// without DependsOn, e.g. the consumers of a shared library. See ProjectImpact.
+	Impacts []string `json:"impacts,omitempty" yaml:"impacts,omitempty"`
+	// ConfigErrors are the problems of the project in etcd if it is invalid and its last valid definition is used instead. See Fallback.
+	ConfigErrors []string `json:"-" yaml:"-"`
+}
+
+// ScriptRepo is a git repository of deploy scripts, e.g. an ops repository shared by projects.
+type ScriptRepo struct {
+	// URL is where the repository is cloned from, e.g. "git@github.com:gengo/ops.git".
+	URL string `json:"url" yaml:"url"`
+	// Ref is the branch, the tag or the commit which is checked out. It defaults to "master".
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
 }
 
 func (p Project) SourceRepo() Repo {
@@ -83,13 +176,117 @@ func (t HostType) Valid() bool {
 
 // Environment stores information about an individual environment, such as its name and whether it is deployable.
 type Environment struct {
-	Name     string   `json:"-" yaml:"name"`
-	Deploy   string   `json:"deploy" yaml:"deploy"`
-	RepoPath string   `json:"repo_path" yaml:"repo_path"`
-	Hosts    []string `json:"hosts" yaml:"hosts,omitempty"`
-	Branch   string   `json:"branch" yaml:"branch"`
-	Comment  string   `json:"comment" yaml:"comment"`
-	IsLocked bool     `json:"is_locked,omitempty" yaml:"is_locked,omitempty"`
+	Name   string `json:"-" yaml:"name"`
+	Deploy string `json:"deploy" yaml:"deploy"`
+	// DeployCommand is the program and arguments of the deployment command.
+	// Each element can contain placeholders like {{.Revision}}, {{.Branch}}, {{.Hosts}} and {{.Environment}}. See DeployParams.
+	// It takes precedence over Deploy.
+	DeployCommand []string `json:"deploy_command,omitempty" yaml:"deploy_command,omitempty"`
+	// Shell makes Deploy run with /bin/sh. It is only for legacy configs which depend on shell features.
+	Shell    bool   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	RepoPath string `json:"repo_path" yaml:"repo_path"`
+	Hosts    []Host `json:"hosts" yaml:"hosts,omitempty"`
+	Branch   string `json:"branch" yaml:"branch"`
+	Comment  string `json:"comment" yaml:"comment"`
+	// Lock is set while the environment is locked. See IsLocked.
+	Lock *EnvironmentLock `json:"lock,omitempty" yaml:"lock,omitempty"`
+	// AutoLock is the lock which goship applied after a failed deployment if LockOnFailure. Lock is set together.
+	AutoLock *AutoLock `json:"auto_lock,omitempty" yaml:"auto_lock,omitempty"`
+	// SSH is how goship authenticates to the hosts, which can override it. The private key given by -k is used if nil.
+	SSH *SSHAuth `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+	// RevisionSource is where the revision deployed into hosts is read instead of the git checkout in RepoPath,
+	// for hosts without a checkout. See RevisionFile and RevisionURLFor.
+	RevisionSource string `json:"revision_source,omitempty" yaml:"revision_source,omitempty"`
+	// RevisionJSONPath is the dot-separated path to the revision in the JSON which RevisionSource of a URL responds with,
+	// e.g. "build.sha". The whole response is the revision if empty.
+	RevisionJSONPath string `json:"revision_json_path,omitempty" yaml:"revision_json_path,omitempty"`
+	// PivotalEvents are the types of deployment events which are posted to Pivotal.
+	// Only successful deployments are posted if empty.
+	PivotalEvents []PivotalEvent `json:"pivotal_events,omitempty" yaml:"pivotal_events,omitempty"`
+	// DependsOn are environments in the form of "project/env" which must be deployed before this environment
+	// when deploying with dependencies.
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	// AllowedFlags are the keys of deploy flags which can be given to deployments of the environment.
+	AllowedFlags []string `json:"allowed_flags,omitempty" yaml:"allowed_flags,omitempty"`
+	// RequireDeployNote makes deployments of the environment rejected unless they have a note of at least MinDeployNoteLength characters.
+	RequireDeployNote bool `json:"require_deploy_note,omitempty" yaml:"require_deploy_note,omitempty"`
+	// DeployCheck means the deployment command supports CheckArg, which checks the command without deploying.
+	DeployCheck bool `json:"deploy_check,omitempty" yaml:"deploy_check,omitempty"`
+	// QuietExternalDeploys disables notifications and Pivotal comments of deployments reported by external tools.
+	QuietExternalDeploys bool `json:"quiet_external_deploys,omitempty" yaml:"quiet_external_deploys,omitempty"`
+	// LockOnFailure locks the environment automatically when a deployment into it fails, until a user unlocks it.
+	LockOnFailure bool `json:"lock_on_failure,omitempty" yaml:"lock_on_failure,omitempty"`
+	// LockBlocksRollback refuses rollbacks while the environment is locked by LockOnFailure. Rollbacks are allowed otherwise,
+	// since they are the usual way out of failed deployments.
+	LockBlocksRollback bool `json:"lock_blocks_rollback,omitempty" yaml:"lock_blocks_rollback,omitempty"`
+	// ConfirmPhrase makes deployments of the environment rejected unless they echo the phrase, e.g. the name of the environment.
+	ConfirmPhrase string `json:"confirm_phrase,omitempty" yaml:"confirm_phrase,omitempty"`
+	// RequireApproval makes deployments of the environment wait until another user who can deploy the project approves them.
+	RequireApproval bool `json:"require_approval,omitempty" yaml:"require_approval,omitempty"`
+	// NotificationOverrides override settings of notification targets by their names for the environment.
+	// They take precedence over the ones of the project. See ResolveNotificationTargets.
+	NotificationOverrides map[string]NotificationOverride `json:"notification_overrides,omitempty" yaml:"notification_overrides,omitempty"`
+	// Ephemeral is set if the environment was created for a branch by an EphemeralRule. It is removed when it expires.
+	Ephemeral *Ephemeral `json:"ephemeral,omitempty" yaml:"ephemeral,omitempty"`
+	// WorkDir is the working directory of the deployment command. Relative paths are relative to the checkout
+	// of the ScriptRepo of the project if configured, or to the working directory of goship otherwise.
+	WorkDir string `json:"work_dir,omitempty" yaml:"work_dir,omitempty"`
+	// Preflight checks the hosts before deployments if not nil.
+	Preflight *PreflightConfiguration `json:"preflight,omitempty" yaml:"preflight,omitempty"`
+	// OnPreflightFailure is what deployments do when some hosts fail the preflight checks, i.e. "abort" (default) or "skip".
+	OnPreflightFailure PreflightPolicy `json:"on_preflight_failure,omitempty" yaml:"on_preflight_failure,omitempty"`
+	// PluginColumns customizes the plugin columns inherited from the project if not nil.
+	PluginColumns *EnvironmentColumns `json:"plugin_columns,omitempty" yaml:"plugin_columns,omitempty"`
+	// Release creates a GitHub release of the deployed revision on successful deployments if not nil.
+	Release *ReleaseConfiguration `json:"release,omitempty" yaml:"release,omitempty"`
+	// RequiresBake rejects deployments of revisions which have not run long enough in another environment if not nil.
+	RequiresBake *BakeRequirement `json:"requires_bake,omitempty" yaml:"requires_bake,omitempty"`
+	// PreDeploy runs before the deploy command if not nil, e.g. to show a maintenance page.
+	PreDeploy *Hook `json:"pre_deploy,omitempty" yaml:"pre_deploy,omitempty"`
+	// PostDeploy runs after the deploy command has succeeded if not nil, e.g. to warm caches or run smoke tests.
+	PostDeploy *Hook `json:"post_deploy,omitempty" yaml:"post_deploy,omitempty"`
+	// Schedules deploy the environment periodically. See Schedule.
+	Schedules []Schedule `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+	// StatusThresholds decides whether the environment is green, yellow or red. The defaults are taken if nil.
+	StatusThresholds *StatusThresholds `json:"status_thresholds,omitempty" yaml:"status_thresholds,omitempty"`
+}
+
+// A PivotalEvent is a type of deployment events which can be posted to Pivotal.
+type PivotalEvent string
+
+const (
+	// PivotalDeploySucceeded means a deployment has successfully finished.
+	PivotalDeploySucceeded = PivotalEvent("deploy_succeeded")
+	// PivotalDeployFailed means a deployment has failed.
+	PivotalDeployFailed = PivotalEvent("deploy_failed")
+	// PivotalRollback means an environment has successfully been rolled back to an older revision.
+	PivotalRollback = PivotalEvent("rollback")
+)
+
+// defaultPivotalEvents are the successful deployments including rollbacks, which were all posted before PivotalEvents.
+var defaultPivotalEvents = []PivotalEvent{PivotalDeploySucceeded, PivotalRollback}
+
+// Valid returns true iff "ev" is a known type of events.
+func (ev PivotalEvent) Valid() bool {
+	switch ev {
+	case PivotalDeploySucceeded, PivotalDeployFailed, PivotalRollback:
+		return true
+	}
+	return false
+}
+
+// PostsToPivotal returns true iff events of type "ev" in the environment should be posted to Pivotal.
+func (e Environment) PostsToPivotal(ev PivotalEvent) bool {
+	events := e.PivotalEvents
+	if len(events) == 0 {
+		events = defaultPivotalEvents
+	}
+	for _, item := range events {
+		if item == ev {
+			return true
+		}
+	}
+	return false
 }
 
 // Repo identifies a revision repository
@@ -100,45 +297,296 @@ type Repo struct {
 
 // PivotalConfiguration used to store Pivotal interface
 type PivotalConfiguration struct {
-	Token    string `json:"token" yaml:"token"`
+	Token    string `json:"token" yaml:"token" goship:"secret"`
 	AddLabel bool   `json:"add_label" yaml:"add_label"`
+	// Concurrency is the number of stories commented at once.
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	// RequestsPerSecond is the maximum rate of requests to Pivotal.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty" yaml:"requests_per_second,omitempty"`
+	// MaxStories is the maximum number of stories commented individually per deployment.
+	MaxStories int `json:"max_stories,omitempty" yaml:"max_stories,omitempty"`
+	// ReleaseStory gets a single comment listing the stories if there are more than MaxStories.
+	ReleaseStory int `json:"release_story,omitempty" yaml:"release_story,omitempty"`
+	// Project is the ID of the project which stories are posted to if their projects cannot be resolved.
+	// Such stories fail if empty.
+	Project string `json:"project,omitempty" yaml:"project,omitempty"`
+	// TestStory is the story which operators post test comments to. See PostTestToPivotal.
+	TestStory int `json:"test_story,omitempty" yaml:"test_story,omitempty"`
 }
 
-func PostToPivotal(piv *PivotalConfiguration, env, owner, name, current, latest string) error {
-	layout := "2006-01-02 15:04:05"
-	timestamp := time.Now()
-	loc, err := time.LoadLocation("Asia/Tokyo")
-	if err != nil {
-		layout += " (UTC)"
-		glog.Error("time zone information for Asia/Tokyo not found")
-	} else {
-		layout += " (JST)"
-		timestamp = timestamp.In(loc)
+// defaultProject returns Project as a number, or zero if it is empty or malformed.
+func (piv PivotalConfiguration) defaultProject() int {
+	if piv.Project == "" {
+		return 0
 	}
-	ids, err := GetPivotalIDFromCommits(owner, name, current, latest)
+	id, err := strconv.Atoi(piv.Project)
+	if err != nil || id <= 0 {
+		glog.Errorf("Ignoring malformed Pivotal project %q", piv.Project)
+		return 0
+	}
+	return id
+}
+
+// OIDCConfiguration is used to authenticate users with an OpenID Connect provider
+type OIDCConfiguration struct {
+	Issuer       string `json:"issuer" yaml:"issuer"`
+	ClientID     string `json:"client_id" yaml:"client_id"`
+	ClientSecret string `json:"client_secret" yaml:"client_secret" goship:"secret"`
+	// RedirectURL is the URL of /auth/oidc/callback of goship.
+	RedirectURL string `json:"redirect_url" yaml:"redirect_url"`
+	// GroupsClaim is the claim of ID tokens which lists groups of users. Defaults to "groups".
+	GroupsClaim string `json:"groups_claim,omitempty" yaml:"groups_claim,omitempty"`
+	// Groups grant permissions to the users in the groups, who do not have permissions in GitHub.
+	Groups []GroupRule `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// RetentionConfiguration limits records of deployments per environment.
+type RetentionConfiguration struct {
+	// Deploys limits entries of the deploy history.
+	Deploys RetentionPolicy `json:"deploys" yaml:"deploys"`
+	// Outputs limits outputs of deployment commands.
+	Outputs RetentionPolicy `json:"outputs" yaml:"outputs"`
+	// Activity limits entries of the activity feed across all projects.
+	Activity RetentionPolicy `json:"activity" yaml:"activity"`
+}
+
+// RetentionPolicy limits records per environment. Zero values mean no limits.
+type RetentionPolicy struct {
+	// MaxAgeDays is how many days records are kept.
+	MaxAgeDays int `json:"max_age_days,omitempty" yaml:"max_age_days,omitempty"`
+	// MaxCount is the number of the most recent records which are kept.
+	MaxCount int `json:"max_count,omitempty" yaml:"max_count,omitempty"`
+}
+
+// Authentication providers which AuthConfiguration can select
+const (
+	AuthGithub    = "github"
+	AuthOIDC      = "oidc"
+	AuthHeader    = "header"
+	AuthAnonymous = "anonymous"
+)
+
+// AuthConfiguration selects how users are authenticated.
+type AuthConfiguration struct {
+	// Provider is one of "github", "oidc", "header" and "anonymous".
+	// GitHub and OpenID Connect are enabled as configured if empty.
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	// Header is the request header which trusted proxies set to the name of the user. It is used by "header".
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// TrustedProxies are CIDRs or IP addresses of the proxies which are trusted to set Header.
+	TrustedProxies []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+}
+
+// GroupRule grants permissions on repositories to a group of OpenID Connect users.
+type GroupRule struct {
+	Group string `json:"group" yaml:"group"`
+	// Repos are repositories in the form of "owner/repo". "owner/*" matches all the repositories of the owner, and "*" matches everything.
+	Repos []string `json:"repos" yaml:"repos"`
+	// Deploy allows the group to deploy in addition to read.
+	Deploy bool `json:"deploy,omitempty" yaml:"deploy,omitempty"`
+}
+
+// HostKeysConfiguration configures verification of SSH host keys.
+type HostKeysConfiguration struct {
+	// TOFU trusts keys of new hosts on first use instead of waiting for approval by an admin.
+	// Changed keys are blocked regardless.
+	TOFU bool `json:"tofu" yaml:"tofu"`
+}
+
+// ReportsConfiguration enables rollups of the deploy history. Rollups are anonymous: they count deployments but not users.
+type ReportsConfiguration struct {
+	// Monthly enables monthly rollups per project and environment.
+	Monthly bool `json:"monthly" yaml:"monthly"`
+	// Timezone is the IANA name of the timezone which months begin in, e.g. "Asia/Tokyo". Months are in UTC if empty.
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// SlackConfiguration is used to notify deployments to a Slack channel with a bot token
+type SlackConfiguration struct {
+	Token   string `json:"token" yaml:"token" goship:"secret"`
+	Channel string `json:"channel" yaml:"channel"`
+	// Digest rolls messages to the channel up if not nil.
+	Digest *DigestConfiguration `json:"digest,omitempty" yaml:"digest,omitempty"`
+	// SigningSecret is the secret which Slack signs slash commands with. Slash commands are refused if empty.
+	SigningSecret string `json:"signing_secret,omitempty" yaml:"signing_secret,omitempty" goship:"secret"`
+	// Users maps Slack user IDs, e.g. "U024BE7LH", to goship users who slash commands run on behalf of.
+	// Slash commands of users without mapping are refused.
+	Users map[string]string `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+// EmailConfiguration is an SMTP server which sends notifications to users.
+type EmailConfiguration struct {
+	// SMTPAddr is the "host:port" of the server.
+	SMTPAddr string `json:"smtp_addr" yaml:"smtp_addr"`
+	// From is the sender address of the mails.
+	From string `json:"from" yaml:"from"`
+	// Username and Password authenticate goship to the server with PLAIN auth. The server is used without auth if Username is empty.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty" goship:"secret"`
+}
+
+// defaultDigestInterval is how long notifications are buffered unless specified.
+const defaultDigestInterval = 10 * time.Minute
+
+// DigestConfiguration rolls notifications of finished deployments up into a message per interval.
+// Failures are notified immediately regardless.
+type DigestConfiguration struct {
+	// IntervalMinutes is how long notifications are buffered. It defaults to 10 minutes.
+	IntervalMinutes int `json:"interval_minutes,omitempty" yaml:"interval_minutes,omitempty"`
+	// MaxEvents sends the rollup as soon as this many deployments are buffered. Zero means no limits.
+	MaxEvents int `json:"max_events,omitempty" yaml:"max_events,omitempty"`
+}
+
+// Interval returns how long notifications are buffered.
+func (d DigestConfiguration) Interval() time.Duration {
+	if d.IntervalMinutes <= 0 {
+		return defaultDigestInterval
+	}
+	return time.Duration(d.IntervalMinutes) * time.Minute
+}
+
+// pivotalProjects caches projects of stories across deployments.
+var pivotalProjects = pivotal.NewProjectCache()
+
+// PostToPivotal posts a comment about the deployment event "ev" by "user" to the stories referred by the commits of "proj" between "current" and "latest"
+// with the deploy note if not empty. The comment of each story links to the commits which refer to it.
+// If "current" is empty, stories are found as configured in PivotalFirstDeploy of "proj". It returns ErrFirstDeploy if it finds no stories in that way,
+// and ErrBaseMissing if the revision to compare with no longer exists on GitHub.
+// It also returns the post with the stories which failed, which can be retried by RetryPivotal.
+// It fails with ErrPivotalUnauthorized if no token is configured.
+// The commits in "others", the other repositories of a multi-repo project, are linked from the stories as well.
+func PostToPivotal(piv *PivotalConfiguration, proj Project, ev PivotalEvent, env, current, latest, user, note string, others ...RepoRange) (pivotal.Summary, pivotal.Post, error) {
+	if piv.Token == "" {
+		return pivotal.Summary{}, pivotal.Post{}, errorf(ErrPivotalUnauthorized, "pivotal token not configured")
+	}
+	base, head := current, latest
+	if ev == PivotalRollback {
+		// Stories between the rolled back revision and the new one are affected.
+		base, head = latest, current
+	}
+	repo := proj.SourceRepo()
+	gcl := newGithubClient()
+	sc, err := PivotalStoryCommits(gcl, proj.PivotalFirstDeploy, repo.RepoOwner, repo.RepoName, base, head, time.Now())
 	if err != nil {
-		return err
+		return pivotal.Summary{}, pivotal.Post{}, err
 	}
-	pivClient := pivotal.NewClient(piv.Token)
-	for _, id := range ids {
-		project, err := pivClient.FindProjectForStory(id)
-		if err != nil {
-			glog.Errorf("error getting project for story %d: %v", id, err)
-			continue
+	p := pivotal.Post{
+		Comment: PivotalMessage(ev, env, repo.RepoName, current, latest, commentTimestamp(time.Now()), user, note),
+	}
+	if len(others) == 0 {
+		p.Stories = sc.IDs()
+		for id, shas := range sc {
+			p.SetDetail(id, PivotalCommitLinks(proj, shas, base, head))
+		}
+	} else {
+		details := make(map[int][]string)
+		for id, shas := range sc {
+			details[id] = []string{fmt.Sprintf("%s/%s\n%s", repo.RepoOwner, repo.RepoName, PivotalCommitLinks(proj, shas, base, head))}
 		}
-		m := fmt.Sprintf("Deployed %s to %s: %s", name, env, timestamp.Format(layout))
-		if err := pivClient.AddComment(id, project, m); err != nil {
-			glog.Errorf("failed to post a comment %q to story %d", m, id)
+		repoStoryDetails(gcl, proj, ev, others, details, time.Now())
+		for id, lines := range details {
+			p.Stories = append(p.Stories, id)
+			p.SetDetail(id, strings.Join(lines, "\n\n"))
 		}
-		if piv.AddLabel {
-			year, week := time.Now().ISOWeek()
-			label := fmt.Sprintf("released_w%d/%d", week, year)
-			if err := pivClient.AddLabel(id, project, label); err != nil {
-				glog.Errorf("Failed to add a label %q to story %d", label, id)
+		sort.Ints(p.Stories)
+	}
+	if piv.AddLabel && ev == PivotalDeploySucceeded {
+		year, week := time.Now().ISOWeek()
+		p.Label = fmt.Sprintf("released_w%d/%d", week, year)
+	}
+	sum, rest := pivotal.PostStories(pivotal.NewClient(piv.Token), p, piv.batchOptions())
+	return sum, rest, nil
+}
+
+// RetryPivotal posts "p" returned by PostToPivotal again, and returns the post with the stories which failed again.
+func RetryPivotal(piv *PivotalConfiguration, p pivotal.Post) (pivotal.Summary, pivotal.Post, error) {
+	if piv == nil || piv.Token == "" {
+		return pivotal.Summary{}, p, errorf(ErrPivotalUnauthorized, "pivotal token not configured")
+	}
+	sum, rest := pivotal.PostStories(pivotal.NewClient(piv.Token), p, piv.batchOptions())
+	return sum, rest, nil
+}
+
+// PostTestToPivotal posts the comment of the deployment event "ev" of "proj" at "at" to TestStory of "piv" as a test,
+// as PostToPivotal would post to the stories of the deployment. It returns the comment and the HTTP status of Pivotal.
+// It fails with ErrPivotalUnauthorized if no token is configured, and with ErrInvalid if no test story is.
+func PostTestToPivotal(piv *PivotalConfiguration, proj Project, ev PivotalEvent, env, current, latest, user, note string, at time.Time) (string, int, error) {
+	if piv == nil || piv.Token == "" {
+		return "", 0, errorf(ErrPivotalUnauthorized, "pivotal token not configured")
+	}
+	if piv.TestStory <= 0 {
+		return "", 0, errorf(ErrInvalid, "pivotal test_story not configured")
+	}
+	comment := PivotalMessage(ev, env, proj.SourceRepo().RepoName, current, latest, commentTimestamp(at), user, note)
+	return pivotal.PostTest(pivotal.NewClient(piv.Token), piv.TestStory, comment)
+}
+
+func (piv PivotalConfiguration) batchOptions() pivotal.BatchOptions {
+	return pivotal.BatchOptions{
+		Concurrency:       piv.Concurrency,
+		RequestsPerSecond: piv.RequestsPerSecond,
+		MaxStories:        piv.MaxStories,
+		ReleaseStory:      piv.ReleaseStory,
+		DefaultProject:    piv.defaultProject(),
+		Projects:          pivotalProjects,
+	}
+}
+
+// commentTimestamp formats "t" in JST for the comments on stories and issues, or in UTC if the time zone is not available.
+func commentTimestamp(t time.Time) string {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		glog.Error("time zone information for Asia/Tokyo not found")
+		return t.UTC().Format("2006-01-02 15:04:05 (UTC)")
+	}
+	return t.In(loc).Format("2006-01-02 15:04:05 (JST)")
+}
+
+// PivotalMessage returns a comment about the deployment event "ev" by "user" to be posted to Pivotal.
+// The deploy note is appended if not empty.
+func PivotalMessage(ev PivotalEvent, env, name, current, latest, timestamp, user, note string) string {
+	var msg string
+	switch ev {
+	case PivotalDeployFailed:
+		msg = fmt.Sprintf("Deploy of %s to %s by %s FAILED at %s", name, env, user, timestamp)
+	case PivotalRollback:
+		msg = fmt.Sprintf("Rolled back %s in %s from %s to %s by %s: %s", name, env, shortRevision(current), shortRevision(latest), user, timestamp)
+	default:
+		msg = fmt.Sprintf("Deployed %s to %s by %s: %s", name, env, user, timestamp)
+	}
+	if note != "" {
+		msg += "\n\nNote: " + note
+	}
+	return msg
+}
+
+// maxPivotalCommitLinks is the maximum number of commits linked from the comment of a story.
+const maxPivotalCommitLinks = 10
+
+// PivotalCommitLinks returns the links to the commits "shas" of "proj" which refer to a story, to be appended to its comment.
+// Commits beyond maxPivotalCommitLinks are summarized into a link to the comparison of "base" and "head",
+// or only counted if "base" is empty.
+func PivotalCommitLinks(proj Project, shas []string, base, head string) string {
+	lines := []string{"Commits:"}
+	for i, sha := range shas {
+		if i == maxPivotalCommitLinks {
+			more := fmt.Sprintf("+%d more", len(shas)-i)
+			if base != "" {
+				more += ": " + proj.CompareURL(base, head)
 			}
+			lines = append(lines, more)
+			break
 		}
+		lines = append(lines, proj.commitLink(sha))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func shortRevision(rev string) string {
+	if len(rev) <= 7 {
+		return rev
 	}
-	return nil
+	return rev[:7]
 }
 
 func appendIfUnique(list []int, elem int) []int {
@@ -150,61 +598,114 @@ func appendIfUnique(list []int, elem int) []int {
 	return append(list, elem)
 }
 
+// GetPivotalIDFromCommits returns the IDs of Pivotal stories referred by the commits after "current" up to "latest" in the repository.
+// It is kept for compatibility. Use GetPivotalCommitsFromCommits to know which commits refer to each story.
 func GetPivotalIDFromCommits(owner, repoName, current, latest string) ([]int, error) {
-	// gets a list pivotal IDs from commit messages from repository based on latest and current commit
-	gt := os.Getenv(gitHubAPITokenEnvVar)
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: gt})
-	c := github.NewClient(oauth2.NewClient(oauth2.NoContext, ts))
-	comp, _, err := c.Repositories.CompareCommits(owner, repoName, current, latest)
+	sc, err := GetPivotalCommitsFromCommits(owner, repoName, current, latest)
 	if err != nil {
 		return nil, err
 	}
-	pivRE, err := regexp.Compile("\\[.*#(\\d+)\\].*")
+	return sc.IDs(), nil
+}
+
+// GetPivotalCommitsFromCommits returns the stories referred by the commits after "current" up to "latest" in the repository
+// with the commits which refer to each of them.
+func GetPivotalCommitsFromCommits(owner, repoName, current, latest string) (StoryCommits, error) {
+	comp, _, err := newGithubClient().CompareCommits(owner, repoName, current, latest)
+	if githublib.IsMissingCommit(err) {
+		return nil, ErrBaseMissing
+	}
 	if err != nil {
-		return nil, err
+		return nil, githubError(err)
 	}
-	var pivotalIDs []int
-	for _, commit := range comp.Commits {
-		cmi := *commit.Commit
-		cm := *cmi.Message
-		ids := pivRE.FindStringSubmatch(cm)
-		if ids != nil {
-			id := ids[1]
-			n, err := strconv.Atoi(id)
-			if err != nil {
-				return nil, err
-			}
-			pivotalIDs = appendIfUnique(pivotalIDs, n)
+	return pivotalCommits(comp.Commits)
+}
+
+// StoryCommits maps IDs of Pivotal stories to the SHAs of the commits which refer to them, in the order of the commits.
+type StoryCommits map[int][]string
+
+// IDs returns the IDs of the stories in ascending order.
+func (sc StoryCommits) IDs() []int {
+	ids := make([]int, 0, len(sc))
+	for id := range sc {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+var pivRE = regexp.MustCompile("\\[.*#(\\d+)\\].*")
+
+// PivotalStoryOf returns the ID of the Pivotal story which the commit message "msg" refers to, or 0 if none.
+func PivotalStoryOf(msg string) int {
+	m := pivRE.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// pivotalIDs returns the IDs of Pivotal stories referred by the messages of "commits".
+func pivotalIDs(commits []github.RepositoryCommit) ([]int, error) {
+	var ids []int
+	for _, commit := range commits {
+		m := pivRE.FindStringSubmatch(*commit.Commit.Message)
+		if m == nil {
+			continue
 		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		ids = appendIfUnique(ids, n)
 	}
-	return pivotalIDs, nil
+	return ids, nil
+}
+
+// pivotalCommits returns the stories referred by the messages of "commits" with the SHAs of the commits.
+func pivotalCommits(commits []github.RepositoryCommit) (StoryCommits, error) {
+	sc := make(StoryCommits)
+	for _, commit := range commits {
+		if commit.SHA == nil || commit.Commit == nil || commit.Commit.Message == nil {
+			continue
+		}
+		m := pivRE.FindStringSubmatch(*commit.Commit.Message)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		sc[n] = append(sc[n], *commit.SHA)
+	}
+	return sc, nil
 }
 
 // ProjectFromName takes a project name as a string and returns
-// a project by that name if it can find one.
+// a copy of the project by that name if it can find one. Handlers use FindProject instead.
 func ProjectFromName(projects []Project, projectName string) (Project, error) {
-	for _, project := range projects {
-		if project.Name == projectName {
-			return project, nil
-		}
+	p, err := FindProject(projects, projectName)
+	if err != nil {
+		return Project{}, err
 	}
-	return Project{}, fmt.Errorf("No project found: %s", projectName)
+	return *p, nil
 }
 
 // EnvironmentFromName takes an environment and project name as a string and returns
-// an environment by the given environment name under a project with the given
-// project name if it can find one.
-func EnvironmentFromName(projects []Project, projectName, environmentName string) (*Environment, error) {
-	p, err := ProjectFromName(projects, projectName)
+// copies of the project with the given project name and of its environment by the given
+// environment name if it can find them. Handlers use ResolveTarget instead, whose results point into "projects".
+func EnvironmentFromName(projects []Project, projectName, environmentName string) (Project, *Environment, error) {
+	p, e, err := ResolveTarget(projects, projectName, environmentName)
 	if err != nil {
-		return nil, err
-	}
-	for _, environment := range p.Environments {
-		if environment.Name == environmentName {
-			return &environment, nil
-		}
+		return Project{}, nil, err
 	}
-	return nil, fmt.Errorf("No environment found: %s", environmentName)
+	env := *e
+	return *p, &env, nil
 }
 
 // ETCDInterface emulates ETCD to allow testing
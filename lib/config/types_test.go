@@ -1,7 +1,9 @@
 package config_test
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gengo/goship/lib/config"
@@ -29,15 +31,113 @@ func TestGetEnvironmentFromName(t *testing.T) {
 		envs = []config.Environment{want}
 	)
 	projects := []config.Project{config.Project{Name: "TestProject", Environments: envs}}
-	got, err := config.EnvironmentFromName(projects, "TestProject", "TestEnvironment")
+	proj, got, err := config.EnvironmentFromName(projects, "TestProject", "TestEnvironment")
 	if err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(got, &want) {
 		t.Errorf("config.EnvironmentFromName = %v, want %v", got, want)
 	}
-	got, err = config.EnvironmentFromName(projects, "BadProject", "BadEnvironment")
+	if !reflect.DeepEqual(proj, projects[0]) {
+		t.Errorf("project of config.EnvironmentFromName = %v, want %v", proj, projects[0])
+	}
+	// the results are copies.
+	got.Branch = "release"
+	if projects[0].Environments[0].Branch != "" {
+		t.Errorf("branch in projects = %q after changing the result; want unchanged", projects[0].Environments[0].Branch)
+	}
+	_, got, err = config.EnvironmentFromName(projects, "BadProject", "BadEnvironment")
 	if err == nil {
 		t.Errorf("config.EnvironmentFromName error case did not error")
 	}
 }
+
+func TestPostsToPivotal(t *testing.T) {
+	for _, spec := range []struct {
+		events []config.PivotalEvent
+		ev     config.PivotalEvent
+		want   bool
+	}{
+		{ev: config.PivotalDeploySucceeded, want: true},
+		{ev: config.PivotalDeployFailed, want: false},
+		// rollbacks are successful deployments too.
+		{ev: config.PivotalRollback, want: true},
+		{events: []config.PivotalEvent{config.PivotalDeployFailed}, ev: config.PivotalDeploySucceeded, want: false},
+		{events: []config.PivotalEvent{config.PivotalDeployFailed}, ev: config.PivotalDeployFailed, want: true},
+		{events: []config.PivotalEvent{config.PivotalDeploySucceeded, config.PivotalRollback}, ev: config.PivotalRollback, want: true},
+	} {
+		env := config.Environment{Name: "production", PivotalEvents: spec.events}
+		if got := env.PostsToPivotal(spec.ev); got != spec.want {
+			t.Errorf("env.PostsToPivotal(%q) = %v with %q; want %v", spec.ev, got, spec.events, spec.want)
+		}
+	}
+}
+
+func TestPivotalMessage(t *testing.T) {
+	const ts = "2015-08-01 12:00:00 (JST)"
+	for _, spec := range []struct {
+		ev   config.PivotalEvent
+		note string
+		want string
+	}{
+		{ev: config.PivotalDeploySucceeded, want: "Deployed goship to production by alice: 2015-08-01 12:00:00 (JST)"},
+		{ev: config.PivotalDeployFailed, want: "Deploy of goship to production by alice FAILED at 2015-08-01 12:00:00 (JST)"},
+		{ev: config.PivotalRollback, want: "Rolled back goship in production from fedcba9 to 0123456 by alice: 2015-08-01 12:00:00 (JST)"},
+		{
+			ev:   config.PivotalRollback,
+			note: "Checkout is broken",
+			want: "Rolled back goship in production from fedcba9 to 0123456 by alice: 2015-08-01 12:00:00 (JST)\n\nNote: Checkout is broken",
+		},
+	} {
+		got := config.PivotalMessage(spec.ev, "production", "goship", "fedcba9876543210", "0123456789abcdef", ts, "alice", spec.note)
+		if got != spec.want {
+			t.Errorf("config.PivotalMessage(%q, ...) = %q; want %q", spec.ev, got, spec.want)
+		}
+	}
+}
+
+func TestPivotalCommitLinks(t *testing.T) {
+	proj := config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+	var shas []string
+	for i := 0; i < 12; i++ {
+		shas = append(shas, fmt.Sprintf("sha%d", i))
+	}
+
+	got := config.PivotalCommitLinks(proj, shas[:2], "base", "head")
+	want := "Commits:\nhttps://github.com/gengo/goship/commit/sha0\nhttps://github.com/gengo/goship/commit/sha1"
+	if got != want {
+		t.Errorf("config.PivotalCommitLinks(proj, %q, ...) = %q; want %q", shas[:2], got, want)
+	}
+
+	got = config.PivotalCommitLinks(proj, shas, "base", "head")
+	lines := strings.Split(got, "\n")
+	if n := len(lines); n != 12 {
+		t.Errorf("config.PivotalCommitLinks(...) has %d lines; want 12 with the first 10 commits", n)
+	}
+	if last, want := lines[len(lines)-1], "+2 more: https://github.com/gengo/goship/compare/base...head"; last != want {
+		t.Errorf("last line = %q; want %q", last, want)
+	}
+	// first deploy without the base
+	lines = strings.Split(config.PivotalCommitLinks(proj, shas, "", "head"), "\n")
+	if last, want := lines[len(lines)-1], "+2 more"; last != want {
+		t.Errorf("last line = %q without the base; want %q", last, want)
+	}
+
+	proj.CommitURLTemplate = "https://review.example.com/{{.Repo}}/commit/{{.SHA}}"
+	proj.DiffURLTemplate = "https://review.example.com/{{.Repo}}/diff/{{.From}}..{{.To}}"
+	lines = strings.Split(config.PivotalCommitLinks(proj, shas, "base", "head"), "\n")
+	if got, want := lines[1], "https://review.example.com/goship/commit/sha0"; got != want {
+		t.Errorf("commit link = %q; want %q", got, want)
+	}
+	if last, want := lines[len(lines)-1], "+2 more: https://review.example.com/goship/diff/base..head"; last != want {
+		t.Errorf("last line = %q; want %q", last, want)
+	}
+}
+
+func TestChatHandlesOf(t *testing.T) {
+	c := config.Config{ChatHandles: map[string]string{"alice": "alice.s", "bob": "U0B0B"}}
+	logins := []string{"alice", "carol", "bob"}
+	if got, want := c.ChatHandlesOf(logins), []string{"alice.s", "carol", "U0B0B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("c.ChatHandlesOf(%q) = %q; want %q", logins, got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import "strings"
+
+// Unconfigured returns true if the environment has no hosts yet, e.g. a placeholder in a newly added project.
+func (e Environment) Unconfigured() bool {
+	return len(e.Hosts) == 0
+}
+
+// RequireHosts returns an error of ErrUnconfigured if the environment of the project "proj" has no hosts to deploy into.
+func (e Environment) RequireHosts(proj string) error {
+	if !e.Unconfigured() {
+		return nil
+	}
+	return errorf(ErrUnconfigured, "%s-%s has no hosts configured; ask an admin to add hosts before deploying", proj, e.Name)
+}
+
+// ParseHosts parses a comma- or newline-separated list of host names.
+func ParseHosts(s string) []Host {
+	var hosts []Host
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if f = strings.TrimSpace(f); f != "" {
+			hosts = append(hosts, Host{Name: f})
+		}
+	}
+	return hosts
+}
+
+// SetHosts replaces the hosts of "projectEnv" of "projectName" with "hosts".
+// Hosts which were already in the environment keep their tags unless "hosts" gives them new ones.
+func SetHosts(client ETCDInterface, projectName, projectEnv string, hosts []Host) error {
+	if len(hosts) == 0 {
+		return errorf(ErrInvalid, "no hosts given for %s-%s", projectName, projectEnv)
+	}
+	hosts = append([]Host(nil), hosts...)
+	if err := normalizeHosts(hosts); err != nil {
+		return err
+	}
+	return updateEnvironment(client, projectName, projectEnv, func(env *Environment) bool {
+		tags := make(map[string]map[string]string)
+		for _, h := range env.Hosts {
+			tags[h.Name] = h.Tags
+		}
+		for i, h := range hosts {
+			if len(h.Tags) == 0 {
+				hosts[i].Tags = tags[h.Name]
+			}
+		}
+		env.Hosts = hosts
+		return true
+	})
+}
@@ -0,0 +1,70 @@
+package config_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestRequireHosts(t *testing.T) {
+	if err := (config.Environment{Name: "production", Hosts: []config.Host{{Name: "web1"}}}).RequireHosts("api"); err != nil {
+		t.Errorf("RequireHosts(%q) failed with %v for an environment with hosts", "api", err)
+	}
+	err := config.Environment{Name: "production"}.RequireHosts("api")
+	if config.Cause(err) != config.ErrUnconfigured {
+		t.Errorf("RequireHosts(%q) = %v for an environment without hosts; want %v", "api", err, config.ErrUnconfigured)
+	}
+	if got := config.StatusCode(err); got != http.StatusConflict {
+		t.Errorf("config.StatusCode(%v) = %d; want %d", err, got, http.StatusConflict)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	got := config.ParseHosts(" web1.example.com,web2.example.com\r\n\nweb3.example.com, ")
+	want := []config.Host{{Name: "web1.example.com"}, {Name: "web2.example.com"}, {Name: "web3.example.com"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config.ParseHosts(...) = %#v; want %#v", got, want)
+	}
+	if got := config.ParseHosts(" , "); len(got) != 0 {
+		t.Errorf("config.ParseHosts(%q) = %#v; want none", " , ", got)
+	}
+}
+
+func TestSetHosts(t *testing.T) {
+	s := memStore{values: make(map[string]string)}
+	cfg := config.Config{Projects: []config.Project{{
+		Name: "api",
+		Environments: []config.Environment{
+			{Name: "production", Deploy: "/bin/true", Hosts: []config.Host{{Name: "web1", Tags: map[string]string{"zone": "a"}}}},
+			{Name: "staging", Deploy: "/bin/true"},
+		},
+	}}}
+	if err := config.Store(s, cfg); err != nil {
+		t.Fatalf("config.Store(s, cfg) failed with %v", err)
+	}
+
+	if err := config.SetHosts(s, "api", "staging", config.ParseHosts("stg1, [2001:db8::1]")); err != nil {
+		t.Fatalf("config.SetHosts(s, %q, %q, ...) failed with %v", "api", "staging", err)
+	}
+	env := storedEnvironment(t, s, "api", "staging")
+	if want := []config.Host{{Name: "stg1"}, {Name: "[2001:db8::1]"}}; !reflect.DeepEqual(env.Hosts, want) || env.Unconfigured() {
+		t.Errorf("staging.Hosts = %#v; want %#v", env.Hosts, want)
+	}
+
+	// web1 keeps its tags.
+	if err := config.SetHosts(s, "api", "production", config.ParseHosts("web1,web2")); err != nil {
+		t.Fatalf("config.SetHosts(s, %q, %q, ...) failed with %v", "api", "production", err)
+	}
+	env = storedEnvironment(t, s, "api", "production")
+	if want := []config.Host{{Name: "web1", Tags: map[string]string{"zone": "a"}}, {Name: "web2"}}; !reflect.DeepEqual(env.Hosts, want) {
+		t.Errorf("production.Hosts = %#v; want %#v", env.Hosts, want)
+	}
+
+	for _, hosts := range []string{"", "web1,[web2]"} {
+		if err := config.SetHosts(s, "api", "production", config.ParseHosts(hosts)); config.Cause(err) != config.ErrInvalid {
+			t.Errorf("config.SetHosts(s, %q, %q, %q) = %v; want %v", "api", "production", hosts, err, config.ErrInvalid)
+		}
+	}
+}
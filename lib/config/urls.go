@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+)
+
+// URLParams are the values which placeholders in Project.CommitURLTemplate and Project.DiffURLTemplate refer to.
+// All values are URL-escaped.
+type URLParams struct {
+	// Owner and Repo are the source repository of the project.
+	Owner, Repo string
+	// SHA is the commit. It is set only for CommitURLTemplate.
+	SHA string
+	// From and To are the range of commits. They are set only for DiffURLTemplate.
+	From, To string
+}
+
+// CommitURL returns the URL of the commit "sha" rendered with CommitURLTemplate.
+// It returns an empty string if CommitURLTemplate is not set.
+func (p Project) CommitURL(sha string) string {
+	return p.renderURL("commit_url_template", p.CommitURLTemplate, URLParams{SHA: escapeURL(sha)})
+}
+
+// DiffURL returns the URL of the difference between "from" and "to" rendered with DiffURLTemplate.
+// It returns an empty string if DiffURLTemplate is not set.
+func (p Project) DiffURL(from, to string) string {
+	return p.renderURL("diff_url_template", p.DiffURLTemplate, URLParams{From: escapeURL(from), To: escapeURL(to)})
+}
+
+// commitLink returns CommitURL of "sha", or the commit on GitHub if CommitURLTemplate is not set.
+func (p Project) commitLink(sha string) string {
+	if u := p.CommitURL(sha); u != "" {
+		return u
+	}
+	repo := p.SourceRepo()
+	return fmt.Sprintf("https://github.com/%s/%s/commit/%s", repo.RepoOwner, repo.RepoName, sha)
+}
+
+// CompareURL returns DiffURL of "from" and "to", or their comparison on GitHub if DiffURLTemplate is not set.
+func (p Project) CompareURL(from, to string) string {
+	if u := p.DiffURL(from, to); u != "" {
+		return u
+	}
+	repo := p.SourceRepo()
+	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", repo.RepoOwner, repo.RepoName, from, to)
+}
+
+func (p Project) renderURL(name, tmpl string, params URLParams) string {
+	if tmpl == "" {
+		return ""
+	}
+	repo := p.SourceRepo()
+	params.Owner, params.Repo = escapeURL(repo.RepoOwner), escapeURL(repo.RepoName)
+	s, err := renderURLTemplate(name, tmpl, params)
+	if err != nil {
+		glog.Errorf("Failed to render %s of %s: %v", name, p.Name, err)
+		return ""
+	}
+	return s
+}
+
+func renderURLTemplate(name, tmpl string, params URLParams) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// validateURLTemplates returns an error if CommitURLTemplate or DiffURLTemplate of the project cannot be rendered.
+func (p Project) validateURLTemplates() error {
+	for _, spec := range []struct {
+		name, tmpl string
+	}{
+		{name: "commit_url_template", tmpl: p.CommitURLTemplate},
+		{name: "diff_url_template", tmpl: p.DiffURLTemplate},
+	} {
+		if spec.tmpl == "" {
+			continue
+		}
+		if _, err := renderURLTemplate(spec.name, spec.tmpl, URLParams{}); err != nil {
+			return errorf(ErrInvalid, "invalid %s in %s: %v", spec.name, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// escapeURL escapes "s" so that it can be placed in both paths and queries of URLs.
+func escapeURL(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
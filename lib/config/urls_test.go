@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestCommitURL(t *testing.T) {
+	repo := config.Repo{RepoOwner: "gengo", RepoName: "goship"}
+	for _, spec := range []struct {
+		tmpl, sha string
+		want      string
+	}{
+		{tmpl: "", sha: "abc123", want: ""},
+		{tmpl: "https://bitbucket.org/{{.Owner}}/{{.Repo}}/commits/{{.SHA}}", sha: "abc123", want: "https://bitbucket.org/gengo/goship/commits/abc123"},
+		{tmpl: "https://git.example.com/cgit/{{.Repo}}/commit/?id={{.SHA}}", sha: "a b&c/d", want: "https://git.example.com/cgit/goship/commit/?id=a%20b%26c%2Fd"},
+	} {
+		p := config.Project{Name: "goship", Repo: repo, CommitURLTemplate: spec.tmpl}
+		if got := p.CommitURL(spec.sha); got != spec.want {
+			t.Errorf("p.CommitURL(%q) with %q = %q; want %q", spec.sha, spec.tmpl, got, spec.want)
+		}
+	}
+}
+
+func TestDiffURL(t *testing.T) {
+	for _, spec := range []struct {
+		p        config.Project
+		from, to string
+		want     string
+	}{
+		{
+			p:    config.Project{Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}},
+			from: "abc123", to: "abc456",
+			want: "",
+		},
+		{
+			p: config.Project{
+				Repo:            config.Repo{RepoOwner: "gengo", RepoName: "goship"},
+				DiffURLTemplate: "https://bitbucket.org/{{.Owner}}/{{.Repo}}/branches/compare/{{.To}}..{{.From}}",
+			},
+			from: "abc123", to: "abc456",
+			want: "https://bitbucket.org/gengo/goship/branches/compare/abc456..abc123",
+		},
+		{
+			// the source repo is used rather than the deployed image
+			p: config.Project{
+				Repo:            config.Repo{RepoOwner: "gengo", RepoName: "goship-image"},
+				Source:          &config.Repo{RepoOwner: "gengo", RepoName: "goship src"},
+				DiffURLTemplate: "https://git.example.com/{{.Repo}}/compare/{{.From}}...{{.To}}",
+			},
+			from: "v1+1", to: "v2",
+			want: "https://git.example.com/goship%20src/compare/v1%2B1...v2",
+		},
+	} {
+		if got := spec.p.DiffURL(spec.from, spec.to); got != spec.want {
+			t.Errorf("p.DiffURL(%q, %q) with %q = %q; want %q", spec.from, spec.to, spec.p.DiffURLTemplate, got, spec.want)
+		}
+	}
+}
+
+func TestLoadSkipsInvalidURLTemplates(t *testing.T) {
+	project := func(name, cfg string) *etcd.Node {
+		return &etcd.Node{
+			Key: "/goship/projects/" + name,
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/goship/projects/" + name + "/config", Value: cfg},
+				{Key: "/goship/projects/" + name + "/environments", Dir: true},
+			},
+		}
+	}
+	ecl := mockEtcdClient{
+		getExpectation: map[string]*etcd.Node{
+			"/goship/config": &etcd.Node{Key: "/goship/config", Value: `{}`},
+			"/goship/projects": &etcd.Node{
+				Key: "/goship/projects",
+				Dir: true,
+				Nodes: etcd.Nodes{
+					project("valid", `{"repo_name": "valid", "repo_owner": "gengo", "commit_url_template": "https://git.example.com/{{.Repo}}/{{.SHA}}"}`),
+					project("unparsable", `{"repo_name": "unparsable", "repo_owner": "gengo", "commit_url_template": "https://git.example.com/{{.SHA"}`),
+					project("unknown-field", `{"repo_name": "unknown-field", "repo_owner": "gengo", "diff_url_template": "https://git.example.com/{{.Base}}"}`),
+				},
+			},
+		},
+	}
+	c, err := config.Load(ecl)
+	if err != nil {
+		t.Fatalf("config.Load(ecl) failed with %v; want success", err)
+	}
+	var names []string
+	for _, p := range c.Projects {
+		names = append(names, p.Name)
+	}
+	if want := []string{"valid"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("projects = %q; want %q", names, want)
+	}
+}
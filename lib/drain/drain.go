@@ -0,0 +1,76 @@
+// Package drain manages hosts taken out of deployments, e.g. during OS maintenance.
+// Drains are stored apart from the configuration so that they survive reloads of it.
+package drain
+
+import (
+	"path"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/hostset"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains drains in "<project>/<environment>/<host>".
+	keyPrefix = "/goship/drains"
+)
+
+// Hosts is the set of drained hosts.
+var Hosts = hostset.Set{Prefix: keyPrefix, Noun: "drain", Verb: "drain", Undo: "undrain"}
+
+// Store is the subset of etcd.Client which stores drains.
+type Store hostset.Store
+
+// Drain describes a drained host. Its Reason is always empty.
+type Drain hostset.Mark
+
+// Set drains "host" in "env" of "proj" on behalf of "by".
+// The drain is cleared after "ttl" unless "ttl" is zero.
+func Set(s Store, proj, env, host, by string, ttl time.Duration, now time.Time) (Drain, error) {
+	m, err := Hosts.Add(s, proj, env, host, by, "", ttl, now)
+	return Drain(m), err
+}
+
+// Rename moves the drains of the project "from" to the project "to" as of "now".
+// Drains keep who drained the hosts, since when and until when.
+func Rename(s Store, from, to string, now time.Time) error {
+	return Hosts.Rename(s, from, to, now)
+}
+
+// Clear puts "host" in "env" of "proj" back into deployments. It is not an error if the host is not drained.
+func Clear(s Store, proj, env, host string) error {
+	return Hosts.Remove(s, proj, env, host)
+}
+
+// Drains are drained hosts keyed by "<project>/<environment>/<host>".
+type Drains map[string]Drain
+
+// Load returns the hosts drained at "now".
+func Load(s Store, now time.Time) (Drains, error) {
+	ms, err := Hosts.Load(s, now)
+	if err != nil {
+		return nil, err
+	}
+	ds := make(Drains, len(ms))
+	for k, m := range ms {
+		ds[k] = Drain(m)
+	}
+	return ds, nil
+}
+
+// Get returns the drain of "host" in "env" of "proj" if drained.
+func (ds Drains) Get(proj, env, host string) (Drain, bool) {
+	d, ok := ds[path.Join(proj, env, host)]
+	return d, ok
+}
+
+// Active returns the hosts in "hosts" of "env" of "proj" which are not drained.
+func (ds Drains) Active(proj, env string, hosts []config.Host) []config.Host {
+	active := make([]config.Host, 0, len(hosts))
+	for _, h := range hosts {
+		if _, ok := ds.Get(proj, env, h.Name); !ok {
+			active = append(active, h)
+		}
+	}
+	return active
+}
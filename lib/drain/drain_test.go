@@ -0,0 +1,122 @@
+package drain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSetAndLoad(t *testing.T) {
+	s := etcdtest.NewStore()
+	if ds, err := Load(s, now); err != nil || len(ds) != 0 {
+		t.Errorf("Load(s, now) = %#v, %v; want no drains", ds, err)
+	}
+	web1, err := Set(s, "api", "production", "web1", "alice", 0, now)
+	if err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web1", err)
+	}
+	if _, err := Set(s, "api", "production", "web2", "bob", 90*time.Minute, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web2", err)
+	}
+	if _, err := Set(s, "api", "staging", "web1", "carol", 0, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web1", err)
+	}
+	if got, want := s.TTLs[keyPrefix+"/api/production/web2"], uint64(90*60); got != want {
+		t.Errorf("ttl of web2 = %d; want %d", got, want)
+	}
+
+	ds, err := Load(s, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Load(s, now+1h) failed with %v", err)
+	}
+	if got, ok := ds.Get("api", "production", "web1"); !ok || !reflect.DeepEqual(got, web1) {
+		t.Errorf("ds.Get(%q, %q, %q) = %#v, %v; want %#v, true", "api", "production", "web1", got, ok, web1)
+	}
+	if got, ok := ds.Get("api", "production", "web2"); !ok || got.By != "bob" || got.Until == nil || !got.Until.Equal(now.Add(90*time.Minute)) {
+		t.Errorf("ds.Get(%q, %q, %q) = %#v, %v; want drained by bob until now+90m", "api", "production", "web2", got, ok)
+	}
+	if got, ok := ds.Get("api", "staging", "web2"); ok {
+		t.Errorf("ds.Get(%q, %q, %q) = %#v, true; want false", "api", "staging", "web2", got)
+	}
+
+	// the store may keep keys for a while after their TTLs.
+	if ds, err = Load(s, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Load(s, now+2h) failed with %v", err)
+	}
+	if got, ok := ds.Get("api", "production", "web2"); ok {
+		t.Errorf("ds.Get(%q, %q, %q) = %#v, true after its TTL; want false", "api", "production", "web2", got)
+	}
+
+	if err := Clear(s, "api", "production", "web1"); err != nil {
+		t.Errorf("Clear(s, ..., %q) failed with %v", "web1", err)
+	}
+	if err := Clear(s, "api", "production", "web1"); err != nil {
+		t.Errorf("Clear(s, ..., %q) failed with %v for a host not drained; want success", "web1", err)
+	}
+	if ds, err = Load(s, now); err != nil {
+		t.Fatalf("Load(s, now) failed with %v", err)
+	}
+	if got, ok := ds.Get("api", "production", "web1"); ok {
+		t.Errorf("ds.Get(%q, %q, %q) = %#v, true after Clear; want false", "api", "production", "web1", got)
+	}
+
+	for _, host := range []string{"", "..", "web/1"} {
+		if _, err := Set(s, "api", "production", host, "alice", 0, now); err == nil {
+			t.Errorf("Set(s, ..., %q, ...) succeeded; want failure", host)
+		}
+	}
+	if _, err := Set(s, "api", "production", "web3", "alice", -time.Hour, now); err == nil {
+		t.Errorf("Set(s, ..., -1h, now) succeeded; want failure")
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := etcdtest.NewStore()
+	if _, err := Set(s, "api", "production", "web1", "alice", 0, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web1", err)
+	}
+	if _, err := Set(s, "api", "production", "web2", "bob", 90*time.Minute, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web2", err)
+	}
+	if _, err := Set(s, "apiv2", "production", "web3", "carol", 0, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web3", err)
+	}
+
+	later := now.Add(time.Hour)
+	if err := Rename(s, "api", "gateway", later); err != nil {
+		t.Fatalf("Rename(s, %q, %q, now+1h) failed with %v", "api", "gateway", err)
+	}
+	if got, want := s.TTLs[keyPrefix+"/gateway/production/web2"], uint64(30*60); got != want {
+		t.Errorf("ttl of web2 = %d; want %d", got, want)
+	}
+	ds, err := Load(s, later)
+	if err != nil {
+		t.Fatalf("Load(s, now+1h) failed with %v", err)
+	}
+	want := Drains{
+		"gateway/production/web1": {By: "alice", Since: now},
+		"apiv2/production/web3":   {By: "carol", Since: now},
+	}
+	web2 := ds["gateway/production/web2"]
+	delete(ds, "gateway/production/web2")
+	if !reflect.DeepEqual(ds, want) {
+		t.Errorf("Load(s, now+1h) = %#v; want %#v", ds, want)
+	}
+	if web2.By != "bob" || !web2.Since.Equal(now) || web2.Until == nil || !web2.Until.Equal(now.Add(90*time.Minute)) {
+		t.Errorf("drain of web2 = %#v; want drained by bob until now+90m", web2)
+	}
+}
+
+func TestActive(t *testing.T) {
+	ds := Drains{"api/production/web2": {By: "alice", Since: now}, "api/staging/web1": {By: "bob", Since: now}}
+	hosts := []config.Host{{Name: "web1"}, {Name: "web2"}, {Name: "web3"}}
+	got := config.HostNames(ds.Active("api", "production", hosts))
+	if want := []string{"web1", "web3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ds.Active(%q, %q, hosts) = %q; want %q", "api", "production", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+// Package etcderr classifies errors returned by etcd.
+package etcderr
+
+import (
+	"github.com/coreos/go-etcd/etcd"
+)
+
+// Error codes of etcd
+// https://github.com/coreos/etcd/blob/master/Documentation/errorcode.md
+const (
+	// KeyNotFound means that the key does not exist.
+	KeyNotFound = 100
+	// TestFailed means that the previous value or index in a compare-and-swap did not match.
+	TestFailed = 101
+	// NodeExist means that the key to create already exists.
+	NodeExist = 105
+)
+
+// Is returns true if "err" is an error of etcd with "code".
+func Is(err error, code int) bool {
+	switch e := err.(type) {
+	case *etcd.EtcdError:
+		return e.ErrorCode == code
+	case etcd.EtcdError:
+		return e.ErrorCode == code
+	}
+	return false
+}
+
+// IsKeyNotFound returns true if "err" means that the key does not exist in etcd.
+func IsKeyNotFound(err error) bool {
+	return Is(err, KeyNotFound)
+}
@@ -0,0 +1,26 @@
+package etcderr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+)
+
+func TestIs(t *testing.T) {
+	for _, spec := range []struct {
+		err  error
+		code int
+		want bool
+	}{
+		{err: &etcd.EtcdError{ErrorCode: KeyNotFound}, code: KeyNotFound, want: true},
+		{err: etcd.EtcdError{ErrorCode: TestFailed}, code: TestFailed, want: true},
+		{err: &etcd.EtcdError{ErrorCode: NodeExist}, code: KeyNotFound, want: false},
+		{err: errors.New("connection refused"), code: KeyNotFound, want: false},
+		{err: nil, code: KeyNotFound, want: false},
+	} {
+		if got := Is(spec.err, spec.code); got != spec.want {
+			t.Errorf("Is(%#v, %d) = %v; want %v", spec.err, spec.code, got, spec.want)
+		}
+	}
+}
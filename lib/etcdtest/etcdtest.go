@@ -0,0 +1,87 @@
+// Package etcdtest provides an in-memory etcd for tests of the packages which store data in etcd.
+package etcdtest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// Store keeps values with their TTLs in memory, and serves the subset of etcd.Client which stores use.
+// Directories are implied by the keys of the values.
+// Its methods are safe for concurrent use, but Values and TTLs are not.
+type Store struct {
+	Values map[string]string
+	TTLs   map[string]uint64
+
+	mu *sync.Mutex
+}
+
+// NewStore returns a new empty Store.
+func NewStore() Store {
+	return Store{Values: make(map[string]string), TTLs: make(map[string]uint64), mu: new(sync.Mutex)}
+}
+
+// Get returns the value of "key", or the directory "key" with all the values under it.
+func (s Store) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.Values[key]; ok {
+		return &etcd.Response{Action: "get", Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	root := s.dir(key)
+	if root == nil {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Action: "get", Node: root}, nil
+}
+
+// dir builds the directory node of "key" from the flat values.
+func (s Store) dir(key string) *etcd.Node {
+	children := make(map[string]bool)
+	for k := range s.Values {
+		if strings.HasPrefix(k, key+"/") {
+			children[key+"/"+strings.SplitN(strings.TrimPrefix(k, key+"/"), "/", 2)[0]] = true
+		}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	n := &etcd.Node{Key: key, Dir: true}
+	for _, k := range keys {
+		if v, ok := s.Values[k]; ok {
+			n.Nodes = append(n.Nodes, &etcd.Node{Key: k, Value: v})
+		} else {
+			n.Nodes = append(n.Nodes, s.dir(k))
+		}
+	}
+	return n
+}
+
+// Set stores "value" into "key" with "ttl" in seconds.
+func (s Store) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Values[key] = value
+	s.TTLs[key] = ttl
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+// Delete deletes the value of "key".
+func (s Store) Delete(key string, recursive bool) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Values[key]; !ok {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	delete(s.Values, key)
+	return &etcd.Response{Action: "delete", Node: &etcd.Node{Key: key}}, nil
+}
@@ -0,0 +1,70 @@
+package etcdtest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+func TestGetDirectory(t *testing.T) {
+	s := NewStore()
+	s.Set("/goship/drains/api/production/web1", "a", 0)
+	s.Set("/goship/drains/api/production/web2", "b", 60)
+	s.Set("/goship/drains/api/staging/web1", "c", 0)
+
+	resp, err := s.Get("/goship/drains/api", false, true)
+	if err != nil {
+		t.Fatalf("s.Get(%q, false, true) failed with %v", "/goship/drains/api", err)
+	}
+	want := &etcd.Node{Key: "/goship/drains/api", Dir: true, Nodes: etcd.Nodes{
+		{Key: "/goship/drains/api/production", Dir: true, Nodes: etcd.Nodes{
+			{Key: "/goship/drains/api/production/web1", Value: "a"},
+			{Key: "/goship/drains/api/production/web2", Value: "b"},
+		}},
+		{Key: "/goship/drains/api/staging", Dir: true, Nodes: etcd.Nodes{
+			{Key: "/goship/drains/api/staging/web1", Value: "c"},
+		}},
+	}}
+	if !reflect.DeepEqual(resp.Node, want) {
+		t.Errorf("s.Get(%q, false, true).Node = %#v; want %#v", "/goship/drains/api", resp.Node, want)
+	}
+	if got := s.TTLs["/goship/drains/api/production/web2"]; got != 60 {
+		t.Errorf("ttl of web2 = %d; want %d", got, 60)
+	}
+
+	if _, err := s.Delete("/goship/drains/api/staging/web1", false); err != nil {
+		t.Errorf("s.Delete(%q, false) failed with %v", "/goship/drains/api/staging/web1", err)
+	}
+	if _, err := s.Get("/goship/drains/api/staging", false, true); !etcderr.IsKeyNotFound(err) {
+		t.Errorf("s.Get(%q, false, true) failed with %v; want key not found", "/goship/drains/api/staging", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := NewStore()
+	srv := NewServer(s)
+	defer srv.Close()
+	c := etcd.NewClient([]string{srv.URL})
+
+	if _, err := c.Set("/goship/drains/api/production/web1", "a", 60); err != nil {
+		t.Fatalf("c.Set(%q, %q, 60) failed with %v", "/goship/drains/api/production/web1", "a", err)
+	}
+	if got := s.TTLs["/goship/drains/api/production/web1"]; got != 60 {
+		t.Errorf("ttl of web1 = %d; want %d", got, 60)
+	}
+	resp, err := c.Get("/goship/drains", false, true)
+	if err != nil {
+		t.Fatalf("c.Get(%q, false, true) failed with %v", "/goship/drains", err)
+	}
+	if n := resp.Node; len(n.Nodes) != 1 || len(n.Nodes[0].Nodes) != 1 || len(n.Nodes[0].Nodes[0].Nodes) != 1 || n.Nodes[0].Nodes[0].Nodes[0].Value != "a" {
+		t.Errorf("c.Get(%q, false, true).Node = %#v; want the directory with web1", "/goship/drains", n)
+	}
+	if _, err := c.Delete("/goship/drains/api/production/web1", false); err != nil {
+		t.Errorf("c.Delete(%q, false) failed with %v", "/goship/drains/api/production/web1", err)
+	}
+	if _, err := c.Get("/goship/drains", false, true); !etcderr.IsKeyNotFound(err) {
+		t.Errorf("c.Get(%q, false, true) failed with %v; want key not found", "/goship/drains", err)
+	}
+}
@@ -0,0 +1,60 @@
+package etcdtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/golang/glog"
+)
+
+// keysPath is the path of the keys API of etcd v2.
+const keysPath = "/v2/keys"
+
+// NewServer starts a server of the keys API of etcd on "s", so that handlers which take an *etcd.Client can be tested.
+// i.e. etcd.NewClient([]string{srv.URL})
+func NewServer(s Store) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, keysPath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, keysPath)
+		var (
+			resp *etcd.Response
+			err  error
+		)
+		switch r.Method {
+		case "GET":
+			resp, err = s.Get(key, r.FormValue("sorted") == "true", r.FormValue("recursive") == "true")
+		case "PUT":
+			var ttl uint64
+			if v := r.FormValue("ttl"); v != "" {
+				if ttl, err = strconv.ParseUint(v, 10, 64); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			resp, err = s.Set(key, r.FormValue("value"), ttl)
+		case "DELETE":
+			resp, err = s.Delete(key, r.FormValue("recursive") == "true")
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var body interface{} = resp
+		if err != nil {
+			// Store fails only with missing keys
+			w.WriteHeader(http.StatusNotFound)
+			body = err
+		}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			glog.Errorf("Failed to send response: %v", err)
+		}
+	}))
+}
@@ -0,0 +1,172 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultAPIURL is the base URL of GitHub API.
+	defaultAPIURL = "https://api.github.com"
+	// jwtLifetime is how long JWTs of apps are valid. GitHub accepts up to 10 minutes.
+	jwtLifetime = 9 * time.Minute
+	// jwtClockSkew backdates JWTs against clocks of GitHub behind ours.
+	jwtClockSkew = time.Minute
+	// tokenRefreshMargin is how long before their expiry installation tokens are renewed.
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// App authenticates to GitHub as a GitHub App.
+// It mints installation tokens with JWTs signed by the private key of the app, and caches them until near expiry.
+type App struct {
+	id  int
+	key *rsa.PrivateKey
+	// baseURL is the base URL of GitHub API. It is replaced in tests.
+	baseURL string
+	hc      *http.Client
+	now     func() time.Time
+
+	mu     sync.Mutex
+	tokens map[int]installationToken
+}
+
+// installationToken is a token of an installation of an app.
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewApp returns an App of the ID "id" with the private key "privateKey" in PEM.
+func NewApp(id int, privateKey []byte) (*App, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &App{
+		id:      id,
+		key:     key,
+		baseURL: defaultAPIURL,
+		hc:      http.DefaultClient,
+		now:     time.Now,
+		tokens:  make(map[int]installationToken),
+	}, nil
+}
+
+// parsePrivateKey parses an RSA private key in PEM, either in PKCS#1 as GitHub issues or in PKCS#8.
+func parsePrivateKey(buf []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, errors.New("private key of the app is not in PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key of the app: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key of the app is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// jwt returns a JWT which authenticates requests as the app.
+func (a *App) jwt() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-jwtClockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": int64(a.id),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Token returns a token of the installation "id" of the app.
+// The cached one is returned unless it expires within tokenRefreshMargin.
+func (a *App) Token(id int) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t, ok := a.tokens[id]; ok && a.now().Add(tokenRefreshMargin).Before(t.ExpiresAt) {
+		return t.Token, nil
+	}
+	t, err := a.mintToken(id)
+	if err != nil {
+		return "", err
+	}
+	a.tokens[id] = t
+	return t.Token, nil
+}
+
+// mintToken exchanges a JWT of the app for a new token of the installation "id".
+func (a *App) mintToken(id int) (installationToken, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return installationToken{}, err
+	}
+	u := fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimSuffix(a.baseURL, "/"), id)
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return installationToken{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	resp, err := a.hc.Do(req)
+	if err != nil {
+		return installationToken{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return installationToken{}, fmt.Errorf("failed to get a token of installation %d of app %d: %s", id, a.id, resp.Status)
+	}
+	var t installationToken
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return installationToken{}, fmt.Errorf("malformed token of installation %d of app %d: %v", id, a.id, err)
+	}
+	if t.Token == "" {
+		return installationToken{}, fmt.Errorf("empty token of installation %d of app %d", id, a.id)
+	}
+	return t, nil
+}
+
+// installationTokenSource is an oauth2.TokenSource of tokens of an installation of an app.
+type installationTokenSource struct {
+	app *App
+	id  int
+}
+
+func (s installationTokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.app.Token(s.id)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: t}, nil
+}
@@ -1,6 +1,10 @@
 package github
 
 import (
+	"fmt"
+	"net/http"
+	"sync"
+
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
 )
@@ -13,11 +17,24 @@ type Client interface {
 	GetCommit(owner, repo, sha1 string) (*github.RepositoryCommit, *github.Response, error)
 	IsTeamMember(int, string) (bool, *github.Response, error)
 	IsCollaborator(string, string, string) (bool, *github.Response, error)
+	ListBranches(owner, repo string, opt *github.ListOptions) ([]github.Branch, *github.Response, error)
+	CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error)
+	CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
+	GetReleaseByTag(owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error)
+	CreateRelease(owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	EditRelease(owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+	// SearchIssues searches issues and pull requests of the repository "owner/repo" with "query", e.g. "type:pr is:closed".
+	SearchIssues(owner, repo, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error)
+	GetIssue(owner, repo string, number int) (*github.Issue, *github.Response, error)
+	CreateIssueComment(owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	AddLabelsToIssue(owner, repo string, number int, labels []string) ([]github.Label, *github.Response, error)
 }
 
 type prodClient struct {
-	org  *github.OrganizationsService
-	repo *github.RepositoriesService
+	org    *github.OrganizationsService
+	repo   *github.RepositoriesService
+	search *github.SearchService
+	issues *github.IssuesService
 }
 
 // NewClient returns a new client of Github APIs.
@@ -25,13 +42,135 @@ type prodClient struct {
 // TODO(yugui) Add a comprehensive list of the scopes.
 func NewClient(token string) Client {
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	c := github.NewClient(oauth2.NewClient(oauth2.NoContext, ts))
+	return newClient(ts, TokenKey)
+}
+
+// newClient returns a client which authenticates with tokens from "ts" and tracks the rate limit in Rates under "key".
+// All the clients of Github APIs are made by newClient.
+func newClient(ts oauth2.TokenSource, key string) Client {
+	hc := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: ts,
+			Base:   rateTransport{key: key, limits: Rates, base: http.DefaultTransport},
+		},
+	}
+	c := github.NewClient(hc)
 	return prodClient{
-		org:  c.Organizations,
-		repo: c.Repositories,
+		org:    c.Organizations,
+		repo:   c.Repositories,
+		search: c.Search,
+		issues: c.Issues,
 	}
 }
 
+// appClient is a Client which authenticates as installations of a GitHub App.
+type appClient struct {
+	app *App
+	// def is the installation used for repositories without their own installations.
+	def int
+	// installationOf returns the installation of the repository, or 0 for the default.
+	installationOf func(owner, repo string) int
+
+	mu      sync.Mutex
+	clients map[int]Client
+}
+
+// NewAppClient returns a client which authenticates as the installation "def" of "app".
+// Requests about repositories for which "installationOf" returns non-zero use that installation instead,
+// so that a goship can serve repositories of organizations with their own installations. "installationOf" can be nil.
+func NewAppClient(app *App, def int, installationOf func(owner, repo string) int) Client {
+	return &appClient{
+		app:            app,
+		def:            def,
+		installationOf: installationOf,
+		clients:        make(map[int]Client),
+	}
+}
+
+// installation returns the client of the installation "id".
+func (c *appClient) installation(id int) Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl, ok := c.clients[id]
+	if !ok {
+		cl = newClient(installationTokenSource{app: c.app, id: id}, InstallationKey(id))
+		c.clients[id] = cl
+	}
+	return cl
+}
+
+// forRepo returns the client of the installation of the repository "owner/repo".
+func (c *appClient) forRepo(owner, repo string) Client {
+	id := c.def
+	if c.installationOf != nil {
+		if i := c.installationOf(owner, repo); i != 0 {
+			id = i
+		}
+	}
+	return c.installation(id)
+}
+
+func (c *appClient) ListTeams(owner, repo string, opt *github.ListOptions) ([]github.Team, *github.Response, error) {
+	return c.forRepo(owner, repo).ListTeams(owner, repo, opt)
+}
+
+func (c *appClient) ListCommits(owner, repo string, opt *github.CommitsListOptions) ([]github.RepositoryCommit, *github.Response, error) {
+	return c.forRepo(owner, repo).ListCommits(owner, repo, opt)
+}
+
+func (c *appClient) GetCommit(owner, repo, sha1 string) (*github.RepositoryCommit, *github.Response, error) {
+	return c.forRepo(owner, repo).GetCommit(owner, repo, sha1)
+}
+
+// IsTeamMember asks the default installation since teams are not of repositories.
+func (c *appClient) IsTeamMember(team int, user string) (bool, *github.Response, error) {
+	return c.installation(c.def).IsTeamMember(team, user)
+}
+
+func (c *appClient) IsCollaborator(owner, repo, user string) (bool, *github.Response, error) {
+	return c.forRepo(owner, repo).IsCollaborator(owner, repo, user)
+}
+
+func (c *appClient) ListBranches(owner, repo string, opt *github.ListOptions) ([]github.Branch, *github.Response, error) {
+	return c.forRepo(owner, repo).ListBranches(owner, repo, opt)
+}
+
+func (c *appClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	return c.forRepo(owner, repo).CompareCommits(owner, repo, base, head)
+}
+
+func (c *appClient) CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+	return c.forRepo(owner, repo).CreateStatus(owner, repo, ref, status)
+}
+
+func (c *appClient) GetReleaseByTag(owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error) {
+	return c.forRepo(owner, repo).GetReleaseByTag(owner, repo, tag)
+}
+
+func (c *appClient) CreateRelease(owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return c.forRepo(owner, repo).CreateRelease(owner, repo, release)
+}
+
+func (c *appClient) EditRelease(owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return c.forRepo(owner, repo).EditRelease(owner, repo, id, release)
+}
+
+func (c *appClient) SearchIssues(owner, repo, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+	return c.forRepo(owner, repo).SearchIssues(owner, repo, query, opt)
+}
+
+func (c *appClient) GetIssue(owner, repo string, number int) (*github.Issue, *github.Response, error) {
+	return c.forRepo(owner, repo).GetIssue(owner, repo, number)
+}
+
+func (c *appClient) CreateIssueComment(owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	return c.forRepo(owner, repo).CreateIssueComment(owner, repo, number, comment)
+}
+
+func (c *appClient) AddLabelsToIssue(owner, repo string, number int, labels []string) ([]github.Label, *github.Response, error) {
+	return c.forRepo(owner, repo).AddLabelsToIssue(owner, repo, number, labels)
+}
+
 // ListTeams exists in both organizations and repositories so we need to alias both functions
 func (c prodClient) ListTeams(owner string, repo string, opt *github.ListOptions) ([]github.Team, *github.Response, error) {
 	return c.repo.ListTeams(owner, repo, opt)
@@ -52,3 +191,43 @@ func (c prodClient) IsTeamMember(team int, user string) (bool, *github.Response,
 func (c prodClient) IsCollaborator(owner, repo, user string) (bool, *github.Response, error) {
 	return c.repo.IsCollaborator(owner, repo, user)
 }
+
+func (c prodClient) ListBranches(owner, repo string, opt *github.ListOptions) ([]github.Branch, *github.Response, error) {
+	return c.repo.ListBranches(owner, repo, opt)
+}
+
+func (c prodClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	return c.repo.CompareCommits(owner, repo, base, head)
+}
+
+func (c prodClient) CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+	return c.repo.CreateStatus(owner, repo, ref, status)
+}
+
+func (c prodClient) GetReleaseByTag(owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error) {
+	return c.repo.GetReleaseByTag(owner, repo, tag)
+}
+
+func (c prodClient) CreateRelease(owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return c.repo.CreateRelease(owner, repo, release)
+}
+
+func (c prodClient) EditRelease(owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return c.repo.EditRelease(owner, repo, id, release)
+}
+
+func (c prodClient) SearchIssues(owner, repo, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+	return c.search.Issues(fmt.Sprintf("repo:%s/%s %s", owner, repo, query), opt)
+}
+
+func (c prodClient) GetIssue(owner, repo string, number int) (*github.Issue, *github.Response, error) {
+	return c.issues.Get(owner, repo, number)
+}
+
+func (c prodClient) CreateIssueComment(owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	return c.issues.CreateComment(owner, repo, number, comment)
+}
+
+func (c prodClient) AddLabelsToIssue(owner, repo string, number int, labels []string) ([]github.Label, *github.Response, error) {
+	return c.issues.AddLabelsToIssue(owner, repo, number, labels)
+}
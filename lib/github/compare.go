@@ -0,0 +1,90 @@
+package github
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// compareCache is a Client which caches results of CompareCommits.
+type compareCache struct {
+	Client
+	size int
+
+	mu      sync.Mutex
+	entries map[compareKey]*github.CommitsComparison
+}
+
+type compareKey struct {
+	owner, repo, base, head string
+}
+
+// WithCompareCache returns a Client which caches up to "size" results of CompareCommits of "c".
+// Comparisons between two commit SHAs never change, so they are kept until the cache is full.
+// Callers should compare SHAs but not branches, whose comparisons change.
+func WithCompareCache(c Client, size int) Client {
+	return &compareCache{Client: c, size: size, entries: make(map[compareKey]*github.CommitsComparison)}
+}
+
+func (c *compareCache) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	key := compareKey{owner: owner, repo: repo, base: base, head: head}
+	c.mu.Lock()
+	comp, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return comp, nil, nil
+	}
+
+	comp, resp, err := c.Client.CompareCommits(owner, repo, base, head)
+	if err != nil {
+		return nil, resp, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		// Simply starts over. Comparisons of the latest deployments are soon cached again.
+		c.entries = make(map[compareKey]*github.CommitsComparison)
+	}
+	c.entries[key] = comp
+	return comp, resp, nil
+}
+
+// CachedComparison returns the result of CompareCommits of "c" cached by WithCompareCache without making requests.
+// It returns false if the comparison is not cached or "c" does not cache comparisons.
+func CachedComparison(c Client, owner, repo, base, head string) (*github.CommitsComparison, bool) {
+	cc, ok := c.(*compareCache)
+	if !ok {
+		return nil, false
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	comp, ok := cc.entries[compareKey{owner: owner, repo: repo, base: base, head: head}]
+	return comp, ok
+}
+
+// statusUnprocessableEntity is returned by GitHub for comparisons which cannot be made.
+const statusUnprocessableEntity = 422
+
+// IsMissingCommit returns true iff "err" from CompareCommits means that either commit no longer exists in the repository
+// or that the commits have no common ancestor, e.g. after a history rewrite and garbage collection.
+// Such comparisons never succeed, so callers should go on without them instead of failing.
+func IsMissingCommit(err error) bool {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil {
+		return false
+	}
+	switch e.Response.StatusCode {
+	case http.StatusNotFound:
+		return true
+	case statusUnprocessableEntity:
+		msg := strings.ToLower(e.Message)
+		for _, s := range []string{"no common ancestor", "not found", "no commit found"} {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
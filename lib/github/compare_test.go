@@ -0,0 +1,91 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+type countingClient struct {
+	Client
+	calls int
+}
+
+func (c *countingClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	c.calls++
+	return &github.CommitsComparison{Status: github.String(base + "..." + head)}, nil, nil
+}
+
+func TestCompareCache(t *testing.T) {
+	cl := &countingClient{}
+	c := WithCompareCache(cl, 2)
+	for _, spec := range []struct {
+		base, head string
+		calls      int
+	}{
+		{base: "a", head: "b", calls: 1},
+		{base: "a", head: "b", calls: 1},
+		{base: "b", head: "a", calls: 2},
+		{base: "a", head: "b", calls: 2},
+		// the cache is full and starts over
+		{base: "a", head: "c", calls: 3},
+		{base: "a", head: "b", calls: 4},
+	} {
+		comp, _, err := c.CompareCommits("gengo", "goship", spec.base, spec.head)
+		if err != nil {
+			t.Fatalf("c.CompareCommits(%q, %q) failed with %v", spec.base, spec.head, err)
+		}
+		if got, want := *comp.Status, spec.base+"..."+spec.head; got != want {
+			t.Errorf("c.CompareCommits(%q, %q).Status = %q; want %q", spec.base, spec.head, got, want)
+		}
+		if cl.calls != spec.calls {
+			t.Errorf("cl.calls = %d after c.CompareCommits(%q, %q); want %d", cl.calls, spec.base, spec.head, spec.calls)
+		}
+	}
+}
+
+func TestCachedComparison(t *testing.T) {
+	cl := &countingClient{}
+	c := WithCompareCache(cl, 2)
+	if _, ok := CachedComparison(c, "gengo", "goship", "a", "b"); ok {
+		t.Errorf("CachedComparison(c, %q, %q) is cached before comparing", "a", "b")
+	}
+	if _, _, err := c.CompareCommits("gengo", "goship", "a", "b"); err != nil {
+		t.Fatalf("c.CompareCommits(%q, %q) failed with %v", "a", "b", err)
+	}
+	comp, ok := CachedComparison(c, "gengo", "goship", "a", "b")
+	if !ok || *comp.Status != "a...b" {
+		t.Errorf("CachedComparison(c, %q, %q) = %v, %t; want the cached comparison", "a", "b", comp, ok)
+	}
+	if cl.calls != 1 {
+		t.Errorf("cl.calls = %d; want 1", cl.calls)
+	}
+	// not a cache
+	if _, ok := CachedComparison(cl, "gengo", "goship", "a", "b"); ok {
+		t.Errorf("CachedComparison(cl, %q, %q) is cached without WithCompareCache", "a", "b")
+	}
+}
+
+func TestIsMissingCommit(t *testing.T) {
+	errorResponse := func(code int, msg string) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: code}, Message: msg}
+	}
+	for _, spec := range []struct {
+		err  error
+		want bool
+	}{
+		{err: errorResponse(404, "Not Found"), want: true},
+		{err: errorResponse(422, "No common ancestor between 0123abc and master."), want: true},
+		{err: errorResponse(422, "No commit found for SHA: 0123abc"), want: true},
+		{err: errorResponse(422, "Validation Failed"), want: false},
+		{err: errorResponse(500, "Server Error"), want: false},
+		{err: errors.New("connection refused"), want: false},
+		{err: nil, want: false},
+	} {
+		if got := IsMissingCommit(spec.err); got != spec.want {
+			t.Errorf("IsMissingCommit(%v) = %t; want %t", spec.err, got, spec.want)
+		}
+	}
+}
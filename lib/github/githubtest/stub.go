@@ -51,6 +51,46 @@ func (s stub) IsCollaborator(owner, repo, user string) (bool, *github.Response,
 	return true, nil, nil
 }
 
+func (s stub) ListBranches(owner, repo string, opt *github.ListOptions) ([]github.Branch, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
 func NewStub() githublib.Client {
 	return stub{}
 }
+
+func (s stub) CreateStatus(owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) GetReleaseByTag(owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) CreateRelease(owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) EditRelease(owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) SearchIssues(owner, repo, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) GetIssue(owner, repo string, number int) (*github.Issue, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) CreateIssueComment(owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (s stub) AddLabelsToIssue(owner, repo string, number int, labels []string) ([]github.Label, *github.Response, error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
@@ -0,0 +1,116 @@
+package github
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Lookups caches lookups of branches and pull requests which the dashboard makes on every page view.
+// Successful results are kept for the TTL, and failures are looked up again next time.
+type Lookups struct {
+	c   Client
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	branches map[lookupKey]branchLookup
+	pulls    map[lookupKey]pullLookup
+}
+
+type lookupKey struct {
+	owner, repo, branch, sha string
+}
+
+type branchLookup struct {
+	updated time.Time
+	expires time.Time
+}
+
+type pullLookup struct {
+	// pull is nil if there is no such pull request.
+	pull    *github.Issue
+	expires time.Time
+}
+
+// NewLookups returns Lookups which caches results of "c" for "ttl".
+func NewLookups(c Client, ttl time.Duration) *Lookups {
+	return &Lookups{
+		c:        c,
+		ttl:      ttl,
+		now:      time.Now,
+		branches: make(map[lookupKey]branchLookup),
+		pulls:    make(map[lookupKey]pullLookup),
+	}
+}
+
+// LastCommitTime returns when the latest commit of "branch" of "owner/repo" was committed.
+func (l *Lookups) LastCommitTime(owner, repo, branch string) (time.Time, error) {
+	key := lookupKey{owner: owner, repo: repo, branch: branch}
+	now := l.now()
+	l.mu.Lock()
+	b, ok := l.branches[key]
+	l.mu.Unlock()
+	if ok && now.Before(b.expires) {
+		return b.updated, nil
+	}
+
+	commits, _, err := l.c.ListCommits(owner, repo, &github.CommitsListOptions{SHA: branch, ListOptions: github.ListOptions{PerPage: 1}})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(commits) == 0 || commits[0].Commit == nil || commits[0].Commit.Committer == nil || commits[0].Commit.Committer.Date == nil {
+		return time.Time{}, fmt.Errorf("no commit date of %s/%s@%s", owner, repo, branch)
+	}
+	updated := *commits[0].Commit.Committer.Date
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneLocked(now)
+	l.branches[key] = branchLookup{updated: updated, expires: now.Add(l.ttl)}
+	return updated, nil
+}
+
+// ClosedPullRequest returns the merged or closed pull request from "branch" of "owner/repo" which contains the commit "sha".
+// It returns nil if there is no such pull request.
+func (l *Lookups) ClosedPullRequest(owner, repo, branch, sha string) (*github.Issue, error) {
+	key := lookupKey{owner: owner, repo: repo, branch: branch, sha: sha}
+	now := l.now()
+	l.mu.Lock()
+	p, ok := l.pulls[key]
+	l.mu.Unlock()
+	if ok && now.Before(p.expires) {
+		return p.pull, nil
+	}
+
+	res, _, err := l.c.SearchIssues(owner, repo, fmt.Sprintf("type:pr is:closed head:%s %s", branch, sha), nil)
+	if err != nil {
+		return nil, err
+	}
+	var pull *github.Issue
+	if len(res.Issues) > 0 {
+		pull = &res.Issues[0]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneLocked(now)
+	l.pulls[key] = pullLookup{pull: pull, expires: now.Add(l.ttl)}
+	return pull, nil
+}
+
+// pruneLocked removes expired results at "now", so that lookups of old revisions do not pile up.
+func (l *Lookups) pruneLocked(now time.Time) {
+	for k, b := range l.branches {
+		if !now.Before(b.expires) {
+			delete(l.branches, k)
+		}
+	}
+	for k, p := range l.pulls {
+		if !now.Before(p.expires) {
+			delete(l.pulls, k)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// lookupClient serves the latest commits of branches and the search results of queries from fixtures.
+type lookupClient struct {
+	Client
+	commits map[string]time.Time
+	results map[string][]github.Issue
+	fail    bool
+
+	listCalls, searchCalls int
+	queries                []string
+}
+
+func (c *lookupClient) ListCommits(owner, repo string, opt *github.CommitsListOptions) ([]github.RepositoryCommit, *github.Response, error) {
+	c.listCalls++
+	if c.fail {
+		return nil, nil, errors.New("github is down")
+	}
+	if opt.PerPage != 1 {
+		return nil, nil, errors.New("lists more commits than needed")
+	}
+	date, ok := c.commits[opt.SHA]
+	if !ok {
+		return nil, nil, errors.New("404 Not Found")
+	}
+	return []github.RepositoryCommit{{SHA: github.String("tip"), Commit: &github.Commit{Committer: &github.CommitAuthor{Date: &date}}}}, nil, nil
+}
+
+func (c *lookupClient) SearchIssues(owner, repo, query string, opt *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error) {
+	c.searchCalls++
+	c.queries = append(c.queries, query)
+	if c.fail {
+		return nil, nil, errors.New("github is down")
+	}
+	issues := c.results[query]
+	return &github.IssuesSearchResult{Total: github.Int(len(issues)), Issues: issues}, nil, nil
+}
+
+func TestLookupsLastCommitTime(t *testing.T) {
+	updated := time.Date(2016, 3, 1, 9, 30, 0, 0, time.UTC)
+	cl := &lookupClient{commits: map[string]time.Time{"feature/login": updated}}
+	now := time.Date(2016, 4, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLookups(cl, time.Hour)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		got, err := l.LastCommitTime("gengo", "goship", "feature/login")
+		if err != nil {
+			t.Fatalf("l.LastCommitTime(...) failed with %v", err)
+		}
+		if !got.Equal(updated) {
+			t.Errorf("l.LastCommitTime(...) = %v; want %v", got, updated)
+		}
+	}
+	if cl.listCalls != 1 {
+		t.Errorf("cl.listCalls = %d; want 1 within the TTL", cl.listCalls)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := l.LastCommitTime("gengo", "goship", "feature/login"); err != nil {
+		t.Fatalf("l.LastCommitTime(...) failed with %v", err)
+	}
+	if cl.listCalls != 2 {
+		t.Errorf("cl.listCalls = %d; want 2 after the TTL", cl.listCalls)
+	}
+
+	if _, err := l.LastCommitTime("gengo", "goship", "deleted"); err == nil {
+		t.Errorf("l.LastCommitTime(%q) succeeded; want failure", "deleted")
+	}
+}
+
+func TestLookupsClosedPullRequest(t *testing.T) {
+	merged := github.Issue{Number: github.Int(42), State: github.String("closed"), Title: github.String("Login"), HTMLURL: github.String("https://github.com/gengo/goship/pull/42")}
+	cl := &lookupClient{results: map[string][]github.Issue{
+		"type:pr is:closed head:feature/login abc123": {merged},
+	}}
+	now := time.Date(2016, 4, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLookups(cl, time.Hour)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		got, err := l.ClosedPullRequest("gengo", "goship", "feature/login", "abc123")
+		if err != nil {
+			t.Fatalf("l.ClosedPullRequest(...) failed with %v", err)
+		}
+		if got == nil || !reflect.DeepEqual(*got, merged) {
+			t.Errorf("l.ClosedPullRequest(...) = %v; want %v", got, merged)
+		}
+	}
+
+	// no pull request, which is cached too
+	for i := 0; i < 2; i++ {
+		got, err := l.ClosedPullRequest("gengo", "goship", "master", "def456")
+		if err != nil {
+			t.Fatalf("l.ClosedPullRequest(...) failed with %v", err)
+		}
+		if got != nil {
+			t.Errorf("l.ClosedPullRequest(%q, %q) = %v; want nil", "master", "def456", got)
+		}
+	}
+	if cl.searchCalls != 2 {
+		t.Errorf("cl.searchCalls = %d; want 2", cl.searchCalls)
+	}
+	if want := []string{"type:pr is:closed head:feature/login abc123", "type:pr is:closed head:master def456"}; !reflect.DeepEqual(cl.queries, want) {
+		t.Errorf("queries = %q; want %q", cl.queries, want)
+	}
+}
+
+func TestLookupsDoNotCacheFailures(t *testing.T) {
+	cl := &lookupClient{fail: true}
+	l := NewLookups(cl, time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := l.LastCommitTime("gengo", "goship", "master"); err == nil {
+			t.Errorf("l.LastCommitTime(...) succeeded; want failure")
+		}
+		if _, err := l.ClosedPullRequest("gengo", "goship", "master", "abc123"); err == nil {
+			t.Errorf("l.ClosedPullRequest(...) succeeded; want failure")
+		}
+	}
+	if cl.listCalls != 2 || cl.searchCalls != 2 {
+		t.Errorf("calls = %d, %d; want 2, 2 since failures are not cached", cl.listCalls, cl.searchCalls)
+	}
+}
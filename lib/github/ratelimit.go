@@ -0,0 +1,99 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// TokenKey is the key of the rate limit of GITHUB_API_TOKEN in RateLimits.
+const TokenKey = "token"
+
+// InstallationKey returns the key of the rate limit of the GitHub App installation "id" in RateLimits.
+func InstallationKey(id int) string {
+	return fmt.Sprintf("installation/%d", id)
+}
+
+// Rate is the rate limit of GitHub API reported in the latest response.
+type Rate struct {
+	Limit     int
+	Remaining int
+	// Reset is when Remaining is reset to Limit.
+	Reset time.Time
+}
+
+// RateLimits tracks rate limits of GitHub API, keyed by the credentials which they apply to.
+// Each installation of a GitHub App has its own rate limit.
+type RateLimits struct {
+	mu    sync.Mutex
+	rates map[string]Rate
+}
+
+// Rates are the rate limits of the clients returned by NewClient and NewAppClient.
+var Rates = new(RateLimits)
+
+// Get returns the latest rate limit of "key", or false if no response with "key" has been seen.
+func (l *RateLimits) Get(key string) (Rate, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.rates[key]
+	return r, ok
+}
+
+// Snapshot returns the latest rate limits of all the keys.
+func (l *RateLimits) Snapshot() map[string]Rate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rates := make(map[string]Rate, len(l.rates))
+	for k, r := range l.rates {
+		rates[k] = r
+	}
+	return rates
+}
+
+// record updates the rate limit of "key" with the X-RateLimit headers in "h" if any.
+// It warns once when the remaining requests fall below a tenth of the limit.
+func (l *RateLimits) record(key string, h http.Header) {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, _ := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	r := Rate{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+
+	l.mu.Lock()
+	if l.rates == nil {
+		l.rates = make(map[string]Rate)
+	}
+	prev, ok := l.rates[key]
+	l.rates[key] = r
+	l.mu.Unlock()
+
+	low := limit / 10
+	if remaining < low && (!ok || prev.Remaining >= low) {
+		glog.Warningf("GitHub API rate limit of %s is running out: %d/%d remaining until %s", key, remaining, limit, r.Reset)
+	}
+}
+
+// rateTransport records the rate limits of responses under "key".
+type rateTransport struct {
+	key    string
+	limits *RateLimits
+	base   http.RoundTripper
+}
+
+func (t rateTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(r)
+	if err == nil {
+		t.limits.record(t.key, resp.Header)
+	}
+	return resp, err
+}
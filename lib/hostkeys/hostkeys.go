@@ -0,0 +1,298 @@
+// Package hostkeys manages the known SSH host keys of the hosts which goship connects to.
+// Keys are stored in etcd like a known_hosts file shared by all instances of goship.
+// Unknown keys are recorded pending until approved by an admin, and changed keys block their hosts until re-approved.
+package hostkeys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains host keys keyed by escaped host names.
+	keyPrefix = "/goship/hostkeys"
+)
+
+// States of host keys
+const (
+	// StateTrusted means that the host presented its trusted key last time.
+	StateTrusted = "trusted"
+	// StatePending means that the key of a new host waits for approval.
+	StatePending = "pending"
+	// StateBlocked means that the host presented a key other than the trusted one. It is refused until re-approved.
+	StateBlocked = "blocked"
+)
+
+var (
+	// ErrPending is returned for hosts whose keys are not approved yet.
+	ErrPending = errors.New("host key is pending approval by an admin")
+	// ErrBlocked is returned for hosts whose keys have changed since approved.
+	ErrBlocked = errors.New("host key has changed; the host is blocked until an admin approves the new key")
+	// ErrNotFound means that the host has never been contacted.
+	ErrNotFound = errors.New("no such host key")
+)
+
+// Store is the subset of etcd.Client which stores host keys.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// HostKey is the known key of a host.
+type HostKey struct {
+	Host  string `json:"host"`
+	State string `json:"state"`
+	// Key is the trusted key in the authorized_keys format. It is empty until the first approval.
+	Key string `json:"key,omitempty"`
+	// Offered is the key which the host presented but is not trusted yet, i.e. a new key or a changed one.
+	Offered string `json:"offered,omitempty"`
+	// Since is when the key entered the state.
+	Since time.Time `json:"since"`
+	// ApprovedBy is the admin who approved Key, or "tofu" if trusted on first use.
+	ApprovedBy string `json:"approvedBy,omitempty"`
+}
+
+// tofuApprover is HostKey.ApprovedBy of keys trusted on first use.
+const tofuApprover = "tofu"
+
+// Fingerprint returns the SHA256 fingerprint of "authorizedKey" like ssh-keygen -l, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+// It returns an empty string if "authorizedKey" is empty or malformed.
+func Fingerprint(authorizedKey string) string {
+	if authorizedKey == "" {
+		return ""
+	}
+	k, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return ""
+	}
+	return fingerprint(k)
+}
+
+func fingerprint(k ssh.PublicKey) string {
+	sum := sha256.Sum256(k.Marshal())
+	return "SHA256:" + strings.TrimRight(base64.StdEncoding.EncodeToString(sum[:]), "=")
+}
+
+// marshal returns "k" in the authorized_keys format without the trailing newline.
+func marshal(k ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+}
+
+func key(host string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("invalid host name %q", host)
+	}
+	return path.Join(keyPrefix, url.QueryEscape(host)), nil
+}
+
+// Get returns the known key of "host", or ErrNotFound if it has never been contacted.
+func Get(s Store, host string) (HostKey, error) {
+	k, err := key(host)
+	if err != nil {
+		return HostKey{}, err
+	}
+	resp, err := s.Get(k, false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return HostKey{}, ErrNotFound
+	}
+	if err != nil {
+		return HostKey{}, err
+	}
+	var hk HostKey
+	if err := json.Unmarshal([]byte(resp.Node.Value), &hk); err != nil {
+		return HostKey{}, fmt.Errorf("malformed host key %s: %v", resp.Node.Key, err)
+	}
+	return hk, nil
+}
+
+func store(s Store, hk HostKey) error {
+	k, err := key(hk.Host)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(hk)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(k, string(buf), 0)
+	return err
+}
+
+// HostKeys are known host keys keyed by host names.
+type HostKeys map[string]HostKey
+
+// Load returns all the known host keys.
+func Load(s Store) (HostKeys, error) {
+	resp, err := s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return HostKeys{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make(HostKeys)
+	for _, n := range resp.Node.Nodes {
+		var hk HostKey
+		if err := json.Unmarshal([]byte(n.Value), &hk); err != nil {
+			return nil, fmt.Errorf("malformed host key %s: %v", n.Key, err)
+		}
+		keys[hk.Host] = hk
+	}
+	return keys, nil
+}
+
+// Sorted returns the keys sorted by host names.
+func (keys HostKeys) Sorted() []HostKey {
+	sorted := make([]HostKey, 0, len(keys))
+	for _, hk := range keys {
+		sorted = append(sorted, hk)
+	}
+	sort.Sort(byHost(sorted))
+	return sorted
+}
+
+// State returns the state of the key of "host", or an empty string if it has never been contacted.
+func (keys HostKeys) State(host string) string {
+	return keys[host].State
+}
+
+// KnownHosts renders the trusted keys in the known_hosts format of OpenSSH, so that deploy commands can verify hosts too.
+// Blocked hosts are left out so that they are refused.
+func (keys HostKeys) KnownHosts() []byte {
+	var buf bytes.Buffer
+	for _, hk := range keys.Sorted() {
+		if hk.Key == "" || hk.State == StateBlocked {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %s\n", knownHostsPattern(hk.Host), hk.Key)
+	}
+	return buf.Bytes()
+}
+
+// knownHostsPattern returns the host pattern of "host" in known_hosts, i.e. "[host]:port" for non-standard ports.
+func knownHostsPattern(host string) string {
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") != 1 {
+		return host
+	}
+	parts := strings.SplitN(host, ":", 2)
+	if parts[1] == "22" {
+		return parts[0]
+	}
+	return "[" + parts[0] + "]:" + parts[1]
+}
+
+// Approve trusts the key of "host" offered with "fingerprint" on behalf of "by".
+// "fingerprint" must match the offered key so that an admin does not approve a key which changed again meanwhile.
+func Approve(s Store, host, fingerprint, by string, now time.Time) (HostKey, error) {
+	hk, err := Get(s, host)
+	if err != nil {
+		return HostKey{}, err
+	}
+	if hk.Offered == "" {
+		return HostKey{}, fmt.Errorf("host key of %s is not waiting for approval", host)
+	}
+	if got := Fingerprint(hk.Offered); got != fingerprint {
+		return HostKey{}, fmt.Errorf("fingerprint %s does not match the offered key %s of %s", fingerprint, got, host)
+	}
+	hk.Key, hk.Offered = hk.Offered, ""
+	hk.State, hk.Since, hk.ApprovedBy = StateTrusted, now, by
+	if err := store(s, hk); err != nil {
+		return HostKey{}, err
+	}
+	return hk, nil
+}
+
+// Checker verifies host keys against the Store, recording keys of new hosts and offered changes.
+type Checker struct {
+	s Store
+	// tofu returns true if keys of new hosts are trusted on first use. It is called only on first contacts.
+	tofu func() bool
+	now  func() time.Time
+}
+
+// NewChecker returns a new Checker which stores keys into "s". Keys of new hosts are trusted on first use
+// iff "tofu" returns true, or recorded pending approval otherwise.
+func NewChecker(s Store, tofu func() bool) *Checker {
+	return &Checker{s: s, tofu: tofu, now: time.Now}
+}
+
+// ConfiguredTOFU returns a function which tells if host_keys.tofu is enabled in the configuration in "client".
+// Failures to load the configuration are regarded as disabled.
+func ConfiguredTOFU(client config.ETCDInterface) func() bool {
+	return func() bool {
+		c, err := config.Load(client)
+		if err != nil {
+			glog.Errorf("Failed to load configuration: %v", err)
+			return false
+		}
+		return c.HostKeys != nil && c.HostKeys.TOFU
+	}
+}
+
+// Check returns nil iff "key" is the trusted key of "host".
+// It returns ErrPending for new hosts unless trusted on first use, and ErrBlocked for hosts whose keys have changed.
+func (c *Checker) Check(host string, key ssh.PublicKey) error {
+	offered := marshal(key)
+	hk, err := Get(c.s, host)
+	switch {
+	case err == ErrNotFound:
+		hk = HostKey{Host: host, State: StatePending, Offered: offered, Since: c.now()}
+		if c.tofu != nil && c.tofu() {
+			hk = HostKey{Host: host, State: StateTrusted, Key: offered, Since: c.now(), ApprovedBy: tofuApprover}
+			glog.Infof("Trusting host key %s of %s on first use", fingerprint(key), host)
+		}
+		if err := store(c.s, hk); err != nil {
+			return fmt.Errorf("failed to record host key of %s: %v", host, err)
+		}
+		if hk.State == StatePending {
+			return ErrPending
+		}
+		return nil
+	case err != nil:
+		return err
+	}
+
+	switch hk.State {
+	case StateTrusted:
+		if hk.Key == offered {
+			return nil
+		}
+		glog.Errorf("Host key of %s changed from %s to %s; blocking the host", host, Fingerprint(hk.Key), fingerprint(key))
+		hk.State, hk.Offered, hk.Since = StateBlocked, offered, c.now()
+		if err := store(c.s, hk); err != nil {
+			return fmt.Errorf("failed to block %s: %v", host, err)
+		}
+		return ErrBlocked
+	case StateBlocked:
+		return ErrBlocked
+	}
+	// pending: keep the latest offer so that an admin approves what the host presents now.
+	if hk.Offered != offered {
+		hk.Offered, hk.Since = offered, c.now()
+		if err := store(c.s, hk); err != nil {
+			return fmt.Errorf("failed to record host key of %s: %v", host, err)
+		}
+	}
+	return ErrPending
+}
+
+type byHost []HostKey
+
+func (b byHost) Len() int           { return len(b) }
+func (b byHost) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byHost) Less(i, j int) bool { return b[i].Host < b[j].Host }
@@ -0,0 +1,249 @@
+package hostkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/etcdtest"
+	sshlib "github.com/gengo/goship/lib/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func newSigner(t *testing.T) ssh.Signer {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey failed with %v", err)
+	}
+	s, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromKey failed with %v", err)
+	}
+	return s
+}
+
+func newTestChecker(s Store, tofu bool) *Checker {
+	c := NewChecker(s, func() bool { return tofu })
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestCheckPendingAndApprove(t *testing.T) {
+	s := etcdtest.NewStore()
+	c := newTestChecker(s, false)
+	k := newSigner(t).PublicKey()
+
+	if err := c.Check("web1", k); err != ErrPending {
+		t.Errorf("c.Check(%q, k) = %v on first contact; want %v", "web1", err, ErrPending)
+	}
+	hk, err := Get(s, "web1")
+	if err != nil || hk.State != StatePending || hk.Key != "" || hk.Offered != marshal(k) {
+		t.Errorf("Get(s, %q) = %#v, %v; want the offered key pending", "web1", hk, err)
+	}
+	if err := c.Check("web1", k); err != ErrPending {
+		t.Errorf("c.Check(%q, k) = %v before approval; want %v", "web1", err, ErrPending)
+	}
+
+	if _, err := Approve(s, "web1", "SHA256:wrong", "alice", now); err == nil {
+		t.Errorf("Approve(s, %q, %q, ...) succeeded; want failure", "web1", "SHA256:wrong")
+	}
+	hk, err = Approve(s, "web1", fingerprint(k), "alice", now)
+	if err != nil {
+		t.Fatalf("Approve(s, %q, %q, ...) failed with %v", "web1", fingerprint(k), err)
+	}
+	if hk.State != StateTrusted || hk.Key != marshal(k) || hk.Offered != "" || hk.ApprovedBy != "alice" {
+		t.Errorf("Approve(s, %q, %q, ...) = %#v; want the key trusted", "web1", fingerprint(k), hk)
+	}
+	if err := c.Check("web1", k); err != nil {
+		t.Errorf("c.Check(%q, k) failed with %v after approval", "web1", err)
+	}
+	if _, err := Approve(s, "web1", fingerprint(k), "alice", now); err == nil {
+		t.Errorf("Approve(s, %q, ...) succeeded for a trusted key; want failure", "web1")
+	}
+}
+
+func TestCheckTOFU(t *testing.T) {
+	s := etcdtest.NewStore()
+	c := newTestChecker(s, true)
+	k := newSigner(t).PublicKey()
+
+	if err := c.Check("web1", k); err != nil {
+		t.Errorf("c.Check(%q, k) failed with %v; want trusted on first use", "web1", err)
+	}
+	hk, err := Get(s, "web1")
+	if err != nil || hk.State != StateTrusted || hk.ApprovedBy != tofuApprover {
+		t.Errorf("Get(s, %q) = %#v, %v; want trusted on first use", "web1", hk, err)
+	}
+
+	// changed keys are blocked even with TOFU.
+	changed := newSigner(t).PublicKey()
+	if err := c.Check("web1", changed); err != ErrBlocked {
+		t.Errorf("c.Check(%q, changed) = %v; want %v", "web1", err, ErrBlocked)
+	}
+	// the old key does not unblock the host either.
+	if err := c.Check("web1", k); err != ErrBlocked {
+		t.Errorf("c.Check(%q, k) = %v after blocked; want %v", "web1", err, ErrBlocked)
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	k1, k2 := newSigner(t).PublicKey(), newSigner(t).PublicKey()
+	keys := HostKeys{
+		"web1":           {Host: "web1", State: StateTrusted, Key: marshal(k1)},
+		"web2:2222":      {Host: "web2:2222", State: StateTrusted, Key: marshal(k2)},
+		"web3":           {Host: "web3", State: StatePending, Offered: marshal(k1)},
+		"web4":           {Host: "web4", State: StateBlocked, Key: marshal(k1), Offered: marshal(k2)},
+		"[2001:db8::1]":  {Host: "[2001:db8::1]", State: StateTrusted, Key: marshal(k1)},
+		"web5.local:22":  {Host: "web5.local:22", State: StateTrusted, Key: marshal(k2)},
+		"web6.local:abc": {Host: "web6.local:abc"},
+	}
+	want := strings.Join([]string{
+		"[2001:db8::1] " + marshal(k1),
+		"web1 " + marshal(k1),
+		"[web2]:2222 " + marshal(k2),
+		"web5.local " + marshal(k2),
+	}, "\n") + "\n"
+	if got := string(keys.KnownHosts()); got != want {
+		t.Errorf("keys.KnownHosts() = %q; want %q", got, want)
+	}
+}
+
+// fakeServer is an SSH server which answers "echo ok" to any command with the current host key.
+type fakeServer struct {
+	l      net.Listener
+	signer chan ssh.Signer
+}
+
+func newFakeServer(t *testing.T, signer ssh.Signer) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen failed with %v", err)
+	}
+	s := &fakeServer{l: l, signer: make(chan ssh.Signer, 1)}
+	s.signer <- signer
+	go s.serve()
+	return s
+}
+
+// rotate replaces the host key of the server.
+func (s *fakeServer) rotate(signer ssh.Signer) {
+	<-s.signer
+	s.signer <- signer
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		signer := <-s.signer
+		s.signer <- signer
+		cfg := &ssh.ServerConfig{NoClientAuth: true}
+		cfg.AddHostKey(signer)
+		go s.handle(conn, cfg)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range reqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				ch.Write([]byte("ok\n"))
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) Close() error { return s.l.Close() }
+
+func TestOutputWithRotatingHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostkeys-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey failed with %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey failed with %v", err)
+	}
+	fname := path.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(fname, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile failed with %v", err)
+	}
+	cl, err := sshlib.WithPrivateKeyFile("deploy", fname)
+	if err != nil {
+		t.Fatalf("sshlib.WithPrivateKeyFile failed with %v", err)
+	}
+
+	first, second := newSigner(t), newSigner(t)
+	srv := newFakeServer(t, first)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+
+	s := etcdtest.NewStore()
+	cl = cl.WithHostKeys(newTestChecker(s, false))
+	ctx := context.Background()
+
+	if _, err := cl.Output(ctx, host, "echo ok"); err == nil {
+		t.Errorf("cl.Output(ctx, %q, ...) succeeded before approval; want failure", host)
+	}
+	if _, err := Approve(s, host, fingerprint(first.PublicKey()), "alice", now); err != nil {
+		t.Fatalf("Approve(s, %q, ...) failed with %v", host, err)
+	}
+	if out, err := cl.Output(ctx, host, "echo ok"); err != nil || string(out) != "ok\n" {
+		t.Errorf("cl.Output(ctx, %q, ...) = %q, %v after approval; want %q", host, out, err, "ok\n")
+	}
+
+	srv.rotate(second)
+	if _, err := cl.Output(ctx, host, "echo ok"); err == nil {
+		t.Errorf("cl.Output(ctx, %q, ...) succeeded with a rotated key; want failure", host)
+	}
+	if hk, err := Get(s, host); err != nil || hk.State != StateBlocked || hk.Offered != marshal(second.PublicKey()) {
+		t.Errorf("Get(s, %q) = %#v, %v; want blocked with the rotated key offered", host, hk, err)
+	}
+	if _, err := Approve(s, host, fingerprint(second.PublicKey()), "alice", now); err != nil {
+		t.Fatalf("Approve(s, %q, ...) failed with %v", host, err)
+	}
+	if out, err := cl.Output(ctx, host, "echo ok"); err != nil || string(out) != "ok\n" {
+		t.Errorf("cl.Output(ctx, %q, ...) = %q, %v after re-approval; want %q", host, out, err, "ok\n")
+	}
+}
@@ -0,0 +1,83 @@
+// Package hostlock manages locks of single hosts, e.g. under investigation, which deployments leave alone
+// even while their environments are open.
+// Locks are stored apart from the configuration so that they survive reloads of it.
+package hostlock
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/gengo/goship/lib/hostset"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains host locks in "<project>/<environment>/<host>".
+	keyPrefix = "/goship/hostlocks"
+)
+
+// Hosts is the set of locked hosts.
+var Hosts = hostset.Set{Prefix: keyPrefix, Noun: "host lock", Verb: "lock", Undo: "unlock", RequireReason: true}
+
+// Store is the subset of etcd.Client which stores host locks.
+type Store hostset.Store
+
+// Lock describes a locked host. Its Reason is why the host must not be deployed into.
+type Lock hostset.Mark
+
+// String describes who locked the host and why, e.g. "locked by alice: investigating memory leak".
+func (l Lock) String() string {
+	return fmt.Sprintf("locked by %s: %s", l.By, l.Reason)
+}
+
+// Set locks "host" in "env" of "proj" on behalf of "by" for "reason", which must not be empty.
+// The lock is released after "ttl" unless "ttl" is zero.
+func Set(s Store, proj, env, host, by, reason string, ttl time.Duration, now time.Time) (Lock, error) {
+	m, err := Hosts.Add(s, proj, env, host, by, reason, ttl, now)
+	return Lock(m), err
+}
+
+// Rename moves the host locks of the project "from" to the project "to" as of "now".
+func Rename(s Store, from, to string, now time.Time) error {
+	return Hosts.Rename(s, from, to, now)
+}
+
+// Clear releases the lock of "host" in "env" of "proj". It is not an error if the host is not locked.
+func Clear(s Store, proj, env, host string) error {
+	return Hosts.Remove(s, proj, env, host)
+}
+
+// Locks are locked hosts keyed by "<project>/<environment>/<host>".
+type Locks map[string]Lock
+
+// Load returns the hosts locked at "now".
+func Load(s Store, now time.Time) (Locks, error) {
+	ms, err := Hosts.Load(s, now)
+	if err != nil {
+		return nil, err
+	}
+	ls := make(Locks, len(ms))
+	for k, m := range ms {
+		ls[k] = Lock(m)
+	}
+	return ls, nil
+}
+
+// Get returns the lock of "host" in "env" of "proj" if locked.
+func (ls Locks) Get(proj, env, host string) (Lock, bool) {
+	l, ok := ls[path.Join(proj, env, host)]
+	return l, ok
+}
+
+// Split returns the names in "hosts" of "env" of "proj" which are not locked, and the locked ones.
+func (ls Locks) Split(proj, env string, hosts []string) (unlocked, locked []string) {
+	unlocked = make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if _, ok := ls.Get(proj, env, h); ok {
+			locked = append(locked, h)
+			continue
+		}
+		unlocked = append(unlocked, h)
+	}
+	return unlocked, locked
+}
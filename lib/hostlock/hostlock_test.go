@@ -0,0 +1,110 @@
+package hostlock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSetAndLoad(t *testing.T) {
+	s := etcdtest.NewStore()
+	if ls, err := Load(s, now); err != nil || len(ls) != 0 {
+		t.Errorf("Load(s, now) = %#v, %v; want no locks", ls, err)
+	}
+	web1, err := Set(s, "api", "production", "web1", "alice", "investigating memory leak", 0, now)
+	if err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web1", err)
+	}
+	if _, err := Set(s, "api", "production", "web2", "bob", "core dump", 90*time.Minute, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web2", err)
+	}
+	if got, want := s.TTLs[keyPrefix+"/api/production/web2"], uint64(90*60); got != want {
+		t.Errorf("ttl of web2 = %d; want %d", got, want)
+	}
+
+	ls, err := Load(s, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Load(s, now+1h) failed with %v", err)
+	}
+	if got, ok := ls.Get("api", "production", "web1"); !ok || !reflect.DeepEqual(got, web1) {
+		t.Errorf("ls.Get(%q, %q, %q) = %#v, %v; want %#v, true", "api", "production", "web1", got, ok, web1)
+	}
+	if got, want := web1.String(), "locked by alice: investigating memory leak"; got != want {
+		t.Errorf("web1.String() = %q; want %q", got, want)
+	}
+	if got, ok := ls.Get("api", "production", "web2"); !ok || got.Reason != "core dump" || got.Until == nil || !got.Until.Equal(now.Add(90*time.Minute)) {
+		t.Errorf("ls.Get(%q, %q, %q) = %#v, %v; want locked by bob until now+90m", "api", "production", "web2", got, ok)
+	}
+
+	// the store may keep keys for a while after their TTLs.
+	if ls, err = Load(s, now.Add(90*time.Minute)); err != nil {
+		t.Fatalf("Load(s, now+90m) failed with %v", err)
+	}
+	if got, ok := ls.Get("api", "production", "web2"); ok {
+		t.Errorf("ls.Get(%q, %q, %q) = %#v, true after its TTL; want false", "api", "production", "web2", got)
+	}
+
+	if err := Clear(s, "api", "production", "web1"); err != nil {
+		t.Errorf("Clear(s, ..., %q) failed with %v", "web1", err)
+	}
+	if err := Clear(s, "api", "production", "web1"); err != nil {
+		t.Errorf("Clear(s, ..., %q) failed with %v for a host not locked; want success", "web1", err)
+	}
+	if ls, err = Load(s, now); err != nil {
+		t.Fatalf("Load(s, now) failed with %v", err)
+	}
+	if got, ok := ls.Get("api", "production", "web1"); ok {
+		t.Errorf("ls.Get(%q, %q, %q) = %#v, true after Clear; want false", "api", "production", "web1", got)
+	}
+
+	for _, host := range []string{"", "..", "web/1"} {
+		if _, err := Set(s, "api", "production", host, "alice", "reason", 0, now); err == nil {
+			t.Errorf("Set(s, ..., %q, ...) succeeded; want failure", host)
+		}
+	}
+	if _, err := Set(s, "api", "production", "web3", "alice", "reason", -time.Hour, now); err == nil {
+		t.Errorf("Set(s, ..., -1h, now) succeeded; want failure")
+	}
+	if _, err := Set(s, "api", "production", "web3", "alice", " ", 0, now); err == nil {
+		t.Errorf("Set(s, ..., %q, ...) succeeded without a reason; want failure", " ")
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := etcdtest.NewStore()
+	if _, err := Set(s, "api", "production", "web1", "alice", "investigating", 0, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web1", err)
+	}
+	if _, err := Set(s, "apiv2", "production", "web3", "carol", "investigating", 0, now); err != nil {
+		t.Fatalf("Set(s, ..., %q, ...) failed with %v", "web3", err)
+	}
+	if err := Rename(s, "api", "gateway", now); err != nil {
+		t.Fatalf("Rename(s, %q, %q, now) failed with %v", "api", "gateway", err)
+	}
+	ls, err := Load(s, now)
+	if err != nil {
+		t.Fatalf("Load(s, now) failed with %v", err)
+	}
+	want := Locks{
+		"gateway/production/web1": {Reason: "investigating", By: "alice", Since: now},
+		"apiv2/production/web3":   {Reason: "investigating", By: "carol", Since: now},
+	}
+	if !reflect.DeepEqual(ls, want) {
+		t.Errorf("Load(s, now) = %#v; want %#v", ls, want)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ls := Locks{"api/production/web2": {By: "alice", Since: now}, "api/staging/web1": {By: "bob", Since: now}}
+	unlocked, locked := ls.Split("api", "production", []string{"web1", "web2", "web3"})
+	if want := []string{"web1", "web3"}; !reflect.DeepEqual(unlocked, want) {
+		t.Errorf("unlocked hosts of ls.Split(%q, %q, hosts) = %q; want %q", "api", "production", unlocked, want)
+	}
+	if want := []string{"web2"}; !reflect.DeepEqual(locked, want) {
+		t.Errorf("locked hosts of ls.Split(%q, %q, hosts) = %q; want %q", "api", "production", locked, want)
+	}
+}
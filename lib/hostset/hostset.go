@@ -0,0 +1,172 @@
+// Package hostset manages sets of single hosts marked by users, e.g. drained or locked hosts.
+// Marks are stored apart from the configuration so that they survive reloads of it.
+package hostset
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// Store is the subset of etcd.Client which stores marks.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Mark describes a marked host.
+type Mark struct {
+	// Reason is why the host has been marked. It is empty in sets which do not take reasons.
+	Reason string `json:"reason,omitempty"`
+	// By is the user who marked the host.
+	By    string    `json:"by"`
+	Since time.Time `json:"since"`
+	// Until is when the mark is cleared automatically. It is nil if the mark lasts until cleared by a user.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// expired returns true iff the mark has been cleared automatically by "now".
+func (m Mark) expired(now time.Time) bool {
+	return m.Until != nil && !now.Before(*m.Until)
+}
+
+// Set is a kind of marks, e.g. drains, stored in etcd.
+type Set struct {
+	// Prefix is the etcd directory which contains the marks in "<project>/<environment>/<host>".
+	Prefix string
+	// Noun names a mark in errors, e.g. "host lock".
+	Noun string
+	// Verb and Undo are what users do to mark hosts and to clear the marks, e.g. "lock" and "unlock".
+	// Verb is also the last component of the API path of the set.
+	Verb, Undo string
+	// RequireReason refuses marks without reasons.
+	RequireReason bool
+}
+
+func (hs Set) key(proj, env, host string) (string, error) {
+	for _, name := range []string{proj, env, host} {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid name %q", name)
+		}
+	}
+	return path.Join(hs.Prefix, proj, env, host), nil
+}
+
+// Add marks "host" in "env" of "proj" on behalf of "by" for "reason", which must not be empty if RequireReason.
+// The mark is cleared after "ttl" unless "ttl" is zero.
+func (hs Set) Add(s Store, proj, env, host, by, reason string, ttl time.Duration, now time.Time) (Mark, error) {
+	k, err := hs.key(proj, env, host)
+	if err != nil {
+		return Mark{}, err
+	}
+	if ttl < 0 {
+		return Mark{}, fmt.Errorf("invalid ttl %s", ttl)
+	}
+	reason = strings.TrimSpace(reason)
+	if hs.RequireReason && reason == "" {
+		return Mark{}, fmt.Errorf("no reason to %s %s", hs.Verb, host)
+	}
+	m := Mark{Reason: reason, By: by, Since: now}
+	if ttl > 0 {
+		until := now.Add(ttl)
+		m.Until = &until
+	}
+	if err := store(s, k, m, now); err != nil {
+		return Mark{}, err
+	}
+	return m, nil
+}
+
+// store stores "m" into "k" so that etcd clears it at m.Until.
+func store(s Store, k string, m Mark, now time.Time) error {
+	var seconds uint64
+	if m.Until != nil {
+		// rounds up so that etcd does not clear the mark before Until.
+		seconds = uint64((m.Until.Sub(now) + time.Second - 1) / time.Second)
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(k, string(buf), seconds)
+	return err
+}
+
+// Rename moves the marks of the project "from" to the project "to" as of "now".
+// Marks keep who marked the hosts, why, since when and until when.
+func (hs Set) Rename(s Store, from, to string, now time.Time) error {
+	ms, err := hs.Load(s, now)
+	if err != nil {
+		return err
+	}
+	for name, m := range ms {
+		parts := strings.SplitN(name, "/", 3)
+		if len(parts) != 3 || parts[0] != from {
+			continue
+		}
+		k, err := hs.key(to, parts[1], parts[2])
+		if err != nil {
+			return err
+		}
+		if err := store(s, k, m, now); err != nil {
+			return err
+		}
+		if err := hs.Remove(s, from, parts[1], parts[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove clears the mark of "host" in "env" of "proj". It is not an error if the host is not marked.
+func (hs Set) Remove(s Store, proj, env, host string) error {
+	k, err := hs.key(proj, env, host)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Delete(k, false); err != nil && !etcderr.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Load returns the marks in effect at "now" keyed by "<project>/<environment>/<host>".
+func (hs Set) Load(s Store, now time.Time) (map[string]Mark, error) {
+	resp, err := s.Get(hs.Prefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return map[string]Mark{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ms := make(map[string]Mark)
+	var walk func(n *etcd.Node) error
+	walk = func(n *etcd.Node) error {
+		if n.Dir {
+			for _, c := range n.Nodes {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		var m Mark
+		if err := json.Unmarshal([]byte(n.Value), &m); err != nil {
+			return fmt.Errorf("malformed %s %s: %v", hs.Noun, n.Key, err)
+		}
+		if !m.expired(now) {
+			ms[strings.TrimPrefix(n.Key, hs.Prefix+"/")] = m
+		}
+		return nil
+	}
+	if err := walk(resp.Node); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
@@ -0,0 +1,191 @@
+package i18n
+
+// en is the complete catalog which the other languages fall back to.
+var en = map[string]string{
+	"time.long":  "Jan 2, 2006 at 3:04pm (MST)",
+	"time.short": "2006-01-02 15:04 MST",
+
+	"ago.seconds.one":   "%d second ago",
+	"ago.seconds.other": "%d seconds ago",
+	"ago.minutes.one":   "%d minute ago",
+	"ago.minutes.other": "%d minutes ago",
+	"ago.hours.one":     "%d hour ago",
+	"ago.hours.other":   "%d hours ago",
+
+	"nav.home":          "Home",
+	"nav.activity":      "Activity",
+	"nav.tokens":        "API tokens",
+	"nav.subscriptions": "Subscriptions",
+	"nav.sign_out":      "Sign out %s",
+
+	"csrf.invalid": "Your session has changed, e.g. by signing in again. Reload the page and try again.",
+
+	"home.config_invalid":     "The global config in etcd is invalid and the last valid one is used:",
+	"home.sort_hosts_by":      "Sort hosts by",
+	"home.sort.config":        "config",
+	"home.sort.name":          "name",
+	"home.sort.state":         "commit state",
+	"home.pin":                "Pin to the top",
+	"home.config_error":       "config error",
+	"home.config_error_title": "The last valid config is used:",
+	"home.environment":        "Environment",
+	"home.select_batch":       "Select for batch deploy",
+	"home.ephemeral":          "ephemeral",
+	"home.ephemeral_title":    "Created for %s; removed after %s",
+	"home.clone_title":        "Create an environment like %s",
+	"home.annotate_title":     "Pin an announcement to %s",
+	"home.log":                "log",
+	"home.compare":            "Compare environments",
+	"home.deploy_batch":       "Deploy selected environments",
+	"home.matrix_title":       "Commits in the row environment but not in the column environment",
+	"home.diff":               "diff",
+	"home.drain":              "drain",
+	"home.lock_host":          "lock",
+	"home.unlock_host":        "unlock",
+	"home.next_schedule":      "next scheduled deploy",
+	"home.skip_schedule":      "skip",
+	"home.unskip_schedule":    "unskip",
+	"home.schedule_skipped":   "skipped",
+	"home.loading_row":        "Loading...",
+	"home.nojs":               "JavaScript is disabled.",
+	"home.nojs_link":          "Show the environments without JavaScript",
+	"home.risk.low":           "low",
+	"home.risk.medium":        "medium",
+	"home.risk.high":          "high",
+	"home.risk.score":         "score",
+	"home.risk.points":        "points",
+	"home.impact.title":       "Deploying %s affects other projects:",
+	"home.impact.dependent":   "depends on it",
+	"home.impact.dependency":  "it depends on",
+	"home.impact.locked":      "locked",
+	"home.impact.scheduled":   "scheduled",
+	"home.impact.hidden":      "more which you cannot see",
+	"home.impact.confirm":     "Deploy anyway?",
+
+	"column.hosts":                      "Hosts",
+	"column.commit":                     "Deployed Revision",
+	"column.loading":                    "Loading...",
+	"column.unconfigured":               "No hosts configured",
+	"column.edit_hosts":                 "Configure hosts",
+	"column.diff":                       "Diff",
+	"column.branch":                     "Branch",
+	"column.last_deploy":                "Last Deploy",
+	"column.last_deploy.failed":         "failed",
+	"column.deployer":                   "Deployer",
+	"column.cleanup":                    "Cleanup",
+	"column.cleanup.stale":              "stale branch",
+	"column.cleanup.stale_title":        "No commits since %s",
+	"column.cleanup.pull_request":       "closed PR #%d",
+	"column.risk":                       "Risk",
+	"column.deploy.dependencies_title":  "Deploy %s first",
+	"column.deploy.with_dependencies":   "with dependencies",
+	"column.deploy.branch_title":        "Branch to deploy",
+	"column.deploy.persist_title":       "Keep deploying from the selected branch",
+	"column.deploy.persist":             "persist",
+	"column.deploy.flags_placeholder":   "Deploy with flags: key=value per line",
+	"column.deploy.flags_title":         "Allowed: %s",
+	"column.deploy.note_required":       "Reason of the deploy (required)",
+	"column.deploy.note":                "Reason of the deploy",
+	"column.deploy.confirm_placeholder": "Type %s to confirm",
+	"column.deploy.confirm_title":       "Deployments of %s must be confirmed",
+	"column.deploy.submit":              "Deploy",
+	"column.deploy.unconfigured_title":  "Add hosts to %s before deploying",
+	"column.deploy.refresh_title":       "Fetch the latest revision of %s",
+	"column.deploy.diff_unavailable":    "no diff",
+
+	"deploy.start_scroll":                "Start auto scroll",
+	"deploy.stop_scroll":                 "Stop auto scroll",
+	"deploy.override_blocklist":          "Deploy blocklisted commits anyway",
+	"deploy.override_blocklist_question": "Ship the blocklisted commits into %s? The override is recorded.",
+	"deploy.override_bake":               "Deploy before it has baked",
+	"deploy.override_bake_question":      "Ship the revision into %s before it has baked? The override is recorded.",
+
+	"deploy_log.environment_info": "Environment Info",
+	"deploy_log.name":             "Name",
+	"deploy_log.branch":           "Branch",
+	"deploy_log.repo_path":        "Repo Path",
+	"deploy_log.deploy_script":    "Deploy Script",
+	"deploy_log.lock":             "Lock",
+	"deploy_log.lock_button":      "lock",
+	"deploy_log.unlock":           "Unlock",
+	"deploy_log.comment":          "Comment",
+	"deploy_log.deployment_log":   "Deployment Log",
+	"deploy_log.time":             "Time",
+	"deploy_log.user":             "User",
+	"deploy_log.deployed_diff":    "Deployed Diff",
+	"deploy_log.result":           "Result",
+	"deploy_log.output":           "Output",
+	"deploy_log.batch":            "Batch",
+	"deploy_log.imported":         "Imported",
+	"deploy_log.success":          "Success",
+	"deploy_log.failure":          "Failure",
+	"deploy_log.external":         "External",
+	"deploy_log.external_title":   "Reported by an external deploy tool",
+	"deploy_log.pivotal_title":    "Pivotal stories",
+	"deploy_log.retry":            "retry %s",
+	"deploy_log.retry_title":      "Failed stories are retried automatically for 24 hours",
+	"deploy_log.retry_now":        "Retry now",
+	"deploy_log.flag_title":       "Deploy flag",
+	"deploy_log.note_title":       "Deploy note",
+	"deploy_log.release_title":    "GitHub release",
+	"deploy_log.artifacts_title":  "Artifacts",
+	"deploy_log.hook_title":       "Deploy hook",
+	"deploy_log.skipped":          "skipped %s",
+	"deploy_log.skipped_title":    "Skipped: %s",
+
+	"activity.title":                  "Activity",
+	"activity.project":                "Project",
+	"activity.type.all":               "all",
+	"activity.type.deploy_started":    "deploy started",
+	"activity.type.deploy_succeeded":  "deploy succeeded",
+	"activity.type.deploy_failed":     "deploy failed",
+	"activity.type.locked":            "locked",
+	"activity.type.unlocked":          "unlocked",
+	"activity.type.commented":         "commented",
+	"activity.type.config_changed":    "config changed",
+	"activity.type.host_key_approved": "host key approved",
+	"activity.type.secret_revealed":   "secret revealed",
+	"activity.filter":                 "Filter",
+	"activity.time":                   "Time",
+	"activity.user":                   "User",
+	"activity.what":                   "What",
+	"activity.older":                  "Older",
+
+	"tokens.title":                "API tokens",
+	"tokens.description":          "Tokens authenticate API requests on behalf of %s with",
+	"tokens.name_placeholder":     "Name, e.g. CI",
+	"tokens.scope.read":           "read",
+	"tokens.scope.deploy":         "deploy",
+	"tokens.scope.share":          "share",
+	"tokens.scope.share_title":    "Only views the wallboard of the projects",
+	"tokens.projects_placeholder": "Projects, e.g. api,web",
+	"tokens.expires_title":        "Days until the token expires. 0 never expires",
+	"tokens.create":               "Create token",
+	"tokens.copy_secret":          "Copy the secret now. It will not be shown again.",
+	"tokens.wallboard":            "Wallboard:",
+	"tokens.all":                  "All tokens",
+	"tokens.user":                 "User",
+	"tokens.name":                 "Name",
+	"tokens.scopes":               "Scopes",
+	"tokens.created":              "Created",
+	"tokens.last_used":            "Last used",
+	"tokens.expires":              "Expires",
+
+	"subscriptions.title":                   "Subscriptions",
+	"subscriptions.description":             "Get a message when deployments ship into the environments, or only when they ship your commits. Messages are sent by email if set, or as Slack direct messages otherwise.",
+	"subscriptions.github_login":            "GitHub login matched against commit authors",
+	"subscriptions.email":                   "Email",
+	"subscriptions.email_placeholder":       "Leave empty for Slack direct messages",
+	"subscriptions.project":                 "Project",
+	"subscriptions.environment":             "Environment",
+	"subscriptions.what":                    "Notify",
+	"subscriptions.project_placeholder":     "Project, or empty for all",
+	"subscriptions.environment_placeholder": "Environment, e.g. production",
+	"subscriptions.my_commits":              "my commits only",
+	"subscriptions.all_deployments":         "all deployments",
+	"subscriptions.all_projects":            "all projects",
+	"subscriptions.add":                     "Add",
+	"subscriptions.remove":                  "Remove",
+	"subscriptions.save":                    "Save",
+	"subscriptions.saved":                   "Saved.",
+}
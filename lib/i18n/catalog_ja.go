@@ -0,0 +1,191 @@
+package i18n
+
+// ja is the Japanese catalog. Missing messages fall back to English.
+var ja = map[string]string{
+	"time.long":  "2006年1月2日 15:04 (MST)",
+	"time.short": "2006/01/02 15:04 MST",
+
+	"ago.seconds.one":   "%d秒前",
+	"ago.seconds.other": "%d秒前",
+	"ago.minutes.one":   "%d分前",
+	"ago.minutes.other": "%d分前",
+	"ago.hours.one":     "%d時間前",
+	"ago.hours.other":   "%d時間前",
+
+	"nav.home":          "ホーム",
+	"nav.activity":      "アクティビティ",
+	"nav.tokens":        "APIトークン",
+	"nav.subscriptions": "通知の購読",
+	"nav.sign_out":      "%s をサインアウト",
+
+	"csrf.invalid": "セッションが変わりました（再度サインインした場合など）。ページを再読み込みしてやり直してください。",
+
+	"home.config_invalid":     "etcd のグローバル設定が不正なため、最後に有効だった設定を使用しています:",
+	"home.sort_hosts_by":      "ホストの並び順",
+	"home.sort.config":        "設定順",
+	"home.sort.name":          "名前",
+	"home.sort.state":         "コミットの状態",
+	"home.pin":                "先頭に固定",
+	"home.config_error":       "設定エラー",
+	"home.config_error_title": "最後に有効だった設定を使用しています:",
+	"home.environment":        "環境",
+	"home.select_batch":       "一括デプロイの対象にする",
+	"home.ephemeral":          "一時環境",
+	"home.ephemeral_title":    "%s 用に作成; %s 以降に削除",
+	"home.clone_title":        "%s と同じ構成の環境を作成",
+	"home.annotate_title":     "%s にお知らせを掲示",
+	"home.log":                "ログ",
+	"home.compare":            "環境を比較",
+	"home.deploy_batch":       "選択した環境にデプロイ",
+	"home.matrix_title":       "行の環境にあって列の環境にないコミット",
+	"home.diff":               "差分",
+	"home.drain":              "切り離す",
+	"home.lock_host":          "ロック",
+	"home.unlock_host":        "ロック解除",
+	"home.next_schedule":      "次の定期デプロイ",
+	"home.skip_schedule":      "スキップ",
+	"home.unskip_schedule":    "スキップ取消",
+	"home.schedule_skipped":   "スキップ予定",
+	"home.loading_row":        "読み込み中...",
+	"home.nojs":               "JavaScript が無効です。",
+	"home.nojs_link":          "JavaScript なしで環境を表示",
+	"home.risk.low":           "低",
+	"home.risk.medium":        "中",
+	"home.risk.high":          "高",
+	"home.risk.score":         "スコア",
+	"home.risk.points":        "点",
+	"home.impact.title":       "%s のデプロイは他のプロジェクトに影響します:",
+	"home.impact.dependent":   "依存元",
+	"home.impact.dependency":  "依存先",
+	"home.impact.locked":      "ロック中",
+	"home.impact.scheduled":   "予定",
+	"home.impact.hidden":      "件は閲覧できません",
+	"home.impact.confirm":     "デプロイしますか?",
+
+	"column.hosts":                      "ホスト",
+	"column.commit":                     "デプロイ済みリビジョン",
+	"column.loading":                    "読み込み中...",
+	"column.unconfigured":               "ホストが設定されていません",
+	"column.edit_hosts":                 "ホストを設定",
+	"column.diff":                       "差分",
+	"column.branch":                     "ブランチ",
+	"column.last_deploy":                "最終デプロイ",
+	"column.last_deploy.failed":         "失敗",
+	"column.deployer":                   "デプロイした人",
+	"column.cleanup":                    "整理",
+	"column.cleanup.stale":              "古いブランチ",
+	"column.cleanup.stale_title":        "%s 以降コミットなし",
+	"column.cleanup.pull_request":       "クローズ済み PR #%d",
+	"column.risk":                       "リスク",
+	"column.deploy.dependencies_title":  "先に %s をデプロイ",
+	"column.deploy.with_dependencies":   "依存する環境も",
+	"column.deploy.branch_title":        "デプロイするブランチ",
+	"column.deploy.persist_title":       "選択したブランチからデプロイし続ける",
+	"column.deploy.persist":             "固定",
+	"column.deploy.flags_placeholder":   "デプロイフラグ: 1行に key=value",
+	"column.deploy.flags_title":         "使用可能: %s",
+	"column.deploy.note_required":       "デプロイの理由 (必須)",
+	"column.deploy.note":                "デプロイの理由",
+	"column.deploy.confirm_placeholder": "確認のため %s と入力",
+	"column.deploy.confirm_title":       "%s へのデプロイには確認が必要です",
+	"column.deploy.submit":              "デプロイ",
+	"column.deploy.unconfigured_title":  "デプロイする前に %s にホストを追加してください",
+	"column.deploy.refresh_title":       "%s の最新リビジョンを取得",
+	"column.deploy.diff_unavailable":    "差分なし",
+
+	"deploy.start_scroll":                "自動スクロールを開始",
+	"deploy.stop_scroll":                 "自動スクロールを停止",
+	"deploy.override_blocklist":          "ブロックリストのコミットをデプロイする",
+	"deploy.override_blocklist_question": "ブロックリストのコミットを %s にデプロイしますか? この操作は記録されます。",
+	"deploy.override_bake":               "待機時間を待たずにデプロイする",
+	"deploy.override_bake_question":      "待機時間を待たずにリビジョンを %s にデプロイしますか? この操作は記録されます。",
+
+	"deploy_log.environment_info": "環境の情報",
+	"deploy_log.name":             "名前",
+	"deploy_log.branch":           "ブランチ",
+	"deploy_log.repo_path":        "リポジトリのパス",
+	"deploy_log.deploy_script":    "デプロイスクリプト",
+	"deploy_log.lock":             "ロック",
+	"deploy_log.lock_button":      "ロック",
+	"deploy_log.unlock":           "ロック解除",
+	"deploy_log.comment":          "コメント",
+	"deploy_log.deployment_log":   "デプロイ履歴",
+	"deploy_log.time":             "日時",
+	"deploy_log.user":             "ユーザー",
+	"deploy_log.deployed_diff":    "デプロイした差分",
+	"deploy_log.result":           "結果",
+	"deploy_log.output":           "出力",
+	"deploy_log.batch":            "一括",
+	"deploy_log.imported":         "インポート",
+	"deploy_log.success":          "成功",
+	"deploy_log.failure":          "失敗",
+	"deploy_log.external":         "外部",
+	"deploy_log.external_title":   "外部のデプロイツールからの報告",
+	"deploy_log.pivotal_title":    "Pivotal のストーリー",
+	"deploy_log.retry":            "再試行 %s",
+	"deploy_log.retry_title":      "失敗したストーリーは24時間自動で再試行されます",
+	"deploy_log.retry_now":        "今すぐ再試行",
+	"deploy_log.flag_title":       "デプロイフラグ",
+	"deploy_log.note_title":       "デプロイの理由",
+	"deploy_log.release_title":    "GitHub リリース",
+	"deploy_log.artifacts_title":  "成果物",
+	"deploy_log.hook_title":       "デプロイフック",
+	"deploy_log.skipped":          "%s をスキップ",
+	"deploy_log.skipped_title":    "スキップ: %s",
+
+	"activity.title":                  "アクティビティ",
+	"activity.project":                "プロジェクト",
+	"activity.type.all":               "すべて",
+	"activity.type.deploy_started":    "デプロイ開始",
+	"activity.type.deploy_succeeded":  "デプロイ成功",
+	"activity.type.deploy_failed":     "デプロイ失敗",
+	"activity.type.locked":            "ロック",
+	"activity.type.unlocked":          "ロック解除",
+	"activity.type.commented":         "コメント",
+	"activity.type.config_changed":    "設定変更",
+	"activity.type.host_key_approved": "ホスト鍵の承認",
+	"activity.type.secret_revealed":   "シークレットの表示",
+	"activity.filter":                 "絞り込み",
+	"activity.time":                   "日時",
+	"activity.user":                   "ユーザー",
+	"activity.what":                   "内容",
+	"activity.older":                  "さらに古いもの",
+
+	"tokens.title":                "APIトークン",
+	"tokens.description":          "トークンは %s として API リクエストを認証します:",
+	"tokens.name_placeholder":     "名前 (例: CI)",
+	"tokens.scope.read":           "読み取り",
+	"tokens.scope.deploy":         "デプロイ",
+	"tokens.scope.share":          "共有",
+	"tokens.scope.share_title":    "プロジェクトのウォールボードの閲覧のみ",
+	"tokens.projects_placeholder": "プロジェクト (例: api,web)",
+	"tokens.expires_title":        "有効期限までの日数。0 は無期限",
+	"tokens.create":               "トークンを作成",
+	"tokens.copy_secret":          "シークレットを今すぐコピーしてください。再表示はできません。",
+	"tokens.wallboard":            "ウォールボード:",
+	"tokens.all":                  "すべてのトークン",
+	"tokens.user":                 "ユーザー",
+	"tokens.name":                 "名前",
+	"tokens.scopes":               "スコープ",
+	"tokens.created":              "作成日時",
+	"tokens.last_used":            "最終使用日時",
+	"tokens.expires":              "有効期限",
+
+	"subscriptions.title":                   "通知の購読",
+	"subscriptions.description":             "環境へのデプロイ、または自分のコミットを含むデプロイが完了したときにメッセージを受け取ります。メールアドレスを設定するとメールで、設定しなければ Slack のダイレクトメッセージで送られます。",
+	"subscriptions.github_login":            "コミットの作者と照合する GitHub ログイン",
+	"subscriptions.email":                   "メールアドレス",
+	"subscriptions.email_placeholder":       "空欄なら Slack のダイレクトメッセージ",
+	"subscriptions.project":                 "プロジェクト",
+	"subscriptions.environment":             "環境",
+	"subscriptions.what":                    "通知",
+	"subscriptions.project_placeholder":     "プロジェクト (空欄ならすべて)",
+	"subscriptions.environment_placeholder": "環境 (例: production)",
+	"subscriptions.my_commits":              "自分のコミットのみ",
+	"subscriptions.all_deployments":         "すべてのデプロイ",
+	"subscriptions.all_projects":            "すべてのプロジェクト",
+	"subscriptions.add":                     "追加",
+	"subscriptions.remove":                  "削除",
+	"subscriptions.save":                    "保存",
+	"subscriptions.saved":                   "保存しました。",
+}
@@ -0,0 +1,169 @@
+// Package i18n localizes the web UI of goship with message catalogs.
+// English is the complete catalog. Messages missing in other languages fall back to English.
+// Errors of APIs and notifications are not localized.
+package i18n
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// English is the language of messages by default.
+	English = "en"
+	// Japanese is the language of the catalog for the Tokyo office.
+	Japanese = "ja"
+
+	// Param is the query parameter which switches the language of the UI, e.g. ?lang=ja.
+	Param = "lang"
+	// CookieName is the cookie which remembers the language chosen with Param.
+	CookieName = "lang"
+	// cookieMaxAge is how long the chosen language is remembered, i.e. a year.
+	cookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// catalogs are the messages keyed by their IDs in each language.
+var catalogs = map[string]map[string]string{
+	English:  en,
+	Japanese: ja,
+}
+
+// Supported returns true if "lang" has a catalog.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Localizer renders messages and times in a language and a timezone.
+type Localizer struct {
+	lang string
+	loc  *time.Location
+}
+
+// New returns a Localizer of "lang" in "loc". Unsupported languages are English, and nil "loc" is UTC.
+func New(lang string, loc *time.Location) *Localizer {
+	if !Supported(lang) {
+		lang = English
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Localizer{lang: lang, loc: loc}
+}
+
+// FromRequest returns a Localizer in UTC of the language given by Param of "r", or by the cookie if not given.
+// The language given by Param is remembered in the cookie for later requests.
+func FromRequest(w http.ResponseWriter, r *http.Request) *Localizer {
+	if lang := r.URL.Query().Get(Param); Supported(lang) {
+		http.SetCookie(w, &http.Cookie{Name: CookieName, Value: lang, Path: "/", MaxAge: cookieMaxAge, HttpOnly: true})
+		return New(lang, nil)
+	}
+	if c, err := r.Cookie(CookieName); err == nil {
+		return New(c.Value, nil)
+	}
+	return New(English, nil)
+}
+
+// Lang returns the language of "l".
+func (l *Localizer) Lang() string {
+	return l.lang
+}
+
+// In returns a copy of "l" which renders times in "loc".
+func (l *Localizer) In(loc *time.Location) *Localizer {
+	return New(l.lang, loc)
+}
+
+// T returns the message "key" formatted with "args" as in fmt.Sprintf.
+// The message falls back to English if the language has none, and to "key" if English has none either.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	msg := l.message(key)
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Time returns "t" in the timezone of "l" in the long format of the language.
+func (l *Localizer) Time(t time.Time) string {
+	return t.In(l.loc).Format(l.message("time.long"))
+}
+
+// ShortTime returns "t" in the timezone of "l" in the short format of the language.
+func (l *Localizer) ShortTime(t time.Time) string {
+	return t.In(l.loc).Format(l.message("time.short"))
+}
+
+// Ago returns how long before "now" "t" is, e.g. "3 minutes ago", or Time(t) if it is a day or longer.
+func (l *Localizer) Ago(t, now time.Time) string {
+	s := now.Sub(t)
+	switch {
+	case s < time.Minute:
+		return l.plural("ago.seconds", int(s/time.Second))
+	case s < time.Hour:
+		return l.plural("ago.minutes", int(s/time.Minute))
+	case s < 24*time.Hour:
+		return l.plural("ago.hours", int(s/time.Hour))
+	default:
+		return l.Time(t)
+	}
+}
+
+// plural returns the message "<key>.one" or "<key>.other" by "n", formatted with "n".
+func (l *Localizer) plural(key string, n int) string {
+	if n <= 1 {
+		return l.T(key+".one", n)
+	}
+	return l.T(key+".other", n)
+}
+
+// Funcs returns the template functions bound to "l":
+// "t" is T, "formatTime" is Time, "shortTime" is ShortTime and "lang" is Lang.
+func (l *Localizer) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"t":          l.T,
+		"formatTime": l.Time,
+		"shortTime":  l.ShortTime,
+		"lang":       l.Lang,
+	}
+}
+
+func (l *Localizer) message(key string) string {
+	if msg, ok := catalogs[l.lang][key]; ok {
+		return msg
+	}
+	reportMissing(l.lang, key)
+	if msg, ok := en[key]; ok {
+		return msg
+	}
+	if l.lang != English {
+		reportMissing(English, key)
+	}
+	return key
+}
+
+// missing is the set of messages reported missing, keyed by "<lang>/<key>".
+var missing = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// warnf logs missing messages. It is replaced in tests.
+var warnf = glog.Warningf
+
+// reportMissing logs once that the message "key" is missing in "lang".
+func reportMissing(lang, key string) {
+	missing.Lock()
+	defer missing.Unlock()
+	k := lang + "/" + key
+	if missing.keys[k] {
+		return
+	}
+	missing.keys[k] = true
+	warnf("Message %q is missing in the catalog of %q", key, lang)
+}
@@ -0,0 +1,112 @@
+package i18n
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCatalogsComplete(t *testing.T) {
+	for lang, msgs := range catalogs {
+		for key := range msgs {
+			if _, ok := en[key]; !ok {
+				t.Errorf("message %q of %q is not in the English catalog", key, lang)
+			}
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	var logged []string
+	orig := warnf
+	warnf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	defer func() { warnf = orig }()
+	en["test.only_english"] = "Deployed %d times"
+	defer delete(en, "test.only_english")
+
+	ja := New(Japanese, nil)
+	for i := 0; i < 2; i++ {
+		if got, want := ja.T("test.only_english", 3), "Deployed 3 times"; got != want {
+			t.Errorf("T(%q) = %q in %q; want %q in English", "test.only_english", got, Japanese, want)
+		}
+	}
+	if got, want := ja.T("test.nowhere"), "test.nowhere"; got != want {
+		t.Errorf("T(%q) = %q; want the key", "test.nowhere", got)
+	}
+	if got, want := ja.T("nav.home"), "ホーム"; got != want {
+		t.Errorf("T(%q) = %q; want %q", "nav.home", got, want)
+	}
+	// logged once per message and language.
+	if len(logged) != 3 {
+		t.Errorf("logged %q; want 3 lines of the missing messages", logged)
+	}
+	New(English, nil).T("test.only_english", 1)
+	if len(logged) != 3 {
+		t.Errorf("logged %q after rendering in English; want no more", logged)
+	}
+}
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2016, 7, 20, 12, 0, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+	for _, spec := range []struct {
+		lang string
+		loc  *time.Location
+		t    time.Time
+		want string
+	}{
+		{lang: English, t: time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC), want: "Nov 10, 2009 at 11:00pm (UTC)"},
+		{lang: English, t: now.Add(-time.Second), want: "1 second ago"},
+		{lang: English, t: now.Add(-30 * time.Second), want: "30 seconds ago"},
+		{lang: English, t: now.Add(-time.Minute), want: "1 minute ago"},
+		{lang: English, t: now.Add(-30 * time.Minute), want: "30 minutes ago"},
+		{lang: English, t: now.Add(-time.Hour), want: "1 hour ago"},
+		{lang: English, t: now.Add(-3 * time.Hour), want: "3 hours ago"},
+		{lang: English, loc: tokyo, t: time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC), want: "Nov 11, 2009 at 8:00am (JST)"},
+		{lang: Japanese, t: now.Add(-30 * time.Minute), want: "30分前"},
+		{lang: Japanese, t: now.Add(-3 * time.Hour), want: "3時間前"},
+		{lang: Japanese, loc: tokyo, t: time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC), want: "2009年11月11日 08:00 (JST)"},
+	} {
+		if got := New(spec.lang, spec.loc).Ago(spec.t, now); got != spec.want {
+			t.Errorf("Ago(%s, %s) = %q in %q; want %q", spec.t, now, got, spec.lang, spec.want)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	for _, spec := range []struct {
+		url, cookie string
+		want        string
+		// wantCookie is the language remembered in the response, or empty if not.
+		wantCookie string
+	}{
+		{url: "/", want: English},
+		{url: "/?lang=ja", want: Japanese, wantCookie: Japanese},
+		{url: "/", cookie: Japanese, want: Japanese},
+		{url: "/?lang=en", cookie: Japanese, want: English, wantCookie: English},
+		// unsupported languages are ignored.
+		{url: "/?lang=fr", cookie: Japanese, want: Japanese},
+		{url: "/", cookie: "fr", want: English},
+	} {
+		r, err := http.NewRequest("GET", spec.url, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest failed with %v", err)
+		}
+		if spec.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: spec.cookie})
+		}
+		w := httptest.NewRecorder()
+		if got := FromRequest(w, r).Lang(); got != spec.want {
+			t.Errorf("FromRequest(%q with cookie %q).Lang() = %q; want %q", spec.url, spec.cookie, got, spec.want)
+		}
+		var got string
+		if resp := (&http.Response{Header: w.Header()}); len(resp.Cookies()) > 0 {
+			got = resp.Cookies()[0].Value
+		}
+		if got != spec.wantCookie {
+			t.Errorf("cookie after FromRequest(%q with cookie %q) = %q; want %q", spec.url, spec.cookie, got, spec.wantCookie)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package inventory tracks the hosts of each environment across refreshes, so that hosts which are added to or removed from
+// the config by external discovery, e.g. a script which syncs EC2 instances or Kubernetes nodes into etcd, do not change silently.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains the inventory of each environment in "<project>/<environment>".
+	keyPrefix = "/goship/inventory"
+
+	// maxChanges is the number of changes kept per environment.
+	maxChanges = 10
+)
+
+// Store is the subset of etcd.Client which stores inventories.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Change is a confirmed change of the hosts of an environment.
+type Change struct {
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// String describes "c", e.g. "gained web-042, lost web-017".
+func (c Change) String() string {
+	var parts []string
+	if len(c.Added) > 0 {
+		parts = append(parts, "gained "+strings.Join(c.Added, ", "))
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, "lost "+strings.Join(c.Removed, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// State is the inventory of an environment.
+type State struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Hosts are the confirmed hosts, sorted by name.
+	Hosts []string `json:"hosts"`
+	// Pending are the hosts observed by the last refresh if they differ from Hosts.
+	// They replace Hosts if the next refresh observes them again, so that flapping hosts are not notified.
+	// It is nil if there are no pending hosts, and empty if the last refresh observed no hosts.
+	Pending []string `json:"pending"`
+	// Changes are the recent confirmed changes from the newest one.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// observe returns the state after a refresh which observed "hosts" at "now", and the change confirmed by it if any.
+func (st State) observe(hosts []string, now time.Time) (State, *Change) {
+	hosts = sortedSet(hosts)
+	if sameHosts(hosts, st.Hosts) {
+		st.Pending = nil
+		return st, nil
+	}
+	if st.Pending == nil || !sameHosts(hosts, st.Pending) {
+		st.Pending = hosts
+		return st, nil
+	}
+	c := Change{Added: difference(hosts, st.Hosts), Removed: difference(st.Hosts, hosts), At: now}
+	st.Hosts, st.Pending = hosts, nil
+	st.Changes = append([]Change{c}, st.Changes...)
+	if len(st.Changes) > maxChanges {
+		st.Changes = st.Changes[:maxChanges]
+	}
+	return st, &c
+}
+
+// Observe records that a refresh observed "hosts" in "env" of "proj" at "now", and returns the change of the hosts
+// if it has persisted across two consecutive refreshes. The first observation of an environment is not a change.
+func Observe(s Store, proj, env string, hosts []string, now time.Time) (*Change, error) {
+	k, err := key(proj, env)
+	if err != nil {
+		return nil, err
+	}
+	var st State
+	resp, err := s.Get(k, false, false)
+	switch {
+	case etcderr.IsKeyNotFound(err):
+		st = State{Project: proj, Environment: env, Hosts: sortedSet(hosts)}
+		return nil, store(s, k, st)
+	case err != nil:
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(resp.Node.Value), &st); err != nil {
+		return nil, fmt.Errorf("malformed inventory %s: %v", k, err)
+	}
+	next, c := st.observe(hosts, now)
+	if c == nil && (next.Pending == nil) == (st.Pending == nil) && sameHosts(next.Pending, st.Pending) {
+		return nil, nil
+	}
+	return c, store(s, k, next)
+}
+
+func store(s Store, k string, st State) error {
+	buf, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(k, string(buf), 0)
+	return err
+}
+
+// Inventories are the inventories of environments keyed by "<project>/<environment>".
+type Inventories map[string]State
+
+// Load returns the inventories of all the environments.
+func Load(s Store) (Inventories, error) {
+	resp, err := s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return Inventories{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv := make(Inventories)
+	for _, p := range resp.Node.Nodes {
+		for _, e := range p.Nodes {
+			var st State
+			if err := json.Unmarshal([]byte(e.Value), &st); err != nil {
+				return nil, fmt.Errorf("malformed inventory %s: %v", e.Key, err)
+			}
+			inv[path.Join(st.Project, st.Environment)] = st
+		}
+	}
+	return inv, nil
+}
+
+// Recent returns the changes of the hosts of "env" of "proj" since "since" from the newest one.
+func (inv Inventories) Recent(proj, env string, since time.Time) []Change {
+	var recent []Change
+	for _, c := range inv[path.Join(proj, env)].Changes {
+		if c.At.Before(since) {
+			break
+		}
+		recent = append(recent, c)
+	}
+	return recent
+}
+
+// Forget removes the inventory of "env" of "proj", e.g. after the environment is removed.
+func Forget(s Store, proj, env string) error {
+	k, err := key(proj, env)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Delete(k, false); err != nil && !etcderr.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func key(proj, env string) (string, error) {
+	for _, name := range []string{proj, env} {
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid name %q", name)
+		}
+	}
+	return path.Join(keyPrefix, proj, env), nil
+}
+
+// sortedSet returns the distinct names in "names" sorted.
+func sortedSet(names []string) []string {
+	seen := make(map[string]bool)
+	set := []string{}
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			set = append(set, n)
+		}
+	}
+	sort.Strings(set)
+	return set
+}
+
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// difference returns the names in "a" which are not in "b".
+func difference(a, b []string) []string {
+	in := make(map[string]bool)
+	for _, n := range b {
+		in[n] = true
+	}
+	var diff []string
+	for _, n := range a {
+		if !in[n] {
+			diff = append(diff, n)
+		}
+	}
+	return diff
+}
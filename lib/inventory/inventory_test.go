@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/etcdtest"
+)
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestObserve(t *testing.T) {
+	type cycle struct {
+		hosts []string
+		// change is the expected notification, or empty if none.
+		change string
+	}
+	for _, spec := range []struct {
+		desc   string
+		cycles []cycle
+		hosts  []string
+	}{
+		{
+			desc: "stable hosts",
+			cycles: []cycle{
+				{hosts: []string{"web-001", "web-002"}},
+				{hosts: []string{"web-002", "web-001"}},
+				{hosts: []string{"web-001", "web-002", "web-001"}},
+			},
+			hosts: []string{"web-001", "web-002"},
+		},
+		{
+			desc: "persistent change",
+			cycles: []cycle{
+				{hosts: []string{"web-017", "web-041"}},
+				{hosts: []string{"web-041", "web-042"}},
+				{hosts: []string{"web-041", "web-042"}, change: "gained web-042, lost web-017"},
+				{hosts: []string{"web-041", "web-042"}},
+			},
+			hosts: []string{"web-041", "web-042"},
+		},
+		{
+			desc: "flapping host",
+			cycles: []cycle{
+				{hosts: []string{"web-041"}},
+				{hosts: []string{"web-041", "web-042"}},
+				{hosts: []string{"web-041"}},
+				{hosts: []string{"web-041", "web-042"}},
+				{hosts: []string{"web-041"}},
+			},
+			hosts: []string{"web-041"},
+		},
+		{
+			desc: "changing again before confirmed",
+			cycles: []cycle{
+				{hosts: []string{"web-041"}},
+				{hosts: []string{"web-041", "web-042"}},
+				{hosts: []string{"web-041", "web-043"}},
+				{hosts: []string{"web-041", "web-043"}, change: "gained web-043"},
+			},
+			hosts: []string{"web-041", "web-043"},
+		},
+		{
+			desc: "all hosts lost",
+			cycles: []cycle{
+				{hosts: []string{"web-041"}},
+				{hosts: nil},
+				{hosts: nil, change: "lost web-041"},
+				{hosts: []string{"web-041"}},
+				{hosts: []string{"web-041"}, change: "gained web-041"},
+			},
+			hosts: []string{"web-041"},
+		},
+	} {
+		s := etcdtest.NewStore()
+		var changes []Change
+		for i, c := range spec.cycles {
+			at := now.Add(time.Duration(i) * time.Minute)
+			got, err := Observe(s, "api", "production", c.hosts, at)
+			if err != nil {
+				t.Fatalf("Observe(s, %q, %q, %q, now+%dm) failed with %v with %s", "api", "production", c.hosts, i, err, spec.desc)
+			}
+			var desc string
+			if got != nil {
+				desc = got.String()
+				if !got.At.Equal(at) {
+					t.Errorf("got.At = %v in cycle %d with %s; want %v", got.At, i, spec.desc, at)
+				}
+				changes = append([]Change{*got}, changes...)
+			}
+			if desc != c.change {
+				t.Errorf("change in cycle %d = %q with %s; want %q", i, desc, spec.desc, c.change)
+			}
+		}
+		inv, err := Load(s)
+		if err != nil {
+			t.Fatalf("Load(s) failed with %v", err)
+		}
+		st := inv["api/production"]
+		if !reflect.DeepEqual(st.Hosts, spec.hosts) {
+			t.Errorf("st.Hosts = %q with %s; want %q", st.Hosts, spec.desc, spec.hosts)
+		}
+		if got := inv.Recent("api", "production", now); !reflect.DeepEqual(got, changes) {
+			t.Errorf("inv.Recent(%q, %q, now) = %v with %s; want %v", "api", "production", got, spec.desc, changes)
+		}
+	}
+}
+
+func TestRecent(t *testing.T) {
+	s := etcdtest.NewStore()
+	hosts := []string{"web-001"}
+	for i := 0; i < 2*maxChanges; i++ {
+		hosts = append(hosts, "web-1"+string('a'+byte(i)))
+		for j := 0; j < 2; j++ {
+			if _, err := Observe(s, "api", "production", hosts, now.Add(time.Duration(i)*time.Hour)); err != nil {
+				t.Fatalf("Observe(s, %q, %q, %q, now+%dh) failed with %v", "api", "production", hosts, i, err)
+			}
+		}
+	}
+	inv, err := Load(s)
+	if err != nil {
+		t.Fatalf("Load(s) failed with %v", err)
+	}
+	if got := inv.Recent("api", "production", now); len(got) != maxChanges {
+		t.Errorf("len(inv.Recent(%q, %q, now)) = %d; want %d", "api", "production", len(got), maxChanges)
+	}
+	since := now.Add(time.Duration(2*maxChanges-3) * time.Hour)
+	got := inv.Recent("api", "production", since)
+	if len(got) != 3 || got[0].String() != "gained web-1t" {
+		t.Errorf("inv.Recent(%q, %q, %v) = %v; want the last 3 changes from the newest", "api", "production", since, got)
+	}
+	if got := inv.Recent("api", "staging", now); len(got) != 0 {
+		t.Errorf("inv.Recent(%q, %q, now) = %v; want none", "api", "staging", got)
+	}
+
+	if err := Forget(s, "api", "production"); err != nil {
+		t.Fatalf("Forget(s, %q, %q) failed with %v", "api", "production", err)
+	}
+	if c, err := Observe(s, "api", "production", nil, now); c != nil || err != nil {
+		t.Errorf("Observe(...) after Forget = %v, %v; want the first observation", c, err)
+	}
+}
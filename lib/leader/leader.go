@@ -0,0 +1,169 @@
+// Package leader implements leader election among multiple goship instances on top of etcd.
+//
+// Only the leader runs background jobs. Deployments are still executed by the instance
+// which received the request.
+package leader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultKey is the etcd key which the current leader holds.
+	DefaultKey = "/goship/leader"
+)
+
+// Store is the subset of etcd APIs which Elector depends on.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Create(key, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+}
+
+// Elector campaigns for leadership of goship instances sharing a store.
+// The leadership is a TTL key in the store which the leader periodically renews.
+// Followers take over the leadership within the TTL when the leader dies.
+type Elector struct {
+	store Store
+	key   string
+	id    string
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	leader bool
+	jobs   []job
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context)
+}
+
+// New returns a new Elector which campaigns on behalf of the instance "id".
+func New(store Store, id string, ttl time.Duration) *Elector {
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return &Elector{
+		store: store,
+		key:   DefaultKey,
+		id:    id,
+		ttl:   ttl,
+	}
+}
+
+// ID returns the identifier of this instance.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader returns true iff this instance currently holds the leadership.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Register registers a background job which runs every "interval" only while this instance is the leader.
+// It must be called before Run.
+func (e *Elector) Register(name string, interval time.Duration, fn func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs = append(e.jobs, job{name: name, interval: interval, fn: fn})
+}
+
+// Run keeps campaigning for the leadership until "ctx" is canceled.
+// It starts the registered jobs when this instance becomes the leader, and stops them when it loses the leadership.
+func (e *Elector) Run(ctx context.Context) {
+	var cancel context.CancelFunc
+	defer func() {
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	t := time.NewTicker(e.ttl / 3)
+	defer t.Stop()
+	for {
+		leading := e.elect()
+		switch {
+		case leading && cancel == nil:
+			glog.Infof("%s became the leader", e.id)
+			var jctx context.Context
+			jctx, cancel = context.WithCancel(ctx)
+			e.startJobs(jctx)
+		case !leading && cancel != nil:
+			glog.Warningf("%s lost the leadership", e.id)
+			cancel()
+			cancel = nil
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// elect tries to acquire or renew the leadership once, and records the result.
+func (e *Elector) elect() bool {
+	leading, err := e.campaign()
+	if err != nil {
+		// Steps down because we cannot renew the key. Another instance will take over after the TTL.
+		glog.Errorf("Failed to campaign for leadership of %s: %v", e.id, err)
+		leading = false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leading
+	return leading
+}
+
+func (e *Elector) campaign() (bool, error) {
+	ttl := uint64(e.ttl / time.Second)
+	_, err := e.store.Create(e.key, e.id, ttl)
+	if err == nil {
+		return true, nil
+	}
+	if !etcderr.Is(err, etcderr.NodeExist) {
+		return false, err
+	}
+	_, err = e.store.CompareAndSwap(e.key, e.id, ttl, e.id, 0)
+	if err == nil {
+		return true, nil
+	}
+	if etcderr.Is(err, etcderr.TestFailed) || etcderr.IsKeyNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (e *Elector) startJobs(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, j := range e.jobs {
+		go j.run(ctx)
+	}
+}
+
+func (j job) run(ctx context.Context) {
+	glog.V(1).Infof("Starting background job %s", j.name)
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		j.fn(ctx)
+		select {
+		case <-ctx.Done():
+			glog.V(1).Infof("Stopped background job %s", j.name)
+			return
+		case <-t.C:
+		}
+	}
+}
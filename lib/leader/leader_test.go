@@ -0,0 +1,136 @@
+package leader
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// mockStore emulates a single TTL key in etcd with a controllable clock.
+type mockStore struct {
+	mu     sync.Mutex
+	now    time.Time
+	value  string
+	expire time.Time
+	broken bool
+}
+
+func (s *mockStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+func (s *mockStore) exists() bool {
+	return s.value != "" && s.now.Before(s.expire)
+}
+
+func (s *mockStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exists() {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: s.value}}, nil
+}
+
+func (s *mockStore) Create(key, value string, ttl uint64) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return nil, fmt.Errorf("etcd unreachable")
+	}
+	if s.exists() {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.NodeExist}
+	}
+	s.value, s.expire = value, s.now.Add(time.Duration(ttl)*time.Second)
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (s *mockStore) CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return nil, fmt.Errorf("etcd unreachable")
+	}
+	if !s.exists() {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	if s.value != prevValue {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.TestFailed}
+	}
+	s.value, s.expire = value, s.now.Add(time.Duration(ttl)*time.Second)
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func TestElectSingleLeader(t *testing.T) {
+	s := &mockStore{now: time.Unix(0, 0)}
+	a, b := New(s, "a", 30*time.Second), New(s, "b", 30*time.Second)
+
+	if !a.elect() {
+		t.Errorf("a.elect() = false; want true")
+	}
+	if b.elect() {
+		t.Errorf("b.elect() = true; want false")
+	}
+	if !a.IsLeader() || b.IsLeader() {
+		t.Errorf("a.IsLeader() = %v, b.IsLeader() = %v; want true, false", a.IsLeader(), b.IsLeader())
+	}
+}
+
+func TestElectRenewal(t *testing.T) {
+	s := &mockStore{now: time.Unix(0, 0)}
+	a, b := New(s, "a", 30*time.Second), New(s, "b", 30*time.Second)
+
+	a.elect()
+	for i := 0; i < 5; i++ {
+		s.advance(20 * time.Second)
+		if !a.elect() {
+			t.Errorf("a.elect() = false after %d renewals; want true", i)
+		}
+		if b.elect() {
+			t.Errorf("b.elect() = true while a is renewing; want false")
+		}
+	}
+}
+
+func TestElectFailover(t *testing.T) {
+	s := &mockStore{now: time.Unix(0, 0)}
+	a, b := New(s, "a", 30*time.Second), New(s, "b", 30*time.Second)
+
+	a.elect()
+	// "a" dies and stops renewing.
+	s.advance(29 * time.Second)
+	if b.elect() {
+		t.Errorf("b.elect() = true before TTL expires; want false")
+	}
+	s.advance(2 * time.Second)
+	if !b.elect() {
+		t.Errorf("b.elect() = false after TTL expired; want true")
+	}
+	// "a" comes back but must not steal the leadership.
+	if a.elect() {
+		t.Errorf("a.elect() = true after failover; want false")
+	}
+	if a.IsLeader() {
+		t.Errorf("a.IsLeader() = true after failover; want false")
+	}
+}
+
+func TestElectStepsDownOnStoreFailure(t *testing.T) {
+	s := &mockStore{now: time.Unix(0, 0)}
+	a := New(s, "a", 30*time.Second)
+
+	a.elect()
+	s.broken = true
+	if a.elect() {
+		t.Errorf("a.elect() = true while the store is unreachable; want false")
+	}
+	if a.IsLeader() {
+		t.Errorf("a.IsLeader() = true while the store is unreachable; want false")
+	}
+}
@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// projectsDir is the etcd directory of the configs of projects.
+const projectsDir = "/goship/projects"
+
+func init() {
+	Register(1, 2, lockStructs)
+}
+
+// legacyAutoLock is the part of auto_lock of environments which lockStructs reads.
+type legacyAutoLock struct {
+	By    string    `json:"by"`
+	Since time.Time `json:"since"`
+}
+
+// lockStructs replaces "is_locked" of environments with "lock", which records who locked them and since when.
+// Locks by goship take the owner and the time from "auto_lock". The others are attributed to nobody with a zero time,
+// since the old layout did not record them.
+func lockStructs(s Store) error {
+	resp, err := s.Get(projectsDir, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, proj := range resp.Node.Nodes {
+		for _, dir := range proj.Nodes {
+			if path.Base(dir.Key) != "environments" {
+				continue
+			}
+			for _, env := range dir.Nodes {
+				if env.Dir {
+					continue
+				}
+				value, changed, err := migrateLock(env.Value)
+				if err != nil {
+					return err
+				}
+				if !changed {
+					continue
+				}
+				if _, err := s.Set(env.Key, value, 0); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// migrateLock returns the JSON of an environment "value" with "is_locked" replaced, and whether it changed.
+func migrateLock(value string) (string, bool, error) {
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &env); err != nil {
+		return "", false, err
+	}
+	raw, ok := env["is_locked"]
+	if !ok {
+		return value, false, nil
+	}
+	delete(env, "is_locked")
+	var locked bool
+	if err := json.Unmarshal(raw, &locked); err != nil {
+		return "", false, err
+	}
+	if _, ok := env["lock"]; locked && !ok {
+		var l legacyAutoLock
+		if auto, ok := env["auto_lock"]; ok {
+			if err := json.Unmarshal(auto, &l); err != nil {
+				return "", false, err
+			}
+		}
+		buf, err := json.Marshal(l)
+		if err != nil {
+			return "", false, err
+		}
+		env["lock"] = buf
+	}
+	buf, err := json.Marshal(env)
+	if err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
@@ -0,0 +1,153 @@
+// Package migrations upgrades the layout of goship's data in etcd.
+//
+// The store records the version of its layout in VersionKey. Features which change the layout register a migration
+// from the previous version, and the leader applies the pending ones at startup. Instances refuse to start against
+// a store which is newer than they support, since they would misread it silently.
+package migrations
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// VersionKey is the etcd key of the schema version of the store.
+	VersionKey = "/goship/schema_version"
+	// Base is the version of stores without VersionKey, which predate migrations.
+	Base = 1
+)
+
+// Store is the subset of etcd APIs which migrations depend on.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Func migrates the contents of a store by one version.
+// It must be idempotent since a migration interrupted halfway is run again from the start.
+type Func func(s Store) error
+
+// Change is a write which a migration made, or would make in a dry run.
+type Change struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Deleted means the key was deleted rather than set to Value.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Result reports the migrations which Run applied.
+type Result struct {
+	// From and To are the schema versions before and after the migrations. They are equal if nothing was pending.
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Changes are in the order of the writes.
+	Changes []Change `json:"changes"`
+}
+
+// registry maps versions to the migrations from them.
+var registry = make(map[int]Func)
+
+// Register registers "fn" which migrates stores from the version "from" to "to".
+// It must be called from init functions. It panics unless "to" follows "from" and there is no other migration from "from".
+func Register(from, to int, fn Func) {
+	if from < Base || to != from+1 {
+		panic(fmt.Sprintf("migrations: invalid migration from %d to %d", from, to))
+	}
+	if _, ok := registry[from]; ok {
+		panic(fmt.Sprintf("migrations: duplicate migration from %d", from))
+	}
+	registry[from] = fn
+}
+
+// Current returns the schema version which this binary supports, i.e. the version after all registered migrations.
+func Current() int {
+	v := Base
+	for from := range registry {
+		if from+1 > v {
+			v = from + 1
+		}
+	}
+	return v
+}
+
+// StoredVersion returns the schema version of "s", which is Base if it has never been migrated.
+func StoredVersion(s Store) (int, error) {
+	resp, err := s.Get(VersionKey, false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return Base, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(resp.Node.Value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q in %s", resp.Node.Value, VersionKey)
+	}
+	return v, nil
+}
+
+// Check returns the schema version of "s", and fails if it is newer than Current.
+func Check(s Store) (int, error) {
+	v, err := StoredVersion(s)
+	if err != nil {
+		return 0, err
+	}
+	if v > Current() {
+		return v, fmt.Errorf("schema version %d of the store is newer than %d which this binary supports; upgrade goship", v, Current())
+	}
+	return v, nil
+}
+
+// Run applies the migrations from the schema version of "s" to Current in order, and records the new version after each of them.
+// If "dryRun", nothing is written and the result lists the changes which would be made. Each migration of a dry run
+// reads the store as it is, so changes of later migrations may depend on the earlier ones which were not applied.
+func Run(s Store, dryRun bool) (Result, error) {
+	from, err := Check(s)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{From: from, To: from}
+	rec := &recorder{Store: s, dryRun: dryRun}
+	for v := from; v < Current(); v++ {
+		fn, ok := registry[v]
+		if !ok {
+			return res, fmt.Errorf("no migration from schema version %d", v)
+		}
+		if err := fn(rec); err != nil {
+			return res, fmt.Errorf("migration from schema version %d failed: %v", v, err)
+		}
+		if _, err := rec.Set(VersionKey, strconv.Itoa(v+1), 0); err != nil {
+			return res, err
+		}
+		res.To = v + 1
+	}
+	res.Changes = rec.changes
+	return res, nil
+}
+
+// recorder records the writes into Store, and skips them in a dry run.
+type recorder struct {
+	Store
+	dryRun  bool
+	changes []Change
+}
+
+func (r *recorder) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	r.changes = append(r.changes, Change{Key: key, Value: value})
+	if r.dryRun {
+		return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+	}
+	return r.Store.Set(key, value, ttl)
+}
+
+func (r *recorder) Delete(key string, recursive bool) (*etcd.Response, error) {
+	r.changes = append(r.changes, Change{Key: key, Deleted: true})
+	if r.dryRun {
+		return &etcd.Response{Action: "delete", Node: &etcd.Node{Key: key}}, nil
+	}
+	return r.Store.Delete(key, recursive)
+}
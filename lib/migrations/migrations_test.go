@@ -0,0 +1,225 @@
+package migrations
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// memStore is an in-memory Store keyed by the paths of values.
+type memStore map[string]string
+
+func (s memStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	node := s.dir(key)
+	if node == nil {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound, Message: "Key not found", Cause: key}
+	}
+	return &etcd.Response{Node: node}, nil
+}
+
+// dir returns the directory node of "key" with all its descendants, or nil if there is nothing under "key".
+func (s memStore) dir(key string) *etcd.Node {
+	var keys []string
+	for k := range s {
+		if strings.HasPrefix(k, key+"/") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	node := &etcd.Node{Key: key, Dir: true}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		child := key + "/" + strings.SplitN(strings.TrimPrefix(k, key+"/"), "/", 2)[0]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if v, ok := s[child]; ok {
+			node.Nodes = append(node.Nodes, &etcd.Node{Key: child, Value: v})
+		} else {
+			node.Nodes = append(node.Nodes, s.dir(child))
+		}
+	}
+	return node
+}
+
+func (s memStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s[key] = value
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (s memStore) Delete(key string, recursive bool) (*etcd.Response, error) {
+	delete(s, key)
+	return &etcd.Response{Node: &etcd.Node{Key: key}}, nil
+}
+
+// fixture is a store in the layout before versioning.
+func fixture() memStore {
+	return memStore{
+		"/goship/config":                                 `{"deploy_user": "deployer"}`,
+		"/goship/projects/api/config":                    `{"repo_name": "api", "repo_owner": "gengo"}`,
+		"/goship/projects/api/environments/staging":      `{"branch": "master", "comment": "", "is_locked": false}`,
+		"/goship/projects/api/environments/production":   `{"branch": "master", "comment": "release day", "is_locked": true}`,
+		"/goship/projects/api/environments/dr":           `{"branch": "master", "comment": ""}`,
+		"/goship/projects/web/config":                    `{"repo_name": "web", "repo_owner": "gengo"}`,
+		"/goship/projects/web/environments/production":   `{"branch": "master", "is_locked": true, "auto_lock": {"reason": "auto-locked: deploy web-production-1 failed", "by": "goship", "since": "2016-05-01T09:00:00Z", "deploy_id": "web-production-1"}}`,
+		"/goship/projects/web/environments/old-unlocked": `{"branch": "master", "is_locked": false, "auto_lock": null}`,
+	}
+}
+
+func envOf(t *testing.T, s memStore, key string) map[string]interface{} {
+	var env map[string]interface{}
+	if err := json.Unmarshal([]byte(s[key]), &env); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v", s[key], err)
+	}
+	return env
+}
+
+func TestRunLockStructs(t *testing.T) {
+	s := fixture()
+	res, err := Run(s, false)
+	if err != nil {
+		t.Fatalf("Run(s, false) failed with %v", err)
+	}
+	if res.From != Base || res.To != Current() || Current() < 2 {
+		t.Errorf("Run(s, false) = %#v; want from %d to %d", res, Base, Current())
+	}
+	if v, err := StoredVersion(s); err != nil || v != Current() {
+		t.Errorf("StoredVersion(s) = %d, %v; want %d", v, err, Current())
+	}
+
+	for _, spec := range []struct {
+		key  string
+		lock interface{}
+	}{
+		{key: "/goship/projects/api/environments/staging"},
+		{key: "/goship/projects/api/environments/production", lock: map[string]interface{}{"by": "", "since": "0001-01-01T00:00:00Z"}},
+		{key: "/goship/projects/api/environments/dr"},
+		{key: "/goship/projects/web/environments/production", lock: map[string]interface{}{"by": "goship", "since": "2016-05-01T09:00:00Z"}},
+		{key: "/goship/projects/web/environments/old-unlocked"},
+	} {
+		env := envOf(t, s, spec.key)
+		if _, ok := env["is_locked"]; ok {
+			t.Errorf("%s = %s; want is_locked removed", spec.key, s[spec.key])
+		}
+		if !reflect.DeepEqual(env["lock"], spec.lock) {
+			t.Errorf("lock of %s = %#v; want %#v", spec.key, env["lock"], spec.lock)
+		}
+		if env["branch"] != "master" {
+			t.Errorf("%s = %s; want the other fields kept", spec.key, s[spec.key])
+		}
+	}
+	if got := envOf(t, s, "/goship/projects/api/environments/production")["comment"]; got != "release day" {
+		t.Errorf("comment of api/production = %q; want %q", got, "release day")
+	}
+	if got := s["/goship/projects/api/environments/dr"]; got != `{"branch": "master", "comment": ""}` {
+		t.Errorf("api/dr = %s; want untouched", got)
+	}
+
+	// runs again as a no-op.
+	before := make(memStore)
+	for k, v := range s {
+		before[k] = v
+	}
+	if res, err := Run(s, false); err != nil || res.From != res.To || len(res.Changes) != 0 {
+		t.Errorf("Run(s, false) = %#v, %v after migrating; want nothing to do", res, err)
+	}
+	if !reflect.DeepEqual(s, before) {
+		t.Errorf("store = %v after running again; want %v", s, before)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	s := fixture()
+	res, err := Run(s, true)
+	if err != nil {
+		t.Fatalf("Run(s, true) failed with %v", err)
+	}
+	if !reflect.DeepEqual(s, fixture()) {
+		t.Errorf("store = %v after a dry run; want untouched", s)
+	}
+	var keys []string
+	for _, c := range res.Changes {
+		keys = append(keys, c.Key)
+	}
+	want := []string{
+		"/goship/projects/api/environments/production",
+		"/goship/projects/api/environments/staging",
+		"/goship/projects/web/environments/old-unlocked",
+		"/goship/projects/web/environments/production",
+		VersionKey,
+	}
+	sort.Strings(keys)
+	sort.Strings(want)
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("changes of Run(s, true) = %q; want %q", keys, want)
+	}
+}
+
+func TestRunRefusesNewerStore(t *testing.T) {
+	s := fixture()
+	s[VersionKey] = "999"
+	if _, err := Check(s); err == nil {
+		t.Errorf("Check(s) succeeded for version 999; want an error")
+	}
+	if _, err := Run(s, false); err == nil {
+		t.Errorf("Run(s, false) succeeded for version 999; want an error")
+	}
+	if got := s["/goship/projects/api/environments/production"]; got != fixture()["/goship/projects/api/environments/production"] {
+		t.Errorf("api/production = %s; want untouched", got)
+	}
+
+	s[VersionKey] = "two"
+	if _, err := Check(s); err == nil {
+		t.Errorf("Check(s) succeeded for version %q; want an error", "two")
+	}
+}
+
+func TestRunChain(t *testing.T) {
+	saved := registry
+	defer func() { registry = saved }()
+	registry = make(map[int]Func)
+
+	var ran []int
+	step := func(from int, err error) Func {
+		return func(s Store) error {
+			ran = append(ran, from)
+			if err != nil {
+				return err
+			}
+			_, err := s.Set("/goship/test", string('a'+rune(from)), 0)
+			return err
+		}
+	}
+	Register(1, 2, step(1, nil))
+	Register(2, 3, step(2, nil))
+	Register(3, 4, step(3, errors.New("broken")))
+
+	s := memStore{VersionKey: "2"}
+	res, err := Run(s, false)
+	if err == nil {
+		t.Fatalf("Run(s, false) succeeded; want the failure of the migration from 3")
+	}
+	if !reflect.DeepEqual(ran, []int{2, 3}) || res.To != 3 || s[VersionKey] != "3" || s["/goship/test"] != "c" {
+		t.Errorf("ran %v up to %d with %v; want migrations from 2 and 3, stopping at 3", ran, res.To, s)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register(1, 2, ...) did not panic for a duplicate migration")
+		}
+	}()
+	Register(1, 2, step(1, nil))
+}
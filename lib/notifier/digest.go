@@ -0,0 +1,212 @@
+package notifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+)
+
+// Digest is a Notifier which rolls results of deployments up into a DeployDigest event to another Notifier.
+// The rollup is sent "interval" after the first buffered result, or as soon as "max" results are buffered.
+// Failures are sent immediately in addition to being rolled up. Started deployments are not sent since their results are,
+// and the other events are sent immediately.
+type Digest struct {
+	n        Notifier
+	interval time.Duration
+	max      int
+	after    func(d time.Duration) <-chan time.Time
+
+	mu     sync.Mutex
+	events []Event
+	// stop stops the timer of the buffered events.
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDigest returns a new Digest which sends rollups to "n". "max" is ignored if zero.
+func NewDigest(n Notifier, interval time.Duration, max int) *Digest {
+	return &Digest{
+		n:        n,
+		interval: interval,
+		max:      max,
+		after:    time.After,
+	}
+}
+
+// Notify buffers "e" if it is a result of a deployment, or sends it otherwise.
+func (d *Digest) Notify(e Event) error {
+	switch e.Type {
+	case DeployStarted:
+		return nil
+	case DeploySucceeded, DeployFailed:
+	default:
+		return d.n.Notify(e)
+	}
+
+	var err error
+	if e.Type == DeployFailed {
+		err = d.n.Notify(e)
+	}
+	d.mu.Lock()
+	d.events = append(d.events, e)
+	var batch []Event
+	if d.max > 0 && len(d.events) >= d.max {
+		batch = d.take()
+	} else if len(d.events) == 1 {
+		d.startTimer()
+	}
+	d.mu.Unlock()
+
+	if batch != nil {
+		if serr := d.send(batch); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// Flush sends the rollup of the buffered events if any.
+func (d *Digest) Flush() error {
+	d.mu.Lock()
+	batch := d.take()
+	d.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return d.send(batch)
+}
+
+// startTimer sends the rollup of the buffered events after the interval unless they are taken before.
+// It must be called with d.mu held.
+func (d *Digest) startTimer() {
+	stop := make(chan struct{})
+	d.stop = stop
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		select {
+		case <-stop:
+			return
+		case <-d.after(d.interval):
+		}
+		d.mu.Lock()
+		if d.stop != stop {
+			d.mu.Unlock()
+			return
+		}
+		batch := d.take()
+		d.mu.Unlock()
+		if err := d.send(batch); err != nil {
+			glog.Errorf("Failed to send a digest of %d deployments: %v", len(batch), err)
+		}
+	}()
+}
+
+// take removes the buffered events and stops their timer. It must be called with d.mu held.
+func (d *Digest) take() []Event {
+	batch := d.events
+	d.events = nil
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	return batch
+}
+
+func (d *Digest) send(batch []Event) error {
+	return d.n.Notify(Event{Type: DeployDigest, Digest: batch})
+}
+
+// digests are the Digests of notification targets, which buffer events across deployments.
+var digests = struct {
+	sync.Mutex
+	m map[string]*Digest
+}{m: make(map[string]*Digest)}
+
+// digestOf returns "n" rolled up as configured in "c", or "n" itself if "c" is nil.
+// The same Digest is returned for the same "target" as long as its configuration is not changed.
+func digestOf(target string, n Notifier, c *config.DigestConfiguration) Notifier {
+	if c == nil {
+		return n
+	}
+	key := fmt.Sprintf("%s %s %d", target, c.Interval(), c.MaxEvents)
+	digests.Lock()
+	defer digests.Unlock()
+	d, ok := digests.m[key]
+	if !ok {
+		d = NewDigest(n, c.Interval(), c.MaxEvents)
+		digests.m[key] = d
+	}
+	return d
+}
+
+// FlushDigests sends the rollups of all the buffered events. It should be called on shutdown.
+// It returns the first error but tries all of the digests.
+func FlushDigests() error {
+	digests.Lock()
+	defer digests.Unlock()
+	var first error
+	for _, d := range digests.m {
+		if err := d.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// digestMessage summarizes "events" per environment, e.g. "5 deploys to *staging*: api x2, web x3, all green."
+func digestMessage(events []Event) string {
+	type envDigest struct {
+		count    int
+		failed   int
+		projects map[string]int
+	}
+	envs := make(map[string]*envDigest)
+	var names []string
+	for _, e := range events {
+		ed, ok := envs[e.Environment]
+		if !ok {
+			ed = &envDigest{projects: make(map[string]int)}
+			envs[e.Environment] = ed
+			names = append(names, e.Environment)
+		}
+		ed.count++
+		ed.projects[e.Project]++
+		if e.Type == DeployFailed {
+			ed.failed++
+		}
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		ed := envs[name]
+		var projs []string
+		for p := range ed.projects {
+			projs = append(projs, p)
+		}
+		sort.Strings(projs)
+		var parts []string
+		for _, p := range projs {
+			if n := ed.projects[p]; n > 1 {
+				p = fmt.Sprintf("%s x%d", p, n)
+			}
+			parts = append(parts, p)
+		}
+		status := "all green"
+		if ed.failed > 0 {
+			status = fmt.Sprintf("%d failed", ed.failed)
+		}
+		noun := "deploys"
+		if ed.count == 1 {
+			noun = "deploy"
+		}
+		lines = append(lines, fmt.Sprintf("%d %s to *%s*: %s, %s.", ed.count, noun, name, strings.Join(parts, ", "), status))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func newTestDigest(n Notifier, interval time.Duration, max int, clock *fakeClock) *Digest {
+	d := NewDigest(n, interval, max)
+	d.after = clock.after
+	return d
+}
+
+func deployed(typ EventType, proj, env string) Event {
+	return Event{Type: typ, Project: proj, Environment: env}
+}
+
+func TestDigestInterval(t *testing.T) {
+	clock := newFakeClock(time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC))
+	rec := new(recorder)
+	d := newTestDigest(rec, 5*time.Minute, 0, clock)
+
+	for _, p := range []string{"api", "web", "api", "web", "web"} {
+		d.Notify(deployed(DeployStarted, p, "staging"))
+		if err := d.Notify(deployed(DeploySucceeded, p, "staging")); err != nil {
+			t.Errorf("d.Notify(%s) failed with %v", p, err)
+		}
+	}
+	if got := rec.types(); len(got) != 0 {
+		t.Errorf("events = %q before the interval; want none", got)
+	}
+	w := <-clock.waiters
+	if w.d != 5*time.Minute {
+		t.Errorf("waiting for %s; want %s", w.d, 5*time.Minute)
+	}
+	clock.fire(w)
+	d.wg.Wait()
+
+	if got, want := rec.types(), []EventType{DeployDigest}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q; want %q", got, want)
+	}
+	if got, want := Message(rec.events[0]), "5 deploys to *staging*: api x2, web x3, all green."; got != want {
+		t.Errorf("Message(digest) = %q; want %q", got, want)
+	}
+
+	// the next result starts a new interval.
+	d.Notify(deployed(DeploySucceeded, "api", "production"))
+	clock.fire(<-clock.waiters)
+	d.wg.Wait()
+	if got, want := Message(rec.events[1]), "1 deploy to *production*: api, all green."; got != want {
+		t.Errorf("Message(digest) = %q; want %q", got, want)
+	}
+}
+
+func TestDigestMaxEvents(t *testing.T) {
+	clock := newFakeClock(time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC))
+	rec := new(recorder)
+	d := newTestDigest(rec, 5*time.Minute, 3, clock)
+
+	d.Notify(deployed(DeploySucceeded, "api", "staging"))
+	// the timer of the first result
+	<-clock.waiters
+	d.Notify(deployed(DeploySucceeded, "api", "staging"))
+	if got := rec.types(); len(got) != 0 {
+		t.Errorf("events = %q with 2 results; want none", got)
+	}
+	d.Notify(deployed(DeploySucceeded, "web", "qa"))
+	d.wg.Wait()
+	if got, want := rec.types(), []EventType{DeployDigest}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q; want %q", got, want)
+	}
+	if got, want := Message(rec.events[0]), "1 deploy to *qa*: web, all green.\n2 deploys to *staging*: api x2, all green."; got != want {
+		t.Errorf("Message(digest) = %q; want %q", got, want)
+	}
+
+	d.Notify(deployed(DeploySucceeded, "web", "qa"))
+	<-clock.waiters
+	if err := d.Flush(); err != nil {
+		t.Errorf("d.Flush() failed with %v", err)
+	}
+	d.wg.Wait()
+	if got, want := rec.types(), []EventType{DeployDigest, DeployDigest}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q after flush; want %q", got, want)
+	}
+	if err := d.Flush(); err != nil || len(rec.events) != 2 {
+		t.Errorf("d.Flush() = %v with %d events; want no more events", err, len(rec.events))
+	}
+}
+
+func TestDigestSendsFailuresImmediately(t *testing.T) {
+	clock := newFakeClock(time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC))
+	rec := new(recorder)
+	d := newTestDigest(rec, 5*time.Minute, 0, clock)
+
+	d.Notify(deployed(DeploySucceeded, "api", "staging"))
+	w := <-clock.waiters
+	d.Notify(deployed(DeployFailed, "web", "staging"))
+	d.Notify(Event{Type: ApprovalRequested, Project: "api", Environment: "production"})
+	if got, want := rec.types(), []EventType{DeployFailed, ApprovalRequested}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q within the interval; want %q", got, want)
+	}
+	clock.fire(w)
+	d.wg.Wait()
+	if got, want := rec.types(), []EventType{DeployFailed, ApprovalRequested, DeployDigest}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q; want %q", got, want)
+	}
+	if got, want := Message(rec.events[2]), "2 deploys to *staging*: api, web, 1 failed."; got != want {
+		t.Errorf("Message(digest) = %q; want %q", got, want)
+	}
+}
+
+func TestDigestOf(t *testing.T) {
+	rec := new(recorder)
+	if got := digestOf("test", rec, nil); got != Notifier(rec) {
+		t.Errorf("digestOf(%q, rec, nil) = %#v; want rec", "test", got)
+	}
+	c := &config.DigestConfiguration{MaxEvents: 3}
+	first := digestOf("test", rec, c)
+	if got := digestOf("test", new(recorder), c); got != first {
+		t.Errorf("digestOf(%q, n, c) returned another digest for the same target", "test")
+	}
+	if got := digestOf("test", rec, &config.DigestConfiguration{MaxEvents: 5}); got == first {
+		t.Errorf("digestOf(%q, n, c) returned the same digest for another configuration", "test")
+	}
+}
@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+// Recipient is a user who receives notifications directly rather than in a room.
+type Recipient struct {
+	// User is the goship user. Slack direct messages are sent to the Slack user mapped to it in "users" of the slack config.
+	User string
+	// Email is sent the notifications instead if set.
+	Email string
+}
+
+// Direct sends notifications to individual users by email or Slack direct messages.
+type Direct struct {
+	slackToken   string
+	slackBaseURL string
+	// slackUsers maps goship users to their Slack user IDs.
+	slackUsers map[string]string
+	email      *config.EmailConfiguration
+	sendMail   func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewDirect returns a Direct which sends notifications with the bot token and the SMTP server in "c".
+func NewDirect(c config.Config) Direct {
+	d := Direct{slackBaseURL: slackBaseURL, slackUsers: make(map[string]string), email: c.Email, sendMail: smtp.SendMail}
+	if c.Slack != nil {
+		d.slackToken = c.Slack.Token
+		for id, user := range c.Slack.Users {
+			d.slackUsers[user] = id
+		}
+	}
+	return d
+}
+
+// Send sends "e" to "to" by email if the recipient has an address, or by a Slack direct message otherwise.
+func (d Direct) Send(to Recipient, e Event) error {
+	msg := Message(e)
+	if to.Email != "" {
+		if d.email == nil {
+			return fmt.Errorf("no SMTP server is configured to mail %s", to.User)
+		}
+		return d.mail(to.Email, fmt.Sprintf("[goship] %s deployed to %s", e.Project, e.Environment), msg)
+	}
+	id, ok := d.slackUsers[to.User]
+	if !ok {
+		return fmt.Errorf("%s is not mapped to any Slack user", to.User)
+	}
+	if d.slackToken == "" {
+		return fmt.Errorf("no Slack bot token is configured to message %s", to.User)
+	}
+	s := &Slack{token: d.slackToken, channel: id, baseURL: d.slackBaseURL}
+	_, err := s.call("chat.postMessage", url.Values{"channel": {id}, "text": {msg}})
+	return err
+}
+
+// mail sends a plain text mail to "addr".
+func (d Direct) mail(addr, subject, body string) error {
+	var auth smtp.Auth
+	if d.email.Username != "" {
+		host, _, err := net.SplitHostPort(d.email.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", d.email.Username, d.email.Password, host)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", d.email.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", addr)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	buf.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return d.sendMail(d.email.SMTPAddr, auth, d.email.From, []string{addr}, buf.Bytes())
+}
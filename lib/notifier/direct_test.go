@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestDirectSlack(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.Path+" "+r.FormValue("token")+" "+r.FormValue("channel")+" "+r.FormValue("text"))
+		w.Write([]byte(`{"ok": true, "channel": "D1", "ts": "ts-1"}`))
+	}))
+	defer srv.Close()
+
+	d := NewDirect(config.Config{Slack: &config.SlackConfiguration{Token: "bot-token", Users: map[string]string{"U024BE7LH": "alice"}}})
+	d.slackBaseURL = srv.URL + "/"
+	e := Event{Type: CommitsShipped, Project: "api", Environment: "production", User: "bob", Commits: []string{"1a2b3c4 Fix login"}}
+	if err := d.Send(Recipient{User: "alice"}, e); err != nil {
+		t.Fatalf("d.Send(alice, e) failed with %v", err)
+	}
+	want := "/chat.postMessage bot-token U024BE7LH api has been deployed to *production* by bob. Your commits shipped: 1a2b3c4 Fix login."
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("calls = %q; want %q", got, want)
+	}
+
+	if err := d.Send(Recipient{User: "carol"}, e); err == nil {
+		t.Errorf("d.Send(carol, e) succeeded without a Slack user; want failure")
+	}
+}
+
+func TestDirectEmail(t *testing.T) {
+	d := NewDirect(config.Config{Email: &config.EmailConfiguration{SMTPAddr: "smtp.example.com:587", From: "goship@example.com", Username: "goship", Password: "secret"}})
+	var (
+		to   []string
+		body string
+	)
+	d.sendMail = func(addr string, a smtp.Auth, from string, rcpt []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || from != "goship@example.com" || a == nil {
+			t.Errorf("sendMail(%q, %v, %q, ...); want the configured server with auth", addr, a, from)
+		}
+		to, body = rcpt, string(msg)
+		return nil
+	}
+	e := Event{Type: CommitsShipped, Project: "api", Environment: "production", User: "bob"}
+	if err := d.Send(Recipient{User: "alice", Email: "alice@example.com"}, e); err != nil {
+		t.Fatalf("d.Send(alice, e) failed with %v", err)
+	}
+	if len(to) != 1 || to[0] != "alice@example.com" {
+		t.Errorf("recipients = %q; want alice@example.com", to)
+	}
+	for _, want := range []string{"To: alice@example.com\r\n", "Subject: [goship] api deployed to production\r\n", "\r\n\r\napi has been deployed to *production* by bob.\r\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("mail = %q; want %q in it", body, want)
+		}
+	}
+
+	if err := NewDirect(config.Config{}).Send(Recipient{User: "alice", Email: "alice@example.com"}, e); err == nil {
+		t.Errorf("Send succeeded without an SMTP server; want failure")
+	}
+}
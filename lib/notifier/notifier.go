@@ -0,0 +1,295 @@
+// Package notifier notifies deployment events to chat rooms or other external systems.
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/artifact"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// EventType is a type of deployment events
+type EventType string
+
+const (
+	// DeployStarted means a deployment has started.
+	DeployStarted = EventType("deploy_started")
+	// DeploySucceeded means a deployment has successfully finished.
+	DeploySucceeded = EventType("deploy_succeeded")
+	// DeployFailed means a deployment has finished with an error.
+	DeployFailed = EventType("deploy_failed")
+	// PivotalPosted means comments about a finished deployment have been posted to Pivotal.
+	PivotalPosted = EventType("pivotal_posted")
+	// ApprovalRequested means a deployment is waiting for approval.
+	ApprovalRequested = EventType("approval_requested")
+	// ApprovalReminder means a deployment is still waiting for approval.
+	ApprovalReminder = EventType("approval_reminder")
+	// Approved means a deployment has been approved.
+	Approved = EventType("approved")
+	// Rejected means a deployment has been rejected.
+	Rejected = EventType("rejected")
+	// DeployDigest is a rollup of finished deployments.
+	DeployDigest = EventType("deploy_digest")
+	// HostsChanged means hosts have been added to or removed from an environment.
+	HostsChanged = EventType("hosts_changed")
+	// AutoLocked means an environment has been locked automatically since a deployment into it failed.
+	AutoLocked = EventType("auto_locked")
+	// CommitsShipped means a deployment has shipped the commits of a user who subscribed to it. It is sent only by Direct.
+	CommitsShipped = EventType("commits_shipped")
+)
+
+// Event is a deployment event to be notified.
+type Event struct {
+	Type EventType
+	// ID identifies the deployment. Events of the same deployment share the ID.
+	ID          string
+	Project     string
+	Environment string
+	User        string
+	// From and To are the revision range of the deployment.
+	From, To string
+	// ExpectedDuration is an estimated duration of the deployment. It is zero if unknown.
+	ExpectedDuration time.Duration
+	// Duration is the actual duration of the deployment. It is zero until the deployment finishes.
+	Duration time.Duration
+	// Pivotal is the result of posting to Pivotal. It is set only for PivotalPosted.
+	Pivotal pivotal.Summary
+	// Approver is the user who approved or rejected the deployment.
+	Approver string
+	// Mentions are chat handles of the users who should take a look at the event.
+	Mentions []string
+	// Flags are the deploy flags given to the deployment.
+	Flags map[string]string
+	// Note is the reason of the deployment given by the user.
+	Note string
+	// Digest are the events of the finished deployments rolled up. It is set only for DeployDigest.
+	Digest []Event
+	// AddedHosts and RemovedHosts are the changes of the hosts. They are set only for HostsChanged.
+	AddedHosts, RemovedHosts []string
+	// Artifacts are the products declared by the deploy command. They are set only for DeploySucceeded and DeployFailed.
+	Artifacts []artifact.Artifact
+	// Reason is why the environment has been locked. It is set only for AutoLocked.
+	Reason string
+	// Commits are one-line summaries of the commits of the recipient, e.g. "1a2b3c4 Fix login". They are set only for CommitsShipped.
+	Commits []string
+	// RequestID identifies the HTTP request which caused the event, if any. Failures to notify are logged with it.
+	RequestID string
+	// Test means an operator is trying a target out with the event. Its message is prefixed with "[TEST]", and approval
+	// requests have no buttons. See SendTest.
+	Test bool
+}
+
+// Notifier sends deployment events to somewhere.
+type Notifier interface {
+	Notify(e Event) error
+}
+
+// New returns a Notifier which sends events to all the targets configured in "c".
+// Targets with digests share their buffers across calls.
+func New(c config.Config) Notifier {
+	return ForEnvironment(c, "", "")
+}
+
+// ForEnvironment is like New, but sends events to the targets with the notification overrides of the environment "env" of "proj".
+// See config.ResolveNotificationTargets.
+func ForEnvironment(c config.Config, proj, env string) Notifier {
+	var m multi
+	for _, t := range config.ResolveNotificationTargets(c, proj, env) {
+		n, key, ok := targetNotifier(t, nil)
+		if !ok {
+			continue
+		}
+		m = append(m, digestOf(key, n, t.Digest))
+	}
+	return m
+}
+
+// targetNotifier returns the Notifier of "t" without its digest, and the key which identifies its settings.
+// Slack requests are sent with "hc", or http.DefaultClient if nil. It returns false if "t" is of an unknown target.
+func targetNotifier(t config.NotificationTarget, hc *http.Client) (Notifier, string, bool) {
+	var (
+		n   Notifier
+		key string
+	)
+	switch t.Name {
+	case config.NotifyTargetCommand:
+		n, key = Command(t.Command), "command "+t.Command
+	case config.NotifyTargetSlack:
+		if t.WebhookURL != "" {
+			w := NewSlackWebhook(t.WebhookURL, t.Channel)
+			w.client = hc
+			n, key = w, "slack "+t.Channel+" "+t.WebhookURL
+		} else {
+			s := NewSlack(t.Token, t.Channel)
+			s.client = hc
+			n, key = s, "slack "+t.Channel+" "+t.Token
+		}
+	default:
+		return nil, "", false
+	}
+	if len(t.Recipients) > 0 {
+		n, key = mentioning{n: n, handles: t.Recipients}, key+" "+strings.Join(t.Recipients, ",")
+	}
+	return n, key, true
+}
+
+// mentioning is a Notifier which makes all the events to "n" mention "handles".
+type mentioning struct {
+	n       Notifier
+	handles []string
+}
+
+func (m mentioning) Notify(e Event) error {
+	return m.n.Notify(withMentions(e, m.handles))
+}
+
+// withMentions returns "e" which mentions "handles" before e.Mentions.
+func withMentions(e Event, handles []string) Event {
+	e.Mentions = append(append([]string(nil), handles...), e.Mentions...)
+	return e
+}
+
+type multi []Notifier
+
+// Notify sends "e" to all the notifiers. It returns the first error but tries all of them.
+func (m multi) Notify(e Event) error {
+	var first error
+	for _, n := range m {
+		if err := n.Notify(e); err != nil {
+			reqlog.Errorf(reqlog.NewContext(context.Background(), e.RequestID), "Failed to notify %s event of %s (%s): %v", e.Type, e.Project, e.Environment, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Command is a Notifier which runs an external command with a message as the argument.
+type Command string
+
+// Notify runs the command with the message of "e".
+func (c Command) Notify(e Event) error {
+	return exec.Command(string(c), Message(e)).Run()
+}
+
+// Message returns a human-readable message which describes "e", which mentions e.Mentions.
+// Messages of tests are prefixed with "[TEST]".
+func Message(e Event) string {
+	msg := mention(e.Mentions, message(e))
+	if e.Test {
+		msg = testPrefix + msg
+	}
+	return msg
+}
+
+func message(e Event) string {
+	switch e.Type {
+	case DeployStarted:
+		msg := fmt.Sprintf("%s is deploying %s to *%s*.", e.User, e.Project, e.Environment)
+		if e.From != "" || e.To != "" {
+			msg = fmt.Sprintf("%s is deploying %s (%s...%s) to *%s*.", e.User, e.Project, short(e.From), short(e.To), e.Environment)
+		}
+		if len(e.Flags) > 0 {
+			msg += fmt.Sprintf(" Flags: %s.", flags(e.Flags))
+		}
+		if e.ExpectedDuration > 0 {
+			msg += fmt.Sprintf(" Expected to take about %s.", e.ExpectedDuration)
+		}
+		return withNote(msg, e.Note)
+	case DeploySucceeded:
+		return withNote(fmt.Sprintf("%s successfully deployed to *%s*%s.", e.Project, e.Environment, by(e.User))+artifacts(e.Artifacts), e.Note)
+	case DeployFailed:
+		return withNote(fmt.Sprintf("%s deployment to *%s*%s failed.", e.Project, e.Environment, by(e.User))+artifacts(e.Artifacts), e.Note)
+	case PivotalPosted:
+		return fmt.Sprintf("Pivotal stories of %s deployment to *%s*: %s.", e.Project, e.Environment, e.Pivotal)
+	case ApprovalRequested:
+		return fmt.Sprintf("%s requests approval to deploy %s to *%s*.", e.User, e.Project, e.Environment)
+	case ApprovalReminder:
+		return fmt.Sprintf("Deployment of %s to *%s* requested by %s is still waiting for approval.", e.Project, e.Environment, e.User)
+	case Approved:
+		return fmt.Sprintf("%s approved deployment of %s to *%s*.", e.Approver, e.Project, e.Environment)
+	case Rejected:
+		return fmt.Sprintf("%s rejected deployment of %s to *%s*.", e.Approver, e.Project, e.Environment)
+	case DeployDigest:
+		return digestMessage(e.Digest)
+	case HostsChanged:
+		var changes []string
+		if len(e.AddedHosts) > 0 {
+			changes = append(changes, "gained "+strings.Join(e.AddedHosts, ", "))
+		}
+		if len(e.RemovedHosts) > 0 {
+			changes = append(changes, "lost "+strings.Join(e.RemovedHosts, ", "))
+		}
+		return fmt.Sprintf("%s *%s* %s.", e.Project, e.Environment, strings.Join(changes, ", "))
+	case AutoLocked:
+		return fmt.Sprintf("%s *%s* has been locked by %s (%s). Unlock it after looking into the failure.", e.Project, e.Environment, e.User, e.Reason)
+	case CommitsShipped:
+		msg := fmt.Sprintf("%s has been deployed to *%s*%s.", e.Project, e.Environment, by(e.User))
+		if len(e.Commits) > 0 {
+			msg += fmt.Sprintf(" Your commits shipped: %s.", strings.Join(e.Commits, "; "))
+		}
+		return withNote(msg, e.Note)
+	}
+	return fmt.Sprintf("%s: %s to *%s*", e.Type, e.Project, e.Environment)
+}
+
+// by returns " by <user>" to be inserted into messages, or "" if "user" is empty.
+func by(user string) string {
+	if user == "" {
+		return ""
+	}
+	return " by " + user
+}
+
+// artifacts returns links to "arts" to be appended to messages, or "" if none.
+func artifacts(arts []artifact.Artifact) string {
+	if len(arts) == 0 {
+		return ""
+	}
+	links := make([]string, 0, len(arts))
+	for _, a := range arts {
+		links = append(links, fmt.Sprintf("<%s|%s>", a.URL, a.Name))
+	}
+	return " Artifacts: " + strings.Join(links, ", ") + "."
+}
+
+// withNote appends the deploy note to "msg" if any.
+func withNote(msg, note string) string {
+	if note == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s Note: %s", msg, note)
+}
+
+// mention prefixes "msg" with the chat handles.
+func mention(handles []string, msg string) string {
+	var prefix string
+	for _, h := range handles {
+		prefix += "@" + strings.TrimPrefix(h, "@") + " "
+	}
+	return prefix + msg
+}
+
+// flags formats deploy flags as comma-separated "key=value" pairs.
+func flags(f map[string]string) string {
+	var pairs []string
+	for _, k := range config.FlagKeys(f) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, f[k]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func short(rev string) string {
+	if len(rev) <= 7 {
+		return rev
+	}
+	return rev[:7]
+}
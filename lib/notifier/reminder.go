@@ -0,0 +1,259 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// approvalsKey is the etcd directory which contains approval requests in "requests/<id>", their resolutions in "resolutions/<id>"
+	// and when their approvers were notified last in "reminded/<id>".
+	// They are stored apart so that instances which remind and resolve a request at once do not overwrite each other.
+	approvalsKey = "/goship/approvals"
+	// approvalRetention is how long approval requests are kept after they expire,
+	// so that late answers to them tell what happened to them.
+	approvalRetention = 24 * time.Hour
+)
+
+var (
+	// ErrApprovalUnknown means that there is no such approval request, or it has been forgotten.
+	ErrApprovalUnknown = errors.New("no such approval request")
+	// ErrApprovalResolved means that the approval request has already been approved or rejected.
+	ErrApprovalResolved = errors.New("approval request already resolved")
+	// ErrApprovalExpired means that the approval request has expired without being resolved.
+	ErrApprovalExpired = errors.New("approval request expired")
+	// ErrSelfApproval means that the requester tried to approve their own request.
+	ErrSelfApproval = errors.New("requesters cannot approve their own deployments")
+)
+
+// Store is the subset of etcd.Client which stores approval requests.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// Approval is an approval request of a deployment.
+type Approval struct {
+	// Event is the ApprovalRequested event of the deployment. Its User is the requester.
+	Event   Event     `json:"event"`
+	Expires time.Time `json:"expires"`
+	// Payload is what the requester needs once the request is approved, e.g. parameters of the deployment.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Resolution is Approved or Rejected once resolved by Approver, or empty while pending.
+	Resolution EventType `json:"-"`
+	Approver   string    `json:"-"`
+	// Reminded is when the approvers were notified of the request last.
+	Reminded time.Time `json:"-"`
+}
+
+// resolution is the stored part of Approval which Resolve fills.
+type resolution struct {
+	Resolution EventType `json:"resolution"`
+	Approver   string    `json:"approver"`
+}
+
+// Resolved returns the event which tells the resolution of "a".
+func (a Approval) Resolved() Event {
+	e := a.Event
+	e.Type, e.Approver, e.Mentions = a.Resolution, a.Approver, nil
+	return e
+}
+
+// Reminders keeps approval requests of deployments in etcd, notifies them and reminds the approvers while the requests are pending.
+// Any instance can request and resolve approvals, while Remind runs only on the leader.
+type Reminders struct {
+	s        Store
+	interval time.Duration
+	load     func() (config.Config, error)
+	// notify returns the notifier of "env" of "proj".
+	notify func(c config.Config, proj, env string) Notifier
+	now    func() time.Time
+}
+
+// NewReminders returns a new Reminders which stores requests into "s", and reminds approvers every "interval" through the notifiers
+// returned by "notify" for the config returned by "load", e.g. ForEnvironment.
+func NewReminders(s Store, interval time.Duration, load func() (config.Config, error), notify func(c config.Config, proj, env string) Notifier) *Reminders {
+	return &Reminders{s: s, interval: interval, load: load, notify: notify, now: time.Now}
+}
+
+func approvalKey(kind, id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.Contains(id, "/") {
+		return "", fmt.Errorf("invalid approval request ID %q", id)
+	}
+	return path.Join(approvalsKey, kind, id), nil
+}
+
+// approversOf returns the chat handles of the approvers of "proj".
+func approversOf(c config.Config, proj string) []string {
+	p, err := config.FindProject(c.Projects, proj)
+	if err != nil {
+		return nil
+	}
+	return c.ChatHandlesOf(p.Approvers)
+}
+
+// set stores the JSON of "v" as "kind" of the request "id" until approvalRetention after "expires".
+func (r *Reminders) set(kind, id string, v interface{}, expires time.Time) error {
+	k, err := approvalKey(kind, id)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ttl := expires.Add(approvalRetention).Sub(r.now())
+	_, err = r.s.Set(k, string(buf), uint64(ttl/time.Second))
+	return err
+}
+
+// get reads the JSON of "kind" of the request "id" into "v". It returns false if it is not stored.
+func (r *Reminders) get(kind, id string, v interface{}) (bool, error) {
+	k, err := approvalKey(kind, id)
+	if err != nil {
+		return false, err
+	}
+	resp, err := r.s.Get(k, false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal([]byte(resp.Node.Value), v); err != nil {
+		return false, fmt.Errorf("malformed approval %s: %v", k, err)
+	}
+	return true, nil
+}
+
+// Request stores the approval request of the deployment "e" with the JSON of "payload" until "expires",
+// and notifies it as an ApprovalRequested event which mentions the approvers of the project.
+func (r *Reminders) Request(e Event, expires time.Time, payload interface{}) error {
+	c, err := r.load()
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	e.Type, e.Mentions = ApprovalRequested, approversOf(c, e.Project)
+	if err := r.set("requests", e.ID, Approval{Event: e, Expires: expires, Payload: buf}, expires); err != nil {
+		return err
+	}
+	if err := r.set("reminded", e.ID, r.now(), expires); err != nil {
+		return err
+	}
+	if err := r.notify(c, e.Project, e.Environment).Notify(e); err != nil {
+		glog.Errorf("Failed to notify approval request %s: %v", e.ID, err)
+	}
+	return nil
+}
+
+// Get returns the approval request "id".
+func (r *Reminders) Get(id string) (Approval, error) {
+	var a Approval
+	if ok, err := r.get("requests", id, &a); err != nil || !ok {
+		if err == nil {
+			err = ErrApprovalUnknown
+		}
+		return Approval{}, err
+	}
+	var res resolution
+	if _, err := r.get("resolutions", id, &res); err != nil {
+		return Approval{}, err
+	}
+	a.Resolution, a.Approver = res.Resolution, res.Approver
+	if _, err := r.get("reminded", id, &a.Reminded); err != nil {
+		return Approval{}, err
+	}
+	return a, nil
+}
+
+// Resolve approves or rejects the pending request "id" on behalf of "approver", which stops its reminders,
+// and notifies the resolution to the requester. Requesters can reject but cannot approve their own requests.
+// It returns the request as it is with an error if the request is not pending.
+func (r *Reminders) Resolve(id, approver string, approved bool) (Approval, error) {
+	a, err := r.Get(id)
+	switch {
+	case err != nil:
+		return a, err
+	case a.Resolution != "":
+		return a, ErrApprovalResolved
+	case !r.now().Before(a.Expires):
+		return a, ErrApprovalExpired
+	case approved && approver == a.Event.User:
+		return a, ErrSelfApproval
+	}
+	c, err := r.load()
+	if err != nil {
+		return a, err
+	}
+	a.Resolution, a.Approver = Rejected, approver
+	if approved {
+		a.Resolution = Approved
+	}
+	if err := r.set("resolutions", id, resolution{Resolution: a.Resolution, Approver: a.Approver}, a.Expires); err != nil {
+		return a, err
+	}
+
+	e := a.Resolved()
+	e.Mentions = c.ChatHandlesOf([]string{a.Event.User})
+	if err := r.notify(c, e.Project, e.Environment).Notify(e); err != nil {
+		glog.Errorf("Failed to notify %s of approval request %s: %v", e.Type, id, err)
+	}
+	return a, nil
+}
+
+// Remind notifies ApprovalReminder events of the requests which have been pending for the interval since their approvers
+// were notified last. Requests are not reminded once they are resolved or expire.
+// It is meant to run periodically on the leader, and stops when "ctx" is canceled.
+func (r *Reminders) Remind(ctx context.Context) {
+	resp, err := r.s.Get(path.Join(approvalsKey, "requests"), true, true)
+	if etcderr.IsKeyNotFound(err) {
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to load approval requests: %v", err)
+		return
+	}
+	c, err := r.load()
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	for _, n := range resp.Node.Nodes {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		a, err := r.Get(path.Base(n.Key))
+		if err != nil {
+			glog.Errorf("Failed to load approval request %s: %v", n.Key, err)
+			continue
+		}
+		now := r.now()
+		if a.Resolution != "" || !now.Before(a.Expires) || now.Sub(a.Reminded) < r.interval {
+			continue
+		}
+		e := a.Event
+		e.Type, e.Mentions = ApprovalReminder, approversOf(c, e.Project)
+		if err := r.notify(c, e.Project, e.Environment).Notify(e); err != nil {
+			glog.Errorf("Failed to remind approval request %s: %v", e.ID, err)
+		}
+		if err := r.set("reminded", e.ID, now, a.Expires); err != nil {
+			glog.Errorf("Failed to record reminder of approval request %s: %v", e.ID, err)
+		}
+	}
+}
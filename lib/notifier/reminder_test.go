@@ -0,0 +1,182 @@
+package notifier
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcdtest"
+	"golang.org/x/net/context"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Notify(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ts []EventType
+	for _, e := range r.events {
+		ts = append(ts, e.Type)
+	}
+	return ts
+}
+
+type waiter struct {
+	d  time.Duration
+	ch chan time.Time
+}
+
+// fakeClock is a clock which advances only when the test fires a waiter.
+type fakeClock struct {
+	mu      sync.Mutex
+	t       time.Time
+	waiters chan waiter
+}
+
+func newFakeClock(t time.Time) *fakeClock {
+	return &fakeClock{t: t, waiters: make(chan waiter)}
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.waiters <- waiter{d: d, ch: ch}
+	return ch
+}
+
+// fire advances the clock to the deadline of "w" and wakes it up.
+func (c *fakeClock) fire(w waiter) {
+	c.mu.Lock()
+	c.t = c.t.Add(w.d)
+	t := c.t
+	c.mu.Unlock()
+	w.ch <- t
+}
+
+// testReminders is a Reminders over an in-memory store with a clock which the test advances, which records the notified events.
+type testReminders struct {
+	*Reminders
+	s   etcdtest.Store
+	rec *recorder
+	t   time.Time
+}
+
+func newTestReminders(interval time.Duration, start time.Time) *testReminders {
+	c := config.Config{
+		ChatHandles: map[string]string{"carol": "carol-handle"},
+		Projects:    []config.Project{{Name: "api", Approvers: []string{"alice"}}},
+	}
+	r := &testReminders{s: etcdtest.NewStore(), rec: new(recorder), t: start}
+	r.Reminders = NewReminders(r.s, interval, func() (config.Config, error) { return c, nil }, func(config.Config, string, string) Notifier { return r.rec })
+	r.now = func() time.Time { return r.t }
+	return r
+}
+
+// advance advances the clock by "d" minute by minute, and reminds every minute.
+func (r *testReminders) advance(d time.Duration) {
+	for end := r.t.Add(d); r.t.Before(end); {
+		r.t = r.t.Add(time.Minute)
+		r.Remind(context.Background())
+	}
+}
+
+func TestRemindersSchedule(t *testing.T) {
+	start := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	r := newTestReminders(10*time.Minute, start)
+
+	if err := r.Request(Event{ID: "deploy-1", Project: "api", User: "carol"}, start.Add(35*time.Minute), nil); err != nil {
+		t.Fatalf("r.Request(...) failed with %v", err)
+	}
+	// no more reminders once the request expires in 35 minutes.
+	r.advance(time.Hour)
+
+	want := []EventType{ApprovalRequested, ApprovalReminder, ApprovalReminder, ApprovalReminder}
+	if got := r.rec.types(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q; want %q", got, want)
+	}
+	for _, e := range r.rec.events {
+		if got, want := e.Mentions, []string{"alice"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("e.Mentions = %q; want %q", got, want)
+		}
+	}
+	if got, want := r.s.TTLs["/goship/approvals/requests/deploy-1"], uint64((35*time.Minute+approvalRetention)/time.Second); got != want {
+		t.Errorf("TTL of the request = %d; want %d", got, want)
+	}
+}
+
+func TestRemindersStopOnResolve(t *testing.T) {
+	for _, approved := range []bool{true, false} {
+		start := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+		r := newTestReminders(10*time.Minute, start)
+
+		if err := r.Request(Event{ID: "deploy-1", Project: "api", User: "carol"}, start.Add(time.Hour), nil); err != nil {
+			t.Fatalf("r.Request(...) failed with %v", err)
+		}
+		r.advance(15 * time.Minute)
+		if _, err := r.Resolve("deploy-1", "carol", true); err != ErrSelfApproval {
+			t.Errorf("r.Resolve(%q, %q, true) failed with %v; want %v", "deploy-1", "carol", err, ErrSelfApproval)
+		}
+		a, err := r.Resolve("deploy-1", "alice", approved)
+		if err != nil {
+			t.Fatalf("r.Resolve(%q, %q, %t) failed with %v", "deploy-1", "alice", approved, err)
+		}
+		r.advance(time.Hour)
+
+		typ := Rejected
+		if approved {
+			typ = Approved
+		}
+		want := []EventType{ApprovalRequested, ApprovalReminder, typ}
+		if got := r.rec.types(); !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %q; want %q", got, want)
+		}
+		if got, want := r.rec.events[2].Mentions, []string{"carol-handle"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("mentions of %s = %q; want %q", typ, got, want)
+		}
+		if a.Resolution != typ || a.Approver != "alice" {
+			t.Errorf("r.Resolve(...) = %#v; want %s by alice", a, typ)
+		}
+		if _, err := r.Resolve("deploy-1", "alice", !approved); err != ErrApprovalResolved {
+			t.Errorf("r.Resolve(%q, ...) again failed with %v; want %v", "deploy-1", err, ErrApprovalResolved)
+		}
+		if got, err := r.Get("deploy-1"); err != nil || got.Resolution != typ {
+			t.Errorf("r.Get(%q) = %#v, %v; want %s", "deploy-1", got, err, typ)
+		}
+	}
+}
+
+func TestRemindersExpired(t *testing.T) {
+	start := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	r := newTestReminders(10*time.Minute, start)
+
+	if err := r.Request(Event{ID: "deploy-1", Project: "api", User: "carol"}, start.Add(5*time.Minute), nil); err != nil {
+		t.Fatalf("r.Request(...) failed with %v", err)
+	}
+	r.advance(time.Hour)
+	if got, want := r.rec.types(), []EventType{ApprovalRequested}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q; want %q", got, want)
+	}
+	if _, err := r.Resolve("deploy-1", "alice", true); err != ErrApprovalExpired {
+		t.Errorf("r.Resolve(%q, ...) failed with %v; want %v", "deploy-1", err, ErrApprovalExpired)
+	}
+	if _, err := r.Get("deploy-2"); err != ErrApprovalUnknown {
+		t.Errorf("r.Get(%q) failed with %v; want %v", "deploy-2", err, ErrApprovalUnknown)
+	}
+}
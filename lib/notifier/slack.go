@@ -0,0 +1,209 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	slackBaseURL = "https://slack.com/api/"
+
+	// SlackActionApprove and SlackActionReject are the action IDs of the buttons on approval requests.
+	// Their values are the IDs of the requests.
+	SlackActionApprove = "approve"
+	SlackActionReject  = "reject"
+)
+
+// slackBlock is a layout block of Slack messages.
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text,omitempty"`
+	BlockID  string         `json:"block_id,omitempty"`
+	Elements []slackElement `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackElement is an interactive element of an actions block.
+type slackElement struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	Style    string    `json:"style,omitempty"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+}
+
+// slackBlocks returns the blocks of the message "msg" for "e", which have Approve and Reject buttons
+// if "e" is a pending approval request, or nil for plain text messages. Tests never have buttons, which would resolve real requests.
+func slackBlocks(e Event, msg string) []slackBlock {
+	if (e.Type != ApprovalRequested && e.Type != ApprovalReminder) || e.ID == "" || e.Test {
+		return nil
+	}
+	button := func(label, style, action string) slackElement {
+		return slackElement{Type: "button", Text: slackText{Type: "plain_text", Text: label}, Style: style, ActionID: action, Value: e.ID}
+	}
+	return []slackBlock{
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: msg}},
+		{Type: "actions", BlockID: "approval", Elements: []slackElement{
+			button("Approve", "primary", SlackActionApprove),
+			button("Reject", "danger", SlackActionReject),
+		}},
+	}
+}
+
+// Slack is a Notifier which posts messages to a Slack channel with a bot token.
+// It updates the message of a started deployment to the final status when the deployment finishes,
+// rather than posting a second message.
+type Slack struct {
+	token   string
+	channel string
+	baseURL string
+	// client sends the requests. It is http.DefaultClient if nil.
+	client *http.Client
+
+	mu sync.Mutex
+	// posted maps IDs of deployments in progress to their messages.
+	posted map[string]slackMessage
+}
+
+// slackMessage identifies a posted message. Channel is the ID of the channel, which chat.update requires
+// even if the message was posted with the name of the channel.
+type slackMessage struct {
+	Channel, TS string
+}
+
+// NewSlack returns a new Slack notifier.
+// "token" must be a valid bot token which can post messages to "channel".
+func NewSlack(token, channel string) *Slack {
+	return &Slack{
+		token:   token,
+		channel: channel,
+		baseURL: slackBaseURL,
+		posted:  make(map[string]slackMessage),
+	}
+}
+
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// Notify posts a message for "e", or updates the message posted for the same deployment.
+func (s *Slack) Notify(e Event) error {
+	msg := Message(e)
+	if e.Type == DeployStarted {
+		resp, err := s.call("chat.postMessage", url.Values{
+			"channel": {s.channel},
+			"text":    {msg},
+		})
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.posted[e.ID] = slackMessage{Channel: resp.Channel, TS: resp.TS}
+		return nil
+	}
+
+	s.mu.Lock()
+	posted, ok := s.posted[e.ID]
+	delete(s.posted, e.ID)
+	s.mu.Unlock()
+	if !ok {
+		form := url.Values{
+			"channel": {s.channel},
+			"text":    {msg},
+		}
+		if blocks := slackBlocks(e, msg); blocks != nil {
+			buf, err := json.Marshal(blocks)
+			if err != nil {
+				return err
+			}
+			form.Set("blocks", string(buf))
+		}
+		_, err := s.call("chat.postMessage", form)
+		return err
+	}
+	_, err := s.call("chat.update", url.Values{
+		"channel": {posted.Channel},
+		"ts":      {posted.TS},
+		"text":    {msg},
+	})
+	return err
+}
+
+func (s *Slack) call(method string, form url.Values) (slackResponse, error) {
+	form.Set("token", s.token)
+	resp, err := httpClient(s.client).PostForm(s.baseURL+method, form)
+	if err != nil {
+		return slackResponse{}, err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code < http.StatusOK || http.StatusMultipleChoices <= code {
+		return slackResponse{}, fmt.Errorf("Unexpected HTTP status %d from Slack %s", code, method)
+	}
+	var r slackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return slackResponse{}, err
+	}
+	if !r.OK {
+		return slackResponse{}, fmt.Errorf("Slack %s failed: %s", method, r.Error)
+	}
+	return r, nil
+}
+
+// SlackWebhook is a Notifier which posts messages to a Slack incoming webhook.
+// Unlike Slack, it posts a message per event since webhooks cannot update messages.
+type SlackWebhook struct {
+	url     string
+	channel string
+	// client sends the requests. It is http.DefaultClient if nil.
+	client *http.Client
+}
+
+// NewSlackWebhook returns a new SlackWebhook which posts to "url".
+// Messages are posted to the default channel of the webhook if "channel" is empty.
+func NewSlackWebhook(url, channel string) SlackWebhook {
+	return SlackWebhook{url: url, channel: channel}
+}
+
+type slackWebhookPayload struct {
+	Text    string       `json:"text"`
+	Channel string       `json:"channel,omitempty"`
+	Blocks  []slackBlock `json:"blocks,omitempty"`
+}
+
+// Notify posts a message for "e".
+func (s SlackWebhook) Notify(e Event) error {
+	msg := Message(e)
+	buf, err := json.Marshal(slackWebhookPayload{Text: msg, Channel: s.channel, Blocks: slackBlocks(e, msg)})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient(s.client).Post(s.url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code < http.StatusOK || http.StatusMultipleChoices <= code {
+		return fmt.Errorf("Unexpected HTTP status %d from Slack webhook", code)
+	}
+	return nil
+}
+
+// httpClient returns "c", or http.DefaultClient if nil.
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
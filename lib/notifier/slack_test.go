@@ -0,0 +1,251 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gengo/goship/lib/artifact"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/pivotal"
+)
+
+type slackCall struct {
+	method, channel, ts, text string
+	// blocks is the JSON of the layout blocks if any.
+	blocks string
+}
+
+func withStubSlack(t *testing.T, f func(s *Slack, calls func() []slackCall)) {
+	var (
+		mu    sync.Mutex
+		log   []slackCall
+		count int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if got, want := r.FormValue("token"), "bot-token"; got != want {
+			t.Errorf("token = %q; want %q", got, want)
+		}
+		count++
+		log = append(log, slackCall{method: r.URL.Path[1:], channel: r.FormValue("channel"), ts: r.FormValue("ts"), text: r.FormValue("text"), blocks: r.FormValue("blocks")})
+		fmt.Fprintf(w, `{"ok": true, "channel": "C1", "ts": "ts-%d"}`, count)
+	}))
+	defer srv.Close()
+
+	s := NewSlack("bot-token", "#deploys")
+	s.baseURL = srv.URL + "/"
+	f(s, func() []slackCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]slackCall(nil), log...)
+	})
+}
+
+func TestSlackUpdatesStartedMessage(t *testing.T) {
+	withStubSlack(t, func(s *Slack, calls func() []slackCall) {
+		start := Event{Type: DeployStarted, ID: "deploy-1", Project: "api", Environment: "production", User: "alice"}
+		if err := s.Notify(start); err != nil {
+			t.Fatalf("s.Notify(%#v) failed with %v; want success", start, err)
+		}
+		end := Event{Type: DeploySucceeded, ID: "deploy-1", Project: "api", Environment: "production", User: "alice"}
+		if err := s.Notify(end); err != nil {
+			t.Fatalf("s.Notify(%#v) failed with %v; want success", end, err)
+		}
+		got := calls()
+		if len(got) != 2 {
+			t.Fatalf("calls = %#v; want 2 calls", got)
+		}
+		if got[0].method != "chat.postMessage" || got[0].channel != "#deploys" {
+			t.Errorf("calls[0] = %#v; want chat.postMessage into #deploys", got[0])
+		}
+		// chat.update takes only the ID of the channel, which chat.postMessage returned for the name.
+		if got[1].method != "chat.update" || got[1].channel != "C1" || got[1].ts != "ts-1" {
+			t.Errorf("calls[1] = %#v; want chat.update of ts-1 in C1", got[1])
+		}
+		if want := Message(end); got[1].text != want {
+			t.Errorf("calls[1].text = %q; want %q", got[1].text, want)
+		}
+	})
+}
+
+func TestSlackPostsNewMessageWithoutStart(t *testing.T) {
+	withStubSlack(t, func(s *Slack, calls func() []slackCall) {
+		s.Notify(Event{Type: DeployStarted, ID: "deploy-1", Project: "api", Environment: "staging"})
+		// a different deployment, whose start was not notified through this notifier.
+		s.Notify(Event{Type: DeployFailed, ID: "deploy-2", Project: "api", Environment: "production"})
+		// the message of a finished deployment must not be updated twice.
+		s.Notify(Event{Type: DeploySucceeded, ID: "deploy-1", Project: "api", Environment: "staging"})
+		s.Notify(Event{Type: DeploySucceeded, ID: "deploy-1", Project: "api", Environment: "staging"})
+
+		var methods []string
+		for _, c := range calls() {
+			methods = append(methods, c.method)
+		}
+		want := []string{"chat.postMessage", "chat.postMessage", "chat.update", "chat.postMessage"}
+		if fmt.Sprint(methods) != fmt.Sprint(want) {
+			t.Errorf("methods = %q; want %q", methods, want)
+		}
+	})
+}
+
+func TestSlackApprovalButtons(t *testing.T) {
+	withStubSlack(t, func(s *Slack, calls func() []slackCall) {
+		req := Event{Type: ApprovalRequested, ID: "deploy-1", Project: "api", Environment: "production", User: "carol", Mentions: []string{"alice"}}
+		s.Notify(req)
+		s.Notify(Event{Type: Approved, ID: "deploy-1", Project: "api", Environment: "production", User: "carol", Approver: "alice"})
+
+		got := calls()
+		if len(got) != 2 {
+			t.Fatalf("calls = %#v; want 2 calls", got)
+		}
+		var blocks []slackBlock
+		if err := json.Unmarshal([]byte(got[0].blocks), &blocks); err != nil {
+			t.Fatalf("json.Unmarshal(%q) failed with %v", got[0].blocks, err)
+		}
+		if len(blocks) != 2 || blocks[0].Text == nil || blocks[0].Text.Text != Message(req) {
+			t.Fatalf("blocks = %#v; want the message and the buttons", blocks)
+		}
+		var actions []string
+		for _, e := range blocks[1].Elements {
+			actions = append(actions, e.ActionID+"="+e.Value)
+		}
+		if want := []string{"approve=deploy-1", "reject=deploy-1"}; !reflect.DeepEqual(actions, want) {
+			t.Errorf("buttons = %q; want %q", actions, want)
+		}
+		if got[1].blocks != "" {
+			t.Errorf("blocks of the resolution = %q; want no buttons", got[1].blocks)
+		}
+	})
+}
+
+func TestMessage(t *testing.T) {
+	for _, spec := range []struct {
+		e    Event
+		want string
+	}{
+		{
+			e:    Event{Type: DeployStarted, Project: "api", Environment: "production", User: "alice"},
+			want: "alice is deploying api to *production*.",
+		},
+		{
+			e: Event{
+				Type: DeployStarted, Project: "api", Environment: "production", User: "alice",
+				From: "0123456789abcdef", To: "fedcba9876543210", ExpectedDuration: 90e9,
+			},
+			want: "alice is deploying api (0123456...fedcba9) to *production*. Expected to take about 1m30s.",
+		},
+		{
+			e: Event{
+				Type: DeployStarted, Project: "api", Environment: "production", User: "alice",
+				Flags: map[string]string{"new_checkout": "on", "beta.search": "50%"},
+			},
+			want: "alice is deploying api to *production*. Flags: beta.search=50%, new_checkout=on.",
+		},
+		{
+			e:    Event{Type: DeployStarted, Project: "api", Environment: "production", User: "alice", Note: "Release for the campaign"},
+			want: "alice is deploying api to *production*. Note: Release for the campaign",
+		},
+		{
+			e:    Event{Type: DeployFailed, Project: "api", Environment: "production", Note: "Release for the campaign"},
+			want: "api deployment to *production* failed. Note: Release for the campaign",
+		},
+		{
+			e:    Event{Type: DeploySucceeded, Project: "api", Environment: "production"},
+			want: "api successfully deployed to *production*.",
+		},
+		{
+			e:    Event{Type: DeployFailed, Project: "api", Environment: "production"},
+			want: "api deployment to *production* failed.",
+		},
+		{
+			e:    Event{Type: DeploySucceeded, Project: "api", Environment: "production", User: "alice"},
+			want: "api successfully deployed to *production* by alice.",
+		},
+		{
+			e:    Event{Type: DeployFailed, Project: "api", Environment: "production", User: "unknown"},
+			want: "api deployment to *production* by unknown failed.",
+		},
+		{
+			e: Event{
+				Type: DeploySucceeded, Project: "api", Environment: "production", Note: "Release for the campaign",
+				Artifacts: []artifact.Artifact{
+					{Name: "tarball", URL: "https://builds.example.com/api-1234.tar.gz"},
+					{Name: "changelog", URL: "https://builds.example.com/api-1234/CHANGES"},
+				},
+			},
+			want: "api successfully deployed to *production*. Artifacts: <https://builds.example.com/api-1234.tar.gz|tarball>, <https://builds.example.com/api-1234/CHANGES|changelog>. Note: Release for the campaign",
+		},
+		{
+			e:    Event{Type: PivotalPosted, Project: "api", Environment: "production", Pivotal: pivotal.Summary{Posted: 3, Skipped: 1, Failed: 2}},
+			want: "Pivotal stories of api deployment to *production*: 3 posted, 1 skipped, 2 failed.",
+		},
+		{
+			e:    Event{Type: ApprovalRequested, Project: "api", Environment: "production", User: "carol", Mentions: []string{"alice", "@bob"}},
+			want: "@alice @bob carol requests approval to deploy api to *production*.",
+		},
+		{
+			e:    Event{Type: Rejected, Project: "api", Environment: "production", User: "carol", Approver: "alice", Mentions: []string{"carol"}},
+			want: "@carol alice rejected deployment of api to *production*.",
+		},
+		{
+			e:    Event{Type: HostsChanged, Project: "api", Environment: "production", AddedHosts: []string{"web-042", "web-043"}, RemovedHosts: []string{"web-017"}},
+			want: "api *production* gained web-042, web-043, lost web-017.",
+		},
+		{
+			e:    Event{Type: HostsChanged, Project: "api", Environment: "production", RemovedHosts: []string{"web-017"}},
+			want: "api *production* lost web-017.",
+		},
+		{
+			e:    Event{Type: AutoLocked, Project: "api", Environment: "production", User: "goship", Reason: "auto-locked: deploy api-production-1 failed"},
+			want: "api *production* has been locked by goship (auto-locked: deploy api-production-1 failed). Unlock it after looking into the failure.",
+		},
+	} {
+		if got := Message(spec.e); got != spec.want {
+			t.Errorf("Message(%#v) = %q; want %q", spec.e, got, spec.want)
+		}
+	}
+}
+
+func TestForEnvironmentWebhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads []slackWebhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p slackWebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("json.Decode failed with %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		payloads = append(payloads, p)
+	}))
+	defer srv.Close()
+
+	c := config.Config{Projects: []config.Project{{
+		Name: "api",
+		Environments: []config.Environment{{
+			Name: "production",
+			NotificationOverrides: map[string]config.NotificationOverride{
+				"slack": {Channel: "#ops", WebhookURL: srv.URL, Recipients: []string{"oncall"}},
+			},
+		}},
+	}}}
+	e := Event{Type: DeploySucceeded, ID: "deploy-1", Project: "api", Environment: "production"}
+	if err := ForEnvironment(c, "api", "production").Notify(e); err != nil {
+		t.Fatalf("ForEnvironment(c, %q, %q).Notify(%#v) failed with %v", "api", "production", e, err)
+	}
+	want := []slackWebhookPayload{{Text: "@oncall api successfully deployed to *production*.", Channel: "#ops"}}
+	if !reflect.DeepEqual(payloads, want) {
+		t.Errorf("payloads = %#v; want %#v", payloads, want)
+	}
+	if err := New(c).Notify(e); err != nil || len(payloads) != 1 {
+		t.Errorf("New(c).Notify(e) = %v with %d payloads; want no notifications without the environment", err, len(payloads))
+	}
+}
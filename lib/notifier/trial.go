@@ -0,0 +1,112 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"syscall"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+// testPrefix is prepended to the messages of tests.
+const testPrefix = "[TEST] "
+
+// ErrNoTarget means the notification target to test is not configured.
+var ErrNoTarget = errors.New("notification target not configured")
+
+// TestResult is how a notification target handled a test event.
+type TestResult struct {
+	Target string `json:"target"`
+	// Payload is what was sent to the target: the request body for Slack with the token removed, or the argument of the command.
+	Payload string `json:"payload"`
+	// Status is the HTTP status code of the last response of Slack, or the exit status of the command.
+	// It is zero if the target could not be reached at all.
+	Status int `json:"status"`
+	// Error describes why the target failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// SendTest sends "e" flagged as a test to the target "name" resolved for the environment "env" of "proj", as ForEnvironment would.
+// Digests are bypassed so that the result is immediate. It fails with ErrNoTarget if the target is not configured.
+func SendTest(c config.Config, proj, env, name string, e Event) (TestResult, error) {
+	e.Test = true
+	for _, t := range config.ResolveNotificationTargets(c, proj, env) {
+		if t.Name != name {
+			continue
+		}
+		rec := &exchangeRecorder{base: http.DefaultTransport}
+		n, _, ok := targetNotifier(t, &http.Client{Transport: rec})
+		if !ok {
+			break
+		}
+		res := TestResult{Target: name}
+		err := n.Notify(e)
+		if t.Name == config.NotifyTargetCommand {
+			res.Payload, res.Status = Message(withMentions(e, t.Recipients)), exitStatus(err)
+		} else {
+			res.Payload, res.Status = rec.payload, rec.status
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		return res, nil
+	}
+	return TestResult{}, ErrNoTarget
+}
+
+// exitStatus returns the exit status of a command which finished with "err".
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok {
+			return ws.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// exchangeRecorder is an http.RoundTripper which records the body of the last request and the status of its response.
+type exchangeRecorder struct {
+	base    http.RoundTripper
+	payload string
+	status  int
+}
+
+func (r *exchangeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		buf, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		copied := *req
+		copied.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		req = &copied
+		r.payload = redactToken(req.Header.Get("Content-Type"), string(buf))
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	r.status = resp.StatusCode
+	return resp, nil
+}
+
+// redactToken removes the bot token from "body" of a form so that it is not shown to the operator.
+func redactToken(contentType, body string) string {
+	if contentType != "application/x-www-form-urlencoded" {
+		return body
+	}
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	form.Del("token")
+	return form.Encode()
+}
@@ -0,0 +1,85 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestSendTestWebhook(t *testing.T) {
+	var got slackWebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("json.Decode(body) failed with %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	c := config.Config{Projects: []config.Project{{
+		Name: "api",
+		Environments: []config.Environment{{
+			Name: "production",
+			NotificationOverrides: map[string]config.NotificationOverride{
+				config.NotifyTargetSlack: {WebhookURL: srv.URL, Channel: "#ops", Recipients: []string{"oncall"}},
+			},
+		}},
+	}}}
+
+	// the flag is applied even if the caller forgets it.
+	e := Event{Type: ApprovalRequested, ID: "req-1", Project: "api", Environment: "production", User: "alice"}
+	res, err := SendTest(c, "api", "production", config.NotifyTargetSlack, e)
+	if err != nil {
+		t.Fatalf("SendTest(c, %q, %q, %q, %#v) failed with %v", "api", "production", config.NotifyTargetSlack, e, err)
+	}
+	if want := "[TEST] @oncall alice requests approval to deploy api to *production*."; got.Text != want {
+		t.Errorf("text = %q; want %q", got.Text, want)
+	}
+	if got.Channel != "#ops" || got.Blocks != nil {
+		t.Errorf("payload = %#v; want a plain message to #ops without buttons", got)
+	}
+	if res.Status != http.StatusAccepted || res.Error != "" || !strings.Contains(res.Payload, `"[TEST] @oncall`) {
+		t.Errorf("SendTest(...) = %#v; want the payload with status %d", res, http.StatusAccepted)
+	}
+
+	if _, err := SendTest(c, "api", "production", config.NotifyTargetCommand, e); err != ErrNoTarget {
+		t.Errorf("SendTest(c, %q, %q, %q, e) failed with %v; want %v", "api", "production", config.NotifyTargetCommand, err, ErrNoTarget)
+	}
+}
+
+func TestSendTestCommand(t *testing.T) {
+	e := Event{Type: DeploySucceeded, Project: "api", Environment: "staging", User: "bob"}
+	for _, spec := range []struct {
+		command string
+		status  int
+	}{
+		{command: "true", status: 0},
+		{command: "false", status: 1},
+	} {
+		c := config.Config{Notify: spec.command}
+		res, err := SendTest(c, "api", "staging", config.NotifyTargetCommand, e)
+		if err != nil {
+			t.Errorf("SendTest(c, ...) failed with %v for %q", err, spec.command)
+			continue
+		}
+		if want := "[TEST] api successfully deployed to *staging* by bob."; res.Payload != want || res.Status != spec.status {
+			t.Errorf("SendTest(c, ...) = %#v for %q; want %q with status %d", res, spec.command, want, spec.status)
+		}
+		if (res.Error != "") != (spec.status != 0) {
+			t.Errorf("res.Error = %q for %q", res.Error, spec.command)
+		}
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	form := "channel=%23deploys&text=hello&token=xoxb-secret"
+	if got, want := redactToken("application/x-www-form-urlencoded", form), "channel=%23deploys&text=hello"; got != want {
+		t.Errorf("redactToken(form) = %q; want %q", got, want)
+	}
+	if got := redactToken("application/json", `{"token":"x"}`); got != `{"token":"x"}` {
+		t.Errorf("redactToken(json) = %q; want it unchanged", got)
+	}
+}
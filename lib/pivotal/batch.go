@@ -0,0 +1,376 @@
+package pivotal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/glog"
+)
+
+const (
+	defaultConcurrency       = 3
+	defaultRequestsPerSecond = 5
+	defaultMaxRetries        = 3
+)
+
+// MaxCommentLength is the maximum number of characters of a comment which Pivotal accepts.
+const MaxCommentLength = 20000
+
+// truncatedSuffix marks comments cut at MaxCommentLength.
+const truncatedSuffix = "\n... (truncated)"
+
+// BatchOptions configures PostBatch.
+type BatchOptions struct {
+	// Concurrency is the number of stories processed at once. Defaults to 3.
+	Concurrency int
+	// RequestsPerSecond is the maximum rate of requests shared by all the workers. Defaults to 5.
+	RequestsPerSecond float64
+	// MaxRetries is how many times a request rejected with 429 is retried. Defaults to 3.
+	MaxRetries int
+	// MaxStories is the maximum number of stories commented individually. No limit if zero.
+	MaxStories int
+	// ReleaseStory is the story which gets a single comment listing all the stories instead
+	// when there are more than MaxStories stories. The stories are skipped if zero.
+	ReleaseStory int
+	// Label is added to each commented story if not empty.
+	Label string
+	// DefaultProject is the project which stories are posted to if their projects cannot be resolved.
+	// Such stories fail if zero.
+	DefaultProject int
+	// Projects caches projects of stories across batches if not nil.
+	Projects *ProjectCache
+}
+
+// Summary is the result of PostBatch.
+type Summary struct {
+	// Posted is the number of comments posted.
+	Posted int `json:"posted"`
+	// Skipped is the number of stories which were not commented individually.
+	Skipped int `json:"skipped"`
+	// Failed is the number of stories which could not be commented.
+	Failed int `json:"failed"`
+	// Resolved is the number of stories whose projects were resolved. It is counted only with BatchOptions.DefaultProject.
+	Resolved int `json:"resolved,omitempty"`
+	// Defaulted is the number of stories posted to BatchOptions.DefaultProject since their projects could not be resolved.
+	Defaulted int `json:"defaulted,omitempty"`
+	// Note explains why no stories were commented, if so.
+	Note string `json:"note,omitempty"`
+	// Outbox is the state of the failed stories in the outbox if they are being retried, i.e. OutboxPending or OutboxFailed.
+	Outbox string `json:"outbox,omitempty"`
+}
+
+func (s Summary) String() string {
+	if s.Note != "" {
+		return s.Note
+	}
+	str := fmt.Sprintf("%d posted, %d skipped, %d failed", s.Posted, s.Skipped, s.Failed)
+	if s.Resolved > 0 || s.Defaulted > 0 {
+		str += fmt.Sprintf(" (%d resolved, %d defaulted)", s.Resolved, s.Defaulted)
+	}
+	return str
+}
+
+// ProjectCache remembers projects of stories, which never change.
+type ProjectCache struct {
+	mu       sync.Mutex
+	projects map[int]int
+}
+
+// NewProjectCache returns a new empty ProjectCache.
+func NewProjectCache() *ProjectCache {
+	return &ProjectCache{projects: make(map[int]int)}
+}
+
+func (c *ProjectCache) get(id int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.projects[id]
+	return p, ok
+}
+
+func (c *ProjectCache) put(id, project int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.projects[id] = project
+}
+
+// PostBatch posts "comment" to the stories "ids" with a limited concurrency and rate.
+// It keeps going on failures and reports them in the summary.
+func PostBatch(cl Client, ids []int, comment string, opts BatchOptions) Summary {
+	return newBatch(cl, opts, time.Now, time.Sleep).post(ids, comment)
+}
+
+// Post is a comment to be posted to stories.
+type Post struct {
+	Stories []int  `json:"stories"`
+	Comment string `json:"comment"`
+	// Label is added to each commented story if not empty.
+	Label string `json:"label,omitempty"`
+	// Details are appended to the comment of each story, e.g. the commits which refer to the story.
+	// They are keyed by the story IDs in decimal since keys of JSON objects are strings.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// SetDetail appends "detail" to the comment of story "id" only.
+func (p *Post) SetDetail(id int, detail string) {
+	if p.Details == nil {
+		p.Details = make(map[string]string)
+	}
+	p.Details[strconv.Itoa(id)] = detail
+}
+
+// PostStories posts "p" like PostBatch with the label of "p". It also returns "p" with the stories which failed,
+// which can be posted again later without duplicating the comments posted this time.
+func PostStories(cl Client, p Post, opts BatchOptions) (Summary, Post) {
+	opts.Label = p.Label
+	b := newBatch(cl, opts, time.Now, time.Sleep)
+	b.details = p.Details
+	sum, failed := b.postStories(p.Stories, p.Comment)
+	p.Stories = failed
+	return sum, p
+}
+
+type batch struct {
+	cl   Client
+	opts BatchOptions
+	th   *throttle
+	// details are appended to the comments of the stories. See Post.Details.
+	details map[string]string
+
+	mu                  sync.Mutex
+	resolved, defaulted int
+}
+
+func newBatch(cl Client, opts BatchOptions, now func() time.Time, sleep func(time.Duration)) *batch {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.RequestsPerSecond <= 0 {
+		opts.RequestsPerSecond = defaultRequestsPerSecond
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+	return &batch{
+		cl:   cl,
+		opts: opts,
+		th: &throttle{
+			interval: time.Duration(float64(time.Second) / opts.RequestsPerSecond),
+			now:      now,
+			sleep:    sleep,
+		},
+	}
+}
+
+func (b *batch) post(ids []int, comment string) Summary {
+	sum, _ := b.postStories(ids, comment)
+	return sum
+}
+
+// postStories posts "comment" to "ids" and returns the summary and the stories which failed.
+func (b *batch) postStories(ids []int, comment string) (Summary, []int) {
+	sum, failed := b.postAll(ids, comment)
+	sum.Resolved, sum.Defaulted = b.resolved, b.defaulted
+	sort.Ints(failed)
+	return sum, failed
+}
+
+func (b *batch) postAll(ids []int, comment string) (Summary, []int) {
+	if b.opts.MaxStories > 0 && len(ids) > b.opts.MaxStories {
+		return b.postRelease(ids, comment)
+	}
+
+	var (
+		mu     sync.Mutex
+		sum    Summary
+		failed []int
+		wg     sync.WaitGroup
+	)
+	queue := make(chan int)
+	for i := 0; i < b.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				err := b.postStory(id, b.commentOf(id, comment))
+				mu.Lock()
+				if err != nil {
+					glog.Errorf("Failed to post a comment %q to story %d: %v", comment, id, err)
+					sum.Failed++
+					failed = append(failed, id)
+				} else {
+					sum.Posted++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ids {
+		queue <- id
+	}
+	close(queue)
+	wg.Wait()
+	return sum, failed
+}
+
+// postRelease posts a single comment about all the stories to the release story.
+// All the stories fail if the comment fails.
+func (b *batch) postRelease(ids []int, comment string) (Summary, []int) {
+	sum := Summary{Skipped: len(ids)}
+	if b.opts.ReleaseStory == 0 {
+		glog.Warningf("Skipped posting to %d Pivotal stories, more than %d", len(ids), b.opts.MaxStories)
+		return sum, nil
+	}
+	refs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, fmt.Sprintf("#%d", id))
+	}
+	comment = fmt.Sprintf("%s\n\nStories: %s", comment, strings.Join(refs, " "))
+	if _, err := b.postComment(b.opts.ReleaseStory, comment); err != nil {
+		glog.Errorf("Failed to post a comment to release story %d: %v", b.opts.ReleaseStory, err)
+		sum.Failed++
+		return sum, append([]int(nil), ids...)
+	}
+	sum.Posted++
+	return sum, nil
+}
+
+// commentOf returns "comment" with the detail of story "id" if any.
+func (b *batch) commentOf(id int, comment string) string {
+	if d := b.details[strconv.Itoa(id)]; d != "" {
+		return comment + "\n\n" + d
+	}
+	return comment
+}
+
+// postStory posts "comment" to story "id" and adds the label.
+// Failure of adding the label is only logged since the comment has been posted.
+func (b *batch) postStory(id int, comment string) error {
+	project, err := b.postComment(id, comment)
+	if err != nil {
+		return err
+	}
+	if b.opts.Label != "" {
+		if err := b.call(func() error { return b.cl.AddLabel(id, project, b.opts.Label) }); err != nil {
+			glog.Errorf("Failed to add a label %q to story %d: %v", b.opts.Label, id, err)
+		}
+	}
+	return nil
+}
+
+// postComment posts "comment" to story "id" and returns the project of the story.
+// The comment is truncated to MaxCommentLength.
+func (b *batch) postComment(id int, comment string) (int, error) {
+	project, err := b.project(id)
+	if err != nil {
+		return 0, err
+	}
+	comment = truncateComment(comment, MaxCommentLength)
+	return project, b.call(func() error { return b.cl.AddComment(id, project, comment) })
+}
+
+// truncateComment cuts "comment" at a line break so that it fits in "max" characters with a note of the truncation.
+// It cuts in the middle of the line if the first line is too long.
+func truncateComment(comment string, max int) string {
+	if utf8.RuneCountInString(comment) <= max {
+		return comment
+	}
+	runes := []rune(comment)[:max-utf8.RuneCountInString(truncatedSuffix)]
+	s := string(runes)
+	if i := strings.LastIndex(s, "\n"); i > 0 {
+		s = s[:i]
+	}
+	return s + truncatedSuffix
+}
+
+// project resolves the project of story "id", or returns the default project if it cannot be resolved.
+func (b *batch) project(id int) (int, error) {
+	if b.opts.Projects != nil {
+		if project, ok := b.opts.Projects.get(id); ok {
+			b.count(&b.resolved)
+			return project, nil
+		}
+	}
+	var project int
+	err := b.call(func() (err error) {
+		project, err = b.cl.FindProjectForStory(id)
+		return err
+	})
+	if err != nil {
+		if b.opts.DefaultProject == 0 {
+			return 0, err
+		}
+		glog.Warningf("Failed to resolve the project of story %d; posting to project %d: %v", id, b.opts.DefaultProject, err)
+		b.count(&b.defaulted)
+		return b.opts.DefaultProject, nil
+	}
+	if b.opts.Projects != nil {
+		b.opts.Projects.put(id, project)
+	}
+	b.count(&b.resolved)
+	return project, nil
+}
+
+// count increments "n" if stories can fall back to the default project.
+func (b *batch) count(n *int) {
+	if b.opts.DefaultProject == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*n++
+}
+
+// call runs "f" within the rate limit, and retries it after the period Pivotal asks for if rate limited.
+func (b *batch) call(f func() error) error {
+	for i := 0; ; i++ {
+		b.th.wait()
+		err := f()
+		rerr, ok := err.(RateLimitError)
+		if !ok || i >= b.opts.MaxRetries {
+			return err
+		}
+		b.th.pause(rerr.RetryAfter)
+	}
+}
+
+// throttle spaces out requests of all the workers.
+type throttle struct {
+	interval time.Duration
+	now      func() time.Time
+	sleep    func(time.Duration)
+
+	mu sync.Mutex
+	// next is when the next request is allowed.
+	next time.Time
+}
+
+// wait blocks until the next request is allowed.
+func (t *throttle) wait() {
+	t.mu.Lock()
+	now := t.now()
+	at := t.next
+	if at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mu.Unlock()
+
+	if d := at.Sub(now); d > 0 {
+		t.sleep(d)
+	}
+}
+
+// pause delays all the requests by "d" from now.
+func (t *throttle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at := t.now().Add(d); at.After(t.next) {
+		t.next = at
+	}
+}
@@ -0,0 +1,291 @@
+package pivotal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient is a Client which records comments and rejects requests with 429 as configured.
+type fakeClient struct {
+	mu sync.Mutex
+	// limited is the number of times AddComment to each story is rate limited.
+	limited               map[int]int
+	comments              map[int][]string
+	labels                map[int][]string
+	inFlight, maxInFlight int
+	delay                 time.Duration
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		limited:  make(map[int]int),
+		comments: make(map[int][]string),
+		labels:   make(map[int][]string),
+	}
+}
+
+func (c *fakeClient) FindProjectForStory(id int) (int, error) {
+	if id < 0 {
+		return 0, fmt.Errorf("no such story %d", id)
+	}
+	return 1000 + id, nil
+}
+
+func (c *fakeClient) AddLabel(id int, project int, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.labels[id] = append(c.labels[id], label)
+	return nil
+}
+
+func (c *fakeClient) AddComment(id int, project int, comment string) error {
+	c.mu.Lock()
+	if project != 1000+id {
+		c.mu.Unlock()
+		return fmt.Errorf("project = %d; want %d", project, 1000+id)
+	}
+	if c.limited[id] > 0 {
+		c.limited[id]--
+		c.mu.Unlock()
+		return RateLimitError{RetryAfter: 2 * time.Second}
+	}
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mu.Unlock()
+
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.comments[id] = append(c.comments[id], comment)
+	return nil
+}
+
+// fakeClock is a clock which advances only when sleeping.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestPostBatchThrottle(t *testing.T) {
+	start := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	cl := newFakeClient()
+	cl.limited[2] = 1
+	opts := BatchOptions{Concurrency: 1, RequestsPerSecond: 1, Label: "released"}
+
+	got := newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, 3}, "deployed")
+	if want := (Summary{Posted: 3}); got != want {
+		t.Errorf("post(...) = %#v; want %#v", got, want)
+	}
+	for _, id := range []int{1, 2, 3} {
+		if got, want := cl.comments[id], []string{"deployed"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("comments[%d] = %q; want %q", id, got, want)
+		}
+		if got, want := cl.labels[id], []string{"released"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("labels[%d] = %q; want %q", id, got, want)
+		}
+	}
+	// 10 requests including the retry at 1 request per second, but 2 seconds of Retry-After after the rejected one.
+	if got, want := clock.now().Sub(start), 10*time.Second; got != want {
+		t.Errorf("elapsed = %s; want %s", got, want)
+	}
+}
+
+func TestPostBatchFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	cl := newFakeClient()
+	cl.limited[2] = 10
+	opts := BatchOptions{MaxRetries: 2}
+
+	got := newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, -3, 4}, "deployed")
+	if want := (Summary{Posted: 2, Failed: 2}); got != want {
+		t.Errorf("post(...) = %#v; want %#v", got, want)
+	}
+	if got, want := cl.limited[2], 7; got != want {
+		t.Errorf("remaining rate limited requests = %d; want %d; must give up after %d retries", got, want, opts.MaxRetries)
+	}
+
+	_, failed := newBatch(cl, opts, clock.now, clock.sleep).postStories([]int{1, 2, -3, 4}, "deployed")
+	if want := []int{-3, 2}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("postStories(...) failed %v; want %v", failed, want)
+	}
+}
+
+func TestPostBatchConcurrency(t *testing.T) {
+	cl := newFakeClient()
+	cl.delay = 10 * time.Millisecond
+	opts := BatchOptions{Concurrency: 2, RequestsPerSecond: 1e6}
+	var ids []int
+	for i := 1; i <= 10; i++ {
+		ids = append(ids, i)
+	}
+
+	got := PostBatch(cl, ids, "deployed", opts)
+	if want := (Summary{Posted: 10}); got != want {
+		t.Errorf("PostBatch(...) = %#v; want %#v", got, want)
+	}
+	if cl.maxInFlight > opts.Concurrency {
+		t.Errorf("maxInFlight = %d; want <= %d", cl.maxInFlight, opts.Concurrency)
+	}
+}
+
+func TestPostBatchCap(t *testing.T) {
+	for _, spec := range []struct {
+		release int
+		want    Summary
+		posted  map[int]int
+	}{
+		{
+			release: 99,
+			want:    Summary{Posted: 1, Skipped: 3},
+			posted:  map[int]int{99: 1},
+		},
+		{
+			want:   Summary{Skipped: 3},
+			posted: map[int]int{},
+		},
+	} {
+		clock := &fakeClock{t: time.Now()}
+		cl := newFakeClient()
+		opts := BatchOptions{MaxStories: 2, ReleaseStory: spec.release}
+
+		got := newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, 3}, "deployed")
+		if got != spec.want {
+			t.Errorf("post(...) with release story %d = %#v; want %#v", spec.release, got, spec.want)
+		}
+		posted := make(map[int]int)
+		for id, cs := range cl.comments {
+			posted[id] = len(cs)
+		}
+		if !reflect.DeepEqual(posted, spec.posted) {
+			t.Errorf("posted = %v; want %v", posted, spec.posted)
+		}
+		if cs := cl.comments[99]; len(cs) == 1 && !strings.HasSuffix(cs[0], "Stories: #1 #2 #3") {
+			t.Errorf("comment = %q; want the list of stories", cs[0])
+		}
+	}
+}
+
+// unresolvableClient is a fakeClient which cannot resolve projects of some stories.
+type unresolvableClient struct {
+	*fakeClient
+	unknown map[int]bool
+	lookups map[int]int
+	posted  map[int]int
+}
+
+func (c unresolvableClient) FindProjectForStory(id int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups[id]++
+	if c.unknown[id] {
+		return 0, fmt.Errorf("bad status code returned by Pivotal: 404 Not Found [404]")
+	}
+	return 1000 + id, nil
+}
+
+func (c unresolvableClient) AddComment(id int, project int, comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posted[id] = project
+	return nil
+}
+
+func TestPostBatchDefaultProject(t *testing.T) {
+	cl := unresolvableClient{
+		fakeClient: newFakeClient(),
+		unknown:    map[int]bool{2: true},
+		lookups:    make(map[int]int),
+		posted:     make(map[int]int),
+	}
+	cache := NewProjectCache()
+	opts := BatchOptions{DefaultProject: 99, Projects: cache}
+	clock := &fakeClock{t: time.Now()}
+
+	got := newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, 3}, "deployed")
+	if want := (Summary{Posted: 3, Resolved: 2, Defaulted: 1}); got != want {
+		t.Errorf("post(...) = %#v; want %#v", got, want)
+	}
+	if want := map[int]int{1: 1001, 2: 99, 3: 1003}; !reflect.DeepEqual(cl.posted, want) {
+		t.Errorf("posted projects = %v; want %v", cl.posted, want)
+	}
+	if got, want := got.String(), "3 posted, 0 skipped, 0 failed (2 resolved, 1 defaulted)"; got != want {
+		t.Errorf("got.String() = %q; want %q", got, want)
+	}
+
+	// resolved projects are cached but unresolved ones are looked up again.
+	got = newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, 3}, "deployed")
+	if want := (Summary{Posted: 3, Resolved: 2, Defaulted: 1}); got != want {
+		t.Errorf("post(...) again = %#v; want %#v", got, want)
+	}
+	if want := map[int]int{1: 1, 2: 2, 3: 1}; !reflect.DeepEqual(cl.lookups, want) {
+		t.Errorf("lookups = %v; want %v", cl.lookups, want)
+	}
+
+	// stories fail without the default project, and nothing is counted.
+	opts.DefaultProject = 0
+	got = newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2}, "deployed")
+	if want := (Summary{Posted: 1, Failed: 1}); got != want {
+		t.Errorf("post(...) without default project = %#v; want %#v", got, want)
+	}
+}
+
+func TestPostStoriesDetails(t *testing.T) {
+	cl := newFakeClient()
+	p := Post{Stories: []int{1, 2}, Comment: "deployed"}
+	p.SetDetail(2, "Commits:\nhttps://github.com/gengo/goship/commit/abc123")
+	sum, rest := PostStories(cl, p, BatchOptions{RequestsPerSecond: 1000})
+	if sum.Posted != 2 || len(rest.Stories) != 0 {
+		t.Fatalf("PostStories(...) = %#v, %#v; want 2 posted", sum, rest)
+	}
+	want := map[int][]string{
+		1: {"deployed"},
+		2: {"deployed\n\nCommits:\nhttps://github.com/gengo/goship/commit/abc123"},
+	}
+	if !reflect.DeepEqual(cl.comments, want) {
+		t.Errorf("comments = %v; want %v", cl.comments, want)
+	}
+	if rest.Details["2"] == "" {
+		t.Errorf("rest.Details = %q; want the details kept for retries", rest.Details)
+	}
+}
+
+func TestTruncateComment(t *testing.T) {
+	for _, spec := range []struct {
+		comment string
+		max     int
+		want    string
+	}{
+		{comment: "deployed", max: 20, want: "deployed"},
+		{comment: "deployed\nhttps://example.com/commit/abc123", max: 30, want: "deployed\n... (truncated)"},
+		{comment: strings.Repeat("あ", 30), max: 20, want: strings.Repeat("あ", 4) + "\n... (truncated)"},
+	} {
+		got := truncateComment(spec.comment, spec.max)
+		if got != spec.want {
+			t.Errorf("truncateComment(%q, %d) = %q; want %q", spec.comment, spec.max, got, spec.want)
+		}
+		if n := len([]rune(got)); n > spec.max {
+			t.Errorf("len(truncateComment(%q, %d)) = %d; want at most %d", spec.comment, spec.max, n, spec.max)
+		}
+	}
+}
@@ -6,14 +6,40 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/golang/glog"
 )
 
 const (
 	pivotalBaseURL = "https://www.pivotaltracker.com/services/v5/"
+	// statusTooManyRequests is the HTTP status code 429, which net/http does not define yet.
+	statusTooManyRequests = 429
+	// defaultRetryAfter is how long to wait after a 429 response without Retry-After.
+	defaultRetryAfter = time.Second
 )
 
+// RateLimitError means Pivotal rejected a request because of its rate limit.
+type RateLimitError struct {
+	// RetryAfter is how long the client should wait before the next request.
+	RetryAfter time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by Pivotal; retry after %s", e.RetryAfter)
+}
+
+// statusError is a response of Pivotal with an unsuccessful status code.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string {
+	return e.msg
+}
+
 // Client is an interface for testability.
 // It provides access to a subset of Pivotal APIs.
 type Client interface {
@@ -23,19 +49,21 @@ type Client interface {
 }
 
 type pivClient struct {
-	token string
+	token   string
+	baseURL string
 }
 
 // NewClient returns a new client of Pivotal APIs.
 // "token" must be a valid Pivotal API access token
 func NewClient(token string) Client {
 	return pivClient{
-		token: token,
+		token:   token,
+		baseURL: pivotalBaseURL,
 	}
 }
 
 func (c pivClient) request(method string, endpoint string, form url.Values) ([]byte, error) {
-	req, err := http.NewRequest(method, pivotalBaseURL+endpoint, nil)
+	req, err := http.NewRequest(method, c.baseURL+endpoint, nil)
 	if err != nil {
 		glog.Errorf("could not form get request to Pivotal: %v", err)
 		return nil, err
@@ -55,15 +83,23 @@ func (c pivClient) request(method string, endpoint string, form url.Values) ([]b
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode == statusTooManyRequests {
+		retryAfter := defaultRetryAfter
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, RateLimitError{RetryAfter: retryAfter}
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		m := fmt.Sprintf("bad status code returned by Pivotal: %s [%d] (%s)", resp.Status, resp.StatusCode, string(b))
 		glog.Error(m)
-		return nil, fmt.Errorf(m)
+		return nil, statusError{code: resp.StatusCode, msg: m}
 	}
 	return b, nil
 }
 
-// FindProjectForStory returns the project id for a Pivotal story
+// FindProjectForStory returns the project id for a Pivotal story.
+// It looks up the story with the global endpoint, which does not need the project.
 func (c pivClient) FindProjectForStory(id int) (int, error) {
 	b, err := c.request("GET", fmt.Sprintf("stories/%d", id), nil)
 	if err != nil {
@@ -0,0 +1,64 @@
+package pivotal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientResolvesProjects(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		comments = make(map[string]string)
+	)
+	projects := map[string]int{"1": 100, "2": 200, "3": 100}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("X-TrackerToken"), "secret"; got != want {
+			t.Errorf("X-TrackerToken = %q; want %q", got, want)
+		}
+		path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == "GET" && len(path) == 2 && path[0] == "stories":
+			p, ok := projects[path[1]]
+			if !ok {
+				http.Error(w, `{"code":"unfound_resource","kind":"error"}`, http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"id":%s,"project_id":%d,"kind":"story"}`, path[1], p)
+		case r.Method == "POST" && len(path) == 5 && path[0] == "projects" && path[4] == "comments":
+			mu.Lock()
+			defer mu.Unlock()
+			comments[path[1]+"/"+path[3]] = r.FormValue("text")
+			fmt.Fprint(w, `{"kind":"comment"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	cl := pivClient{token: "secret", baseURL: srv.URL + "/"}
+
+	for id, want := range map[int]int{1: 100, 2: 200} {
+		if got, err := cl.FindProjectForStory(id); err != nil || got != want {
+			t.Errorf("cl.FindProjectForStory(%d) = %d, %v; want %d", id, got, err, want)
+		}
+	}
+	if got, err := cl.FindProjectForStory(4); err == nil {
+		t.Errorf("cl.FindProjectForStory(4) = %d; want failure", got)
+	}
+
+	opts := BatchOptions{DefaultProject: 999, Projects: NewProjectCache(), RequestsPerSecond: 1e6}
+	clock := &fakeClock{t: time.Now()}
+	got := newBatch(cl, opts, clock.now, clock.sleep).post([]int{1, 2, 3, 4}, "deployed")
+	if want := (Summary{Posted: 4, Resolved: 3, Defaulted: 1}); got != want {
+		t.Errorf("post(...) = %#v; want %#v", got, want)
+	}
+	want := map[string]string{"100/1": "deployed", "200/2": "deployed", "100/3": "deployed", "999/4": "deployed"}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("comments = %v; want %v", comments, want)
+	}
+}
@@ -0,0 +1,253 @@
+package pivotal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+)
+
+const (
+	// outboxPrefix is the etcd directory which contains outbox entries keyed by their IDs.
+	outboxPrefix = "/goship/pivotal/outbox"
+	// OutboxMaxAge is how long failed posts are retried.
+	OutboxMaxAge = 24 * time.Hour
+	// outboxMinBackoff is the interval before the first retry. It doubles on each failure.
+	outboxMinBackoff = time.Minute
+	// outboxMaxBackoff is the maximum interval between retries.
+	outboxMaxBackoff = 2 * time.Hour
+	// outboxClaimTTL is how long an entry is reserved by the instance retrying it.
+	// Other instances retry it after the period if the instance died while retrying.
+	outboxClaimTTL = 5 * time.Minute
+)
+
+// States of outbox entries
+const (
+	// OutboxPending means that the entry will be retried.
+	OutboxPending = "pending"
+	// OutboxFailed means that the entry was given up after OutboxMaxAge. It is retried only manually.
+	OutboxFailed = "failed"
+)
+
+var (
+	// ErrOutboxNotFound means that no outbox entry has the given ID, e.g. it has been delivered.
+	ErrOutboxNotFound = errors.New("no such outbox entry")
+	// ErrOutboxBusy means that the entry is being retried by someone else.
+	ErrOutboxBusy = errors.New("outbox entry is being retried")
+)
+
+// OutboxStore is the subset of etcd.Client which stores the outbox.
+type OutboxStore interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+}
+
+// OutboxEntry is a post of a deployment whose stories failed, which is retried until delivered.
+type OutboxEntry struct {
+	// ID is the ID of the deploy record of the deployment.
+	ID          string `json:"id"`
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Post has the comment and the stories which are not commented yet.
+	Post Post `json:"post"`
+	// Summary is the result of all the attempts so far.
+	Summary Summary `json:"summary"`
+	State   string  `json:"state"`
+	// Attempts is the number of retries so far.
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	Created   time.Time `json:"created"`
+	// NextAttempt is when the entry is retried next time.
+	NextAttempt time.Time `json:"nextAttempt"`
+	// ClaimedUntil is when the instance retrying the entry loses its claim.
+	ClaimedUntil time.Time `json:"claimedUntil"`
+}
+
+// SendFunc posts "p" and returns the summary and "p" with the stories which failed, like PostStories.
+type SendFunc func(p Post) (Summary, Post, error)
+
+// Enqueue stores "e" into the outbox to be retried after a while since "now".
+// The ID of "e" must be unique. The summary of the entry is returned.
+func Enqueue(s OutboxStore, e OutboxEntry, now time.Time) (Summary, error) {
+	e.State, e.Created, e.NextAttempt = OutboxPending, now, now.Add(outboxMinBackoff)
+	e.Summary.Outbox = OutboxPending
+	if err := putOutbox(s, e); err != nil {
+		return e.Summary, err
+	}
+	glog.Infof("Queued %d Pivotal stories of %s for retries", len(e.Post.Stories), e.ID)
+	return e.Summary, nil
+}
+
+// ListOutbox returns all the entries in the outbox ordered by creation.
+func ListOutbox(s OutboxStore) ([]OutboxEntry, error) {
+	resp, err := s.Get(outboxPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []OutboxEntry
+	for _, n := range resp.Node.Nodes {
+		var e OutboxEntry
+		if err := json.Unmarshal([]byte(n.Value), &e); err != nil {
+			glog.Errorf("Skipping malformed outbox entry %s: %v", n.Key, err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Sort(byCreated(entries))
+	return entries, nil
+}
+
+type byCreated []OutboxEntry
+
+func (b byCreated) Len() int           { return len(b) }
+func (b byCreated) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreated) Less(i, j int) bool { return b[i].Created.Before(b[j].Created) }
+
+// RetryDue retries the pending entries whose next attempts are due at "now" with "send".
+// It returns the entries which were retried, with their states after the retries.
+// The state of a delivered entry is empty.
+func RetryDue(s OutboxStore, send SendFunc, now time.Time) ([]OutboxEntry, error) {
+	entries, err := ListOutbox(s)
+	if err != nil {
+		return nil, err
+	}
+	var retried []OutboxEntry
+	for _, e := range entries {
+		if e.State != OutboxPending || e.NextAttempt.After(now) {
+			continue
+		}
+		r, err := Retry(s, e.ID, send, now)
+		if err == ErrOutboxBusy || err == ErrOutboxNotFound {
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Failed to retry outbox entry %s: %v", e.ID, err)
+			continue
+		}
+		retried = append(retried, r)
+	}
+	return retried, nil
+}
+
+// Retry retries the entry "id" with "send" right now regardless of its state, and returns the entry after the retry.
+// The entry is removed from the outbox if all its stories are commented, and its state is empty.
+// It fails with ErrOutboxBusy if the entry is being retried by another caller, so that no comment is posted twice.
+func Retry(s OutboxStore, id string, send SendFunc, now time.Time) (OutboxEntry, error) {
+	e, err := claimOutbox(s, id, now)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	sum, rest, err := send(e.Post)
+	if err != nil {
+		// nothing was posted.
+		rest = e.Post
+	}
+	e.Attempts++
+	e.Post, e.ClaimedUntil = rest, time.Time{}
+	e.Summary.Posted += sum.Posted
+	e.Summary.Resolved += sum.Resolved
+	e.Summary.Defaulted += sum.Defaulted
+	e.Summary.Failed = len(rest.Stories)
+	if err == nil && len(rest.Stories) == 0 {
+		if _, err := s.Delete(outboxKey(id), false); err != nil {
+			return OutboxEntry{}, err
+		}
+		glog.Infof("Delivered outbox entry %s after %d attempts", id, e.Attempts)
+		e.State, e.Summary.Outbox, e.LastError, e.NextAttempt = "", "", "", time.Time{}
+		return e, nil
+	}
+	e.LastError = fmt.Sprintf("%d stories failed", len(rest.Stories))
+	if err != nil {
+		e.LastError = err.Error()
+	}
+	e.NextAttempt = now.Add(outboxBackoff(e.Attempts))
+	if e.NextAttempt.Sub(e.Created) > OutboxMaxAge {
+		glog.Warningf("Giving up outbox entry %s after %d attempts: %s", id, e.Attempts, e.LastError)
+		e.State = OutboxFailed
+	}
+	e.Summary.Outbox = e.State
+	return e, putOutbox(s, e)
+}
+
+// outboxBackoff returns the interval after the "attempts"-th retry.
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxMinBackoff
+	for i := 0; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
+
+// GetOutbox returns the entry "id" in the outbox. It fails with ErrOutboxNotFound if there is no such entry.
+func GetOutbox(s OutboxStore, id string) (OutboxEntry, error) {
+	e, _, err := getOutbox(s, id)
+	return e, err
+}
+
+// getOutbox returns the entry "id" and its modified index.
+func getOutbox(s OutboxStore, id string) (OutboxEntry, uint64, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return OutboxEntry{}, 0, ErrOutboxNotFound
+	}
+	resp, err := s.Get(outboxKey(id), false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return OutboxEntry{}, 0, ErrOutboxNotFound
+	}
+	if err != nil {
+		return OutboxEntry{}, 0, err
+	}
+	var e OutboxEntry
+	if err := json.Unmarshal([]byte(resp.Node.Value), &e); err != nil {
+		return OutboxEntry{}, 0, err
+	}
+	return e, resp.Node.ModifiedIndex, nil
+}
+
+// claimOutbox reserves the entry "id" for a retry at "now" with compare-and-swap.
+func claimOutbox(s OutboxStore, id string, now time.Time) (OutboxEntry, error) {
+	e, index, err := getOutbox(s, id)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	if e.ClaimedUntil.After(now) {
+		return OutboxEntry{}, ErrOutboxBusy
+	}
+	e.ClaimedUntil = now.Add(outboxClaimTTL)
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	_, err = s.CompareAndSwap(outboxKey(id), string(buf), 0, "", index)
+	if etcderr.Is(err, etcderr.TestFailed) || etcderr.IsKeyNotFound(err) {
+		return OutboxEntry{}, ErrOutboxBusy
+	}
+	return e, err
+}
+
+func putOutbox(s OutboxStore, e OutboxEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(outboxKey(e.ID), string(buf), 0)
+	return err
+}
+
+func outboxKey(id string) string {
+	return path.Join(outboxPrefix, id)
+}
@@ -0,0 +1,225 @@
+package pivotal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// mockOutboxStore is an OutboxStore which keeps values in memory with their modified indices.
+type mockOutboxStore struct {
+	values  map[string]string
+	indices map[string]uint64
+	index   uint64
+}
+
+func newMockOutboxStore() *mockOutboxStore {
+	return &mockOutboxStore{values: make(map[string]string), indices: make(map[string]uint64)}
+}
+
+func (s *mockOutboxStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s.values[key]; ok {
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: v, ModifiedIndex: s.indices[key]}}, nil
+	}
+	n := &etcd.Node{Key: key, Dir: true}
+	for k, v := range s.values {
+		if strings.HasPrefix(k, key+"/") {
+			n.Nodes = append(n.Nodes, &etcd.Node{Key: k, Value: v, ModifiedIndex: s.indices[k]})
+		}
+	}
+	if len(n.Nodes) == 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Node: n}, nil
+}
+
+func (s *mockOutboxStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s.index++
+	s.values[key], s.indices[key] = value, s.index
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value, ModifiedIndex: s.index}}, nil
+}
+
+func (s *mockOutboxStore) Delete(key string, recursive bool) (*etcd.Response, error) {
+	if _, ok := s.values[key]; !ok {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	delete(s.values, key)
+	delete(s.indices, key)
+	return &etcd.Response{Node: &etcd.Node{Key: key}}, nil
+}
+
+func (s *mockOutboxStore) CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	if _, ok := s.values[key]; !ok {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	if s.indices[key] != prevIndex {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.TestFailed}
+	}
+	return s.Set(key, value, ttl)
+}
+
+// outageClient is a fakeClient which fails to comment on the stories in "down".
+type outageClient struct {
+	*fakeClient
+	down map[int]bool
+}
+
+func (c outageClient) AddComment(id int, project int, comment string) error {
+	if c.down[id] {
+		return fmt.Errorf("Pivotal is down")
+	}
+	return c.fakeClient.AddComment(id, project, comment)
+}
+
+func (c outageClient) send(p Post) (Summary, Post, error) {
+	clock := &fakeClock{t: time.Now()}
+	sum, failed := newBatch(c, BatchOptions{}, clock.now, clock.sleep).postStories(p.Stories, p.Comment)
+	p.Stories = failed
+	return sum, p, nil
+}
+
+func TestOutboxOutage(t *testing.T) {
+	s := newMockOutboxStore()
+	cl := outageClient{fakeClient: newFakeClient(), down: map[int]bool{2: true, 3: true}}
+	start := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// the deployment during the outage
+	sum, rest, _ := cl.send(Post{Stories: []int{1, 2, 3}, Comment: "deployed"})
+	if want := []int{2, 3}; !reflect.DeepEqual(rest.Stories, want) {
+		t.Fatalf("failed stories = %v; want %v", rest.Stories, want)
+	}
+	sum, err := Enqueue(s, OutboxEntry{ID: "api-staging-1", Project: "api", Environment: "staging", Post: rest, Summary: sum}, start)
+	if err != nil {
+		t.Fatalf("Enqueue(...) failed with %v", err)
+	}
+	if want := (Summary{Posted: 1, Failed: 2, Outbox: OutboxPending}); sum != want {
+		t.Errorf("Enqueue(...) = %#v; want %#v", sum, want)
+	}
+
+	for _, spec := range []struct {
+		after   time.Duration
+		recover bool
+		// want is the retried entries, or nil if none.
+		want []OutboxEntry
+	}{
+		{after: 30 * time.Second},
+		{
+			after: time.Minute,
+			want: []OutboxEntry{{
+				Summary:     Summary{Posted: 1, Failed: 2, Outbox: OutboxPending},
+				State:       OutboxPending,
+				Attempts:    1,
+				NextAttempt: start.Add(3 * time.Minute),
+			}},
+		},
+		{after: 2 * time.Minute, recover: true},
+		{
+			after: 3 * time.Minute,
+			want:  []OutboxEntry{{Summary: Summary{Posted: 3}, Attempts: 2}},
+		},
+		{after: time.Hour},
+	} {
+		if spec.recover {
+			cl.down = nil
+		}
+		got, err := RetryDue(s, cl.send, start.Add(spec.after))
+		if err != nil {
+			t.Fatalf("RetryDue(...) failed with %v", err)
+		}
+		var states []OutboxEntry
+		for _, e := range got {
+			states = append(states, OutboxEntry{Summary: e.Summary, State: e.State, Attempts: e.Attempts, NextAttempt: e.NextAttempt})
+		}
+		if !reflect.DeepEqual(states, spec.want) {
+			t.Errorf("RetryDue(...) after %s retried %#v; want %#v", spec.after, states, spec.want)
+		}
+	}
+	for _, id := range []int{1, 2, 3} {
+		if got, want := cl.comments[id], []string{"deployed"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("comments[%d] = %q; want %q", id, got, want)
+		}
+	}
+	if entries, err := ListOutbox(s); err != nil || len(entries) != 0 {
+		t.Errorf("ListOutbox(s) = %v, %v; want no entries", entries, err)
+	}
+}
+
+func TestOutboxGiveUp(t *testing.T) {
+	s := newMockOutboxStore()
+	cl := outageClient{fakeClient: newFakeClient(), down: map[int]bool{1: true}}
+	start := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := Enqueue(s, OutboxEntry{ID: "api-staging-1", Post: Post{Stories: []int{1}, Comment: "deployed"}, Summary: Summary{Failed: 1}}, start); err != nil {
+		t.Fatalf("Enqueue(...) failed with %v", err)
+	}
+
+	now := start
+	var e OutboxEntry
+	for e.State != OutboxFailed {
+		entries, err := ListOutbox(s)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("ListOutbox(s) = %v, %v; want an entry", entries, err)
+		}
+		now = entries[0].NextAttempt
+		if now.Sub(start) > OutboxMaxAge+outboxMaxBackoff {
+			t.Fatalf("entry is still %s at %s", entries[0].State, now)
+		}
+		retried, err := RetryDue(s, cl.send, now)
+		if err != nil || len(retried) != 1 {
+			t.Fatalf("RetryDue(...) = %v, %v at %s; want a retry", retried, err, now)
+		}
+		e = retried[0]
+	}
+	if e.Summary.Outbox != OutboxFailed || e.LastError == "" {
+		t.Errorf("entry = %#v; want failed with the error", e)
+	}
+	if retried, err := RetryDue(s, cl.send, now.Add(OutboxMaxAge)); err != nil || len(retried) != 0 {
+		t.Errorf("RetryDue(...) = %v, %v after given up; want no retries", retried, err)
+	}
+
+	// retried manually after the recovery
+	cl.down = nil
+	e, err := Retry(s, "api-staging-1", cl.send, now.Add(OutboxMaxAge))
+	if err != nil {
+		t.Fatalf("Retry(...) failed with %v", err)
+	}
+	if want := (Summary{Posted: 1}); e.State != "" || e.Summary != want {
+		t.Errorf("Retry(...) = %#v; want delivered with %#v", e, want)
+	}
+	if _, err := Retry(s, "api-staging-1", cl.send, now.Add(OutboxMaxAge)); err != ErrOutboxNotFound {
+		t.Errorf("Retry(...) of a delivered entry failed with %v; want %v", err, ErrOutboxNotFound)
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	s := newMockOutboxStore()
+	start := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := Enqueue(s, OutboxEntry{ID: "api-staging-1", Post: Post{Stories: []int{1}, Comment: "deployed"}}, start); err != nil {
+		t.Fatalf("Enqueue(...) failed with %v", err)
+	}
+
+	posts := 0
+	var send SendFunc
+	send = func(p Post) (Summary, Post, error) {
+		posts++
+		// another instance tries to retry the same entry meanwhile.
+		if _, err := Retry(s, "api-staging-1", send, start); err != ErrOutboxBusy {
+			t.Errorf("Retry(...) while retrying failed with %v; want %v", err, ErrOutboxBusy)
+		}
+		p.Stories = nil
+		return Summary{Posted: 1}, p, nil
+	}
+	if _, err := Retry(s, "api-staging-1", send, start); err != nil {
+		t.Fatalf("Retry(...) failed with %v", err)
+	}
+	if posts != 1 {
+		t.Errorf("posted %d times; want once", posts)
+	}
+	if _, err := Retry(s, "../config", send, start); err != ErrOutboxNotFound {
+		t.Errorf("Retry(...) with a malformed ID failed with %v; want %v", err, ErrOutboxNotFound)
+	}
+}
@@ -0,0 +1,90 @@
+package pivotal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrStoryNotFound means that a story does not exist, e.g. it has been deleted.
+var ErrStoryNotFound = errors.New("story not found")
+
+// StoryNamer looks up names of stories.
+type StoryNamer interface {
+	StoryName(id int) (string, error)
+}
+
+// NewStoryNamer returns a new StoryNamer with Pivotal APIs.
+// "token" must be a valid Pivotal API access token
+func NewStoryNamer(token string) StoryNamer {
+	return pivClient{
+		token:   token,
+		baseURL: pivotalBaseURL,
+	}
+}
+
+// StoryName returns the name of a story. It fails with ErrStoryNotFound if the story does not exist.
+func (c pivClient) StoryName(id int) (string, error) {
+	b, err := c.request("GET", fmt.Sprintf("stories/%d", id), nil)
+	if e, ok := err.(statusError); ok && e.code == http.StatusNotFound {
+		return "", ErrStoryNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	var s struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", err
+	}
+	return s.Name, nil
+}
+
+// NameCache remembers names of stories for a while, since they are rarely renamed.
+// Stories not found are remembered too.
+type NameCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	names map[int]cachedName
+}
+
+type cachedName struct {
+	name string
+	// found is false if the story did not exist.
+	found     bool
+	fetchedAt time.Time
+}
+
+// NewNameCache returns a new empty NameCache which keeps names for "ttl".
+func NewNameCache(ttl time.Duration) *NameCache {
+	return &NameCache{ttl: ttl, now: time.Now, names: make(map[int]cachedName)}
+}
+
+// StoryName returns the name of the story "id" from the cache, or looks it up with "n" if not cached or expired.
+// It fails with ErrStoryNotFound if the story does not exist. Other failures are not cached.
+func (c *NameCache) StoryName(n StoryNamer, id int) (string, error) {
+	now := c.now()
+	c.mu.Lock()
+	cached, ok := c.names[id]
+	c.mu.Unlock()
+	if !ok || now.Sub(cached.fetchedAt) >= c.ttl {
+		name, err := n.StoryName(id)
+		if err != nil && err != ErrStoryNotFound {
+			return "", err
+		}
+		cached = cachedName{name: name, found: err == nil, fetchedAt: now}
+		c.mu.Lock()
+		c.names[id] = cached
+		c.mu.Unlock()
+	}
+	if !cached.found {
+		return "", ErrStoryNotFound
+	}
+	return cached.name, nil
+}
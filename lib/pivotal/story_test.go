@@ -0,0 +1,90 @@
+package pivotal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoryName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stories/1":
+			fmt.Fprint(w, `{"id":1,"name":"Sign in with Google","kind":"story"}`)
+		case "/stories/2":
+			http.Error(w, `{"code":"unfound_resource","kind":"error"}`, http.StatusNotFound)
+		default:
+			http.Error(w, `{"code":"unauthorized","kind":"error"}`, http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+	cl := pivClient{token: "secret", baseURL: srv.URL + "/"}
+
+	if got, err := cl.StoryName(1); err != nil || got != "Sign in with Google" {
+		t.Errorf("cl.StoryName(1) = %q, %v; want %q", got, err, "Sign in with Google")
+	}
+	if got, err := cl.StoryName(2); err != ErrStoryNotFound {
+		t.Errorf("cl.StoryName(2) = %q, %v; want %v", got, err, ErrStoryNotFound)
+	}
+	if got, err := cl.StoryName(3); err == nil || err == ErrStoryNotFound {
+		t.Errorf("cl.StoryName(3) = %q, %v; want a failure other than %v", got, err, ErrStoryNotFound)
+	}
+}
+
+// countingNamer names stories "Story <id>" and counts the lookups.
+type countingNamer struct {
+	calls   map[int]int
+	deleted map[int]bool
+	fail    bool
+}
+
+func (n *countingNamer) StoryName(id int) (string, error) {
+	n.calls[id]++
+	switch {
+	case n.fail:
+		return "", errors.New("unavailable")
+	case n.deleted[id]:
+		return "", ErrStoryNotFound
+	}
+	return fmt.Sprintf("Story %d", id), nil
+}
+
+func TestNameCache(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)}
+	c := NewNameCache(time.Hour)
+	c.now = clock.now
+	n := &countingNamer{calls: make(map[int]int), deleted: map[int]bool{2: true}}
+
+	for i := 0; i < 2; i++ {
+		if got, err := c.StoryName(n, 1); err != nil || got != "Story 1" {
+			t.Errorf("c.StoryName(n, 1) = %q, %v; want %q", got, err, "Story 1")
+		}
+		if _, err := c.StoryName(n, 2); err != ErrStoryNotFound {
+			t.Errorf("c.StoryName(n, 2) failed with %v; want %v", err, ErrStoryNotFound)
+		}
+	}
+	if n.calls[1] != 1 || n.calls[2] != 1 {
+		t.Errorf("calls = %v; want a lookup per story", n.calls)
+	}
+
+	// failures are not cached
+	n.fail = true
+	if _, err := c.StoryName(n, 3); err == nil || strings.Contains(err.Error(), "not found") {
+		t.Errorf("c.StoryName(n, 3) failed with %v; want unavailable", err)
+	}
+	n.fail = false
+	if got, err := c.StoryName(n, 3); err != nil || got != "Story 3" || n.calls[3] != 2 {
+		t.Errorf("c.StoryName(n, 3) = %q, %v after %d calls; want %q looked up again", got, err, n.calls[3], "Story 3")
+	}
+
+	// expired
+	clock.t = clock.t.Add(time.Hour)
+	n.deleted = nil
+	if got, err := c.StoryName(n, 2); err != nil || got != "Story 2" || n.calls[2] != 2 {
+		t.Errorf("c.StoryName(n, 2) = %q, %v after %d calls; want %q looked up again", got, err, n.calls[2], "Story 2")
+	}
+}
@@ -0,0 +1,25 @@
+package pivotal
+
+import "net/http"
+
+// testPrefix is prepended to test comments.
+const testPrefix = "[TEST] "
+
+// PostTest comments "comment" prefixed with "[TEST]" on the story "id" with "cl", e.g. to try a token out.
+// It returns the comment as posted and the HTTP status of Pivotal, which is zero if Pivotal could not be reached.
+func PostTest(cl Client, id int, comment string) (string, int, error) {
+	comment = testPrefix + comment
+	project, err := cl.FindProjectForStory(id)
+	if err == nil {
+		err = cl.AddComment(id, project, comment)
+	}
+	switch e := err.(type) {
+	case nil:
+		return comment, http.StatusOK, nil
+	case statusError:
+		return comment, e.code, err
+	case RateLimitError:
+		return comment, statusTooManyRequests, err
+	}
+	return comment, 0, err
+}
@@ -0,0 +1,47 @@
+package pivotal
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// rejectingClient is a Client which resolves stories but rejects comments with "err".
+type rejectingClient struct {
+	*fakeClient
+	err error
+}
+
+func (c rejectingClient) AddComment(id int, project int, comment string) error {
+	return c.err
+}
+
+func TestPostTest(t *testing.T) {
+	cl := newFakeClient()
+	comment, status, err := PostTest(cl, 42, "Deployed api to staging by alice")
+	if err != nil {
+		t.Fatalf("PostTest(cl, 42, comment) failed with %v", err)
+	}
+	want := "[TEST] Deployed api to staging by alice"
+	if comment != want || status != http.StatusOK {
+		t.Errorf("PostTest(cl, 42, comment) = %q, %d; want %q, %d", comment, status, want, http.StatusOK)
+	}
+	if got := cl.comments[42]; len(got) != 1 || got[0] != want {
+		t.Errorf("comments on 42 = %q; want %q", got, want)
+	}
+
+	for _, spec := range []struct {
+		err    error
+		status int
+	}{
+		{err: statusError{code: http.StatusForbidden, msg: "forbidden"}, status: http.StatusForbidden},
+		{err: RateLimitError{}, status: statusTooManyRequests},
+		{err: errors.New("connection refused"), status: 0},
+	} {
+		cl := rejectingClient{fakeClient: newFakeClient(), err: spec.err}
+		comment, status, err := PostTest(cl, 42, "Deployed")
+		if err != spec.err || status != spec.status || comment != "[TEST] Deployed" {
+			t.Errorf("PostTest(cl, 42, comment) = %q, %d, %v; want status %d with %v", comment, status, err, spec.status, spec.err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package preferences stores per-user preferences of goship users.
+package preferences
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains preferences of users.
+	keyPrefix = "/goship/users"
+)
+
+// Preferences is a set of preferences of a user.
+type Preferences struct {
+	// Favorites are names of the projects starred by the user.
+	// Names of projects which no longer exist are ignored.
+	Favorites []string `json:"favorites"`
+	// HostSort is the order of hosts in environments. See the "sort" parameter of /commits.
+	HostSort string `json:"host_sort,omitempty"`
+}
+
+func key(user string) (string, error) {
+	if user == "" || user == "." || user == ".." || strings.Contains(user, "/") {
+		return "", fmt.Errorf("invalid user name %q", user)
+	}
+	return path.Join(keyPrefix, user, "preferences"), nil
+}
+
+// Load returns preferences of "user" stored in etcd.
+// It returns empty preferences if the user has not stored any.
+func Load(client config.ETCDInterface, user string) (Preferences, error) {
+	k, err := key(user)
+	if err != nil {
+		return Preferences{}, err
+	}
+	resp, err := client.Get(k, false, false)
+	if err != nil {
+		if etcderr.IsKeyNotFound(err) {
+			return Preferences{}, nil
+		}
+		return Preferences{}, err
+	}
+	var p Preferences
+	if err := json.Unmarshal([]byte(resp.Node.Value), &p); err != nil {
+		return Preferences{}, err
+	}
+	return p, nil
+}
+
+// Save stores "p" as preferences of "user" into etcd.
+func Save(client config.ETCDInterface, user string, p Preferences) error {
+	k, err := key(user)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(k, string(buf), 0)
+	return err
+}
+
+// IsFavorite returns true iff the user has starred the project "name".
+func (p Preferences) IsFavorite(name string) bool {
+	for _, f := range p.Favorites {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterFavorites returns only the projects starred by the user.
+func (p Preferences) FilterFavorites(projs []config.Project) []config.Project {
+	var favs []config.Project
+	for _, proj := range projs {
+		if p.IsFavorite(proj.Name) {
+			favs = append(favs, proj)
+		}
+	}
+	return favs
+}
+
+// Listing returns "projs" as listed to the user, i.e. sorted with the projects starred by the user first.
+// It returns only the starred projects if "mine" is true, as "?mine=true" asks. "projs" is left as it is.
+func (p Preferences) Listing(projs []config.Project, mine bool) []config.Project {
+	if mine {
+		projs = p.FilterFavorites(projs)
+	} else {
+		projs = append([]config.Project(nil), projs...)
+	}
+	p.SortProjects(projs)
+	return projs
+}
+
+// SortProjects sorts "projs" by name, with the projects starred by the user first.
+func (p Preferences) SortProjects(projs []config.Project) {
+	sort.Sort(byFavorite{prefs: p, projs: projs})
+}
+
+type byFavorite struct {
+	prefs Preferences
+	projs []config.Project
+}
+
+func (s byFavorite) Len() int      { return len(s.projs) }
+func (s byFavorite) Swap(i, j int) { s.projs[i], s.projs[j] = s.projs[j], s.projs[i] }
+func (s byFavorite) Less(i, j int) bool {
+	fi, fj := s.prefs.IsFavorite(s.projs[i].Name), s.prefs.IsFavorite(s.projs[j].Name)
+	if fi != fj {
+		return fi
+	}
+	return s.projs[i].Name < s.projs[j].Name
+}
@@ -0,0 +1,78 @@
+package preferences
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+type mockStore map[string]string
+
+func (s mockStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	v, ok := s[key]
+	if !ok {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Action: "get", Node: &etcd.Node{Key: key, Value: v}}, nil
+}
+
+func (s mockStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s[key] = value
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func TestPersistence(t *testing.T) {
+	s := make(mockStore)
+	got, err := Load(s, "alice")
+	if err != nil {
+		t.Fatalf("Load(s, %q) failed with %v; want success", "alice", err)
+	}
+	if want := (Preferences{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load(s, %q) = %#v; want %#v", "alice", got, want)
+	}
+
+	p := Preferences{Favorites: []string{"api", "worker"}}
+	if err := Save(s, "alice", p); err != nil {
+		t.Fatalf("Save(s, %q, %#v) failed with %v; want success", "alice", p, err)
+	}
+	if got, err = Load(s, "alice"); err != nil {
+		t.Fatalf("Load(s, %q) failed with %v; want success", "alice", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Load(s, %q) = %#v; want %#v", "alice", got, p)
+	}
+	if got, err = Load(s, "bob"); err != nil || len(got.Favorites) != 0 {
+		t.Errorf("Load(s, %q) = %#v, %v; want empty preferences", "bob", got, err)
+	}
+
+	for _, user := range []string{"", "..", "../config"} {
+		if err := Save(s, user, p); err == nil {
+			t.Errorf("Save(s, %q, %#v) succeeded; want failure", user, p)
+		}
+	}
+}
+
+func names(projs []config.Project) []string {
+	var ns []string
+	for _, p := range projs {
+		ns = append(ns, p.Name)
+	}
+	return ns
+}
+
+func TestSortProjects(t *testing.T) {
+	projs := []config.Project{{Name: "db"}, {Name: "worker"}, {Name: "api"}, {Name: "web"}}
+	// "renamed" no longer exists and is ignored
+	p := Preferences{Favorites: []string{"worker", "renamed", "db"}}
+
+	p.SortProjects(projs)
+	if got, want := names(projs), []string{"db", "worker", "api", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("projects = %q; want %q", got, want)
+	}
+	if got, want := names(p.FilterFavorites(projs)), []string{"db", "worker"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("p.FilterFavorites(...) = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+// Package preflight checks that hosts are healthy before deployments into them.
+package preflight
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/ssh"
+	"golang.org/x/net/context"
+)
+
+// Checker checks that a host is ready for a deployment.
+type Checker interface {
+	// Check returns an error describing why "host" is not ready, or nil if it is ready.
+	Check(ctx context.Context, host string) error
+}
+
+// CheckerFunc is a function which implements Checker.
+type CheckerFunc func(ctx context.Context, host string) error
+
+// Check implements Checker.
+func (f CheckerFunc) Check(ctx context.Context, host string) error {
+	return f(ctx, host)
+}
+
+// Failure is a host which failed the checks.
+type Failure struct {
+	Host   string `json:"host"`
+	Reason string `json:"reason"`
+}
+
+// Run checks all the "hosts" with "checkers" concurrently, and returns the hosts which failed in the order of "hosts".
+// The checkers of each host run in order until one fails. Hosts whose checks do not finish within "budget" fail.
+func Run(ctx context.Context, hosts []string, checkers []Checker, budget time.Duration) []Failure {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	type result struct {
+		i   int
+		err error
+	}
+	// buffered so that checks finishing after the budget do not block.
+	results := make(chan result, len(hosts))
+	for i, host := range hosts {
+		go func(i int, host string) {
+			for _, c := range checkers {
+				if err := c.Check(ctx, host); err != nil {
+					results <- result{i: i, err: err}
+					return
+				}
+			}
+			results <- result{i: i}
+		}(i, host)
+	}
+
+	errs := make([]error, len(hosts))
+	done := make([]bool, len(hosts))
+wait:
+	for n := 0; n < len(hosts); n++ {
+		select {
+		case r := <-results:
+			errs[r.i], done[r.i] = r.err, true
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	var failures []Failure
+	for i, host := range hosts {
+		switch {
+		case !done[i]:
+			failures = append(failures, Failure{Host: host, Reason: fmt.Sprintf("not checked within %s", budget)})
+		case errs[i] != nil:
+			failures = append(failures, Failure{Host: host, Reason: errs[i].Error()})
+		}
+	}
+	return failures
+}
+
+// Runner runs commands in hosts, e.g. ssh.SSH.
+type Runner interface {
+	Output(ctx context.Context, host, cmd string) ([]byte, error)
+}
+
+// Reachable returns a Checker which checks that hosts accept commands with "r".
+func Reachable(r Runner) Checker {
+	return CheckerFunc(func(ctx context.Context, host string) error {
+		if _, err := r.Output(ctx, host, "true"); err != nil {
+			return fmt.Errorf("unreachable: %v", err)
+		}
+		return nil
+	})
+}
+
+// FreeDisk returns a Checker which checks that the file system of "path" in hosts has at least "minMB" megabytes free.
+func FreeDisk(r Runner, path string, minMB int) Checker {
+	return CheckerFunc(func(ctx context.Context, host string) error {
+		out, err := r.Output(ctx, host, fmt.Sprintf("df -Pk %s", ssh.Quote(path)))
+		if err != nil {
+			return fmt.Errorf("failed to check disk space of %s: %v", path, err)
+		}
+		free, err := parseDFAvailable(string(out))
+		if err != nil {
+			return fmt.Errorf("failed to check disk space of %s: %v", path, err)
+		}
+		if free < int64(minMB)*1024 {
+			return fmt.Errorf("%d MB free in %s; want at least %d MB", free/1024, path, minMB)
+		}
+		return nil
+	})
+}
+
+// parseDFAvailable returns the available kilobytes in the output of "df -Pk".
+func parseDFAvailable(out string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected output of df: %q", out)
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected output of df: %q", out)
+	}
+	return strconv.ParseInt(fields[3], 10, 64)
+}
+
+// Health returns a Checker which checks that the health URL of "c" responds with 200 for hosts.
+func Health(client *http.Client, c config.PreflightConfiguration) Checker {
+	return CheckerFunc(func(ctx context.Context, host string) error {
+		u, err := c.HealthURLFor(host)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return err
+		}
+		req.Cancel = ctx.Done()
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("health check failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("health check %s responded %s", u, resp.Status)
+		}
+		return nil
+	})
+}
+
+// ForEnvironment returns the checkers configured for "env", which run commands in hosts with "r".
+// It returns nil if the preflight checks are not configured.
+func ForEnvironment(env config.Environment, r Runner, client *http.Client) []Checker {
+	c := env.Preflight
+	if c == nil {
+		return nil
+	}
+	checkers := []Checker{Reachable(r)}
+	if c.MinFreeDiskMB > 0 {
+		checkers = append(checkers, FreeDisk(r, c.Disk(), c.MinFreeDiskMB))
+	}
+	if c.HealthURL != "" {
+		checkers = append(checkers, Health(client, *c))
+	}
+	return checkers
+}
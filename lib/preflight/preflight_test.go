@@ -0,0 +1,65 @@
+package preflight
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRun(t *testing.T) {
+	var calls []string
+	failing := CheckerFunc(func(ctx context.Context, host string) error {
+		if host == "web2" {
+			return errors.New("disk full")
+		}
+		return nil
+	})
+	second := CheckerFunc(func(ctx context.Context, host string) error {
+		if host == "web2" {
+			calls = append(calls, host)
+		}
+		return nil
+	})
+	got := Run(context.Background(), []string{"web1", "web2", "web3"}, []Checker{failing, second}, time.Second)
+	want := []Failure{{Host: "web2", Reason: "disk full"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run(ctx, hosts, checkers, budget) = %#v; want %#v", got, want)
+	}
+	if len(calls) != 0 {
+		t.Errorf("checkers after a failure ran for %q; want none", calls)
+	}
+}
+
+func TestRunBudget(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := CheckerFunc(func(ctx context.Context, host string) error {
+		if host == "slow" {
+			// ignores the cancellation to simulate a hung check.
+			<-release
+		}
+		return nil
+	})
+	start := time.Now()
+	got := Run(context.Background(), []string{"fast", "slow"}, []Checker{slow}, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run(ctx, hosts, checkers, 50ms) took %s; want it bounded by the budget", elapsed)
+	}
+	want := []Failure{{Host: "slow", Reason: "not checked within 50ms"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run(ctx, hosts, checkers, 50ms) = %#v; want %#v", got, want)
+	}
+}
+
+func TestParseDFAvailable(t *testing.T) {
+	out := "Filesystem     1024-blocks    Used Available Capacity Mounted on\n/dev/xvda1        8123812 6012344   1692220      79% /\n"
+	if got, err := parseDFAvailable(out); err != nil || got != 1692220 {
+		t.Errorf("parseDFAvailable(%q) = %d, %v; want %d", out, got, err, 1692220)
+	}
+	if _, err := parseDFAvailable("df: /nonexistent: No such file or directory"); err == nil {
+		t.Errorf("parseDFAvailable(error) succeeded; want failure")
+	}
+}
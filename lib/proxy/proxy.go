@@ -0,0 +1,203 @@
+// Package proxy serves goship behind reverse proxies, under a URL path prefix and with the addresses and
+// the schemes of clients forwarded by trusted proxies.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PeerHeader carries the address of the peer which sent a request to Forwarded, i.e. the nearest proxy.
+const PeerHeader = "X-Goship-Peer"
+
+var basePath string
+
+// SetBasePath sets the path prefix which goship is served under, e.g. "/goship" for https://tools.example.com/goship/.
+// "" or "/" serves goship at the root. It must be called before serving requests.
+func SetBasePath(p string) error {
+	p = strings.TrimSuffix(p, "/")
+	if p != "" && !validBasePath(p) {
+		return fmt.Errorf("invalid base path %q", p)
+	}
+	basePath = p
+	return nil
+}
+
+// validBasePath returns true if "p" is an absolute path of unreserved characters without empty, "." or ".." segments,
+// so that it can be embedded into pages and redirects without escaping.
+func validBasePath(p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+	for _, seg := range strings.Split(p[1:], "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+		for _, c := range seg {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("-._~", c)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BasePath returns the path prefix set by SetBasePath without trailing slashes, or "" at the root.
+func BasePath() string {
+	return basePath
+}
+
+// Path returns the path "p" of goship, which starts with "/", under the base path.
+// i.e. Path("/deployLog/api-production") is "/goship/deployLog/api-production" under "/goship".
+func Path(p string) string {
+	return basePath + p
+}
+
+// URL returns the absolute URL of the path "p" of goship as seen by the client of "r".
+func URL(r *http.Request, p string) *url.URL {
+	return &url.URL{Scheme: Scheme(r), Host: r.Host, Path: Path(p)}
+}
+
+// StripBasePath serves requests under the base path with "h", with the base path removed from their paths.
+// The base path itself is redirected to the one with a trailing slash, and requests outside of it are not found.
+func StripBasePath(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basePath == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == basePath {
+			target := basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.Path, basePath)
+		r2.URL = &u
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// Networks are ranges of IP addresses.
+type Networks []*net.IPNet
+
+// ParseNetworks parses "specs", which are CIDRs or IP addresses.
+func ParseNetworks(specs []string) (Networks, error) {
+	var ns Networks
+	for _, s := range specs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ns = append(ns, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %v", s, err)
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
+
+// Contains returns true iff "addr", an IP address optionally in the form of "host:port", is in the ranges of "ns".
+func (ns Networks) Contains(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range ns {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forwarded serves requests with "h", taking the addresses and the schemes of the clients from X-Forwarded-For and
+// X-Forwarded-Proto of requests from "trusted" proxies. X-Forwarded-For is followed from the right only while the addresses
+// are trusted, so that the client address is the nearest one which is not a trusted proxy and cannot be spoofed by clients.
+// The headers of requests from other peers are removed, so that handlers can rely on them.
+// The address of the peer is kept in PeerHeader.
+func Forwarded(trusted Networks, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := r.RemoteAddr
+		r.Header.Set(PeerHeader, peer)
+		if !trusted.Contains(peer) {
+			r.Header.Del("X-Forwarded-For")
+			r.Header.Del("X-Forwarded-Proto")
+			h.ServeHTTP(w, r)
+			return
+		}
+		r.RemoteAddr = clientAddr(trusted, peer, r.Header["X-Forwarded-For"])
+		switch proto := strings.ToLower(strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0])); proto {
+		case "http", "https":
+			r.Header.Set("X-Forwarded-Proto", proto)
+		default:
+			r.Header.Del("X-Forwarded-Proto")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// clientAddr returns the nearest address to "peer" in "forwardedFor" which is not in "trusted".
+// It stops at malformed addresses, which trusted proxies never append.
+func clientAddr(trusted Networks, peer string, forwardedFor []string) string {
+	var hops []string
+	for _, v := range forwardedFor {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	addr := peer
+	for i := len(hops) - 1; i >= 0 && trusted.Contains(addr); i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		addr = hops[i]
+	}
+	return addr
+}
+
+// Peer returns the address of the peer which sent "r", i.e. the nearest proxy if "r" was forwarded.
+func Peer(r *http.Request) string {
+	if p := r.Header.Get(PeerHeader); p != "" {
+		return p
+	}
+	return r.RemoteAddr
+}
+
+// Scheme returns the scheme which the client of "r" requested with, i.e. "http" or "https".
+func Scheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
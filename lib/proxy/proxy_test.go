@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withBasePath runs "f" with the base path set to "p".
+func withBasePath(t *testing.T, p string, f func()) {
+	if err := SetBasePath(p); err != nil {
+		t.Fatalf("SetBasePath(%q) failed with %v", p, err)
+	}
+	defer SetBasePath("")
+	f()
+}
+
+func TestSetBasePath(t *testing.T) {
+	for _, spec := range []struct {
+		path string
+		want string
+	}{
+		{path: "", want: ""},
+		{path: "/", want: ""},
+		{path: "/goship", want: "/goship"},
+		{path: "/goship/", want: "/goship"},
+		{path: "/tools/goship-1.0", want: "/tools/goship-1.0"},
+	} {
+		withBasePath(t, spec.path, func() {
+			if got := BasePath(); got != spec.want {
+				t.Errorf("BasePath() = %q after SetBasePath(%q); want %q", got, spec.path, spec.want)
+			}
+		})
+	}
+	for _, path := range []string{"goship", "//goship", "/goship//", "/a/../b", "/go ship", `/"><script>`, "/%2e"} {
+		if err := SetBasePath(path); err == nil {
+			t.Errorf("SetBasePath(%q) succeeded; want failure", path)
+		}
+		if got := BasePath(); got != "" {
+			t.Errorf("BasePath() = %q after SetBasePath(%q) failed; want it unchanged", got, path)
+		}
+	}
+}
+
+func TestStripBasePath(t *testing.T) {
+	h := StripBasePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	withBasePath(t, "/goship", func() {
+		for _, spec := range []struct {
+			url      string
+			code     int
+			body     string
+			location string
+		}{
+			{url: "/goship/", code: http.StatusOK, body: "/"},
+			{url: "/goship/api/v1/status?ephemeral=true", code: http.StatusOK, body: "/api/v1/status"},
+			{url: "/goship/web_push", code: http.StatusOK, body: "/web_push"},
+			{url: "/goship", code: http.StatusMovedPermanently, location: "/goship/"},
+			{url: "/goship?token=x", code: http.StatusMovedPermanently, location: "/goship/?token=x"},
+			// outside of the base path
+			{url: "/", code: http.StatusNotFound},
+			{url: "/api/v1/status", code: http.StatusNotFound},
+			{url: "/goshipper/", code: http.StatusNotFound},
+		} {
+			req, _ := http.NewRequest("GET", "http://tools.example.com"+spec.url, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != spec.code {
+				t.Errorf("w.Code = %d for %s; want %d", w.Code, spec.url, spec.code)
+				continue
+			}
+			if spec.body != "" && w.Body.String() != spec.body {
+				t.Errorf("path = %q for %s; want %q", w.Body.String(), spec.url, spec.body)
+			}
+			if got := w.HeaderMap.Get("Location"); got != spec.location {
+				t.Errorf("Location = %q for %s; want %q", got, spec.url, spec.location)
+			}
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "http://tools.example.com/api/v1/status", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "/api/v1/status" {
+		t.Errorf("response = %d %q without base path; want %d %q", w.Code, w.Body.String(), http.StatusOK, "/api/v1/status")
+	}
+}
+
+func TestURL(t *testing.T) {
+	withBasePath(t, "/goship", func() {
+		if got, want := Path("/deployLog/api-production"), "/goship/deployLog/api-production"; got != want {
+			t.Errorf("Path(%q) = %q; want %q", "/deployLog/api-production", got, want)
+		}
+		req, _ := http.NewRequest("GET", "http://tools.example.com/goship/", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		if got, want := URL(req, "/web_push").String(), "https://tools.example.com/goship/web_push"; got != want {
+			t.Errorf("URL(req, %q) = %q; want %q", "/web_push", got, want)
+		}
+	})
+}
+
+func TestForwarded(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseNetworks(...) failed with %v", err)
+	}
+	for _, spec := range []struct {
+		remoteAddr   string
+		forwardedFor []string
+		proto        string
+		tls          bool
+
+		wantAddr   string
+		wantScheme string
+	}{
+		// direct
+		{remoteAddr: "203.0.113.5:4321", wantAddr: "203.0.113.5:4321", wantScheme: "http"},
+		{remoteAddr: "203.0.113.5:4321", tls: true, wantAddr: "203.0.113.5:4321", wantScheme: "https"},
+		// spoofed by untrusted clients
+		{remoteAddr: "203.0.113.5:4321", forwardedFor: []string{"10.0.0.1"}, proto: "https", wantAddr: "203.0.113.5:4321", wantScheme: "http"},
+		// through a trusted proxy
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"203.0.113.5"}, proto: "https", wantAddr: "203.0.113.5", wantScheme: "https"},
+		{remoteAddr: "[fd00::2]:80", forwardedFor: []string{"2001:db8::5"}, proto: "HTTP", wantAddr: "2001:db8::5", wantScheme: "http"},
+		{remoteAddr: "10.0.0.2:80", proto: "https, http", wantAddr: "10.0.0.2:80", wantScheme: "https"},
+		{remoteAddr: "10.0.0.2:80", proto: "gopher", wantAddr: "10.0.0.2:80", wantScheme: "http"},
+		// through a chain of trusted proxies
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"203.0.113.5, 192.168.1.10"}, wantAddr: "203.0.113.5", wantScheme: "http"},
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"203.0.113.5", "192.168.1.10"}, wantAddr: "203.0.113.5", wantScheme: "http"},
+		// the client prepended a spoofed address, which the trusted proxy does not vouch for
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"10.9.9.9, 198.51.100.7, 203.0.113.5"}, wantAddr: "203.0.113.5", wantScheme: "http"},
+		// only proxies
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"10.0.0.3"}, wantAddr: "10.0.0.3", wantScheme: "http"},
+		// malformed
+		{remoteAddr: "10.0.0.2:80", forwardedFor: []string{"203.0.113.5, unknown"}, wantAddr: "10.0.0.2:80", wantScheme: "http"},
+	} {
+		var gotAddr, gotScheme, gotPeer string
+		h := Forwarded(trusted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotAddr, gotScheme, gotPeer = r.RemoteAddr, Scheme(r), Peer(r)
+		}))
+		req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+		req.RemoteAddr = spec.remoteAddr
+		for _, v := range spec.forwardedFor {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if spec.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", spec.proto)
+		}
+		if spec.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if gotAddr != spec.wantAddr {
+			t.Errorf("r.RemoteAddr = %q from %q with %q; want %q", gotAddr, spec.remoteAddr, spec.forwardedFor, spec.wantAddr)
+		}
+		if gotScheme != spec.wantScheme {
+			t.Errorf("Scheme(r) = %q from %q with %q; want %q", gotScheme, spec.remoteAddr, spec.proto, spec.wantScheme)
+		}
+		if gotPeer != spec.remoteAddr {
+			t.Errorf("Peer(r) = %q; want %q", gotPeer, spec.remoteAddr)
+		}
+	}
+}
+
+func TestForwardedOverwritesPeerHeader(t *testing.T) {
+	var got string
+	h := Forwarded(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Peer(r)
+	}))
+	req, _ := http.NewRequest("GET", "http://goship.example/", nil)
+	req.RemoteAddr = "203.0.113.5:4321"
+	req.Header.Set(PeerHeader, "10.0.0.2:80")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "203.0.113.5:4321" {
+		t.Errorf("Peer(r) = %q; want %q", got, "203.0.113.5:4321")
+	}
+}
+
+func TestParseNetworksFailure(t *testing.T) {
+	for _, specs := range [][]string{{"10.0.0.0/33"}, {"proxy.example"}, {"10.0.0.1", ""}} {
+		if _, err := ParseNetworks(specs); err == nil {
+			t.Errorf("ParseNetworks(%q) succeeded; want failure", specs)
+		}
+	}
+}
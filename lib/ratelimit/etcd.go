@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// etcdKeyPrefix is the etcd directory which contains buckets.
+	etcdKeyPrefix = "/goship/ratelimit"
+	// etcdTTL is the TTL of buckets in seconds. Expired buckets are as good as full ones.
+	etcdTTL = 3600
+	// maxRetries is the maximum number of retries of conflicting updates.
+	maxRetries = 10
+)
+
+// ETCDClient is the subset of etcd APIs which EtcdStore depends on.
+type ETCDClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Create(key, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+}
+
+// EtcdStore is a Store in etcd, which is shared among goship instances.
+type EtcdStore struct {
+	client ETCDClient
+}
+
+// NewEtcdStore returns a new EtcdStore.
+func NewEtcdStore(client ETCDClient) EtcdStore {
+	return EtcdStore{client: client}
+}
+
+// Update implements Store with compare-and-swap.
+func (s EtcdStore) Update(key string, f func(b Bucket) Bucket) (Bucket, error) {
+	k := path.Join(etcdKeyPrefix, key)
+	for i := 0; i < maxRetries; i++ {
+		var (
+			b     Bucket
+			index uint64
+		)
+		resp, err := s.client.Get(k, false, false)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal([]byte(resp.Node.Value), &b); err != nil {
+				return Bucket{}, err
+			}
+			index = resp.Node.ModifiedIndex
+		case etcderr.IsKeyNotFound(err):
+		default:
+			return Bucket{}, err
+		}
+
+		b = f(b)
+		buf, err := json.Marshal(b)
+		if err != nil {
+			return Bucket{}, err
+		}
+		if index == 0 {
+			_, err = s.client.Create(k, string(buf), etcdTTL)
+		} else {
+			_, err = s.client.CompareAndSwap(k, string(buf), etcdTTL, "", index)
+		}
+		if err == nil {
+			return b, nil
+		}
+		if !etcderr.Is(err, etcderr.TestFailed) && !etcderr.Is(err, etcderr.NodeExist) && !etcderr.IsKeyNotFound(err) {
+			return Bucket{}, err
+		}
+		// another instance has updated the bucket. retry.
+	}
+	return Bucket{}, fmt.Errorf("too many conflicts on updating %s", k)
+}
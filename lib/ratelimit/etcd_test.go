@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+type mockEtcd struct {
+	value string
+	index uint64
+	// conflicts is the number of CompareAndSwaps to fail as if another instance had updated the key.
+	conflicts int
+}
+
+func (m *mockEtcd) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if m.index == 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: m.value, ModifiedIndex: m.index}}, nil
+}
+
+func (m *mockEtcd) Create(key, value string, ttl uint64) (*etcd.Response, error) {
+	if m.index != 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.NodeExist}
+	}
+	m.value, m.index = value, 1
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value, ModifiedIndex: m.index}}, nil
+}
+
+func (m *mockEtcd) CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	if m.conflicts > 0 {
+		m.conflicts--
+		m.index++
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.TestFailed}
+	}
+	if prevIndex != m.index {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.TestFailed}
+	}
+	m.value = value
+	m.index++
+	return &etcd.Response{Node: &etcd.Node{Key: key, Value: value, ModifiedIndex: m.index}}, nil
+}
+
+func TestEtcdStore(t *testing.T) {
+	m := &mockEtcd{}
+	l := New(NewEtcdStore(m), 60, 2)
+	now := time.Unix(1400000000, 0)
+	l.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		if i == 1 {
+			m.conflicts = 2
+		}
+		res, err := l.Take("alice")
+		if err != nil {
+			t.Fatalf("l.Take(%q) failed with %v; want success", "alice", err)
+		}
+		if res.Allowed != want {
+			t.Errorf("request %d: res.Allowed = %v; want %v", i, res.Allowed, want)
+		}
+	}
+
+	m.conflicts = maxRetries
+	if _, err := l.Take("alice"); err == nil {
+		t.Errorf("l.Take(%q) succeeded with too many conflicts; want failure", "alice")
+	}
+}
@@ -0,0 +1,145 @@
+// Package ratelimit limits the rate of requests per user with token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/auth"
+	"github.com/golang/glog"
+)
+
+// statusTooManyRequests is the HTTP status code 429, which net/http does not define yet.
+const statusTooManyRequests = 429
+
+// Bucket is the state of a token bucket.
+type Bucket struct {
+	// Tokens is the number of available tokens at Updated.
+	Tokens float64 `json:"tokens"`
+	// Updated is when Tokens was computed. A zero Updated means a full bucket.
+	Updated time.Time `json:"updated"`
+}
+
+// Store stores token buckets.
+type Store interface {
+	// Update atomically replaces the bucket of "key" with the result of "f".
+	Update(key string, f func(b Bucket) Bucket) (Bucket, error)
+}
+
+// Limiter is a token-bucket rate limiter.
+// Each key has a bucket of "burst" tokens, which is refilled at "rate" tokens per second.
+type Limiter struct {
+	store Store
+	rate  float64
+	burst int
+	now   func() time.Time
+}
+
+// New returns a new Limiter which allows "perMinute" requests per minute per key in average,
+// and "burst" requests at once.
+func New(store Store, perMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		store: store,
+		rate:  perMinute / 60,
+		burst: burst,
+		now:   time.Now,
+	}
+}
+
+// Result is the state of a limit after a request.
+type Result struct {
+	Allowed bool
+	// Limit is the maximum number of requests allowed at once.
+	Limit int
+	// Remaining is the number of requests allowed right now.
+	Remaining int
+	// RetryAfter is how long the client should wait before the next request if it is not allowed.
+	RetryAfter time.Duration
+}
+
+// Take consumes a token of "key" if available.
+func (l *Limiter) Take(key string) (Result, error) {
+	now := l.now()
+	var res Result
+	_, err := l.store.Update(key, func(b Bucket) Bucket {
+		tokens := float64(l.burst)
+		if !b.Updated.IsZero() {
+			tokens = math.Min(tokens, b.Tokens+now.Sub(b.Updated).Seconds()*l.rate)
+		}
+		res = Result{Limit: l.burst}
+		if tokens >= 1 {
+			tokens--
+			res.Allowed = true
+		} else if l.rate > 0 {
+			res.RetryAfter = time.Duration((1 - tokens) / l.rate * float64(time.Second))
+		}
+		res.Remaining = int(tokens)
+		return Bucket{Tokens: tokens, Updated: now}
+	})
+	return res, err
+}
+
+// Handler returns an http.Handler which limits requests to "h" per user.
+// It responds with 429 if the current user has run out of the limit. Users for whom "exempt" returns true are not limited.
+func Handler(l *Limiter, exempt func(user string) bool, h http.Handler) http.Handler {
+	return handler(l, exempt, auth.CurrentUser, h)
+}
+
+func handler(l *Limiter, exempt func(user string) bool, currentUser func(r *http.Request) (auth.User, error), h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := currentUser(r)
+		if err != nil {
+			glog.Errorf("Failed to get current user: %v", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if exempt != nil && exempt(u.Name) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		res, err := l.Take(u.Name)
+		if err != nil {
+			// Fails open. Rate limiting must not make goship unavailable.
+			glog.Errorf("Failed to take a rate limit token of %s: %v", u.Name, err)
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			secs := int(math.Ceil(res.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			glog.Warningf("Rate limit exceeded by %s on %s", u.Name, r.URL.Path)
+			http.Error(w, fmt.Sprintf("rate limit exceeded; retry after %d seconds", secs), statusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// MemoryStore is a Store in memory. It is not shared among goship instances.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]Bucket)}
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(key string, f func(b Bucket) Bucket) (Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := f(s.buckets[key])
+	s.buckets[key] = b
+	return b, nil
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/auth"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestHandler(perMinute float64, burst int, exempt func(string) bool) (http.Handler, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1400000000, 0)}
+	l := New(NewMemoryStore(), perMinute, burst)
+	l.now = clock.Now
+	currentUser := func(r *http.Request) (auth.User, error) {
+		return auth.User{Name: r.FormValue("user")}, nil
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return handler(l, exempt, currentUser, ok), clock
+}
+
+func request(h http.Handler, user string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest("POST", "/deploy_handler?user="+user, nil)
+	if err != nil {
+		panic(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerLimits(t *testing.T) {
+	// 6 requests per minute = one per 10 seconds, 3 at once
+	h, clock := newTestHandler(6, 3, nil)
+	for i := 0; i < 3; i++ {
+		w := request(h, "alice")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: code = %d; want %d", i, w.Code, http.StatusOK)
+		}
+		if got, want := w.Header().Get("X-RateLimit-Remaining"), []string{"2", "1", "0"}[i]; got != want {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q; want %q", i, got, want)
+		}
+		if got, want := w.Header().Get("X-RateLimit-Limit"), "3"; got != want {
+			t.Errorf("request %d: X-RateLimit-Limit = %q; want %q", i, got, want)
+		}
+	}
+
+	w := request(h, "alice")
+	if w.Code != statusTooManyRequests {
+		t.Errorf("code = %d after burst; want %d", w.Code, statusTooManyRequests)
+	}
+	if got, want := w.Header().Get("Retry-After"), "10"; got != want {
+		t.Errorf("Retry-After = %q; want %q", got, want)
+	}
+	// other users have their own buckets
+	if w := request(h, "bob"); w.Code != http.StatusOK {
+		t.Errorf("code = %d for another user; want %d", w.Code, http.StatusOK)
+	}
+
+	clock.now = clock.now.Add(5 * time.Second)
+	w = request(h, "alice")
+	if w.Code != statusTooManyRequests {
+		t.Errorf("code = %d before refill; want %d", w.Code, statusTooManyRequests)
+	}
+	if got, want := w.Header().Get("Retry-After"), "5"; got != want {
+		t.Errorf("Retry-After = %q; want %q", got, want)
+	}
+
+	clock.now = clock.now.Add(5 * time.Second)
+	if w := request(h, "alice"); w.Code != http.StatusOK {
+		t.Errorf("code = %d after refill; want %d", w.Code, http.StatusOK)
+	}
+	if w := request(h, "alice"); w.Code != statusTooManyRequests {
+		t.Errorf("code = %d after consuming the refilled token; want %d", w.Code, statusTooManyRequests)
+	}
+
+	// fully recovers after a long time, but not beyond the burst
+	clock.now = clock.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if w := request(h, "alice"); w.Code != http.StatusOK {
+			t.Errorf("request %d: code = %d after recovery; want %d", i, w.Code, http.StatusOK)
+		}
+	}
+	if w := request(h, "alice"); w.Code != statusTooManyRequests {
+		t.Errorf("code = %d after recovery and burst; want %d", w.Code, statusTooManyRequests)
+	}
+}
+
+func TestHandlerExempt(t *testing.T) {
+	h, _ := newTestHandler(1, 1, func(user string) bool { return user == "admin" })
+	for i := 0; i < 10; i++ {
+		if w := request(h, "admin"); w.Code != http.StatusOK {
+			t.Errorf("request %d: code = %d for an admin; want %d", i, w.Code, http.StatusOK)
+		}
+	}
+	request(h, "alice")
+	if w := request(h, "alice"); w.Code != statusTooManyRequests {
+		t.Errorf("code = %d for a non-admin; want %d", w.Code, statusTooManyRequests)
+	}
+}
@@ -0,0 +1,150 @@
+// Package reqlog correlates log lines and error responses with the HTTP request which caused them.
+// Each request gets an ID, taken from the X-Request-ID header if a proxy assigned one, which is
+// threaded through contexts into deployments so that interleaved log lines of concurrent requests can be told apart.
+package reqlog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// Header is the HTTP header which carries request IDs in both requests and responses.
+const Header = "X-Request-ID"
+
+// maxIDLen is the longest inbound request ID accepted. Longer ones are replaced with generated IDs.
+const maxIDLen = 64
+
+type contextKey int
+
+const idKey contextKey = 0
+
+// NewID returns a random request ID.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		glog.Errorf("Failed to generate a request ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validID returns true if "id" is short and consists of printable ASCII letters other than spaces,
+// so that it cannot forge log lines or response headers.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler assigns an ID to each request to "h". The inbound X-Request-ID is kept if valid.
+// The ID is available to "h" through FromRequest and echoed in the X-Request-ID response header.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !validID(id) {
+			id = NewID()
+		}
+		r.Header.Set(Header, id)
+		w.Header().Set(Header, id)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// FromRequest returns the ID assigned to "r" by Handler.
+func FromRequest(r *http.Request) string {
+	return r.Header.Get(Header)
+}
+
+// NewContext returns a copy of "ctx" which carries the request ID "id".
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey, id)
+}
+
+// FromContext returns the request ID carried by "ctx", or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey).(string)
+	return id
+}
+
+// sink writes log lines. depth is as in glog.InfoDepth.
+// It is replaced in tests.
+var sink = struct {
+	info, warning, error func(depth int, args ...interface{})
+}{
+	info:    glog.InfoDepth,
+	warning: glog.WarningDepth,
+	error:   glog.ErrorDepth,
+}
+
+// line formats a log line prefixed with the request ID in "ctx". It also returns the line without the ID.
+func line(ctx context.Context, format string, args []interface{}) (text, msg string) {
+	msg = fmt.Sprintf(format, args...)
+	if id := FromContext(ctx); id != "" {
+		return fmt.Sprintf("[request %s] %s", id, msg), msg
+	}
+	return msg, msg
+}
+
+// Infof logs like glog.Infof with the request ID in "ctx". Log lines point to the caller of Infof.
+func Infof(ctx context.Context, format string, args ...interface{}) {
+	text, msg := line(ctx, format, args)
+	throttle.log(infoLog, 1, msg, text)
+}
+
+// Warningf logs like glog.Warningf with the request ID in "ctx".
+// Warnings identical to one logged within the throttle window are counted instead. See SetThrottleWindow.
+func Warningf(ctx context.Context, format string, args ...interface{}) {
+	text, msg := line(ctx, format, args)
+	throttle.log(warningLog, 1, msg, text)
+}
+
+// Errorf logs like glog.Errorf with the request ID in "ctx".
+// Errors identical to one logged within the throttle window are counted instead.
+func Errorf(ctx context.Context, format string, args ...interface{}) {
+	text, msg := line(ctx, format, args)
+	throttle.log(errorLog, 1, msg, text)
+}
+
+// Criticalf logs an error like Errorf, but never suppresses it, for errors each of which needs attention, e.g. failed deployments.
+func Criticalf(ctx context.Context, format string, args ...interface{}) {
+	text, _ := line(ctx, format, args)
+	sink.error(1, text)
+}
+
+// errorResponse is the JSON body of API errors.
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+	// Suggestions are the names which the client might have meant instead of an unknown one.
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Error replies to the request "id" with the error message "msg" and the HTTP status "code" in JSON,
+// so that users can quote the ID when they report the error.
+func Error(w http.ResponseWriter, id, msg string, code int) {
+	ErrorWithSuggestions(w, id, msg, code, nil)
+}
+
+// ErrorWithSuggestions is like Error, but also tells the client the names it might have meant, e.g. for a misspelled project.
+func ErrorWithSuggestions(w http.ResponseWriter, id, msg string, code int, suggestions []string) {
+	b, err := json.Marshal(errorResponse{Error: msg, RequestID: id, Suggestions: suggestions})
+	if err != nil {
+		glog.Errorf("Failed to marshal error response: %v", err)
+		http.Error(w, msg, code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
@@ -0,0 +1,161 @@
+package reqlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// captureLogs records log lines instead of writing them to glog until the returned function is called.
+// Lines are throttled afresh by the default window.
+func captureLogs() (*[]string, func()) {
+	orig, origThrottle := sink, throttle
+	throttle = newThrottler(DefaultThrottleWindow, time.Now)
+	var lines []string
+	record := func(level string) func(int, ...interface{}) {
+		return func(depth int, args ...interface{}) {
+			lines = append(lines, level+": "+fmt.Sprint(args...))
+		}
+	}
+	sink.info, sink.warning, sink.error = record("I"), record("W"), record("E")
+	return &lines, func() { sink, throttle = orig, origThrottle }
+}
+
+func TestHandler(t *testing.T) {
+	var got string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	for _, spec := range []struct {
+		inbound  string
+		generate bool
+	}{
+		{inbound: "", generate: true},
+		{inbound: "lb-0123-abcd"},
+		{inbound: "with space", generate: true},
+		{inbound: "forged\nline", generate: true},
+		{inbound: strings.Repeat("a", maxIDLen)},
+		{inbound: strings.Repeat("a", maxIDLen+1), generate: true},
+	} {
+		r, err := http.NewRequest("POST", "/deploy_handler", nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest failed with %v", err)
+		}
+		if spec.inbound != "" {
+			r.Header.Set(Header, spec.inbound)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if spec.generate {
+			if got == "" || got == spec.inbound {
+				t.Errorf("request ID with %s %q = %q; want a generated one", Header, spec.inbound, got)
+			}
+		} else if got != spec.inbound {
+			t.Errorf("request ID with %s %q = %q; want %q", Header, spec.inbound, got, spec.inbound)
+		}
+		if resp := w.Header().Get(Header); resp != got {
+			t.Errorf("%s response header = %q; want %q", Header, resp, got)
+		}
+	}
+}
+
+func TestNewIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewID()
+		if !validID(id) {
+			t.Errorf("NewID() = %q; want a valid ID", id)
+		}
+		if seen[id] {
+			t.Errorf("NewID() = %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// deployStep and postStatus stand for nested calls in a deployment which log with the context they are given.
+func deployStep(ctx context.Context, proj string) {
+	Infof(ctx, "Starting deployment of %s", proj)
+	postStatus(ctx, proj)
+}
+
+func postStatus(ctx context.Context, proj string) {
+	Errorf(ctx, "Failed to post commit status of %s: %v", proj, "boom")
+}
+
+func TestNestedLogs(t *testing.T) {
+	lines, restore := captureLogs()
+	defer restore()
+
+	var id string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = FromRequest(r)
+		deployStep(NewContext(context.Background(), id), "api")
+		Warningf(context.Background(), "Unrelated to requests")
+	}))
+	r, err := http.NewRequest("POST", "/deploy_handler", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest failed with %v", err)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	want := []string{
+		fmt.Sprintf("I: [request %s] Starting deployment of api", id),
+		fmt.Sprintf("E: [request %s] Failed to post commit status of api: boom", id),
+		"W: Unrelated to requests",
+	}
+	if len(*lines) != len(want) {
+		t.Fatalf("log lines = %q; want %q", *lines, want)
+	}
+	for i, l := range *lines {
+		if l != want[i] {
+			t.Errorf("log line %d = %q; want %q", i, l, want[i])
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	w := httptest.NewRecorder()
+	Error(w, "lb-0123", "no such project", http.StatusNotFound)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	if got, want := w.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type = %q; want %q", got, want)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v", w.Body.String(), err)
+	}
+	if got, want := body["error"], "no such project"; got != want {
+		t.Errorf("error = %q; want %q", got, want)
+	}
+	if got, want := body["requestId"], "lb-0123"; got != want {
+		t.Errorf("requestId = %q; want %q", got, want)
+	}
+}
+
+func TestErrorWithSuggestions(t *testing.T) {
+	w := httptest.NewRecorder()
+	ErrorWithSuggestions(w, "lb-0123", "No project found: apl; did you mean api?", http.StatusNotFound, []string{"api"})
+	var body errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusNotFound || !reflect.DeepEqual(body.Suggestions, []string{"api"}) {
+		t.Errorf("ErrorWithSuggestions(...) = %d %s; want %d with the suggestions", w.Code, w.Body, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	Error(w, "lb-0123", "no such project", http.StatusNotFound)
+	if strings.Contains(w.Body.String(), "suggestions") {
+		t.Errorf("Error(...) = %s; want no suggestions", w.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package reqlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultThrottleWindow is how long identical warnings and errors are suppressed after the first one by default.
+const DefaultThrottleWindow = time.Minute
+
+// severity is the level of a log line.
+type severity int
+
+const (
+	infoLog severity = iota
+	warningLog
+	errorLog
+)
+
+// write returns the function of "sink" which writes lines of "sev".
+func (sev severity) write() func(depth int, args ...interface{}) {
+	switch sev {
+	case warningLog:
+		return sink.warning
+	case errorLog:
+		return sink.error
+	}
+	return sink.info
+}
+
+// throttleKey identifies identical log lines. The request ID is not a part of it,
+// so that the same failure in concurrent requests is suppressed too.
+type throttleKey struct {
+	sev severity
+	msg string
+}
+
+// burst is the repetitions of a log line within a window.
+type burst struct {
+	until      time.Time
+	suppressed int
+}
+
+// throttler suppresses warnings and errors which are identical to one written within the window, e.g. when GitHub is down
+// and every request fails the same way. The number of suppressed lines is written when the window of the first one passes.
+type throttler struct {
+	mu     sync.Mutex
+	window time.Duration
+	now    func() time.Time
+	bursts map[throttleKey]*burst
+}
+
+func newThrottler(window time.Duration, now func() time.Time) *throttler {
+	return &throttler{window: window, now: now, bursts: make(map[throttleKey]*burst)}
+}
+
+// throttle is the throttler of Warningf and Errorf.
+var throttle = newThrottler(DefaultThrottleWindow, time.Now)
+
+// SetThrottleWindow changes how long identical warnings and errors are suppressed after the first one. Zero disables suppression.
+func SetThrottleWindow(d time.Duration) {
+	throttle.mu.Lock()
+	throttle.window = d
+	throttle.mu.Unlock()
+	throttle.flush(true)
+}
+
+// RunThrottle writes the numbers of suppressed lines whose windows have passed every "interval" until "ctx" is done,
+// so that the count of a burst is written even if the line is never logged again.
+func RunThrottle(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			throttle.flush(true)
+			return
+		case <-t.C:
+			throttle.flush(false)
+		}
+	}
+}
+
+// log writes "text" at "sev" unless a line with the same "msg" and "sev" was written within the window, in which case
+// it is only counted. "depth" is as in glog.InfoDepth, relative to the caller of log.
+func (t *throttler) log(sev severity, depth int, msg, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sev == infoLog || t.window <= 0 {
+		sev.write()(depth+1, text)
+		return
+	}
+	key := throttleKey{sev: sev, msg: msg}
+	now := t.now()
+	if b, ok := t.bursts[key]; ok {
+		if now.Before(b.until) {
+			b.suppressed++
+			return
+		}
+		t.report(key, b)
+	}
+	t.bursts[key] = &burst{until: now.Add(t.window)}
+	sev.write()(depth+1, text)
+}
+
+// flush writes the numbers of suppressed lines of the bursts whose windows have passed, or of all the bursts if "all".
+func (t *throttler) flush(all bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for key, b := range t.bursts {
+		if all || !now.Before(b.until) {
+			t.report(key, b)
+			delete(t.bursts, key)
+		}
+	}
+}
+
+// report writes the number of lines suppressed in "b" if any. t.mu must be held.
+func (t *throttler) report(key throttleKey, b *burst) {
+	if b.suppressed == 0 {
+		return
+	}
+	key.sev.write()(0, fmt.Sprintf("%s (last message repeated %d times)", key.msg, b.suppressed))
+}
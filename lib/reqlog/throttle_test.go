@@ -0,0 +1,76 @@
+package reqlog
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestThrottle(t *testing.T) {
+	lines, restore := captureLogs()
+	defer restore()
+	now := time.Date(2016, 5, 1, 9, 0, 0, 0, time.UTC)
+	throttle = newThrottler(time.Minute, func() time.Time { return now })
+	expect := func(desc string, want ...string) {
+		if !reflect.DeepEqual(*lines, want) {
+			t.Errorf("log lines %s = %q; want %q", desc, *lines, want)
+		}
+		*lines = nil
+	}
+
+	for i := 0; i < 215; i++ {
+		ctx := NewContext(context.Background(), fmt.Sprintf("req%d", i))
+		Errorf(ctx, "Failed to get branch %s: %v", "master", "GitHub unavailable")
+		Warningf(ctx, "Failed to get branch %s: %v", "master", "GitHub unavailable")
+		Infof(ctx, "Refreshing %s", "api")
+	}
+	if len(*lines) != 217 {
+		t.Errorf("log lines of the burst = %d; want an error, a warning and every info line", len(*lines))
+	}
+	if got, want := (*lines)[0], "E: [request req0] Failed to get branch master: GitHub unavailable"; got != want {
+		t.Errorf("first log line = %q; want %q", got, want)
+	}
+	*lines = nil
+
+	now = now.Add(30 * time.Second)
+	Errorf(context.Background(), "Failed to get branch master: GitHub unavailable")
+	Errorf(context.Background(), "Failed to poll %s", "web1")
+	expect("within the window", "E: Failed to poll web1")
+
+	now = now.Add(30 * time.Second)
+	Errorf(context.Background(), "Failed to get branch master: GitHub unavailable")
+	expect("after the window",
+		"E: Failed to get branch master: GitHub unavailable (last message repeated 215 times)",
+		"E: Failed to get branch master: GitHub unavailable",
+	)
+
+	// the warnings whose window has passed and the next error burst are reported without being logged again.
+	throttle.flush(false)
+	expect("flushed after the window of the warnings", "W: Failed to get branch master: GitHub unavailable (last message repeated 214 times)")
+	Errorf(context.Background(), "Failed to get branch master: GitHub unavailable")
+	throttle.flush(false)
+	expect("flushed within the window")
+	now = now.Add(time.Minute)
+	throttle.flush(false)
+	expect("flushed after the window", "E: Failed to get branch master: GitHub unavailable (last message repeated 1 times)")
+	Errorf(context.Background(), "Failed to get branch master: GitHub unavailable")
+	expect("after flushing", "E: Failed to get branch master: GitHub unavailable")
+}
+
+func TestThrottleExempt(t *testing.T) {
+	lines, restore := captureLogs()
+	defer restore()
+	for i := 0; i < 3; i++ {
+		Criticalf(context.Background(), "Deployment of %s failed: %v", "api", "exit status 1")
+	}
+	SetThrottleWindow(0)
+	for i := 0; i < 3; i++ {
+		Errorf(context.Background(), "Failed to poll %s", "web1")
+	}
+	if len(*lines) != 6 {
+		t.Errorf("log lines = %q; want critical lines and unthrottled lines all logged", *lines)
+	}
+}
@@ -0,0 +1,56 @@
+package revision
+
+import (
+	"sync"
+	"time"
+)
+
+// Deployed is a revision observed in a host.
+type Deployed struct {
+	Rev, SrcRev Revision
+	// ObservedAt is when Rev was observed. It is zero if never observed successfully.
+	ObservedAt time.Time
+	// Err is the error of the last observation, if any. Rev is the last successfully observed one.
+	Err error
+}
+
+// deployedKey identifies a host in an environment.
+type deployedKey struct {
+	Project, Environment, Host string
+}
+
+// DeployedCache remembers revisions last observed in hosts, so that they can be served without SSH.
+type DeployedCache struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	revs map[deployedKey]Deployed
+}
+
+// NewDeployedCache returns a new empty DeployedCache.
+func NewDeployedCache() *DeployedCache {
+	return &DeployedCache{now: time.Now, revs: make(map[deployedKey]Deployed)}
+}
+
+// Put records the result of an observation of the revision deployed into "host".
+// A failure keeps the last successfully observed revision.
+func (c *DeployedCache) Put(proj, env, host string, rev, srcRev Revision, err error) {
+	key := deployedKey{Project: proj, Environment: env, Host: host}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.revs[key]
+	if err != nil {
+		d.Err = err
+	} else {
+		d = Deployed{Rev: rev, SrcRev: srcRev, ObservedAt: c.now()}
+	}
+	c.revs[key] = d
+}
+
+// Get returns the revision last observed in "host", or false if it has never been observed.
+func (c *DeployedCache) Get(proj, env, host string) (Deployed, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.revs[deployedKey{Project: proj, Environment: env, Host: host}]
+	return d, ok
+}
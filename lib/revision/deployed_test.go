@@ -0,0 +1,36 @@
+package revision
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeployedCache(t *testing.T) {
+	now := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	c := NewDeployedCache()
+	c.now = func() time.Time { return now }
+
+	if d, ok := c.Get("goship", "staging", "web1"); ok {
+		t.Errorf("c.Get(...) = %#v, true before observed; want false", d)
+	}
+
+	c.Put("goship", "staging", "web1", "abcdef0123", "abcdef0123", nil)
+	d, ok := c.Get("goship", "staging", "web1")
+	if !ok || d.Rev != "abcdef0123" || d.Err != nil || !d.ObservedAt.Equal(now) {
+		t.Errorf("c.Get(...) = %#v, %v; want revision %q observed at %s", d, ok, "abcdef0123", now)
+	}
+
+	errSSH := errors.New("connection refused")
+	now = now.Add(time.Hour)
+	c.Put("goship", "staging", "web1", "", "", errSSH)
+	d, _ = c.Get("goship", "staging", "web1")
+	// the last successfully observed revision is kept.
+	if d.Rev != "abcdef0123" || d.Err != errSSH || !d.ObservedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("c.Get(...) = %#v after failure; want revision %q with %v", d, "abcdef0123", errSSH)
+	}
+
+	if d, ok := c.Get("goship", "production", "web1"); ok {
+		t.Errorf("c.Get(...) = %#v, true for another environment; want false", d)
+	}
+}
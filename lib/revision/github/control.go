@@ -2,7 +2,9 @@ package github
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gengo/goship/lib/config"
 	githublib "github.com/gengo/goship/lib/github"
@@ -13,14 +15,24 @@ import (
 	"golang.org/x/net/context"
 )
 
+// revisionSourceTimeout is how long LatestDeployed waits for the URL in config.Environment.RevisionSource.
+const revisionSourceTimeout = 10 * time.Second
+
+// runner runs commands in hosts. It is ssh.SSH except in tests.
+type runner interface {
+	Output(ctx context.Context, host, cmd string) ([]byte, error)
+}
+
 type control struct {
 	gcl githublib.Client
-	ssh ssh.SSH
+	ssh runner
+	// hc reads the URLs in config.Environment.RevisionSource.
+	hc *http.Client
 }
 
 // New returns a new git-based implementation of revision.Control
 func New(gcl githublib.Client, ssh ssh.SSH) revision.Control {
-	return control{gcl: gcl, ssh: ssh}
+	return control{gcl: gcl, ssh: ssh, hc: &http.Client{Timeout: revisionSourceTimeout}}
 }
 
 // Latest returns the latest commit in the given reference.
@@ -41,7 +53,16 @@ func (c control) Latest(ctx context.Context, proj config.Project, env config.Env
 }
 
 // LatestDeployed returns the latest commit deployed into the host.
+// It is read from config.Environment.RevisionSource if set, or from the git checkout in the host otherwise.
 func (c control) LatestDeployed(ctx context.Context, hostname string, proj config.Project, env config.Environment) (rev, srcRev revision.Revision, err error) {
+	if env.RevisionSource != "" {
+		rev, err = c.sourceDeployed(ctx, hostname, env)
+		if err != nil {
+			glog.Errorf("Failed to get latest deployed commit from %s:%s : %v", hostname, env.RevisionSource, err)
+			return "", "", err
+		}
+		return rev, rev, nil
+	}
 	cmd := fmt.Sprintf("git --git-dir=%s rev-parse HEAD", env.RepoPath)
 	if proj.HostType == config.HostTypeK8s {
 		selector := proj.Name
@@ -60,6 +81,9 @@ func (c control) LatestDeployed(ctx context.Context, hostname string, proj confi
 }
 
 func (c control) RevisionURL(p config.Project, rev revision.Revision) string {
+	if u := p.CommitURL(string(rev)); u != "" {
+		return u
+	}
 	return fmt.Sprintf("https://github.com/%s/%s/commit/%s", p.RepoOwner, p.RepoName, rev)
 }
 
@@ -67,6 +91,9 @@ func (c control) SourceDiffURL(p config.Project, from, to revision.Revision) str
 	if from == to {
 		return ""
 	}
+	if u := p.DiffURL(string(from), string(to)); u != "" {
+		return u
+	}
 	repo := p.SourceRepo()
 	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", repo.RepoOwner, repo.RepoName, from, to)
 }
@@ -38,9 +38,54 @@ func TestSourceDiffURL(t *testing.T) {
 			to:   "abc456",
 			want: "https://github.com/foo/test/compare/abc123...abc456",
 		},
+		{
+			p: config.Project{
+				Name: "test project",
+				Repo: config.Repo{
+					RepoOwner: "foo",
+					RepoName:  "test",
+				},
+				DiffURLTemplate: "https://bitbucket.org/{{.Owner}}/{{.Repo}}/branches/compare/{{.To}}..{{.From}}",
+			},
+			from: "abc123",
+			to:   "abc#456",
+			want: "https://bitbucket.org/foo/test/branches/compare/abc%23456..abc123",
+		},
 	} {
 		if got := ctl.SourceDiffURL(tt.p, tt.from, tt.to); got != tt.want {
 			t.Errorf("ctl.SourceDiffURL(%#v, %q, %q) = %q; want %q", tt.p, tt.from, tt.to, got, tt.want)
 		}
 	}
 }
+
+func TestRevisionURL(t *testing.T) {
+	var ctl control
+	repo := config.Repo{
+		RepoOwner: "foo",
+		RepoName:  "test",
+	}
+	for _, tt := range []struct {
+		p    config.Project
+		rev  revision.Revision
+		want string
+	}{
+		{
+			p:    config.Project{Name: "test project", Repo: repo},
+			rev:  "abc123",
+			want: "https://github.com/foo/test/commit/abc123",
+		},
+		{
+			p: config.Project{
+				Name:              "test project",
+				Repo:              repo,
+				CommitURLTemplate: "https://bitbucket.org/{{.Owner}}/{{.Repo}}/commits/{{.SHA}}",
+			},
+			rev:  "abc123",
+			want: "https://bitbucket.org/foo/test/commits/abc123",
+		},
+	} {
+		if got := ctl.RevisionURL(tt.p, tt.rev); got != tt.want {
+			t.Errorf("ctl.RevisionURL(%#v, %q) = %q; want %q", tt.p, tt.rev, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/ssh"
+	"golang.org/x/net/context"
+)
+
+// maxRevisionSourceSize is the largest response of config.Environment.RevisionSource which is read.
+const maxRevisionSourceSize = 64 * 1024
+
+// shaPattern matches abbreviated or full SHA-1 of git commits.
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// sourceDeployed returns the revision deployed into "host" which config.Environment.RevisionSource of "env" has.
+func (c control) sourceDeployed(ctx context.Context, host string, env config.Environment) (revision.Revision, error) {
+	if path, ok := env.RevisionFile(); ok {
+		buf, err := c.ssh.Output(ctx, host, fmt.Sprintf("cat %s", ssh.Quote(path)))
+		if err != nil {
+			return "", err
+		}
+		return parseRevision(string(buf))
+	}
+	u, err := env.RevisionURLFor(host)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Cancel = ctx.Done()
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s responded with %s", u, resp.Status)
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRevisionSourceSize))
+	if err != nil {
+		return "", err
+	}
+	if env.RevisionJSONPath == "" {
+		return parseRevision(string(buf))
+	}
+	s, err := lookupJSON(buf, env.RevisionJSONPath)
+	if err != nil {
+		return "", fmt.Errorf("malformed response of %s: %v", u, err)
+	}
+	return parseRevision(s)
+}
+
+// lookupJSON returns the string at the dot-separated "path" in the JSON object "buf".
+func lookupJSON(buf []byte, path string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return "", err
+	}
+	for _, k := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("no object at %q of %q", k, path)
+		}
+		if v, ok = obj[k]; !ok {
+			return "", fmt.Errorf("no %q of %q", k, path)
+		}
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%q is not a string", path)
+	}
+	return s, nil
+}
+
+// parseRevision returns the revision in "s" with surrounding spaces, or an error unless it is a SHA of a commit.
+func parseRevision(s string) (revision.Revision, error) {
+	s = strings.TrimSpace(s)
+	if !shaPattern.MatchString(s) {
+		if len(s) > 64 {
+			s = s[:64] + "..."
+		}
+		return "", fmt.Errorf("malformed revision %q", s)
+	}
+	return revision.Revision(s), nil
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/revision"
+	"golang.org/x/net/context"
+)
+
+// fakeRunner returns the contents of files in "files" for "cat" and records the commands.
+type fakeRunner struct {
+	files map[string]string
+	cmds  []string
+}
+
+func (r *fakeRunner) Output(ctx context.Context, host, cmd string) ([]byte, error) {
+	r.cmds = append(r.cmds, cmd)
+	for path, content := range r.files {
+		if cmd == fmt.Sprintf("cat '%s'", path) {
+			return []byte(content), nil
+		}
+	}
+	return nil, fmt.Errorf("no such file in %s: %q", host, cmd)
+}
+
+func TestLatestDeployedFromFile(t *testing.T) {
+	r := &fakeRunner{files: map[string]string{
+		"/srv/api/REVISION":  "0123456789abcdef0123456789abcdef01234567\n",
+		"/srv/api/BROKEN":    "<html>Not Found</html>",
+		"/srv/api/EMPTY":     "",
+		"/srv/api/TWO LINES": "0123456\n89abcde\n",
+	}}
+	c := control{ssh: r}
+	for _, spec := range []struct {
+		source string
+		want   revision.Revision
+		// msg is a part of the error, or empty if the revision is read.
+		msg string
+	}{
+		{source: "file:/srv/api/REVISION", want: "0123456789abcdef0123456789abcdef01234567"},
+		{source: "file:/srv/api/BROKEN", msg: "malformed revision"},
+		{source: "file:/srv/api/EMPTY", msg: "malformed revision"},
+		{source: "file:/srv/api/TWO LINES", msg: "malformed revision"},
+		{source: "file:/srv/api/MISSING", msg: "no such file"},
+	} {
+		env := config.Environment{Name: "production", RevisionSource: spec.source}
+		rev, srcRev, err := c.LatestDeployed(context.Background(), "web1.example.com", config.Project{Name: "api"}, env)
+		if spec.msg != "" {
+			if err == nil || !strings.Contains(err.Error(), spec.msg) {
+				t.Errorf("c.LatestDeployed(ctx, host, proj, %q) = %q, %v; want an error with %q", spec.source, rev, err, spec.msg)
+			}
+			continue
+		}
+		if err != nil || rev != spec.want || srcRev != spec.want {
+			t.Errorf("c.LatestDeployed(ctx, host, proj, %q) = %q, %q, %v; want %q", spec.source, rev, srcRev, err, spec.want)
+		}
+	}
+	if got, want := r.cmds[len(r.cmds)-2], `cat '/srv/api/TWO LINES'`; got != want {
+		t.Errorf("ran %q; want %q", got, want)
+	}
+}
+
+func TestLatestDeployedFromURL(t *testing.T) {
+	responses := map[string]string{
+		"/raw":      "abcdef1\n",
+		"/json":     `{"build": {"sha": "abcdef0123456789"}, "version": "1.2.0"}`,
+		"/number":   `{"build": {"sha": 12345678}}`,
+		"/not-json": "abcdef1",
+		"/not-sha":  `{"build": {"sha": "v1.2.0"}}`,
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer s.Close()
+	port := s.URL[strings.LastIndex(s.URL, ":")+1:]
+
+	c := control{hc: http.DefaultClient}
+	for _, spec := range []struct {
+		path, jsonPath string
+		want           revision.Revision
+		// msg is a part of the error, or empty if the revision is read.
+		msg string
+	}{
+		{path: "/raw", want: "abcdef1"},
+		{path: "/json", jsonPath: "build.sha", want: "abcdef0123456789"},
+		{path: "/json", jsonPath: "build.ref", msg: `no "ref"`},
+		{path: "/json", jsonPath: "version.sha", msg: `no object at "sha"`},
+		{path: "/number", jsonPath: "build.sha", msg: "not a string"},
+		{path: "/not-json", jsonPath: "build.sha", msg: "malformed response"},
+		{path: "/not-sha", jsonPath: "build.sha", msg: "malformed revision"},
+		{path: "/missing", msg: "404 Not Found"},
+	} {
+		env := config.Environment{
+			Name:             "production",
+			RevisionSource:   "http://{{.Host}}:" + port + spec.path,
+			RevisionJSONPath: spec.jsonPath,
+		}
+		// {{.Host}} is the name of the host without the port of SSH.
+		rev, srcRev, err := c.LatestDeployed(context.Background(), "127.0.0.1:22", config.Project{Name: "api"}, env)
+		if spec.msg != "" {
+			if err == nil || !strings.Contains(err.Error(), spec.msg) {
+				t.Errorf("c.LatestDeployed(ctx, host, proj, %q with %q) = %q, %v; want an error with %q", spec.path, spec.jsonPath, rev, err, spec.msg)
+			}
+			continue
+		}
+		if err != nil || rev != spec.want || srcRev != spec.want {
+			t.Errorf("c.LatestDeployed(ctx, host, proj, %q with %q) = %q, %q, %v; want %q", spec.path, spec.jsonPath, rev, srcRev, err, spec.want)
+		}
+	}
+}
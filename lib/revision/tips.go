@@ -0,0 +1,115 @@
+package revision
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"golang.org/x/net/context"
+)
+
+// Tip is the latest deployable revision of a branch.
+type Tip struct {
+	Rev, SrcRev Revision
+	// FetchedAt is when Rev was fetched. It is zero if never fetched successfully.
+	FetchedAt time.Time
+	// Err is the error of the last fetch, if any. Rev is the last successfully fetched one.
+	Err error
+}
+
+// TipKey identifies a branch.
+type TipKey struct {
+	RepoType            config.RepositoryType
+	Owner, Repo, Branch string
+}
+
+func tipKey(proj config.Project, env config.Environment) TipKey {
+	return TipKey{RepoType: proj.RepoType, Owner: proj.RepoOwner, Repo: proj.RepoName, Branch: env.Branch}
+}
+
+// tipCall is a fetch in flight.
+type tipCall struct {
+	wg  sync.WaitGroup
+	tip Tip
+	// dups is the number of callers waiting for the fetch other than the one which started it.
+	dups int
+}
+
+// TipCache caches tips of branches, and refreshes stale ones in background.
+// Concurrent fetches of the same branch are coalesced into one.
+type TipCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	tips  map[TipKey]Tip
+	calls map[TipKey]*tipCall
+}
+
+// NewTipCache returns a new TipCache which considers tips older than "ttl" stale.
+func NewTipCache(ttl time.Duration) *TipCache {
+	return &TipCache{
+		ttl:   ttl,
+		now:   time.Now,
+		tips:  make(map[TipKey]Tip),
+		calls: make(map[TipKey]*tipCall),
+	}
+}
+
+// Get returns the tip of the branch of "env".
+// It fetches the tip with "ctrl" if not cached yet. A stale tip is returned as it is while it is refreshed in background.
+func (c *TipCache) Get(ctx context.Context, ctrl Control, proj config.Project, env config.Environment) Tip {
+	c.mu.Lock()
+	tip, ok := c.tips[tipKey(proj, env)]
+	c.mu.Unlock()
+	if !ok {
+		return c.Refresh(ctx, ctrl, proj, env)
+	}
+	if c.now().Sub(tip.FetchedAt) >= c.ttl {
+		// Refreshes with a new context since "ctx" may end with the request.
+		go c.Refresh(context.Background(), ctrl, proj, env)
+	}
+	return tip
+}
+
+// Peek returns the cached tip of the branch of "env" without fetching it, or false if it is not cached.
+func (c *TipCache) Peek(proj config.Project, env config.Environment) (Tip, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tip, ok := c.tips[tipKey(proj, env)]
+	return tip, ok
+}
+
+// Refresh fetches the tip of the branch of "env" with "ctrl" now.
+// If a fetch of the same branch is in flight, it waits for the fetch instead of starting another one.
+func (c *TipCache) Refresh(ctx context.Context, ctrl Control, proj config.Project, env config.Environment) Tip {
+	key := tipKey(proj, env)
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		call.dups++
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.tip
+	}
+	call := new(tipCall)
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	rev, srcRev, err := ctrl.Latest(ctx, proj, env)
+
+	c.mu.Lock()
+	tip := c.tips[key]
+	if err != nil {
+		tip.Err = err
+	} else {
+		tip = Tip{Rev: rev, SrcRev: srcRev, FetchedAt: c.now()}
+	}
+	c.tips[key] = tip
+	delete(c.calls, key)
+	c.mu.Unlock()
+
+	call.tip = tip
+	call.wg.Done()
+	return tip
+}
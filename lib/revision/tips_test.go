@@ -0,0 +1,165 @@
+package revision
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"golang.org/x/net/context"
+)
+
+// blockingControl is a Control whose Latest blocks until released.
+type blockingControl struct {
+	Control
+
+	mu    sync.Mutex
+	calls int
+	rev   Revision
+	err   error
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingControl) Latest(ctx context.Context, proj config.Project, env config.Environment) (rev, srcRev Revision, err error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+	c.started <- struct{}{}
+	<-c.release
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rev, c.rev, c.err
+}
+
+func newBlockingControl(rev Revision) *blockingControl {
+	return &blockingControl{rev: rev, started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+var (
+	testProject = config.Project{Name: "goship", Repo: config.Repo{RepoOwner: "gengo", RepoName: "goship"}}
+	testEnv     = config.Environment{Name: "staging", Branch: "master"}
+)
+
+func TestTipCacheCoalescing(t *testing.T) {
+	const n = 5
+	ctrl := newBlockingControl("abcdef0123")
+	c := NewTipCache(time.Minute)
+
+	var wg sync.WaitGroup
+	tips := make([]Tip, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tips[i] = c.Refresh(context.Background(), ctrl, testProject, testEnv)
+		}(i)
+	}
+	<-ctrl.started
+	// waits for the other refreshes to join the fetch in flight.
+	for {
+		c.mu.Lock()
+		dups := c.calls[tipKey(testProject, testEnv)].dups
+		c.mu.Unlock()
+		if dups == n-1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(ctrl.release)
+	wg.Wait()
+
+	if ctrl.calls != 1 {
+		t.Errorf("ctrl.calls = %d; want 1", ctrl.calls)
+	}
+	for i, tip := range tips {
+		if tip.Rev != "abcdef0123" || tip.Err != nil || tip.FetchedAt.IsZero() {
+			t.Errorf("tips[%d] = %#v; want revision %q", i, tip, "abcdef0123")
+		}
+	}
+
+	// a cached tip is served without fetching.
+	if tip := c.Get(context.Background(), ctrl, testProject, testEnv); tip.Rev != "abcdef0123" {
+		t.Errorf("c.Get(...) = %#v; want revision %q", tip, "abcdef0123")
+	}
+	if ctrl.calls != 1 {
+		t.Errorf("ctrl.calls = %d; want 1", ctrl.calls)
+	}
+}
+
+func TestTipCacheError(t *testing.T) {
+	ctrl := newBlockingControl("abcdef0123")
+	close(ctrl.release)
+	now := time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTipCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	first := c.Refresh(context.Background(), ctrl, testProject, testEnv)
+	if first.Err != nil || !first.FetchedAt.Equal(now) {
+		t.Fatalf("c.Refresh(...) = %#v; want success at %s", first, now)
+	}
+
+	now = now.Add(time.Hour)
+	errFetch := errors.New("GitHub is down")
+	ctrl.rev, ctrl.err = "", errFetch
+	tip := c.Refresh(context.Background(), ctrl, testProject, testEnv)
+	if tip.Err != errFetch {
+		t.Errorf("tip.Err = %v; want %v", tip.Err, errFetch)
+	}
+	// the last successfully fetched revision is kept.
+	if tip.Rev != first.Rev || !tip.FetchedAt.Equal(first.FetchedAt) {
+		t.Errorf("tip = %#v; want revision %q fetched at %s", tip, first.Rev, first.FetchedAt)
+	}
+
+	ctrl.rev, ctrl.err = "0123abcdef", nil
+	if tip := c.Refresh(context.Background(), ctrl, testProject, testEnv); tip.Err != nil || tip.Rev != "0123abcdef" {
+		t.Errorf("c.Refresh(...) = %#v; want revision %q without error", tip, "0123abcdef")
+	}
+}
+
+// fixedControl is a Control whose Latest returns "rev" at once.
+type fixedControl struct {
+	Control
+	rev Revision
+}
+
+func (c fixedControl) Latest(ctx context.Context, proj config.Project, env config.Environment) (rev, srcRev Revision, err error) {
+	return c.rev, c.rev, nil
+}
+
+// TestCachesConcurrentAccess is meant for the race detector: pollers write into the caches while requests read them.
+func TestCachesConcurrentAccess(t *testing.T) {
+	tips := NewTipCache(0)
+	deployed := NewDeployedCache()
+	ctl := fixedControl{rev: "abc123"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tips.Refresh(context.Background(), ctl, testProject, testEnv)
+				deployed.Put(testProject.Name, testEnv.Name, "app1", "abc123", "abc123", nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tips.Get(context.Background(), ctl, testProject, testEnv)
+				tips.Peek(testProject, testEnv)
+				deployed.Get(testProject.Name, testEnv.Name, "app1")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if tip, ok := tips.Peek(testProject, testEnv); !ok || tip.Rev != "abc123" {
+		t.Errorf("tips.Peek(...) = %#v, %v; want %q", tip, ok, "abc123")
+	}
+	if d, ok := deployed.Get(testProject.Name, testEnv.Name, "app1"); !ok || d.Rev != "abc123" {
+		t.Errorf("deployed.Get(...) = %#v, %v; want %q", d, ok, "abc123")
+	}
+}
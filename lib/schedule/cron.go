@@ -0,0 +1,190 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch is how far Next looks for a matching minute, which is enough for any valid expression like "0 0 29 2 *".
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Expr is a parsed cron expression of five fields: minute, hour, day of month, month and day of week.
+type Expr struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+	loc                           *time.Location
+}
+
+// field is the range of a field of cron expressions.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// macros are the shorthands of common expressions.
+var macros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse parses the cron expression "spec" evaluated in "loc", e.g. "0 2 * * *" for 02:00 every day.
+// Each field is "*", a number, a range "1-5", a list "1,3,5" or any of them with a step like "*/15".
+// Days of week are 0 to 7, where both 0 and 7 are Sunday. As in the usual cron, a time matches if either
+// the day of month or the day of week matches when neither of them starts with "*".
+// Expressions which never match, e.g. "0 0 31 2 *", are rejected.
+// UTC is used if "loc" is nil.
+func Parse(spec string, loc *time.Location) (Expr, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	expanded := strings.TrimSpace(spec)
+	if m, ok := macros[expanded]; ok {
+		expanded = m
+	}
+	parts := strings.Fields(expanded)
+	if len(parts) != len(fields) {
+		return Expr{}, fmt.Errorf("cron expression %q must have %d fields", spec, len(fields))
+	}
+	var bits [5]uint64
+	for i, p := range parts {
+		b, err := parseField(p, fields[i])
+		if err != nil {
+			return Expr{}, fmt.Errorf("invalid cron expression %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	e := Expr{
+		spec:          strings.TrimSpace(spec),
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: !strings.HasPrefix(parts[2], "*"),
+		dowRestricted: !strings.HasPrefix(parts[4], "*"),
+		loc:           loc,
+	}
+	if e.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, loc)).IsZero() {
+		return Expr{}, fmt.Errorf("cron expression %q never matches", spec)
+	}
+	return e, nil
+}
+
+// parseField returns the bits of the values of "f" which "s" matches.
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q of %s", item[i+1:], f.name)
+			}
+			rng, step = item[:i], n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(bounds[1], f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q of %s", rng, f.name)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s must be between %d and %d: %q", f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
+
+// String returns the expression as written.
+func (e Expr) String() string {
+	return e.spec
+}
+
+// Location returns the time zone which the expression is evaluated in.
+func (e Expr) Location() *time.Location {
+	return e.loc
+}
+
+// Next returns the first minute strictly after "t" which matches the expression, in the location of the expression.
+func (e Expr) Next(t time.Time) time.Time {
+	t = t.In(e.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		if !has(e.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, e.loc)
+			continue
+		}
+		if !e.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, e.loc)
+			continue
+		}
+		if !has(e.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, e.loc)
+			continue
+		}
+		if !has(e.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay returns true if the day of "t" matches the day fields.
+func (e Expr) matchDay(t time.Time) bool {
+	dom, dow := has(e.dom, t.Day()), has(e.dow, int(t.Weekday()))
+	if e.domRestricted && e.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0 2 * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"0 0 31 2 *",
+	} {
+		if e, err := Parse(spec, nil); err == nil {
+			t.Errorf("Parse(%q, nil) = %v; want an error", spec, e)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	// 2016-03-02 is a Wednesday.
+	base := time.Date(2016, 3, 2, 1, 30, 20, 0, jst)
+	for _, spec := range []struct {
+		spec string
+		t    time.Time
+		want time.Time
+	}{
+		{spec: "0 2 * * *", t: base, want: time.Date(2016, 3, 2, 2, 0, 0, 0, jst)},
+		{spec: "0 2 * * *", t: time.Date(2016, 3, 2, 2, 0, 0, 0, jst), want: time.Date(2016, 3, 3, 2, 0, 0, 0, jst)},
+		{spec: "@daily", t: base, want: time.Date(2016, 3, 3, 0, 0, 0, 0, jst)},
+		{spec: "@hourly", t: base, want: time.Date(2016, 3, 2, 2, 0, 0, 0, jst)},
+		{spec: "*/15 * * * *", t: base, want: time.Date(2016, 3, 2, 1, 45, 0, 0, jst)},
+		{spec: "30 9 * * 1-5", t: time.Date(2016, 3, 4, 10, 0, 0, 0, jst), want: time.Date(2016, 3, 7, 9, 30, 0, 0, jst)},
+		{spec: "0 0 * * 7", t: base, want: time.Date(2016, 3, 6, 0, 0, 0, 0, jst)},
+		{spec: "0 0 29 2 *", t: base, want: time.Date(2020, 2, 29, 0, 0, 0, 0, jst)},
+		{spec: "0 12 1,15 * *", t: base, want: time.Date(2016, 3, 15, 12, 0, 0, 0, jst)},
+		// either day matches if both are restricted.
+		{spec: "0 0 10 * 5", t: base, want: time.Date(2016, 3, 4, 0, 0, 0, 0, jst)},
+	} {
+		e, err := Parse(spec.spec, jst)
+		if err != nil {
+			t.Errorf("Parse(%q, jst) failed with %v", spec.spec, err)
+			continue
+		}
+		if got := e.Next(spec.t); !got.Equal(spec.want) {
+			t.Errorf("Next(%v) of %q = %v; want %v", spec.t, spec.spec, got, spec.want)
+		}
+	}
+
+	// evaluated in the location of the expression.
+	e, err := Parse("0 2 * * *", jst)
+	if err != nil {
+		t.Fatalf("Parse(%q, jst) failed with %v", "0 2 * * *", err)
+	}
+	utc := time.Date(2016, 3, 1, 16, 0, 0, 0, time.UTC)
+	if got, want := e.Next(utc), time.Date(2016, 3, 2, 2, 0, 0, 0, jst); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v; want %v", utc, got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// etcdKeyPrefix is the etcd directory which contains the states of jobs.
+	etcdKeyPrefix = "/goship/schedules"
+	// maxRetries is the maximum number of retries of conflicting updates.
+	maxRetries = 10
+)
+
+// ETCDClient is the subset of etcd APIs which EtcdStore depends on.
+type ETCDClient interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Create(key, value string, ttl uint64) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+}
+
+// EtcdStore is a Store in etcd, which is shared among goship instances so that a new leader takes over the jobs.
+type EtcdStore struct {
+	client ETCDClient
+}
+
+// NewEtcdStore returns a new EtcdStore.
+func NewEtcdStore(client ETCDClient) EtcdStore {
+	return EtcdStore{client: client}
+}
+
+// Get implements Store.
+func (s EtcdStore) Get(key string) (State, error) {
+	st, _, err := s.get(path.Join(etcdKeyPrefix, key))
+	return st, err
+}
+
+// get returns the state in "k" and its modified index, which is zero if "k" does not exist.
+func (s EtcdStore) get(k string) (State, uint64, error) {
+	var st State
+	resp, err := s.client.Get(k, false, false)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal([]byte(resp.Node.Value), &st); err != nil {
+			return State{}, 0, fmt.Errorf("malformed schedule state %s: %v", k, err)
+		}
+		return st, resp.Node.ModifiedIndex, nil
+	case etcderr.IsKeyNotFound(err):
+		return State{}, 0, nil
+	}
+	return State{}, 0, err
+}
+
+// Update implements Store with compare-and-swap.
+func (s EtcdStore) Update(key string, f func(st State) State) (State, error) {
+	k := path.Join(etcdKeyPrefix, key)
+	for i := 0; i < maxRetries; i++ {
+		st, index, err := s.get(k)
+		if err != nil {
+			return State{}, err
+		}
+		st = f(st)
+		buf, err := json.Marshal(st)
+		if err != nil {
+			return State{}, err
+		}
+		if index == 0 {
+			_, err = s.client.Create(k, string(buf), 0)
+		} else {
+			_, err = s.client.CompareAndSwap(k, string(buf), 0, "", index)
+		}
+		if err == nil {
+			return st, nil
+		}
+		if !etcderr.Is(err, etcderr.TestFailed) && !etcderr.Is(err, etcderr.NodeExist) && !etcderr.IsKeyNotFound(err) {
+			return State{}, err
+		}
+		// a user has updated the state, e.g. to skip the next run. retry.
+	}
+	return State{}, fmt.Errorf("too many conflicts on updating %s", k)
+}
@@ -0,0 +1,152 @@
+// Package schedule keeps track of recurring jobs described by cron expressions, e.g. nightly deployments.
+//
+// The states of the jobs live in a Store rather than in memory, so that whichever goship instance is the leader
+// picks up where the previous one stopped. Runs missed while no instance was running are not piled up:
+// only the latest one runs on recovery, and only if it is not older than the grace period.
+package schedule
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reasons of skipped runs
+const (
+	// SkipRequested means that a user asked to skip the run.
+	SkipRequested = "skip requested"
+	// SkipMissed means that the run was due longer than the grace period ago, e.g. while goship was down.
+	SkipMissed = "missed"
+)
+
+// State is the progress of a job.
+type State struct {
+	// Last is the scheduled time of the latest run which has been handled, either run or skipped.
+	// Runs are due after it. The zero time means that the job has not started yet.
+	Last time.Time `json:"last"`
+	// SkipNext skips the next run once.
+	SkipNext bool `json:"skip_next,omitempty"`
+	// Result describes how the latest run went, e.g. "deployed abc1234" or "skipped: environment is locked".
+	Result string `json:"result,omitempty"`
+}
+
+// Store stores the states of jobs.
+type Store interface {
+	// Get returns the state of "key", which is the zero State if not stored.
+	Get(key string) (State, error)
+	// Update atomically replaces the state of "key" with the result of "f".
+	Update(key string, f func(s State) State) (State, error)
+}
+
+// Key returns the key of the "index"-th schedule of "env" of "proj".
+func Key(proj, env string, index int) string {
+	return fmt.Sprintf("%s/%s/%d", proj, env, index)
+}
+
+// Run is a run of a job which has become due.
+type Run struct {
+	// At is when the run was scheduled.
+	At time.Time
+	// Skip is why the run must be skipped, e.g. SkipRequested. It must run if empty.
+	Skip string
+}
+
+// Tick advances the job "key" scheduled by "expr" to "now", and returns the run which has become due if any.
+// The first tick of a job only starts it, so that adding a schedule does not run it immediately.
+// If several runs have become due since the last tick, only the latest one is returned, and it is skipped
+// as SkipMissed if it was due longer than "grace" ago.
+// The run is marked as handled before it is returned, so that it runs at most once even if the caller dies while running it.
+func Tick(s Store, key string, expr Expr, grace time.Duration, now time.Time) (*Run, error) {
+	var run *Run
+	_, err := s.Update(key, func(st State) State {
+		run = nil
+		if st.Last.IsZero() {
+			st.Last = now
+			return st
+		}
+		var latest time.Time
+		for next := expr.Next(st.Last); !next.IsZero() && !next.After(now); next = expr.Next(next) {
+			latest = next
+		}
+		if latest.IsZero() {
+			return st
+		}
+		run = &Run{At: latest}
+		st.Last = latest
+		switch {
+		case now.Sub(latest) > grace:
+			run.Skip = SkipMissed
+		case st.SkipNext:
+			run.Skip = SkipRequested
+			st.SkipNext = false
+		}
+		return st
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Record records "result" as how the latest run of "key" went.
+func Record(s Store, key, result string) error {
+	_, err := s.Update(key, func(st State) State {
+		st.Result = result
+		return st
+	})
+	return err
+}
+
+// SetSkipNext sets whether the next run of "key" is skipped.
+func SetSkipNext(s Store, key string, skip bool) error {
+	_, err := s.Update(key, func(st State) State {
+		st.SkipNext = skip
+		return st
+	})
+	return err
+}
+
+// Upcoming is the next run of a job, which is shown to users.
+type Upcoming struct {
+	At time.Time `json:"at"`
+	// Skipped is true if a user has asked to skip it.
+	Skipped bool `json:"skipped,omitempty"`
+	// LastResult is how the previous run went.
+	LastResult string `json:"lastResult,omitempty"`
+}
+
+// Next returns the next run of the job "key" scheduled by "expr" after "now".
+func Next(s Store, key string, expr Expr, now time.Time) (Upcoming, error) {
+	st, err := s.Get(key)
+	if err != nil {
+		return Upcoming{}, err
+	}
+	return Upcoming{At: expr.Next(now), Skipped: st.SkipNext, LastResult: st.Result}, nil
+}
+
+// MemoryStore is a Store in memory. It is not shared among goship instances.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]State)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(key string, f func(st State) State) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := f(s.states[key])
+	s.states[key] = st
+	return st, nil
+}
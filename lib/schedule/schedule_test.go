@@ -0,0 +1,162 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) advance(d time.Duration) time.Time {
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func nightly(t *testing.T) Expr {
+	e, err := Parse("0 2 * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse(%q, time.UTC) failed with %v", "0 2 * * *", err)
+	}
+	return e
+}
+
+func TestTickFires(t *testing.T) {
+	s, e, key := NewMemoryStore(), nightly(t), Key("api", "staging", 0)
+	clock := &fakeClock{now: time.Date(2016, 3, 1, 1, 0, 0, 0, time.UTC)}
+	grace := 30 * time.Minute
+
+	// starts the job without running it.
+	if run, err := Tick(s, key, e, grace, clock.now); err != nil || run != nil {
+		t.Fatalf("Tick(...) = %v, %v on the first tick; want no run", run, err)
+	}
+	for _, spec := range []struct {
+		advance time.Duration
+		want    *Run
+	}{
+		{advance: 59 * time.Minute},
+		{advance: time.Minute, want: &Run{At: time.Date(2016, 3, 1, 2, 0, 0, 0, time.UTC)}},
+		// runs at most once.
+		{advance: time.Minute},
+		{advance: 24 * time.Hour, want: &Run{At: time.Date(2016, 3, 2, 2, 0, 0, 0, time.UTC)}},
+	} {
+		now := clock.advance(spec.advance)
+		run, err := Tick(s, key, e, grace, now)
+		if err != nil {
+			t.Fatalf("Tick(...) failed with %v at %v", err, now)
+		}
+		if !sameRun(run, spec.want) {
+			t.Errorf("Tick(...) = %v at %v; want %v", run, now, spec.want)
+		}
+	}
+}
+
+func TestTickSkipNext(t *testing.T) {
+	s, e, key := NewMemoryStore(), nightly(t), Key("api", "staging", 0)
+	clock := &fakeClock{now: time.Date(2016, 3, 1, 1, 0, 0, 0, time.UTC)}
+	grace := 30 * time.Minute
+
+	// can be requested before the job starts.
+	if err := SetSkipNext(s, key, true); err != nil {
+		t.Fatalf("SetSkipNext(...) failed with %v", err)
+	}
+	if _, err := Tick(s, key, e, grace, clock.now); err != nil {
+		t.Fatalf("Tick(...) failed with %v", err)
+	}
+	up, err := Next(s, key, e, clock.now)
+	if err != nil {
+		t.Fatalf("Next(...) failed with %v", err)
+	}
+	if want := (Upcoming{At: time.Date(2016, 3, 1, 2, 0, 0, 0, time.UTC), Skipped: true}); up != want {
+		t.Errorf("Next(...) = %#v; want %#v", up, want)
+	}
+
+	now := clock.advance(time.Hour)
+	run, err := Tick(s, key, e, grace, now)
+	if err != nil {
+		t.Fatalf("Tick(...) failed with %v", err)
+	}
+	if want := (&Run{At: now, Skip: SkipRequested}); !sameRun(run, want) {
+		t.Errorf("Tick(...) = %v; want %v", run, want)
+	}
+
+	// only the next run is skipped.
+	now = clock.advance(24 * time.Hour)
+	run, err = Tick(s, key, e, grace, now)
+	if err != nil {
+		t.Fatalf("Tick(...) failed with %v", err)
+	}
+	if want := (&Run{At: now}); !sameRun(run, want) {
+		t.Errorf("Tick(...) = %v; want %v", run, want)
+	}
+}
+
+func TestTickRecovery(t *testing.T) {
+	e, key := nightly(t), Key("api", "staging", 0)
+	grace := 30 * time.Minute
+	started := time.Date(2016, 3, 1, 1, 0, 0, 0, time.UTC)
+	for _, spec := range []struct {
+		desc string
+		// down is how long no instance ran after the job started.
+		down time.Duration
+		want *Run
+	}{
+		{
+			desc: "within the grace period",
+			down: 3*24*time.Hour + time.Hour + 10*time.Minute,
+			want: &Run{At: time.Date(2016, 3, 4, 2, 0, 0, 0, time.UTC)},
+		},
+		{
+			desc: "after the grace period",
+			down: 3*24*time.Hour + 2*time.Hour,
+			want: &Run{At: time.Date(2016, 3, 4, 2, 0, 0, 0, time.UTC), Skip: SkipMissed},
+		},
+	} {
+		s := NewMemoryStore()
+		clock := &fakeClock{now: started}
+		if _, err := Tick(s, key, e, grace, clock.now); err != nil {
+			t.Fatalf("Tick(...) failed with %v", err)
+		}
+		now := clock.advance(spec.down)
+		run, err := Tick(s, key, e, grace, now)
+		if err != nil {
+			t.Errorf("Tick(...) failed with %v %s", err, spec.desc)
+			continue
+		}
+		if !sameRun(run, spec.want) {
+			t.Errorf("Tick(...) = %v %s; want %v", run, spec.desc, spec.want)
+		}
+		// missed runs do not pile up.
+		now = clock.advance(time.Minute)
+		if run, err := Tick(s, key, e, grace, now); err != nil || run != nil {
+			t.Errorf("Tick(...) = %v, %v after recovery %s; want no run", run, err, spec.desc)
+		}
+	}
+}
+
+func TestTickSkipMissedKeepsRequest(t *testing.T) {
+	s, e, key := NewMemoryStore(), nightly(t), Key("api", "staging", 0)
+	clock := &fakeClock{now: time.Date(2016, 3, 1, 1, 0, 0, 0, time.UTC)}
+	grace := 30 * time.Minute
+	if _, err := Tick(s, key, e, grace, clock.now); err != nil {
+		t.Fatalf("Tick(...) failed with %v", err)
+	}
+	if err := SetSkipNext(s, key, true); err != nil {
+		t.Fatalf("SetSkipNext(...) failed with %v", err)
+	}
+	if run, err := Tick(s, key, e, grace, clock.advance(2*time.Hour)); err != nil || run == nil || run.Skip != SkipMissed {
+		t.Fatalf("Tick(...) = %v, %v; want a missed run", run, err)
+	}
+	// the request applies to the next run which would have run.
+	if run, err := Tick(s, key, e, grace, clock.advance(23*time.Hour)); err != nil || run == nil || run.Skip != SkipRequested {
+		t.Errorf("Tick(...) = %v, %v; want a skipped run", run, err)
+	}
+}
+
+func sameRun(got, want *Run) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return got.At.Equal(want.At) && got.Skip == want.Skip
+}
@@ -0,0 +1,115 @@
+// Package scripts checks out git repositories of deploy scripts for deployments.
+// Each project has a mirror of its script repository in the cache directory, and each deployment gets its own worktree
+// of the mirror so that concurrent deployments of the project never share a checkout.
+package scripts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// defaultRef is the ref which is checked out if none is configured.
+const defaultRef = "master"
+
+// Cache keeps mirrors of script repositories and worktrees of deployments under a directory.
+type Cache struct {
+	dir string
+	// git is the path to the git command.
+	git string
+
+	mu sync.Mutex
+	// projects serializes updates of the mirror of each project.
+	projects map[string]*sync.Mutex
+}
+
+// NewCache returns a new Cache under "dir".
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, git: "git", projects: make(map[string]*sync.Mutex)}
+}
+
+// lock locks the mirror of "project" and returns a function which unlocks it.
+func (c *Cache) lock(project string) func() {
+	c.mu.Lock()
+	m, ok := c.projects[project]
+	if !ok {
+		m = new(sync.Mutex)
+		c.projects[project] = m
+	}
+	c.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// Checkout updates the mirror of the script repository "url" of "project" and checks out "ref" into a new worktree
+// for the deployment "id". Ref defaults to "master". It returns the directory of the worktree and a function which removes it.
+func (c *Cache) Checkout(project, url, ref, id string) (string, func(), error) {
+	if ref == "" {
+		ref = defaultRef
+	}
+	unlock := c.lock(project)
+	defer unlock()
+
+	mirror := filepath.Join(c.dir, project+".git")
+	if err := c.update(mirror, url); err != nil {
+		return "", nil, fmt.Errorf("failed to fetch script repo %s: %v", url, err)
+	}
+	sha, err := c.run(mirror, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("unknown ref %q in script repo %s: %v", ref, url, err)
+	}
+	dir := filepath.Join(c.dir, project+".worktrees", id)
+	if _, err := c.run(mirror, "worktree", "add", "--detach", dir, sha); err != nil {
+		return "", nil, fmt.Errorf("failed to check out %s of script repo %s: %v", ref, url, err)
+	}
+	return dir, func() { c.remove(project, mirror, dir) }, nil
+}
+
+// update clones "url" into "mirror", or fetches it if already cloned.
+func (c *Cache) update(mirror, url string) error {
+	if _, err := os.Stat(mirror); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(mirror), 0755); err != nil {
+			return err
+		}
+		_, err := c.run("", "clone", "--mirror", url, mirror)
+		return err
+	}
+	// the repository may have moved since cloned.
+	if _, err := c.run(mirror, "remote", "set-url", "origin", url); err != nil {
+		return err
+	}
+	_, err := c.run(mirror, "fetch", "--prune", "origin")
+	return err
+}
+
+// remove removes the worktree "dir" of "mirror".
+func (c *Cache) remove(project, mirror, dir string) {
+	unlock := c.lock(project)
+	defer unlock()
+	if err := os.RemoveAll(dir); err != nil {
+		glog.Errorf("Failed to remove worktree %s: %v", dir, err)
+	}
+	if _, err := c.run(mirror, "worktree", "prune"); err != nil {
+		glog.Errorf("Failed to prune worktrees of %s: %v", mirror, err)
+	}
+}
+
+// run runs git with "args" in "dir" and returns its trimmed output. Errors include the output of git.
+func (c *Cache) run(dir string, args ...string) (string, error) {
+	cmd := exec.Command(c.git, args...)
+	cmd.Dir = dir
+	// never ask for credentials on the terminal of goship.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(out.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
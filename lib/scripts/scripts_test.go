@@ -0,0 +1,150 @@
+package scripts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRepo is a bare repository of deploy scripts with a working copy to push commits from.
+type testRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newTestRepo(t *testing.T, dir string) *testRepo {
+	r := &testRepo{t: t, bare: filepath.Join(dir, "ops.git"), work: filepath.Join(dir, "ops")}
+	r.git(dir, "init", "--bare", r.bare)
+	r.git(dir, "clone", r.bare, r.work)
+	r.git(r.work, "checkout", "-b", "master")
+	return r
+}
+
+func (r *testRepo) git(dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		r.t.Fatalf("git %s failed with %v: %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// commit pushes a commit which writes "content" into deploy.sh to "branch".
+func (r *testRepo) commit(branch, content string) {
+	if err := ioutil.WriteFile(filepath.Join(r.work, "deploy.sh"), []byte(content), 0755); err != nil {
+		r.t.Fatalf("ioutil.WriteFile failed with %v", err)
+	}
+	r.git(r.work, "add", "deploy.sh")
+	r.git(r.work, "commit", "-m", content)
+	r.git(r.work, "push", "origin", "HEAD:refs/heads/"+branch)
+}
+
+func readScript(t *testing.T, dir string) string {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "deploy.sh"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed with %v", err)
+	}
+	return string(buf)
+}
+
+func withCache(t *testing.T, f func(c *Cache, repo *testRepo)) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "goship-scripts-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+	f(NewCache(filepath.Join(dir, "cache")), newTestRepo(t, dir))
+}
+
+func TestCheckout(t *testing.T) {
+	withCache(t, func(c *Cache, repo *testRepo) {
+		repo.commit("master", "v1")
+		dir, cleanup, err := c.Checkout("api", repo.bare, "", "deploy-1")
+		if err != nil {
+			t.Fatalf("c.Checkout(%q, %q, %q, %q) failed with %v", "api", repo.bare, "", "deploy-1", err)
+		}
+		if got := readScript(t, dir); got != "v1" {
+			t.Errorf("deploy.sh = %q; want %q", got, "v1")
+		}
+		cleanup()
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("os.Stat(%q) = %v after cleanup; want not exist", dir, err)
+		}
+
+		// fetched on the next checkout
+		repo.commit("master", "v2")
+		repo.commit("release", "v3")
+		for ref, want := range map[string]string{"master": "v2", "release": "v3"} {
+			dir, cleanup, err := c.Checkout("api", repo.bare, ref, "deploy-"+ref)
+			if err != nil {
+				t.Fatalf("c.Checkout(%q, %q, %q, ...) failed with %v", "api", repo.bare, ref, err)
+			}
+			if got := readScript(t, dir); got != want {
+				t.Errorf("deploy.sh = %q at %s; want %q", got, ref, want)
+			}
+			cleanup()
+		}
+	})
+}
+
+func TestCheckoutConcurrent(t *testing.T) {
+	withCache(t, func(c *Cache, repo *testRepo) {
+		repo.commit("master", "v1")
+		var wg sync.WaitGroup
+		dirs := make([]string, 4)
+		errs := make([]error, len(dirs))
+		cleanups := make([]func(), len(dirs))
+		for i := range dirs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				dirs[i], cleanups[i], errs[i] = c.Checkout("api", repo.bare, "master", fmt.Sprintf("deploy-%d", i))
+			}(i)
+		}
+		wg.Wait()
+		seen := make(map[string]bool)
+		for i, dir := range dirs {
+			if errs[i] != nil {
+				t.Errorf("c.Checkout(...) failed with %v in deployment %d", errs[i], i)
+				continue
+			}
+			if seen[dir] {
+				t.Errorf("worktree %s is shared by deployments", dir)
+			}
+			seen[dir] = true
+			// a deployment modifying its checkout does not affect the others.
+			if err := ioutil.WriteFile(filepath.Join(dir, "deploy.sh"), []byte(dir), 0755); err != nil {
+				t.Fatalf("ioutil.WriteFile failed with %v", err)
+			}
+		}
+		for i, dir := range dirs {
+			if errs[i] == nil {
+				if got := readScript(t, dir); got != dir {
+					t.Errorf("deploy.sh in %s = %q; want %q", dir, got, dir)
+				}
+				cleanups[i]()
+			}
+		}
+	})
+}
+
+func TestCheckoutFailure(t *testing.T) {
+	withCache(t, func(c *Cache, repo *testRepo) {
+		repo.commit("master", "v1")
+		if _, _, err := c.Checkout("api", repo.bare+"-missing", "", "deploy-1"); err == nil {
+			t.Errorf("c.Checkout(...) succeeded with a missing repo; want failure")
+		}
+		if _, _, err := c.Checkout("web", repo.bare, "no-such-branch", "deploy-2"); err == nil || !strings.Contains(err.Error(), "no-such-branch") {
+			t.Errorf("c.Checkout(...) = _, _, %v with an unknown ref; want an error naming the ref", err)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Auth configures how to authenticate to hosts. The methods which are set are tried in the order of
+// the private key, the keys in the agent and the password.
+type Auth struct {
+	// KeyPath is the path to a private key file in PEM.
+	KeyPath string
+	// Key is a private key in PEM. It is exclusive with KeyPath.
+	Key string
+	// Passphrase decrypts the private key if it is encrypted.
+	Passphrase string
+	// Agent is the path to the socket of an SSH agent.
+	Agent string
+	// Password is the password of the user.
+	Password string
+}
+
+// hostAuth is the resolved Auth of a host.
+type hostAuth struct {
+	methods []ssh.AuthMethod
+	// id identifies the credentials, so that pooled connections are not shared among different credentials.
+	id string
+	// err is why the Auth could not be resolved.
+	err error
+}
+
+// AuthMethods resolves "a" into the chain of auth methods.
+// It fails if the key cannot be read or decrypted, or the agent is unreachable, so that such mistakes are reported
+// as they are instead of as a failed handshake.
+func AuthMethods(a Auth) ([]ssh.AuthMethod, error) {
+	h := resolve(a)
+	return h.methods, h.err
+}
+
+// WithAuth returns an SSH which connects to hosts as "user" authenticated with "a".
+func WithAuth(user string, a Auth) (SSH, error) {
+	h := resolve(a)
+	if h.err != nil {
+		return SSH{}, h.err
+	}
+	return SSH{cfg: ssh.ClientConfig{User: user, Auth: h.methods}, authID: h.id}, nil
+}
+
+// WithHostAuth returns a copy of "s" which authenticates to "host" with "a" instead.
+// If "a" cannot be resolved, commands on "host" fail with the reason without connecting to it.
+func (s SSH) WithHostAuth(host string, a Auth) SSH {
+	hosts := make(map[string]hostAuth, len(s.hosts)+1)
+	for k, v := range s.hosts {
+		hosts[k] = v
+	}
+	hosts[host] = resolve(a)
+	s.hosts = hosts
+	return s
+}
+
+func resolve(a Auth) hostAuth {
+	var h hostAuth
+	ids := sha256.New()
+	if a.KeyPath != "" && a.Key != "" {
+		return hostAuth{err: errors.New("both a key file and an inline key are given")}
+	}
+	pemBytes := []byte(a.Key)
+	if a.KeyPath != "" {
+		var err error
+		if pemBytes, err = ioutil.ReadFile(a.KeyPath); err != nil {
+			return hostAuth{err: fmt.Errorf("cannot read the private key: %v", err)}
+		}
+	}
+	if len(pemBytes) > 0 {
+		signer, err := parsePrivateKey(pemBytes, a.Passphrase)
+		if err != nil {
+			return hostAuth{err: err}
+		}
+		h.methods = append(h.methods, ssh.PublicKeys(signer))
+		fmt.Fprintf(ids, "key:%s\n", signer.PublicKey().Marshal())
+	}
+	if a.Agent != "" {
+		keys, err := agentKeys(a.Agent)
+		if err != nil {
+			return hostAuth{err: fmt.Errorf("cannot use the agent at %s: %v", a.Agent, err)}
+		}
+		if len(keys) == 0 {
+			return hostAuth{err: fmt.Errorf("the agent at %s has no keys", a.Agent)}
+		}
+		sock := a.Agent
+		h.methods = append(h.methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) { return agentKeys(sock) }))
+		fmt.Fprintf(ids, "agent:%s\n", sock)
+	}
+	if a.Password != "" {
+		h.methods = append(h.methods, ssh.Password(a.Password))
+		fmt.Fprintf(ids, "password:%s\n", a.Password)
+	}
+	if len(h.methods) == 0 {
+		return hostAuth{err: errors.New("no auth methods are given")}
+	}
+	h.id = hex.EncodeToString(ids.Sum(nil)[:16])
+	return h
+}
+
+// parsePrivateKey parses the private key "pemBytes", which is decrypted with "passphrase" if encrypted.
+func parsePrivateKey(pemBytes []byte, passphrase string) (ssh.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("the private key is not in PEM")
+	}
+	if !x509.IsEncryptedPEMBlock(block) {
+		if passphrase != "" {
+			return nil, errors.New("a passphrase is given but the private key is not encrypted")
+		}
+		return parseSigner(pemBytes)
+	}
+	if passphrase == "" {
+		return nil, errors.New("the private key is encrypted but no passphrase is given")
+	}
+	der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the private key: %v", err)
+	}
+	s, err := ssh.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+	if err != nil {
+		// a wrong passphrase can pass the padding check of DecryptPEMBlock.
+		return nil, fmt.Errorf("cannot decrypt the private key: %v", err)
+	}
+	return s, nil
+}
+
+func parseSigner(pemBytes []byte) (ssh.Signer, error) {
+	s, err := ssh.ParsePrivateKey(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	return s, nil
+}
+
+// agentKeys returns signers of the keys in the agent at "sock".
+// The agent is connected for each operation, so that no connection is left open between handshakes.
+func agentKeys(sock string) ([]ssh.Signer, error) {
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]ssh.Signer, 0, len(keys))
+	for _, k := range keys {
+		signers = append(signers, agentKey{sock: sock, pub: k})
+	}
+	return signers, nil
+}
+
+// agentKey is an ssh.Signer of a key in the agent at "sock".
+type agentKey struct {
+	sock string
+	pub  ssh.PublicKey
+}
+
+func (k agentKey) PublicKey() ssh.PublicKey {
+	return k.pub
+}
+
+func (k agentKey) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	conn, err := net.Dial("unix", k.sock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return agent.NewClient(conn).Sign(k.pub, data)
+}
@@ -0,0 +1,206 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/net/context"
+)
+
+const testPassword = "hunter2"
+
+// authFixture has an SSH server which accepts the key "authorized" and testPassword, and credentials in various forms.
+type authFixture struct {
+	srv *fakeServer
+	dir string
+	// keyPEM and encryptedPEM are "authorized" in plaintext and encrypted with "open sesame".
+	keyPEM, encryptedPEM string
+	// otherPEM is a key which the server does not accept.
+	otherPEM string
+	// agentSock serves an agent which has "authorized".
+	agentSock string
+}
+
+func newTestKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(P256, rand.Reader) failed with %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(key) failed with %v", err)
+	}
+	return key, der
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	authorized, der := newTestKey(t)
+	pub, err := ssh.NewPublicKey(&authorized.PublicKey)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey(...) failed with %v", err)
+	}
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte("open sesame"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("x509.EncryptPEMBlock(...) failed with %v", err)
+	}
+	_, otherDER := newTestKey(t)
+
+	dir, err := ioutil.TempDir("", "goship-ssh-auth")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(...) failed with %v", err)
+	}
+	f := &authFixture{
+		dir:          dir,
+		keyPEM:       string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		encryptedPEM: string(pem.EncodeToMemory(encrypted)),
+		otherPEM:     string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherDER})),
+		agentSock:    filepath.Join(dir, "agent.sock"),
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(authorized, nil, ""); err != nil {
+		t.Fatalf("keyring.Add(...) failed with %v", err)
+	}
+	l, err := net.Listen("unix", f.agentSock)
+	if err != nil {
+		t.Fatalf("net.Listen(%q, %q) failed with %v", "unix", f.agentSock, err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				agent.ServeAgent(keyring, c)
+			}()
+		}
+	}()
+
+	f.srv = newFakeServerWithConfig(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), pub.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != testPassword {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	})
+	return f
+}
+
+func (f *authFixture) writeFile(t *testing.T, name, content string) string {
+	fname := filepath.Join(f.dir, name)
+	if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q, ...) failed with %v", fname, err)
+	}
+	return fname
+}
+
+func (f *authFixture) Close() {
+	f.srv.Close()
+	os.RemoveAll(f.dir)
+}
+
+func TestWithAuth(t *testing.T) {
+	f := newAuthFixture(t)
+	defer f.Close()
+	host := f.srv.l.Addr().String()
+	keyFile := f.writeFile(t, "id_ecdsa", f.keyPEM)
+
+	for _, spec := range []struct {
+		desc string
+		auth Auth
+		// resolveErr is a part of the error of resolving the auth, which is empty if it resolves.
+		resolveErr string
+		// rejected means the server rejects the resolved auth.
+		rejected bool
+	}{
+		{desc: "key file", auth: Auth{KeyPath: keyFile}},
+		{desc: "inline key", auth: Auth{Key: f.keyPEM}},
+		{desc: "encrypted key", auth: Auth{Key: f.encryptedPEM, Passphrase: "open sesame"}},
+		{desc: "agent", auth: Auth{Agent: f.agentSock}},
+		{desc: "password", auth: Auth{Password: testPassword}},
+		{desc: "other key then password", auth: Auth{Key: f.otherPEM, Password: testPassword}},
+		{desc: "other key", auth: Auth{Key: f.otherPEM}, rejected: true},
+		{desc: "wrong password", auth: Auth{Password: "hunter3"}, rejected: true},
+		{desc: "wrong passphrase", auth: Auth{Key: f.encryptedPEM, Passphrase: "open sesami"}, resolveErr: "cannot decrypt"},
+		{desc: "missing passphrase", auth: Auth{Key: f.encryptedPEM}, resolveErr: "no passphrase"},
+		{desc: "needless passphrase", auth: Auth{Key: f.keyPEM, Passphrase: "open sesame"}, resolveErr: "not encrypted"},
+		{desc: "unreadable key file", auth: Auth{KeyPath: filepath.Join(f.dir, "missing")}, resolveErr: "cannot read"},
+		{desc: "broken key", auth: Auth{Key: "ssh-rsa AAAA"}, resolveErr: "not in PEM"},
+		{desc: "both keys", auth: Auth{KeyPath: keyFile, Key: f.keyPEM}, resolveErr: "both"},
+		{desc: "unreachable agent", auth: Auth{Agent: filepath.Join(f.dir, "missing.sock")}, resolveErr: "cannot use the agent"},
+		{desc: "nothing", resolveErr: "no auth methods"},
+	} {
+		s, err := WithAuth("deploy", spec.auth)
+		if spec.resolveErr != "" {
+			if err == nil || !strings.Contains(err.Error(), spec.resolveErr) {
+				t.Errorf("%s: WithAuth(%q, auth) failed with %v; want %q", spec.desc, "deploy", err, spec.resolveErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: WithAuth(%q, auth) failed with %v", spec.desc, "deploy", err)
+			continue
+		}
+		_, err = s.WithHostKeys(trustAll{}).Output(context.Background(), host, "true")
+		if spec.rejected && err == nil {
+			t.Errorf("%s: s.Output(ctx, %q, %q) succeeded; want rejected", spec.desc, host, "true")
+		}
+		if !spec.rejected && err != nil {
+			t.Errorf("%s: s.Output(ctx, %q, %q) failed with %v", spec.desc, host, "true", err)
+		}
+	}
+}
+
+func TestWithHostAuth(t *testing.T) {
+	f := newAuthFixture(t)
+	defer f.Close()
+	host := f.srv.l.Addr().String()
+
+	p := NewPool(PoolOptions{})
+	defer p.closeAll()
+	base, err := WithAuth("deploy", Auth{Password: "hunter3"})
+	if err != nil {
+		t.Fatalf("WithAuth(%q, auth) failed with %v", "deploy", err)
+	}
+	base = base.WithHostKeys(trustAll{}).WithPool(p)
+	if _, err := base.Output(context.Background(), host, "true"); err == nil {
+		t.Fatalf("base.Output(ctx, %q, %q) succeeded; want rejected", host, "true")
+	}
+
+	s := base.WithHostAuth(host, Auth{Key: f.keyPEM})
+	mustOutput(t, s, host, "true")
+	mustOutput(t, base.WithHostAuth(host, Auth{Password: testPassword}), host, "true")
+	if got, want := p.Len(), 2; got != want {
+		t.Errorf("p.Len() = %d; want %d, one per credentials", got, want)
+	}
+	if _, ok := base.hosts[host]; ok {
+		t.Errorf("base.hosts = %v; want WithHostAuth to leave the original alone", base.hosts)
+	}
+
+	broken := base.WithHostAuth(host, Auth{Key: f.encryptedPEM})
+	if _, err := broken.Output(context.Background(), host, "true"); err == nil || !strings.Contains(err.Error(), "invalid ssh auth") {
+		t.Errorf("broken.Output(ctx, %q, %q) failed with %v; want the invalid auth", host, "true", err)
+	}
+}
@@ -0,0 +1,214 @@
+package ssh
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+)
+
+// PoolOptions configures Pool.
+type PoolOptions struct {
+	// IdleTimeout is how long connections are kept without being used. Defaults to 5 minutes.
+	IdleTimeout time.Duration
+	// MaxConns is the maximum number of open connections. Commands run on one-off connections while the pool is full. Defaults to 256.
+	MaxConns int
+}
+
+const (
+	defaultIdleTimeout = 5 * time.Minute
+	defaultMaxConns    = 256
+)
+
+// Pool keeps authenticated connections to hosts so that commands reuse them instead of a handshake per command,
+// e.g. polling revisions of hosts every minute. Connections are keyed by the address, the user and the credentials.
+// Pool.Run must be running to keep the connections alive and to close idle ones.
+type Pool struct {
+	opts PoolOptions
+	// dial opens a new connection. It is ssh.Dial except in tests.
+	dial func(network, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error)
+	now  func() time.Time
+
+	mu    sync.Mutex
+	conns map[poolKey]*pooledConn
+}
+
+type poolKey struct {
+	addr, user string
+	// auth identifies the credentials, which are empty for the default ones.
+	auth string
+}
+
+type pooledConn struct {
+	client   *ssh.Client
+	lastUsed time.Time
+	// inUse is the number of sessions running on the connection.
+	inUse int
+}
+
+// NewPool returns a new empty Pool.
+func NewPool(opts PoolOptions) *Pool {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = defaultMaxConns
+	}
+	return &Pool{opts: opts, dial: ssh.Dial, now: time.Now, conns: make(map[poolKey]*pooledConn)}
+}
+
+// session opens a new session to "addr" with "cfg", whose credentials are identified by "authID", on a pooled connection,
+// which is dialed if there is none.
+// A pooled connection which fails to open a session is regarded as broken, and is dialed again once.
+// The returned function must be called when the session is closed.
+func (p *Pool) session(addr, authID string, cfg *ssh.ClientConfig) (*ssh.Session, func(), error) {
+	key := poolKey{addr: addr, user: cfg.User, auth: authID}
+	if c := p.acquire(key); c != nil {
+		s, err := c.client.NewSession()
+		if err == nil {
+			return s, func() { p.release(key, c) }, nil
+		}
+		glog.Warningf("Dialing %s@%s again since its pooled connection is broken: %v", cfg.User, addr, err)
+		p.discard(key, c)
+	}
+	client, err := p.dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	c, ok := p.add(key, client)
+	if !ok {
+		// the pool is full of connections in use.
+		return s, func() { client.Close() }, nil
+	}
+	return s, func() { p.release(key, c) }, nil
+}
+
+// acquire returns the pooled connection of "key" marked in use, or nil if there is none.
+func (p *Pool) acquire(key poolKey) *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.conns[key]
+	if !ok {
+		return nil
+	}
+	c.inUse++
+	return c
+}
+
+// add pools "client" as the connection of "key" marked in use. It evicts the least recently used idle connection
+// if the pool is full, and returns false if all of them are in use.
+func (p *Pool) add(key poolKey, client *ssh.Client) (*pooledConn, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.conns[key]; ok {
+		// dialed concurrently by another command.
+		if old.inUse == 0 {
+			old.client.Close()
+		}
+		delete(p.conns, key)
+	}
+	if len(p.conns) >= p.opts.MaxConns {
+		var lru *poolKey
+		for k, c := range p.conns {
+			if c.inUse == 0 && (lru == nil || c.lastUsed.Before(p.conns[*lru].lastUsed)) {
+				k := k
+				lru = &k
+			}
+		}
+		if lru == nil {
+			return nil, false
+		}
+		p.conns[*lru].client.Close()
+		delete(p.conns, *lru)
+	}
+	c := &pooledConn{client: client, lastUsed: p.now(), inUse: 1}
+	p.conns[key] = c
+	return c, true
+}
+
+// release marks "c" no longer in use. It closes "c" if it has been replaced or evicted meanwhile.
+func (p *Pool) release(key poolKey, c *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.inUse--
+	c.lastUsed = p.now()
+	if p.conns[key] != c && c.inUse == 0 {
+		c.client.Close()
+	}
+}
+
+// discard closes the broken connection "c" and removes it from the pool.
+func (p *Pool) discard(key poolKey, c *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns[key] == c {
+		delete(p.conns, key)
+	}
+	c.client.Close()
+}
+
+// evictIdle closes the connections which have not been used for IdleTimeout at "now", and returns the rest.
+func (p *Pool) evictIdle(now time.Time) map[poolKey]*pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	alive := make(map[poolKey]*pooledConn)
+	for key, c := range p.conns {
+		if c.inUse == 0 && now.Sub(c.lastUsed) >= p.opts.IdleTimeout {
+			glog.V(1).Infof("Closing idle connection to %s@%s", key.user, key.addr)
+			c.client.Close()
+			delete(p.conns, key)
+			continue
+		}
+		alive[key] = c
+	}
+	return alive
+}
+
+// keepAlive sends a keepalive request over "c", and discards it if it is broken.
+func (p *Pool) keepAlive(key poolKey, c *pooledConn) {
+	if _, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+		glog.Warningf("Closing broken connection to %s@%s: %v", key.user, key.addr, err)
+		p.discard(key, c)
+	}
+}
+
+// Len returns the number of open connections in the pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// Run closes idle connections and sends keepalives over the others every "interval" until "ctx" is done.
+// Then it closes all the connections.
+func (p *Pool) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.closeAll()
+			return
+		case <-t.C:
+			for key, c := range p.evictIdle(p.now()) {
+				go p.keepAlive(key, c)
+			}
+		}
+	}
+}
+
+func (p *Pool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, c := range p.conns {
+		c.client.Close()
+		delete(p.conns, key)
+	}
+}
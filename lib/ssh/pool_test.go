@@ -0,0 +1,291 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/context"
+)
+
+// fakeServer is an SSH server which echoes commands back and counts handshakes.
+type fakeServer struct {
+	l   net.Listener
+	cfg *ssh.ServerConfig
+
+	mu         sync.Mutex
+	handshakes int
+	conns      []ssh.Conn
+}
+
+func newFakeServer(t testing.TB) *fakeServer {
+	return newFakeServerWithConfig(t, &ssh.ServerConfig{NoClientAuth: true})
+}
+
+// newFakeServerWithConfig returns a fakeServer which authenticates clients as configured in "cfg".
+func newFakeServerWithConfig(t testing.TB, cfg *ssh.ServerConfig) *fakeServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(P256, rand.Reader) failed with %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromKey(key) failed with %v", err)
+	}
+	cfg.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(%q, %q) failed with %v", "tcp", "127.0.0.1:0", err)
+	}
+	s := &fakeServer{l: l, cfg: cfg}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *fakeServer) handle(c net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, s.cfg)
+	if err != nil {
+		c.Close()
+		return
+	}
+	s.mu.Lock()
+	s.handshakes++
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+	// refuses keepalives, which still proves that the connection is alive.
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range reqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var exec struct{ Command string }
+				ssh.Unmarshal(req.Payload, &exec)
+				req.Reply(true, nil)
+				ch.Write([]byte(exec.Command))
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) handshakeCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshakes
+}
+
+// dropAll breaks all the connections from the server side.
+func (s *fakeServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) Close() {
+	s.l.Close()
+	s.dropAll()
+}
+
+// trustAll is a HostKeyChecker which trusts any key.
+type trustAll struct{}
+
+func (trustAll) Check(host string, key ssh.PublicKey) error {
+	return nil
+}
+
+func testSSH(user string, p *Pool) SSH {
+	s := SSH{cfg: ssh.ClientConfig{User: user}}
+	return s.WithHostKeys(trustAll{}).WithPool(p)
+}
+
+func mustOutput(t testing.TB, s SSH, host, cmd string) {
+	out, err := s.Output(context.Background(), host, cmd)
+	if err != nil {
+		t.Fatalf("s.Output(ctx, %q, %q) failed with %v", host, cmd, err)
+	}
+	if got := string(out); got != cmd {
+		t.Fatalf("s.Output(ctx, %q, %q) = %q; want %q", host, cmd, got, cmd)
+	}
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+
+	p := NewPool(PoolOptions{})
+	defer p.closeAll()
+	alice, bob := testSSH("alice", p), testSSH("bob", p)
+	for i := 0; i < 5; i++ {
+		mustOutput(t, alice, host, "cat /srv/REVISION")
+		mustOutput(t, bob, host, "cat /srv/REVISION")
+	}
+	if got, want := srv.handshakeCount(), 2; got != want {
+		t.Errorf("handshakes = %d; want %d, one per user", got, want)
+	}
+	if got, want := p.Len(), 2; got != want {
+		t.Errorf("p.Len() = %d; want %d", got, want)
+	}
+
+	// without pool
+	for i := 0; i < 3; i++ {
+		mustOutput(t, testSSH("alice", nil), host, "cat /srv/REVISION")
+	}
+	if got, want := srv.handshakeCount(), 5; got != want {
+		t.Errorf("handshakes = %d; want %d", got, want)
+	}
+}
+
+func TestPoolEvictsIdle(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	p := NewPool(PoolOptions{IdleTimeout: time.Minute})
+	p.now = func() time.Time { return now }
+	defer p.closeAll()
+	s := testSSH("alice", p)
+	mustOutput(t, s, host, "true")
+
+	now = now.Add(59 * time.Second)
+	if alive := p.evictIdle(now); len(alive) != 1 {
+		t.Errorf("p.evictIdle(now+59s) = %v; want the connection kept", alive)
+	}
+	mustOutput(t, s, host, "true")
+	// idle since the last use
+	now = now.Add(time.Minute)
+	if alive := p.evictIdle(now); len(alive) != 0 {
+		t.Errorf("p.evictIdle(now+1m) = %v; want the connection closed", alive)
+	}
+	if got := p.Len(); got != 0 {
+		t.Errorf("p.Len() = %d; want 0", got)
+	}
+	mustOutput(t, s, host, "true")
+	if got, want := srv.handshakeCount(), 2; got != want {
+		t.Errorf("handshakes = %d; want %d", got, want)
+	}
+}
+
+func TestPoolRedialsBroken(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+
+	p := NewPool(PoolOptions{})
+	defer p.closeAll()
+	s := testSSH("alice", p)
+	mustOutput(t, s, host, "true")
+	srv.dropAll()
+	mustOutput(t, s, host, "true")
+	if got, want := srv.handshakeCount(), 2; got != want {
+		t.Errorf("handshakes = %d; want %d", got, want)
+	}
+	if got, want := p.Len(), 1; got != want {
+		t.Errorf("p.Len() = %d; want %d", got, want)
+	}
+
+	// keepalives find broken connections before commands.
+	for key, c := range p.evictIdle(time.Now()) {
+		p.keepAlive(key, c)
+	}
+	if got, want := p.Len(), 1; got != want {
+		t.Errorf("p.Len() = %d after keepalives; want %d", got, want)
+	}
+	srv.dropAll()
+	for key, c := range p.evictIdle(time.Now()) {
+		p.keepAlive(key, c)
+	}
+	if got := p.Len(); got != 0 {
+		t.Errorf("p.Len() = %d after keepalives over broken connections; want 0", got)
+	}
+}
+
+func TestPoolMaxConns(t *testing.T) {
+	srv := newFakeServer(t)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+
+	p := NewPool(PoolOptions{MaxConns: 1})
+	defer p.closeAll()
+	mustOutput(t, testSSH("alice", p), host, "true")
+	mustOutput(t, testSSH("bob", p), host, "true")
+	if got, want := p.Len(), 1; got != want {
+		t.Errorf("p.Len() = %d; want %d", got, want)
+	}
+	if c := p.acquire(poolKey{addr: host, user: "alice"}); c != nil {
+		t.Errorf("connection of alice = %#v; want evicted", c)
+	}
+
+	// the connection of bob is in use.
+	c := p.acquire(poolKey{addr: host, user: "bob"})
+	if c == nil {
+		t.Fatalf("connection of bob is not pooled")
+	}
+	mustOutput(t, testSSH("carol", p), host, "true")
+	if got, want := p.Len(), 1; got != want {
+		t.Errorf("p.Len() = %d; want %d", got, want)
+	}
+	p.release(poolKey{addr: host, user: "bob"}, c)
+	if got, want := srv.handshakeCount(), 3; got != want {
+		t.Errorf("handshakes = %d; want %d", got, want)
+	}
+}
+
+// benchmarkPolling polls 20 hosts with "p" in each iteration, and reports the number of handshakes.
+func benchmarkPolling(b *testing.B, p *Pool) {
+	srv := newFakeServer(b)
+	defer srv.Close()
+	host := srv.l.Addr().String()
+	if p != nil {
+		defer p.closeAll()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 20; j++ {
+			mustOutput(b, testSSH(fmt.Sprintf("user%d", j), p), host, "cat /srv/REVISION")
+		}
+	}
+	b.StopTimer()
+	b.Logf("%d handshakes for %d commands", srv.handshakeCount(), 20*b.N)
+}
+
+func BenchmarkPollingWithoutPool(b *testing.B) {
+	benchmarkPolling(b, nil)
+}
+
+func BenchmarkPollingWithPool(b *testing.B) {
+	benchmarkPolling(b, NewPool(PoolOptions{}))
+}
@@ -20,6 +20,20 @@ const (
 
 type SSH struct {
 	cfg ssh.ClientConfig
+	// authID identifies the credentials of cfg. See hostAuth.
+	authID string
+	// hosts overrides the credentials of cfg by host names.
+	hosts map[string]hostAuth
+	// hostKeys verifies host keys if not nil.
+	hostKeys HostKeyChecker
+	// pool reuses connections if not nil.
+	pool *Pool
+}
+
+// HostKeyChecker verifies keys of hosts, which are identified by their names in the config.
+type HostKeyChecker interface {
+	// Check returns an error unless "key" is trusted for "host".
+	Check(host string, key ssh.PublicKey) error
 }
 
 func WithPrivateKeyFile(user, fname string) (SSH, error) {
@@ -39,24 +53,56 @@ func WithPrivateKeyFile(user, fname string) (SSH, error) {
 	}, nil
 }
 
+// WithHostKeys returns a copy of "s" which refuses hosts unless "c" trusts their keys.
+func (s SSH) WithHostKeys(c HostKeyChecker) SSH {
+	s.hostKeys = c
+	return s
+}
+
+// WithPool returns a copy of "s" which runs commands on connections pooled in "p".
+// Keys of hosts are verified only when connections are dialed.
+func (s SSH) WithPool(p *Pool) SSH {
+	s.pool = p
+	return s
+}
+
+// dialAddress returns "host" with the well-known port unless it has a port.
+// "host" is a host name, an IPv4 address or an IPv6 address, which is bracketed if followed by a port.
+func dialAddress(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return net.JoinHostPort(host[1:len(host)-1], fmt.Sprintf("%d", wellKnownPort))
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, fmt.Sprintf("%d", wellKnownPort))
+}
+
 // Output runs the given command on the remote server.
 // It returns the stdout outputs of the command.
 func (s SSH) Output(ctx context.Context, host, cmd string) ([]byte, error) {
-	// TODO(yugui) Support IPv6 address without port number
-	if !strings.Contains(host, ":") {
-		host = net.JoinHostPort(host, fmt.Sprintf("%d", wellKnownPort))
-	}
+	name, host := host, dialAddress(host)
 	glog.V(1).Infof("Running %q in %s@%s", cmd, s.cfg.User, host)
-	client, err := ssh.Dial("tcp", host, &s.cfg)
-	if err != nil {
-		return nil, err
+	cfg, authID := s.cfg, s.authID
+	if a, ok := s.hosts[name]; ok {
+		if a.err != nil {
+			return nil, fmt.Errorf("invalid ssh auth of %s: %v", name, a.err)
+		}
+		cfg.Auth, authID = a.methods, a.id
 	}
-	defer client.Close()
-
-	session, err := client.NewSession()
+	if s.hostKeys != nil {
+		cfg.HostKeyCallback = func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if err := s.hostKeys.Check(name, key); err != nil {
+				return fmt.Errorf("refusing %s: %v", name, err)
+			}
+			return nil
+		}
+	}
+	session, release, err := s.newSession(host, authID, &cfg)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	defer session.Close()
 
 	var outBuf, errBuf bytes.Buffer
@@ -83,3 +129,26 @@ func (s SSH) Output(ctx context.Context, host, cmd string) ([]byte, error) {
 	}
 	return outBuf.Bytes(), nil
 }
+
+// Quote quotes "s" as a single word of sh, so that commands given to Output can take arbitrary arguments.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// newSession opens a new session to "addr" on a pooled connection if "s" has a pool, or on a new connection otherwise.
+// "authID" identifies the credentials in "cfg". The returned function must be called when the session is closed.
+func (s SSH) newSession(addr, authID string, cfg *ssh.ClientConfig) (*ssh.Session, func(), error) {
+	if s.pool != nil {
+		return s.pool.session(addr, authID, cfg)
+	}
+	client, err := ssh.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return session, func() { client.Close() }, nil
+}
@@ -0,0 +1,40 @@
+package ssh
+
+import (
+	"testing"
+)
+
+func TestDialAddress(t *testing.T) {
+	for _, spec := range []struct {
+		host string
+		want string
+	}{
+		{host: "web1.example.com", want: "web1.example.com:22"},
+		{host: "web1.example.com:2222", want: "web1.example.com:2222"},
+		{host: "10.0.0.1", want: "10.0.0.1:22"},
+		{host: "10.0.0.1:2222", want: "10.0.0.1:2222"},
+		{host: "[2001:db8::1]", want: "[2001:db8::1]:22"},
+		{host: "[2001:db8::1]:2222", want: "[2001:db8::1]:2222"},
+		{host: "2001:db8::1", want: "[2001:db8::1]:22"},
+	} {
+		if got := dialAddress(spec.host); got != spec.want {
+			t.Errorf("dialAddress(%q) = %q; want %q", spec.host, got, spec.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, spec := range []struct {
+		s    string
+		want string
+	}{
+		{s: "", want: "''"},
+		{s: "/var/lib/goship", want: "'/var/lib/goship'"},
+		{s: "$(rm -rf /); echo", want: "'$(rm -rf /); echo'"},
+		{s: "it's", want: `'it'\''s'`},
+	} {
+		if got := Quote(spec.s); got != spec.want {
+			t.Errorf("Quote(%q) = %q; want %q", spec.s, got, spec.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package subscriptions stores which deployments goship users want to hear about,
+// and resolves the users to notify of a finished deployment.
+package subscriptions
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains the settings of users by their names.
+	keyPrefix = "/goship/subscriptions"
+)
+
+// Subscription subscribes a user to deployments into an environment.
+type Subscription struct {
+	// Project is the project of the environment. Environments of the name in all the projects match if empty.
+	Project     string `json:"project,omitempty"`
+	Environment string `json:"environment"`
+	// MyCommits limits the notifications to the deployments which ship commits authored by the user.
+	MyCommits bool `json:"my_commits,omitempty"`
+}
+
+// matches returns true iff "s" subscribes to deployments of "proj" into "env".
+func (s Subscription) matches(proj, env string) bool {
+	return (s.Project == "" || s.Project == proj) && s.Environment == env
+}
+
+// Settings are the subscriptions of a user and where to send the notifications.
+type Settings struct {
+	// User is the goship user. It is the name of the key in etcd rather than stored.
+	User string `json:"-"`
+	// GitHubLogin is matched against the authors of commits. It defaults to User.
+	GitHubLogin string `json:"github_login,omitempty"`
+	// Email receives the notifications if set. They are sent as Slack direct messages otherwise.
+	Email         string         `json:"email,omitempty"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// Login returns the GitHub login of the user.
+func (s Settings) Login() string {
+	if s.GitHubLogin != "" {
+		return s.GitHubLogin
+	}
+	return s.User
+}
+
+// Validate returns an error if "s" cannot be stored.
+func (s Settings) Validate() error {
+	if s.Email != "" && (!strings.Contains(s.Email, "@") || strings.ContainsAny(s.Email, " \r\n<>,")) {
+		return fmt.Errorf("invalid email %q", s.Email)
+	}
+	for i, sub := range s.Subscriptions {
+		if sub.Environment == "" {
+			return fmt.Errorf("subscription %d has no environment", i)
+		}
+	}
+	return nil
+}
+
+func key(user string) (string, error) {
+	if user == "" || user == "." || user == ".." || strings.Contains(user, "/") {
+		return "", fmt.Errorf("invalid user name %q", user)
+	}
+	return path.Join(keyPrefix, user), nil
+}
+
+// Load returns the settings of "user" stored in etcd. It returns empty settings if the user has not stored any.
+func Load(client config.ETCDInterface, user string) (Settings, error) {
+	k, err := key(user)
+	if err != nil {
+		return Settings{}, err
+	}
+	resp, err := client.Get(k, false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return Settings{User: user}, nil
+	}
+	if err != nil {
+		return Settings{}, err
+	}
+	s := Settings{User: user}
+	if err := json.Unmarshal([]byte(resp.Node.Value), &s); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// Save stores "s" as the settings of "user" into etcd.
+func Save(client config.ETCDInterface, user string, s Settings) error {
+	k, err := key(user)
+	if err != nil {
+		return err
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(k, string(buf), 0)
+	return err
+}
+
+// List returns the settings of all the users who have stored any, in the order of their names.
+// Malformed settings are skipped with an error returned with the rest.
+func List(client config.ETCDInterface) ([]Settings, error) {
+	resp, err := client.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var (
+		all   []Settings
+		first error
+	)
+	for _, n := range resp.Node.Nodes {
+		s := Settings{User: path.Base(n.Key)}
+		if err := json.Unmarshal([]byte(n.Value), &s); err != nil {
+			if first == nil {
+				first = fmt.Errorf("malformed subscriptions of %s: %v", s.User, err)
+			}
+			continue
+		}
+		all = append(all, s)
+	}
+	sort.Sort(byUser(all))
+	return all, first
+}
+
+type byUser []Settings
+
+func (s byUser) Len() int           { return len(s) }
+func (s byUser) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byUser) Less(i, j int) bool { return s[i].User < s[j].User }
+
+// Commit is a commit shipped by a deployment.
+type Commit struct {
+	SHA string
+	// Author is the GitHub login of the author, or empty if the author has no GitHub account.
+	Author string
+	// Subject is the first line of the message.
+	Subject string
+}
+
+// Delivery is a notification to a user about a deployment.
+type Delivery struct {
+	Settings
+	// Commits are the shipped commits authored by the user.
+	Commits []Commit
+}
+
+// Subscribed returns true iff any of "all" subscribes to deployments of "proj" into "env",
+// so that commits need not be fetched for deployments nobody follows.
+func Subscribed(all []Settings, proj, env string) bool {
+	for _, s := range all {
+		for _, sub := range s.Subscriptions {
+			if sub.matches(proj, env) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resolve returns a delivery per user of "all" subscribed to the deployment of "proj" into "env" which shipped "commits".
+// Users subscribed to the environment are notified with their commits if any, and users subscribed only to their commits
+// are notified only if they authored any of "commits". Users are notified once however many of their subscriptions match.
+func Resolve(all []Settings, proj, env string, commits []Commit) []Delivery {
+	var ds []Delivery
+	seen := make(map[string]bool)
+	for _, s := range all {
+		if seen[s.User] {
+			continue
+		}
+		var followed, matched bool
+		for _, sub := range s.Subscriptions {
+			if sub.matches(proj, env) {
+				matched = true
+				followed = followed || !sub.MyCommits
+			}
+		}
+		if !matched {
+			continue
+		}
+		mine := authoredBy(commits, s.Login())
+		if !followed && len(mine) == 0 {
+			continue
+		}
+		seen[s.User] = true
+		ds = append(ds, Delivery{Settings: s, Commits: mine})
+	}
+	return ds
+}
+
+// authoredBy returns the commits of "commits" authored by the GitHub user "login".
+func authoredBy(commits []Commit, login string) []Commit {
+	var mine []Commit
+	for _, c := range commits {
+		// GitHub logins are case-insensitive.
+		if c.Author != "" && strings.EqualFold(c.Author, login) {
+			mine = append(mine, c)
+		}
+	}
+	return mine
+}
@@ -0,0 +1,142 @@
+package subscriptions
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+type mockStore map[string]string
+
+func (s mockStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s[key]; ok {
+		return &etcd.Response{Action: "get", Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	dir := &etcd.Node{Key: key, Dir: true}
+	for k, v := range s {
+		if path.Dir(k) == key {
+			dir.Nodes = append(dir.Nodes, &etcd.Node{Key: k, Value: v})
+		}
+	}
+	if len(dir.Nodes) == 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Action: "get", Node: dir}, nil
+}
+
+func (s mockStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s[key] = value
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func TestPersistence(t *testing.T) {
+	s := make(mockStore)
+	if all, err := List(s); err != nil || len(all) != 0 {
+		t.Errorf("List(s) = %#v, %v; want none", all, err)
+	}
+
+	bob := Settings{Email: "bob@example.com", Subscriptions: []Subscription{{Project: "api", Environment: "staging"}}}
+	alice := Settings{GitHubLogin: "Alice-GH", Subscriptions: []Subscription{{Environment: "production", MyCommits: true}}}
+	for user, settings := range map[string]Settings{"bob": bob, "alice": alice} {
+		if err := Save(s, user, settings); err != nil {
+			t.Fatalf("Save(s, %q, %#v) failed with %v", user, settings, err)
+		}
+	}
+	got, err := Load(s, "alice")
+	if err != nil {
+		t.Fatalf("Load(s, %q) failed with %v", "alice", err)
+	}
+	alice.User = "alice"
+	if !reflect.DeepEqual(got, alice) {
+		t.Errorf("Load(s, %q) = %#v; want %#v", "alice", got, alice)
+	}
+	if got, err := Load(s, "carol"); err != nil || got.User != "carol" || len(got.Subscriptions) != 0 {
+		t.Errorf("Load(s, %q) = %#v, %v; want empty settings", "carol", got, err)
+	}
+
+	all, err := List(s)
+	if err != nil {
+		t.Fatalf("List(s) failed with %v", err)
+	}
+	bob.User = "bob"
+	if want := []Settings{alice, bob}; !reflect.DeepEqual(all, want) {
+		t.Errorf("List(s) = %#v; want %#v", all, want)
+	}
+
+	for _, bad := range []Settings{
+		{Subscriptions: []Subscription{{Project: "api"}}},
+		{Email: "bob"},
+		{Email: "bob@example.com, eve@example.com"},
+	} {
+		if err := Save(s, "bob", bad); err == nil {
+			t.Errorf("Save(s, %q, %#v) succeeded; want failure", "bob", bad)
+		}
+	}
+	for _, user := range []string{"", "..", "../config"} {
+		if err := Save(s, user, bob); err == nil {
+			t.Errorf("Save(s, %q, ...) succeeded; want failure", user)
+		}
+	}
+}
+
+func TestResolveMatchesAuthors(t *testing.T) {
+	commits := []Commit{
+		{SHA: "1111111", Author: "alice-gh", Subject: "Fix login"},
+		{SHA: "2222222", Author: "bob", Subject: "Add search"},
+		{SHA: "3333333", Subject: "Commit without a GitHub account"},
+		{SHA: "4444444", Author: "Alice-GH", Subject: "Fix logout"},
+	}
+	all := []Settings{
+		{User: "alice", GitHubLogin: "ALICE-gh", Subscriptions: []Subscription{{Environment: "production", MyCommits: true}}},
+		{User: "bob", Subscriptions: []Subscription{{Project: "api", Environment: "production", MyCommits: true}}},
+		{User: "carol", Subscriptions: []Subscription{{Environment: "production", MyCommits: true}}},
+		// an empty login must not match commits without authors.
+		{User: "", Subscriptions: []Subscription{{Environment: "production", MyCommits: true}}},
+	}
+
+	got := Resolve(all, "api", "production", commits)
+	want := []Delivery{
+		{Settings: all[0], Commits: []Commit{commits[0], commits[3]}},
+		{Settings: all[1], Commits: []Commit{commits[1]}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve(all, %q, %q, commits) = %#v; want %#v", "api", "production", got, want)
+	}
+
+	if got := Resolve(all, "web", "production", commits); len(got) != 1 || got[0].User != "alice" {
+		t.Errorf("Resolve(all, %q, %q, commits) = %#v; want only alice subscribed to all projects", "web", "production", got)
+	}
+	if got := Resolve(all, "api", "staging", commits); len(got) != 0 {
+		t.Errorf("Resolve(all, %q, %q, commits) = %#v; want none", "api", "staging", got)
+	}
+}
+
+func TestResolveOncePerUser(t *testing.T) {
+	commits := []Commit{{SHA: "1111111", Author: "alice", Subject: "Fix login"}}
+	alice := Settings{User: "alice", Subscriptions: []Subscription{
+		{Environment: "production", MyCommits: true},
+		{Project: "api", Environment: "production"},
+		{Environment: "production"},
+	}}
+	bob := Settings{User: "bob", Subscriptions: []Subscription{
+		{Project: "api", Environment: "production"},
+		{Project: "api", Environment: "production", MyCommits: true},
+	}}
+	all := []Settings{alice, bob, alice}
+
+	got := Resolve(all, "api", "production", commits)
+	want := []Delivery{
+		{Settings: alice, Commits: []Commit{commits[0]}},
+		{Settings: bob},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve(all, %q, %q, commits) = %#v; want %#v", "api", "production", got, want)
+	}
+	if !Subscribed(all, "api", "production") || Subscribed(all, "api", "staging") {
+		t.Errorf("Subscribed(all, ...) = %t for production and %t for staging; want true and false",
+			Subscribed(all, "api", "production"), Subscribed(all, "api", "staging"))
+	}
+}
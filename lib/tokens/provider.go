@@ -0,0 +1,44 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/auth"
+)
+
+// provider authenticates requests with tokens in the Authorization header.
+type provider struct {
+	s   Store
+	rec *Recorder
+	now func() time.Time
+}
+
+// NewProvider returns an auth.Provider which authenticates requests with "Authorization: Bearer <secret>".
+// Requests other than GET and HEAD require the deploy scope. Uses of tokens are recorded into "rec".
+func NewProvider(s Store, rec *Recorder) auth.Provider {
+	return provider{s: s, rec: rec, now: time.Now}
+}
+
+func (p provider) Authenticate(r *http.Request) (auth.User, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return auth.User{}, errors.New("no bearer token")
+	}
+	now := p.now()
+	t, err := Verify(p.s, strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")), now)
+	if err != nil {
+		return auth.User{}, err
+	}
+	if t.HasScope(ScopeShare) {
+		return auth.User{}, fmt.Errorf("token %s only authenticates wallboards", t.ID)
+	}
+	if r.Method != "GET" && r.Method != "HEAD" && !t.HasScope(ScopeDeploy) {
+		return auth.User{}, fmt.Errorf("token %s does not have %s scope", t.ID, ScopeDeploy)
+	}
+	p.rec.Touch(t.ID, now)
+	return t.Owner(), nil
+}
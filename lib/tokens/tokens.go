@@ -0,0 +1,294 @@
+// Package tokens manages API tokens which authenticate requests on behalf of goship users.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+const (
+	// keyPrefix is the etcd directory which contains tokens.
+	keyPrefix = "/goship/tokens"
+	// secretPrefix makes secrets recognizable, e.g. by secret scanners.
+	secretPrefix = "goship_"
+)
+
+// Scopes of tokens
+const (
+	// ScopeRead allows reading with GET and HEAD requests.
+	ScopeRead = "read"
+	// ScopeDeploy allows the other requests, e.g. deployments and locks.
+	ScopeDeploy = "deploy"
+	// ScopeShare allows viewing the wallboard of the projects of the token, but no API requests. See CreateShare.
+	ScopeShare = "share"
+)
+
+// ErrNotFound means that the token does not exist or belongs to another user.
+var ErrNotFound = errors.New("no such token")
+
+// Store is the subset of etcd.Client which stores tokens.
+type Store interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+	Delete(key string, recursive bool) (*etcd.Response, error)
+}
+
+// Token is an API token of a user.
+// The secret of the token is returned only by Create. It is never stored but only its digest.
+type Token struct {
+	ID      string    `json:"id"`
+	User    string    `json:"user"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+	// LastUsed is nil if the token has not been used yet.
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	// Expires is nil if the token does not expire.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Projects are the projects which a share token can view.
+	Projects []string `json:"projects,omitempty"`
+	// Provider and Groups are those of the user who created the token, so that the token is granted no more than the user.
+	Provider string   `json:"provider,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Owner returns the user who the token authenticates requests on behalf of.
+func (t Token) Owner() auth.User {
+	return auth.User{Name: t.User, Provider: auth.ProviderToken, TokenProvider: t.Provider, Groups: t.Groups}
+}
+
+// HasScope returns true iff the token has "scope".
+func (t Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Shares returns true iff "t" is a share token which can view "project".
+func (t Token) Shares(project string) bool {
+	if !t.HasScope(ScopeShare) {
+		return false
+	}
+	for _, p := range t.Projects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// record is a token stored in etcd.
+type record struct {
+	Token
+	// Digest is the hex-encoded SHA-256 digest of the secret.
+	Digest string `json:"digest"`
+}
+
+func key(id string) string {
+	return path.Join(keyPrefix, id)
+}
+
+func digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Create issues a new token of "u" with "scopes", which expires after "ttl" unless "ttl" is zero.
+// It returns the token and its secret. The secret cannot be retrieved again.
+func Create(s Store, u auth.User, name string, scopes []string, ttl time.Duration, now time.Time) (Token, string, error) {
+	if u.Name == "" {
+		return Token{}, "", errors.New("no user specified")
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return Token{}, "", errors.New("name: no name specified")
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", errors.New("scopes: no scopes specified")
+	}
+	for _, sc := range scopes {
+		if sc == ScopeShare {
+			return Token{}, "", fmt.Errorf("scopes: %s tokens must be created with projects", ScopeShare)
+		}
+		if sc != ScopeRead && sc != ScopeDeploy {
+			return Token{}, "", fmt.Errorf("scopes: unknown scope %q", sc)
+		}
+	}
+	return issue(s, Token{User: u.Name, Name: name, Scopes: scopes, Provider: u.Provider, Groups: u.Groups}, ttl, now)
+}
+
+// CreateShare issues a new share token of "u" which can view the wallboard of "projects" without signing in,
+// e.g. on a TV in the office. It expires after "ttl" unless "ttl" is zero, and authenticates no other requests.
+// It returns the token and its secret. The secret cannot be retrieved again.
+func CreateShare(s Store, u auth.User, name string, projects []string, ttl time.Duration, now time.Time) (Token, string, error) {
+	if u.Name == "" {
+		return Token{}, "", errors.New("no user specified")
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return Token{}, "", errors.New("name: no name specified")
+	}
+	if len(projects) == 0 {
+		return Token{}, "", errors.New("projects: no projects specified")
+	}
+	for _, p := range projects {
+		if p == "" || strings.Contains(p, ",") {
+			return Token{}, "", fmt.Errorf("projects: invalid project %q", p)
+		}
+	}
+	return issue(s, Token{User: u.Name, Name: name, Scopes: []string{ScopeShare}, Projects: projects, Provider: u.Provider, Groups: u.Groups}, ttl, now)
+}
+
+// issue stores "t" with a new ID and a new secret, which expires after "ttl" unless "ttl" is zero.
+func issue(s Store, t Token, ttl time.Duration, now time.Time) (Token, string, error) {
+	if ttl < 0 {
+		return Token{}, "", fmt.Errorf("invalid expiry %s", ttl)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return Token{}, "", err
+	}
+	random, err := randomHex(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret := secretPrefix + id + "_" + random
+	t.ID, t.Created = id, now
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		t.Expires = &expires
+	}
+	if err := save(s, record{Token: t, Digest: digest(secret)}); err != nil {
+		return Token{}, "", err
+	}
+	return t, secret, nil
+}
+
+func save(s Store, rec record) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(key(rec.ID), string(buf), 0)
+	return err
+}
+
+func load(s Store, id string) (record, error) {
+	if id == "" || strings.Contains(id, "/") || id == "." || id == ".." {
+		return record{}, ErrNotFound
+	}
+	resp, err := s.Get(key(id), false, false)
+	if etcderr.IsKeyNotFound(err) {
+		return record{}, ErrNotFound
+	}
+	if err != nil {
+		return record{}, err
+	}
+	var rec record
+	if err := json.Unmarshal([]byte(resp.Node.Value), &rec); err != nil {
+		return record{}, err
+	}
+	return rec, nil
+}
+
+// List returns the tokens of "user" in the order of creation. It returns the tokens of all users if "user" is empty.
+func List(s Store, user string) ([]Token, error) {
+	resp, err := s.Get(keyPrefix, false, true)
+	if etcderr.IsKeyNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ts []Token
+	for _, n := range resp.Node.Nodes {
+		var rec record
+		if err := json.Unmarshal([]byte(n.Value), &rec); err != nil {
+			return nil, fmt.Errorf("malformed token %s: %v", n.Key, err)
+		}
+		if user == "" || rec.User == user {
+			ts = append(ts, rec.Token)
+		}
+	}
+	sort.Sort(byCreated(ts))
+	return ts, nil
+}
+
+type byCreated []Token
+
+func (t byCreated) Len() int           { return len(t) }
+func (t byCreated) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byCreated) Less(i, j int) bool { return t[i].Created.Before(t[j].Created) }
+
+// Revoke deletes the token "id" of "user". Any user's token can be revoked if "user" is empty.
+func Revoke(s Store, id, user string) error {
+	rec, err := load(s, id)
+	if err != nil {
+		return err
+	}
+	if user != "" && rec.User != user {
+		return ErrNotFound
+	}
+	_, err = s.Delete(key(id), false)
+	return err
+}
+
+// Verify returns the token whose secret is "secret" if it has not expired at "now".
+func Verify(s Store, secret string, now time.Time) (Token, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return Token{}, errors.New("malformed token")
+	}
+	i := strings.Index(secret[len(secretPrefix):], "_")
+	if i < 0 {
+		return Token{}, errors.New("malformed token")
+	}
+	rec, err := load(s, secret[len(secretPrefix):len(secretPrefix)+i])
+	if err == ErrNotFound {
+		return Token{}, errors.New("invalid token")
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(rec.Digest), []byte(digest(secret))) != 1 {
+		return Token{}, errors.New("invalid token")
+	}
+	if rec.Expires != nil && !now.Before(*rec.Expires) {
+		return Token{}, fmt.Errorf("token %s expired at %s", rec.ID, rec.Expires)
+	}
+	return rec.Token, nil
+}
+
+// VerifyShare returns the share token whose secret is "secret" if it has not expired at "now".
+func VerifyShare(s Store, secret string, now time.Time) (Token, error) {
+	t, err := Verify(s, secret, now)
+	if err != nil {
+		return Token{}, err
+	}
+	if !t.HasScope(ScopeShare) {
+		return Token{}, fmt.Errorf("token %s is not a %s token", t.ID, ScopeShare)
+	}
+	return t, nil
+}
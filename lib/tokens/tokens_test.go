@@ -0,0 +1,374 @@
+package tokens
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+)
+
+// mockStore is a Store which counts writes.
+type mockStore struct {
+	values map[string]string
+	sets   int
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{values: make(map[string]string)}
+}
+
+func (s *mockStore) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if v, ok := s.values[key]; ok {
+		return &etcd.Response{Action: "get", Node: &etcd.Node{Key: key, Value: v}}, nil
+	}
+	dir := &etcd.Node{Key: key, Dir: true}
+	for k, v := range s.values {
+		if path.Dir(k) == key {
+			dir.Nodes = append(dir.Nodes, &etcd.Node{Key: k, Value: v})
+		}
+	}
+	if len(dir.Nodes) == 0 {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	return &etcd.Response{Action: "get", Node: dir}, nil
+}
+
+func (s *mockStore) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	s.sets++
+	s.values[key] = value
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (s *mockStore) Delete(key string, recursive bool) (*etcd.Response, error) {
+	if _, ok := s.values[key]; !ok {
+		return nil, &etcd.EtcdError{ErrorCode: etcderr.KeyNotFound}
+	}
+	delete(s.values, key)
+	return &etcd.Response{Action: "delete", Node: &etcd.Node{Key: key}}, nil
+}
+
+var now = time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSecretShownOnce(t *testing.T) {
+	s := newMockStore()
+	tok, secret, err := Create(s, auth.User{Name: "alice"}, "CI", []string{ScopeRead}, 0, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "alice", err)
+	}
+	if !strings.HasPrefix(secret, secretPrefix+tok.ID+"_") {
+		t.Errorf("secret = %q; want prefix %q", secret, secretPrefix+tok.ID+"_")
+	}
+
+	for k, v := range s.values {
+		if strings.Contains(v, secret) || strings.Contains(v, secret[len(secretPrefix+tok.ID+"_"):]) {
+			t.Errorf("%s = %s contains the secret", k, v)
+		}
+	}
+	ts, err := List(s, "alice")
+	if err != nil {
+		t.Fatalf("List(s, %q) failed with %v", "alice", err)
+	}
+	buf, err := json.Marshal(ts)
+	if err != nil {
+		t.Fatalf("json.Marshal(%#v) failed with %v", ts, err)
+	}
+	if len(ts) != 1 || ts[0].ID != tok.ID || strings.Contains(string(buf), secret) || strings.Contains(string(buf), "digest") {
+		t.Errorf("List(s, %q) = %s; want %s without its secret", "alice", buf, tok.ID)
+	}
+
+	got, err := Verify(s, secret, now)
+	if err != nil || got.ID != tok.ID || got.User != "alice" {
+		t.Errorf("Verify(s, secret, now) = %#v, %v; want %s of alice", got, err, tok.ID)
+	}
+	// wrong flips the last digit of the secret.
+	wrong := secret[:len(secret)-1] + "0"
+	if strings.HasSuffix(secret, "0") {
+		wrong = secret[:len(secret)-1] + "1"
+	}
+	for _, secret := range []string{
+		"",
+		"goship_",
+		wrong,
+		strings.Replace(secret, secretPrefix, "other_", 1),
+		secretPrefix + "../config_" + secret[len(secretPrefix+tok.ID+"_"):],
+	} {
+		if got, err := Verify(s, secret, now); err == nil {
+			t.Errorf("Verify(s, %q, now) = %#v; want failure", secret, got)
+		}
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	s := newMockStore()
+	_, secret, err := Create(s, auth.User{Name: "alice"}, "CI", []string{ScopeRead}, time.Hour, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "alice", err)
+	}
+	if _, err := Verify(s, secret, now.Add(59*time.Minute)); err != nil {
+		t.Errorf("Verify(s, secret, now+59m) failed with %v; want success", err)
+	}
+	if got, err := Verify(s, secret, now.Add(time.Hour)); err == nil {
+		t.Errorf("Verify(s, secret, now+1h) = %#v; want failure", got)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	for _, spec := range []struct {
+		user, name string
+		scopes     []string
+		ttl        time.Duration
+	}{
+		{name: "CI", scopes: []string{ScopeRead}},
+		{user: "alice", name: " ", scopes: []string{ScopeRead}},
+		{user: "alice", name: "CI"},
+		{user: "alice", name: "CI", scopes: []string{"admin"}},
+		// share tokens need projects.
+		{user: "alice", name: "CI", scopes: []string{ScopeShare}},
+		{user: "alice", name: "CI", scopes: []string{ScopeRead}, ttl: -time.Hour},
+	} {
+		if got, _, err := Create(newMockStore(), auth.User{Name: spec.user}, spec.name, spec.scopes, spec.ttl, now); err == nil {
+			t.Errorf("Create(s, %q, %q, %q, %s, now) = %#v; want failure", spec.user, spec.name, spec.scopes, spec.ttl, got)
+		}
+	}
+}
+
+func TestCreateShare(t *testing.T) {
+	for _, spec := range []struct {
+		user, name string
+		projects   []string
+	}{
+		{name: "TV", projects: []string{"api"}},
+		{user: "alice", name: " ", projects: []string{"api"}},
+		{user: "alice", name: "TV"},
+		{user: "alice", name: "TV", projects: []string{""}},
+		{user: "alice", name: "TV", projects: []string{"api,web"}},
+	} {
+		if got, _, err := CreateShare(newMockStore(), auth.User{Name: spec.user}, spec.name, spec.projects, 0, now); err == nil {
+			t.Errorf("CreateShare(s, %q, %q, %q, 0, now) = %#v; want failure", spec.user, spec.name, spec.projects, got)
+		}
+	}
+
+	s := newMockStore()
+	tok, secret, err := CreateShare(s, auth.User{Name: "alice"}, "TV", []string{"api", "web"}, time.Hour, now)
+	if err != nil {
+		t.Fatalf("CreateShare(s, %q, ...) failed with %v", "alice", err)
+	}
+	for _, spec := range []struct {
+		project string
+		want    bool
+	}{
+		{project: "api", want: true},
+		{project: "web", want: true},
+		{project: "secret"},
+	} {
+		if got := tok.Shares(spec.project); got != spec.want {
+			t.Errorf("tok.Shares(%q) = %v; want %v", spec.project, got, spec.want)
+		}
+	}
+	got, err := VerifyShare(s, secret, now)
+	if err != nil {
+		t.Fatalf("VerifyShare(s, secret, now) failed with %v", err)
+	}
+	if got.User != "alice" || !got.Shares("api") {
+		t.Errorf("VerifyShare(s, secret, now) = %#v; want the share token of alice", got)
+	}
+	if got, err := VerifyShare(s, secret, now.Add(time.Hour)); err == nil {
+		t.Errorf("VerifyShare(s, secret, now+1h) = %#v; want failure", got)
+	}
+
+	// other tokens neither share projects nor view wallboards.
+	read, readSecret, err := Create(s, auth.User{Name: "alice"}, "CI", []string{ScopeRead}, 0, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "alice", err)
+	}
+	read.Projects = []string{"api"}
+	if read.Shares("api") {
+		t.Errorf("read.Shares(%q) = true; want false", "api")
+	}
+	if got, err := VerifyShare(s, readSecret, now); err == nil {
+		t.Errorf("VerifyShare(s, readSecret, now) = %#v; want failure", got)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := newMockStore()
+	alice, secret, err := Create(s, auth.User{Name: "alice"}, "CI", []string{ScopeRead}, 0, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "alice", err)
+	}
+	bob, _, err := Create(s, auth.User{Name: "bob"}, "laptop", []string{ScopeRead, ScopeDeploy}, 0, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "bob", err)
+	}
+	if ts, err := List(s, ""); err != nil || len(ts) != 2 || ts[0].ID != alice.ID || ts[1].ID != bob.ID {
+		t.Errorf("List(s, \"\") = %#v, %v; want tokens of alice and bob in order", ts, err)
+	}
+
+	if err := Revoke(s, alice.ID, "bob"); err != ErrNotFound {
+		t.Errorf("Revoke(s, %q, %q) = %v; want %v", alice.ID, "bob", err, ErrNotFound)
+	}
+	if err := Revoke(s, alice.ID, "alice"); err != nil {
+		t.Errorf("Revoke(s, %q, %q) failed with %v", alice.ID, "alice", err)
+	}
+	if _, err := Verify(s, secret, now); err == nil {
+		t.Errorf("Verify(s, secret, now) succeeded after revocation; want failure")
+	}
+	if err := Revoke(s, bob.ID, ""); err != nil {
+		t.Errorf("Revoke(s, %q, \"\") failed with %v", bob.ID, err)
+	}
+	if ts, err := List(s, ""); err != nil || len(ts) != 0 {
+		t.Errorf("List(s, \"\") = %#v, %v; want no tokens", ts, err)
+	}
+}
+
+func TestRecorderBatchesWrites(t *testing.T) {
+	s := newMockStore()
+	var ids []string
+	for _, user := range []string{"alice", "bob", "carol"} {
+		tok, _, err := Create(s, auth.User{Name: user}, "CI", []string{ScopeRead}, 0, now)
+		if err != nil {
+			t.Fatalf("Create(s, %q, ...) failed with %v", user, err)
+		}
+		ids = append(ids, tok.ID)
+	}
+	sort.Strings(ids)
+	s.sets = 0
+
+	r := NewRecorder(s)
+	for i := 0; i < 100; i++ {
+		r.Touch(ids[0], now.Add(time.Duration(i)*time.Second))
+		r.Touch(ids[1], now.Add(time.Duration(100-i)*time.Second))
+	}
+	if s.sets != 0 {
+		t.Errorf("Touch wrote into the store %d times; want 0", s.sets)
+	}
+	if err := Revoke(s, ids[1], ""); err != nil {
+		t.Fatalf("Revoke(s, %q, \"\") failed with %v", ids[1], err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatalf("r.Flush() failed with %v", err)
+	}
+	if s.sets != 1 {
+		t.Errorf("r.Flush() wrote %d times; want 1", s.sets)
+	}
+	ts, err := List(s, "")
+	if err != nil {
+		t.Fatalf("List(s, \"\") failed with %v", err)
+	}
+	used := make(map[string]*time.Time)
+	for _, tok := range ts {
+		used[tok.ID] = tok.LastUsed
+	}
+	if _, ok := used[ids[1]]; ok {
+		t.Errorf("revoked token %s was written back", ids[1])
+	}
+	if want := now.Add(99 * time.Second); used[ids[0]] == nil || !used[ids[0]].Equal(want) {
+		t.Errorf("LastUsed of %s = %v; want %v", ids[0], used[ids[0]], want)
+	}
+	if used[ids[2]] != nil {
+		t.Errorf("LastUsed of %s = %v; want nil", ids[2], used[ids[2]])
+	}
+
+	s.sets = 0
+	if err := r.Flush(); err != nil || s.sets != 0 {
+		t.Errorf("r.Flush() wrote %d times with %v; want no writes without uses", s.sets, err)
+	}
+	r.Touch(ids[0], now)
+	if err := r.Flush(); err != nil || s.sets != 0 {
+		t.Errorf("r.Flush() wrote %d times with %v; want no writes for older uses", s.sets, err)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	s := newMockStore()
+	_, readSecret, err := Create(s, auth.User{Name: "alice"}, "dashboard", []string{ScopeRead}, 0, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "alice", err)
+	}
+	_, deploySecret, err := Create(s, auth.User{Name: "bob"}, "CI", []string{ScopeRead, ScopeDeploy}, 0, now)
+	if err != nil {
+		t.Fatalf("Create(s, %q, ...) failed with %v", "bob", err)
+	}
+	_, shareSecret, err := CreateShare(s, auth.User{Name: "carol"}, "TV", []string{"api"}, 0, now)
+	if err != nil {
+		t.Fatalf("CreateShare(s, %q, ...) failed with %v", "carol", err)
+	}
+	rec := NewRecorder(s)
+	p := provider{s: s, rec: rec, now: func() time.Time { return now }}
+	for _, spec := range []struct {
+		method, header string
+		want           string
+		fails          bool
+	}{
+		{method: "GET", header: "Bearer " + readSecret, want: "alice"},
+		{method: "POST", header: "Bearer " + readSecret, fails: true},
+		{method: "POST", header: "Bearer " + deploySecret, want: "bob"},
+		{method: "GET", header: "Basic " + readSecret, fails: true},
+		// share tokens authenticate only wallboards.
+		{method: "GET", header: "Bearer " + shareSecret, fails: true},
+		{method: "GET", fails: true},
+	} {
+		r, _ := http.NewRequest(spec.method, "http://goship.example/api/v1/status", nil)
+		if spec.header != "" {
+			r.Header.Set("Authorization", spec.header)
+		}
+		u, err := p.Authenticate(r)
+		if spec.fails {
+			if err == nil {
+				t.Errorf("p.Authenticate(%s with %q) = %#v; want failure", spec.method, spec.header, u)
+			}
+			continue
+		}
+		if err != nil || u.Name != spec.want || u.Provider != auth.ProviderToken {
+			t.Errorf("p.Authenticate(%s with %q) = %#v, %v; want %s by %s", spec.method, spec.header, u, err, spec.want, auth.ProviderToken)
+		}
+	}
+	if got := len(rec.used); got != 2 {
+		t.Errorf("recorded uses of %d tokens; want 2", got)
+	}
+}
+
+func TestProviderKeepsGroups(t *testing.T) {
+	c := config.Config{OIDC: &config.OIDCConfiguration{Groups: []config.GroupRule{
+		{Group: "ops", Repos: []string{"gengo/*"}, Deploy: true},
+		{Group: "contractors", Repos: []string{"gengo/*"}},
+	}}}
+	s := newMockStore()
+	p := provider{s: s, rec: NewRecorder(s), now: func() time.Time { return now }}
+	for _, spec := range []struct {
+		groups     []string
+		deployable bool
+	}{
+		{groups: []string{"ops"}, deployable: true},
+		// the deploy scope does not grant more than the group of the user who created the token.
+		{groups: []string{"contractors"}},
+	} {
+		owner := auth.User{Name: "alice@example.com", Provider: auth.ProviderOIDC, Groups: spec.groups}
+		_, secret, err := Create(s, owner, "CI", []string{ScopeRead, ScopeDeploy}, 0, now)
+		if err != nil {
+			t.Fatalf("Create(s, %#v, ...) failed with %v", owner, err)
+		}
+		r, _ := http.NewRequest("POST", "http://goship.example/deploy", nil)
+		r.Header.Set("Authorization", "Bearer "+secret)
+		u, err := p.Authenticate(r)
+		if err != nil {
+			t.Fatalf("p.Authenticate(POST with the token of %q) failed with %v", spec.groups, err)
+		}
+		ac := acl.ForUser(acl.Null, c, u)
+		if !ac.Readable("gengo", "api", u.Name) {
+			t.Errorf("Readable(%q, %q) with the token of %q = false; want true", "gengo", "api", spec.groups)
+		}
+		if got := ac.Deployable("gengo", "api", u.Name); got != spec.deployable {
+			t.Errorf("Deployable(%q, %q) with the token of %q = %t; want %t", "gengo", "api", spec.groups, got, spec.deployable)
+		}
+	}
+}
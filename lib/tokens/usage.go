@@ -0,0 +1,79 @@
+package tokens
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// Recorder batches updates of the last-used times of tokens, so that authentication does not wait for writes into the store.
+type Recorder struct {
+	s Store
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewRecorder returns a new Recorder which writes last-used times into "s".
+func NewRecorder(s Store) *Recorder {
+	return &Recorder{s: s, used: make(map[string]time.Time)}
+}
+
+// Touch records that the token "id" was used at "t". It does not access the store.
+func (r *Recorder) Touch(id string, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.used[id]; !ok || t.After(last) {
+		r.used[id] = t
+	}
+}
+
+// Flush writes the times recorded since the last flush into the store, once for each token.
+// Times of tokens revoked meanwhile are dropped. It returns the first error but tries all the tokens.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	used := r.used
+	r.used = make(map[string]time.Time)
+	r.mu.Unlock()
+
+	var first error
+	for id, t := range used {
+		if err := r.update(id, t); err != nil {
+			glog.Errorf("Failed to record last use of token %s: %v", id, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (r *Recorder) update(id string, t time.Time) error {
+	rec, err := load(r.s, id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if rec.LastUsed != nil && !t.After(*rec.LastUsed) {
+		return nil
+	}
+	rec.LastUsed = &t
+	return save(r.s, rec)
+}
+
+// Run flushes the recorded times every "interval" until "ctx" is done.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			r.Flush()
+			return
+		case <-time.After(interval):
+			r.Flush()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package viewhelpers
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// baseTemplate is the layout which every page is parsed with.
+const baseTemplate = "base.html"
+
+// Pages are the page templates parsed with the layout.
+// Templates in the override directory take precedence over the default ones of the same file names.
+type Pages struct {
+	dir, overrideDir string
+	names            []string
+	funcs            template.FuncMap
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// NewPages parses the pages "names" in "dir" with the layout, overridden by the templates in "overrideDir" if not empty.
+// "funcs" must define all the functions which the templates call. Pages can replace them on Lookup.
+// It returns an error with the path and the line of the template if any of them fails to parse.
+func NewPages(dir, overrideDir string, funcs template.FuncMap, names ...string) (*Pages, error) {
+	p := &Pages{dir: dir, overrideDir: overrideDir, names: names, funcs: funcs}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload parses the templates again. It keeps the current ones if any of the templates fails to parse.
+func (p *Pages) Reload() error {
+	pages := make(map[string]*template.Template)
+	for _, name := range p.names {
+		t, err := p.parse(name)
+		if err != nil {
+			return err
+		}
+		pages[name] = t
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages = pages
+	return nil
+}
+
+func (p *Pages) parse(name string) (*template.Template, error) {
+	t := template.New(name).Funcs(p.funcs)
+	for _, file := range []string{name, baseTemplate} {
+		path, err := p.path(file)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tmpl := t
+		if file != name {
+			tmpl = t.New(file)
+		}
+		// html/template reports the line in the error.
+		if _, err := tmpl.Parse(string(buf)); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return t, nil
+}
+
+// path returns the path to the template "file" in the override directory if exists, or in the default directory.
+func (p *Pages) path(file string) (string, error) {
+	if p.overrideDir != "" {
+		path := filepath.Join(p.overrideDir, file)
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return filepath.Join(p.dir, file), nil
+}
+
+// Lookup returns a copy of the page "name" in which "funcs" replace the functions of the same names.
+func (p *Pages) Lookup(name string, funcs template.FuncMap) (*template.Template, error) {
+	p.mu.RLock()
+	t, ok := p.pages[name]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no such page template %s", name)
+	}
+	t, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if funcs != nil {
+		t.Funcs(funcs)
+	}
+	return t, nil
+}
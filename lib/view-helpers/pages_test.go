@@ -0,0 +1,134 @@
+package viewhelpers
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(%q) failed with %v", name, err)
+		}
+	}
+}
+
+func withTemplateDirs(t *testing.T, f func(dir, overrideDir string)) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := ioutil.TempDir("", "goship-templates-")
+		if err != nil {
+			t.Fatalf("ioutil.TempDir failed with %v", err)
+		}
+		defer os.RemoveAll(dir)
+		dirs = append(dirs, dir)
+	}
+	writeTemplates(t, dirs[0], map[string]string{
+		"base.html": `{{define "base"}}<title>goship</title>{{template "content" .}}{{end}}`,
+		"home.html": `{{define "content"}}home {{greet .}}{{end}}`,
+		"logs.html": `{{define "content"}}logs{{end}}`,
+	})
+	f(dirs[0], dirs[1])
+}
+
+func render(t *testing.T, p *Pages, name string, funcs template.FuncMap) string {
+	tmpl, err := p.Lookup(name, funcs)
+	if err != nil {
+		t.Fatalf("p.Lookup(%q, funcs) failed with %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", "alice"); err != nil {
+		t.Fatalf("tmpl.ExecuteTemplate(&buf, %q, params) failed with %v", "base", err)
+	}
+	return buf.String()
+}
+
+var greetFuncs = template.FuncMap{"greet": func(string) string { return "" }}
+
+func TestPagesOverride(t *testing.T) {
+	withTemplateDirs(t, func(dir, overrideDir string) {
+		writeTemplates(t, overrideDir, map[string]string{
+			"base.html": `{{define "base"}}<title>ACME deploys</title>{{template "content" .}}{{end}}`,
+			"logs.html": `{{define "content"}}custom logs{{end}}`,
+		})
+		p, err := NewPages(dir, overrideDir, greetFuncs, "home.html", "logs.html")
+		if err != nil {
+			t.Fatalf("NewPages(%q, %q, funcs, names...) failed with %v", dir, overrideDir, err)
+		}
+		greet := template.FuncMap{"greet": func(s string) string { return "hello " + s }}
+		for _, spec := range []struct {
+			name string
+			want string
+		}{
+			// the default page with the overriding layout
+			{name: "home.html", want: "<title>ACME deploys</title>home hello alice"},
+			{name: "logs.html", want: "<title>ACME deploys</title>custom logs"},
+		} {
+			if got := render(t, p, spec.name, greet); got != spec.want {
+				t.Errorf("render(t, p, %q, funcs) = %q; want %q", spec.name, got, spec.want)
+			}
+		}
+		if _, err := p.Lookup("tokens.html", nil); err == nil {
+			t.Errorf("p.Lookup(%q, nil) succeeded; want failure", "tokens.html")
+		}
+	})
+}
+
+func TestPagesWithoutOverride(t *testing.T) {
+	withTemplateDirs(t, func(dir, _ string) {
+		p, err := NewPages(dir, "", greetFuncs, "logs.html")
+		if err != nil {
+			t.Fatalf("NewPages(%q, %q, funcs, names...) failed with %v", dir, "", err)
+		}
+		if got, want := render(t, p, "logs.html", nil), "<title>goship</title>logs"; got != want {
+			t.Errorf("render(t, p, %q, nil) = %q; want %q", "logs.html", got, want)
+		}
+	})
+}
+
+func TestPagesParseError(t *testing.T) {
+	withTemplateDirs(t, func(dir, overrideDir string) {
+		writeTemplates(t, overrideDir, map[string]string{
+			"logs.html": "{{define \"content\"}}\n{{if .}}broken\n{{end}}",
+		})
+		_, err := NewPages(dir, overrideDir, greetFuncs, "logs.html")
+		if err == nil {
+			t.Fatalf("NewPages(%q, %q, funcs, names...) succeeded; want failure", dir, overrideDir)
+		}
+		for _, want := range []string{filepath.Join(overrideDir, "logs.html"), ":3:"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("err = %q; want to contain %q", err, want)
+			}
+		}
+	})
+}
+
+func TestPagesReload(t *testing.T) {
+	withTemplateDirs(t, func(dir, overrideDir string) {
+		p, err := NewPages(dir, overrideDir, greetFuncs, "logs.html")
+		if err != nil {
+			t.Fatalf("NewPages(%q, %q, funcs, names...) failed with %v", dir, overrideDir, err)
+		}
+
+		writeTemplates(t, overrideDir, map[string]string{"logs.html": `{{define "content"}}custom logs{{end}}`})
+		if err := p.Reload(); err != nil {
+			t.Fatalf("p.Reload() failed with %v", err)
+		}
+		if got, want := render(t, p, "logs.html", nil), "<title>goship</title>custom logs"; got != want {
+			t.Errorf("render(t, p, %q, nil) = %q after reload; want %q", "logs.html", got, want)
+		}
+
+		writeTemplates(t, overrideDir, map[string]string{"logs.html": `{{define "content"}}{{end`})
+		if err := p.Reload(); err == nil {
+			t.Errorf("p.Reload() succeeded with a broken template; want failure")
+		}
+		if got, want := render(t, p, "logs.html", nil), "<title>goship</title>custom logs"; got != want {
+			t.Errorf("render(t, p, %q, nil) = %q after failed reload; want %q", "logs.html", got, want)
+		}
+	})
+}
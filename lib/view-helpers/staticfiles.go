@@ -6,22 +6,30 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/gengo/goship/lib/proxy"
 	"github.com/golang/glog"
 )
 
 const (
 	javascriptExt = ".js"
 	stylesheetExt = ".css"
-	javascriptTag = "<script src='/static/js/%s'></script>"
-	stylesheetTag = "<link href='/static/css/%s' rel='stylesheet'>"
+	javascriptTag = "<script src='%s/static/js/%s'></script>"
+	stylesheetTag = "<link href='%s/static/css/%s' rel='stylesheet'>"
 )
 
 type Assets struct {
-	dir string
+	dir   string
+	pages *Pages
 }
 
-func New(dir string) Assets {
-	return Assets{dir: dir}
+// New returns Assets of the static files in "dir" and the page templates in "pages".
+func New(dir string, pages *Pages) Assets {
+	return Assets{dir: dir, pages: pages}
+}
+
+// Page returns the page template "name" with "funcs".
+func (a Assets) Page(name string, funcs template.FuncMap) (*template.Template, error) {
+	return a.pages.Lookup(name, funcs)
 }
 
 func getFilePaths(root string, extension string) ([]string, error) {
@@ -61,7 +69,7 @@ func makeJavascriptTemplate(folderpath string) template.HTML {
 	fps := getJavascriptFiles(folderpath)
 	var str string = ""
 	for _, fp := range fps {
-		str += fmt.Sprintf(javascriptTag, fp)
+		str += fmt.Sprintf(javascriptTag, proxy.BasePath(), fp)
 	}
 	return template.HTML(str)
 }
@@ -70,7 +78,7 @@ func makeStylesheetTemplate(folderpath string) template.HTML {
 	fps := getStylesheetFiles(folderpath)
 	var str string = ""
 	for _, fp := range fps {
-		str += fmt.Sprintf(stylesheetTag, fp)
+		str += fmt.Sprintf(stylesheetTag, proxy.BasePath(), fp)
 	}
 	return template.HTML(str)
 }
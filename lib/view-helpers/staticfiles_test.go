@@ -4,6 +4,8 @@ import (
 	"html/template"
 	"path/filepath"
 	"testing"
+
+	"github.com/gengo/goship/lib/proxy"
 )
 
 var getFilePathsTests = []struct {
@@ -85,3 +87,17 @@ func TestMakeJavascriptTemplate(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplatesUnderBasePath(t *testing.T) {
+	if err := proxy.SetBasePath("/goship"); err != nil {
+		t.Fatalf("proxy.SetBasePath(%q) failed with %v", "/goship", err)
+	}
+	defer proxy.SetBasePath("")
+	js, css := New("../../static", nil).Templates()
+	if want := template.HTML("<script src='/goship/static/js/pivotal.js'></script>"); js != want {
+		t.Errorf("js = %v; want %v", js, want)
+	}
+	if want := template.HTML("<link href='/goship/static/css/styles.css' rel='stylesheet'>"); css != want {
+		t.Errorf("css = %v; want %v", css, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gengo/goship/lib/proxy"
+	"github.com/golang/glog"
+)
+
+// splitList returns the non-empty items of the comma-separated list "s".
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// pushAddr returns the URL of the websocket endpoint of push notifications as seen by the client of "r".
+func pushAddr(r *http.Request) *url.URL {
+	u := proxy.URL(r, "/web_push")
+	u.Scheme = "ws"
+	if proxy.Scheme(r) == "https" {
+		u.Scheme = "wss"
+	}
+	return u
+}
+
+// externalBaseURL returns the URL of goship which links in GitHub commit statuses and notifications are relative to.
+// It defaults to the bind address under the base path, with https if goship serves TLS itself.
+func externalBaseURL() string {
+	if *externalURL != "" {
+		return strings.TrimSuffix(*externalURL, "/")
+	}
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + *bindAddress + proxy.BasePath()
+}
+
+// certReloader serves the TLS certificate in files, which are loaded again by Reload so that renewed certificates
+// take effect without restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader returns a certReloader of the certificate in "certFile" and its private key in "keyFile".
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate from the files. The current certificate is kept if they are invalid.
+func (c *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// GetCertificate returns the current certificate. It is used as tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reloadOnHangup reloads the certificate of "c" whenever goship receives SIGHUP.
+func reloadOnHangup(c *certReloader) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		if err := c.Reload(); err != nil {
+			glog.Errorf("Failed to reload the TLS certificate %s; keeping the current one: %v", c.certFile, err)
+			continue
+		}
+		glog.Infof("Reloaded the TLS certificate %s", c.certFile)
+	}
+}
+
+// serve serves "s" in HTTPS with the certificate in "certFile" and the key in "keyFile", or in HTTP if both are empty.
+func serve(s *http.Server, certFile, keyFile string) error {
+	if certFile == "" && keyFile == "" {
+		return s.ListenAndServe()
+	}
+	if certFile == "" || keyFile == "" {
+		return errors.New("both -tls-cert and -tls-key must be specified to serve HTTPS")
+	}
+	c, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	go reloadOnHangup(c)
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(tls.NewListener(ln, &tls.Config{GetCertificate: c.GetCertificate}))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/proxy"
+)
+
+func TestSplitList(t *testing.T) {
+	if got, want := splitList(" 10.0.0.0/8, ,192.168.1.10 "), []string{"10.0.0.0/8", "192.168.1.10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitList(...) = %q; want %q", got, want)
+	}
+	if got := splitList(""); got != nil {
+		t.Errorf("splitList(%q) = %q; want nil", "", got)
+	}
+}
+
+func TestPushAddr(t *testing.T) {
+	if err := proxy.SetBasePath("/goship"); err != nil {
+		t.Fatalf("proxy.SetBasePath(%q) failed with %v", "/goship", err)
+	}
+	defer proxy.SetBasePath("")
+
+	req, _ := http.NewRequest("GET", "http://tools.example.com/goship/", nil)
+	if got, want := pushAddr(req).String(), "ws://tools.example.com/goship/web_push"; got != want {
+		t.Errorf("pushAddr(req) = %q; want %q", got, want)
+	}
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if got, want := pushAddr(req).String(), "wss://tools.example.com/goship/web_push"; got != want {
+		t.Errorf("pushAddr(req) = %q behind https; want %q", got, want)
+	}
+}
+
+func TestExternalBaseURL(t *testing.T) {
+	origURL, origBind, origCert := *externalURL, *bindAddress, *tlsCert
+	defer func() { *externalURL, *bindAddress, *tlsCert = origURL, origBind, origCert }()
+	if err := proxy.SetBasePath("/goship"); err != nil {
+		t.Fatalf("proxy.SetBasePath(%q) failed with %v", "/goship", err)
+	}
+	defer proxy.SetBasePath("")
+
+	*externalURL, *bindAddress, *tlsCert = "", "localhost:8000", ""
+	if got, want := externalBaseURL(), "http://localhost:8000/goship"; got != want {
+		t.Errorf("externalBaseURL() = %q; want %q", got, want)
+	}
+	*tlsCert = "cert.pem"
+	if got, want := externalBaseURL(), "https://localhost:8000/goship"; got != want {
+		t.Errorf("externalBaseURL() = %q with TLS; want %q", got, want)
+	}
+	*externalURL = "https://tools.example.com/goship/"
+	if got, want := externalBaseURL(), "https://tools.example.com/goship"; got != want {
+		t.Errorf("externalBaseURL() = %q; want %q", got, want)
+	}
+	if got, want := deployLogURL("api", "production"), "https://tools.example.com/goship/deployLog/api-production"; got != want {
+		t.Errorf("deployLogURL(%q, %q) = %q; want %q", "api", "production", got, want)
+	}
+}
+
+// writeCert writes a new self-signed certificate of "name" and its key into "certFile" and "keyFile".
+func writeCert(t *testing.T, name, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(...) failed with %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(...) failed with %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(...) failed with %v", err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed with %v", certFile, err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed with %v", keyFile, err)
+	}
+}
+
+// commonName returns the common name of the current certificate of "c".
+func commonName(t *testing.T, c *certReloader) string {
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("c.GetCertificate(nil) failed with %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate(...) failed with %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goship-tls")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(...) failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	writeCert(t, "old.example.com", certFile, keyFile)
+	c, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader(%q, %q) failed with %v", certFile, keyFile, err)
+	}
+	if got := commonName(t, c); got != "old.example.com" {
+		t.Errorf("common name = %q; want %q", got, "old.example.com")
+	}
+
+	// half-written renewal
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%q) failed with %v", certFile, err)
+	}
+	if err := c.Reload(); err == nil {
+		t.Errorf("c.Reload() succeeded with an invalid certificate; want failure")
+	}
+	if got := commonName(t, c); got != "old.example.com" {
+		t.Errorf("common name = %q after a failed reload; want %q", got, "old.example.com")
+	}
+
+	writeCert(t, "new.example.com", certFile, keyFile)
+	if err := c.Reload(); err != nil {
+		t.Errorf("c.Reload() failed with %v", err)
+	}
+	if got := commonName(t, c); got != "new.example.com" {
+		t.Errorf("common name = %q after reload; want %q", got, "new.example.com")
+	}
+}
+
+func TestServeRequiresBothTLSFiles(t *testing.T) {
+	s := &http.Server{Addr: "localhost:0"}
+	if err := serve(s, "cert.pem", ""); err == nil {
+		t.Errorf("serve(s, %q, %q) succeeded; want failure", "cert.pem", "")
+	}
+}
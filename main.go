@@ -7,23 +7,53 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	docker "github.com/fsouza/go-dockerclient"
+	activityhandlers "github.com/gengo/goship/handlers/activity"
+	"github.com/gengo/goship/handlers/annotations"
+	"github.com/gengo/goship/handlers/branches"
+	"github.com/gengo/goship/handlers/clone"
 	"github.com/gengo/goship/handlers/comment"
 	"github.com/gengo/goship/handlers/commits"
 	deploypage "github.com/gengo/goship/handlers/deploy-page"
+	"github.com/gengo/goship/handlers/healthz"
+	hostsethandler "github.com/gengo/goship/handlers/hostset"
 	"github.com/gengo/goship/handlers/lock"
+	"github.com/gengo/goship/handlers/preferences"
+	"github.com/gengo/goship/handlers/schedules"
+	subscriptionhandlers "github.com/gengo/goship/handlers/subscriptions"
+	tokenhandlers "github.com/gengo/goship/handlers/tokens"
 	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
 	"github.com/gengo/goship/lib/auth"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
 	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/hostkeys"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/leader"
+	"github.com/gengo/goship/lib/migrations"
 	"github.com/gengo/goship/lib/notification"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/proxy"
+	"github.com/gengo/goship/lib/ratelimit"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
 	"github.com/gengo/goship/lib/revision/gcr"
+	"github.com/gengo/goship/lib/running"
+	"github.com/gengo/goship/lib/scripts"
+	"github.com/gengo/goship/lib/ssh"
+	"github.com/gengo/goship/lib/tokens"
 	helpers "github.com/gengo/goship/lib/view-helpers"
 	_ "github.com/gengo/goship/plugins"
+	"github.com/gengo/goship/plugins/columns"
 	"github.com/golang/glog"
 	ghandlers "github.com/gorilla/handlers"
 	"golang.org/x/net/context"
@@ -38,17 +68,41 @@ var (
 	gcpJWTConfig      = flag.String("gcp-jwt-config", "", "Path to a JSON file which contains a JWT configuration of a service account in Google Cloud Platform")
 	dataPath          = flag.String("d", "data/", "Path to data directory (default ./data/)")
 	staticFilePath    = flag.String("s", "static/", "Path to directory for static files (default ./static/)")
+	templatesDir      = flag.String("templates-dir", "", "Path to directory of templates which override the default ones of the same names")
 	ETCDServer        = flag.String("e", "http://127.0.0.1:4001", "Etcd Server (default http://127.0.0.1:4001)")
 	cookieSessionHash = flag.String("c", "COOKIE-SESSION-HASH", "Random cookie session key (default jhjhjhjhjhjjhjhhj)")
 	defaultUser       = flag.String("u", "genericUser", "Default User if non auth (default genericUser)")
 	defaultAvatar     = flag.String("a", "https://camo.githubusercontent.com/33a7d9a138ac73ece82dee977c216eb13dffc984/687474703a2f2f692e696d6775722e636f6d2f524c766b486b612e706e67", "Default Avatar (default goship gopher image)")
 	confirmDeployFlag = flag.Bool("f", true, "Flag to always ask for confirmation before deploying")
 	requestLog        = flag.String("request-log", "-", "destination of request log. '-' means stdout")
+	instanceID        = flag.String("instance-id", "", "Unique identifier of this instance in leader election (default hostname and pid)")
+	leaderTTL         = flag.Duration("leader-ttl", 30*time.Second, "TTL of the leadership of background jobs. Followers take over within this period when the leader dies")
+	migrateDryRun     = flag.Bool("migrate-dry-run", false, "Only log the changes of pending schema migrations of etcd instead of applying them")
+	rateLimit         = flag.Float64("rate-limit", 0, "Maximum number of deploy, lock and comment requests per minute per user in average. 0 disables rate limiting")
+	rateBurst         = flag.Int("rate-burst", 5, "Maximum number of deploy, lock and comment requests per user at once")
+	rateLimitShared   = flag.Bool("rate-limit-shared", false, "Share rate limit counters among instances through etcd")
+	admins            = flag.String("admins", "", "Comma-separated list of admin users. They are exempt from rate limits")
+	retentionInterval = flag.Duration("retention-interval", time.Hour, "Interval of pruning old records under the retention policy")
+	tipTTL            = flag.Duration("tip-ttl", time.Minute, "How long latest revisions of branches are served from cache before refreshed in background")
+	statusInterval    = flag.Duration("status-interval", time.Minute, "Interval of fetching revisions of all the hosts into the cache served by /api/v1/status")
+	deploySettle      = flag.Duration("deploy-settle", 2*time.Minute, "How long hosts are shown as deploying instead of compared with the tip after a deployment finishes")
+	validateOnly      = flag.Bool("validate-only", false, "Validate the config and the deploy commands of all environments, and exit")
+	validateCheck     = flag.Bool("validate-check", false, "Run deploy commands of environments with deploy_check with --goship-check in -validate-only")
+	externalURL       = flag.String("external-url", "", "URL of goship which GitHub commit statuses and notifications link to (default http(s)://<bind address><base path>)")
+	sshIdleTimeout    = flag.Duration("ssh-idle-timeout", 5*time.Minute, "How long SSH connections for polling hosts are kept without being used")
+	sshMaxConns       = flag.Int("ssh-max-conns", 256, "Maximum number of SSH connections kept for polling hosts")
+	scriptsDir        = flag.String("scripts-dir", "", "Path to directory of checkouts of script repos of projects (default <data path>/scripts)")
+	basePath          = flag.String("base-path", "", "URL path prefix which goship is served under, e.g. /goship behind a reverse proxy at https://tools.example.com/goship/")
+	tlsCert           = flag.String("tls-cert", "", "Path to a PEM certificate file to serve HTTPS with. Reloaded with -tls-key on SIGHUP")
+	tlsKey            = flag.String("tls-key", "", "Path to the PEM private key file of -tls-cert")
+	trustedProxies    = flag.String("trusted-proxies", "", "Comma-separated CIDRs or IP addresses of reverse proxies whose X-Forwarded-For and X-Forwarded-Proto are trusted")
+	logThrottle       = flag.Duration("log-throttle-window", reqlog.DefaultThrottleWindow, "How long warnings and errors identical to a logged one are counted instead of logged. 0 logs all of them")
+	approvalReminder  = flag.Duration("approval-reminder-interval", 30*time.Minute, "How long deployments wait for approval before their approvers are reminded again")
 )
 
 var validPathWithEnv = regexp.MustCompile("^/(deployLog|commits)/(.*)$")
 
-func extractDeployLogHandler(ac acl.AccessControl, ecl *etcd.Client, fn func(http.ResponseWriter, *http.Request, string, config.Environment, string)) http.HandlerFunc {
+func extractDeployLogHandler(ac acl.AccessControl, ecl *etcd.Client, fn func(http.ResponseWriter, *http.Request, string, config.Environment, config.Project)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m := validPathWithEnv.FindStringSubmatch(r.URL.Path)
 		if m == nil {
@@ -67,7 +121,7 @@ func extractDeployLogHandler(ac acl.AccessControl, ecl *etcd.Client, fn func(htt
 			glog.Error("Failed to get a user while deploying in Auth Mode: %v", err)
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 		}
-		c.Projects = acl.ReadableProjects(ac, c.Projects, u)
+		c.Projects = acl.ReadableProjects(acl.ForUser(ac, c, u), c.Projects, u)
 		// get project name and env from url
 		a := strings.Split(m[2], "-")
 		l := len(a)
@@ -78,13 +132,13 @@ func extractDeployLogHandler(ac acl.AccessControl, ecl *etcd.Client, fn func(htt
 		} else {
 			projectName = strings.Join(a[0:l-1], "-")
 		}
-		e, err := config.EnvironmentFromName(c.Projects, projectName, environmentName)
+		p, e, err := config.ResolveTarget(c.Projects, projectName, environmentName)
 		if err != nil {
-			glog.Errorf("Can't get environment from name: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			glog.Errorf("Can't resolve %s-%s: %v", projectName, environmentName, err)
+			http.Error(w, err.Error(), config.StatusCode(err))
 			return
 		}
-		fn(w, r, m[2], *e, projectName)
+		fn(w, r, m[2], *e, *p)
 	}
 }
 
@@ -103,25 +157,165 @@ func extractOutputHandler(fn func(http.ResponseWriter, *http.Request, string, st
 
 const (
 	gitHubAPITokenEnvVar = "GITHUB_API_TOKEN"
+	// compareCacheSize is the number of comparisons of commits cached in memory.
+	compareCacheSize = 1000
 )
 
-func newGithubClient() (githublib.Client, error) {
-	gt := os.Getenv(gitHubAPITokenEnvVar)
-	if gt == "" {
-		return nil, fmt.Errorf("environment variable %s not defined", gitHubAPITokenEnvVar)
+func newElector(ecl *etcd.Client) (*leader.Elector, error) {
+	id := *instanceID
+	if id == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return leader.New(ecl, id, *leaderTTL), nil
+}
+
+// isAdmin returns true iff "user" is one of the admin users.
+func isAdmin(user string) bool {
+	for _, a := range strings.Split(*admins, ",") {
+		if a = strings.TrimSpace(a); a != "" && a == user {
+			return true
+		}
 	}
-	return githublib.NewClient(gt), nil
+	return false
 }
 
-func buildHandler(ctx context.Context) (http.Handler, error) {
-	gcl, err := newGithubClient()
+// newRateLimiter returns a function which limits the rate of requests to a handler per user.
+func newRateLimiter(ecl *etcd.Client) func(http.Handler) http.Handler {
+	if *rateLimit <= 0 {
+		return func(h http.Handler) http.Handler { return h }
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if *rateLimitShared {
+		store = ratelimit.NewEtcdStore(ecl)
+	}
+	l := ratelimit.New(store, *rateLimit, *rateBurst)
+	return func(h http.Handler) http.Handler {
+		return ratelimit.Handler(l, isAdmin, h)
+	}
+}
+
+// initAuth selects the authentication provider in the config stored in etcd,
+// and enables login with the OpenID Connect provider in the config, if any.
+func initAuth(ecl *etcd.Client) error {
+	c, err := config.Load(ecl)
+	if err != nil {
+		return err
+	}
+	if c.OIDC != nil && c.OIDC.Issuer != "" {
+		auth.EnableOIDC(auth.OIDCConfig{
+			Issuer:       c.OIDC.Issuer,
+			ClientID:     c.OIDC.ClientID,
+			ClientSecret: c.OIDC.ClientSecret,
+			RedirectURL:  c.OIDC.RedirectURL,
+			GroupsClaim:  c.OIDC.GroupsClaim,
+		})
+	}
+	if c.Auth == nil || c.Auth.Provider == "" {
+		return nil
+	}
+	switch p := c.Auth.Provider; p {
+	case config.AuthGithub:
+		if !auth.GithubEnabled() {
+			return fmt.Errorf("github authentication is not configured")
+		}
+		auth.SetProvider(auth.Github)
+	case config.AuthOIDC:
+		if !auth.OIDCEnabled() {
+			return fmt.Errorf("oidc authentication is not configured")
+		}
+		auth.SetProvider(auth.OIDC)
+	case config.AuthHeader:
+		hp, err := auth.NewHeaderProvider(c.Auth.Header, c.Auth.TrustedProxies)
+		if err != nil {
+			return err
+		}
+		auth.SetProvider(hp)
+	case config.AuthAnonymous:
+		auth.SetProvider(auth.Anonymous(auth.User{Name: *defaultUser, Avatar: *defaultAvatar}))
+	default:
+		return fmt.Errorf("unknown authentication provider %q", p)
+	}
+	glog.Infof("Authenticating users with %s", c.Auth.Provider)
+	return nil
+}
+
+// tokenUsageInterval is the interval of writing last-used times of API tokens into etcd.
+const tokenUsageInterval = 30 * time.Second
+
+// runningTTL is how long deployments in progress are visible to other instances after this instance stops refreshing them.
+const runningTTL = time.Minute
+
+// aclCacheTTL is how long /api/v1/status remembers permissions of users.
+const aclCacheTTL = 5 * time.Minute
+
+// cleanupLookupTTL is how long lookups of branches and pull requests for the cleanup column are cached.
+const cleanupLookupTTL = 10 * time.Minute
+
+// sshKeepAliveInterval is the interval of keepalives over pooled SSH connections to hosts.
+const sshKeepAliveInterval = 30 * time.Second
+
+// columnPrefetchInterval is the interval of refreshing cached statuses of plugin columns before they expire.
+const columnPrefetchInterval = 30 * time.Second
+
+// approvalCheckInterval is the interval of checking pending approval requests for reminders.
+const approvalCheckInterval = time.Minute
+
+// scriptCacheDir returns the directory of checkouts of script repos.
+func scriptCacheDir() string {
+	if *scriptsDir != "" {
+		return *scriptsDir
+	}
+	return path.Join(*dataPath, "scripts")
+}
+
+// rollupInterval is the interval of checking whether the last month has been rolled up.
+const rollupInterval = time.Hour
+
+// warmStatus calls "warm" to fill the caches served by /api/v1/status every "interval" until "ctx" is done.
+func warmStatus(ctx context.Context, interval time.Duration, warm func(ctx context.Context) error) {
+	for {
+		if err := warm(ctx); err != nil {
+			glog.Errorf("Failed to fetch status: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// routeBySuffix returns an http.Handler which dispatches requests to the handler for the suffix of the request path.
+func routeBySuffix(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for suffix, h := range handlers {
+			if strings.HasSuffix(r.URL.Path, suffix) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func buildHandler(ctx context.Context, keys *config.Keyring) (http.Handler, error) {
+	ecl := etcd.NewClient([]string{*ETCDServer})
+	if _, err := migrations.Check(ecl); err != nil {
+		glog.Errorf("Refusing to start against the store: %v", err)
+		return nil, err
+	}
+	gcl, err := newGithubClient(ecl)
 	if err != nil {
 		glog.Errorf("Failed to build github client: %v", err)
 		return nil, err
 	}
 
 	ac := acl.Null
-	if auth.Enabled() {
+	if auth.GithubEnabled() {
 		ac = acl.NewGithub(gcl)
 	}
 
@@ -131,35 +325,164 @@ func buildHandler(ctx context.Context) (http.Handler, error) {
 	}
 
 	hub := notification.NewHub(ctx)
-	ecl := etcd.NewClient([]string{*ETCDServer})
-	assets := helpers.New(*staticFilePath)
+	pages, err := newPages(*templatesDir)
+	if err != nil {
+		glog.Errorf("Failed to parse templates: %v", err)
+		return nil, err
+	}
+	assets := helpers.New(*staticFilePath, pages)
+	if err := initAuth(ecl); err != nil {
+		glog.Errorf("Failed to configure authentication: %v", err)
+		return nil, err
+	}
+	usage := tokens.NewRecorder(ecl)
+	if auth.Enabled() {
+		auth.SetProvider(auth.Any(tokens.NewProvider(ecl, usage), auth.CurrentProvider()))
+	}
+
+	elector, err := newElector(ecl)
+	if err != nil {
+		glog.Errorf("Failed to build leader elector: %v", err)
+		return nil, err
+	}
 
+	limit := newRateLimiter(ecl)
+	hostKeys := hostkeys.NewChecker(ecl, hostkeys.ConfiguredTOFU(ecl))
+	sshPool := ssh.NewPool(ssh.PoolOptions{IdleTimeout: *sshIdleTimeout, MaxConns: *sshMaxConns})
+	feed := activity.NewFeed(ecl)
+	scriptCache := scripts.NewCache(scriptCacheDir())
+	registry := running.NewRegistry(ecl, runningTTL)
+	registry.KeepFinished(*deploySettle)
 	mux := http.NewServeMux()
-	mux.Handle("/", auth.Authenticate(HomeHandler{ac: ac, ecl: ecl, assets: assets}))
+	lookups := githublib.NewLookups(gcl, cleanupLookupTTL)
+	configHistory := configHistoryHandler{ac: ac, store: ecl, isAdmin: isAdmin, feed: feed}
+	mux.Handle("/", auth.Authenticate(HomeHandler{ac: ac, ecl: ecl, assets: assets, pushAddr: pushAddr, lookups: lookups}))
 	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, r.URL.Path[1:])
 	})
 
-	dph, err := deploypage.New(assets, fmt.Sprintf("ws://%s/web_push", *bindAddress))
-	if err != nil {
-		glog.Errorf("Failed to build deploy page handler: %v", err)
-		return nil, err
-	}
-	mux.Handle("/deploy", auth.Authenticate(dph))
+	mux.Handle("/deploy", auth.Authenticate(deploypage.New(assets, pushAddr)))
 	mux.Handle("/web_push", websocket.Handler(hub.AcceptConnection))
 
 	dlh := DeployLogHandler{assets: assets}
 	mux.Handle("/deployLog/", auth.AuthenticateFunc(extractDeployLogHandler(ac, ecl, dlh.ServeHTTP)))
 	mux.Handle("/output/", auth.AuthenticateFunc(extractOutputHandler(DeployOutputHandler)))
-	mux.Handle("/commits/", auth.Authenticate(commits.New(ac, ecl, gcl, dcl, *keyPath)))
-	mux.Handle("/deploy_handler", auth.Authenticate(DeployHandler{ecl: ecl, hub: hub}))
-	mux.Handle("/lock", auth.Authenticate(lock.NewLock(ecl)))
-	mux.Handle("/unlock", auth.Authenticate(lock.NewUnlock(ecl)))
-	mux.Handle("/comment", auth.Authenticate(comment.New(ecl)))
+	tips := revision.NewTipCache(*tipTTL)
+	deployed := revision.NewDeployedCache()
+	mux.Handle("/commits/", auth.Authenticate(commits.New(ac, ecl, gcl, dcl, *keyPath, hostKeys, sshPool, tips, deployed, registry.List, *deploySettle, deployedRevisions, lastSuccessfulDeploy, deployRecords)))
+	reminders := notifier.NewReminders(ecl, *approvalReminder, func() (config.Config, error) { return config.Load(ecl) }, notifier.ForEnvironment)
+	dh := DeployHandler{ac: ac, ecl: ecl, hub: hub, gcl: gcl, dcl: dcl, registry: registry, hostKeys: hostKeys, feed: feed, scripts: scriptCache, sshKeyPath: *keyPath, approvals: reminders}
+	mux.Handle("/deploy_handler", auth.Authenticate(limit(dh)))
+	mux.Handle("/lock", auth.Authenticate(limit(lock.NewLock(ac, ecl, feed))))
+	mux.Handle("/unlock", auth.Authenticate(limit(lock.NewUnlock(ac, ecl, feed))))
+	mux.Handle("/comment", auth.Authenticate(limit(comment.New(ac, ecl, feed))))
+	mux.Handle("/pivotal/retry", auth.Authenticate(pivotalRetryHandler{ac: ac, ecl: ecl}))
+	mux.Handle("/clone_environment", auth.Authenticate(clone.New(ecl, isAdmin, feed)))
+	mux.Handle("/admin/retention", auth.Authenticate(retentionHandler{ecl: ecl, isAdmin: isAdmin}))
+	mux.Handle("/admin/templates/reload", auth.Authenticate(templatesReloadHandler{pages: pages, isAdmin: isAdmin}))
+	mux.Handle("/admin/projects/rename", auth.Authenticate(renameProjectHandler{ecl: ecl, isAdmin: isAdmin, feed: feed}))
+	mux.Handle("/admin/reports/monthly", auth.Authenticate(recomputeReportHandler{ecl: ecl, isAdmin: isAdmin}))
+	mux.Handle("/admin/hostkeys", auth.Authenticate(hostKeysHandler{ecl: ecl, isAdmin: isAdmin, feed: feed}))
+	mux.Handle("/admin/blocklist", auth.Authenticate(blocklistHandler{ecl: ecl, isAdmin: isAdmin, feed: feed}))
+	mux.Handle("/admin/hosts", auth.Authenticate(hostEditorHandler{ecl: ecl, isAdmin: isAdmin, feed: feed}))
+	mux.Handle("/admin/notifications/test", auth.Authenticate(notificationTestHandler{ecl: ecl, isAdmin: isAdmin}))
+	mux.Handle("/admin/config/effective", auth.Authenticate(effectiveConfigHandler{ecl: ecl, isAdmin: isAdmin, feed: feed, keyPath: *keyPath}))
+	mux.Handle("/admin/backup", auth.Authenticate(backupHandler{ecl: ecl, isAdmin: isAdmin}))
+	mux.Handle("/admin/restore", auth.Authenticate(restoreHandler{ecl: ecl, keys: keys, isAdmin: isAdmin, feed: feed}))
 	mux.HandleFunc("/auth/github/login", auth.LoginHandler)
 	mux.HandleFunc("/auth/github/callback", auth.CallbackHandler)
+	mux.HandleFunc("/auth/login", auth.LoginPageHandler)
+	mux.HandleFunc("/auth/logout", auth.LogoutHandler)
+	mux.HandleFunc("/auth/oidc/login", auth.OIDCLoginHandler)
+	mux.HandleFunc("/auth/oidc/callback", auth.OIDCCallbackHandler)
+	mux.Handle("/healthz", healthz.New(elector))
+	// scraped by Prometheus without sessions.
+	mux.Handle("/metrics", commits.NewMetrics(ecl, gcl, tips, deployed, columns.DefaultCache.WriteMetrics))
+	mux.Handle("/webhooks/github", githubWebhookHandler{s: ecl, feed: feed, now: time.Now})
+	// slash commands are authenticated by signatures of Slack instead of sessions.
+	mux.Handle("/integrations/slack/command", newSlackCommandHandler(ac, ecl, feed, dh))
+	mux.Handle("/integrations/slack/interact", newSlackInteractionHandler(ac, ecl, reminders, dh))
+	mux.Handle("/api/v1/status", auth.Authenticate(commits.NewStatus(acl.NewCache(ac, aclCacheTTL), ecl, gcl, dcl, *keyPath, hostKeys, tips, deployed, registry.List, *deploySettle)))
+	// wallboards are authenticated by share tokens instead of sessions.
+	mux.Handle("/wallboard", commits.NewWallboardPage(assets, ecl))
+	mux.Handle("/api/v1/wallboard/status", commits.NewWallboardStatus(acl.NewCache(ac, aclCacheTTL), ecl, gcl, dcl, *keyPath, hostKeys, tips, deployed, registry.List, *deploySettle))
+	mux.Handle("/api/v1/wallboard/stream", commits.NewWallboardStream(acl.NewCache(ac, aclCacheTTL), ecl, gcl, dcl, *keyPath, hostKeys, tips, deployed, registry.List, *deploySettle))
+	mux.Handle("/api/v1/drift/age", auth.Authenticate(commits.NewDriftByAge(acl.NewCache(ac, aclCacheTTL), ecl, gcl, tips, deployed, deployedRevisions, lastSuccessfulDeploy)))
+	mux.Handle("/api/v1/me/preferences", auth.Authenticate(preferences.New(ecl)))
+	mux.Handle("/api/v1/me/tokens", auth.Authenticate(tokenhandlers.New(ecl)))
+	mux.Handle("/api/v1/tokens", auth.Authenticate(tokenhandlers.NewAll(ecl, isAdmin)))
+	mux.Handle("/tokens", auth.Authenticate(tokenhandlers.NewPage(assets, isAdmin)))
+	mux.Handle("/api/v1/me/subscriptions", auth.Authenticate(subscriptionhandlers.New(ecl)))
+	mux.Handle("/subscriptions", auth.Authenticate(subscriptionhandlers.NewPage(assets)))
+	mux.Handle("/api/v1/reports/monthly", auth.Authenticate(monthlyReportHandler{ecl: ecl}))
+	mux.Handle("/activity", auth.Authenticate(activityhandlers.NewPage(assets)))
+	mux.Handle("/api/v1/activity", auth.Authenticate(activityhandlers.New(ac, ecl)))
+	mux.Handle("/api/v1/activity/stream", auth.Authenticate(activityhandlers.NewStream(ac, ecl, feed)))
+	mux.Handle("/api/v1/projects/", auth.Authenticate(routeBySuffix(map[string]http.Handler{
+		"/branches":        branches.New(ac, ecl, gcl),
+		"/refresh":         commits.NewRefresh(ac, ecl, gcl, dcl, *keyPath, hostKeys, tips),
+		"/compare":         commits.NewCompare(ac, ecl, gcl, dcl, *keyPath, hostKeys),
+		"/deploy-batch":    limit(batchHandler{dh}),
+		"/annotations":     limit(annotations.New(ac, ecl)),
+		"/drain":           limit(hostsethandler.New(ac, ecl, drain.Hosts)),
+		"/lock":            limit(hostsethandler.New(ac, ecl, hostlock.Hosts)),
+		"/skip":            limit(schedules.New(ac, ecl)),
+		"/external-deploy": limit(newExternalDeployHandler(ac, ecl, deployed)),
+		"/changelog":       newChangelogHandler(ac, ecl, gcl),
+		"/impact":          newImpactHandler(ac, ecl),
+		"/row":             newHomeRowHandler(ac, ecl, lookups),
+		"/config/history":  configHistory,
+		"/config/diff":     configHistory,
+		"/config/rollback": configHistory,
+	})))
+
+	elector.Register("schema-migrations", schemaMigrationInterval, func(ctx context.Context) { runSchemaMigrations(ecl, *migrateDryRun) })
+	elector.Register("retention", *retentionInterval, func(ctx context.Context) { runRetention(ctx, ecl) })
+	elector.Register("monthly-rollup", rollupInterval, func(ctx context.Context) { runMonthlyRollup(ctx, ecl) })
+	elector.Register("ephemeral-expiry", ephemeralExpiryInterval, func(ctx context.Context) { runEphemeralExpiry(ctx, ecl, feed) })
+	elector.Register("pivotal-outbox", pivotalOutboxInterval, func(ctx context.Context) { runPivotalOutbox(ctx, ecl) })
+	elector.Register("host-inventory", *statusInterval, func(ctx context.Context) { runHostInventory(ctx, ecl, feed) })
+	elector.Register("scheduled-deploys", scheduleInterval, newScheduledDeployer(ecl, feed, dh).run)
+	elector.Register("approval-reminders", approvalCheckInterval, reminders.Remind)
+	go elector.Run(ctx)
+	go usage.Run(ctx, tokenUsageInterval)
+	go registry.Run(ctx, runningTTL/3)
+	go sshPool.Run(ctx, sshKeepAliveInterval)
+	go columns.DefaultCache.Run(ctx, columnPrefetchInterval)
+	go warmStatus(ctx, *statusInterval, func(ctx context.Context) error {
+		return commits.Warm(ctx, ecl, gcl, dcl, *keyPath, hostKeys, sshPool, tips, deployed)
+	})
+	return redirectRenamed(func() (config.Config, error) { return config.Load(ecl) }, mux), nil
+}
+
+// runValidate lints the config and reports each environment to "w". It returns false if any problems are found.
+func runValidate(w io.Writer) (bool, error) {
+	results, err := config.Lint(etcd.NewClient([]string{*ETCDServer}), config.LintOptions{SelfCheck: *validateCheck})
+	if err != nil {
+		return false, err
+	}
+	ok := true
+	for _, r := range results {
+		if len(r.Problems) > 0 {
+			ok = false
+		}
+		fmt.Fprintln(w, r)
+	}
+	return ok, nil
+}
 
-	return mux, nil
+// flushOnSignal stops the background jobs by "cancel", sends the buffered notification digests and exits when goship is interrupted or terminated.
+func flushOnSignal(cancel context.CancelFunc) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	s := <-sig
+	glog.Infof("Shutting down on %s", s)
+	cancel()
+	if err := notifier.FlushDigests(); err != nil {
+		glog.Errorf("Failed to flush notification digests: %v", err)
+	}
+	glog.Flush()
+	os.Exit(0)
 }
 
 func initGCP(ctx context.Context) error {
@@ -186,6 +509,11 @@ func main() {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	reqlog.SetThrottleWindow(*logThrottle)
+	if *logThrottle > 0 {
+		go reqlog.RunThrottle(ctx, *logThrottle)
+	}
+
 	auth.Initialize(auth.User{Name: *defaultUser, Avatar: *defaultAvatar}, []byte(*cookieSessionHash))
 	if err := initGCP(ctx); err != nil {
 		glog.Fatal("Failed to load Google Service Account credential: %v", err)
@@ -194,8 +522,62 @@ func main() {
 	if err := os.Mkdir(*dataPath, 0777); err != nil && !os.IsExist(err) {
 		glog.Fatal("could not create data dir: %v", err)
 	}
+	keys, err := config.LoadKeyring()
+	if err != nil {
+		glog.Fatalf("Failed to load the master key: %v", err)
+	}
+	config.SetKeyring(keys)
+	config.SetFallback(config.NewFallback())
+
+	if *validateOnly {
+		ok, err := runValidate(os.Stdout)
+		if err != nil {
+			glog.Fatalf("Failed to validate the config: %v", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "rekey" {
+		n, err := config.Rekey(etcd.NewClient([]string{*ETCDServer}), keys)
+		if err != nil {
+			glog.Fatalf("Failed to re-encrypt secrets: %v", err)
+		}
+		fmt.Printf("Re-encrypted secrets in %d keys\n", n)
+		return
+	}
 
-	h, err := buildHandler(ctx)
+	if flag.Arg(0) == "backup" {
+		if err := runBackup(flag.Args()[1:], os.Stdout); err != nil {
+			glog.Fatalf("Failed to back up state: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "restore" {
+		if err := runRestore(flag.Args()[1:], keys, os.Stdout); err != nil {
+			glog.Fatalf("Failed to restore state: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "bootstrap" {
+		if err := runBootstrap(ctx, os.Stdout); err != nil {
+			glog.Fatalf("Failed to bootstrap deploy state: %v", err)
+		}
+		return
+	}
+
+	if err := proxy.SetBasePath(*basePath); err != nil {
+		glog.Fatalf("Failed to set the base path: %v", err)
+	}
+	trusted, err := proxy.ParseNetworks(splitList(*trustedProxies))
+	if err != nil {
+		glog.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	h, err := buildHandler(ctx, keys)
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -207,14 +589,16 @@ func main() {
 		}
 		defer w.Close()
 	}
-	h = ghandlers.CombinedLoggingHandler(w, h)
+	// the request log records the clients forwarded by trusted proxies.
+	h = proxy.Forwarded(trusted, ghandlers.CombinedLoggingHandler(w, reqlog.Handler(proxy.StripBasePath(h))))
+	go flushOnSignal(cancel)
 
-	fmt.Printf("Running on %s\n", *bindAddress)
+	fmt.Printf("Running on %s%s\n", *bindAddress, proxy.BasePath())
 	s := &http.Server{
 		Addr:    *bindAddress,
 		Handler: h,
 	}
-	if err := s.ListenAndServe(); err != nil {
+	if err := serve(s, *tlsCert, *tlsKey); err != nil {
 		glog.Fatal(err)
 	}
 }
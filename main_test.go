@@ -1,8 +1,14 @@
 package main
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"golang.org/x/net/context"
 )
 
 func TestStripANSICodes(t *testing.T) {
@@ -24,25 +30,202 @@ func TestStripANSICodes(t *testing.T) {
 	}
 }
 
-var now = time.Now()
+func TestExpectedDuration(t *testing.T) {
+	base := time.Date(2015, time.October, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(i int, d time.Duration, success bool) DeployLogEntry {
+		return DeployLogEntry{Time: base.Add(time.Duration(i) * time.Hour), Duration: d, Success: success}
+	}
+	for _, spec := range []struct {
+		entries []DeployLogEntry
+		want    time.Duration
+	}{
+		{
+			entries: nil,
+			want:    0,
+		},
+		{
+			entries: []DeployLogEntry{entry(0, 3*time.Minute, true)},
+			want:    3 * time.Minute,
+		},
+		{
+			// even number of samples
+			entries: []DeployLogEntry{
+				entry(0, 1*time.Minute, true),
+				entry(1, 4*time.Minute, true),
+				entry(2, 2*time.Minute, true),
+				entry(3, 10*time.Minute, true),
+			},
+			want: 3 * time.Minute,
+		},
+		{
+			// failures and entries without durations are ignored
+			entries: []DeployLogEntry{
+				entry(0, 1*time.Minute, true),
+				entry(1, 60*time.Minute, false),
+				entry(2, 0, true),
+				entry(3, 5*time.Minute, true),
+				entry(4, 2*time.Minute, true),
+			},
+			want: 2 * time.Minute,
+		},
+		{
+			// only the last 10 successful deployments count
+			entries: func() []DeployLogEntry {
+				var es []DeployLogEntry
+				for i := 0; i < 5; i++ {
+					es = append(es, entry(i, time.Hour, true))
+				}
+				for i := 5; i < 15; i++ {
+					es = append(es, entry(i, time.Minute, true))
+				}
+				return es
+			}(),
+			want: time.Minute,
+		},
+	} {
+		if got := expectedDuration(spec.entries); got != spec.want {
+			t.Errorf("expectedDuration(%v) = %v; want %v", spec.entries, got, spec.want)
+		}
+	}
+}
+
+func TestPivotalEvent(t *testing.T) {
+	for _, spec := range []struct {
+		success, rollback bool
+		want              config.PivotalEvent
+	}{
+		{success: true, want: config.PivotalDeploySucceeded},
+		{success: false, want: config.PivotalDeployFailed},
+		{success: true, rollback: true, want: config.PivotalRollback},
+		{success: false, rollback: true, want: config.PivotalDeployFailed},
+	} {
+		if got := pivotalEvent(spec.success, spec.rollback); got != spec.want {
+			t.Errorf("pivotalEvent(%v, %v) = %q; want %q", spec.success, spec.rollback, got, spec.want)
+		}
+	}
+}
+
+func TestDeployOptionsApply(t *testing.T) {
+	env := config.Environment{Name: "staging", Branch: "master"}
+	for _, spec := range []struct {
+		opts deployOptions
+		want string
+	}{
+		{opts: deployOptions{}, want: "master"},
+		{opts: deployOptions{Branch: "feature"}, want: "feature"},
+	} {
+		if got := spec.opts.apply(env).Branch; got != spec.want {
+			t.Errorf("%#v.apply(env).Branch = %q; want %q", spec.opts, got, spec.want)
+		}
+		// the configured branch is kept for drift calculations
+		if env.Branch != "master" {
+			t.Errorf("env.Branch = %q after %#v.apply(env); want %q", env.Branch, spec.opts, "master")
+		}
+	}
+}
+
+func TestDeployHosts(t *testing.T) {
+	env := config.Environment{Name: "production", Hosts: []config.Host{{Name: "web1"}, {Name: "web2"}, {Name: "web3"}}}
+	since := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, spec := range []struct {
+		drains drain.Drains
+		want   config.HostList
+	}{
+		{drains: drain.Drains{}, want: config.HostList{"web1", "web2", "web3"}},
+		{
+			drains: drain.Drains{"api/production/web2": {By: "alice", Since: since}},
+			want:   config.HostList{"web1", "web3"},
+		},
+		{
+			// drains of the same host name in other environments do not matter
+			drains: drain.Drains{"api/staging/web1": {By: "alice", Since: since}, "worker/production/web3": {By: "bob", Since: since}},
+			want:   config.HostList{"web1", "web2", "web3"},
+		},
+	} {
+		got, err := deployHosts("api", env, spec.drains)
+		if err != nil {
+			t.Errorf("deployHosts(%q, env, %#v) failed with %v", "api", spec.drains, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("deployHosts(%q, env, %#v) = %q; want %q", "api", spec.drains, got, spec.want)
+		}
+	}
+
+	all := drain.Drains{}
+	for _, h := range env.Hosts {
+		all["api/production/"+h.Name] = drain.Drain{By: "alice", Since: since}
+	}
+	if got, err := deployHosts("api", env, all); err == nil {
+		t.Errorf("deployHosts(%q, env, all) = %q; want failure", "api", got)
+	}
+	if got, err := deployHosts("api", config.Environment{Name: "local"}, drain.Drains{}); config.Cause(err) != config.ErrUnconfigured {
+		t.Errorf("deployHosts(%q, env without hosts, none) = %q, %v; want %v", "api", got, err, config.ErrUnconfigured)
+	}
+}
 
-var formatTimeTests = []struct {
-	t    time.Time
-	want string
-}{
-	{time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC), "Nov 10, 2009 at 11:00pm (UTC)"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second()-1, 0, now.Location()), "1 second ago"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second()-30, 0, now.Location()), "30 seconds ago"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute()-1, now.Second(), 0, now.Location()), "1 minute ago"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute()-30, now.Second(), 0, now.Location()), "30 minutes ago"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour()-1, now.Minute(), now.Second(), 0, now.Location()), "1 hour ago"},
-	{time.Date(now.Year(), now.Month(), now.Day(), now.Hour()-3, now.Minute(), now.Second(), 0, now.Location()), "3 hours ago"},
+func TestDeployerName(t *testing.T) {
+	for user, want := range map[string]string{"alice": "alice", "": "unknown", " ": "unknown"} {
+		if got := deployerName(user); got != want {
+			t.Errorf("deployerName(%q) = %q; want %q", user, got, want)
+		}
+	}
 }
 
-func TestFormatTime(t *testing.T) {
-	for _, tt := range formatTimeTests {
-		if got := formatTime(tt.t); got != tt.want {
-			t.Errorf("formatTime(%s) = %s, want %s", tt.t, got, tt.want)
+func TestCommandEnv(t *testing.T) {
+	env := commandEnv("alice", config.HostList{"web1", "web2"}, map[string]string{"new_checkout": "on"}, "/tmp/known_hosts", "", nil)
+	got := make(map[string]bool)
+	for _, kv := range env {
+		got[kv] = true
+	}
+	for _, want := range []string{"GOSHIP_TRIGGERED_BY=alice", "GOSHIP_HOSTS=web1,web2", "GOSHIP_FLAG_NEW_CHECKOUT=on", "GOSHIP_KNOWN_HOSTS=/tmp/known_hosts"} {
+		if !got[want] {
+			t.Errorf("commandEnv(...) = %q; want %s", env, want)
+		}
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, scriptDirEnvName+"=") {
+			t.Errorf("commandEnv(...) has %s; want none without a script repo", kv)
 		}
+		if strings.HasPrefix(kv, revisionsEnvName+"=") {
+			t.Errorf("commandEnv(...) has %s; want none for a single-repo project", kv)
+		}
+	}
+	env = commandEnv("alice", nil, nil, "", "/tmp/scripts", nil)
+	if !strings.Contains(strings.Join(env, "\n"), "\nGOSHIP_SCRIPT_DIR=/tmp/scripts\n") {
+		t.Errorf("commandEnv(...) = %q; want GOSHIP_SCRIPT_DIR=/tmp/scripts", env)
+	}
+	revs := config.Revisions{"gengo/web": "4567def", "gengo/api": "0123abc"}
+	env = commandEnv("alice", nil, nil, "", "", revs)
+	if !strings.HasSuffix(strings.Join(env, "\n"), "\nGOSHIP_REVISIONS=gengo/api=0123abc,gengo/web=4567def\nGOSHIP_TRIGGERED_BY=alice") {
+		t.Errorf("commandEnv(...) = %q; want GOSHIP_REVISIONS=gengo/api=0123abc,gengo/web=4567def", env)
 	}
 }
+
+func TestInsertEntryRecordsOptions(t *testing.T) {
+	withDataPath(t, func() {
+		proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+		env := config.Environment{Name: "production"}
+		opts := deployOptions{Flags: map[string]string{"new_checkout": "on"}, Note: "Release for the campaign"}
+		deploy := RevRange{From: "abc", To: "def"}
+		if err := (DeployHandler{}).insertEntry(context.Background(), proj, env, deploy, RevRange{}, "alice", true, time.Now(), time.Second, nil, nil, "", nil, opts); err != nil {
+			t.Fatalf("insertEntry(...) failed with %v", err)
+		}
+		entries, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("len(entries) = %d; want 1", len(entries))
+		}
+		if got, want := entries[0].Flags, opts.Flags; !reflect.DeepEqual(got, want) {
+			t.Errorf("entries[0].Flags = %q; want %q", got, want)
+		}
+		if got, want := entries[0].Note, opts.Note; got != want {
+			t.Errorf("entries[0].Note = %q; want %q", got, want)
+		}
+		if got, want := entries[0].User, "alice"; got != want {
+			t.Errorf("entries[0].User = %q; want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/golang/glog"
+)
+
+// trialTargetPivotal is the target of notificationTestHandler which comments on the test story of Pivotal.
+const trialTargetPivotal = "pivotal"
+
+// errNoRecord means the deploy record to replay does not exist.
+var errNoRecord = errors.New("deploy record not found")
+
+// notificationTestHandler lets admins try a notification target out without deploying. It sends an event flagged as a test
+// through the notifier of "target", or comments on the test story of Pivotal if "target" is "pivotal", and responds with
+// what was sent and the status of the remote end. The event is the deploy record "id" replayed if given, or synthesized from
+// "event", "user", "from", "to" and "note" otherwise.
+// i.e. POST http://127.0.0.1:8000/admin/notifications/test?target=slack&project=api&environment=production&event=deploy_failed
+// i.e. POST http://127.0.0.1:8000/admin/notifications/test?target=pivotal&project=api&environment=production&id=api-production-1443700800000000000
+type notificationTestHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+}
+
+func (h notificationTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target := r.FormValue("target")
+	res, err := sendTrial(c, target, r.FormValue("project"), r.FormValue("environment"), r.Form, u.Name, time.Now())
+	switch {
+	case err == errNoRecord || err == notifier.ErrNoTarget:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	glog.Infof("%s sent a test to %s: status %d", u.Name, target, res.Status)
+	buf, err := json.Marshal(res)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// sendTrial sends the test event which "form" asks "user" to send to "target" for the environment "env" of "proj" at "now".
+// Failures of the target are reported in the result rather than as errors.
+func sendTrial(c config.Config, target, proj, env string, form url.Values, user string, now time.Time) (notifier.TestResult, error) {
+	p, _, err := config.ResolveTarget(c.Projects, proj, env)
+	if err != nil {
+		return notifier.TestResult{}, err
+	}
+	ev, at, err := trialEvent(proj, env, form, user, now)
+	if err != nil {
+		return notifier.TestResult{}, err
+	}
+	if target != trialTargetPivotal {
+		return notifier.SendTest(c, proj, env, target, ev)
+	}
+	pev := pivotalEvent(ev.Type != notifier.DeployFailed, false)
+	comment, status, err := config.PostTestToPivotal(c.Pivotal, *p, pev, env, ev.From, ev.To, ev.User, ev.Note, at)
+	if comment == "" {
+		return notifier.TestResult{}, err
+	}
+	res := notifier.TestResult{Target: target, Payload: comment, Status: status}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res, nil
+}
+
+// trialEvent returns the event which "form" asks "user" to send for "proj"/"env" at "now", and when the event happened.
+// It is the deploy record "id" replayed if given, or synthesized from the other parameters. Either way it is flagged as a test.
+func trialEvent(proj, env string, form url.Values, user string, now time.Time) (notifier.Event, time.Time, error) {
+	if id := form.Get("id"); id != "" {
+		entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+		if err != nil {
+			return notifier.Event{}, time.Time{}, err
+		}
+		for _, d := range entries {
+			if d.ID == id {
+				return replayEvent(proj, env, d), d.Time, nil
+			}
+		}
+		return notifier.Event{}, time.Time{}, errNoRecord
+	}
+	ev := notifier.Event{
+		Type:        notifier.EventType(form.Get("event")),
+		ID:          fmt.Sprintf("test-%d", now.UnixNano()),
+		Project:     proj,
+		Environment: env,
+		User:        form.Get("user"),
+		From:        form.Get("from"),
+		To:          form.Get("to"),
+		Note:        form.Get("note"),
+		Test:        true,
+	}
+	if ev.Type == "" {
+		ev.Type = notifier.DeploySucceeded
+	}
+	if ev.User == "" {
+		ev.User = user
+	}
+	return ev, now, nil
+}
+
+// replayEvent returns the test event of the finished deployment recorded in "d" of "proj"/"env".
+func replayEvent(proj, env string, d DeployLogEntry) notifier.Event {
+	ev := notifier.Event{
+		Type:        notifier.DeploySucceeded,
+		ID:          d.ID,
+		Project:     proj,
+		Environment: env,
+		User:        d.User,
+		From:        string(d.Range.From),
+		To:          string(d.Range.To),
+		Duration:    d.Duration,
+		Flags:       d.Flags,
+		Note:        d.Note,
+		Artifacts:   d.Artifacts,
+		Test:        true,
+	}
+	if !d.Success {
+		ev.Type = notifier.DeployFailed
+	}
+	return ev
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+)
+
+func TestTrialEvent(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	withDataPath(t, func() {
+		d := DeployLogEntry{
+			ID:       "api-production-1",
+			Range:    RevRange{From: "1a2b3c4d", To: "5e6f7a8b"},
+			User:     "alice",
+			Success:  false,
+			Time:     now.Add(-time.Hour),
+			Duration: 3 * time.Minute,
+			Note:     "hotfix",
+			Flags:    map[string]string{"migrate": "true"},
+		}
+		if err := appendEntry("api", "production", d); err != nil {
+			t.Fatalf("appendEntry(%q, %q, %#v) failed with %v", "api", "production", d, err)
+		}
+
+		ev, at, err := trialEvent("api", "production", url.Values{"id": {d.ID}, "user": {"bob"}, "note": {"ignored"}}, "admin", now)
+		if err != nil {
+			t.Fatalf("trialEvent(..., id=%q, ...) failed with %v", d.ID, err)
+		}
+		if !ev.Test || ev.Type != notifier.DeployFailed || ev.User != "alice" || ev.From != "1a2b3c4d" || ev.To != "5e6f7a8b" ||
+			ev.Note != "hotfix" || ev.Duration != d.Duration || ev.Flags["migrate"] != "true" || !at.Equal(d.Time) {
+			t.Errorf("trialEvent(..., id=%q, ...) = %#v, %s; want the stored record flagged as a test", d.ID, ev, at)
+		}
+
+		if _, _, err := trialEvent("api", "production", url.Values{"id": {"api-production-2"}}, "admin", now); err != errNoRecord {
+			t.Errorf("trialEvent(..., id=%q, ...) failed with %v; want %v", "api-production-2", err, errNoRecord)
+		}
+	})
+
+	ev, at, err := trialEvent("api", "staging", url.Values{"note": {"trying slack out"}}, "admin", now)
+	if err != nil {
+		t.Fatalf("trialEvent(...) failed with %v", err)
+	}
+	if !ev.Test || ev.Type != notifier.DeploySucceeded || ev.User != "admin" || ev.Note != "trying slack out" || !at.Equal(now) {
+		t.Errorf("trialEvent(...) = %#v, %s; want a synthetic test event by %q", ev, at, "admin")
+	}
+}
+
+func TestSendTrial(t *testing.T) {
+	var text string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ioutil.ReadAll(r.Body) failed with %v", err)
+		}
+		text = string(buf)
+	}))
+	defer srv.Close()
+	c := config.Config{
+		Projects: []config.Project{{
+			Name:         "api",
+			Repo:         config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			Environments: []config.Environment{{Name: "staging"}},
+			NotificationOverrides: map[string]config.NotificationOverride{
+				config.NotifyTargetSlack: {WebhookURL: srv.URL},
+			},
+		}},
+		Pivotal: &config.PivotalConfiguration{Token: "pivotal-token"},
+	}
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	form := url.Values{"event": {string(notifier.DeployStarted)}}
+	res, err := sendTrial(c, config.NotifyTargetSlack, "api", "staging", form, "admin", now)
+	if err != nil {
+		t.Fatalf("sendTrial(c, %q, ...) failed with %v", config.NotifyTargetSlack, err)
+	}
+	if res.Status != http.StatusOK || !strings.Contains(text, `"text":"[TEST] admin is deploying api to *staging*."`) || res.Payload != text {
+		t.Errorf("sendTrial(c, %q, ...) = %#v with %q sent; want the test message", config.NotifyTargetSlack, res, text)
+	}
+
+	for _, spec := range []struct {
+		target, proj string
+		want         error
+	}{
+		{target: config.NotifyTargetCommand, proj: "api", want: notifier.ErrNoTarget},
+		{target: config.NotifyTargetSlack, proj: "web", want: config.ErrProjectNotFound},
+		// no test story
+		{target: trialTargetPivotal, proj: "api", want: config.ErrInvalid},
+	} {
+		if _, err := sendTrial(c, spec.target, spec.proj, "staging", url.Values{}, "admin", now); config.Cause(err) != spec.want {
+			t.Errorf("sendTrial(c, %q, %q, ...) failed with %v; want %v", spec.target, spec.proj, err, spec.want)
+		}
+	}
+}
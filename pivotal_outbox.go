@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/pivotal"
+	"github.com/gengo/goship/lib/proxy"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// pivotalOutboxInterval is the interval of retrying failed Pivotal posts in the outbox.
+const pivotalOutboxInterval = time.Minute
+
+// runPivotalOutbox retries the failed Pivotal posts which are due.
+func runPivotalOutbox(ctx context.Context, s pivotal.OutboxStore) {
+	c, err := config.Load(s)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	retryPivotalOutbox(s, func(p pivotal.Post) (pivotal.Summary, pivotal.Post, error) { return config.RetryPivotal(c.Pivotal, p) }, time.Now())
+}
+
+// retryPivotalOutbox retries the posts in the outbox which are due at "now" with "send", and updates their deploy records.
+func retryPivotalOutbox(s pivotal.OutboxStore, send pivotal.SendFunc, now time.Time) {
+	retried, err := pivotal.RetryDue(s, send, now)
+	if err != nil {
+		glog.Errorf("Failed to retry the Pivotal outbox: %v", err)
+		return
+	}
+	for _, e := range retried {
+		updatePivotalSummary(e)
+	}
+}
+
+// updatePivotalSummary updates the Pivotal summary of the deploy record of "e" after a retry.
+func updatePivotalSummary(e pivotal.OutboxEntry) {
+	sum := e.Summary
+	err := updateEntry(e.Project, e.Environment, e.ID, func(d *DeployLogEntry) { d.Pivotal = &sum })
+	if err != nil {
+		glog.Errorf("Failed to update the Pivotal summary of %s: %v", e.ID, err)
+	}
+}
+
+// enqueuePivotal stores the stories of the deployment "id" which failed in "rest" into the outbox to be retried,
+// and returns "sum" with the state of the retries.
+func enqueuePivotal(s pivotal.OutboxStore, proj, env, id string, sum pivotal.Summary, rest pivotal.Post) pivotal.Summary {
+	if len(rest.Stories) == 0 || s == nil {
+		return sum
+	}
+	e := pivotal.OutboxEntry{ID: id, Project: proj, Environment: env, Post: rest, Summary: sum}
+	queued, err := pivotal.Enqueue(s, e, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to queue %d Pivotal stories of %s for retries: %v", len(rest.Stories), id, err)
+		return sum
+	}
+	return queued
+}
+
+// pivotalRetryHandler retries the failed Pivotal posts of a deployment right now.
+// i.e. http://127.0.0.1:8000/pivotal/retry?id=api-staging-1443700800000000000
+type pivotalRetryHandler struct {
+	ac  acl.AccessControl
+	ecl *etcd.Client
+}
+
+func (h pivotalRetryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to fetch latest configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := r.FormValue("id")
+	e, err := pivotal.GetOutbox(h.ecl, id)
+	if err == pivotal.ErrOutboxNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get outbox entry %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	proj, err := config.FindProject(c.Projects, e.Project)
+	if err != nil {
+		http.Error(w, err.Error(), config.StatusCode(err))
+		return
+	}
+	repo := proj.SourceRepo()
+	if !acl.ForUser(h.ac, c, u).Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	e, err = pivotal.Retry(h.ecl, id, func(p pivotal.Post) (pivotal.Summary, pivotal.Post, error) { return config.RetryPivotal(c.Pivotal, p) }, time.Now())
+	switch err {
+	case nil:
+	case pivotal.ErrOutboxNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case pivotal.ErrOutboxBusy:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		glog.Errorf("Failed to retry outbox entry %s: %v", id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	glog.Infof("%s retried Pivotal posts of %s: %s", u.Name, id, e.Summary)
+	updatePivotalSummary(e)
+	http.Redirect(w, r, proxy.Path(fmt.Sprintf("/deployLog/%s-%s", e.Project, e.Environment)), http.StatusSeeOther)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/pivotal"
+)
+
+// outboxStore is a webhookStore which never conflicts on compare-and-swap.
+type outboxStore struct {
+	webhookStore
+}
+
+func (s outboxStore) CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	return s.Set(key, value, ttl)
+}
+
+func TestRetryPivotalOutbox(t *testing.T) {
+	withDataPath(t, func() {
+		s := outboxStore{make(webhookStore)}
+		at := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+		id := deployID("api", "staging", at)
+		sum := enqueuePivotal(s, "api", "staging", id, pivotal.Summary{Posted: 1, Failed: 2}, pivotal.Post{Stories: []int{2, 3}, Comment: "deployed"})
+		if want := (pivotal.Summary{Posted: 1, Failed: 2, Outbox: pivotal.OutboxPending}); sum != want {
+			t.Errorf("enqueuePivotal(...) = %#v; want %#v", sum, want)
+		}
+		if err := appendEntry("api", "staging", DeployLogEntry{ID: id, Time: at, Success: true, Pivotal: &sum}); err != nil {
+			t.Fatalf("appendEntry(...) failed with %v", err)
+		}
+
+		var sent [][]int
+		send := func(p pivotal.Post) (pivotal.Summary, pivotal.Post, error) {
+			sent = append(sent, p.Stories)
+			p.Stories = nil
+			return pivotal.Summary{Posted: 2}, p, nil
+		}
+		// not due yet
+		retryPivotalOutbox(s, send, time.Now().Add(-time.Hour))
+		if len(sent) != 0 {
+			t.Errorf("retried %v before due; want no retries", sent)
+		}
+		retryPivotalOutbox(s, send, time.Now().Add(time.Hour))
+		if len(sent) != 1 || len(sent[0]) != 2 {
+			t.Errorf("retried %v; want only the failed stories once", sent)
+		}
+
+		entries, err := readEntries("api-staging")
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("readEntries(%q) = %v, %v; want an entry", "api-staging", entries, err)
+		}
+		if got, want := *entries[0].Pivotal, (pivotal.Summary{Posted: 3}); got != want {
+			t.Errorf("Pivotal summary = %#v; want %#v", got, want)
+		}
+	})
+}
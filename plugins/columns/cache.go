@@ -0,0 +1,336 @@
+package columns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultCacheTimeout is the timeout of upstream requests of DefaultCache.
+	defaultCacheTimeout = 5 * time.Second
+	// maxCachedResponseSize is the maximum size of responses read from upstreams.
+	maxCachedResponseSize = 1 << 20
+	// cacheIdleTimeout is how long entries are kept and prefetched after they were last rendered.
+	cacheIdleTimeout = time.Hour
+
+	// DefaultTTL is how long responses are fresh if requests do not tell.
+	DefaultTTL = time.Minute
+)
+
+// ParseTTL parses the optional "ttl" param of a column, e.g. "30s". It returns zero if not given.
+func ParseTTL(params map[string]string) (time.Duration, error) {
+	s := params["ttl"]
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl %q: %v", s, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("ttl %q must be positive", s)
+	}
+	return d, nil
+}
+
+// DefaultCache is the cache shared by the built-in columns.
+var DefaultCache = NewCache(&http.Client{Timeout: defaultCacheTimeout})
+
+// Request is a GET request of a column to its upstream API, e.g. the build status of a CI server.
+type Request struct {
+	// Column is the type of the column, which labels the metrics.
+	Column string
+	URL    string
+	// Header is added to the request, e.g. Authorization.
+	Header http.Header
+	// TTL is how long the response is fresh. It defaults to DefaultTTL.
+	TTL time.Duration
+}
+
+// key identifies the cached response of "r". Requests with different credentials are cached apart.
+func (r Request) key() string {
+	return r.URL + "\x00" + r.Header.Get("Authorization")
+}
+
+// cacheEntry is a cached response and its validators for conditional requests.
+type cacheEntry struct {
+	req Request
+	// mu serializes fetches of the entry, so that concurrent renders make one upstream request.
+	mu sync.Mutex
+
+	// the fields below are guarded by Cache.mu.
+	body         []byte
+	etag         string
+	lastModified string
+	expires      time.Time
+	used         time.Time
+}
+
+// cacheStats are the counters of a column type.
+type cacheStats struct {
+	hits, misses, stale            int64
+	fetched, notModified, failures int64
+	prefetches, evictions          int64
+}
+
+// Cache caches responses of the upstream APIs of columns, so that rendering rows does not query them every time.
+// Expired entries are revalidated with If-None-Match and If-Modified-Since if the upstream gave an ETag or Last-Modified,
+// and Run refreshes entries before they expire so that renders usually do not wait on the network.
+type Cache struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	stats   map[string]*cacheStats
+}
+
+// NewCache returns a new empty Cache which fetches responses with "client".
+func NewCache(client *http.Client) *Cache {
+	return &Cache{
+		client:  client,
+		now:     time.Now,
+		entries: make(map[string]*cacheEntry),
+		stats:   make(map[string]*cacheStats),
+	}
+}
+
+// Get returns the body of the response to "req". Fresh responses are returned from the cache.
+// If revalidating an expired response fails, the expired one is returned with the error logged.
+func (c *Cache) Get(req Request) ([]byte, error) {
+	c.mu.Lock()
+	e, ok := c.entries[req.key()]
+	if !ok {
+		e = &cacheEntry{req: req}
+		c.entries[req.key()] = e
+	}
+	e.req, e.used = req, c.now()
+	if ok && c.now().Before(e.expires) {
+		c.statsOf(req.Column).hits++
+		body := e.body
+		c.mu.Unlock()
+		return body, nil
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c.mu.Lock()
+	// another render may have fetched it while waiting.
+	if c.now().Before(e.expires) {
+		c.statsOf(req.Column).hits++
+		body := e.body
+		c.mu.Unlock()
+		return body, nil
+	}
+	stale := e.body
+	if stale == nil {
+		c.statsOf(req.Column).misses++
+	} else {
+		c.statsOf(req.Column).stale++
+	}
+	c.mu.Unlock()
+
+	body, err := c.fetch(e)
+	if err != nil && stale != nil {
+		glog.Warningf("Serving the expired response of %s since revalidation failed: %v", req.URL, err)
+		return stale, nil
+	}
+	return body, err
+}
+
+// fetch fetches the response of "e" with its validators, and updates "e". The caller must hold e.mu.
+func (c *Cache) fetch(e *cacheEntry) ([]byte, error) {
+	c.mu.Lock()
+	req, etag, lastModified := e.req, e.etag, e.lastModified
+	c.mu.Unlock()
+
+	r, err := http.NewRequest("GET", req.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := c.client.Do(r)
+	if err != nil {
+		c.count(req.Column, func(s *cacheStats) { s.failures++ })
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.statsOf(req.Column)
+	switch {
+	case resp.StatusCode == http.StatusNotModified && e.body != nil:
+		s.notModified++
+	case http.StatusOK <= resp.StatusCode && resp.StatusCode < http.StatusMultipleChoices:
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedResponseSize))
+		if err != nil {
+			s.failures++
+			return nil, err
+		}
+		s.fetched++
+		e.body, e.etag, e.lastModified = body, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	default:
+		s.failures++
+		return nil, fmt.Errorf("unexpected HTTP status %d from %s", resp.StatusCode, req.URL)
+	}
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	e.expires = c.now().Add(ttl)
+	return e.body, nil
+}
+
+// Prefetch refreshes the entries which expire within "ahead", and evicts the ones which have not been rendered recently.
+// It returns the number of entries refreshed.
+func (c *Cache) Prefetch(ahead time.Duration) int {
+	now := c.now()
+	var due []*cacheEntry
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if now.Sub(e.used) > cacheIdleTimeout {
+			delete(c.entries, k)
+			c.statsOf(e.req.Column).evictions++
+			continue
+		}
+		if e.body != nil && !now.Add(ahead).Before(e.expires) {
+			due = append(due, e)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, e := range due {
+		c.mu.Lock()
+		req := e.req
+		c.mu.Unlock()
+		e.mu.Lock()
+		if _, err := c.fetch(e); err != nil {
+			glog.Warningf("Failed to prefetch %s: %v", req.URL, err)
+		}
+		e.mu.Unlock()
+		c.count(req.Column, func(s *cacheStats) { s.prefetches++ })
+	}
+	return len(due)
+}
+
+// Run prefetches entries every "interval" until "ctx" is done.
+// Entries which would expire before the next round are refreshed, so that they stay fresh while rendered.
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.Prefetch(interval)
+		}
+	}
+}
+
+func (c *Cache) count(column string, f func(s *cacheStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(c.statsOf(column))
+}
+
+// statsOf returns the counters of "column". The caller must hold c.mu.
+func (c *Cache) statsOf(column string) *cacheStats {
+	s, ok := c.stats[column]
+	if !ok {
+		s = new(cacheStats)
+		c.stats[column] = s
+	}
+	return s
+}
+
+// cacheCounters are the counters of Cache in the Prometheus text format, labeled by "result".
+var cacheCounters = []struct {
+	name, help string
+	results    map[string]func(s *cacheStats) int64
+}{
+	{
+		name: "goship_column_cache_lookups_total",
+		help: "Lookups of the column cache by renders.",
+		results: map[string]func(s *cacheStats) int64{
+			"hit":   func(s *cacheStats) int64 { return s.hits },
+			"miss":  func(s *cacheStats) int64 { return s.misses },
+			"stale": func(s *cacheStats) int64 { return s.stale },
+		},
+	},
+	{
+		name: "goship_column_cache_upstream_requests_total",
+		help: "Requests of the column cache to the upstream APIs.",
+		results: map[string]func(s *cacheStats) int64{
+			"fetched":      func(s *cacheStats) int64 { return s.fetched },
+			"not_modified": func(s *cacheStats) int64 { return s.notModified },
+			"failed":       func(s *cacheStats) int64 { return s.failures },
+		},
+	},
+	{
+		name: "goship_column_cache_refreshes_total",
+		help: "Background refreshes and evictions of cached entries.",
+		results: map[string]func(s *cacheStats) int64{
+			"prefetched": func(s *cacheStats) int64 { return s.prefetches },
+			"evicted":    func(s *cacheStats) int64 { return s.evictions },
+		},
+	},
+}
+
+// WriteMetrics writes the counters of the cache by column types in the Prometheus text format.
+func (c *Cache) WriteMetrics(w io.Writer) error {
+	c.mu.Lock()
+	columns := make([]string, 0, len(c.stats))
+	stats := make(map[string]cacheStats)
+	for name, s := range c.stats {
+		columns = append(columns, name)
+		stats[name] = *s
+	}
+	entries := len(c.entries)
+	c.mu.Unlock()
+	sort.Strings(columns)
+
+	var buf bytes.Buffer
+	for _, m := range cacheCounters {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+		results := make([]string, 0, len(m.results))
+		for r := range m.results {
+			results = append(results, r)
+		}
+		sort.Strings(results)
+		for _, col := range columns {
+			s := stats[col]
+			for _, r := range results {
+				fmt.Fprintf(&buf, "%s{column=\"%s\",result=\"%s\"} %d\n", m.name, labelEscaper.Replace(col), r, m.results[r](&s))
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "# HELP goship_column_cache_entries Responses in the column cache.\n# TYPE goship_column_cache_entries gauge\ngoship_column_cache_entries %d\n", entries)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// labelEscaper escapes label values in the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
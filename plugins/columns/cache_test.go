@@ -0,0 +1,182 @@
+package columns
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upstream is a fake API which counts requests and answers conditional ones with 304 while "etag" matches.
+type upstream struct {
+	mu          sync.Mutex
+	requests    int
+	conditional int
+	etag        string
+	fail        bool
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+	if u.fail {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		u.conditional++
+		if inm == u.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("ETag", u.etag)
+	fmt.Fprintf(w, "body %s", u.etag)
+}
+
+// newTestCache returns a cache with a fake clock and an upstream server.
+func newTestCache() (*Cache, *upstream, *httptest.Server, *time.Time) {
+	u := &upstream{etag: `"v1"`}
+	s := httptest.NewServer(u)
+	now := time.Date(2016, 3, 1, 10, 0, 0, 0, time.UTC)
+	c := NewCache(http.DefaultClient)
+	c.now = func() time.Time { return now }
+	return c, u, s, &now
+}
+
+func TestCacheGetWithinTTL(t *testing.T) {
+	c, u, s, now := newTestCache()
+	defer s.Close()
+	req := Request{Column: "travis", URL: s.URL + "/status", TTL: time.Minute}
+
+	for i := 0; i < 10; i++ {
+		body, err := c.Get(req)
+		if err != nil {
+			t.Fatalf("c.Get(req) failed with %v", err)
+		}
+		if got, want := string(body), `body "v1"`; got != want {
+			t.Errorf("c.Get(req) = %q; want %q", got, want)
+		}
+		*now = now.Add(5 * time.Second)
+	}
+	if u.requests != 1 {
+		t.Errorf("upstream got %d requests for 10 renders within the TTL; want 1", u.requests)
+	}
+
+	// requests with other credentials are not served from the cache.
+	other := req
+	other.Header = http.Header{"Authorization": {"token other"}}
+	if _, err := c.Get(other); err != nil {
+		t.Fatalf("c.Get(other) failed with %v", err)
+	}
+	if u.requests != 2 {
+		t.Errorf("upstream got %d requests; want 2", u.requests)
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	c, u, s, now := newTestCache()
+	defer s.Close()
+	req := Request{Column: "jenkins", URL: s.URL + "/status", TTL: time.Minute}
+
+	if _, err := c.Get(req); err != nil {
+		t.Fatalf("c.Get(req) failed with %v", err)
+	}
+	*now = now.Add(2 * time.Minute)
+	body, err := c.Get(req)
+	if err != nil || string(body) != `body "v1"` {
+		t.Errorf("c.Get(req) = %q, %v after not modified; want the cached body", body, err)
+	}
+	if u.conditional != 1 {
+		t.Errorf("upstream got %d conditional requests; want 1", u.conditional)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	u.etag = `"v2"`
+	if body, err := c.Get(req); err != nil || string(body) != `body "v2"` {
+		t.Errorf("c.Get(req) = %q, %v after modified; want the new body", body, err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	u.fail = true
+	if body, err := c.Get(req); err != nil || string(body) != `body "v2"` {
+		t.Errorf("c.Get(req) = %q, %v while the upstream is down; want the expired body", body, err)
+	}
+	if _, err := c.Get(Request{Column: "jenkins", URL: s.URL + "/other"}); err == nil {
+		t.Errorf("c.Get(other) succeeded while the upstream is down; want failure")
+	}
+}
+
+func TestCachePrefetch(t *testing.T) {
+	c, u, s, now := newTestCache()
+	defer s.Close()
+	req := Request{Column: "travis", URL: s.URL + "/status", TTL: time.Minute}
+	if _, err := c.Get(req); err != nil {
+		t.Fatalf("c.Get(req) failed with %v", err)
+	}
+
+	// prefetch every 30s as Run does, rendering in between.
+	for i := 0; i < 10; i++ {
+		*now = now.Add(30 * time.Second)
+		c.Prefetch(30 * time.Second)
+		before := u.requests
+		if _, err := c.Get(req); err != nil {
+			t.Fatalf("c.Get(req) failed with %v", err)
+		}
+		if u.requests != before {
+			t.Errorf("c.Get(req) requested the upstream after %v; want the entry kept fresh", time.Duration(i+1)*30*time.Second)
+		}
+	}
+
+	*now = now.Add(cacheIdleTimeout + time.Minute)
+	if n := c.Prefetch(30 * time.Second); n != 0 {
+		t.Errorf("c.Prefetch(30s) = %d after idle; want 0", n)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("%d entries are left after idle; want evicted", len(c.entries))
+	}
+}
+
+func TestCacheWriteMetrics(t *testing.T) {
+	c, _, s, _ := newTestCache()
+	defer s.Close()
+	req := Request{Column: "travis", URL: s.URL + "/status"}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Get(req); err != nil {
+			t.Fatalf("c.Get(req) failed with %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteMetrics(&buf); err != nil {
+		t.Fatalf("c.WriteMetrics(&buf) failed with %v", err)
+	}
+	for _, want := range []string{
+		`goship_column_cache_lookups_total{column="travis",result="hit"} 2`,
+		`goship_column_cache_lookups_total{column="travis",result="miss"} 1`,
+		`goship_column_cache_upstream_requests_total{column="travis",result="fetched"} 1`,
+		"# TYPE goship_column_cache_entries gauge\ngoship_column_cache_entries 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics = %s; want %q", buf.String(), want)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for params, want := range map[string]time.Duration{"": 0, "30s": 30 * time.Second, "5m": 5 * time.Minute} {
+		if got, err := ParseTTL(map[string]string{"ttl": params}); err != nil || got != want {
+			t.Errorf("ParseTTL(ttl: %q) = %v, %v; want %v", params, got, err, want)
+		}
+	}
+	for _, ttl := range []string{"soon", "-1m", "0s"} {
+		if _, err := ParseTTL(map[string]string{"ttl": ttl}); err == nil {
+			t.Errorf("ParseTTL(ttl: %q) succeeded; want failure", ttl)
+		}
+	}
+}
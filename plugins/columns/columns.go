@@ -0,0 +1,125 @@
+// Package columns is a registry of plugin columns which projects configure by name in "plugin_columns", e.g.
+//
+//	plugin_columns:
+//	- type: travis
+//	- type: jenkins
+//	  params: {url: "https://jenkins.example.com", job: "api"}
+//
+// Plugins register their factories in init, and the columns are instantiated when the config is loaded.
+package columns
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/plugins/plugin"
+)
+
+// Factory instantiates a column from its params. It returns an error if the params are bad.
+type Factory func(params map[string]string) (plugin.Column, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+func init() {
+	config.SetColumnCheck(func(p config.Project, c config.PluginColumn) error {
+		_, err := New(p, c)
+		return err
+	})
+	plugin.RegisterPlugin(columnsPlugin{})
+}
+
+// Register registers "factory" of columns as "name". It panics if "name" is already registered.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("column type %s registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// Types returns the names of the registered factories in order.
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New instantiates the column configured by "c" for the project "p".
+func New(p config.Project, c config.PluginColumn) (plugin.Column, error) {
+	mu.RLock()
+	f, ok := factories[c.Type]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown column type %q", c.Type)
+	}
+	return f(c.ParamsFor(p))
+}
+
+// columnsPlugin renders PluginColumns of projects, customized by environments.
+type columnsPlugin struct{}
+
+func (columnsPlugin) Apply(p config.Project) ([]plugin.Column, error) {
+	var cols []plugin.Column
+	for _, c := range p.PluginColumns {
+		col, err := New(p, c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin column %s of %s: %v", c.Type, p.Name, err)
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// AddColumns adds the columns of "p" to "cols". Columns of the project are rendered in all the environments
+// unless overridden or disabled by the environments, and columns only of environments get their own slots.
+func (pl columnsPlugin) AddColumns(p config.Project, cols *plugin.Columns) error {
+	base := make(map[string]config.PluginColumn)
+	slots := make(map[string]*plugin.Slot)
+	for _, c := range p.PluginColumns {
+		col, err := New(p, c)
+		if err != nil {
+			return fmt.Errorf("invalid plugin column %s of %s: %v", c.Type, p.Name, err)
+		}
+		s := cols.AddPluginColumn(col)
+		if _, ok := slots[c.Key()]; !ok {
+			base[c.Key()], slots[c.Key()] = c, s
+		}
+	}
+	for _, e := range p.Environments {
+		if e.PluginColumns == nil {
+			continue
+		}
+		for _, key := range e.PluginColumns.Disable {
+			if s, ok := slots[key]; ok {
+				s.Disable(e.Name)
+			}
+		}
+		for _, c := range e.PluginColumns.Add {
+			key := c.Key()
+			if b, ok := base[key]; ok {
+				c = b.Override(c)
+			}
+			col, err := New(p, c)
+			if err != nil {
+				return fmt.Errorf("invalid plugin column %s of %s of %s: %v", key, e.Name, p.Name, err)
+			}
+			if s, ok := slots[key]; ok {
+				s.Override(e.Name, col)
+				continue
+			}
+			slots[key] = cols.AddEnvironmentColumn(e.Name, col)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package columns_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/plugins/columns"
+	"github.com/gengo/goship/plugins/jenkins"
+	"github.com/gengo/goship/plugins/plugin"
+	"github.com/gengo/goship/plugins/remote"
+	"github.com/gengo/goship/plugins/travis"
+	"github.com/gengo/goship/plugins/version"
+)
+
+// fixtureClient serves a config with a project "api" whose project config is "project".
+// The project has the environments in "environments" in order if not empty, or only "production" otherwise.
+type fixtureClient struct {
+	project      string
+	environments []fixtureEnvironment
+}
+
+// fixtureEnvironment is an environment served by fixtureClient.
+type fixtureEnvironment struct {
+	name, config string
+}
+
+func (c fixtureClient) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	switch key {
+	case "/goship/config":
+		return &etcd.Response{Node: &etcd.Node{Key: key, Value: `{"deploy_user": "deployer"}`}}, nil
+	case "/goship/projects":
+		envs := c.environments
+		if len(envs) == 0 {
+			envs = []fixtureEnvironment{{name: "production", config: `{"hosts": ["web1"]}`}}
+		}
+		var nodes etcd.Nodes
+		for _, e := range envs {
+			nodes = append(nodes, &etcd.Node{Key: "/goship/projects/api/environments/" + e.name, Value: e.config})
+		}
+		return &etcd.Response{Node: &etcd.Node{Key: key, Dir: true, Nodes: etcd.Nodes{
+			{Key: "/goship/projects/api", Dir: true, Nodes: etcd.Nodes{
+				{Key: "/goship/projects/api/config", Value: c.project},
+				{Key: "/goship/projects/api/environments", Dir: true, Nodes: nodes},
+			}},
+		}}}, nil
+	}
+	return nil, &etcd.EtcdError{ErrorCode: 100}
+}
+
+func (fixtureClient) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	return nil, errors.New("read only")
+}
+
+func TestBuiltins(t *testing.T) {
+	if got, want := columns.Types(), []string{"jenkins", "remote", "travis", "version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns.Types() = %q; want %q", got, want)
+	}
+
+	c, err := config.Load(fixtureClient{project: `{
+		"repo_owner": "gengo",
+		"repo_name": "api",
+		"travis_token": "secret",
+		"plugin_columns": [
+			{"type": "travis"},
+			{"type": "jenkins", "params": {"url": "https://jenkins.example.com/", "job": "api-build"}},
+			{"type": "remote", "params": {"url": "https://ci.example.com/column"}},
+			{"type": "version", "params": {"url": "https://status.example.com/version", "header": "Release", "ttl": "30s"}}
+		]
+	}`})
+	if err != nil {
+		t.Fatalf("config.Load(ecl) failed with %v", err)
+	}
+	proj, err := config.ProjectFromName(c.Projects, "api")
+	if err != nil {
+		t.Fatalf("config.ProjectFromName(projects, %q) failed with %v", "api", err)
+	}
+	var cols []plugin.Column
+	for _, pl := range plugin.Plugins {
+		cs, err := pl.Apply(proj)
+		if err != nil {
+			t.Fatalf("pl.Apply(proj) failed with %v", err)
+		}
+		cols = append(cols, cs...)
+	}
+	if got, want := len(cols), 4; got != want {
+		t.Fatalf("len(cols) = %d; want %d", got, want)
+	}
+	if got, want := cols[0], (travis.TravisColumn{Project: "api", Token: "secret", Organization: "gengo"}); got != want {
+		t.Errorf("cols[0] = %#v; want %#v", got, want)
+	}
+	if got, want := cols[1], (jenkins.JenkinsColumn{URL: "https://jenkins.example.com", Job: "api-build"}); got != want {
+		t.Errorf("cols[1] = %#v; want %#v", got, want)
+	}
+	if got, ok := cols[2].(remote.RemoteColumn); !ok || got.URL != "https://ci.example.com/column" || got.Project != "api" {
+		t.Errorf("cols[2] = %#v; want a remote column of https://ci.example.com/column", cols[2])
+	}
+	if got, ok := cols[3].(version.VersionColumn); !ok || got.URL != "https://status.example.com/version" || got.Header != "Release" {
+		t.Errorf("cols[3] = %#v; want a version column of https://status.example.com/version", cols[3])
+	}
+}
+
+func TestInvalidColumns(t *testing.T) {
+	for _, spec := range []struct {
+		column string
+		// msg is a part of the expected error message.
+		msg string
+	}{
+		{column: `{"params": {"url": "https://ci.example.com"}}`, msg: "type of plugin_columns[0] of api not configured"},
+		{column: `{"type": "unknown"}`, msg: `unknown column type "unknown"`},
+		{column: `{"type": "jenkins"}`, msg: "is not an absolute http(s) URL"},
+		{column: `{"type": "jenkins", "params": {"url": "https://jenkins.example.com", "repo_name": ""}}`, msg: "job is required"},
+		{column: `{"type": "remote", "params": {"url": "/relative"}}`, msg: "is not an absolute http(s) URL"},
+		{column: `{"type": "version", "params": {"url": "https://status.example.com", "ttl": "soon"}}`, msg: `invalid ttl "soon"`},
+		{column: `{"type": "travis", "params": {"repo_owner": ""}}`, msg: "repo_owner and repo_name are required"},
+	} {
+		proj := `{"repo_owner": "gengo", "repo_name": "api", "plugin_columns": [` + spec.column + `]}`
+		c, err := config.Lint(fixtureClient{project: proj}, config.LintOptions{})
+		if err != nil {
+			t.Errorf("config.Lint(ecl, opts) failed with %v for %s", err, spec.column)
+			continue
+		}
+		var problems []string
+		for _, r := range c {
+			problems = append(problems, r.Problems...)
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0], spec.msg) || !strings.Contains(problems[0], "api") {
+			t.Errorf("problems of %s = %q; want a problem of api with %q", spec.column, problems, spec.msg)
+		}
+	}
+}
+
+// envColumnsProject has default columns inherited by the environments in envColumnsEnvironments.
+const envColumnsProject = `{
+	"repo_owner": "gengo",
+	"repo_name": "api",
+	"travis_token": "secret",
+	"plugin_columns": [
+		{"type": "travis"},
+		{"type": "jenkins", "params": {"url": "https://jenkins.example.com", "job": "api"}}
+	]
+}`
+
+var envColumnsEnvironments = []fixtureEnvironment{
+	{name: "production", config: `{"hosts": ["web1"]}`},
+	{name: "qa", config: `{"plugin_columns": {"add": [{"type": "version", "params": {"url": "https://status.example.com/version"}}]}}`},
+	{name: "staging", config: `{"plugin_columns": {"add": [{"type": "jenkins", "params": {"job": "api-staging"}}], "disable": ["travis"]}}`},
+}
+
+func TestEnvironmentColumns(t *testing.T) {
+	c, err := config.Load(fixtureClient{project: envColumnsProject, environments: envColumnsEnvironments})
+	if err != nil {
+		t.Fatalf("config.Load(ecl) failed with %v", err)
+	}
+	proj, err := config.ProjectFromName(c.Projects, "api")
+	if err != nil {
+		t.Fatalf("config.ProjectFromName(projects, %q) failed with %v", "api", err)
+	}
+
+	keys := func(cols []config.PluginColumn) []string {
+		var keys []string
+		for _, c := range cols {
+			keys = append(keys, c.Key())
+		}
+		return keys
+	}
+	for env, want := range map[string][]string{
+		"production": {"travis", "jenkins"},
+		"qa":         {"travis", "jenkins", "version"},
+		"staging":    {"jenkins"},
+	} {
+		_, e, err := config.EnvironmentFromName(c.Projects, "api", env)
+		if err != nil {
+			t.Fatalf("config.EnvironmentFromName(projects, %q, %q) failed with %v", "api", env, err)
+		}
+		if got := keys(proj.ColumnsOf(*e)); !reflect.DeepEqual(got, want) {
+			t.Errorf("proj.ColumnsOf(%s) = %q; want %q", env, got, want)
+		}
+	}
+
+	cols, err := plugin.ColumnsFor(proj)
+	if err != nil {
+		t.Fatalf("plugin.ColumnsFor(proj) failed with %v", err)
+	}
+	if got, want := len(cols.Headers()), 3; got != want {
+		t.Fatalf("len(cols.Headers()) = %d; want %d", got, want)
+	}
+	travisCol := travis.TravisColumn{Project: "api", Token: "secret", Organization: "gengo"}
+	jenkinsCol := jenkins.JenkinsColumn{URL: "https://jenkins.example.com", Job: "api"}
+	for env, want := range map[string][]plugin.Column{
+		"production": {travisCol, jenkinsCol, nil},
+		"staging":    {nil, jenkins.JenkinsColumn{URL: "https://jenkins.example.com", Job: "api-staging"}, nil},
+	} {
+		if got := cols.Row(env); !reflect.DeepEqual(got, want) {
+			t.Errorf("cols.Row(%q) = %#v; want %#v", env, got, want)
+		}
+	}
+	row := cols.Row("qa")
+	if len(row) != 3 || row[0] != travisCol || row[1] != jenkinsCol {
+		t.Fatalf("cols.Row(%q) = %#v; want the columns of the project followed by version", "qa", row)
+	}
+	if got, ok := row[2].(version.VersionColumn); !ok || got.URL != "https://status.example.com/version" {
+		t.Errorf("cols.Row(%q)[2] = %#v; want a version column", "qa", row[2])
+	}
+}
+
+func TestInvalidEnvironmentColumns(t *testing.T) {
+	for _, spec := range []struct {
+		project, env string
+		// msg is a part of the expected error message.
+		msg string
+	}{
+		{project: envColumnsProject, env: `{"plugin_columns": {"disable": ["circle"]}}`, msg: `unknown column "circle"`},
+		{project: envColumnsProject, env: `{"plugin_columns": {"add": [{"type": "unknown"}]}}`, msg: `unknown column type "unknown"`},
+		{project: envColumnsProject, env: `{"plugin_columns": {"add": [{"params": {"job": "x"}}]}}`, msg: "type of plugin_columns.add[0]"},
+		{project: envColumnsProject, env: `{"plugin_columns": {"add": [{"type": "jenkins", "params": {"url": "/relative"}}]}}`, msg: "is not an absolute http(s) URL"},
+		{
+			project: `{"repo_owner": "gengo", "repo_name": "api", "plugin_columns": [{"type": "travis"}, {"type": "travis"}]}`,
+			env:     `{"plugin_columns": {"disable": ["travis"]}}`,
+			msg:     "is ambiguous",
+		},
+	} {
+		ecl := fixtureClient{project: spec.project, environments: []fixtureEnvironment{{name: "staging", config: spec.env}}}
+		c, err := config.Lint(ecl, config.LintOptions{})
+		if err != nil {
+			t.Errorf("config.Lint(ecl, opts) failed with %v for %s", err, spec.env)
+			continue
+		}
+		var problems []string
+		for _, r := range c {
+			problems = append(problems, r.Problems...)
+		}
+		if len(problems) != 1 || !strings.Contains(problems[0], spec.msg) || !strings.Contains(problems[0], "staging") {
+			t.Errorf("problems of %s = %q; want a problem of staging with %q", spec.env, problems, spec.msg)
+		}
+	}
+}
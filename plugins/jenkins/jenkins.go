@@ -0,0 +1,121 @@
+// Jenkins adds build status badges of Jenkins jobs to Goship.
+// It needs the Embeddable Build Status plugin of Jenkins. Add the column to "plugin_columns" of the project config:
+//
+//	{type: jenkins, params: {url: "https://jenkins.example.com", job: "api"}}
+//
+// "job" defaults to the repo name of the project.
+// The last build of the job is fetched from the JSON API of Jenkins through columns.DefaultCache, which keeps
+// it for "ttl" (e.g. "30s") if given. The badge is shown instead while the API is not available.
+package jenkins
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/plugins/columns"
+	"github.com/gengo/goship/plugins/plugin"
+	"github.com/golang/glog"
+)
+
+// statusCache caches the responses of Jenkins.
+var statusCache = columns.DefaultCache
+
+func init() {
+	columns.Register("jenkins", newColumn)
+}
+
+// JenkinsColumn is a build status badge of a Jenkins job.
+type JenkinsColumn struct {
+	// URL is the root URL of Jenkins.
+	URL string
+	Job string
+	// TTL is how long the last build is cached. Zero means columns.DefaultTTL.
+	TTL time.Duration
+}
+
+func newColumn(params map[string]string) (plugin.Column, error) {
+	u, err := url.Parse(params["url"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", params["url"], err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url %q is not an absolute http(s) URL", params["url"])
+	}
+	job := params["job"]
+	if job == "" {
+		job = params["repo_name"]
+	}
+	if job == "" {
+		return nil, fmt.Errorf("job is required")
+	}
+	ttl, err := columns.ParseTTL(params)
+	if err != nil {
+		return nil, err
+	}
+	return JenkinsColumn{URL: strings.TrimSuffix(params["url"], "/"), Job: job, TTL: ttl}, nil
+}
+
+// Trusted marks the column as built-in. Its values are escaped, and the badge is hidden by an inline handler if broken.
+func (c JenkinsColumn) Trusted() {}
+
+func (c JenkinsColumn) RenderHeader() (template.HTML, error) {
+	return template.HTML(`<th style="min-width: 100px">Jenkins</th>`), nil
+}
+
+func (c JenkinsColumn) RenderDetail() (template.HTML, error) {
+	link := fmt.Sprintf("%s/job/%s/", c.URL, (&url.URL{Path: c.Job}).String())
+	b, err := c.lastBuild(link)
+	if err != nil {
+		glog.Warningf("Failed to get the last build of %s from %s: %v", c.Job, c.URL, err)
+		badge := fmt.Sprintf("%s/buildStatus/icon?job=%s", c.URL, url.QueryEscape(c.Job))
+		return template.HTML(fmt.Sprintf(`<td><a target="_blank" href="%s"><img src="%s" onerror='this.style.display = "none"'></a></td>`,
+			template.HTMLEscapeString(link), template.HTMLEscapeString(badge))), nil
+	}
+	class, text := "label-info", fmt.Sprintf("#%d building", b.Number)
+	if !b.Building {
+		text = fmt.Sprintf("#%d %s", b.Number, strings.ToLower(b.Result))
+		switch b.Result {
+		case "SUCCESS":
+			class = "label-success"
+		case "FAILURE":
+			class = "label-danger"
+		case "UNSTABLE":
+			class = "label-warning"
+		default:
+			class = "label-default"
+		}
+	}
+	return template.HTML(fmt.Sprintf(`<td><a target="_blank" href="%s%d/"><span class="label %s">%s</span></a></td>`,
+		template.HTMLEscapeString(link), b.Number, class, template.HTMLEscapeString(text))), nil
+}
+
+// jenkinsBuild is a build in the JSON API of Jenkins.
+type jenkinsBuild struct {
+	Number   int    `json:"number"`
+	Result   string `json:"result"`
+	Building bool   `json:"building"`
+}
+
+// lastBuild returns the last build of the job at "link".
+func (c JenkinsColumn) lastBuild(link string) (jenkinsBuild, error) {
+	body, err := statusCache.Get(columns.Request{
+		Column: "jenkins",
+		URL:    link + "lastBuild/api/json?tree=number,result,building",
+		TTL:    c.TTL,
+	})
+	if err != nil {
+		return jenkinsBuild{}, err
+	}
+	var b jenkinsBuild
+	if err := json.Unmarshal(body, &b); err != nil {
+		return jenkinsBuild{}, err
+	}
+	if b.Number == 0 {
+		return jenkinsBuild{}, fmt.Errorf("no build of %s", c.Job)
+	}
+	return b, nil
+}
@@ -0,0 +1,79 @@
+package jenkins
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gengo/goship/plugins/columns"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// withCache replaces statusCache with a new cache with "rt" while the test runs.
+func withCache(rt http.RoundTripper) (restore func()) {
+	orig := statusCache
+	statusCache = columns.NewCache(&http.Client{Transport: rt})
+	return func() { statusCache = orig }
+}
+
+func TestRenderDetail(t *testing.T) {
+	defer withCache(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("unreachable")
+	}))()
+	c := JenkinsColumn{URL: "https://jenkins.example.com", Job: "api build"}
+	got, err := c.RenderDetail()
+	if err != nil {
+		t.Fatalf("c.RenderDetail() failed with %v", err)
+	}
+	want := template.HTML(`<td><a target="_blank" href="https://jenkins.example.com/job/api%20build/"><img src="https://jenkins.example.com/buildStatus/icon?job=api+build" onerror='this.style.display = "none"'></a></td>`)
+	if got != want {
+		t.Errorf("c.RenderDetail() = %q; want %q", got, want)
+	}
+}
+
+func TestNewColumn(t *testing.T) {
+	got, err := newColumn(map[string]string{"url": "https://jenkins.example.com/", "repo_name": "api"})
+	if err != nil {
+		t.Fatalf("newColumn(params) failed with %v", err)
+	}
+	if want := (JenkinsColumn{URL: "https://jenkins.example.com", Job: "api"}); got != want {
+		t.Errorf("newColumn(params) = %#v; want %#v", got, want)
+	}
+
+	if _, err := newColumn(map[string]string{"url": "https://jenkins.example.com/", "repo_name": "api", "ttl": "soon"}); err == nil {
+		t.Errorf("newColumn(params) succeeded with an invalid ttl; want failure")
+	}
+}
+
+func TestRenderDetailStatus(t *testing.T) {
+	defer withCache(http.DefaultTransport)()
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		fmt.Fprint(w, `{"number": 42, "result": "UNSTABLE", "building": false}`)
+	}))
+	defer s.Close()
+
+	c := JenkinsColumn{URL: s.URL, Job: "api"}
+	for i := 0; i < 3; i++ {
+		got, err := c.RenderDetail()
+		if err != nil {
+			t.Fatalf("c.RenderDetail() failed with %v", err)
+		}
+		want := template.HTML(fmt.Sprintf(`<td><a target="_blank" href="%s/job/api/42/"><span class="label label-warning">#42 unstable</span></a></td>`, s.URL))
+		if got != want {
+			t.Errorf("c.RenderDetail() = %q; want %q", got, want)
+		}
+	}
+	if want := "/job/api/lastBuild/api/json?tree=number,result,building"; len(requests) != 1 || requests[0] != want {
+		t.Errorf("requests = %q; want one to %q", requests, want)
+	}
+}
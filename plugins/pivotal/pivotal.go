@@ -18,6 +18,9 @@ func init() {
 
 type StoryColumn struct{}
 
+// Trusted lets the header keep its width, which sanitized columns cannot style.
+func (c StoryColumn) Trusted() {}
+
 func (c StoryColumn) RenderHeader() (template.HTML, error) {
 	return template.HTML(`<th style="min-width: 200px;">Stories</th>`), nil
 }
@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/proxy"
+)
+
+// LastDeploy is the latest deployment of an environment.
+type LastDeploy struct {
+	Time    time.Time
+	User    string
+	Success bool
+}
+
+// Cleanup is what the column "cleanup" suggests about an environment.
+type Cleanup struct {
+	// StaleSince is the time of the latest commit of the branch if it is older than config.Project.StaleBranchAge, or zero.
+	StaleSince time.Time
+	// PullRequest is the merged or closed pull request from the branch which the deployed revision belongs to, or nil.
+	PullRequest *PullRequest
+}
+
+// PullRequest is a pull request linked from the column "cleanup".
+type PullRequest struct {
+	Number int
+	Title  string
+	URL    string
+}
+
+// TableParams are what the built-in columns render besides the project.
+type TableParams struct {
+	// HostTags are the keys of host tags in the order which they are shown in.
+	HostTags []string
+	// MinDeployNoteLength is the shortest deploy note accepted by environments which require one.
+	MinDeployNoteLength int
+	// LastDeploy returns the latest deployment of the environment "env" of the project, or false if there is none.
+	// It is called only if the project has the column "last_deploy" or "deployer".
+	LastDeploy func(env string) (LastDeploy, bool)
+	// Cleanup returns the suggestions about the environment "env" of the project, or false if there are none or they
+	// could not be looked up. It is called only if the project has the column "cleanup".
+	Cleanup func(env string) (Cleanup, bool)
+	// Localizer renders the messages and times of the columns. They are in English in UTC if nil.
+	Localizer *i18n.Localizer
+	// HostEditor links environments without hosts to the host editor, i.e. for admins.
+	HostEditor bool
+	// CSRFToken is the CSRF token of the session of the user, which the deploy form posts. See auth.CSRFToken.
+	CSRFToken string
+}
+
+// coreCell is what the detail of a built-in column is rendered with.
+type coreCell struct {
+	Project     config.Project
+	Environment config.Environment
+	params      TableParams
+}
+
+// HostTags returns the tags of "h" in order.
+func (c coreCell) HostTags(h config.Host) []string {
+	return h.SortedTags(c.params.HostTags)
+}
+
+// HostEditor returns TableParams.HostEditor.
+func (c coreCell) HostEditor() bool {
+	return c.params.HostEditor
+}
+
+// CSRFToken returns TableParams.CSRFToken.
+func (c coreCell) CSRFToken() string {
+	return c.params.CSRFToken
+}
+
+// MinDeployNoteLength returns TableParams.MinDeployNoteLength.
+func (c coreCell) MinDeployNoteLength() int {
+	return c.params.MinDeployNoteLength
+}
+
+// T returns the message "key" formatted with "args" in the language of TableParams.Localizer.
+func (c coreCell) T(key string, args ...interface{}) string {
+	return c.localizer().T(key, args...)
+}
+
+// ShortTime returns "t" in the short format of the language of TableParams.Localizer.
+func (c coreCell) ShortTime(t time.Time) string {
+	return c.localizer().ShortTime(t)
+}
+
+func (c coreCell) localizer() *i18n.Localizer {
+	if c.params.Localizer == nil {
+		return i18n.New(i18n.English, nil)
+	}
+	return c.params.Localizer
+}
+
+// LastDeploy returns the latest deployment of the environment, or nil if there is none.
+func (c coreCell) LastDeploy() *LastDeploy {
+	if c.params.LastDeploy == nil {
+		return nil
+	}
+	d, ok := c.params.LastDeploy(c.Environment.Name)
+	if !ok {
+		return nil
+	}
+	return &d
+}
+
+// Cleanup returns the suggestions about the environment, or nil if there are none.
+func (c coreCell) Cleanup() *Cleanup {
+	if c.params.Cleanup == nil {
+		return nil
+	}
+	s, ok := c.params.Cleanup(c.Environment.Name)
+	if !ok {
+		return nil
+	}
+	return &s
+}
+
+// coreTemplate renders the headers and the details of the built-in columns, defined as "<key>-header" and "<key>".
+// The details of "commit" and "diff" are filled by the dashboard with the status of the hosts, and "risk" with the pending commits.
+var coreTemplate = template.Must(template.New("core").Funcs(template.FuncMap{
+	"join": func(s []string) string { return strings.Join(s, ", ") },
+	"url":  proxy.Path,
+}).Parse(`
+{{define "hosts-header"}}<th class="column-hosts">{{.T "column.hosts"}}</th>{{end}}
+{{define "hosts"}}<td>
+  {{range $host := .Environment.Hosts}}
+    <div>{{$host.Name}}{{range $.HostTags $host}} <span class="label label-info host-tag">{{.}}</span>{{end}}</div>
+  {{end}}
+</td>{{end}}
+
+{{define "commit-header"}}<th class="column-deployed-revision">{{.T "column.commit"}}</th>{{end}}
+{{define "commit"}}{{if .Environment.Unconfigured}}<td class="hosts unconfigured">
+  <span class="text-muted">{{.T "column.unconfigured"}}</span>{{if .HostEditor}} <a href="#" class="edit-hosts">{{.T "column.edit_hosts"}}</a>{{end}}
+</td>{{else}}<td class="hosts">
+  {{.T "column.loading"}}
+</td>{{end}}{{end}}
+
+{{define "diff-header"}}<th class="column-diff">{{.T "column.diff"}}</th>{{end}}
+{{define "diff"}}<td class="diffs"></td>{{end}}
+
+{{define "deploy-header"}}<th class="column-deploy"></th>{{end}}
+{{define "deploy"}}{{$environment := .Environment}}{{$project := .Project}}{{$cell := .}}<td>
+  <form class="form-deploy" method="POST" action="{{url "/deploy"}}" target="_blank" style="margin-bottom: 0">
+    <input type="hidden" name="csrf_token" value="{{.CSRFToken}}"/>
+    <input type="hidden" name="environment" value="{{$environment.Name}}"/>
+    <input type="hidden" name="project" value="{{$project.Name}}"/>
+    <input type="hidden" name="repo_owner" value="{{$project.RepoOwner}}"/>
+    <input type="hidden" name="repo_name" value="{{$project.RepoName}}"/>
+    <input type="hidden" name="from_revision" value=""/>
+    <input type="hidden" name="to_revision" value=""/>
+    <input type="hidden" name="user" value="PlaceholderUser"/>
+    <input type="hidden" name="timestamp" value=""/>
+    {{if $environment.DependsOn}}
+    <label title="{{.T "column.deploy.dependencies_title" (join $environment.DependsOn)}}"><input type="checkbox" name="with_dependencies" value="true"/> {{.T "column.deploy.with_dependencies"}}</label>
+    {{end}}
+    <select name="branch" class="branch" title="{{.T "column.deploy.branch_title"}}">
+      <option value="">{{$environment.Branch}}</option>
+    </select>
+    <label title="{{.T "column.deploy.persist_title"}}"><input type="checkbox" name="persist" value="true"/> {{.T "column.deploy.persist"}}</label>
+    {{if $environment.AllowedFlags}}
+    <textarea name="flags" class="form-control input-sm" rows="2" placeholder="{{.T "column.deploy.flags_placeholder"}}" title="{{.T "column.deploy.flags_title" (join $environment.AllowedFlags)}}"></textarea>
+    {{end}}
+    <input type="text" name="note" class="form-control input-sm" {{if $environment.RequireDeployNote}}required minlength="{{.MinDeployNoteLength}}" placeholder="{{.T "column.deploy.note_required"}}"{{else}}placeholder="{{.T "column.deploy.note"}}"{{end}}/>
+    {{with $environment.ConfirmPhrase}}
+    <input type="text" name="confirm" class="form-control input-sm confirm-phrase" required autocomplete="off" placeholder="{{$cell.T "column.deploy.confirm_placeholder" .}}" title="{{$cell.T "column.deploy.confirm_title" $environment.Name}}"/>
+    {{end}}
+    <input type="submit" class="btn btn-success" value="{{.T "column.deploy.submit"}}"{{if $environment.Unconfigured}} disabled title="{{.T "column.deploy.unconfigured_title" $environment.Name}}"{{end}} />
+  </form>
+  <small class="tip-status text-muted"></small>
+  <small class="oldest-undeployed hidden"></small>
+  <span class="label label-default diff-unavailable hidden">{{.T "column.deploy.diff_unavailable"}}</span>
+  <a href="#" class="refresh-tip" title="{{.T "column.deploy.refresh_title" $environment.Branch}}"><span class="glyphicon glyphicon-refresh"></span></a>
+</td>{{end}}
+
+{{define "comment-header"}}<th class="column-comment">  </th>{{end}}
+{{define "comment"}}<td class="comment">
+  <span title="" class="hidden glyphicon glyphicon-comment"></span>
+</td>{{end}}
+
+{{define "branch-header"}}<th class="column-branch">{{.T "column.branch"}}</th>{{end}}
+{{define "branch"}}<td class="env-branch">{{.Environment.Branch}}</td>{{end}}
+
+{{define "last_deploy-header"}}<th class="column-last-deploy">{{.T "column.last_deploy"}}</th>{{end}}
+{{define "last_deploy"}}{{$cell := .}}<td class="last-deploy">{{with .LastDeploy}}<time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{$cell.ShortTime .Time}}</time>{{if not .Success}} <span class="label label-danger">{{$cell.T "column.last_deploy.failed"}}</span>{{end}}{{end}}</td>{{end}}
+
+{{define "deployer-header"}}<th class="column-deployer">{{.T "column.deployer"}}</th>{{end}}
+{{define "deployer"}}<td class="deployer">{{with .LastDeploy}}{{.User}}{{end}}</td>{{end}}
+
+{{define "cleanup-header"}}<th class="column-cleanup">{{.T "column.cleanup"}}</th>{{end}}
+{{define "cleanup"}}{{$cell := .}}<td class="cleanup">{{with .Cleanup}}
+  {{- if not .StaleSince.IsZero}}<span class="label label-warning stale-branch" title="{{$cell.T "column.cleanup.stale_title" ($cell.ShortTime .StaleSince)}}">{{$cell.T "column.cleanup.stale"}}</span>{{end}}
+  {{- with .PullRequest}} <a class="closed-pull-request" href="{{.URL}}" target="_blank" title="{{.Title}}">{{$cell.T "column.cleanup.pull_request" .Number}}</a>{{end}}
+{{- end}}</td>{{end}}
+
+{{define "risk-header"}}<th class="column-risk">{{.T "column.risk"}}</th>{{end}}
+{{define "risk"}}<td class="risk"></td>{{end}}
+`))
+
+// coreColumn is a built-in column of the dashboard, e.g. the hosts or the deploy form of environments.
+type coreColumn struct {
+	key    string
+	p      config.Project
+	params TableParams
+}
+
+func (c coreColumn) RenderHeader() (template.HTML, error) {
+	return c.render(c.key+"-header", coreCell{Project: c.p, params: c.params})
+}
+
+// Trusted marks built-in columns as trusted, since they render forms and scripts hook into them.
+func (c coreColumn) Trusted() {}
+
+// RenderDetail renders an empty cell since built-in columns are specific to environments.
+func (c coreColumn) RenderDetail() (template.HTML, error) {
+	return template.HTML("<td></td>"), nil
+}
+
+func (c coreColumn) RenderEnvironmentDetail(env string) (template.HTML, error) {
+	for _, e := range c.p.Environments {
+		if e.Name == env {
+			return c.render(c.key, coreCell{Project: c.p, Environment: e, params: c.params})
+		}
+	}
+	return template.HTML("<td></td>"), nil
+}
+
+func (c coreColumn) render(name string, data interface{}) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := coreTemplate.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// TableFor returns all the columns of the table of "p" following the environment column, in the order of p.ColumnKeys().
+// The plugin columns of "p" come at "plugins".
+func TableFor(p config.Project, params TableParams) (*Columns, error) {
+	cols := new(Columns)
+	for _, key := range p.ColumnKeys() {
+		if key == config.ColumnPlugins {
+			pcs, err := ColumnsFor(p)
+			if err != nil {
+				return nil, err
+			}
+			cols.slots = append(cols.slots, pcs.slots...)
+			continue
+		}
+		if coreTemplate.Lookup(key) == nil {
+			return nil, fmt.Errorf("unknown column %q of %s", key, p.Name)
+		}
+		cols.AddPluginColumn(coreColumn{key: key, p: p, params: params})
+	}
+	return cols, nil
+}
@@ -0,0 +1,159 @@
+package plugin_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/plugins/plugin"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// renderTable renders the headers and the rows of "cols" for the environments of "p", one cell per line.
+func renderTable(t *testing.T, p config.Project, cols *plugin.Columns) string {
+	var lines []string
+	for _, c := range cols.Headers() {
+		h, err := c.RenderHeader()
+		if err != nil {
+			t.Fatalf("RenderHeader() failed with %v", err)
+		}
+		lines = append(lines, string(h))
+	}
+	for _, e := range p.Environments {
+		lines = append(lines, "<!-- "+e.Name+" -->")
+		for _, c := range cols.Row(e.Name) {
+			d, err := plugin.RenderDetail(c, e.Name)
+			if err != nil {
+				t.Fatalf("RenderDetail(%v, %q) failed with %v", c, e.Name, err)
+			}
+			lines = append(lines, string(d))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// pluginColumn is a plugin which adds the column "travis" to all the projects.
+type pluginColumn struct{}
+
+func (pluginColumn) Apply(p config.Project) ([]plugin.Column, error) {
+	return []plugin.Column{fakeColumn("travis")}, nil
+}
+
+func TestTableFor(t *testing.T) {
+	orig := plugin.Plugins
+	defer func() { plugin.Plugins = orig }()
+	plugin.Plugins = []plugin.Plugin{pluginColumn{}}
+
+	deployed := time.Date(2016, 3, 1, 9, 30, 0, 0, time.UTC)
+	params := plugin.TableParams{
+		HostTags:            []string{"role", "zone"},
+		MinDeployNoteLength: 10,
+		LastDeploy: func(env string) (plugin.LastDeploy, bool) {
+			switch env {
+			case "production":
+				return plugin.LastDeploy{Time: deployed, User: "alice", Success: true}, true
+			case "staging":
+				return plugin.LastDeploy{Time: deployed.Add(time.Hour), User: "bob"}, true
+			}
+			return plugin.LastDeploy{}, false
+		},
+		Cleanup: func(env string) (plugin.Cleanup, bool) {
+			pr := &plugin.PullRequest{Number: 42, Title: "Add <login>", URL: "https://github.com/gengo/api/pull/42"}
+			switch env {
+			case "production":
+				return plugin.Cleanup{StaleSince: deployed.Add(-40 * 24 * time.Hour)}, true
+			case "staging":
+				return plugin.Cleanup{StaleSince: deployed.Add(-40 * 24 * time.Hour), PullRequest: pr}, true
+			}
+			// e.g. failed to look up
+			return plugin.Cleanup{}, false
+		},
+	}
+	envs := []config.Environment{
+		{
+			Name:   "production",
+			Branch: "master",
+			Hosts: []config.Host{
+				{Name: "api-1.example.com", Tags: map[string]string{"zone": "a", "role": "web"}},
+				{Name: "api-2.example.com"},
+			},
+			RequireDeployNote: true,
+			ConfirmPhrase:     "production",
+		},
+		{
+			Name:         "staging",
+			Branch:       "develop",
+			Hosts:        []config.Host{{Name: "api-staging.example.com"}},
+			DependsOn:    []string{"db"},
+			AllowedFlags: []string{"migrate"},
+		},
+		// no hosts yet
+		{Name: "qa", Branch: "qa"},
+	}
+	for _, spec := range []struct {
+		golden     string
+		columns    []string
+		localizer  *i18n.Localizer
+		hostEditor bool
+	}{
+		{golden: "default.golden", hostEditor: true},
+		{
+			golden:  "custom.golden",
+			columns: []string{"branch", "commit", "diff", "last_deploy", "deployer", "plugins", "deploy"},
+		},
+		{
+			golden:  "readonly.golden",
+			columns: []string{"hosts", "commit"},
+		},
+		{
+			golden:  "cleanup.golden",
+			columns: []string{"branch", "cleanup", "risk"},
+		},
+		{
+			golden:    "custom_ja.golden",
+			columns:   []string{"branch", "commit", "diff", "last_deploy", "deployer", "plugins", "deploy"},
+			localizer: i18n.New(i18n.Japanese, time.FixedZone("JST", 9*60*60)),
+		},
+	} {
+		p := config.Project{
+			Name:         "api",
+			Repo:         config.Repo{RepoOwner: "gengo", RepoName: "api"},
+			Environments: envs,
+			Columns:      spec.columns,
+		}
+		params.Localizer, params.HostEditor = spec.localizer, spec.hostEditor
+		cols, err := plugin.TableFor(p, params)
+		if err != nil {
+			t.Errorf("plugin.TableFor(%v, params) failed with %v", spec.columns, err)
+			continue
+		}
+		got := renderTable(t, p, cols)
+		path := filepath.Join("testdata", spec.golden)
+		if *update {
+			if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile(%q) failed with %v", path, err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile(%q) failed with %v", path, err)
+		}
+		if got != string(want) {
+			t.Errorf("table with columns %v = \n%s\nwant\n%s", spec.columns, got, want)
+		}
+	}
+}
+
+func TestTableForUnknownColumn(t *testing.T) {
+	p := config.Project{Name: "api", Columns: []string{"hosts", "owner"}}
+	if _, err := plugin.TableFor(p, plugin.TableParams{}); err == nil {
+		t.Errorf("plugin.TableFor(%v, params) succeeded; want an error", p.Columns)
+	}
+}
@@ -2,8 +2,11 @@ package plugin
 
 import (
 	"html/template"
+	"strings"
 
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/sanitize"
+	"github.com/golang/glog"
 )
 
 var Plugins []Plugin
@@ -21,10 +24,170 @@ func RegisterPlugin(p Plugin) {
 }
 
 // Column is an interface that demands a RenderHeader and RenderDetails method to be able to generate a table column (with header and body)
-// See templates/index.html to see how the Header and Render methods are used
+// See templates/index.html to see how the Header and Render methods are used.
+// Their HTML is sanitized by RenderHeader and RenderDetail of this package unless the column is a TrustedColumn.
 type Column interface {
 	// RenderHeader() returns a HTML template that should render a <th> element
 	RenderHeader() (template.HTML, error)
 	// RenderDetail() returns a HTML template that should render a <td> element
 	RenderDetail() (template.HTML, error)
 }
+
+// EnvironmentColumn is an optional interface of Column.
+// Columns which implement it render a detail specific to each environment of the project.
+type EnvironmentColumn interface {
+	Column
+	// RenderEnvironmentDetail() returns a HTML template that should render a <td> element for the environment "env"
+	RenderEnvironmentDetail(env string) (template.HTML, error)
+}
+
+// TrustedColumn is an optional interface of Column.
+// The HTML of columns which implement it is rendered as it is, while the HTML of the others is sanitized
+// against an allowlist of tags and attributes. Only built-in columns which need richer markup, e.g. forms, should implement it.
+type TrustedColumn interface {
+	Column
+	// Trusted does nothing but marks the column.
+	Trusted()
+}
+
+// RenderHeader renders the header of "c", which is sanitized unless "c" is a TrustedColumn.
+func RenderHeader(c Column) (template.HTML, error) {
+	h, err := c.RenderHeader()
+	if err != nil {
+		return "", err
+	}
+	return sanitizeColumn(c, "header", h), nil
+}
+
+// RenderDetail renders the detail of "c" in the row of the environment "env", which is sanitized unless "c" is a TrustedColumn.
+// It renders an empty cell if "c" is nil.
+func RenderDetail(c Column, env string) (template.HTML, error) {
+	if c == nil {
+		return template.HTML("<td></td>"), nil
+	}
+	var (
+		h   template.HTML
+		err error
+	)
+	if ec, ok := c.(EnvironmentColumn); ok {
+		h, err = ec.RenderEnvironmentDetail(env)
+	} else {
+		h, err = c.RenderDetail()
+	}
+	if err != nil {
+		return "", err
+	}
+	return sanitizeColumn(c, "detail of "+env, h), nil
+}
+
+// sanitizeColumn returns the sanitized "h" which "c" rendered as "part" unless "c" is trusted.
+// What is removed is logged, since it is a bug or an attack of the column.
+func sanitizeColumn(c Column, part string, h template.HTML) template.HTML {
+	if _, ok := c.(TrustedColumn); ok {
+		return h
+	}
+	safe, removed := sanitize.Cell(string(h))
+	if len(removed) > 0 {
+		glog.Warningf("Removed %s from the %s of column %T", strings.Join(removed, ", "), part, c)
+	}
+	return safe
+}
+
+// EnvironmentPlugin is an optional interface of Plugin.
+// Plugins which implement it add columns which differ among environments of the project, instead of Apply.
+type EnvironmentPlugin interface {
+	Plugin
+	// AddColumns adds the columns for "p" to "cols".
+	AddColumns(p config.Project, cols *Columns) error
+}
+
+// Columns are the plugin columns of the table of a project, whose rows are its environments.
+// Each slot is a column in the table, which renders the column of each environment or an empty cell.
+type Columns struct {
+	slots []*Slot
+}
+
+// Slot is a column in the table of a project.
+type Slot struct {
+	// header renders the header of the slot.
+	header Column
+	// all is rendered in the environments without their own columns. It is nil if the slot is only of some environments.
+	all Column
+	// envs are the columns of environments which override "all". nil values disable the slot in the environments.
+	envs map[string]Column
+}
+
+// AddPluginColumn adds "c" as a column of all the environments, and returns its slot.
+func (cs *Columns) AddPluginColumn(c Column) *Slot {
+	s := &Slot{header: c, all: c, envs: make(map[string]Column)}
+	cs.slots = append(cs.slots, s)
+	return s
+}
+
+// AddEnvironmentColumn adds "c" as a column of the environment "envName" only, and returns its slot.
+// The slot is empty in the other environments unless they are given their columns with Override.
+func (cs *Columns) AddEnvironmentColumn(envName string, c Column) *Slot {
+	s := &Slot{header: c, envs: map[string]Column{envName: c}}
+	cs.slots = append(cs.slots, s)
+	return s
+}
+
+// Override renders "c" in the environment "envName" instead of the column of all the environments.
+func (s *Slot) Override(envName string, c Column) {
+	s.envs[envName] = c
+}
+
+// Disable renders an empty cell in the environment "envName".
+func (s *Slot) Disable(envName string) {
+	s.envs[envName] = nil
+}
+
+// Headers returns the columns which render the headers of the slots in order.
+func (cs *Columns) Headers() []Column {
+	if cs == nil {
+		return nil
+	}
+	var headers []Column
+	for _, s := range cs.slots {
+		headers = append(headers, s.header)
+	}
+	return headers
+}
+
+// Row returns the columns of the environment "envName" in the order of Headers.
+// Slots empty in the environment are nil, which RenderDetail renders as empty cells.
+func (cs *Columns) Row(envName string) []Column {
+	if cs == nil {
+		return nil
+	}
+	row := make([]Column, 0, len(cs.slots))
+	for _, s := range cs.slots {
+		c, ok := s.envs[envName]
+		if !ok {
+			c = s.all
+		}
+		row = append(row, c)
+	}
+	return row
+}
+
+// ColumnsFor returns the columns of all the registered plugins for "p".
+func ColumnsFor(p config.Project) (*Columns, error) {
+	cols := new(Columns)
+	for _, pl := range Plugins {
+		if ep, ok := pl.(EnvironmentPlugin); ok {
+			if err := ep.AddColumns(p, cols); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		cs, err := pl.Apply(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			cols.AddPluginColumn(c)
+		}
+	}
+	return cols, nil
+}
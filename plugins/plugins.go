@@ -3,4 +3,14 @@ package plugins
 // Import plugin packages here
 
 // import _ "github.com/gengo/goship/plugins/helloworld"
-// import _ "github.com/gengo/goship/plugins/travis"
+
+// remote is enabled by default because it is configured per project without compiling plugins.
+import _ "github.com/gengo/goship/plugins/remote"
+
+// built-in columns which projects configure by name in "plugin_columns".
+import (
+	_ "github.com/gengo/goship/plugins/columns"
+	_ "github.com/gengo/goship/plugins/jenkins"
+	_ "github.com/gengo/goship/plugins/travis"
+	_ "github.com/gengo/goship/plugins/version"
+)
@@ -0,0 +1,189 @@
+// Remote adds columns rendered by external HTTP endpoints to Goship.
+// This lets teams add columns without compiling plugins into the binary.
+//
+// Add the URLs of the endpoints to "remote_columns" in the project config,
+// or {type: remote, params: {url: ...}} to "plugin_columns".
+// Goship calls "GET url?project=X&environment=Y" (environment is omitted for the header)
+// and expects a JSON response like
+//
+//	{ "header_html": "CI", "detail_html": "<span class=\"label label-success\">passed</span>" }
+//
+// The HTML is sanitized before rendered, and the response is cached per its Cache-Control header.
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/sanitize"
+	"github.com/gengo/goship/plugins/columns"
+	"github.com/gengo/goship/plugins/plugin"
+	"github.com/golang/glog"
+)
+
+const (
+	// defaultTimeout is the timeout of requests to the remote endpoints.
+	defaultTimeout = 2 * time.Second
+
+	neutralHeader = template.HTML("<th></th>")
+	neutralDetail = template.HTML("<td></td>")
+)
+
+type RemotePlugin struct{}
+
+func init() {
+	var p RemotePlugin
+	plugin.RegisterPlugin(p)
+	columns.Register("remote", newColumn)
+}
+
+// newColumn instantiates a RemoteColumn from "url" and "project" in "params".
+// It is an alternative to "remote_columns" in the project config.
+func newColumn(params map[string]string) (plugin.Column, error) {
+	u, err := url.Parse(params["url"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", params["url"], err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url %q is not an absolute http(s) URL", params["url"])
+	}
+	return RemoteColumn{URL: params["url"], Project: params["project"], fetcher: defaultFetcher}, nil
+}
+
+var defaultFetcher = newFetcher(&http.Client{Timeout: defaultTimeout})
+
+func (p RemotePlugin) Apply(proj config.Project) ([]plugin.Column, error) {
+	var cols []plugin.Column
+	for _, u := range proj.RemoteColumns {
+		cols = append(cols, RemoteColumn{URL: u, Project: proj.Name, fetcher: defaultFetcher})
+	}
+	return cols, nil
+}
+
+// RemoteColumn is a column rendered by an external HTTP endpoint.
+type RemoteColumn struct {
+	URL     string
+	Project string
+
+	fetcher *fetcher
+}
+
+// payload is the expected response of the remote endpoints.
+type payload struct {
+	HeaderHTML string `json:"header_html"`
+	DetailHTML string `json:"detail_html"`
+}
+
+func (c RemoteColumn) RenderHeader() (template.HTML, error) {
+	p, err := c.fetcher.fetch(c.requestURL(""))
+	if err != nil {
+		glog.Errorf("Failed to fetch remote column header from %s: %v", c.URL, err)
+		return neutralHeader, nil
+	}
+	return template.HTML("<th>") + sanitize.HTML(p.HeaderHTML) + template.HTML("</th>"), nil
+}
+
+func (c RemoteColumn) RenderDetail() (template.HTML, error) {
+	return c.RenderEnvironmentDetail("")
+}
+
+func (c RemoteColumn) RenderEnvironmentDetail(env string) (template.HTML, error) {
+	p, err := c.fetcher.fetch(c.requestURL(env))
+	if err != nil {
+		glog.Errorf("Failed to fetch remote column detail from %s: %v", c.URL, err)
+		return neutralDetail, nil
+	}
+	return template.HTML("<td>") + sanitize.HTML(p.DetailHTML) + template.HTML("</td>"), nil
+}
+
+func (c RemoteColumn) requestURL(env string) string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.URL
+	}
+	q := u.Query()
+	q.Set("project", c.Project)
+	if env != "" {
+		q.Set("environment", env)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type cacheEntry struct {
+	payload payload
+	expires time.Time
+}
+
+// fetcher fetches payloads from remote endpoints and caches them.
+type fetcher struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+func newFetcher(client *http.Client) *fetcher {
+	return &fetcher{
+		client: client,
+		now:    time.Now,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+func (f *fetcher) fetch(u string) (payload, error) {
+	f.mu.Lock()
+	e, ok := f.cache[u]
+	f.mu.Unlock()
+	if ok && f.now().Before(e.expires) {
+		return e.payload, nil
+	}
+
+	resp, err := f.client.Get(u)
+	if err != nil {
+		return payload{}, err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code < http.StatusOK || http.StatusMultipleChoices <= code {
+		return payload{}, fmt.Errorf("Unexpected HTTP status %d from %s", code, u)
+	}
+	var p payload
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return payload{}, err
+	}
+
+	if ttl := maxAge(resp.Header.Get("Cache-Control")); ttl > 0 {
+		f.mu.Lock()
+		f.cache[u] = cacheEntry{payload: p, expires: f.now().Add(ttl)}
+		f.mu.Unlock()
+	}
+	return p, nil
+}
+
+// maxAge returns how long a response with the Cache-Control header "cc" can be cached.
+func maxAge(cc string) time.Duration {
+	var age time.Duration
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store" || d == "no-cache":
+			return 0
+		case strings.HasPrefix(d, "max-age="):
+			n, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+			if err != nil || n < 0 {
+				return 0
+			}
+			age = time.Duration(n) * time.Second
+		}
+	}
+	return age
+}
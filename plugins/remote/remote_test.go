@@ -0,0 +1,136 @@
+package remote
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func withStubServer(t *testing.T, cacheControl string, delay time.Duration, f func(url string, hits *int32)) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(delay)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		env := r.FormValue("environment")
+		fmt.Fprintf(w, `{"header_html": "CI <script>alert(1)</script>", "detail_html": "<b onclick=\"alert(1)\">%s-%s</b>"}`, r.FormValue("project"), env)
+	}))
+	defer s.Close()
+	f(s.URL, &hits)
+}
+
+func TestApply(t *testing.T) {
+	p := RemotePlugin{}
+	proj := config.Project{
+		Name:          "test_project",
+		RemoteColumns: []string{"http://ci.example/a", "http://ci.example/b"},
+	}
+	cols, err := p.Apply(proj)
+	if err != nil {
+		t.Fatalf("p.Apply(%#v) failed with %v; want success", proj, err)
+	}
+	if got, want := len(cols), 2; got != want {
+		t.Fatalf("len(cols) = %d; want %d", got, want)
+	}
+	for i, c := range cols {
+		rc, ok := c.(RemoteColumn)
+		if !ok {
+			t.Errorf("cols[%d] = %#v; want a RemoteColumn", i, c)
+			continue
+		}
+		if got, want := rc.URL, proj.RemoteColumns[i]; got != want {
+			t.Errorf("cols[%d].URL = %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestRenderSanitized(t *testing.T) {
+	withStubServer(t, "", 0, func(url string, hits *int32) {
+		c := RemoteColumn{URL: url, Project: "proj", fetcher: newFetcher(http.DefaultClient)}
+		got, err := c.RenderHeader()
+		if err != nil {
+			t.Errorf("c.RenderHeader() failed with %v; want success", err)
+		}
+		if want := template.HTML("<th>CI </th>"); got != want {
+			t.Errorf("c.RenderHeader() = %q; want %q", got, want)
+		}
+		got, err = c.RenderEnvironmentDetail("staging")
+		if err != nil {
+			t.Errorf("c.RenderEnvironmentDetail(%q) failed with %v; want success", "staging", err)
+		}
+		if want := template.HTML("<td><b>proj-staging</b></td>"); got != want {
+			t.Errorf("c.RenderEnvironmentDetail(%q) = %q; want %q", "staging", got, want)
+		}
+	})
+}
+
+func TestRenderCached(t *testing.T) {
+	for _, spec := range []struct {
+		cacheControl string
+		wantHits     int32
+	}{
+		{cacheControl: "max-age=60", wantHits: 1},
+		{cacheControl: "public, max-age=60", wantHits: 1},
+		{cacheControl: "no-store", wantHits: 3},
+		{cacheControl: "", wantHits: 3},
+	} {
+		withStubServer(t, spec.cacheControl, 0, func(url string, hits *int32) {
+			c := RemoteColumn{URL: url, Project: "proj", fetcher: newFetcher(http.DefaultClient)}
+			for i := 0; i < 3; i++ {
+				c.RenderEnvironmentDetail("staging")
+			}
+			if got, want := atomic.LoadInt32(hits), spec.wantHits; got != want {
+				t.Errorf("hits = %d with Cache-Control %q; want %d", got, spec.cacheControl, want)
+			}
+		})
+	}
+}
+
+func TestRenderCacheExpiry(t *testing.T) {
+	withStubServer(t, "max-age=60", 0, func(url string, hits *int32) {
+		now := time.Unix(0, 0)
+		f := newFetcher(http.DefaultClient)
+		f.now = func() time.Time { return now }
+		c := RemoteColumn{URL: url, Project: "proj", fetcher: f}
+
+		c.RenderEnvironmentDetail("staging")
+		now = now.Add(59 * time.Second)
+		c.RenderEnvironmentDetail("staging")
+		if got, want := atomic.LoadInt32(hits), int32(1); got != want {
+			t.Errorf("hits = %d before expiry; want %d", got, want)
+		}
+		now = now.Add(2 * time.Second)
+		c.RenderEnvironmentDetail("staging")
+		if got, want := atomic.LoadInt32(hits), int32(2); got != want {
+			t.Errorf("hits = %d after expiry; want %d", got, want)
+		}
+	})
+}
+
+func TestRenderTimeout(t *testing.T) {
+	withStubServer(t, "", 100*time.Millisecond, func(url string, hits *int32) {
+		c := RemoteColumn{URL: url, Project: "proj", fetcher: newFetcher(&http.Client{Timeout: 10 * time.Millisecond})}
+		got, err := c.RenderHeader()
+		if err != nil {
+			t.Errorf("c.RenderHeader() failed with %v; want a neutral cell", err)
+		}
+		if want := neutralHeader; got != want {
+			t.Errorf("c.RenderHeader() = %q; want %q", got, want)
+		}
+		got, err = c.RenderEnvironmentDetail("staging")
+		if err != nil {
+			t.Errorf("c.RenderEnvironmentDetail(%q) failed with %v; want a neutral cell", "staging", err)
+		}
+		if want := neutralDetail; got != want {
+			t.Errorf("c.RenderEnvironmentDetail(%q) = %q; want %q", "staging", got, want)
+		}
+	})
+}
@@ -1,37 +1,152 @@
 // Travis adds Travis build banners to Goship.
+// Add {type: travis} to "plugin_columns" of the project config.
 // For public repos, it should be automatic.
 // For private repos, add your travis token to the project in ETCD
 // etcdctl set /projects/{project_name}/travis_token {travis_token}
+//
+// The state of the last build of master is fetched from the Travis API through columns.DefaultCache,
+// which keeps it for the optional "ttl" param, e.g. {type: travis, params: {ttl: 5m}}.
+// The badge image is shown instead if the API is not available, e.g. the token is only for badges.
+//
+// To show the banners in all the projects instead, register TravisPlugin with plugin.RegisterPlugin.
 package travis
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"net/http"
+	"time"
 
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/plugins/columns"
 	"github.com/gengo/goship/plugins/plugin"
+	"github.com/golang/glog"
 )
 
 type TravisPlugin struct{}
 
 func init() {
-	var p TravisPlugin
-	plugin.RegisterPlugin(p)
+	columns.Register("travis", newColumn)
+}
+
+// newColumn instantiates a TravisColumn from "repo_owner", "repo_name" and optional "travis_token" and "ttl" in "params".
+func newColumn(params map[string]string) (plugin.Column, error) {
+	ttl, err := columns.ParseTTL(params)
+	if err != nil {
+		return nil, err
+	}
+	c := TravisColumn{
+		Project:      params["repo_name"],
+		Token:        params["travis_token"],
+		Organization: params["repo_owner"],
+		TTL:          ttl,
+	}
+	if c.Project == "" || c.Organization == "" {
+		return nil, fmt.Errorf("repo_owner and repo_name are required")
+	}
+	return c, nil
 }
 
 var rootUrls = []string{"https://travis-ci.org", "https://magnum.travis-ci.com"}
 
+var (
+	// apiRoots are the roots of the Travis API for public and private repos, in the order of rootUrls.
+	apiRoots = []string{"https://api.travis-ci.org", "https://api.travis-ci.com"}
+	// statusCache caches the responses of the Travis API.
+	statusCache = columns.DefaultCache
+)
+
+// stateClasses are the classes of labels by the states of Travis builds.
+var stateClasses = map[string]string{
+	"passed":   "label-success",
+	"failed":   "label-danger",
+	"errored":  "label-danger",
+	"created":  "label-info",
+	"received": "label-info",
+	"queued":   "label-info",
+	"started":  "label-info",
+}
+
 type TravisColumn struct {
 	Project      string
 	Token        string
 	Organization string
+	// TTL is how long the build status is cached. Zero means columns.DefaultTTL.
+	TTL time.Duration
 }
 
+// Trusted marks the column as built-in, which hides broken badges with an inline handler.
+// Its URLs are built from the repository in the project config.
+func (c TravisColumn) Trusted() {}
+
 func (c TravisColumn) RenderHeader() (template.HTML, error) {
 	return template.HTML(`<th style="min-width: 100px">Build Status</th>`), nil
 }
 
 func (c TravisColumn) RenderDetail() (template.HTML, error) {
+	b, err := c.lastBuild()
+	if err == nil {
+		return c.renderStatus(b), nil
+	}
+	glog.Warningf("Failed to get the build status of %s/%s from Travis: %v", c.Organization, c.Project, err)
+	return c.renderBadge(), nil
+}
+
+// travisBuild is the last build of a branch in the Travis API v2.
+type travisBuild struct {
+	ID     int64  `json:"id"`
+	Number string `json:"number"`
+	State  string `json:"state"`
+}
+
+// lastBuild returns the last build of master.
+func (c TravisColumn) lastBuild() (travisBuild, error) {
+	root, header := apiRoots[0], make(http.Header)
+	header.Set("Accept", "application/vnd.travis-ci.2+json")
+	if c.Token != "" {
+		root = apiRoots[1]
+		header.Set("Authorization", fmt.Sprintf("token %q", c.Token))
+	}
+	body, err := statusCache.Get(columns.Request{
+		Column: "travis",
+		URL:    fmt.Sprintf("%s/repos/%s/%s/branches/master", root, c.Organization, c.Project),
+		Header: header,
+		TTL:    c.TTL,
+	})
+	if err != nil {
+		return travisBuild{}, err
+	}
+	var resp struct {
+		Branch *travisBuild `json:"branch"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return travisBuild{}, err
+	}
+	if resp.Branch == nil || resp.Branch.State == "" {
+		return travisBuild{}, fmt.Errorf("no build of master")
+	}
+	return *resp.Branch, nil
+}
+
+// renderStatus renders the state of "b" linked to the build.
+func (c TravisColumn) renderStatus(b travisBuild) template.HTML {
+	root := rootUrls[0]
+	if c.Token != "" {
+		root = rootUrls[1]
+	}
+	class, ok := stateClasses[b.State]
+	if !ok {
+		class = "label-default"
+	}
+	link := fmt.Sprintf("%s/%s/%s/builds/%d", root, c.Organization, c.Project, b.ID)
+	text := fmt.Sprintf("#%s %s", b.Number, b.State)
+	return template.HTML(fmt.Sprintf(`<td><a target="_blank" href="%s"><span class="label %s">%s</span></a></td>`,
+		template.HTMLEscapeString(link), class, template.HTMLEscapeString(text)))
+}
+
+// renderBadge renders the badge image of master, which the browser loads from Travis.
+func (c TravisColumn) renderBadge() template.HTML {
 	var url, svg string
 	if c.Token == "" {
 		url = fmt.Sprintf("%s/%s/%s", rootUrls[0], c.Organization, c.Project)
@@ -40,7 +155,7 @@ func (c TravisColumn) RenderDetail() (template.HTML, error) {
 		url = fmt.Sprintf("%s/%s/%s", rootUrls[1], c.Organization, c.Project)
 		svg = fmt.Sprintf("%s/%s/%s.svg?token=%s&branch=master", rootUrls[1], c.Organization, c.Project, c.Token)
 	}
-	return template.HTML(fmt.Sprintf(`<td><a target=_blank href=%s><img src=%s onerror='this.style.display = "none"'></img></a></td>`, url, svg)), nil
+	return template.HTML(fmt.Sprintf(`<td><a target=_blank href=%s><img src=%s onerror='this.style.display = "none"'></img></a></td>`, url, svg))
 }
 
 func (p TravisPlugin) Apply(proj config.Project) ([]plugin.Column, error) {
@@ -2,15 +2,30 @@ package travis
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/plugins/columns"
 	"github.com/gengo/goship/plugins/plugin"
 )
 
+// fakeAPI serves the Travis API with "h" and an empty cache while the test runs.
+func fakeAPI(h http.Handler) (restore func()) {
+	s := httptest.NewServer(h)
+	roots, cache := apiRoots, statusCache
+	apiRoots, statusCache = []string{s.URL + "/org", s.URL + "/com"}, columns.NewCache(http.DefaultClient)
+	return func() {
+		s.Close()
+		apiRoots, statusCache = roots, cache
+	}
+}
+
 type tokenMockClient struct {
 	Token string
 }
@@ -52,6 +67,7 @@ func TestRenderHeader(t *testing.T) {
 }
 
 func TestRenderDetailPublic(t *testing.T) {
+	defer fakeAPI(http.NotFoundHandler())()
 	c := TravisColumn{
 		Project:      "test_public",
 		Token:        "",
@@ -68,6 +84,7 @@ func TestRenderDetailPublic(t *testing.T) {
 }
 
 func TestRenderDetailPrivate(t *testing.T) {
+	defer fakeAPI(http.NotFoundHandler())()
 	c := TravisColumn{
 		Project:      "test_private",
 		Token:        "test_token",
@@ -83,6 +100,29 @@ func TestRenderDetailPrivate(t *testing.T) {
 	}
 }
 
+func TestRenderDetailStatus(t *testing.T) {
+	var requests []string
+	defer fakeAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s", r.URL.Path, r.Header.Get("Authorization")))
+		fmt.Fprint(w, `{"branch": {"id": 1234, "number": "56", "state": "failed"}}`)
+	}))()
+
+	c := TravisColumn{Project: "test_private", Token: "test_token", Organization: "test"}
+	for i := 0; i < 3; i++ {
+		got, err := c.RenderDetail()
+		if err != nil {
+			t.Fatalf("c.RenderDetail() failed with %v", err)
+		}
+		want := template.HTML(`<td><a target="_blank" href="https://magnum.travis-ci.com/test/test_private/builds/1234"><span class="label label-danger">#56 failed</span></a></td>`)
+		if got != want {
+			t.Errorf("c.RenderDetail() = %q; want %q", got, want)
+		}
+	}
+	if want := `/com/repos/test/test_private/branches/master token "test_token"`; len(requests) != 1 || requests[0] != want {
+		t.Errorf("requests = %q; want one %q", requests, want)
+	}
+}
+
 func TestApply(t *testing.T) {
 	p := &TravisPlugin{}
 	proj := config.Project{
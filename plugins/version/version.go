@@ -0,0 +1,190 @@
+// Version adds a column of the versions which environments report at their version endpoints.
+// Add the column to "plugin_columns" of the project config:
+//
+//	{type: version, params: {url: "https://status.example.com/version", header: "Version", ttl: "1m"}}
+//
+// Goship calls "GET url?project=X&environment=Y" and shows the response, which is either plain text or
+// a JSON object like {"version": "v1.2.3"}. Responses are cached for "ttl" (default 1m).
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gengo/goship/plugins/columns"
+	"github.com/gengo/goship/plugins/plugin"
+	"github.com/golang/glog"
+)
+
+const (
+	// defaultTimeout is the timeout of requests to the version endpoints.
+	defaultTimeout = 2 * time.Second
+	defaultTTL     = time.Minute
+	// maxVersionLength is the maximum length of versions shown.
+	maxVersionLength = 64
+	// maxResponseSize is the maximum size of responses read from the endpoints.
+	maxResponseSize = 4096
+)
+
+func init() {
+	columns.Register("version", newColumn)
+}
+
+var defaultClient = &http.Client{Timeout: defaultTimeout}
+
+// VersionColumn shows the version reported by the endpoint of each environment.
+type VersionColumn struct {
+	URL     string
+	Project string
+	Header  string
+
+	cache *cache
+}
+
+func newColumn(params map[string]string) (plugin.Column, error) {
+	u, err := url.Parse(params["url"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", params["url"], err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url %q is not an absolute http(s) URL", params["url"])
+	}
+	ttl := defaultTTL
+	if s := params["ttl"]; s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid ttl %q", s)
+		}
+	}
+	header := params["header"]
+	if header == "" {
+		header = "Version"
+	}
+	return VersionColumn{
+		URL:     params["url"],
+		Project: params["project"],
+		Header:  header,
+		cache:   sharedCache(ttl),
+	}, nil
+}
+
+func (c VersionColumn) RenderHeader() (template.HTML, error) {
+	return template.HTML("<th>" + template.HTMLEscapeString(c.Header) + "</th>"), nil
+}
+
+func (c VersionColumn) RenderDetail() (template.HTML, error) {
+	return c.RenderEnvironmentDetail("")
+}
+
+func (c VersionColumn) RenderEnvironmentDetail(env string) (template.HTML, error) {
+	v, err := c.cache.get(c.requestURL(env))
+	if err != nil {
+		glog.Errorf("Failed to fetch version from %s: %v", c.URL, err)
+		return template.HTML("<td></td>"), nil
+	}
+	return template.HTML("<td><code>" + template.HTMLEscapeString(v) + "</code></td>"), nil
+}
+
+func (c VersionColumn) requestURL(env string) string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.URL
+	}
+	q := u.Query()
+	q.Set("project", c.Project)
+	if env != "" {
+		q.Set("environment", env)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// parseVersion returns the version in the response body "body".
+func parseVersion(body []byte) string {
+	var obj struct {
+		Version string `json:"version"`
+	}
+	v := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &obj); err == nil && obj.Version != "" {
+		v = obj.Version
+	}
+	if i := strings.IndexAny(v, "\r\n"); i >= 0 {
+		v = v[:i]
+	}
+	if len(v) > maxVersionLength {
+		v = v[:maxVersionLength]
+	}
+	return v
+}
+
+type cacheEntry struct {
+	version string
+	expires time.Time
+}
+
+// cache fetches versions from endpoints and caches them for ttl.
+type cache struct {
+	client *http.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+var (
+	cachesMu sync.Mutex
+	// caches are shared by columns with the same ttl since columns are instantiated per page view.
+	caches = make(map[time.Duration]*cache)
+)
+
+func sharedCache(ttl time.Duration) *cache {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	c, ok := caches[ttl]
+	if !ok {
+		c = newCache(defaultClient, ttl)
+		caches[ttl] = c
+	}
+	return c
+}
+
+func newCache(client *http.Client, ttl time.Duration) *cache {
+	return &cache{client: client, ttl: ttl, now: time.Now, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cache) get(u string) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[u]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expires) {
+		return e.version, nil
+	}
+
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if code := resp.StatusCode; code < http.StatusOK || http.StatusMultipleChoices <= code {
+		return "", fmt.Errorf("Unexpected HTTP status %d from %s", code, u)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", err
+	}
+	v := parseVersion(body)
+	if c.ttl > 0 {
+		c.mu.Lock()
+		c.entries[u] = cacheEntry{version: v, expires: c.now().Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return v, nil
+}
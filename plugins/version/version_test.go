@@ -0,0 +1,58 @@
+package version
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, spec := range []struct {
+		body string
+		want string
+	}{
+		{body: "v1.2.3\n", want: "v1.2.3"},
+		{body: "v1.2.3\nbuilt by ci", want: "v1.2.3"},
+		{body: `{"version": "abc123", "built": "2015-10-01"}`, want: "abc123"},
+		{body: `{"revision": "abc123"}`, want: `{"revision": "abc123"}`},
+		{body: strings.Repeat("a", 100), want: strings.Repeat("a", maxVersionLength)},
+	} {
+		if got := parseVersion([]byte(spec.body)); got != spec.want {
+			t.Errorf("parseVersion(%q) = %q; want %q", spec.body, got, spec.want)
+		}
+	}
+}
+
+func TestRenderEnvironmentDetail(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprintf(w, "<%s-%s>", r.FormValue("project"), r.FormValue("environment"))
+	}))
+	defer s.Close()
+
+	c := VersionColumn{URL: s.URL, Project: "api", Header: "Version", cache: newCache(http.DefaultClient, time.Minute)}
+	for i := 0; i < 2; i++ {
+		got, err := c.RenderEnvironmentDetail("production")
+		if err != nil {
+			t.Fatalf("c.RenderEnvironmentDetail(%q) failed with %v", "production", err)
+		}
+		if want := template.HTML("<td><code>&lt;api-production&gt;</code></td>"); got != want {
+			t.Errorf("c.RenderEnvironmentDetail(%q) = %q; want %q", "production", got, want)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("hits = %d; want 1 with the cache", got)
+	}
+
+	c.URL = s.URL + "/missing"
+	s.Close()
+	if got, err := c.RenderEnvironmentDetail("staging"); err != nil || got != template.HTML("<td></td>") {
+		t.Errorf("c.RenderEnvironmentDetail(%q) = %q, %v; want an empty cell", "staging", got, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/preflight"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/ssh"
+	"golang.org/x/net/context"
+)
+
+// preflightClient is the HTTP client of health checks. Requests are bounded by the time budget of the checks.
+var preflightClient = &http.Client{}
+
+// preflightCheckers returns the preflight checkers of "env", which connect to hosts as "deployUser".
+func (h DeployHandler) preflightCheckers(deployUser string, env config.Environment) ([]preflight.Checker, error) {
+	if env.Preflight == nil {
+		return nil, nil
+	}
+	s, err := ssh.WithPrivateKeyFile(deployUser, h.sshKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if h.hostKeys != nil {
+		s = s.WithHostKeys(h.hostKeys)
+	}
+	return preflight.ForEnvironment(env, config.WithSSHAuth(s, env), preflightClient), nil
+}
+
+// preflightHosts checks "hosts" of "env" of "proj" with "checkers" and applies the policy of "env" to the failed hosts.
+// It returns the hosts to deploy into and the failed hosts which are excluded, or an error if the deployment must abort.
+// Each failure is also reported with "report".
+func preflightHosts(ctx context.Context, proj string, env config.Environment, hosts config.HostList, checkers []preflight.Checker, report func(string)) (config.HostList, []preflight.Failure, error) {
+	if len(checkers) == 0 || len(hosts) == 0 {
+		return hosts, nil, nil
+	}
+	failures := preflight.Run(ctx, hosts, checkers, env.Preflight.Timeout())
+	if len(failures) == 0 {
+		return hosts, nil, nil
+	}
+	failed := make(map[string]bool)
+	var reasons []string
+	for _, f := range failures {
+		reqlog.Warningf(ctx, "%s in %s-%s failed the preflight checks: %s", f.Host, proj, env.Name, f.Reason)
+		report(fmt.Sprintf("preflight: %s: %s", f.Host, f.Reason))
+		failed[f.Host] = true
+		reasons = append(reasons, fmt.Sprintf("%s: %s", f.Host, f.Reason))
+	}
+	if env.PreflightFailurePolicy() == config.PreflightAbort {
+		return nil, failures, fmt.Errorf("%d hosts in %s-%s failed the preflight checks: %s", len(failures), proj, env.Name, strings.Join(reasons, "; "))
+	}
+	var passed config.HostList
+	for _, host := range hosts {
+		if !failed[host] {
+			passed = append(passed, host)
+		}
+	}
+	if len(passed) == 0 {
+		return nil, failures, fmt.Errorf("all hosts in %s-%s failed the preflight checks: %s", proj, env.Name, strings.Join(reasons, "; "))
+	}
+	reqlog.Infof(ctx, "Skipping %d hosts in %s-%s which failed the preflight checks", len(failures), proj, env.Name)
+	return passed, failures, nil
+}
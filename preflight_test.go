@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/preflight"
+	"golang.org/x/net/context"
+)
+
+// failHosts returns checkers which fail for "failed" hosts.
+func failHosts(failed ...string) []preflight.Checker {
+	return []preflight.Checker{preflight.CheckerFunc(func(ctx context.Context, host string) error {
+		for _, f := range failed {
+			if host == f {
+				return errors.New("unreachable")
+			}
+		}
+		return nil
+	})}
+}
+
+func TestPreflightHosts(t *testing.T) {
+	hosts := config.HostList{"web1", "web2", "web3"}
+	for _, spec := range []struct {
+		policy   config.PreflightPolicy
+		failed   []string
+		want     config.HostList
+		skipped  []preflight.Failure
+		wantErr  bool
+		reported int
+	}{
+		{policy: config.PreflightAbort, want: hosts},
+		{policy: config.PreflightSkip, want: hosts},
+		{
+			policy:   "",
+			failed:   []string{"web2"},
+			skipped:  []preflight.Failure{{Host: "web2", Reason: "unreachable"}},
+			wantErr:  true,
+			reported: 1,
+		},
+		{
+			policy:   config.PreflightAbort,
+			failed:   []string{"web2"},
+			skipped:  []preflight.Failure{{Host: "web2", Reason: "unreachable"}},
+			wantErr:  true,
+			reported: 1,
+		},
+		{
+			policy:   config.PreflightSkip,
+			failed:   []string{"web1", "web3"},
+			want:     config.HostList{"web2"},
+			skipped:  []preflight.Failure{{Host: "web1", Reason: "unreachable"}, {Host: "web3", Reason: "unreachable"}},
+			reported: 2,
+		},
+		{
+			policy:   config.PreflightSkip,
+			failed:   []string{"web1", "web2", "web3"},
+			skipped:  []preflight.Failure{{Host: "web1", Reason: "unreachable"}, {Host: "web2", Reason: "unreachable"}, {Host: "web3", Reason: "unreachable"}},
+			wantErr:  true,
+			reported: 3,
+		},
+	} {
+		env := config.Environment{Name: "production", Preflight: &config.PreflightConfiguration{}, OnPreflightFailure: spec.policy}
+		var reported []string
+		report := func(line string) { reported = append(reported, line) }
+		got, skipped, err := preflightHosts(context.Background(), "goship", env, hosts, failHosts(spec.failed...), report)
+		if (err != nil) != spec.wantErr {
+			t.Errorf("preflightHosts with %q failing under %q failed with %v; want error %t", spec.failed, spec.policy, err, spec.wantErr)
+		}
+		if !reflect.DeepEqual(got, spec.want) {
+			t.Errorf("preflightHosts with %q failing under %q = %q; want %q", spec.failed, spec.policy, got, spec.want)
+		}
+		if !reflect.DeepEqual(skipped, spec.skipped) {
+			t.Errorf("preflightHosts with %q failing under %q skipped %#v; want %#v", spec.failed, spec.policy, skipped, spec.skipped)
+		}
+		if len(reported) != spec.reported {
+			t.Errorf("preflightHosts with %q failing under %q reported %q; want %d lines", spec.failed, spec.policy, reported, spec.reported)
+		}
+	}
+
+	// no checks configured
+	got, skipped, err := preflightHosts(context.Background(), "goship", config.Environment{Name: "production"}, hosts, nil, func(string) {})
+	if err != nil || !reflect.DeepEqual(got, hosts) || skipped != nil {
+		t.Errorf("preflightHosts without checkers = %q, %#v, %v; want %q", got, skipped, err, hosts)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// jiraIssueRE matches keys of JIRA issues in commit messages, e.g. "API-42".
+var jiraIssueRE = regexp.MustCompile(`\b[A-Z][A-Z0-9]+-[0-9]+\b`)
+
+// releaseDeploy creates a GitHub release of "deploy.To" deployed into "env" of "proj" at "t" if enabled by env.Release,
+// and returns its tag. Redeployments of a revision released in "previous" entries of the deploy log reuse its release,
+// which is kept or updated as configured. Failures are only logged since they must not fail deployments.
+func releaseDeploy(ctx context.Context, gcl githublib.Client, proj config.Project, env config.Environment, deploy RevRange, t time.Time, previous []DeployLogEntry) string {
+	c := env.Release
+	if c == nil || proj.RepoType == config.RepoTypeDocker || deploy.To == "" {
+		return ""
+	}
+	repo := proj.SourceRepo()
+	sha := string(deploy.To)
+	tag := releasedTag(previous, deploy.To)
+	if tag == "" {
+		var err error
+		tag, err = c.TagFor(config.ReleaseParams{Project: proj.Name, Environment: env.Name, Revision: sha, Time: t})
+		if err != nil {
+			reqlog.Errorf(ctx, "Failed to name the release of %s-%s: %v", proj.Name, env.Name, err)
+			return ""
+		}
+	}
+	body := releaseBody(ctx, gcl, repo, env.Name, deploy)
+
+	existing, resp, err := gcl.GetReleaseByTag(repo.RepoOwner, repo.RepoName, tag)
+	switch {
+	case err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+		// not released yet
+	case err != nil:
+		reqlog.Errorf(ctx, "Failed to get release %s of %s/%s: %v", tag, repo.RepoOwner, repo.RepoName, err)
+		return ""
+	case existing.TargetCommitish == nil || *existing.TargetCommitish != sha:
+		reqlog.Errorf(ctx, "Release %s of %s/%s already exists for another revision; not releasing %s", tag, repo.RepoOwner, repo.RepoName, sha)
+		return ""
+	case c.OnExisting != config.ReleaseUpdate:
+		reqlog.Infof(ctx, "Release %s of %s/%s already exists", tag, repo.RepoOwner, repo.RepoName)
+		return tag
+	default:
+		if _, _, err := gcl.EditRelease(repo.RepoOwner, repo.RepoName, *existing.ID, &github.RepositoryRelease{Body: github.String(body)}); err != nil {
+			reqlog.Errorf(ctx, "Failed to update release %s of %s/%s: %v", tag, repo.RepoOwner, repo.RepoName, err)
+			return ""
+		}
+		reqlog.Infof(ctx, "Updated release %s of %s/%s", tag, repo.RepoOwner, repo.RepoName)
+		return tag
+	}
+
+	release := &github.RepositoryRelease{
+		TagName:         github.String(tag),
+		TargetCommitish: github.String(sha),
+		Name:            github.String(tag),
+		Body:            github.String(body),
+	}
+	if _, _, err := gcl.CreateRelease(repo.RepoOwner, repo.RepoName, release); err != nil {
+		reqlog.Errorf(ctx, "Failed to create release %s of %s/%s: %v", tag, repo.RepoOwner, repo.RepoName, err)
+		return ""
+	}
+	reqlog.Infof(ctx, "Created release %s of %s/%s at %s", tag, repo.RepoOwner, repo.RepoName, sha)
+	return tag
+}
+
+// releasedTag returns the tag of the latest release of "rev" recorded in "entries", or "" if it has not been released.
+func releasedTag(entries []DeployLogEntry, rev revision.Revision) string {
+	var (
+		tag    string
+		latest time.Time
+	)
+	for _, e := range entries {
+		if e.ReleaseTag != "" && e.Range.To == rev && e.Time.After(latest) {
+			tag, latest = e.ReleaseTag, e.Time
+		}
+	}
+	return tag
+}
+
+// releaseGroup is the commits of a release which refer to the same story.
+type releaseGroup struct {
+	title string
+	// story is the ID of the Pivotal story and issue is the key of the JIRA issue which the commits refer to.
+	// Both are empty for the commits which refer to neither.
+	story   int
+	issue   string
+	commits []string
+}
+
+// releaseBody returns the body of the release of "deploy" into "env", which lists the deployed commits of "repo" grouped by
+// the Pivotal stories or JIRA issues they refer to.
+func releaseBody(ctx context.Context, gcl githublib.Client, repo config.Repo, env string, deploy RevRange) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Deployed %s into %s.\n", deploy.To.Short(), env)
+	if deploy.From == "" {
+		return buf.String()
+	}
+	comp, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(deploy.From), string(deploy.To))
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to compare %s...%s of %s/%s: %v", deploy.From, deploy.To, repo.RepoOwner, repo.RepoName, err)
+		fmt.Fprintf(&buf, "\nChanges since %s are not available.\n", deploy.From.Short())
+		return buf.String()
+	}
+	for _, g := range groupCommits(comp.Commits) {
+		fmt.Fprintf(&buf, "\n### %s\n\n", g.title)
+		for _, c := range g.commits {
+			fmt.Fprintf(&buf, "- %s\n", c)
+		}
+	}
+	return buf.String()
+}
+
+// groupCommits groups "commits" by the Pivotal stories or the JIRA issues which their messages refer to in the order of
+// their first commits, followed by the other commits. A commit referring to both is grouped by its Pivotal story.
+func groupCommits(commits []github.RepositoryCommit) []releaseGroup {
+	var (
+		groups []releaseGroup
+		others []string
+	)
+	index := make(map[string]int)
+	for _, c := range commits {
+		var sha, msg, author string
+		if c.SHA != nil {
+			sha = *c.SHA
+		}
+		if c.Commit != nil {
+			if c.Commit.Message != nil {
+				msg = *c.Commit.Message
+			}
+			if c.Commit.Author != nil && c.Commit.Author.Name != nil {
+				author = *c.Commit.Author.Name
+			}
+		}
+		line := fmt.Sprintf("%s %s", revision.Revision(sha).Short(), strings.SplitN(msg, "\n", 2)[0])
+		if author != "" {
+			line += fmt.Sprintf(" (%s)", author)
+		}
+		var g releaseGroup
+		if id := config.PivotalStoryOf(msg); id != 0 {
+			g = releaseGroup{title: fmt.Sprintf("Pivotal #%d", id), story: id}
+		} else if key := jiraIssueRE.FindString(msg); key != "" {
+			g = releaseGroup{title: "JIRA " + key, issue: key}
+		}
+		if g.title == "" {
+			others = append(others, line)
+			continue
+		}
+		i, ok := index[g.title]
+		if !ok {
+			i = len(groups)
+			index[g.title] = i
+			groups = append(groups, g)
+		}
+		groups[i].commits = append(groups[i].commits, line)
+	}
+	if len(others) > 0 {
+		groups = append(groups, releaseGroup{title: "Other changes", commits: others})
+	}
+	return groups
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// releaseClient is a githublib.Client which keeps releases by tag like the releases API.
+type releaseClient struct {
+	githublib.Client
+	releases      map[string]*github.RepositoryRelease
+	created, edit int
+	fail          bool
+}
+
+func (c *releaseClient) GetReleaseByTag(owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error) {
+	if c.fail {
+		return nil, nil, errors.New("unavailable")
+	}
+	r, ok := c.releases[tag]
+	if !ok {
+		resp := &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}
+		return nil, resp, &github.ErrorResponse{Response: resp.Response, Message: "Not Found"}
+	}
+	return r, nil, nil
+}
+
+func (c *releaseClient) CreateRelease(owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	c.created++
+	release.ID = github.Int(len(c.releases) + 1)
+	c.releases[*release.TagName] = release
+	return release, nil, nil
+}
+
+func (c *releaseClient) EditRelease(owner, repo string, id int, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	c.edit++
+	for _, r := range c.releases {
+		if *r.ID == id {
+			r.Body = release.Body
+			return r, nil, nil
+		}
+	}
+	return nil, nil, errors.New("not found")
+}
+
+func (c *releaseClient) CompareCommits(owner, repo, base, head string) (*github.CommitsComparison, *github.Response, error) {
+	return &github.CommitsComparison{Commits: []github.RepositoryCommit{
+		releaseCommit("1111111aaa", "Add login [#123]"),
+		releaseCommit("2222222bbb", "API-42 Fix timeout\n\nDetails"),
+		releaseCommit("3333333ccc", "Bump version"),
+		releaseCommit("4444444ddd", "Fix login again [finishes #123] API-43"),
+	}}, nil, nil
+}
+
+func releaseCommit(sha, msg string) github.RepositoryCommit {
+	return github.RepositoryCommit{
+		SHA:    github.String(sha),
+		Commit: &github.Commit{Message: github.String(msg), Author: &github.CommitAuthor{Name: github.String("alice")}},
+	}
+}
+
+func TestReleaseDeploy(t *testing.T) {
+	proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, RepoType: config.RepoTypeGithub}
+	env := config.Environment{Name: "prod", Release: &config.ReleaseConfiguration{}}
+	deployTime := time.Date(2015, 10, 10, 12, 34, 0, 0, time.UTC)
+	deploy := RevRange{From: "0000000", To: "abcdef0123"}
+	gcl := &releaseClient{releases: make(map[string]*github.RepositoryRelease)}
+
+	tag := releaseDeploy(context.Background(), gcl, proj, env, deploy, deployTime, nil)
+	if want := "deploy-prod-20151010-1234"; tag != want {
+		t.Fatalf("releaseDeploy(ctx, gcl, proj, env, deploy, t, nil) = %q; want %q", tag, want)
+	}
+	r := gcl.releases[tag]
+	if r == nil || *r.TargetCommitish != "abcdef0123" || gcl.created != 1 {
+		t.Fatalf("releases = %#v; want a release of abcdef0123", gcl.releases)
+	}
+	want := `Deployed abcdef0 into prod.
+
+### Pivotal #123
+
+- 1111111 Add login [#123] (alice)
+- 4444444 Fix login again [finishes #123] API-43 (alice)
+
+### JIRA API-42
+
+- 2222222 API-42 Fix timeout (alice)
+
+### Other changes
+
+- 3333333 Bump version (alice)
+`
+	if *r.Body != want {
+		t.Errorf("body = %q; want %q", *r.Body, want)
+	}
+
+	// redeployment of the same revision later
+	previous := []DeployLogEntry{{Range: deploy, Time: deployTime, Success: true, ReleaseTag: tag}}
+	*r.Body = "edited by hand"
+	if got := releaseDeploy(context.Background(), gcl, proj, env, deploy, deployTime.Add(time.Hour), previous); got != tag {
+		t.Errorf("releaseDeploy of the released revision = %q; want %q", got, tag)
+	}
+	if gcl.created != 1 || gcl.edit != 0 || *r.Body != "edited by hand" {
+		t.Errorf("release = %q after %d creations and %d edits; want it skipped", *r.Body, gcl.created, gcl.edit)
+	}
+	update := env
+	update.Release = &config.ReleaseConfiguration{OnExisting: config.ReleaseUpdate}
+	if got := releaseDeploy(context.Background(), gcl, proj, update, deploy, deployTime.Add(time.Hour), previous); got != tag {
+		t.Errorf("releaseDeploy of the released revision = %q; want %q", got, tag)
+	}
+	if gcl.created != 1 || gcl.edit != 1 || *r.Body != want {
+		t.Errorf("release = %q after %d creations and %d edits; want it updated", *r.Body, gcl.created, gcl.edit)
+	}
+
+	// another revision deployed within the same minute conflicts with the tag
+	other := RevRange{From: "abcdef0123", To: "fedcba9876"}
+	if got := releaseDeploy(context.Background(), gcl, proj, env, other, deployTime, previous); got != "" {
+		t.Errorf("releaseDeploy with a conflicting tag = %q; want no release", got)
+	}
+	if gcl.created != 1 || *r.TargetCommitish != "abcdef0123" {
+		t.Errorf("release %s points at %s after %d creations; want the existing one kept", tag, *r.TargetCommitish, gcl.created)
+	}
+
+	gcl.fail = true
+	if got := releaseDeploy(context.Background(), gcl, proj, env, RevRange{To: "1234567890"}, deployTime.Add(2*time.Hour), nil); got != "" {
+		t.Errorf("releaseDeploy with GitHub unavailable = %q; want no release", got)
+	}
+	gcl.fail = false
+
+	// first deployment has no commits to list
+	custom := env
+	custom.Release = &config.ReleaseConfiguration{Tag: `{{.Project}}-{{.Revision}}`}
+	tag = releaseDeploy(context.Background(), gcl, proj, custom, RevRange{To: "1234567890"}, deployTime, nil)
+	if tag != "api-1234567890" || !strings.HasPrefix(*gcl.releases[tag].Body, "Deployed 1234567 into prod.") {
+		t.Errorf("releaseDeploy of the first deployment = %q with %#v; want api-1234567890", tag, gcl.releases[tag])
+	}
+
+	gcl.created = 0
+	disabled := env
+	disabled.Release = nil
+	releaseDeploy(context.Background(), gcl, proj, disabled, RevRange{To: "5555555555"}, deployTime, nil)
+	docker := proj
+	docker.RepoType = config.RepoTypeDocker
+	releaseDeploy(context.Background(), gcl, docker, env, RevRange{To: "v1.2.3"}, deployTime, nil)
+	if gcl.created != 0 {
+		t.Errorf("CreateRelease called %d times; want no calls when disabled or for docker", gcl.created)
+	}
+}
+
+func TestReleasedTag(t *testing.T) {
+	t0 := time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC)
+	entries := []DeployLogEntry{
+		{Range: RevRange{To: "a"}, Time: t0, ReleaseTag: "deploy-1"},
+		{Range: RevRange{To: "b"}, Time: t0.Add(time.Hour), ReleaseTag: "deploy-2"},
+		{Range: RevRange{To: "a"}, Time: t0.Add(2 * time.Hour), ReleaseTag: "deploy-3"},
+		{Range: RevRange{To: "a"}, Time: t0.Add(3 * time.Hour)},
+	}
+	for rev, want := range map[string]string{"a": "deploy-3", "b": "deploy-2", "c": ""} {
+		if got := releasedTag(entries, revision.Revision(rev)); got != want {
+			t.Errorf("releasedTag(entries, %q) = %q; want %q", rev, got, want)
+		}
+	}
+	if got := groupCommits(nil); !reflect.DeepEqual(got, []releaseGroup(nil)) {
+		t.Errorf("groupCommits(nil) = %#v; want no groups", got)
+	}
+}
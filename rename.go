@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/annotation"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/drain"
+	"github.com/gengo/goship/lib/hostlock"
+	"github.com/gengo/goship/lib/proxy"
+	"github.com/golang/glog"
+)
+
+// defaultRenameGrace is how long old names of renamed projects are redirected to the new names by default.
+const defaultRenameGrace = 30 * 24 * time.Hour
+
+// renameHistory moves the deploy histories and outputs of the project "from" in "c" to "to",
+// and renames steps of "from" in chained deployments recorded in all the histories.
+// It fails without moving anything if "to" already has records.
+func renameHistory(c config.Config, from, to string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	proj, err := config.FindProject(c.Projects, from)
+	if err != nil {
+		return err
+	}
+	var moves [][2]string
+	for _, e := range proj.Environments {
+		src, dst := fmt.Sprintf("%s-%s", from, e.Name), fmt.Sprintf("%s-%s", to, e.Name)
+		for _, name := range []string{".json", ""} {
+			if fileExists(path.Join(*dataPath, dst+name)) {
+				return fmt.Errorf("records of %s already exist", dst)
+			}
+			if fileExists(path.Join(*dataPath, src+name)) {
+				moves = append(moves, [2]string{path.Join(*dataPath, src+name), path.Join(*dataPath, dst+name)})
+			}
+		}
+	}
+	for i, m := range moves {
+		if err := os.Rename(m[0], m[1]); err != nil {
+			for _, m := range moves[:i] {
+				if err := os.Rename(m[1], m[0]); err != nil {
+					glog.Errorf("Failed to move %s back to %s: %v", m[1], m[0], err)
+				}
+			}
+			return err
+		}
+	}
+
+	for _, p := range c.Projects {
+		name := p.Name
+		if name == from {
+			name = to
+		}
+		for _, e := range p.Environments {
+			basename := fmt.Sprintf("%s-%s", name, e.Name)
+			if err := renameChainSteps(basename, from, to); err != nil {
+				return fmt.Errorf("failed to rename steps in %s: %v", basename, err)
+			}
+		}
+	}
+	return nil
+}
+
+// renameChainSteps renames the project "from" in chained deployments recorded in the history "basename" to "to".
+func renameChainSteps(basename, from, to string) error {
+	entries, err := readEntries(basename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, e := range entries {
+		for i := range e.Chain {
+			if e.Chain[i].Project == from {
+				e.Chain[i].Project = to
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeJSON(entries, path.Join(*dataPath, basename+".json"))
+}
+
+// renameProject renames the project "from" to "to" on behalf of "by". The old name redirects to the new one for "grace".
+// Deploy histories, outputs, locks, comments, drains, host locks and annotations follow the project.
+func renameProject(ecl *etcd.Client, from, to, by string, grace time.Duration, now time.Time) error {
+	c, err := config.Load(ecl)
+	if err != nil {
+		return err
+	}
+	if _, err := config.FindProject(c.Projects, to); err == nil {
+		return fmt.Errorf("project %s already exists", to)
+	}
+	if err := renameHistory(c, from, to); err != nil {
+		return err
+	}
+	if err := config.RenameProject(ecl, c, from, to, grace, now); err != nil {
+		if rerr := renameHistory(renamedConfig(c, from, to), to, from); rerr != nil {
+			glog.Errorf("Failed to move records of %s back to %s: %v", to, from, rerr)
+		}
+		return err
+	}
+	if err := drain.Rename(ecl, from, to, now); err != nil {
+		glog.Errorf("Failed to move drains of %s to %s: %v", from, to, err)
+	}
+	if err := hostlock.Rename(ecl, from, to, now); err != nil {
+		glog.Errorf("Failed to move host locks of %s to %s: %v", from, to, err)
+	}
+	if err := annotation.Rename(ecl, from, to, now); err != nil {
+		glog.Errorf("Failed to move annotations of %s to %s: %v", from, to, err)
+	}
+	glog.Infof("%s renamed project %s to %s; %s redirects until %s", by, from, to, from, now.Add(grace))
+	return nil
+}
+
+// renamedConfig returns a copy of "c" whose project "from" is named "to".
+func renamedConfig(c config.Config, from, to string) config.Config {
+	projs := make([]config.Project, len(c.Projects))
+	for i, p := range c.Projects {
+		if p.Name == from {
+			p.Name = to
+		}
+		projs[i] = p
+	}
+	c.Projects = projs
+	return c
+}
+
+// renameProjectHandler renames a project. Only admins can rename projects.
+// i.e. http://127.0.0.1:8000/admin/projects/rename?from=api&to=gateway&grace=72h
+type renameProjectHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+	// feed records renames.
+	feed *activity.Feed
+}
+
+func (h renameProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	from, to := r.FormValue("from"), r.FormValue("to")
+	if from == "" || to == "" {
+		http.Error(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+	grace := defaultRenameGrace
+	if s := r.FormValue("grace"); s != "" {
+		if grace, err = time.ParseDuration(s); err != nil || grace < 0 {
+			http.Error(w, fmt.Sprintf("invalid grace %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := renameProject(h.ecl, from, to, u.Name, grace, time.Now()); err != nil {
+		glog.Errorf("Failed to rename project %s to %s: %v", from, to, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.feed.Record(activity.Entry{Type: activity.ConfigChanged, Project: to, User: u.Name, Summary: fmt.Sprintf("%s renamed project %s to %s", u.Name, from, to)})
+	recordConfigVersion(h.ecl, to, u.Name, "renamed from "+from)
+	buf, err := json.Marshal(config.ProjectAlias{Project: to, Until: time.Now().Add(grace)})
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// redirectRenamed redirects requests to pages and APIs of renamed projects under their old names to the new names
+// during the grace periods. Other requests are served by "h".
+func redirectRenamed(load func() (config.Config, error), h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mayReferProject(r.URL) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		c, err := load()
+		if err != nil || len(c.ProjectAliases) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if u, ok := renamedURL(c, r.URL, time.Now()); ok {
+			http.Redirect(w, r, proxy.Path(u.String()), http.StatusTemporaryRedirect)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// projectPaths are prefixes of paths which contain project names.
+var projectPaths = []string{"/api/v1/projects/", "/commits/", "/deployLog/", "/output/"}
+
+// mayReferProject returns true if "u" may contain a project name, so that the config is loaded only for such requests.
+func mayReferProject(u *url.URL) bool {
+	for _, p := range projectPaths {
+		if strings.HasPrefix(u.Path, p) {
+			return true
+		}
+	}
+	return strings.Contains(u.RawQuery, "project=")
+}
+
+// renamedURL returns "u" with old names of renamed projects in "c" replaced by the new names at "now".
+// It returns false if "u" does not refer to any old names.
+func renamedURL(c config.Config, u *url.URL, now time.Time) (*url.URL, bool) {
+	// resolve returns the new name of "name" unless a project is still named "name".
+	resolve := func(name string) (string, bool) {
+		if _, err := config.FindProject(c.Projects, name); err == nil {
+			return name, false
+		}
+		to := c.ResolveProjectName(name, now)
+		return to, to != name
+	}
+	renamed := *u
+	changed := false
+	parts := strings.Split(u.Path, "/")
+	switch {
+	case len(parts) >= 5 && parts[1] == "api" && parts[2] == "v1" && parts[3] == "projects":
+		parts[4], changed = resolve(parts[4])
+	case len(parts) >= 3 && parts[1] == "commits":
+		parts[2], changed = resolve(parts[2])
+	case len(parts) >= 3 && (parts[1] == "deployLog" || parts[1] == "output"):
+		// "<project>-<environment>", split at the last "-" like extractDeployLogHandler.
+		if i := strings.LastIndex(parts[2], "-"); i > 0 {
+			var to string
+			if to, changed = resolve(parts[2][:i]); changed {
+				parts[2] = to + parts[2][i:]
+			}
+		}
+	}
+	renamed.Path = strings.Join(parts, "/")
+
+	if q := u.Query(); q.Get("project") != "" {
+		if to, ok := resolve(q.Get("project")); ok {
+			q.Set("project", to)
+			renamed.RawQuery = q.Encode()
+			changed = true
+		}
+	}
+	return &renamed, changed
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+var renameTestConfig = config.Config{
+	Projects: []config.Project{
+		{Name: "api", Environments: []config.Environment{{Name: "staging"}, {Name: "production"}}},
+		{Name: "web", Environments: []config.Environment{{Name: "production"}}},
+		{Name: "api-v2", Environments: []config.Environment{{Name: "production"}}},
+	},
+}
+
+func TestRenameHistory(t *testing.T) {
+	withDataPath(t, func() {
+		at := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+		if err := appendEntry("api", "production", DeployLogEntry{User: "alice", Success: true, Time: at}); err != nil {
+			t.Fatalf("appendEntry failed with %v", err)
+		}
+		chain := []ChainStep{{Project: "api", Environment: "production", Status: "success"}, {Project: "web", Environment: "production", Status: "success"}}
+		if err := appendEntry("web", "production", DeployLogEntry{User: "bob", Success: true, Time: at, Chain: chain}); err != nil {
+			t.Fatalf("appendEntry failed with %v", err)
+		}
+		if err := os.Mkdir(path.Join(*dataPath, "api-production"), 0755); err != nil {
+			t.Fatalf("os.Mkdir failed with %v", err)
+		}
+		output := path.Join("api-production", at.String()+".log")
+		if err := ioutil.WriteFile(path.Join(*dataPath, output), []byte("deployed"), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile failed with %v", err)
+		}
+
+		if err := renameHistory(renameTestConfig, "api", "gateway"); err != nil {
+			t.Fatalf("renameHistory(c, %q, %q) failed with %v", "api", "gateway", err)
+		}
+		entries, err := readEntries("gateway-production")
+		if err != nil || len(entries) != 1 || entries[0].User != "alice" {
+			t.Errorf("readEntries(%q) = %#v, %v; want the entry of api-production", "gateway-production", entries, err)
+		}
+		if _, err := readEntries("api-production"); !os.IsNotExist(err) {
+			t.Errorf("readEntries(%q) failed with %v; want not exist", "api-production", err)
+		}
+		if buf, err := ioutil.ReadFile(path.Join(*dataPath, "gateway-production", at.String()+".log")); err != nil || string(buf) != "deployed" {
+			t.Errorf("output of gateway-production = %q, %v; want the output of api-production", buf, err)
+		}
+		entries, err = readEntries("web-production")
+		if err != nil || len(entries) != 1 || len(entries[0].Chain) != 2 {
+			t.Fatalf("readEntries(%q) = %#v, %v; want the chained entry", "web-production", entries, err)
+		}
+		if got := entries[0].Chain[0].Project; got != "gateway" {
+			t.Errorf("project of the chain step = %q; want %q", got, "gateway")
+		}
+
+		// the new name must not have records yet.
+		if err := renameHistory(renamedConfig(renameTestConfig, "api", "gateway"), "gateway", "web"); err == nil {
+			t.Errorf("renameHistory(c, %q, %q) succeeded over the records of web; want failure", "gateway", "web")
+		}
+		if _, err := readEntries("gateway-production"); err != nil {
+			t.Errorf("readEntries(%q) failed with %v after a failed rename", "gateway-production", err)
+		}
+	})
+}
+
+func TestRenamedURL(t *testing.T) {
+	c := renamedConfig(renameTestConfig, "api", "gateway")
+	c.ProjectAliases = map[string]config.ProjectAlias{
+		"api":     {Project: "gateway", Until: time.Now().Add(time.Hour)},
+		"old-web": {Project: "web", Until: time.Now().Add(-time.Hour)},
+	}
+	for _, spec := range []struct {
+		url  string
+		want string
+	}{
+		{url: "/api/v1/projects/api/branches", want: "/api/v1/projects/gateway/branches"},
+		{url: "/api/v1/projects/api/deploy-batch?x=1", want: "/api/v1/projects/gateway/deploy-batch?x=1"},
+		{url: "/commits/api", want: "/commits/gateway"},
+		{url: "/deployLog/api-production", want: "/deployLog/gateway-production"},
+		{url: "/output/api-production/2015-10-01", want: "/output/gateway-production/2015-10-01"},
+		{url: "/deploy?project=api&environment=staging", want: "/deploy?environment=staging&project=gateway"},
+		// not renamed
+		{url: "/api/v1/projects/web/branches"},
+		{url: "/deployLog/api-v2-production"},
+		{url: "/commits/old-web"},
+		{url: "/"},
+	} {
+		u, err := url.Parse(spec.url)
+		if err != nil {
+			t.Fatalf("url.Parse(%q) failed with %v", spec.url, err)
+		}
+		got, ok := renamedURL(c, u, time.Now())
+		if spec.want == "" {
+			if ok {
+				t.Errorf("renamedURL(c, %q, now) = %q, true; want false", spec.url, got)
+			}
+			continue
+		}
+		if !ok || got.String() != spec.want {
+			t.Errorf("renamedURL(c, %q, now) = %q, %v; want %q, true", spec.url, got, ok, spec.want)
+		}
+	}
+}
+
+func TestRedirectRenamed(t *testing.T) {
+	c := renamedConfig(renameTestConfig, "api", "gateway")
+	c.ProjectAliases = map[string]config.ProjectAlias{"api": {Project: "gateway", Until: time.Now().Add(time.Hour)}}
+	loads := 0
+	load := func() (config.Config, error) {
+		loads++
+		return c, nil
+	}
+	h := redirectRenamed(load, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, &http.Request{Method: "POST", URL: &url.URL{Path: "/api/v1/projects/api/deploy-batch"}})
+	if w.Code != http.StatusTemporaryRedirect || w.HeaderMap.Get("Location") != "/api/v1/projects/gateway/deploy-batch" {
+		t.Errorf("response = %d %q; want %d to the new name", w.Code, w.HeaderMap.Get("Location"), http.StatusTemporaryRedirect)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/commits/gateway"}})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("response to the new name = %d; want %d", w.Code, http.StatusNoContent)
+	}
+
+	loads = 0
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/static/app.js"}})
+	if w.Code != http.StatusNoContent || loads != 0 {
+		t.Errorf("response = %d with %d loads of the config; want %d without loads", w.Code, loads, http.StatusNoContent)
+	}
+
+	h = redirectRenamed(func() (config.Config, error) { return config.Config{}, errors.New("unavailable") }, h)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, &http.Request{Method: "GET", URL: &url.URL{Path: "/commits/gateway"}})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("response with an unavailable config = %d; want %d", w.Code, http.StatusNoContent)
+	}
+}
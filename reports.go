@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcderr"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// monthlyReportsKey is the etcd directory which contains monthly rollups keyed by months.
+	monthlyReportsKey = "/goship/reports/monthly"
+	// monthFormat is the format of months in rollups, e.g. "2015-10".
+	monthFormat = "2006-01"
+)
+
+// monthlyRollup counts deployments of all the environments in a month.
+type monthlyRollup struct {
+	Month    string `json:"month"`
+	Timezone string `json:"timezone"`
+	// GeneratedAt is when the rollup was computed from the deploy history.
+	GeneratedAt time.Time   `json:"generated_at"`
+	Rows        []rollupRow `json:"rows"`
+}
+
+// rollupRow counts deployments of an environment in a month.
+type rollupRow struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	Deploys     int    `json:"deploys"`
+	Succeeded   int    `json:"succeeded"`
+	// SuccessRate is Succeeded / Deploys, or zero without deployments.
+	SuccessRate float64 `json:"success_rate"`
+	// DeployMinutes is the total duration of the deployments in minutes.
+	DeployMinutes float64 `json:"deploy_minutes"`
+}
+
+// reportLocation returns the timezone which months begin in under "r".
+func reportLocation(r *config.ReportsConfiguration) (*time.Location, error) {
+	if r == nil || r.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.Timezone)
+}
+
+// monthRange returns the beginning of "month" in "loc" and of the next month.
+func monthRange(month string, loc *time.Location) (time.Time, time.Time, error) {
+	begin, err := time.ParseInLocation(monthFormat, month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q; want YYYY-MM", month)
+	}
+	return begin, begin.AddDate(0, 1, 0), nil
+}
+
+// rollupMonth counts deployments of all the environments in "c" during "month" in "loc" from the deploy history.
+// Records imported by bootstrap and summaries of chained or batched deployments are not deployments by themselves.
+// Environments without deployments in the month are left out.
+func rollupMonth(c config.Config, month string, loc *time.Location, now time.Time) (monthlyRollup, error) {
+	begin, end, err := monthRange(month, loc)
+	if err != nil {
+		return monthlyRollup{}, err
+	}
+	r := monthlyRollup{Month: month, Timezone: loc.String(), GeneratedAt: now, Rows: []rollupRow{}}
+	for _, p := range c.Projects {
+		for _, e := range p.Environments {
+			entries, err := readEntries(fmt.Sprintf("%s-%s", p.Name, e.Name))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return monthlyRollup{}, fmt.Errorf("failed to read deploy history of %s-%s: %v", p.Name, e.Name, err)
+			}
+			row := rollupRow{Project: p.Name, Environment: e.Name}
+			var total time.Duration
+			for _, d := range entries {
+				if d.Imported || len(d.Chain) > 0 || d.Time.Before(begin) || !d.Time.Before(end) {
+					continue
+				}
+				row.Deploys++
+				if d.Success {
+					row.Succeeded++
+				}
+				total += d.Duration
+			}
+			if row.Deploys == 0 {
+				continue
+			}
+			row.SuccessRate = float64(row.Succeeded) / float64(row.Deploys)
+			row.DeployMinutes = total.Minutes()
+			r.Rows = append(r.Rows, row)
+		}
+	}
+	sort.Sort(byProjectEnvironment(r.Rows))
+	return r, nil
+}
+
+type byProjectEnvironment []rollupRow
+
+func (b byProjectEnvironment) Len() int      { return len(b) }
+func (b byProjectEnvironment) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byProjectEnvironment) Less(i, j int) bool {
+	if b[i].Project != b[j].Project {
+		return b[i].Project < b[j].Project
+	}
+	return b[i].Environment < b[j].Environment
+}
+
+// writeCSV writes the rows of "r" in CSV with a header.
+func (r monthlyRollup) writeCSV(w *csv.Writer) error {
+	if err := w.Write([]string{"month", "project", "environment", "deploys", "succeeded", "success_rate", "deploy_minutes"}); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		rec := []string{
+			r.Month, row.Project, row.Environment,
+			strconv.Itoa(row.Deploys), strconv.Itoa(row.Succeeded),
+			strconv.FormatFloat(row.SuccessRate, 'f', 3, 64),
+			strconv.FormatFloat(row.DeployMinutes, 'f', 1, 64),
+		}
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// reportStore is the subset of etcd.Client which stores rollups.
+type reportStore interface {
+	Get(key string, sort, recursive bool) (*etcd.Response, error)
+	Set(key, value string, ttl uint64) (*etcd.Response, error)
+}
+
+// loadRollup returns the rollup of "month" stored in "s". It returns false if the month has not been rolled up.
+func loadRollup(s reportStore, month string) (monthlyRollup, bool, error) {
+	resp, err := s.Get(path.Join(monthlyReportsKey, month), false, false)
+	if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == etcderr.KeyNotFound {
+		return monthlyRollup{}, false, nil
+	}
+	if err != nil {
+		return monthlyRollup{}, false, err
+	}
+	var r monthlyRollup
+	if err := json.Unmarshal([]byte(resp.Node.Value), &r); err != nil {
+		return monthlyRollup{}, false, fmt.Errorf("malformed rollup of %s: %v", month, err)
+	}
+	return r, true, nil
+}
+
+func storeRollup(s reportStore, r monthlyRollup) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(path.Join(monthlyReportsKey, r.Month), string(buf), 0)
+	return err
+}
+
+// recomputeRollup rolls up "month" from the current deploy history in "c" and stores it into "s".
+func recomputeRollup(s reportStore, c config.Config, month string, now time.Time) (monthlyRollup, error) {
+	loc, err := reportLocation(c.Reports)
+	if err != nil {
+		return monthlyRollup{}, err
+	}
+	historyMu.Lock()
+	r, err := rollupMonth(c, month, loc, now)
+	historyMu.Unlock()
+	if err != nil {
+		return monthlyRollup{}, err
+	}
+	if err := storeRollup(s, r); err != nil {
+		return monthlyRollup{}, err
+	}
+	return r, nil
+}
+
+// runMonthlyRollup rolls up the last month unless it already has been, so that the rollup survives pruning of the history.
+// It is a background job of the leader.
+func runMonthlyRollup(ctx context.Context, ecl *etcd.Client) {
+	c, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	if c.Reports == nil || !c.Reports.Monthly {
+		return
+	}
+	loc, err := reportLocation(c.Reports)
+	if err != nil {
+		glog.Errorf("Invalid timezone of reports: %v", err)
+		return
+	}
+	now := time.Now().In(loc)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc).AddDate(0, -1, 0).Format(monthFormat)
+	if _, ok, err := loadRollup(ecl, month); err != nil || ok {
+		if err != nil {
+			glog.Errorf("Failed to load rollup of %s: %v", month, err)
+		}
+		return
+	}
+	r, err := recomputeRollup(ecl, c, month, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to roll up %s: %v", month, err)
+		return
+	}
+	glog.Infof("Rolled up %d environments deployed in %s", len(r.Rows), month)
+}
+
+// monthlyReportHandler serves the rollup of a month in JSON or CSV. Months which have not been rolled up yet,
+// e.g. the current month, are computed from the deploy history on the fly.
+// i.e. http://127.0.0.1:8000/api/v1/reports/monthly?month=2015-10&format=csv
+type monthlyReportHandler struct {
+	ecl *etcd.Client
+}
+
+func (h monthlyReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if c.Reports == nil || !c.Reports.Monthly {
+		http.Error(w, "monthly reports are not enabled", http.StatusNotFound)
+		return
+	}
+	month, format := r.FormValue("month"), r.FormValue("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+	loc, err := reportLocation(c.Reports)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, _, err := monthRange(month, loc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rollup, ok, err := loadRollup(h.ecl, month)
+	if err != nil {
+		glog.Errorf("Failed to load rollup of %s: %v", month, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		historyMu.Lock()
+		rollup, err = rollupMonth(c, month, loc, time.Now())
+		historyMu.Unlock()
+		if err != nil {
+			glog.Errorf("Failed to roll up %s: %v", month, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeRollup(w, rollup, format)
+}
+
+// writeRollup responds "rollup" in "format", which is "csv" or JSON otherwise.
+func writeRollup(w http.ResponseWriter, rollup monthlyRollup, format string) {
+	var buf bytes.Buffer
+	if format == "csv" {
+		if err := rollup.writeCSV(csv.NewWriter(&buf)); err != nil {
+			glog.Errorf("Failed to render rollup: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=goship-%s.csv", rollup.Month))
+	} else {
+		if err := json.NewEncoder(&buf).Encode(rollup); err != nil {
+			glog.Errorf("Failed to marshal response: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// recomputeReportHandler rolls up a month again from the current deploy history, e.g. after it has been fixed.
+// Only admins can recompute rollups.
+// i.e. POST http://127.0.0.1:8000/admin/reports/monthly?month=2015-10
+type recomputeReportHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+}
+
+func (h recomputeReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if c.Reports == nil || !c.Reports.Monthly {
+		http.Error(w, "monthly reports are not enabled", http.StatusNotFound)
+		return
+	}
+	month := r.FormValue("month")
+	rollup, err := recomputeRollup(h.ecl, c, month, time.Now())
+	if err != nil {
+		glog.Errorf("Failed to roll up %s: %v", month, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	glog.Infof("%s recomputed the rollup of %s", u.Name, month)
+	writeRollup(w, rollup, "json")
+}
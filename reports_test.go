@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func TestRollupMonth(t *testing.T) {
+	withDataPath(t, func() {
+		tokyo := time.FixedZone("JST", 9*60*60)
+		for _, e := range []struct {
+			env   string
+			entry DeployLogEntry
+		}{
+			// 2015-09-30T16:00 UTC is October in Tokyo.
+			{"production", DeployLogEntry{Success: true, Time: time.Date(2015, 9, 30, 16, 0, 0, 0, time.UTC), Duration: 3 * time.Minute}},
+			{"production", DeployLogEntry{Success: false, Time: time.Date(2015, 10, 15, 0, 0, 0, 0, time.UTC), Duration: time.Minute}},
+			// 2015-10-31T15:00 UTC is November in Tokyo.
+			{"production", DeployLogEntry{Success: true, Time: time.Date(2015, 10, 31, 15, 0, 0, 0, time.UTC), Duration: time.Minute}},
+			{"production", DeployLogEntry{Success: true, Time: time.Date(2015, 10, 20, 0, 0, 0, 0, time.UTC), Imported: true}},
+			{"production", DeployLogEntry{Success: true, Time: time.Date(2015, 10, 21, 0, 0, 0, 0, time.UTC), Chain: []ChainStep{{Project: "api", Environment: "production"}}}},
+			{"staging", DeployLogEntry{Success: true, Time: time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC), Duration: 30 * time.Second}},
+			{"staging", DeployLogEntry{Success: true, Time: time.Date(2015, 9, 1, 0, 0, 0, 0, time.UTC)}},
+		} {
+			if err := appendEntry("api", e.env, e.entry); err != nil {
+				t.Fatalf("appendEntry failed with %v", err)
+			}
+		}
+		c := config.Config{Projects: []config.Project{
+			{Name: "api", Environments: []config.Environment{{Name: "staging"}, {Name: "production"}}},
+			{Name: "web", Environments: []config.Environment{{Name: "production"}}},
+		}}
+		now := time.Date(2015, 11, 2, 0, 0, 0, 0, time.UTC)
+
+		for _, spec := range []struct {
+			month string
+			loc   *time.Location
+			want  []rollupRow
+		}{
+			{
+				month: "2015-10",
+				loc:   time.UTC,
+				want: []rollupRow{
+					{Project: "api", Environment: "production", Deploys: 2, Succeeded: 1, SuccessRate: 0.5, DeployMinutes: 2},
+					{Project: "api", Environment: "staging", Deploys: 1, Succeeded: 1, SuccessRate: 1, DeployMinutes: 0.5},
+				},
+			},
+			{
+				month: "2015-10",
+				loc:   tokyo,
+				want: []rollupRow{
+					{Project: "api", Environment: "production", Deploys: 2, Succeeded: 1, SuccessRate: 0.5, DeployMinutes: 4},
+					{Project: "api", Environment: "staging", Deploys: 1, Succeeded: 1, SuccessRate: 1, DeployMinutes: 0.5},
+				},
+			},
+			{
+				month: "2015-09",
+				loc:   time.UTC,
+				want: []rollupRow{
+					{Project: "api", Environment: "production", Deploys: 1, Succeeded: 1, SuccessRate: 1, DeployMinutes: 3},
+					{Project: "api", Environment: "staging", Deploys: 1, Succeeded: 1, SuccessRate: 1},
+				},
+			},
+			{
+				month: "2015-12",
+				loc:   time.UTC,
+				want:  []rollupRow{},
+			},
+		} {
+			r, err := rollupMonth(c, spec.month, spec.loc, now)
+			if err != nil {
+				t.Errorf("rollupMonth(c, %q, %v, now) failed with %v", spec.month, spec.loc, err)
+				continue
+			}
+			if !reflect.DeepEqual(r.Rows, spec.want) {
+				t.Errorf("rollupMonth(c, %q, %v, now).Rows = %#v; want %#v", spec.month, spec.loc, r.Rows, spec.want)
+			}
+		}
+
+		if _, err := rollupMonth(c, "2015-13", time.UTC, now); err == nil {
+			t.Errorf("rollupMonth(c, %q, ...) succeeded; want failure", "2015-13")
+		}
+	})
+}
+
+func TestRollupCSV(t *testing.T) {
+	r := monthlyRollup{
+		Month: "2015-10",
+		Rows: []rollupRow{
+			{Project: "api", Environment: "production", Deploys: 3, Succeeded: 2, SuccessRate: 2.0 / 3, DeployMinutes: 4.25},
+		},
+	}
+	var buf bytes.Buffer
+	if err := r.writeCSV(csv.NewWriter(&buf)); err != nil {
+		t.Fatalf("r.writeCSV(w) failed with %v", err)
+	}
+	want := "month,project,environment,deploys,succeeded,success_rate,deploy_minutes\n" +
+		"2015-10,api,production,3,2,0.667,4.2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("r.writeCSV(w) wrote %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// prunedRecords are records of an environment which retention prunes.
+type prunedRecords struct {
+	Project     string `json:"project"`
+	Environment string `json:"environment"`
+	// Entries are the times of pruned entries in the deploy history.
+	Entries []time.Time `json:"entries,omitempty"`
+	// Outputs are the paths of pruned outputs of deployments.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// pruneEntries splits "entries" into the ones to keep and the ones to prune under "p" at "now".
+// The most recent successful deployment is always kept regardless of "p" since rollbacks depend on it.
+// Both keep the order of "entries".
+func pruneEntries(entries []DeployLogEntry, p config.RetentionPolicy, now time.Time) (keep, pruned []DeployLogEntry) {
+	// indices of entries from the most recent
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byEntryTime{entries: entries, order: order})
+
+	var (
+		expired = make(map[int]bool)
+		maxAge  = time.Duration(p.MaxAgeDays) * 24 * time.Hour
+		latest  = -1
+	)
+	for rank, i := range order {
+		e := entries[i]
+		if latest < 0 && e.Success && len(e.Chain) == 0 {
+			latest = i
+			continue
+		}
+		if (p.MaxCount > 0 && rank >= p.MaxCount) || (p.MaxAgeDays > 0 && now.Sub(e.Time) > maxAge) {
+			expired[i] = true
+		}
+	}
+	for i, e := range entries {
+		if expired[i] {
+			pruned = append(pruned, e)
+		} else {
+			keep = append(keep, e)
+		}
+	}
+	return keep, pruned
+}
+
+// byEntryTime sorts indices of entries from the most recent.
+type byEntryTime struct {
+	entries []DeployLogEntry
+	order   []int
+}
+
+func (b byEntryTime) Len() int      { return len(b.order) }
+func (b byEntryTime) Swap(i, j int) { b.order[i], b.order[j] = b.order[j], b.order[i] }
+func (b byEntryTime) Less(i, j int) bool {
+	return b.entries[b.order[i]].Time.After(b.entries[b.order[j]].Time)
+}
+
+// outputPath returns the path of the output of the deployment recorded in "e".
+func outputPath(basename string, e DeployLogEntry) string {
+	return path.Join(*dataPath, basename, e.Time.String()+".log")
+}
+
+// sweepRetention prunes records of all the environments in "c" under c.Retention at "now".
+// Outputs of pruned entries are pruned together. It only reports what would be pruned if "dryRun" is true.
+func sweepRetention(c config.Config, now time.Time, dryRun bool) ([]prunedRecords, error) {
+	if c.Retention == nil {
+		return nil, nil
+	}
+	var result []prunedRecords
+	for _, p := range c.Projects {
+		for _, e := range p.Environments {
+			rec, err := sweepEnvironment(c.Retention, p.Name, e.Name, now, dryRun)
+			if err != nil {
+				return result, fmt.Errorf("failed to prune records of %s-%s: %v", p.Name, e.Name, err)
+			}
+			if len(rec.Entries) > 0 || len(rec.Outputs) > 0 {
+				result = append(result, rec)
+			}
+		}
+	}
+	return result, nil
+}
+
+func sweepEnvironment(r *config.RetentionConfiguration, proj, env string, now time.Time, dryRun bool) (prunedRecords, error) {
+	rec := prunedRecords{Project: proj, Environment: env}
+	basename := fmt.Sprintf("%s-%s", proj, env)
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	entries, err := readEntries(basename)
+	if os.IsNotExist(err) {
+		return rec, nil
+	}
+	if err != nil {
+		return rec, err
+	}
+	keep, pruned := pruneEntries(entries, r.Deploys, now)
+	_, prunedOutputs := pruneEntries(keep, r.Outputs, now)
+	for _, e := range pruned {
+		rec.Entries = append(rec.Entries, e.Time)
+	}
+	for _, e := range append(pruned, prunedOutputs...) {
+		if p := outputPath(basename, e); fileExists(p) {
+			rec.Outputs = append(rec.Outputs, p)
+		}
+	}
+	if dryRun {
+		return rec, nil
+	}
+
+	if len(pruned) > 0 {
+		if keep == nil {
+			keep = []DeployLogEntry{}
+		}
+		if err := writeJSON(keep, path.Join(*dataPath, basename+".json")); err != nil {
+			return rec, err
+		}
+	}
+	for _, p := range rec.Outputs {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// runRetention prunes records under the retention policy in the current config. It is a background job of the leader.
+func runRetention(ctx context.Context, ecl *etcd.Client) {
+	c, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	recs, err := sweepRetention(c, time.Now(), false)
+	for _, rec := range recs {
+		glog.Infof("Pruned %d deploy entries and %d outputs of %s-%s", len(rec.Entries), len(rec.Outputs), rec.Project, rec.Environment)
+	}
+	if err != nil {
+		glog.Errorf("Failed to prune old records: %v", err)
+	}
+	if c.Retention == nil {
+		return
+	}
+	n, err := activity.Prune(ecl, c.Retention.Activity, time.Now())
+	if n > 0 {
+		glog.Infof("Pruned %d activities", n)
+	}
+	if err != nil {
+		glog.Errorf("Failed to prune old activities: %v", err)
+	}
+}
+
+// retentionHandler reports what retention would prune now without pruning them. Only admins can see it.
+// i.e. http://127.0.0.1:8000/admin/retention
+type retentionHandler struct {
+	ecl     *etcd.Client
+	isAdmin func(user string) bool
+}
+
+func (h retentionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	c, err := config.Load(h.ecl)
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recs, err := sweepRetention(c, time.Now(), true)
+	if err != nil {
+		glog.Errorf("Failed to compute records to prune: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if recs == nil {
+		recs = []prunedRecords{}
+	}
+	buf, err := json.Marshal(recs)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+)
+
+func entryIDs(entries []DeployLogEntry) []string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestPruneEntries(t *testing.T) {
+	now := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	history := []DeployLogEntry{
+		{ID: "d40", Time: now.Add(-40 * day), Success: true},
+		{ID: "d30", Time: now.Add(-30 * day), Success: true},
+		{ID: "d20", Time: now.Add(-20 * day), Success: false},
+		// chained deployments are not deployments of the environment itself
+		{ID: "d10", Time: now.Add(-10 * day), Success: true, Chain: []ChainStep{{Project: "api", Environment: "staging"}}},
+		{ID: "d2", Time: now.Add(-2 * day), Success: false},
+		{ID: "d1", Time: now.Add(-1 * day), Success: false},
+	}
+	for _, spec := range []struct {
+		policy       config.RetentionPolicy
+		keep, pruned []string
+	}{
+		{
+			policy: config.RetentionPolicy{},
+			keep:   []string{"d40", "d30", "d20", "d10", "d2", "d1"},
+		},
+		{
+			policy: config.RetentionPolicy{MaxCount: 2},
+			// d30 is the latest successful deployment
+			keep:   []string{"d30", "d2", "d1"},
+			pruned: []string{"d40", "d20", "d10"},
+		},
+		{
+			policy: config.RetentionPolicy{MaxAgeDays: 15},
+			keep:   []string{"d30", "d10", "d2", "d1"},
+			pruned: []string{"d40", "d20"},
+		},
+		{
+			policy: config.RetentionPolicy{MaxAgeDays: 15, MaxCount: 1},
+			keep:   []string{"d30", "d1"},
+			pruned: []string{"d40", "d20", "d10", "d2"},
+		},
+	} {
+		keep, pruned := pruneEntries(history, spec.policy, now)
+		if got := entryIDs(keep); !reflect.DeepEqual(got, spec.keep) {
+			t.Errorf("pruneEntries(history, %#v, now) keeps %q; want %q", spec.policy, got, spec.keep)
+		}
+		if got := entryIDs(pruned); !reflect.DeepEqual(got, spec.pruned) {
+			t.Errorf("pruneEntries(history, %#v, now) prunes %q; want %q", spec.policy, got, spec.pruned)
+		}
+	}
+}
+
+func TestPruneEntriesKeepsLatestSuccess(t *testing.T) {
+	now := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC)
+	// unsorted and all expired
+	history := []DeployLogEntry{
+		{ID: "new-failure", Time: now.Add(-100 * 24 * time.Hour)},
+		{ID: "old-success", Time: now.Add(-300 * 24 * time.Hour), Success: true},
+		{ID: "older-success", Time: now.Add(-400 * 24 * time.Hour), Success: true},
+	}
+	keep, pruned := pruneEntries(history, config.RetentionPolicy{MaxAgeDays: 1, MaxCount: 1}, now)
+	if got, want := entryIDs(keep), []string{"old-success"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pruneEntries(...) keeps %q; want %q", got, want)
+	}
+	if got, want := entryIDs(pruned), []string{"new-failure", "older-success"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pruneEntries(...) prunes %q; want %q", got, want)
+	}
+}
+
+func TestSweepRetention(t *testing.T) {
+	withDataPath(t, func() {
+		now := time.Now()
+		var history []DeployLogEntry
+		for i := 5; i > 0; i-- {
+			history = append(history, DeployLogEntry{ID: fmt.Sprintf("d%d", i), Time: now.Add(-time.Duration(i) * time.Hour), Success: true})
+		}
+		for _, e := range history {
+			if err := appendEntry("api", "production", e); err != nil {
+				t.Fatalf("appendEntry(%q, %q, %#v) failed with %v", "api", "production", e, err)
+			}
+		}
+		// reads them back so that times are formatted as the deploy log does.
+		history, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		if err := os.Mkdir(path.Join(*dataPath, "api-production"), 0755); err != nil {
+			t.Fatalf("os.Mkdir(...) failed with %v", err)
+		}
+		for _, e := range history {
+			if err := ioutil.WriteFile(outputPath("api-production", e), []byte("output"), 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile(...) failed with %v", err)
+			}
+		}
+
+		c := config.Config{
+			Projects: []config.Project{
+				{Name: "api", Environments: []config.Environment{{Name: "production"}, {Name: "staging"}}},
+			},
+			Retention: &config.RetentionConfiguration{
+				Deploys: config.RetentionPolicy{MaxCount: 3},
+				Outputs: config.RetentionPolicy{MaxCount: 1},
+			},
+		}
+		recs, err := sweepRetention(c, now, true)
+		if err != nil {
+			t.Fatalf("sweepRetention(c, now, true) failed with %v", err)
+		}
+		if len(recs) != 1 || len(recs[0].Entries) != 2 || len(recs[0].Outputs) != 4 {
+			t.Errorf("sweepRetention(c, now, true) = %#v; want 2 entries and 4 outputs of api-production", recs)
+		}
+		if got, err := readEntries("api-production"); err != nil || len(got) != 5 {
+			t.Errorf("readEntries(%q) = %d entries, %v after dry run; want 5 entries", "api-production", len(got), err)
+		}
+
+		if _, err := sweepRetention(c, now, false); err != nil {
+			t.Fatalf("sweepRetention(c, now, false) failed with %v", err)
+		}
+		got, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		if want := entryIDs(history[2:]); !reflect.DeepEqual(entryIDs(got), want) {
+			t.Errorf("entries = %q after sweep; want %q", entryIDs(got), want)
+		}
+		for i, e := range history {
+			if got, want := fileExists(outputPath("api-production", e)), i == len(history)-1; got != want {
+				t.Errorf("output of %s exists = %v after sweep; want %v", e.ID, got, want)
+			}
+		}
+	})
+}
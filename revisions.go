@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gengo/goship/handlers/commits"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/golang/glog"
+	"github.com/google/go-github/github"
+)
+
+// revisionsEnvName is the name of the environment variable which exports the revisions of all the repositories of
+// a multi-repo project to the deployment command, e.g. "gengo/api=0123abc,gengo/web=4567def". See config.Revisions.
+const revisionsEnvName = "GOSHIP_REVISIONS"
+
+// deployRevisions returns the revisions of the repositories of "proj" which a deployment of "to" into "env" ships.
+// "to" is the revision of the first repository, and the others are deployed from the tips of their branches.
+// It returns nil for single-repo projects.
+func deployRevisions(gcl githublib.Client, proj config.Project, env config.Environment, to revision.Revision) (config.Revisions, error) {
+	if len(proj.Repos) == 0 {
+		return nil, nil
+	}
+	repos := proj.SourceRepos()
+	revs := config.Revisions{repos[0].Name(): string(to)}
+	for _, r := range repos[1:] {
+		branch := r.BranchFor(env)
+		commits, _, err := gcl.ListCommits(r.RepoOwner, r.RepoName, &github.CommitsListOptions{SHA: branch, ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the tip of %s@%s: %v", r.Name(), branch, err)
+		}
+		if len(commits) == 0 || commits[0].SHA == nil {
+			return nil, fmt.Errorf("no commits in %s@%s", r.Name(), branch)
+		}
+		revs[r.Name()] = *commits[0].SHA
+	}
+	return revs, nil
+}
+
+// previousRevisions returns the revisions of the latest successful deployment in "entries" of a multi-repo project,
+// or nil if none of them recorded revisions.
+func previousRevisions(entries []DeployLogEntry) config.Revisions {
+	var latest DeployLogEntry
+	for _, e := range entries {
+		if e.Success && len(e.Revisions) > 0 && e.Time.After(latest.Time) {
+			latest = e
+		}
+	}
+	return latest.Revisions
+}
+
+// deployedRevisions returns the revisions of the repositories of a multi-repo project deployed last into "env" of "proj"
+// according to the deploy log.
+func deployedRevisions(proj, env string) config.Revisions {
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to read deploy log of %s-%s: %v", proj, env, err)
+		}
+		return nil
+	}
+	return previousRevisions(entries)
+}
+
+// lastSuccessfulDeploy returns when "env" of "proj" was deployed into successfully last according to the deploy log,
+// or false if it never was.
+func lastSuccessfulDeploy(proj, env string) (time.Time, bool) {
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to read deploy log of %s-%s: %v", proj, env, err)
+		}
+		return time.Time{}, false
+	}
+	var last time.Time
+	for _, e := range entries {
+		if e.Success && e.Time.After(last) {
+			last = e.Time
+		}
+	}
+	return last, !last.IsZero()
+}
+
+// deployRecords returns the deployments of "env" of "proj" in the deploy log which shipped a revision.
+// Summaries of chains and batches are left out since their steps are recorded on their own.
+func deployRecords(proj, env string) []commits.DeployRecord {
+	entries, err := readEntries(fmt.Sprintf("%s-%s", proj, env))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Failed to read deploy log of %s-%s: %v", proj, env, err)
+		}
+		return nil
+	}
+	return toDeployRecords(entries)
+}
+
+// toDeployRecords converts "entries" of a deploy log into the records which the status is reconciled with.
+func toDeployRecords(entries []DeployLogEntry) []commits.DeployRecord {
+	var records []commits.DeployRecord
+	for _, e := range entries {
+		if len(e.Chain) > 0 || e.Range.To == "" {
+			continue
+		}
+		records = append(records, commits.DeployRecord{Revision: e.Range.To, Time: e.Time, Success: e.Success})
+	}
+	return records
+}
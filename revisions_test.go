@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/handlers/commits"
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/google/go-github/github"
+)
+
+// tipClient is a githublib.Client which serves the tips of branches keyed by "owner/repo@branch".
+type tipClient struct {
+	githublib.Client
+	tips map[string]string
+}
+
+func (c tipClient) ListCommits(owner, repo string, opts *github.CommitsListOptions) ([]github.RepositoryCommit, *github.Response, error) {
+	sha, ok := c.tips[owner+"/"+repo+"@"+opts.SHA]
+	if !ok {
+		return nil, nil, errors.New("not found")
+	}
+	return []github.RepositoryCommit{{SHA: github.String(sha)}}, nil, nil
+}
+
+func TestDeployRevisions(t *testing.T) {
+	api := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}}
+	web := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}}
+	worker := config.RepoRef{Repo: config.Repo{RepoOwner: "gengo", RepoName: "worker"}, Branch: "stable"}
+	proj := config.Project{Name: "shop", Repo: api.Repo, Repos: []config.RepoRef{api, web, worker}}
+	env := config.Environment{Name: "production", Branch: "master"}
+	gcl := tipClient{tips: map[string]string{
+		"gengo/web@master":    "w2",
+		"gengo/worker@stable": "k2",
+		"gengo/worker@master": "k3",
+	}}
+
+	got, err := deployRevisions(gcl, proj, env, "a2")
+	if err != nil {
+		t.Fatalf("deployRevisions(gcl, proj, env, %q) failed with %v", "a2", err)
+	}
+	want := config.Revisions{"gengo/api": "a2", "gengo/web": "w2", "gengo/worker": "k2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deployRevisions(gcl, proj, env, %q) = %v; want %v", "a2", got, want)
+	}
+
+	if _, err := deployRevisions(gcl, proj, config.Environment{Name: "staging", Branch: "develop"}, "a2"); err == nil {
+		t.Errorf("deployRevisions(gcl, proj, env, %q) succeeded without the tip of gengo/web@develop; want failure", "a2")
+	}
+	single := config.Project{Name: "api", Repo: api.Repo}
+	if got, err := deployRevisions(gcl, single, env, "a2"); err != nil || got != nil {
+		t.Errorf("deployRevisions(gcl, single, env, %q) = %v, %v; want nil for a single-repo project", "a2", got, err)
+	}
+}
+
+func TestPreviousRevisions(t *testing.T) {
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	entries := []DeployLogEntry{
+		{Time: now.Add(-time.Hour), Success: true, Revisions: config.Revisions{"gengo/api": "a1", "gengo/web": "w1"}},
+		{Time: now, Success: false, Revisions: config.Revisions{"gengo/api": "a3", "gengo/web": "w3"}},
+		{Time: now.Add(-2 * time.Hour), Success: true, Revisions: config.Revisions{"gengo/api": "a0", "gengo/web": "w0"}},
+		// recorded before the project had several repositories.
+		{Time: now.Add(-time.Minute), Success: true},
+	}
+	want := config.Revisions{"gengo/api": "a1", "gengo/web": "w1"}
+	if got := previousRevisions(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("previousRevisions(entries) = %v; want %v", got, want)
+	}
+	if got := previousRevisions(nil); got != nil {
+		t.Errorf("previousRevisions(nil) = %v; want nil", got)
+	}
+}
+
+func TestToDeployRecords(t *testing.T) {
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	entries := []DeployLogEntry{
+		{Range: RevRange{From: "a0", To: "a1"}, Time: now.Add(-time.Hour), Success: true},
+		{Range: RevRange{From: "a1", To: "a2"}, Time: now},
+		// the summary of a chain whose steps are recorded on their own.
+		{Range: RevRange{From: "a1", To: "a2"}, Time: now, Chain: []ChainStep{{Project: "api", Environment: "production"}}},
+		{Time: now.Add(time.Minute), Success: true},
+	}
+	want := []commits.DeployRecord{
+		{Revision: "a1", Time: now.Add(-time.Hour), Success: true},
+		{Revision: "a2", Time: now},
+	}
+	if got := toDeployRecords(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("toDeployRecords(entries) = %#v; want %#v", got, want)
+	}
+}
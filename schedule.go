@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/schedule"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// scheduleInterval is how often the leader checks the schedules of environments, which is the granularity of cron.
+	scheduleInterval = time.Minute
+	// scheduleUser is the deployer of scheduled deployments.
+	scheduleUser = "goship"
+)
+
+// scheduledDeployer deploys environments on their schedules. Only the leader runs it.
+type scheduledDeployer struct {
+	load  func() (config.Config, error)
+	store schedule.Store
+	now   func() time.Time
+	// latest returns the revisions deployed into "env" and the latest one of its branch.
+	latest func(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error)
+	// deploy deploys "rng" into "env" on behalf of "user". It returns false if the deployment failed, and an error if it was refused.
+	deploy func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error)
+	// record records skipped runs.
+	record func(e activity.Entry)
+}
+
+func newScheduledDeployer(ecl *etcd.Client, feed *activity.Feed, d DeployHandler) scheduledDeployer {
+	return scheduledDeployer{
+		load:   func() (config.Config, error) { return config.Load(ecl) },
+		store:  schedule.NewEtcdStore(ecl),
+		now:    time.Now,
+		latest: d.latestRange,
+		deploy: func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error) {
+			return d.deploy(ctx, c, user, proj, env, rng, RevRange{}, deployOptions{Note: note})
+		},
+		record: feed.Record,
+	}
+}
+
+// run runs the enabled schedules which have become due.
+func (d scheduledDeployer) run(ctx context.Context) {
+	c, err := d.load()
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	now := d.now()
+	for _, proj := range c.Projects {
+		for _, env := range proj.Environments {
+			for i, s := range env.Schedules {
+				if s.Enabled {
+					d.tick(ctx, c, proj, env, i, s, now)
+				}
+			}
+		}
+	}
+}
+
+// tick runs the "i"-th schedule "s" of "env" if it has become due at "now", and records how it went.
+func (d scheduledDeployer) tick(ctx context.Context, c config.Config, proj config.Project, env config.Environment, i int, s config.Schedule, now time.Time) {
+	key := schedule.Key(proj.Name, env.Name, i)
+	expr, err := s.Expr()
+	if err != nil {
+		glog.Errorf("Invalid schedule %s: %v", key, err)
+		return
+	}
+	run, err := schedule.Tick(d.store, key, expr, s.Grace(), now)
+	if err != nil {
+		glog.Errorf("Failed to check schedule %s: %v", key, err)
+		return
+	}
+	if run == nil {
+		return
+	}
+	ctx = reqlog.NewContext(ctx, reqlog.NewID())
+	result := d.execute(ctx, c, proj, env, s, *run)
+	reqlog.Infof(ctx, "Scheduled deployment of %s-%s at %s: %s", proj.Name, env.Name, run.At, result)
+	if err := schedule.Record(d.store, key, result); err != nil {
+		glog.Errorf("Failed to record the result of schedule %s: %v", key, err)
+	}
+}
+
+// execute deploys "env" for "run" of "s" unless it must be skipped, and returns how it went.
+func (d scheduledDeployer) execute(ctx context.Context, c config.Config, proj config.Project, env config.Environment, s config.Schedule, run schedule.Run) string {
+	switch {
+	case run.Skip != "":
+		return d.skip(proj, env, s, run.Skip)
+	case env.IsLocked():
+		return d.skip(proj, env, s, "environment is locked")
+	case env.ConfirmPhrase != "":
+		return d.skip(proj, env, s, "environment requires its "+config.ConfirmChallenge)
+	}
+	env.Branch = s.BranchOf(env)
+	rng, err := d.latest(ctx, c, proj, env)
+	if err != nil {
+		return d.skip(proj, env, s, fmt.Sprintf("could not resolve revisions: %v", err))
+	}
+	if rng.From == rng.To {
+		return d.skip(proj, env, s, fmt.Sprintf("%s is already deployed", rng.To.Short()))
+	}
+	ok, err := d.deploy(ctx, c, scheduleUser, proj, env, rng, fmt.Sprintf("scheduled deploy (%s)", s.Cron))
+	switch {
+	case err != nil:
+		return d.skip(proj, env, s, err.Error())
+	case !ok:
+		return fmt.Sprintf("failed to deploy %s", rng.To.Short())
+	}
+	return fmt.Sprintf("deployed %s", rng.To.Short())
+}
+
+// skip records that a run of "s" was skipped for "reason", and returns the result of the run.
+func (d scheduledDeployer) skip(proj config.Project, env config.Environment, s config.Schedule, reason string) string {
+	d.record(activity.Entry{
+		Type:        activity.ScheduleSkipped,
+		Project:     proj.Name,
+		Environment: env.Name,
+		User:        scheduleUser,
+		Summary:     fmt.Sprintf("skipped the scheduled deploy (%s) of %s-%s: %s", s.Cron, proj.Name, env.Name, reason),
+	})
+	return "skipped: " + reason
+}
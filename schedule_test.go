@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/schedule"
+	"golang.org/x/net/context"
+)
+
+// scheduleFixture is a scheduledDeployer with a fake clock which records deployments and skips.
+type scheduleFixture struct {
+	d        scheduledDeployer
+	now      time.Time
+	deployed []string
+	skipped  []string
+	// refused makes deployments refused with the error.
+	refused error
+}
+
+func newScheduleFixture(envs ...config.Environment) *scheduleFixture {
+	f := &scheduleFixture{now: time.Date(2016, 3, 1, 1, 0, 0, 0, time.UTC)}
+	c := config.Config{Projects: []config.Project{
+		{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: envs},
+	}}
+	f.d = scheduledDeployer{
+		load:  func() (config.Config, error) { return c, nil },
+		store: schedule.NewMemoryStore(),
+		now:   func() time.Time { return f.now },
+		latest: func(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error) {
+			if env.Branch == "release" {
+				return RevRange{From: "1111111111", To: "3333333333"}, nil
+			}
+			return RevRange{From: "1111111111", To: "2222222222"}, nil
+		},
+		deploy: func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error) {
+			if f.refused != nil {
+				return false, f.refused
+			}
+			f.deployed = append(f.deployed, fmt.Sprintf("%s %s-%s %s..%s %q", user, proj.Name, env.Name, rng.From.Short(), rng.To.Short(), note))
+			return true, nil
+		},
+		record: func(e activity.Entry) {
+			if e.Type != activity.ScheduleSkipped {
+				panic(fmt.Sprintf("unexpected activity %#v", e))
+			}
+			f.skipped = append(f.skipped, e.Summary)
+		},
+	}
+	return f
+}
+
+// at runs the schedules after "d" passed.
+func (f *scheduleFixture) at(d time.Duration) {
+	f.now = f.now.Add(d)
+	f.d.run(context.Background())
+}
+
+func nightlyStaging() config.Environment {
+	return config.Environment{Name: "staging", Branch: "master", Schedules: []config.Schedule{{Cron: "0 2 * * *", Enabled: true}}}
+}
+
+func TestScheduledDeployFires(t *testing.T) {
+	env := nightlyStaging()
+	env.Schedules = append(env.Schedules,
+		config.Schedule{Cron: "30 2 * * *", Revision: config.ScheduleBranch, Branch: "release", Enabled: true},
+		config.Schedule{Cron: "0 3 * * *"},
+	)
+	f := newScheduleFixture(env)
+	for _, d := range []time.Duration{0, time.Hour, time.Minute, 30 * time.Minute, time.Hour} {
+		f.at(d)
+	}
+	want := []string{
+		`goship api-staging 1111111..2222222 "scheduled deploy (0 2 * * *)"`,
+		`goship api-staging 1111111..3333333 "scheduled deploy (30 2 * * *)"`,
+	}
+	if !reflect.DeepEqual(f.deployed, want) {
+		t.Errorf("deployed %q; want %q", f.deployed, want)
+	}
+	if len(f.skipped) > 0 {
+		t.Errorf("skipped %q; want none", f.skipped)
+	}
+	st, err := f.d.store.Get(schedule.Key("api", "staging", 0))
+	if err != nil || st.Result != "deployed 2222222" {
+		t.Errorf("state = %#v, %v; want the result recorded", st, err)
+	}
+}
+
+func TestScheduledDeploySkips(t *testing.T) {
+	for _, spec := range []struct {
+		desc    string
+		env     func(e *config.Environment)
+		refused error
+		skip    bool
+		want    string
+	}{
+		{desc: "locked", env: func(e *config.Environment) { e.Lock = &config.EnvironmentLock{By: "alice"} }, want: "environment is locked"},
+		{desc: "confirmed", env: func(e *config.Environment) { e.ConfirmPhrase = "ship api" }, want: "requires its"},
+		{desc: "up to date", env: func(e *config.Environment) { e.Branch = "deployed" }, want: "1111111 is already deployed"},
+		{desc: "refused", refused: errors.New("2222222 is blocklisted"), want: "2222222 is blocklisted"},
+		{desc: "skip requested", skip: true, want: schedule.SkipRequested},
+	} {
+		env := nightlyStaging()
+		if spec.env != nil {
+			spec.env(&env)
+		}
+		f := newScheduleFixture(env)
+		f.refused = spec.refused
+		if env.Branch == "deployed" {
+			f.d.latest = func(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error) {
+				return RevRange{From: "1111111111", To: "1111111111"}, nil
+			}
+		}
+		f.at(0)
+		if spec.skip {
+			if err := schedule.SetSkipNext(f.d.store, schedule.Key("api", "staging", 0), true); err != nil {
+				t.Fatalf("schedule.SetSkipNext(...) failed with %v", err)
+			}
+		}
+		f.at(time.Hour)
+		if len(f.deployed) > 0 {
+			t.Errorf("deployed %q when %s; want none", f.deployed, spec.desc)
+		}
+		if len(f.skipped) != 1 || !strings.Contains(f.skipped[0], spec.want) {
+			t.Errorf("skipped %q when %s; want one with %q", f.skipped, spec.desc, spec.want)
+		}
+		st, err := f.d.store.Get(schedule.Key("api", "staging", 0))
+		if err != nil || !strings.HasPrefix(st.Result, "skipped: ") {
+			t.Errorf("state = %#v, %v when %s; want the skip recorded", st, err, spec.desc)
+		}
+	}
+}
+
+func TestScheduledDeployRecovery(t *testing.T) {
+	for _, spec := range []struct {
+		desc string
+		// down is how long goship was down after the schedule started.
+		down     time.Duration
+		deployed int
+		skipped  int
+	}{
+		{desc: "within the grace period", down: 3*24*time.Hour + time.Hour + 20*time.Minute, deployed: 1},
+		{desc: "after the grace period", down: 3*24*time.Hour + 2*time.Hour, skipped: 1},
+	} {
+		f := newScheduleFixture(nightlyStaging())
+		f.at(0)
+		f.at(spec.down)
+		f.at(time.Minute)
+		if len(f.deployed) != spec.deployed || len(f.skipped) != spec.skipped {
+			t.Errorf("deployed %q and skipped %q %s; want %d deployment and %d skip", f.deployed, f.skipped, spec.desc, spec.deployed, spec.skipped)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gengo/goship/lib/migrations"
+	"github.com/golang/glog"
+)
+
+// schemaMigrationInterval is how often the leader looks for pending schema migrations.
+// It is a single read once the store is up to date.
+const schemaMigrationInterval = 10 * time.Minute
+
+// runSchemaMigrations applies the pending schema migrations of "s", or only logs the keys which they would change if "dryRun".
+func runSchemaMigrations(s migrations.Store, dryRun bool) {
+	res, err := migrations.Run(s, dryRun)
+	if err != nil {
+		glog.Errorf("Failed to migrate the schema of the store: %v", err)
+		return
+	}
+	if res.From == res.To {
+		return
+	}
+	if !dryRun {
+		glog.Infof("Migrated the schema of the store from version %d to %d with %d changes", res.From, res.To, len(res.Changes))
+		return
+	}
+	glog.Infof("Dry run: migrating the schema of the store from version %d to %d would make %d changes", res.From, res.To, len(res.Changes))
+	// values are left out since they can contain secrets.
+	for _, c := range res.Changes {
+		if c.Deleted {
+			glog.Infof("Dry run: would delete %s", c.Key)
+		} else {
+			glog.Infof("Dry run: would set %s", c.Key)
+		}
+	}
+}
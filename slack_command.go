@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/activity"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// maxSlackCommandPayload is the maximum size of slash command and interaction payloads which are accepted.
+	maxSlackCommandPayload = 64 << 10
+	// maxSlackSkew is how old slash commands can be. Older ones are refused as replays.
+	maxSlackSkew = 5 * time.Minute
+	// slackHistoryLen is the number of deployments which the history subcommand shows.
+	slackHistoryLen = 5
+	// maxSuggestions is the number of names suggested for an unknown project or environment.
+	maxSuggestions = 3
+)
+
+// slackCommandUsage is the reply to unknown subcommands.
+const slackCommandUsage = "Usage:\n" +
+	"`status <project> [environment]` shows deployed and latest revisions\n" +
+	"`deploy <project> <environment> [revision] [-- note]` deploys the latest revision of the branch unless specified\n" +
+	"`lock <project> <environment>` and `unlock <project> <environment>` lock and unlock an environment\n" +
+	"`history <project> <environment>` shows the latest deployments"
+
+// slackMessage is a reply to a slash command, either as the response or posted to its response_url.
+type slackMessage struct {
+	// ResponseType is "ephemeral", which only the user sees, or "in_channel".
+	ResponseType string `json:"response_type,omitempty"`
+	Text         string `json:"text"`
+	// ReplaceOriginal replaces the message whose button was pressed instead of posting a new one.
+	ReplaceOriginal bool `json:"replace_original,omitempty"`
+}
+
+func ephemeral(format string, args ...interface{}) slackMessage {
+	return slackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf(format, args...)}
+}
+
+// validSlackSignature returns true iff "sig" in X-Slack-Signature is the HMAC-SHA256 of "payload" sent at "ts"
+// with "secret", and "ts" in X-Slack-Request-Timestamp is within maxSlackSkew from "now".
+func validSlackSignature(sig, ts string, payload []byte, secret string, now time.Time) bool {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > maxSlackSkew || d < -maxSlackSkew {
+		return false
+	}
+	if !strings.HasPrefix(sig, "v0=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "v0="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// notFoundMessage tells that "kind" named "name" does not exist, and suggests similar "candidates" if any.
+func notFoundMessage(kind, name string, candidates []string) slackMessage {
+	msg := ephemeral("No %s named %q.", kind, name)
+	if s := config.SuggestNames(name, candidates); len(s) > 0 {
+		if len(s) > maxSuggestions {
+			s = s[:maxSuggestions]
+		}
+		msg.Text += fmt.Sprintf(" Did you mean %s?", strings.Join(s, ", "))
+	} else if len(candidates) > 0 {
+		msg.Text += fmt.Sprintf(" Try one of %s.", strings.Join(candidates, ", "))
+	}
+	return msg
+}
+
+// slackCommand is a parsed slash command.
+type slackCommand struct {
+	sub  string
+	args []string
+	// note is the text after "--".
+	note string
+	// responseURL is where follow-ups are posted.
+	responseURL string
+}
+
+// parseSlackCommand parses the text of a slash command, e.g. "deploy api production abc123 -- hotfix".
+func parseSlackCommand(text, responseURL string) slackCommand {
+	var note string
+	if i := strings.Index(text, " -- "); i >= 0 {
+		text, note = text[:i], strings.TrimSpace(text[i+len(" -- "):])
+	}
+	fields := strings.Fields(text)
+	cmd := slackCommand{note: note, responseURL: responseURL}
+	if len(fields) > 0 {
+		cmd.sub, cmd.args = strings.ToLower(fields[0]), fields[1:]
+	}
+	return cmd
+}
+
+// slackCommandHandler runs slash commands of Slack on behalf of the goship users who the Slack users are mapped to by
+// slack.users of the config. Commands must be signed with slack.signing_secret. Deployments are acknowledged at once,
+// and their results are posted to the response_url of the command when they finish.
+// i.e. POST http://127.0.0.1:8000/integrations/slack/command with "text=deploy api production"
+type slackCommandHandler struct {
+	ac   acl.AccessControl
+	load func() (config.Config, error)
+	// feed records locks and unlocks.
+	feed *activity.Feed
+	now  func() time.Time
+
+	// latest returns the revisions deployed into "env" and the latest one of its branch.
+	latest func(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error)
+	// deploy deploys "rng" into "env" on behalf of "user". It returns false if the deployment failed.
+	deploy func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error)
+	// lock locks "env" of "proj" with "l", or unlocks it if "l" is nil.
+	lock func(proj, env string, l *config.EnvironmentLock) error
+	// history returns the deploy history of "env" of "proj".
+	history func(proj, env string) ([]DeployLogEntry, error)
+	// respond posts a follow-up to the response_url of a command.
+	respond func(url string, msg slackMessage) error
+	// async runs follow-ups of commands.
+	async func(f func())
+}
+
+func newSlackCommandHandler(ac acl.AccessControl, ecl *etcd.Client, feed *activity.Feed, d DeployHandler) slackCommandHandler {
+	return slackCommandHandler{
+		ac:     ac,
+		load:   func() (config.Config, error) { return config.Load(ecl) },
+		feed:   feed,
+		now:    time.Now,
+		latest: d.latestRange,
+		deploy: func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error) {
+			return d.deploy(ctx, c, user, proj, env, rng, RevRange{}, deployOptions{Note: note})
+		},
+		lock: func(proj, env string, l *config.EnvironmentLock) error {
+			if err := config.LockEnvironment(ecl, proj, env, l); err != nil || l != nil {
+				return err
+			}
+			return config.ClearAutoLock(ecl, proj, env)
+		},
+		history: func(proj, env string) ([]DeployLogEntry, error) {
+			return readEntries(fmt.Sprintf("%s-%s", proj, env))
+		},
+		respond: postSlackResponse,
+		async:   func(f func()) { go f() },
+	}
+}
+
+// postSlackResponse posts "msg" to the response_url "u" of a slash command or an interaction.
+func postSlackResponse(u string, msg slackMessage) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(u, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response_url responded %s", resp.Status)
+	}
+	return nil
+}
+
+// readSlackRequest returns the config and the form of "r", which is a POST request signed by Slack with slack.signing_secret.
+// It responds with an error and returns false if "r" is not.
+func readSlackRequest(w http.ResponseWriter, r *http.Request, load func() (config.Config, error), now time.Time) (config.Config, url.Values, bool) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return config.Config{}, nil, false
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlackCommandPayload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return config.Config{}, nil, false
+	}
+	c, err := load()
+	if err != nil {
+		glog.Errorf("Failed to load configuration: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return config.Config{}, nil, false
+	}
+	if c.Slack == nil || c.Slack.SigningSecret == "" {
+		http.Error(w, "slack signing_secret not configured", http.StatusForbidden)
+		return config.Config{}, nil, false
+	}
+	if !validSlackSignature(r.Header.Get("X-Slack-Signature"), r.Header.Get("X-Slack-Request-Timestamp"), payload, c.Slack.SigningSecret, now) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return config.Config{}, nil, false
+	}
+	form, err := url.ParseQuery(string(payload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return config.Config{}, nil, false
+	}
+	return c, form, true
+}
+
+func (h slackCommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, form, ok := readSlackRequest(w, r, h.load, h.now())
+	if !ok {
+		return
+	}
+
+	var msg slackMessage
+	if name, ok := c.Slack.Users[form.Get("user_id")]; !ok {
+		msg = ephemeral("Your Slack account %s is not mapped to a goship user. Ask an admin to add it to slack.users.", form.Get("user_id"))
+	} else {
+		ctx := reqlog.NewContext(context.Background(), reqlog.FromRequest(r))
+		u := auth.User{Name: name, Provider: auth.ProviderSlack}
+		msg = h.run(ctx, c, u, parseSlackCommand(form.Get("text"), form.Get("response_url")))
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		glog.Errorf("Failed to marshal response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(buf); err != nil {
+		glog.Errorf("Failed to send response: %v", err)
+	}
+}
+
+// run runs "cmd" on behalf of "u" and returns the immediate reply.
+func (h slackCommandHandler) run(ctx context.Context, c config.Config, u auth.User, cmd slackCommand) slackMessage {
+	write := cmd.sub == "deploy" || cmd.sub == "lock" || cmd.sub == "unlock"
+	switch cmd.sub {
+	case "status", "deploy", "lock", "unlock", "history":
+	default:
+		return ephemeral("%s", slackCommandUsage)
+	}
+	if len(cmd.args) < 1 || (cmd.sub != "status" && len(cmd.args) < 2) {
+		return ephemeral("%s", slackCommandUsage)
+	}
+	ac := acl.ForUser(h.ac, c, u)
+	projs := acl.ReadableProjects(ac, c.Projects, u)
+	var names []string
+	for _, p := range projs {
+		names = append(names, p.Name)
+	}
+	p, err := config.FindProject(projs, cmd.args[0])
+	if err != nil {
+		return notFoundMessage("project", cmd.args[0], names)
+	}
+	proj := *p
+	repo := proj.SourceRepo()
+	if write && !ac.Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		return ephemeral("You do not have permission to deploy %s.", proj.Name)
+	}
+	envs := proj.Environments
+	if len(cmd.args) >= 2 {
+		_, env, err := config.ResolveTarget([]config.Project{proj}, proj.Name, cmd.args[1])
+		if err != nil {
+			var envNames []string
+			for _, e := range proj.Environments {
+				envNames = append(envNames, e.Name)
+			}
+			return notFoundMessage("environment of "+proj.Name, cmd.args[1], envNames)
+		}
+		envs = []config.Environment{*env}
+	}
+
+	switch cmd.sub {
+	case "status":
+		h.async(func() { h.followUp(ctx, cmd, h.status(ctx, c, proj, envs)) })
+		return ephemeral("Checking %s...", proj.Name)
+	case "deploy":
+		return h.startDeploy(ctx, c, u, proj, envs[0], cmd)
+	case "lock", "unlock":
+		locked := cmd.sub == "lock"
+		var l *config.EnvironmentLock
+		if locked {
+			l = &config.EnvironmentLock{By: u.Name, Since: h.now()}
+		}
+		if err := h.lock(proj.Name, envs[0].Name, l); err != nil {
+			reqlog.Errorf(ctx, "Failed to %s %s-%s: %v", cmd.sub, proj.Name, envs[0].Name, err)
+			return ephemeral("Failed to %s %s %s: %v", cmd.sub, proj.Name, envs[0].Name, err)
+		}
+		e := activity.Entry{Type: activity.Unlocked, Project: proj.Name, Environment: envs[0].Name, User: u.Name, Summary: fmt.Sprintf("%s unlocked %s-%s", u.Name, proj.Name, envs[0].Name)}
+		if locked {
+			e.Type, e.Summary = activity.Locked, fmt.Sprintf("%s locked %s-%s", u.Name, proj.Name, envs[0].Name)
+		}
+		if h.feed != nil {
+			h.feed.Record(e)
+		}
+		return slackMessage{ResponseType: "in_channel", Text: fmt.Sprintf("%s %sed %s *%s*.", u.Name, cmd.sub, proj.Name, envs[0].Name)}
+	}
+	return h.recent(proj, envs[0])
+}
+
+// followUp posts "msg" to the response_url of "cmd".
+func (h slackCommandHandler) followUp(ctx context.Context, cmd slackCommand, msg slackMessage) {
+	if err := h.respond(cmd.responseURL, msg); err != nil {
+		reqlog.Errorf(ctx, "Failed to post a follow-up of %s command: %v", cmd.sub, err)
+	}
+}
+
+// status returns the deployed and the latest revisions of "envs".
+func (h slackCommandHandler) status(ctx context.Context, c config.Config, proj config.Project, envs []config.Environment) slackMessage {
+	var lines []string
+	for _, e := range envs {
+		line := fmt.Sprintf("*%s*: ", e.Name)
+		rng, err := h.latest(ctx, c, proj, e)
+		switch {
+		case err != nil:
+			line += fmt.Sprintf("unknown (%v)", err)
+		case rng.From == rng.To:
+			line += fmt.Sprintf("%s, up to date", rng.To.Short())
+		default:
+			line += fmt.Sprintf("%s deployed, %s latest on %s", shortOrUnknown(rng.From), rng.To.Short(), e.Branch)
+		}
+		if e.IsLocked() {
+			line += " (locked)"
+		}
+		lines = append(lines, line)
+	}
+	return ephemeral("%s\n%s", proj.Name, strings.Join(lines, "\n"))
+}
+
+func shortOrUnknown(rev revision.Revision) string {
+	if rev == "" {
+		return "nothing"
+	}
+	return string(rev.Short())
+}
+
+// startDeploy starts deploying "env" as requested by "cmd" in background, and returns the acknowledgment.
+// The result is posted to the response_url of "cmd" when the deployment finishes.
+func (h slackCommandHandler) startDeploy(ctx context.Context, c config.Config, u auth.User, proj config.Project, env config.Environment, cmd slackCommand) slackMessage {
+	if env.IsLocked() {
+		return ephemeral("%s %s is locked.", proj.Name, env.Name)
+	}
+	if env.ConfirmPhrase != "" {
+		return ephemeral("%s %s requires its %s; deploy it from the web UI.", proj.Name, env.Name, config.ConfirmChallenge)
+	}
+	if err := env.ValidateDeployNote(cmd.note); err != nil {
+		return ephemeral("%v. Give a note after \"--\", e.g. `deploy %s %s -- reason`.", err, proj.Name, env.Name)
+	}
+	var to revision.Revision
+	if len(cmd.args) >= 3 {
+		to = revision.Revision(cmd.args[2])
+	}
+	h.async(func() {
+		rng, err := h.latest(ctx, c, proj, env)
+		if err != nil {
+			reqlog.Errorf(ctx, "Could not resolve revisions of %s-%s: %v", proj.Name, env.Name, err)
+			h.followUp(ctx, cmd, ephemeral("Could not deploy %s %s: %v", proj.Name, env.Name, err))
+			return
+		}
+		if to != "" {
+			rng.To = to
+		}
+		ok, err := h.deploy(ctx, c, u.Name, proj, env, rng, cmd.note)
+		msg := slackMessage{ResponseType: "in_channel", Text: fmt.Sprintf("%s deployed %s into %s *%s*.", u.Name, rng.To.Short(), proj.Name, env.Name)}
+		switch {
+		case err == errApprovalRequested:
+			msg.Text = fmt.Sprintf("%s requested approval to deploy %s into %s *%s*.", u.Name, rng.To.Short(), proj.Name, env.Name)
+		case err != nil:
+			msg.Text = fmt.Sprintf("%s could not deploy %s into %s *%s*: %v", u.Name, rng.To.Short(), proj.Name, env.Name, err)
+		case !ok:
+			msg.Text = fmt.Sprintf("%s failed to deploy %s into %s *%s*. See %s", u.Name, rng.To.Short(), proj.Name, env.Name, deployLogURL(proj.Name, env.Name))
+		}
+		h.followUp(ctx, cmd, msg)
+	})
+	target := "the latest revision of " + env.Branch
+	if to != "" {
+		target = string(to.Short())
+	}
+	return ephemeral("Deploying %s into %s %s. The result will be posted here.", target, proj.Name, env.Name)
+}
+
+// recent returns the latest deployments into "env".
+func (h slackCommandHandler) recent(proj config.Project, env config.Environment) slackMessage {
+	entries, err := h.history(proj.Name, env.Name)
+	if err != nil || len(entries) == 0 {
+		return ephemeral("No deployments of %s %s.", proj.Name, env.Name)
+	}
+	sort.Sort(ByTime(entries))
+	lines := []string{fmt.Sprintf("Latest deployments of %s %s:", proj.Name, env.Name)}
+	for i := 0; i < len(entries) && i < slackHistoryLen; i++ {
+		e := entries[i]
+		status := "deployed"
+		if !e.Success {
+			status = "failed to deploy"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", e.Time.UTC().Format("2006-01-02 15:04"), e.User, status, e.Range.To.Short()))
+	}
+	return ephemeral("%s", strings.Join(lines, "\n"))
+}
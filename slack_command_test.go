@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/config"
+	"golang.org/x/net/context"
+)
+
+func signSlack(payload, ts, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, payload)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSlackSignature(t *testing.T) {
+	now := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	payload := "text=status+api&user_id=U1"
+	for _, spec := range []struct {
+		desc, sig, ts string
+		want          bool
+	}{
+		{desc: "valid", sig: signSlack(payload, ts, "secret"), ts: ts, want: true},
+		{desc: "wrong secret", sig: signSlack(payload, ts, "other"), ts: ts},
+		{desc: "signed another timestamp", sig: signSlack(payload, "1443700000", "secret"), ts: ts},
+		{desc: "replayed", sig: signSlack(payload, "1443700000", "secret"), ts: "1443700000"},
+		{desc: "no version", sig: strings.TrimPrefix(signSlack(payload, ts, "secret"), "v0="), ts: ts},
+		{desc: "malformed", sig: "v0=zz", ts: ts},
+		{desc: "no timestamp", sig: signSlack(payload, "", "secret"), ts: ""},
+	} {
+		if got := validSlackSignature(spec.sig, spec.ts, []byte(payload), "secret", now); got != spec.want {
+			t.Errorf("validSlackSignature(%s) = %v; want %v", spec.desc, got, spec.want)
+		}
+	}
+}
+
+// slackAccessControl allows everyone to read, and only "deployers" to deploy.
+type slackAccessControl struct {
+	deployers []string
+}
+
+func (a slackAccessControl) Readable(owner, repo, user string) bool {
+	return true
+}
+
+func (a slackAccessControl) Deployable(owner, repo, user string) bool {
+	for _, d := range a.deployers {
+		if d == user {
+			return true
+		}
+	}
+	return false
+}
+
+// slackFixture is a slackCommandHandler with fake operations which records what they are called with.
+type slackFixture struct {
+	h         slackCommandHandler
+	now       time.Time
+	deployed  []string
+	locks     map[string]bool
+	followUps []slackMessage
+}
+
+func newSlackFixture() *slackFixture {
+	f := &slackFixture{now: time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC), locks: make(map[string]bool)}
+	c := config.Config{
+		Slack: &config.SlackConfiguration{SigningSecret: "secret", Users: map[string]string{"U1": "alice", "U2": "bob"}},
+		Projects: []config.Project{
+			{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{
+				{Name: "staging", Branch: "master"},
+				{Name: "production", Branch: "master", RequireDeployNote: true},
+				{Name: "dr", Branch: "master", Lock: &config.EnvironmentLock{By: "bob"}},
+				{Name: "secure", Branch: "master", ConfirmPhrase: "ship api"},
+			}},
+			{Name: "web", Repo: config.Repo{RepoOwner: "gengo", RepoName: "web"}, Environments: []config.Environment{{Name: "production", Branch: "master"}}},
+		},
+	}
+	f.h = slackCommandHandler{
+		ac:   slackAccessControl{deployers: []string{"alice"}},
+		load: func() (config.Config, error) { return c, nil },
+		now:  func() time.Time { return f.now },
+		latest: func(ctx context.Context, c config.Config, proj config.Project, env config.Environment) (RevRange, error) {
+			if env.Name == "staging" {
+				return RevRange{From: "1111111111", To: "2222222222"}, nil
+			}
+			return RevRange{From: "2222222222", To: "2222222222"}, nil
+		},
+		deploy: func(ctx context.Context, c config.Config, user string, proj config.Project, env config.Environment, rng RevRange, note string) (bool, error) {
+			f.deployed = append(f.deployed, fmt.Sprintf("%s %s-%s %s..%s %q", user, proj.Name, env.Name, rng.From.Short(), rng.To.Short(), note))
+			return rng.To != "bad", nil
+		},
+		lock: func(proj, env string, l *config.EnvironmentLock) error {
+			f.locks[proj+"-"+env] = l != nil
+			return nil
+		},
+		history: func(proj, env string) ([]DeployLogEntry, error) {
+			if env != "staging" {
+				return nil, errors.New("no such file")
+			}
+			return []DeployLogEntry{
+				{User: "bob", Success: true, Time: f.now.Add(-2 * time.Hour), Range: RevRange{To: "1111111111"}},
+				{User: "alice", Success: false, Time: f.now.Add(-time.Hour), Range: RevRange{To: "2222222222"}},
+			}, nil
+		},
+		respond: func(u string, msg slackMessage) error {
+			if u != "https://hooks.slack.com/commands/1" {
+				return fmt.Errorf("unexpected response_url %s", u)
+			}
+			f.followUps = append(f.followUps, msg)
+			return nil
+		},
+		// runs follow-ups before responding so that tests see them.
+		async: func(fn func()) { fn() },
+	}
+	return f
+}
+
+// command runs the slash command "text" as the Slack user "userID" and returns the immediate reply.
+func (f *slackFixture) command(t *testing.T, userID, text string) slackMessage {
+	payload := url.Values{"command": {"/goship"}, "text": {text}, "user_id": {userID}, "response_url": {"https://hooks.slack.com/commands/1"}}.Encode()
+	ts := strconv.FormatInt(f.now.Unix(), 10)
+	r, err := http.NewRequest("POST", "/integrations/slack/command", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("http.NewRequest failed with %v", err)
+	}
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", signSlack(payload, ts, "secret"))
+	w := httptest.NewRecorder()
+	f.h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%q responded %d %q; want %d", text, w.Code, w.Body.String(), http.StatusOK)
+	}
+	var msg slackMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatalf("json.Unmarshal(%q) failed with %v", w.Body.String(), err)
+	}
+	return msg
+}
+
+func TestSlackCommandRefusesUnsigned(t *testing.T) {
+	f := newSlackFixture()
+	payload := "text=deploy+api+staging&user_id=U1"
+	r, err := http.NewRequest("POST", "/integrations/slack/command", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("http.NewRequest failed with %v", err)
+	}
+	r.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(f.now.Unix(), 10))
+	r.Header.Set("X-Slack-Signature", signSlack(payload, strconv.FormatInt(f.now.Unix(), 10), "forged"))
+	w := httptest.NewRecorder()
+	f.h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("forged command responded %d; want %d", w.Code, http.StatusForbidden)
+	}
+	if len(f.deployed) > 0 {
+		t.Errorf("deployed %q by a forged command", f.deployed)
+	}
+}
+
+func TestSlackCommandDeploy(t *testing.T) {
+	f := newSlackFixture()
+	msg := f.command(t, "U1", "deploy api staging")
+	if msg.ResponseType != "ephemeral" || !strings.Contains(msg.Text, "Deploying the latest revision of master into api staging") {
+		t.Errorf("reply = %#v; want an ephemeral acknowledgment", msg)
+	}
+	if want := []string{`alice api-staging 1111111..2222222 ""`}; !reflect.DeepEqual(f.deployed, want) {
+		t.Errorf("deployed %q; want %q", f.deployed, want)
+	}
+	if len(f.followUps) != 1 || f.followUps[0].ResponseType != "in_channel" || f.followUps[0].Text != "alice deployed 2222222 into api *staging*." {
+		t.Errorf("follow-ups = %#v; want the result in the channel", f.followUps)
+	}
+
+	f = newSlackFixture()
+	f.command(t, "U1", "deploy api production 3333333 -- hotfix for login")
+	f.command(t, "U1", "deploy api staging bad")
+	if want := []string{`alice api-production 2222222..3333333 "hotfix for login"`, `alice api-staging 1111111..bad ""`}; !reflect.DeepEqual(f.deployed, want) {
+		t.Errorf("deployed %q; want %q", f.deployed, want)
+	}
+	if len(f.followUps) != 2 || !strings.Contains(f.followUps[1].Text, "alice failed to deploy bad into api *staging*") {
+		t.Errorf("follow-ups = %#v; want the failure reported", f.followUps)
+	}
+}
+
+func TestSlackCommandRefusals(t *testing.T) {
+	for _, spec := range []struct {
+		user, text, want string
+	}{
+		{user: "U9", text: "deploy api staging", want: "not mapped to a goship user"},
+		{user: "U2", text: "deploy api staging", want: "You do not have permission to deploy api."},
+		{user: "U2", text: "lock api staging", want: "You do not have permission to deploy api."},
+		{user: "U1", text: "deploy api dr", want: "api dr is locked."},
+		{user: "U1", text: "deploy api secure", want: "deploy it from the web UI"},
+		{user: "U1", text: "deploy api production", want: "Give a note after"},
+		{user: "U1", text: "deploy apu staging", want: `No project named "apu". Did you mean api?`},
+		{user: "U1", text: "deploy api stagign", want: `No environment of api named "stagign". Did you mean staging?`},
+		{user: "U1", text: "deploy billing staging", want: "Try one of api, web."},
+		{user: "U1", text: "deploy api", want: "Usage:"},
+		{user: "U1", text: "rollback api staging", want: "Usage:"},
+		{user: "U1", text: "", want: "Usage:"},
+	} {
+		f := newSlackFixture()
+		msg := f.command(t, spec.user, spec.text)
+		if msg.ResponseType != "ephemeral" || !strings.Contains(msg.Text, spec.want) {
+			t.Errorf("%q by %s replied %#v; want ephemeral %q", spec.text, spec.user, msg, spec.want)
+		}
+		if len(f.deployed) > 0 || len(f.locks) > 0 || len(f.followUps) > 0 {
+			t.Errorf("%q by %s deployed %q, locked %v and followed up %#v; want nothing", spec.text, spec.user, f.deployed, f.locks, f.followUps)
+		}
+	}
+}
+
+func TestSlackCommandStatus(t *testing.T) {
+	f := newSlackFixture()
+	msg := f.command(t, "U2", "status api")
+	if msg.ResponseType != "ephemeral" || msg.Text != "Checking api..." {
+		t.Errorf("reply = %#v; want an acknowledgment", msg)
+	}
+	want := "api\n*staging*: 1111111 deployed, 2222222 latest on master\n*production*: 2222222, up to date\n*dr*: 2222222, up to date (locked)\n*secure*: 2222222, up to date"
+	if len(f.followUps) != 1 || f.followUps[0].Text != want {
+		t.Errorf("follow-ups = %#v; want %q", f.followUps, want)
+	}
+
+	f = newSlackFixture()
+	f.command(t, "U2", "status api staging")
+	if len(f.followUps) != 1 || f.followUps[0].Text != "api\n*staging*: 1111111 deployed, 2222222 latest on master" {
+		t.Errorf("follow-ups = %#v; want the status of staging", f.followUps)
+	}
+}
+
+func TestSlackCommandLock(t *testing.T) {
+	f := newSlackFixture()
+	if msg := f.command(t, "U1", "lock api staging"); msg.ResponseType != "in_channel" || msg.Text != "alice locked api *staging*." {
+		t.Errorf("reply = %#v; want the lock announced", msg)
+	}
+	if !f.locks["api-staging"] {
+		t.Errorf("api-staging not locked")
+	}
+	if msg := f.command(t, "U1", "unlock api staging"); msg.Text != "alice unlocked api *staging*." {
+		t.Errorf("reply = %#v; want the unlock announced", msg)
+	}
+	if f.locks["api-staging"] {
+		t.Errorf("api-staging not unlocked")
+	}
+}
+
+func TestSlackCommandHistory(t *testing.T) {
+	f := newSlackFixture()
+	want := "Latest deployments of api staging:\n2015-10-01 11:00 alice failed to deploy 2222222\n2015-10-01 10:00 bob deployed 1111111"
+	if msg := f.command(t, "U2", "history api staging"); msg.Text != want {
+		t.Errorf("reply = %q; want %q", msg.Text, want)
+	}
+	if msg := f.command(t, "U2", "history api production"); msg.Text != "No deployments of api production." {
+		t.Errorf("reply = %q; want no deployments", msg.Text)
+	}
+}
+
+func TestParseSlackCommand(t *testing.T) {
+	got := parseSlackCommand("Deploy  api production abc123 -- fix -- login ", "https://hooks.slack.com/commands/1")
+	want := slackCommand{sub: "deploy", args: []string{"api", "production", "abc123"}, note: "fix -- login", responseURL: "https://hooks.slack.com/commands/1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSlackCommand(...) = %#v; want %#v", got, want)
+	}
+}
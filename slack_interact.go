@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/reqlog"
+	"golang.org/x/net/context"
+)
+
+// slackInteraction is the payload of a block action, i.e. a click on a button of a message.
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// slackInteractionHandler handles the Approve and Reject buttons on approval requests posted by notifier.Slack
+// on behalf of the goship users who the Slack users are mapped to by slack.users of the config.
+// Interactions must be signed with slack.signing_secret. The outcome replaces the message with the buttons,
+// and approved deployments start as their requesters.
+// i.e. POST http://127.0.0.1:8000/integrations/slack/interact with "payload={...}"
+type slackInteractionHandler struct {
+	ac        acl.AccessControl
+	load      func() (config.Config, error)
+	approvals *notifier.Reminders
+	now       func() time.Time
+	// deploy starts the deployment of an approved request.
+	deploy func(ctx context.Context, a notifier.Approval) error
+	// async runs approved deployments.
+	async func(f func())
+	// respond posts a reply to the response_url of an interaction.
+	respond func(url string, msg slackMessage) error
+}
+
+func newSlackInteractionHandler(ac acl.AccessControl, ecl *etcd.Client, approvals *notifier.Reminders, dh DeployHandler) slackInteractionHandler {
+	return slackInteractionHandler{
+		ac:        ac,
+		load:      func() (config.Config, error) { return config.Load(ecl) },
+		approvals: approvals,
+		now:       time.Now,
+		deploy:    dh.deployApproved,
+		async:     func(f func()) { go f() },
+		respond:   postSlackResponse,
+	}
+}
+
+func (h slackInteractionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, form, ok := readSlackRequest(w, r, h.load, h.now())
+	if !ok {
+		return
+	}
+	var in slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Slack expects an empty 200 as the acknowledgment. Replies go to the response_url.
+	if in.Type != "block_actions" || len(in.Actions) == 0 {
+		return
+	}
+	action := in.Actions[0]
+	if action.ActionID != notifier.SlackActionApprove && action.ActionID != notifier.SlackActionReject {
+		return
+	}
+	ctx := reqlog.NewContext(context.Background(), reqlog.FromRequest(r))
+	var msg slackMessage
+	if name, ok := c.Slack.Users[in.User.ID]; !ok {
+		msg = ephemeral("Your Slack account %s is not mapped to a goship user. Ask an admin to add it to slack.users.", in.User.ID)
+	} else {
+		u := auth.User{Name: name, Provider: auth.ProviderSlack}
+		msg = h.resolve(ctx, c, u, action.Value, action.ActionID == notifier.SlackActionApprove, in.ResponseURL)
+	}
+	if err := h.respond(in.ResponseURL, msg); err != nil {
+		reqlog.Errorf(ctx, "Failed to reply to %s of approval request %s: %v", action.ActionID, action.Value, err)
+	}
+}
+
+// resolve approves or rejects the request "id" on behalf of "u", starts the deployment if approved, and returns the reply.
+// Replies which tell the request is no longer pending replace the message with the buttons.
+// Failures to start the deployment are replied later to "responseURL".
+func (h slackInteractionHandler) resolve(ctx context.Context, c config.Config, u auth.User, id string, approved bool, responseURL string) slackMessage {
+	a, err := h.approvals.Get(id)
+	if err != nil {
+		return slackMessage{ReplaceOriginal: true, Text: "This approval request is no longer pending."}
+	}
+	proj, err := config.FindProject(c.Projects, a.Event.Project)
+	if err != nil {
+		return slackMessage{ReplaceOriginal: true, Text: fmt.Sprintf("Project %s of this approval request no longer exists.", a.Event.Project)}
+	}
+	repo := proj.SourceRepo()
+	if !acl.ForUser(h.ac, c, u).Deployable(repo.RepoOwner, repo.RepoName, u.Name) {
+		return ephemeral("You do not have permission to deploy %s.", proj.Name)
+	}
+
+	a, err = h.approvals.Resolve(id, u.Name, approved)
+	switch err {
+	case nil:
+	case notifier.ErrSelfApproval:
+		return ephemeral("You cannot approve your own deployment of %s to %s. Ask another approver.", a.Event.Project, a.Event.Environment)
+	case notifier.ErrApprovalResolved:
+		return slackMessage{ReplaceOriginal: true, Text: notifier.Message(a.Resolved())}
+	case notifier.ErrApprovalExpired:
+		return slackMessage{ReplaceOriginal: true, Text: fmt.Sprintf("The request by %s to deploy %s to *%s* expired at %s.", a.Event.User, a.Event.Project, a.Event.Environment, a.Expires.UTC().Format("2006-01-02 15:04 MST"))}
+	default:
+		reqlog.Errorf(ctx, "Failed to resolve approval request %s: %v", id, err)
+		return ephemeral("Failed to resolve the approval request: %v", err)
+	}
+
+	if a.Resolution == notifier.Approved {
+		h.async(func() {
+			if err := h.deploy(ctx, a); err != nil {
+				reqlog.Errorf(ctx, "Failed to deploy approved request %s: %v", id, err)
+				if err := h.respond(responseURL, ephemeral("Could not deploy %s to %s: %v", a.Event.Project, a.Event.Environment, err)); err != nil {
+					reqlog.Errorf(ctx, "Failed to reply to approval request %s: %v", id, err)
+				}
+			}
+		})
+	}
+	return slackMessage{ReplaceOriginal: true, Text: notifier.Message(a.Resolved())}
+}
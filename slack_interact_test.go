@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gengo/goship/lib/acl"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/etcdtest"
+	"github.com/gengo/goship/lib/notifier"
+	"golang.org/x/net/context"
+)
+
+// notifierFunc is a notifier.Notifier which calls itself.
+type notifierFunc func(e notifier.Event) error
+
+func (f notifierFunc) Notify(e notifier.Event) error { return f(e) }
+
+// slackInteractionFixture is a slackInteractionHandler with a pending request "deploy-1" by carol,
+// which records the replies, the notified events and the started deployments.
+type slackInteractionFixture struct {
+	h        slackInteractionHandler
+	now      time.Time
+	replies  []slackMessage
+	notified []string
+	deployed []string
+}
+
+func newSlackInteractionFixture(t *testing.T) *slackInteractionFixture {
+	f := &slackInteractionFixture{now: time.Now()}
+	c := config.Config{
+		Slack:       &config.SlackConfiguration{SigningSecret: "secret", Users: map[string]string{"U1": "alice", "U2": "bob", "U3": "carol"}},
+		ChatHandles: map[string]string{"carol": "carol.s"},
+		Projects: []config.Project{
+			{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Environments: []config.Environment{{Name: "production", Branch: "master"}}},
+		},
+	}
+	load := func() (config.Config, error) { return c, nil }
+	approvals := notifier.NewReminders(etcdtest.NewStore(), time.Hour, load, func(config.Config, string, string) notifier.Notifier {
+		return notifierFunc(func(e notifier.Event) error {
+			f.notified = append(f.notified, notifier.Message(e))
+			return nil
+		})
+	})
+	if err := approvals.Request(notifier.Event{ID: "deploy-1", Project: "api", Environment: "production", User: "carol"}, f.now.Add(time.Hour), nil); err != nil {
+		t.Fatalf("approvals.Request(...) failed with %v", err)
+	}
+	f.notified = nil
+	f.h = slackInteractionHandler{
+		ac:        slackAccessControl{deployers: []string{"alice", "carol"}},
+		load:      load,
+		approvals: approvals,
+		now:       func() time.Time { return f.now },
+		deploy: func(ctx context.Context, a notifier.Approval) error {
+			f.deployed = append(f.deployed, a.Event.ID)
+			return nil
+		},
+		async: func(f func()) { f() },
+		respond: func(u string, msg slackMessage) error {
+			if u != "https://hooks.slack.com/actions/1" {
+				return fmt.Errorf("unexpected response_url %s", u)
+			}
+			f.replies = append(f.replies, msg)
+			return nil
+		},
+	}
+	return f
+}
+
+// click presses the button "action" of the request "id" as the Slack user "userID", and returns the reply.
+func (f *slackInteractionFixture) click(t *testing.T, userID, action, id string) slackMessage {
+	in := fmt.Sprintf(`{"type": "block_actions", "user": {"id": %q}, "actions": [{"action_id": %q, "value": %q}], "response_url": "https://hooks.slack.com/actions/1"}`, userID, action, id)
+	payload := url.Values{"payload": {in}}.Encode()
+	ts := strconv.FormatInt(f.now.Unix(), 10)
+	r, err := http.NewRequest("POST", "/integrations/slack/interact", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("http.NewRequest failed with %v", err)
+	}
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", signSlack(payload, ts, "secret"))
+	w := httptest.NewRecorder()
+	n := len(f.replies)
+	f.h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s of %s responded %d %q; want %d", action, id, w.Code, w.Body.String(), http.StatusOK)
+	}
+	if len(f.replies) != n+1 {
+		t.Fatalf("replies = %#v after %s of %s; want a reply", f.replies, action, id)
+	}
+	return f.replies[n]
+}
+
+func TestSlackInteractionApprove(t *testing.T) {
+	f := newSlackInteractionFixture(t)
+	msg := f.click(t, "U1", notifier.SlackActionApprove, "deploy-1")
+	want := slackMessage{ReplaceOriginal: true, Text: "alice approved deployment of api to *production*."}
+	if msg != want {
+		t.Errorf("reply = %#v; want %#v", msg, want)
+	}
+	if want := []string{"@carol.s alice approved deployment of api to *production*."}; !reflect.DeepEqual(f.notified, want) {
+		t.Errorf("notified %q; want %q", f.notified, want)
+	}
+	if want := []string{"deploy-1"}; !reflect.DeepEqual(f.deployed, want) {
+		t.Errorf("deployed %q; want %q", f.deployed, want)
+	}
+
+	// the message of the resolved request can be clicked again before it is replaced.
+	msg = f.click(t, "U1", notifier.SlackActionReject, "deploy-1")
+	if !msg.ReplaceOriginal || msg.Text != "alice approved deployment of api to *production*." {
+		t.Errorf("reply = %#v; want the message replaced with the resolution", msg)
+	}
+	if len(f.notified) != 1 || len(f.deployed) != 1 {
+		t.Errorf("notified %q and deployed %q; want no more", f.notified, f.deployed)
+	}
+}
+
+func TestSlackInteractionReject(t *testing.T) {
+	f := newSlackInteractionFixture(t)
+	msg := f.click(t, "U1", notifier.SlackActionReject, "deploy-1")
+	want := slackMessage{ReplaceOriginal: true, Text: "alice rejected deployment of api to *production*."}
+	if msg != want {
+		t.Errorf("reply = %#v; want %#v", msg, want)
+	}
+	if a, err := f.h.approvals.Get("deploy-1"); err != nil || a.Resolution != notifier.Rejected || a.Approver != "alice" {
+		t.Errorf("approvals.Get(%q) = %#v, %v; want rejected by alice", "deploy-1", a, err)
+	}
+	if len(f.deployed) != 0 {
+		t.Errorf("deployed %q; want nothing", f.deployed)
+	}
+}
+
+func TestSlackInteractionSelfApproval(t *testing.T) {
+	f := newSlackInteractionFixture(t)
+	msg := f.click(t, "U3", notifier.SlackActionApprove, "deploy-1")
+	if msg.ReplaceOriginal || msg.ResponseType != "ephemeral" || !strings.Contains(msg.Text, "cannot approve your own deployment") {
+		t.Errorf("reply = %#v; want an ephemeral refusal", msg)
+	}
+	if a, err := f.h.approvals.Get("deploy-1"); err != nil || a.Resolution != "" {
+		t.Errorf("approvals.Get(%q) = %#v, %v; want still pending", "deploy-1", a, err)
+	}
+	if len(f.notified) != 0 {
+		t.Errorf("notified %q; want nothing", f.notified)
+	}
+
+	// requesters can withdraw their requests.
+	msg = f.click(t, "U3", notifier.SlackActionReject, "deploy-1")
+	if !msg.ReplaceOriginal || msg.Text != "carol rejected deployment of api to *production*." {
+		t.Errorf("reply = %#v; want the rejection", msg)
+	}
+}
+
+func TestSlackInteractionExpired(t *testing.T) {
+	f := newSlackInteractionFixture(t)
+	expires := f.now.Add(-time.Minute)
+	if err := f.h.approvals.Request(notifier.Event{ID: "deploy-2", Project: "api", Environment: "production", User: "carol"}, expires, nil); err != nil {
+		t.Fatalf("approvals.Request(...) failed with %v", err)
+	}
+	f.notified = nil
+	msg := f.click(t, "U1", notifier.SlackActionApprove, "deploy-2")
+	want := slackMessage{ReplaceOriginal: true, Text: fmt.Sprintf("The request by carol to deploy api to *production* expired at %s.", expires.UTC().Format("2006-01-02 15:04 MST"))}
+	if msg != want {
+		t.Errorf("reply = %#v; want %#v", msg, want)
+	}
+	if len(f.notified) != 0 || len(f.deployed) != 0 {
+		t.Errorf("notified %q and deployed %q; want nothing", f.notified, f.deployed)
+	}
+}
+
+func TestSlackInteractionRefused(t *testing.T) {
+	for _, spec := range []struct {
+		desc, userID, id string
+		want             slackMessage
+	}{
+		{desc: "unknown request", userID: "U1", id: "deploy-2", want: slackMessage{ReplaceOriginal: true, Text: "This approval request is no longer pending."}},
+		{desc: "unmapped user", userID: "U9", id: "deploy-1", want: ephemeral("Your Slack account U9 is not mapped to a goship user. Ask an admin to add it to slack.users.")},
+		{desc: "no permission", userID: "U2", id: "deploy-1", want: ephemeral("You do not have permission to deploy api.")},
+	} {
+		f := newSlackInteractionFixture(t)
+		if msg := f.click(t, spec.userID, notifier.SlackActionApprove, spec.id); msg != spec.want {
+			t.Errorf("reply to %s = %#v; want %#v", spec.desc, msg, spec.want)
+		}
+		if a, err := f.h.approvals.Get("deploy-1"); err != nil || a.Resolution != "" {
+			t.Errorf("approvals.Get(%q) = %#v, %v after %s; want still pending", "deploy-1", a, err, spec.desc)
+		}
+	}
+}
+
+func TestSlackInteractionRefusesUnsigned(t *testing.T) {
+	f := newSlackInteractionFixture(t)
+	in := `{"type": "block_actions", "user": {"id": "U1"}, "actions": [{"action_id": "approve", "value": "deploy-1"}]}`
+	payload := url.Values{"payload": {in}}.Encode()
+	r, err := http.NewRequest("POST", "/integrations/slack/interact", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("http.NewRequest failed with %v", err)
+	}
+	ts := strconv.FormatInt(f.now.Unix(), 10)
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", signSlack(payload, ts, "forged"))
+	w := httptest.NewRecorder()
+	f.h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("forged interaction responded %d; want %d", w.Code, http.StatusForbidden)
+	}
+	if a, err := f.h.approvals.Get("deploy-1"); err != nil || a.Resolution != "" {
+		t.Errorf("approvals.Get(%q) = %#v, %v; want still pending", "deploy-1", a, err)
+	}
+}
+
+// TestApprovalFlow makes sure that deployments into environments which require approval wait for the Approve button on Slack.
+func TestApprovalFlow(t *testing.T) {
+	withDataPath(t, func() {
+		s := etcdtest.NewStore()
+		env := config.Environment{Name: "production", Branch: "master", Deploy: "/bin/true", Hosts: []config.Host{{Name: "prod1"}}, RequireApproval: true}
+		proj := config.Project{Name: "api", Repo: config.Repo{RepoOwner: "gengo", RepoName: "api"}, Approvers: []string{"alice"}, Environments: []config.Environment{env}}
+		c := config.Config{
+			Slack:    &config.SlackConfiguration{SigningSecret: "secret", Users: map[string]string{"U1": "alice"}},
+			Projects: []config.Project{proj},
+		}
+		if err := config.Store(s, c); err != nil {
+			t.Fatalf("config.Store(s, c) failed with %v", err)
+		}
+		h, _, done := newTestDeployHandler(s)
+		defer done()
+		load := func() (config.Config, error) { return config.Load(h.ecl) }
+		var events []notifier.Event
+		h.approvals = notifier.NewReminders(s, time.Hour, load, func(config.Config, string, string) notifier.Notifier {
+			return notifierFunc(func(e notifier.Event) error {
+				events = append(events, e)
+				return nil
+			})
+		})
+
+		rng := RevRange{From: "abc123", To: "def456"}
+		if ok, err := h.deploy(context.Background(), c, "carol", proj, env, rng, RevRange{}, deployOptions{Note: "hotfix"}); ok || err != errApprovalRequested {
+			t.Fatalf("h.deploy(...) = %t, %v; want %v", ok, err, errApprovalRequested)
+		}
+		if entries, _ := readEntries("api-production"); len(entries) != 0 {
+			t.Fatalf("deployed %#v before approval; want nothing", entries)
+		}
+		if len(events) != 1 || events[0].Type != notifier.ApprovalRequested || !reflect.DeepEqual(events[0].Mentions, []string{"alice"}) {
+			t.Fatalf("notified %#v; want an approval request mentioning alice", events)
+		}
+
+		f := &slackInteractionFixture{now: time.Now()}
+		f.h = slackInteractionHandler{
+			ac:        acl.Null,
+			load:      load,
+			approvals: h.approvals,
+			now:       time.Now,
+			deploy:    h.deployApproved,
+			async:     func(f func()) { f() },
+			respond: func(u string, msg slackMessage) error {
+				f.replies = append(f.replies, msg)
+				return nil
+			},
+		}
+		msg := f.click(t, "U1", notifier.SlackActionApprove, events[0].ID)
+		if want := "alice approved deployment of api to *production*."; msg.Text != want {
+			t.Errorf("reply = %#v; want %q", msg, want)
+		}
+
+		entries, err := readEntries("api-production")
+		if err != nil {
+			t.Fatalf("readEntries(%q) failed with %v", "api-production", err)
+		}
+		if len(entries) != 1 || !entries[0].Success || entries[0].User != "carol" || entries[0].Range.To != "def456" || entries[0].Note != "hotfix" {
+			t.Errorf("entries = %#v; want a successful deployment of def456 by carol", entries)
+		}
+	})
+}
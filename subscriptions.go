@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gengo/goship/lib/config"
+	githublib "github.com/gengo/goship/lib/github"
+	"github.com/gengo/goship/lib/notifier"
+	"github.com/gengo/goship/lib/reqlog"
+	"github.com/gengo/goship/lib/revision"
+	"github.com/gengo/goship/lib/subscriptions"
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// notifySubscribers sends "ev" of the successful deployment of "deploy" into "env" of "proj" to each user subscribed to it,
+// with the commits of the user which it shipped. Failures are only logged since the deployment has finished anyway.
+func notifySubscribers(ctx context.Context, c config.Config, ecl config.ETCDInterface, gcl githublib.Client, proj config.Project, env config.Environment, deploy RevRange, ev notifier.Event) {
+	all, err := subscriptions.List(ecl)
+	if err != nil {
+		reqlog.Errorf(ctx, "Failed to load subscriptions: %v", err)
+	}
+	if !subscriptions.Subscribed(all, proj.Name, env.Name) {
+		return
+	}
+	commits, err := shippedCommits(gcl, proj, deploy)
+	if err != nil {
+		// subscribers of the environment are still notified without their commits.
+		reqlog.Errorf(ctx, "Failed to list the commits of %s-%s from %s to %s: %v", proj.Name, env.Name, deploy.From.Short(), deploy.To.Short(), err)
+	}
+	d := notifier.NewDirect(c)
+	for _, dl := range subscriptions.Resolve(all, proj.Name, env.Name, commits) {
+		e := ev
+		e.Type, e.Mentions, e.Commits = notifier.CommitsShipped, nil, nil
+		for _, cm := range dl.Commits {
+			e.Commits = append(e.Commits, fmt.Sprintf("%s %s", revision.Revision(cm.SHA).Short(), cm.Subject))
+		}
+		if err := d.Send(notifier.Recipient{User: dl.User, Email: dl.Email}, e); err != nil {
+			reqlog.Errorf(ctx, "Failed to notify %s of the deployment of %s-%s: %v", dl.User, proj.Name, env.Name, err)
+		}
+	}
+}
+
+// shippedCommits returns the commits of "proj" which "deploy" shipped, with the GitHub logins of their authors.
+// It returns none for first deployments.
+func shippedCommits(gcl githublib.Client, proj config.Project, deploy RevRange) ([]subscriptions.Commit, error) {
+	if deploy.From == "" || deploy.From == deploy.To || proj.RepoType == config.RepoTypeDocker {
+		return nil, nil
+	}
+	repo := proj.SourceRepo()
+	cmp, _, err := gcl.CompareCommits(repo.RepoOwner, repo.RepoName, string(deploy.From), string(deploy.To))
+	if err != nil {
+		return nil, err
+	}
+	return commitsOf(cmp.Commits), nil
+}
+
+// commitsOf converts "rcs" into commits matched against subscriptions.
+func commitsOf(rcs []github.RepositoryCommit) []subscriptions.Commit {
+	var commits []subscriptions.Commit
+	for _, rc := range rcs {
+		var c subscriptions.Commit
+		if rc.SHA != nil {
+			c.SHA = *rc.SHA
+		}
+		if rc.Author != nil && rc.Author.Login != nil {
+			c.Author = *rc.Author.Login
+		}
+		if rc.Commit != nil && rc.Commit.Message != nil {
+			c.Subject = strings.SplitN(*rc.Commit.Message, "\n", 2)[0]
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
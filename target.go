@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/reqlog"
+)
+
+// respondTargetError replies to the request "id" with "err" of resolving the project or the environment it names, in JSON.
+// The body suggests the names which the client might have meant if the name is unknown.
+func respondTargetError(w http.ResponseWriter, id string, err error) {
+	reqlog.ErrorWithSuggestions(w, id, err.Error(), config.StatusCode(err), config.Suggestions(err))
+}
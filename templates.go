@@ -0,0 +1,70 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gengo/goship/lib/auth"
+	"github.com/gengo/goship/lib/config"
+	"github.com/gengo/goship/lib/i18n"
+	"github.com/gengo/goship/lib/proxy"
+	helpers "github.com/gengo/goship/lib/view-helpers"
+	"github.com/gengo/goship/plugins/plugin"
+	"github.com/golang/glog"
+)
+
+// defaultTemplatesDir is the directory of the default page templates.
+const defaultTemplatesDir = "templates"
+
+// pageNames are the page templates which goship renders.
+var pageNames = []string{"index.html", "deploy.html", "deploy_log.html", "tokens.html", "activity.html", "wallboard.html", "subscriptions.html"}
+
+// newPages parses the page templates, overridden by ones in "overrideDir" if not empty.
+func newPages(overrideDir string) (*helpers.Pages, error) {
+	// handlers replace these functions with ones bound to their requests.
+	funcs := template.FuncMap{
+		"renderHeader":  plugin.RenderHeader,
+		"renderDetail":  plugin.RenderDetail,
+		"hostTags":      func(config.Host) []string { return nil },
+		"isFavorite":    func(string) bool { return false },
+		"hasDependents": func(string) bool { return false },
+		"url":           proxy.Path,
+	}
+	for name, fn := range i18n.New(i18n.English, nil).Funcs() {
+		funcs[name] = fn
+	}
+	return helpers.NewPages(defaultTemplatesDir, overrideDir, funcs, pageNames...)
+}
+
+// templatesReloadHandler parses the page templates again, so that changes of the override templates take effect without restart.
+// The current templates are kept if any of them fails to parse. Only admins can reload them.
+// i.e. POST http://127.0.0.1:8000/admin/templates/reload
+type templatesReloadHandler struct {
+	pages   *helpers.Pages
+	isAdmin func(user string) bool
+}
+
+func (h templatesReloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, err := auth.CurrentUser(r)
+	if err != nil {
+		glog.Errorf("Failed to get current user: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !h.isAdmin(u.Name) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	if err := h.pages.Reload(); err != nil {
+		glog.Errorf("Failed to reload templates: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	glog.Infof("%s reloaded templates", u.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
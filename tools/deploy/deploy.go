@@ -153,12 +153,12 @@ func main() {
 		if err != nil {
 			glog.Fatalf("Error parsing ETCD: %s", err)
 		}
-		projectEnv, err := gsconfig.EnvironmentFromName(c.Projects, *deployProj, *deployEnv)
+		_, projectEnv, err := gsconfig.EnvironmentFromName(c.Projects, *deployProj, *deployEnv)
 		if err != nil {
 			glog.Fatalf("Error getting project %s %s %s", *deployProj, *deployEnv, err)
 		}
 		glog.Infof("Deploying project name: %s environment Name: %s", *deployEnv, projectEnv.Name)
-		for _, h := range projectEnv.Hosts {
+		for _, h := range gsconfig.HostNames(projectEnv.Hosts) {
 			var cmd []string
 			if *bootstrap {
 				cmd = []string{
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/gengo/goship/lib/config"
@@ -16,6 +17,7 @@ var (
 	dump     = flag.Bool("dump", false, "dumps configs from etcd")
 	dumpV1   = flag.Bool("dump-v1", false, "same as -dump but reads from old structure of etcd directory")
 	store    = flag.Bool("store", false, "store configs into etcd")
+	author   = flag.String("author", os.Getenv("USER"), "who is recorded in the config history as the author of -store")
 )
 
 func dumpCfg(cfg config.Config, err error) error {
@@ -43,13 +45,32 @@ func storeCfg(ecl *etcd.Client) error {
 		glog.Errorf("Failed to marshal config: %v", err)
 		return err
 	}
-	return config.Store(ecl, cfg)
+	if err := config.Store(ecl, cfg); err != nil {
+		return err
+	}
+	// records the projects as loaded, i.e. with defaults and secrets decrypted.
+	stored, err := config.Load(ecl)
+	if err != nil {
+		glog.Errorf("Failed to load the stored config: %v", err)
+		return err
+	}
+	for _, p := range cfg.Projects {
+		if _, err := config.RecordVersion(ecl, stored, p.Name, *author, "stored by goshipcfg", time.Now()); err != nil {
+			glog.Errorf("Failed to record the config of %s in its history: %v", p.Name, err)
+		}
+	}
+	return nil
 }
 
 func main() {
 	flag.Parse()
 	defer glog.Flush()
 
+	keys, err := config.LoadKeyring()
+	if err != nil {
+		glog.Fatalf("Failed to load the master key: %v", err)
+	}
+	config.SetKeyring(keys)
 	ecl := etcd.NewClient([]string{*endpoint})
 	switch {
 	case *dump:
@@ -109,7 +109,10 @@ func loadEnvironment(node *etcd.Node) (config.Environment, error) {
 				glog.Errorf("Failed to parse 'locked' field %q. Assuming unlocked: %v", n.Value, err)
 				continue
 			}
-			env.IsLocked = locked
+			if locked {
+				// the v1 layout did not record who locked environments or since when.
+				env.Lock = &config.EnvironmentLock{}
+			}
 		case "comment":
 			env.Comment = n.Value
 		case "hosts":
@@ -126,7 +129,7 @@ func loadHosts(node *etcd.Node, env *config.Environment) error {
 		return fmt.Errorf("node %s must be a directory", node.Key)
 	}
 	for _, h := range node.Nodes {
-		env.Hosts = append(env.Hosts, path.Base(h.Key))
+		env.Hosts = append(env.Hosts, config.Host{Name: path.Base(h.Key)})
 	}
 	return nil
 }